@@ -0,0 +1,627 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/envato/iamy/iamy"
+	"github.com/fatih/color"
+)
+
+type AnalyzeSourceIpCommandInput struct {
+	Dir           string
+	AllowlistFile string
+	ProblemsOnly  bool
+	ResultFiles
+}
+
+// AnalyzeSourceIpCommand reports the aws:SourceIp conditions in the yaml
+// files, exiting with an error if any have problems
+func AnalyzeSourceIpCommand(ui Ui, input AnalyzeSourceIpCommandInput) {
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze source-ip", err)
+		ui.Fatal(err)
+		return
+	}
+
+	var allowlist []*net.IPNet
+	if input.AllowlistFile != "" {
+		f, err := os.Open(input.AllowlistFile)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		allowlist, err = iamy.ReadCidrList(f)
+		f.Close()
+		if err != nil {
+			ui.Fatalf("Error reading %s: %s", input.AllowlistFile, err)
+			return
+		}
+	}
+
+	problems := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		found := map[string][]string{}
+		for _, r := range iamy.SourceIpReport(&account, allowlist) {
+			if len(r.Problems) == 0 {
+				if !input.ProblemsOnly {
+					ui.Printf("%s: %s %s", r.Statement, r.Operator, r.Value)
+				}
+				continue
+			}
+			problems++
+			ui.Printf("%s: %s %s %s", r.Statement, r.Operator, r.Value, color.YellowString("(%s)", strings.Join(r.Problems, ", ")))
+			found[r.Statement.Location()] = append(found[r.Statement.Location()], fmt.Sprintf("%s: %s %s (%s)", r.Statement, r.Operator, r.Value, strings.Join(r.Problems, ", ")))
+		}
+		cases = append(cases, iamy.FileCases("analyze source-ip", &account, found)...)
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if problems > 0 {
+		ui.Error.Printf("Found %d aws:SourceIp ranges with problems", problems)
+		ui.Exit(1)
+	}
+}
+
+type AnalyzeTimeConditionsCommandInput struct {
+	Dir            string
+	ExpiringWithin time.Duration
+	RemoveExpired  bool
+	ResultFiles
+}
+
+// AnalyzeTimeConditionsCommand reports statements limited by date conditions
+// that have expired or expire soon, optionally removing expired statements
+// from the yaml files so the next push deletes them
+func AnalyzeTimeConditionsCommand(ui Ui, input AnalyzeTimeConditionsCommandInput) {
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze time-conditions", err)
+		ui.Fatal(err)
+		return
+	}
+
+	now := time.Now()
+	remaining := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		expired := []iamy.PolicyStatement{}
+		for _, s := range iamy.TimeConditionReport(&account) {
+			switch {
+			case s.Expired(now):
+				expired = append(expired, s.Statement)
+				ui.Printf("%s: %s", s.Statement, color.RedString("expired, was in effect %s", timeConditionWindow(ui, s, now)))
+			case s.ExpiresWithin(now, input.ExpiringWithin):
+				ui.Printf("%s: %s", s.Statement, color.YellowString("expires %s", ui.When(s.End, now)))
+			default:
+				ui.Printf("%s: in effect %s", s.Statement, timeConditionWindow(ui, s, now))
+			}
+		}
+
+		found := map[string][]string{}
+		if len(expired) > 0 && (!input.RemoveExpired || *dryRun) {
+			remaining += len(expired)
+			for _, s := range expired {
+				found[s.Location()] = append(found[s.Location()], s.String()+": expired")
+			}
+		}
+		cases = append(cases, iamy.FileCases("analyze time-conditions", &account, found)...)
+		if len(expired) == 0 || !input.RemoveExpired || *dryRun {
+			continue
+		}
+
+		if err := iamy.RemoveStatements(expired); err != nil {
+			ui.Error.Println(err)
+			remaining++
+		}
+		if err := yaml.Dump(&account, false); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Printf("Removed expired statements from %s, run push to apply", account.Account.String())
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if remaining > 0 {
+		ui.Error.Printf("Found %d expired statements", remaining)
+		ui.Exit(1)
+	}
+}
+
+func timeConditionWindow(ui Ui, s iamy.TimeBoundStatement, now time.Time) string {
+	switch {
+	case s.Start.IsZero():
+		return "until " + ui.When(s.End, now)
+	case s.End.IsZero():
+		return "from " + ui.When(s.Start, now)
+	}
+	return "from " + ui.When(s.Start, now) + " until " + ui.When(s.End, now)
+}
+
+type AnalyzeMfaCommandInput struct {
+	Dir          string
+	Designations iamy.MfaDesignations
+	ResultFiles
+}
+
+// AnalyzeMfaCommand reports the human access groups, policies and users in the
+// yaml files that can act without MFA, exiting with an error if there are any
+func AnalyzeMfaCommand(ui Ui, input AnalyzeMfaCommandInput) {
+	if len(input.Designations.Groups) == 0 && len(input.Designations.Policies) == 0 && input.Designations.UserTag == "" {
+		ui.Fatal("At least one of --human-group, --human-policy or --human-user-tag is required")
+		return
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze mfa", err)
+		ui.Fatal(err)
+		return
+	}
+
+	problems := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		found := map[string][]string{}
+		for _, f := range iamy.MfaReport(&account, input.Designations) {
+			problems++
+			ui.Printf("%s %s: %s", account.Account.String(), f.Principal, color.YellowString(f.Problem))
+			for _, s := range f.Statements {
+				ui.Printf("    %s", s)
+				found[s.Location()] = append(found[s.Location()], fmt.Sprintf("%s: %s, %s", f.Principal, f.Problem, s))
+			}
+			if len(f.Statements) == 0 {
+				found[account.Account.String()] = append(found[account.Account.String()], fmt.Sprintf("%s: %s", f.Principal, f.Problem))
+			}
+		}
+		cases = append(cases, iamy.FileCases("analyze mfa", &account, found)...)
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if problems > 0 {
+		ui.Error.Printf("Found %d principals that can act without MFA", problems)
+		ui.Exit(1)
+	}
+}
+
+type AnalyzeRegionsCommandInput struct {
+	Dir             string
+	ApprovedRegions []string
+	BaselinePolicy  string
+	ResultFiles
+}
+
+// AnalyzeRegionsCommand checks every account in the yaml files denies
+// requests outside the approved regions, and that no policy permits activity
+// in other regions, exiting with an error if any don't
+func AnalyzeRegionsCommand(ui Ui, input AnalyzeRegionsCommandInput) {
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze regions", err)
+		ui.Fatal(err)
+		return
+	}
+
+	problems := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		findings := iamy.RegionReport(&account, input.ApprovedRegions, input.BaselinePolicy)
+		if len(findings) == 0 {
+			ui.Printf("%s: only approved regions are permitted", account.Account.String())
+		}
+		found := map[string][]string{}
+		for _, f := range findings {
+			problems++
+			ui.Println(color.YellowString(f.String()))
+			key := account.Account.String()
+			if f.Statement != nil {
+				key = f.Statement.Location()
+			}
+			found[key] = append(found[key], f.String())
+		}
+		cases = append(cases, iamy.FileCases("analyze regions", &account, found)...)
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if problems > 0 {
+		ui.Error.Printf("Found %d region restriction problems", problems)
+		ui.Exit(1)
+	}
+}
+
+type AnalyzeBoundariesCommandInput struct {
+	Dir string
+	ResultFiles
+}
+
+// AnalyzeBoundariesCommand reports the permissions boundaries in the yaml
+// files that make identity policy grants ineffective or that don't restrict
+// their principal, exiting with an error if there are any
+func AnalyzeBoundariesCommand(ui Ui, input AnalyzeBoundariesCommandInput) {
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze boundaries", err)
+		ui.Fatal(err)
+		return
+	}
+
+	problems := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		found := map[string][]string{}
+		for _, f := range iamy.BoundaryReport(&account) {
+			problems++
+			ui.Printf("%s %s", account.Account.String(), color.YellowString(f.String()))
+			key := account.Account.String()
+			if f.Statement != nil {
+				key = f.Statement.Location()
+			}
+			found[key] = append(found[key], f.String())
+		}
+		cases = append(cases, iamy.FileCases("analyze boundaries", &account, found)...)
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if problems > 0 {
+		ui.Error.Printf("Found %d permissions boundary problems", problems)
+		ui.Exit(1)
+	}
+}
+
+type AnalyzeStaleCommandInput struct {
+	Dir       string
+	OlderThan time.Duration
+	ResultFiles
+}
+
+// AnalyzeStaleCommand reports the users, roles and managed policies in the
+// yaml files that were created more than OlderThan ago but grant or are
+// granted nothing, exiting with an error if there are any
+func AnalyzeStaleCommand(ui Ui, input AnalyzeStaleCommandInput) {
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze stale", err)
+		ui.Fatal(err)
+		return
+	}
+
+	now := time.Now()
+	problems := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		found := map[string][]string{}
+		for _, s := range iamy.StaleReport(&account, now.Add(-input.OlderThan)) {
+			problems++
+			r := fmt.Sprintf("%s/%s%s", s.Resource.ResourceType(), strings.TrimPrefix(s.Resource.ResourcePath(), "/"), s.Resource.ResourceName())
+			ui.Printf("%s %s: %s, created %s", account.Account.String(), r, color.YellowString(s.Problem), ui.When(s.Created, now))
+			found[s.File] = append(found[s.File], fmt.Sprintf("%s: %s, created %s", r, s.Problem, s.Created.Format(time.RFC3339)))
+		}
+		cases = append(cases, iamy.FileCases("analyze stale", &account, found)...)
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if problems > 0 {
+		ui.Error.Printf("Found %d stale resources", problems)
+		ui.Exit(1)
+	}
+}
+
+type AnalyzeEmptyCommandInput struct {
+	Dir           string
+	CheckLastUsed bool
+	UnusedFor     time.Duration
+	Remove        bool
+	ResultFiles
+}
+
+// AnalyzeEmptyCommand reports the groups, managed policies, roles and
+// instance profiles in the yaml files that hold or grant nothing, leaving out
+// the protected ones, optionally removing their files so the next push with
+// --prune deletes them. With CheckLastUsed, roles used in AWS within
+// UnusedFor aren't reported, and without it roles' files aren't removed
+func AnalyzeEmptyCommand(ui Ui, input AnalyzeEmptyCommandInput) {
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze empty", err)
+		ui.Fatal(err)
+		return
+	}
+	protected, err := iamy.LoadProtectedResources(input.Dir)
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze empty", err)
+		ui.Fatal(err)
+		return
+	}
+
+	unusedSince := time.Now().Add(-input.UnusedFor)
+	remaining := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		var lastUsed map[string]time.Time
+		if input.CheckLastUsed {
+			if lastUsed, err = iamy.FetchRoleLastUsed(account.Roles); err != nil {
+				writeResultsError(ui, input.ResultFiles, input.Dir, "analyze empty", err)
+				ui.Fatal(err)
+				return
+			}
+		}
+
+		empty := iamy.EmptyReport(&account, protected, lastUsed, unusedSince)
+		found := map[string][]string{}
+		resources := []iamy.AwsResource{}
+		for _, e := range empty {
+			r := fmt.Sprintf("%s/%s%s", e.Resource.ResourceType(), strings.TrimPrefix(e.Resource.ResourcePath(), "/"), e.Resource.ResourceName())
+			ui.Printf("%s %s: %s", account.Account.String(), r, color.YellowString(e.Problem))
+			if input.Remove && !e.Removable {
+				ui.Error.Printf("Not removing %s %s, it may still be used, run with --check-last-used to remove unused roles", account.Account.String(), r)
+			}
+			if input.Remove && e.Removable && !*dryRun {
+				resources = append(resources, e.Resource)
+				continue
+			}
+			remaining++
+			found[e.File] = append(found[e.File], fmt.Sprintf("%s: %s", r, e.Problem))
+		}
+		cases = append(cases, iamy.FileCases("analyze empty", &account, found)...)
+		if len(resources) == 0 {
+			continue
+		}
+
+		if err := yaml.RemoveResources(account.Account, resources); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Printf("Removed %d empty resources from %s, run push --prune to delete them", len(resources), account.Account.String())
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if remaining > 0 {
+		ui.Error.Printf("Found %d empty resources", remaining)
+		ui.Exit(1)
+	}
+}
+
+type AnalyzeOrgConditionsCommandInput struct {
+	Dir           string
+	MaxAccounts   int
+	InventoryFile string
+	ResultFiles
+}
+
+// AnalyzeOrgConditionsCommand reports statements that enumerate more
+// accounts than MaxAccounts, suggesting the organization condition to
+// replace them with, more specifically with an inventory of the organization
+func AnalyzeOrgConditionsCommand(ui Ui, input AnalyzeOrgConditionsCommandInput) {
+	var inv *iamy.OrgInventory
+	if input.InventoryFile != "" {
+		var err error
+		if inv, err = iamy.LoadOrgInventory(input.InventoryFile); err != nil {
+			writeResultsError(ui, input.ResultFiles, input.Dir, "analyze org-conditions", err)
+			ui.Fatal(err)
+			return
+		}
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze org-conditions", err)
+		ui.Fatal(err)
+		return
+	}
+
+	problems := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		found := map[string][]string{}
+		for _, f := range iamy.OrgConditionReport(&account, input.MaxAccounts, inv) {
+			problems++
+			ui.Println(color.YellowString(f.String()))
+			found[f.Statement.Location()] = append(found[f.Statement.Location()], f.String())
+		}
+		cases = append(cases, iamy.FileCases("analyze org-conditions", &account, found)...)
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if problems > 0 {
+		ui.Error.Printf("Found %d statements enumerating accounts", problems)
+		ui.Exit(1)
+	}
+}
+
+type AnalyzeDuplicatesCommandInput struct {
+	Dir  string
+	Json bool
+}
+
+// AnalyzeDuplicatesCommand reports policy documents stored more than once in
+// the yaml files, within and across accounts. With Json it writes the hash
+// of every policy document instead, for external tooling
+func AnalyzeDuplicatesCommand(ui Ui, input AnalyzeDuplicatesCommandInput) {
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	accounts := []*iamy.AccountData{}
+	for i := range allDataFromYaml {
+		accounts = append(accounts, &allDataFromYaml[i])
+	}
+	index := iamy.NewPolicyIndex(accounts...)
+
+	if input.Json {
+		enc := json.NewEncoder(ui.Writer())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(index.Locations()); err != nil {
+			ui.Fatal(err)
+		}
+		return
+	}
+
+	for _, locations := range index.Duplicates() {
+		ui.Printf("%s stored %d times:", locations[0].Hash[:12], len(locations))
+		for _, l := range locations {
+			ui.Printf("    %s %s", l.File, l.Policy)
+		}
+	}
+}
+
+type AnalyzeQuotasCommandInput struct {
+	Dir    string
+	WarnAt float64
+	// QuotaLimits are raised quota limits, by quota name
+	QuotaLimits map[string]string
+	All         bool
+	ResultFiles
+}
+
+// AnalyzeQuotasCommand reports the IAM quotas the yaml files use at least
+// WarnAt percent of, or with All the usage of every quota, exiting with an
+// error if any quota is exceeded
+func AnalyzeQuotasCommand(ui Ui, input AnalyzeQuotasCommandInput) {
+	limits, err := iamy.ParseQuotaLimits(input.QuotaLimits)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze quotas", err)
+		ui.Fatal(err)
+		return
+	}
+
+	exceeded := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		for _, u := range iamy.QuotaReport(&account, nil, limits) {
+			c := iamy.JUnitCase{Suite: "analyze quotas", ClassName: u.Quota, Name: u.Resource}
+			switch {
+			case u.Used > u.Limit:
+				exceeded++
+				ui.Printf("%s", color.RedString(u.String()))
+				c.Failure = "exceeded: " + u.String()
+			case u.Percent() >= input.WarnAt:
+				ui.Printf("%s", color.YellowString(u.String()))
+			case input.All:
+				ui.Printf("%s", u)
+			}
+			cases = append(cases, c)
+		}
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if exceeded > 0 {
+		ui.Error.Printf("Found %d exceeded quotas", exceeded)
+		ui.Exit(1)
+	}
+}
+
+type AnalyzeBucketPoliciesCommandInput struct {
+	Dir          string
+	MandatesFile string
+	AddMissing   bool
+	ResultFiles
+}
+
+// AnalyzeBucketPoliciesCommand reports the buckets in the yaml files whose
+// policies are missing mandated statements, optionally adding them to the
+// files for the next push, exiting with an error if any are missing
+func AnalyzeBucketPoliciesCommand(ui Ui, input AnalyzeBucketPoliciesCommandInput) {
+	mandatesFile := input.MandatesFile
+	if mandatesFile == "" {
+		mandatesFile = filepath.Join(input.Dir, iamy.BucketPolicyMandatesFileName)
+	}
+	mandates, err := iamy.LoadBucketPolicyMandates(mandatesFile)
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze bucket-policies", err)
+		ui.Fatal(err)
+		return
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeResultsError(ui, input.ResultFiles, input.Dir, "analyze bucket-policies", err)
+		ui.Fatal(err)
+		return
+	}
+
+	missing := 0
+	cases := []iamy.JUnitCase{}
+	for _, account := range allDataFromYaml {
+		findings, err := iamy.BucketPolicyReport(&account, mandates)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		if len(findings) == 0 {
+			ui.Printf("%s: every bucket policy has its mandated statements", account.Account.String())
+		}
+
+		found := map[string][]string{}
+		for _, f := range findings {
+			ui.Println(color.YellowString(f.String()))
+			if !input.AddMissing || *dryRun {
+				missing++
+				found[f.File] = append(found[f.File], f.String())
+			}
+		}
+		cases = append(cases, iamy.FileCases("analyze bucket-policies", &account, found)...)
+		if len(findings) == 0 || !input.AddMissing || *dryRun {
+			continue
+		}
+
+		if err := yaml.WriteResources(account.Account, iamy.AddMissingStatements(findings)); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Printf("Added the missing statements to the bucket policies of %s, run push to apply", account.Account.String())
+	}
+	writeResults(ui, input.ResultFiles, input.Dir, cases)
+
+	if missing > 0 {
+		ui.Error.Printf("Found %d missing bucket policy statements", missing)
+		ui.Exit(1)
+	}
+}
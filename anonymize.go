@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type AnonymizeCommandInput struct {
+	SnapshotFile string
+	Seed         string
+	OutputFile   string
+}
+
+func AnonymizeCommand(ui Ui, input AnonymizeCommandInput) {
+	snapshot := iamy.SnapshotLoadDumper{
+		Path: input.SnapshotFile,
+	}
+	data, err := snapshot.Load()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	anonymiser := iamy.Anonymiser{Seed: input.Seed}
+	anonymised := anonymiser.AccountData(data)
+
+	if input.OutputFile == "" {
+		if err = iamy.WriteSnapshot(os.Stdout, anonymised); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		return
+	}
+
+	out := iamy.SnapshotLoadDumper{
+		Path: input.OutputFile,
+	}
+	if err = out.Dump(anonymised); err != nil {
+		ui.Fatal(err)
+		return
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/envato/iamy/iamy"
+	"github.com/ghodss/yaml"
+)
+
+// BucketPolicyTemplatesCommand lists the bucket policy templates
+func BucketPolicyTemplatesCommand(ui Ui) {
+	for _, t := range iamy.BucketPolicyTemplates {
+		name := t.Name
+		if len(t.Params) > 0 {
+			name += " (" + strings.Join(t.Params, ", ") + ")"
+		}
+		ui.Printf("%-36s %s", name, t.Description)
+	}
+}
+
+type BucketPolicyGenerateCommandInput struct {
+	Templates []string
+	Bucket    string
+	Params    map[string]string
+	Format    string
+}
+
+// BucketPolicyGenerateCommand prints a bucket policy of the templates'
+// statements for the bucket, to paste into its file
+func BucketPolicyGenerateCommand(ui Ui, input BucketPolicyGenerateCommandInput) {
+	doc, err := iamy.BucketPolicyFromTemplates(input.Bucket, input.Templates, input.Params)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err == nil && input.Format == "yaml" {
+		b, err = yaml.JSONToYAML(b)
+	}
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.Println(string(b))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/envato/iamy/iamy"
+	"github.com/fatih/color"
+)
+
+type CheckCommandInput struct {
+	Dir                   string
+	HeuristicCfnMatching  bool
+	SkipTagged            []string
+	IncludeTagged         []string
+	SkipPathPrefixes      []string
+	SkipBucketPrefixes    []string
+	IncludeBucketPatterns []string
+	IncludeControlTower   bool
+	Regions               []string
+	Kinds                 []iamy.ResourceSelector
+	Timings               *iamy.Timings
+	FallbackProfile       string
+	FallbackRoleArn       string
+	ConfigAggregator      string
+	AccountId             string
+	Json                  bool
+	// DriftHistory is the file, or s3://bucket/key, each check's drift is
+	// recorded in, if set
+	DriftHistory string
+	// DriftBudget is how much drift is tolerated, if set, so a check exits
+	// with 2 only once the drift has exceeded it
+	DriftBudget *iamy.DriftBudget
+}
+
+// CheckCommand reports the resources that differ between AWS and the files,
+// with the attributes that differ, without planning any commands. It exits
+// with 2 when there's drift, so scheduled audits can alert on it, or with a
+// drift budget when the drift has stayed above it for its runs
+func CheckCommand(ui Ui, input CheckCommandInput) {
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	ignore, err := iamy.LoadIgnoreCatalogue(input.Dir)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	aws := iamy.AwsFetcher{
+		Debug:                 ui.Debug,
+		HeuristicCfnMatching:  input.HeuristicCfnMatching,
+		SkipTagged:            input.SkipTagged,
+		IncludeTagged:         input.IncludeTagged,
+		SkipPathPrefixes:      input.SkipPathPrefixes,
+		SkipBucketPrefixes:    input.SkipBucketPrefixes,
+		IncludeBucketPatterns: input.IncludeBucketPatterns,
+		IncludeControlTower:   input.IncludeControlTower,
+		Regions:               input.Regions,
+		Ignore:                ignore,
+		Timings:               input.Timings,
+		FallbackProfile:       input.FallbackProfile,
+		FallbackRoleArn:       input.FallbackRoleArn,
+		ConfigAggregator:      input.ConfigAggregator,
+		AccountId:             input.AccountId,
+		Phases:                iamy.TargetFetchPhases(input.Kinds),
+	}
+
+	stop := input.Timings.Track("load yaml")
+	allDataFromYaml, err := yaml.Load()
+	stop()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	dataFromAws, err := aws.Fetch()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.usage.countResources(dataFromAws)
+	ui.PrintWarnings(dataFromAws.Warnings)
+
+	for _, dataFromYaml := range allDataFromYaml {
+		if dataFromYaml.Account.Id != dataFromAws.Account.Id {
+			continue
+		}
+		dataFromYaml = *aws.WithoutIgnored(&dataFromYaml)
+		ui.PrintWarnings(dataFromYaml.Warnings)
+
+		kinds := input.Kinds
+		if input.ConfigAggregator != "" && len(kinds) == 0 {
+			// the aggregator only has IAM data, so only IAM drift is checked
+			kinds, _ = iamy.ParseResourceKinds([]string{"user,group,role,policy,instance-profile"}, false)
+		}
+		if len(kinds) > 0 {
+			dataFromAws, dataFromYaml = iamy.FilterResourceKinds(dataFromAws, kinds), *iamy.FilterResourceKinds(&dataFromYaml, kinds)
+		}
+
+		ownership, err := iamy.LoadPolicyOwnership(input.Dir, dataFromYaml.Account)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		// the policies only observed aren't drift, as push doesn't change them
+		observed, _ := ownership.Observed(dataFromAws, &dataFromYaml)
+
+		drifts := iamy.DetectDrift(dataFromAws, observed)
+		if input.Json {
+			b, err := json.MarshalIndent(drifts, "", "  ")
+			if err != nil {
+				ui.Fatal(err)
+				return
+			}
+			ui.Println(string(b))
+		} else {
+			printDrifts(drifts, ui)
+		}
+
+		if input.DriftHistory != "" {
+			runs, err := iamy.RecordDriftRun(input.DriftHistory, dataFromAws.Account, iamy.NewDriftRun(time.Now(), drifts))
+			if err != nil {
+				ui.Fatal(err)
+				return
+			}
+			if input.DriftBudget != nil {
+				over := iamy.ConsecutiveOverBudget(runs, input.DriftBudget.Limit)
+				if input.DriftBudget.Exceeded(runs) {
+					ui.Error.Println(color.RedString("Drift budget exceeded, %s", input.DriftBudget))
+					ui.Exit(2)
+				} else if over > 0 {
+					ui.Error.Println(color.YellowString("Over the drift budget of %d for %d of %d consecutive runs", input.DriftBudget.Limit, over, input.DriftBudget.Runs))
+				}
+				return
+			}
+		}
+		if len(drifts) > 0 {
+			ui.Exit(2)
+		}
+		return
+	}
+
+	ui.Fatal("No files found for AWS Account ID " + dataFromAws.Account.Id)
+}
+
+func printDrifts(drifts []iamy.Drift, ui Ui) {
+	if len(drifts) == 0 {
+		ui.Println("No drift, AWS matches the files")
+		return
+	}
+
+	for _, d := range drifts {
+		switch d.Action {
+		case "create":
+			ui.Println(color.GreenString("+ %s", d.Resource) + " (missing from AWS)")
+		case "delete":
+			ui.Println(color.RedString("- %s", d.Resource) + " (missing from the files)")
+		default:
+			ui.Println(color.YellowString("~ %s", d.Resource))
+		}
+		for _, a := range d.Attributes {
+			ui.Printf("    %s:", a.Name)
+			for _, line := range renderDiff(a.Diff) {
+				ui.Println("      " + line)
+			}
+		}
+	}
+	ui.Printf("\n%d resources have drifted from the files", len(drifts))
+}
+
+// driftBudget returns the drift budget of the flags, or nil when the limit
+// isn't set
+func driftBudget(limit, runs int) *iamy.DriftBudget {
+	if limit < 0 {
+		return nil
+	}
+	return &iamy.DriftBudget{Limit: limit, Runs: runs}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// A diffPart is a run of text in a line of a diff, and whether it changed
+type diffPart struct {
+	text    string
+	changed bool
+}
+
+var wordReg = regexp.MustCompile(`\w+|\s+|[^\w\s]`)
+
+// lcsPairs returns the indexes of a longest common subsequence of a and b
+func lcsPairs(a, b []string) [][2]int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	pairs := [][2]int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// wordDiff splits the lines into words, spaces and punctuation, marking
+// those that aren't common to both lines as changed
+func wordDiff(before, after string) ([]diffPart, []diffPart) {
+	a, b := wordReg.FindAllString(before, -1), wordReg.FindAllString(after, -1)
+	common := map[int]bool{}
+	commonAfter := map[int]bool{}
+	for _, p := range lcsPairs(a, b) {
+		common[p[0]] = true
+		commonAfter[p[1]] = true
+	}
+
+	parts := func(words []string, common map[int]bool) []diffPart {
+		result := []diffPart{}
+		for i, w := range words {
+			changed := !common[i]
+			if n := len(result); n > 0 && result[n-1].changed == changed {
+				result[n-1].text += w
+			} else {
+				result = append(result, diffPart{w, changed})
+			}
+		}
+		return result
+	}
+	return parts(a, common), parts(b, commonAfter)
+}
+
+// A diffRow is a line of a diff as it was before and after. A removed line
+// has no after, an added line no before, and a line that isn't part of the
+// diff is text
+type diffRow struct {
+	before, after       string
+	hasBefore, hasAfter bool
+	text                bool
+}
+
+// diffRows parses a diff of "- " and "+ " prefixed lines. Lines common to a
+// run of removed lines and the added lines after it are one row. The removed
+// and added lines in between are paired in order, each removed line with the
+// added line replacing it
+func diffRows(diff string) []diffRow {
+	result := []diffRow{}
+	var before, after []string
+	flush := func() {
+		changes := func(from, to []string) {
+			for k := 0; k < len(from) || k < len(to); k++ {
+				row := diffRow{hasBefore: k < len(from), hasAfter: k < len(to)}
+				if row.hasBefore {
+					row.before = from[k]
+				}
+				if row.hasAfter {
+					row.after = to[k]
+				}
+				result = append(result, row)
+			}
+		}
+
+		i, j := 0, 0
+		for _, p := range lcsPairs(before, after) {
+			changes(before[i:p[0]], after[j:p[1]])
+			result = append(result, diffRow{before[p[0]], after[p[1]], true, true, false})
+			i, j = p[0]+1, p[1]+1
+		}
+		changes(before[i:], after[j:])
+		before, after = nil, nil
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "- "):
+			if len(after) > 0 {
+				flush()
+			}
+			before = append(before, strings.TrimPrefix(line, "- "))
+		case strings.HasPrefix(line, "+ "):
+			after = append(after, strings.TrimPrefix(line, "+ "))
+		default:
+			flush()
+			result = append(result, diffRow{before: line, text: true})
+		}
+	}
+	flush()
+	return result
+}
+
+var (
+	removedColor     = color.New(color.FgRed)
+	addedColor       = color.New(color.FgGreen)
+	removedWordColor = color.New(color.FgRed, color.ReverseVideo)
+	addedWordColor   = color.New(color.FgGreen, color.ReverseVideo)
+)
+
+// highlight colours the parts of a line, highlighting those that changed
+func highlight(prefix string, parts []diffPart, line, word *color.Color) string {
+	s := line.Sprint(prefix)
+	for _, p := range parts {
+		if p.changed {
+			s += word.Sprint(p.text)
+		} else {
+			s += line.Sprint(p.text)
+		}
+	}
+	return s
+}
+
+// renderDiff colours a diff of "- " and "+ " prefixed lines for the terminal.
+// Lines common to a run of removed lines and the added lines after it are
+// shown once, unprefixed. The removed and added lines in between are paired
+// in order, each removed line followed by the added line replacing it, with
+// the words that differ between them highlighted
+func renderDiff(diff string) []string {
+	result := []string{}
+	for _, row := range diffRows(diff) {
+		switch {
+		case row.text:
+			result = append(result, row.before)
+		case row.hasBefore && row.hasAfter && row.before == row.after:
+			result = append(result, "  "+row.before)
+		case !row.hasAfter:
+			result = append(result, removedColor.Sprint("- "+row.before))
+		case !row.hasBefore:
+			result = append(result, addedColor.Sprint("+ "+row.after))
+		default:
+			b, a := wordDiff(row.before, row.after)
+			result = append(result, highlight("- ", b, removedColor, removedWordColor))
+			result = append(result, highlight("+ ", a, addedColor, addedWordColor))
+		}
+	}
+	return result
+}
+
+// renderSideBySideDiff colours a diff of "- " and "+ " prefixed lines for the
+// terminal in two columns, the lines before on the left and after on the
+// right, with each removed line beside the added line replacing it and the
+// words that differ between them highlighted
+func renderSideBySideDiff(diff string) []string {
+	rows := diffRows(diff)
+	width := 0
+	for _, row := range rows {
+		if !row.text && len(row.before) > width {
+			width = len(row.before)
+		}
+	}
+
+	result := []string{}
+	for _, row := range rows {
+		if row.text {
+			result = append(result, row.before)
+			continue
+		}
+		left, right := "", ""
+		switch {
+		case row.hasBefore && row.hasAfter && row.before == row.after:
+			left, right = "  "+row.before, "  "+row.after
+		case !row.hasAfter:
+			left = removedColor.Sprint("- " + row.before)
+		case !row.hasBefore:
+			right = addedColor.Sprint("+ " + row.after)
+		default:
+			b, a := wordDiff(row.before, row.after)
+			left = highlight("- ", b, removedColor, removedWordColor)
+			right = highlight("+ ", a, addedColor, addedWordColor)
+		}
+		padding := ""
+		if row.hasBefore {
+			padding = strings.Repeat(" ", width-len(row.before))
+		} else {
+			padding = strings.Repeat(" ", width+2)
+		}
+		result = append(result, strings.TrimRight(left+padding+" | "+right, " "))
+	}
+	return result
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestWordDiff(t *testing.T) {
+	before, after := wordDiff(`"Action": "s3:GetObject",`, `"Action": "s3:PutObject",`)
+	if expected := []diffPart{{`"Action": "s3:`, false}, {"GetObject", true}, {`",`, false}}; !reflect.DeepEqual(before, expected) {
+		t.Errorf("Expected %v, got %v", expected, before)
+	}
+	if expected := []diffPart{{`"Action": "s3:`, false}, {"PutObject", true}, {`",`, false}}; !reflect.DeepEqual(after, expected) {
+		t.Errorf("Expected %v, got %v", expected, after)
+	}
+}
+
+func TestRenderDiff(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = true
+
+	diff := "- {\n-   \"Action\": \"s3:GetObject\",\n-   \"Effect\": \"Allow\"\n- }\n+ {\n+   \"Action\": \"s3:PutObject\",\n+   \"Effect\": \"Allow\",\n+   \"Resource\": \"*\"\n+ }\n"
+	expected := []string{
+		"  {",
+		"-   \"Action\": \"s3:GetObject\",",
+		"+   \"Action\": \"s3:PutObject\",",
+		"-   \"Effect\": \"Allow\"",
+		"+   \"Effect\": \"Allow\",",
+		"+   \"Resource\": \"*\"",
+		"  }",
+	}
+	if actual := renderDiff(diff); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected\n%q\ngot\n%q", expected, actual)
+	}
+}
+
+func TestRenderSideBySideDiff(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = true
+
+	diff := "- [\n-   \"deploy\",\n-   \"read\"\n- ]\n+ [\n+   \"read\",\n+   \"write\"\n+ ]\n"
+	expected := []string{
+		"  [           |   [",
+		"-   \"deploy\", | +   \"read\",",
+		"-   \"read\"    | +   \"write\"",
+		"  ]           |   ]",
+	}
+	if actual := renderSideBySideDiff(diff); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
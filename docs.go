@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type DocsCommandInput struct {
+	ExportSource
+	Format    string
+	OutputDir string
+}
+
+// DocsCommand writes a site documenting the accounts in the files, or the
+// active AWS account, to the output directory, as markdown or static HTML
+// pages, starting from index.md or index.html
+func DocsCommand(ui Ui, input DocsCommandInput) {
+	accounts := loadExportAccounts(ui, input.ExportSource)
+	if accounts == nil {
+		return
+	}
+
+	pages, err := iamy.GenerateDocs(accounts, input.Format)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	for _, page := range pages {
+		file := filepath.Join(input.OutputDir, filepath.FromSlash(page.Path))
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		if err = ioutil.WriteFile(file, page.Content, 0644); err != nil {
+			ui.Fatal(err)
+			return
+		}
+	}
+	ui.Error.Printf("Wrote %d pages to %s", len(pages), input.OutputDir)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type DriftTrendCommandInput struct {
+	History  string
+	Accounts []string
+	Last     int
+	Json     bool
+}
+
+// DriftTrendCommand reports how each account's drift has changed over the
+// runs of check recorded in the drift history
+func DriftTrendCommand(ui Ui, input DriftTrendCommandInput) {
+	history, err := iamy.ReadDriftHistory(input.History)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	trends := iamy.DriftTrends(history, input.Accounts, input.Last)
+
+	if input.Json {
+		b, err := json.MarshalIndent(trends, "", "  ")
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Println(string(b))
+		return
+	}
+
+	if len(trends) == 0 {
+		ui.Println("No runs recorded")
+		return
+	}
+	ui.Printf("%-40s %6s %7s %5s %5s %7s %7s  %s", "Account", "Runs", "Latest", "Min", "Max", "Mean", "Change", "Recent")
+	for _, t := range trends {
+		runs := t.History
+		if len(runs) > 10 {
+			runs = runs[len(runs)-10:]
+		}
+		recent := []string{}
+		for _, r := range runs {
+			recent = append(recent, fmt.Sprint(r.Drifts))
+		}
+		ui.Printf("%-40s %6d %7d %5d %5d %7.1f %+7d  %s", t.Account, t.Runs, t.Latest, t.Min, t.Max, t.Mean, t.Change, strings.Join(recent, " "))
+	}
+}
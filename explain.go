@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/envato/iamy/iamy"
+	"github.com/fatih/color"
+)
+
+type ExplainDiffCommandInput struct {
+	Dir                   string
+	Selector              string
+	HeuristicCfnMatching  bool
+	SkipTagged            []string
+	IncludeTagged         []string
+	SkipPathPrefixes      []string
+	SkipBucketPrefixes    []string
+	IncludeBucketPatterns []string
+	IncludeControlTower   bool
+	Regions               []string
+	Timings               *iamy.Timings
+	FallbackProfile       string
+	FallbackRoleArn       string
+	Json                  bool
+}
+
+// ExplainDiffCommand explains why the resources the selector selects differ
+// between the active AWS account and the files, printing each resource's
+// canonical forms side by side, AWS on the left and the files on the right,
+// the attributes that differ after normalisation and the commands push
+// would run, to debug drift that shouldn't be there
+func ExplainDiffCommand(ui Ui, input ExplainDiffCommandInput) {
+	selector, err := iamy.ParseResourceSelector(input.Selector)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	ignore, err := iamy.LoadIgnoreCatalogue(input.Dir)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	aws := iamy.AwsFetcher{
+		Debug:                 ui.Debug,
+		HeuristicCfnMatching:  input.HeuristicCfnMatching,
+		SkipTagged:            input.SkipTagged,
+		IncludeTagged:         input.IncludeTagged,
+		SkipPathPrefixes:      input.SkipPathPrefixes,
+		SkipBucketPrefixes:    input.SkipBucketPrefixes,
+		IncludeBucketPatterns: input.IncludeBucketPatterns,
+		IncludeControlTower:   input.IncludeControlTower,
+		Regions:               input.Regions,
+		Ignore:                ignore,
+		Timings:               input.Timings,
+		FallbackProfile:       input.FallbackProfile,
+		FallbackRoleArn:       input.FallbackRoleArn,
+		Phases:                iamy.TargetFetchPhases([]iamy.ResourceSelector{selector}),
+	}
+
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	dataFromAws, err := aws.Fetch()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.PrintWarnings(dataFromAws.Warnings)
+
+	for _, dataFromYaml := range allDataFromYaml {
+		if dataFromYaml.Account.Id != dataFromAws.Account.Id {
+			continue
+		}
+
+		explanations := iamy.ExplainDiff(dataFromAws, &dataFromYaml, selector)
+		if len(explanations) == 0 {
+			ui.Fatalf("No resources match %s", selector)
+			return
+		}
+		if input.Json {
+			b, err := json.MarshalIndent(explanations, "", "  ")
+			if err != nil {
+				ui.Fatal(err)
+				return
+			}
+			ui.Println(string(b))
+			return
+		}
+		for i, e := range explanations {
+			if i > 0 {
+				ui.Println("")
+			}
+			printExplanation(ui, e)
+		}
+		return
+	}
+
+	ui.Fatal("No files found for AWS Account ID " + dataFromAws.Account.Id)
+}
+
+// printExplanation prints the resource's canonical forms side by side, then
+// what differs between them and what push would do about it
+func printExplanation(ui Ui, e iamy.DiffExplanation) {
+	heading := color.New(color.Bold)
+	label := color.New(color.FgBlue)
+
+	ui.Println(heading.Sprint(e.Resource))
+	var diff strings.Builder
+	for _, side := range []struct{ prefix, json string }{{"- ", e.Remote}, {"+ ", e.Local}} {
+		if side.json != "" {
+			diff.WriteString(side.prefix + strings.ReplaceAll(side.json, "\n", "\n"+side.prefix) + "\n")
+		}
+	}
+	for _, line := range renderSideBySideDiff(diff.String()) {
+		ui.Println("  " + line)
+	}
+
+	switch {
+	case e.Remote == "":
+		ui.Println(label.Sprint("Missing from AWS,") + " push would create it")
+	case e.Local == "":
+		ui.Println(label.Sprint("Missing from the files,") + " push would delete it unless pruning is disabled")
+	case len(e.Attributes) == 0 && len(e.Commands) == 0:
+		ui.Println(label.Sprint("No differences") + " after normalisation")
+	}
+	for _, a := range e.Attributes {
+		ui.Println(label.Sprintf("%s differs:", a.Name))
+		for _, line := range renderDiff(a.Diff) {
+			ui.Println("  " + line)
+		}
+	}
+	if len(e.Normalised) > 0 {
+		ui.Printf("%s %s", label.Sprint("Equal once normalised:"), strings.Join(e.Normalised, ", "))
+	}
+	if len(e.Commands) > 0 {
+		ui.Println(label.Sprint("Push would run:"))
+		for _, c := range e.Commands {
+			ui.Println("  " + c.Shell)
+		}
+	}
+	if e.Phantom() {
+		ui.Println(color.YellowString("Push would change the resource though no attribute differs after normalisation, the differ is comparing something the files don't record"))
+	}
+}
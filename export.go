@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/envato/iamy/iamy"
+)
+
+// An ExportSource is the accounts to export, those in the files, or one of
+// them, or the active AWS account
+type ExportSource struct {
+	Dir                   string
+	Account               string
+	Live                  bool
+	HeuristicCfnMatching  bool
+	SkipTagged            []string
+	IncludeTagged         []string
+	SkipPathPrefixes      []string
+	SkipBucketPrefixes    []string
+	IncludeBucketPatterns []string
+	IncludeControlTower   bool
+	Timings               *iamy.Timings
+	FallbackProfile       string
+	FallbackRoleArn       string
+}
+
+// loadExportAccounts returns the accounts the source selects, exiting when
+// there are none
+func loadExportAccounts(ui Ui, input ExportSource) []*iamy.AccountData {
+	var accounts []*iamy.AccountData
+	if input.Live {
+		ignore, err := iamy.LoadIgnoreCatalogue(input.Dir)
+		if err != nil {
+			ui.Fatal(err)
+			return nil
+		}
+		aws := iamy.AwsFetcher{
+			Debug:                 ui.Debug,
+			HeuristicCfnMatching:  input.HeuristicCfnMatching,
+			SkipTagged:            input.SkipTagged,
+			IncludeTagged:         input.IncludeTagged,
+			SkipPathPrefixes:      input.SkipPathPrefixes,
+			SkipBucketPrefixes:    input.SkipBucketPrefixes,
+			IncludeBucketPatterns: input.IncludeBucketPatterns,
+			IncludeControlTower:   input.IncludeControlTower,
+			Ignore:                ignore,
+			Timings:               input.Timings,
+			FallbackProfile:       input.FallbackProfile,
+			FallbackRoleArn:       input.FallbackRoleArn,
+			Phases:                []string{"iam", "s3"},
+		}
+		data, err := aws.Fetch()
+		if err != nil {
+			ui.Fatal(err)
+			return nil
+		}
+		ui.PrintWarnings(data.Warnings)
+		ui.usage.countResources(data)
+		return append(accounts, data)
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		ui.Fatal(err)
+		return nil
+	}
+	for i, data := range allDataFromYaml {
+		if input.Account == "" || data.Account.Id == input.Account || data.Account.String() == input.Account {
+			accounts = append(accounts, &allDataFromYaml[i])
+			ui.usage.countResources(&allDataFromYaml[i])
+		}
+	}
+	switch {
+	case len(accounts) == 0 && input.Account != "":
+		ui.Fatal("No files found for account " + input.Account)
+	case len(accounts) == 0:
+		ui.Fatal("No files found in " + input.Dir)
+	}
+	return accounts
+}
+
+// writeExportFile writes a file of the export to the account's directory in
+// the output directory, returning false when it couldn't be written
+func writeExportFile(ui Ui, dir, name string, content *bytes.Buffer, mode os.FileMode) bool {
+	if content.Len() == 0 {
+		return true
+	}
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, content.Bytes(), mode); err != nil {
+		ui.Fatal(err)
+		return false
+	}
+	ui.Error.Printf("Wrote %s", file)
+	return true
+}
+
+type ExportTerraformCommandInput struct {
+	ExportSource
+	OutputDir string
+	// Imports is how to write the imports of the existing resources, as
+	// import blocks, terraform import commands or none
+	Imports     string
+	ImportsOnly bool
+}
+
+// importScriptNames are the names of the scripts of terraform import
+// commands written to the output directory, by shell dialect
+var importScriptNames = map[string]string{
+	"posix":      "import.sh",
+	"fish":       "import.fish",
+	"powershell": "import.ps1",
+	"cmd":        "import.cmd",
+}
+
+// ExportTerraformCommand writes the accounts in the files, or the active AWS
+// account, as Terraform configuration, to bootstrap a Terraform config when
+// moving off iamy, with the imports that adopt the existing resources. A
+// single account is written to stdout, and with OutputDir each account is
+// written to a directory named for the account, the resources to main.tf and
+// the imports to imports.tf or a script
+func ExportTerraformCommand(ui Ui, input ExportTerraformCommandInput) {
+	accounts := loadExportAccounts(ui, input.ExportSource)
+	switch {
+	case len(accounts) == 0:
+		return
+	case len(accounts) > 1 && input.OutputDir == "":
+		ui.Fatal("The files have several accounts, export one with --account or each to a directory with --output-dir")
+		return
+	case input.OutputDir == "" && input.Imports == "commands" && !input.ImportsOnly:
+		ui.Fatal("--imports commands writes a script, use --output-dir or --imports-only")
+		return
+	}
+
+	for _, data := range accounts {
+		x, err := iamy.ExportTerraform(data)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.PrintWarnings(x.Warnings)
+
+		var resources, imports bytes.Buffer
+		if !input.ImportsOnly {
+			if err := x.WriteResources(&resources); err != nil {
+				ui.Fatal(err)
+				return
+			}
+		}
+		switch input.Imports {
+		case "blocks":
+			err = x.WriteImportBlocks(&imports)
+		case "commands":
+			if ui.Shell == "posix" {
+				imports.WriteString("#!/bin/sh\nset -e\n")
+			}
+			for _, c := range x.ImportCmds() {
+				imports.WriteString(c.Quoted(ui.Shell) + "\n")
+			}
+		}
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+
+		if input.OutputDir == "" {
+			if resources.Len() > 0 && imports.Len() > 0 {
+				resources.WriteString("\n")
+			}
+			io.Copy(ui.Writer(), io.MultiReader(&resources, &imports))
+			continue
+		}
+
+		dir := filepath.Join(input.OutputDir, data.Account.String())
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		importsFile, importsMode := "imports.tf", os.FileMode(0644)
+		if input.Imports == "commands" {
+			importsFile, importsMode = importScriptNames[ui.Shell], 0755
+		}
+		if !writeExportFile(ui, dir, "main.tf", &resources, 0644) || !writeExportFile(ui, dir, importsFile, &imports, importsMode) {
+			return
+		}
+	}
+}
+
+type ExportCloudFormationCommandInput struct {
+	ExportSource
+	OutputDir         string
+	MaxResources      int
+	ResourcesToImport bool
+}
+
+// ExportCloudFormationCommand writes the accounts in the files, or the active
+// AWS account, as CloudFormation templates, with the resources to import to
+// adopt the existing resources into stacks with an IMPORT change set. A
+// single template is written to stdout, and with OutputDir each account is
+// written to a directory named for the account, as template.json and
+// resources-to-import.json, numbered when the templates are split
+func ExportCloudFormationCommand(ui Ui, input ExportCloudFormationCommandInput) {
+	accounts := loadExportAccounts(ui, input.ExportSource)
+	if len(accounts) == 0 {
+		return
+	}
+	if len(accounts) > 1 && input.OutputDir == "" {
+		ui.Fatal("The files have several accounts, export one with --account or each to a directory with --output-dir")
+		return
+	}
+
+	for _, data := range accounts {
+		x, err := iamy.ExportCloudFormation(data, input.MaxResources)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.PrintWarnings(x.Warnings)
+
+		if input.OutputDir == "" {
+			if len(x.Templates) > 1 {
+				ui.Fatalf("The resources are split between %d templates, write them to a directory with --output-dir", len(x.Templates))
+				return
+			}
+			for _, t := range x.Templates {
+				if input.ResourcesToImport {
+					err = t.WriteResourcesToImport(ui.Writer())
+				} else {
+					err = t.WriteTemplate(ui.Writer())
+				}
+				if err != nil {
+					ui.Fatal(err)
+					return
+				}
+			}
+			continue
+		}
+
+		dir := filepath.Join(input.OutputDir, data.Account.String())
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		for i, t := range x.Templates {
+			suffix := ""
+			if len(x.Templates) > 1 {
+				suffix = fmt.Sprintf("-%d", i+1)
+			}
+			var template, imports bytes.Buffer
+			if err := t.WriteTemplate(&template); err != nil {
+				ui.Fatal(err)
+				return
+			}
+			if err := t.WriteResourcesToImport(&imports); err != nil {
+				ui.Fatal(err)
+				return
+			}
+			if !writeExportFile(ui, dir, "template"+suffix+".json", &template, 0644) || !writeExportFile(ui, dir, "resources-to-import"+suffix+".json", &imports, 0644) {
+				return
+			}
+		}
+	}
+}
+
+type ExportPulumiCommandInput struct {
+	ExportSource
+	OutputDir string
+	Language  string
+	Imports   bool
+}
+
+// ExportPulumiCommand writes the accounts in the files, or the active AWS
+// account, as a Pulumi program in YAML or Go, optionally with the import
+// option on each resource to adopt the existing resources on the first
+// pulumi up. A single account is written to stdout, and with OutputDir each
+// account is written to a project directory named for the account
+func ExportPulumiCommand(ui Ui, input ExportPulumiCommandInput) {
+	accounts := loadExportAccounts(ui, input.ExportSource)
+	if len(accounts) == 0 {
+		return
+	}
+	if len(accounts) > 1 && input.OutputDir == "" {
+		ui.Fatal("The files have several accounts, export one with --account or each to a directory with --output-dir")
+		return
+	}
+
+	for _, data := range accounts {
+		x, err := iamy.ExportPulumi(data)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.PrintWarnings(x.Warnings)
+
+		project := "iamy-" + data.Account.String()
+		var program, projectFile bytes.Buffer
+		if input.Language == "go" {
+			err = x.WriteGo(&program, input.Imports)
+			fmt.Fprintf(&projectFile, "name: %s\nruntime: go\ndescription: Exported by iamy from account %s\n", project, data.Account)
+		} else {
+			err = x.WriteYaml(&program, project, input.Imports)
+		}
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+
+		if input.OutputDir == "" {
+			io.Copy(ui.Writer(), &program)
+			continue
+		}
+
+		dir := filepath.Join(input.OutputDir, data.Account.String())
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		if input.Language == "go" {
+			if !writeExportFile(ui, dir, "Pulumi.yaml", &projectFile, 0644) || !writeExportFile(ui, dir, "main.go", &program, 0644) {
+				return
+			}
+		} else if !writeExportFile(ui, dir, "Pulumi.yaml", &program, 0644) {
+			return
+		}
+	}
+}
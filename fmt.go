@@ -5,15 +5,31 @@ import "github.com/envato/iamy/iamy"
 type FormatCommandInput struct {
 	Dir       string
 	CanDelete bool
+	Relayout  bool
 }
 
 func FormatCommand(ui Ui, input FormatCommandInput) {
 	if *dryRun {
 		ui.Fatal("Dry-run mode not supported for fmt")
+		return
 	}
 
+	// files written with anchors are formatted by hand, only reformat
+	// them when their resources change, eg. with --relayout
 	yaml := iamy.YamlLoadDumper{
-		Dir: input.Dir,
+		Dir:            input.Dir,
+		KeepReferences: true,
+	}
+
+	if input.Relayout {
+		moved, err := yaml.Relayout()
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		for _, m := range moved {
+			ui.Printf("Moved %s to %s", m[0], m[1])
+		}
 	}
 
 	allDataFromYaml, err := yaml.Load()
@@ -27,7 +43,8 @@ func FormatCommand(ui Ui, input FormatCommandInput) {
 
 		err = yaml.Dump(&account, input.CanDelete)
 		if err != nil {
-			ui.Error.Fatal(err)
+			ui.Fatal(err)
+			return
 		}
 	}
 }
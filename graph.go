@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type GraphCommandInput struct {
+	ExportSource
+	Output string
+}
+
+// GraphCommand writes the permission topology of the accounts in the files,
+// or of the active AWS account, as a Graphviz DOT graph, to stdout or to the
+// output file
+func GraphCommand(ui Ui, input GraphCommandInput) {
+	accounts := loadExportAccounts(ui, input.ExportSource)
+	if accounts == nil {
+		return
+	}
+
+	out := os.Stdout
+	if input.Output != "" {
+		f, err := os.Create(input.Output)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := iamy.WriteDotGraph(out, accounts); err != nil {
+		ui.Fatal(err)
+		return
+	}
+	if input.Output != "" {
+		ui.Error.Printf("Wrote %s", input.Output)
+	}
+}
@@ -6,7 +6,13 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/envato/iamy/iamy"
+	"github.com/fatih/color"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -32,28 +38,306 @@ type Ui struct {
 	*log.Logger
 	Error, Debug *log.Logger
 	Exit         func(code int)
+	// Shell is the dialect commands are printed in
+	Shell string
+	// Location is the time zone times are reported in, local time if nil
+	Location *time.Location
+
+	usage *usageRecorder
+}
+
+// PrintWarnings reports warnings on stderr. Skipped resources are expected in
+// most accounts, so they are only listed individually in debug output, with
+// those managed by AWS Control Tower counted by baseline and guardrail
+func (ui Ui) PrintWarnings(warnings iamy.Warnings) {
+	for _, w := range warnings {
+		if w.Category == iamy.WarningSkipped || w.Category == iamy.WarningControlTower {
+			ui.Debug.Println("Warning:", w)
+		} else {
+			ui.Error.Println(color.YellowString("Warning: %s", w))
+		}
+	}
+
+	if skipped := warnings.Count(iamy.WarningSkipped); skipped > 0 {
+		ui.Error.Printf("Skipped %d resources, use --debug to list them", skipped)
+	}
+	if skipped := warnings.Count(iamy.WarningControlTower); skipped > 0 {
+		components := warnings.ControlTowerComponents()
+		names := []string{}
+		for name := range components {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		counts := []string{}
+		for _, name := range names {
+			counts = append(counts, fmt.Sprintf("%s: %d", name, components[name]))
+		}
+		ui.Error.Printf("Skipped %d resources managed by AWS Control Tower (%s), use --debug to list them", skipped, strings.Join(counts, ", "))
+	}
+}
+
+// PrintTimings reports the time spent in each phase. Phases that run
+// concurrently, like fetching descriptions, can total more than the wall time
+func (ui Ui) PrintTimings(l *log.Logger, timings *iamy.Timings) {
+	all := timings.All()
+	if len(all) == 0 {
+		return
+	}
+
+	l.Printf("%-32s %6s %12s %12s", "Phase", "Count", "Total", "Max")
+	for _, t := range all {
+		l.Printf("%-32s %6d %12s %12s", t.Phase, t.Count, t.Total.Round(time.Millisecond), t.Max.Round(time.Millisecond))
+	}
 }
 
 // CFN automatically tags resources with this and other tags:
 // https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-properties-resource-tags.html
 const cloudformationStackNameTag = "aws:cloudformation:stack-name"
 
+// accountIdReg matches an account id, or an alias and account id as account
+// directories are named
+var accountIdReg = regexp.MustCompile(`^([\w-]+-)?\d{12}$`)
+
 func main() {
 	var (
 		debug            = kingpin.Flag("debug", "Show debugging output").Bool()
+		timezone         = kingpin.Flag("timezone", "The time zone to report times in, as an IANA name like Australia/Melbourne or UTC. Defaults to the local time zone").String()
+		noColor          = kingpin.Flag("no-color", "Don't colour the output, also disabled by setting NO_COLOR").Bool()
+		showTimings      = kingpin.Flag("timings", "Show how long each phase of fetching and planning took").Bool()
 		skipCfnTagged    = kingpin.Flag("skip-cfn-tagged", fmt.Sprintf("Shorthand for --skip-tagged %s", cloudformationStackNameTag)).Bool()
-		skipTagged       = kingpin.Flag("skip-tagged", "Skips IAM entities (or buckets associated with bucket policies) tagged with a given tag").Strings()
-		includeTagged    = kingpin.Flag("include-tagged", "Includes IAM entities (or buckets associated with bucket policies) tagged with a given tag").Strings()
+		skipTagged       = kingpin.Flag("skip-tagged", "Skips IAM entities and S3 buckets tagged with a given tag").Strings()
+		includeTagged    = kingpin.Flag("include-tagged", "Includes IAM entities and S3 buckets tagged with a given tag").Strings()
 		skipPathPrefixes = kingpin.Flag("skip-path-prefix", fmt.Sprintf("Skips IAM entities that have a path starting with the supplied prefix, repeat flag for multiple prefixes")).Strings()
+		skipBuckets      = kingpin.Flag("skip-bucket-prefix", "Skips S3 buckets with names starting with the supplied prefix, eg. cdk- for CDK bootstrap buckets, repeat flag for multiple prefixes").Strings()
+		includeBuckets   = kingpin.Flag("include-bucket-pattern", "Only includes S3 buckets with names matching the supplied glob pattern, repeat flag for multiple patterns").Strings()
+		onlyKinds        = kingpin.Flag("only", "Only pull or push resources of these types, eg. users,roles,policies, skipping fetching the others. Comma separate or repeat flag for multiple types").Strings()
+		excludeKinds     = kingpin.Flag("exclude", "Don't pull or push resources of these types, eg. buckets, skipping fetching them. Comma separate or repeat flag for multiple types").Strings()
+		includeCtrlTower = kingpin.Flag("include-control-tower", "Includes IAM entities and S3 buckets managed by AWS Control Tower, which are skipped by default").Bool()
+		regions          = kingpin.Flag("region", "A region to fetch regional resources (API Gateway REST APIs, S3 Access Points, S3 Object Lambda Access Points, CodeArtifact domains and repositories, SES identities, Glacier vaults and ECR registry policies) from, repeat flag for multiple regions. Defaults to the region of the AWS session").Strings()
+		fallbackProfile  = kingpin.Flag("fallback-profile", "An AWS profile to retry parts of the fetch that fail with an authentication error with").String()
+		fallbackRoleArn  = kingpin.Flag("fallback-role-arn", "A role to assume to retry parts of the fetch that fail with an authentication error, with the fallback profile if given").String()
+		configAggregator = kingpin.Flag("config-aggregator", "An AWS Config aggregator in the account of the credentials to read the IAM data of --account-id from, for reports and drift detection without credentials for the account. Push never runs commands with it").String()
+		accountId        = kingpin.Flag("account-id", "The account to read from --config-aggregator, as ID or ALIAS-ID to match its directory").String()
+		shellDialect     = kingpin.Flag("shell", fmt.Sprintf("The shell to print aws commands for, one of %s. Detected from the environment by default", strings.Join(iamy.ShellDialects, ", "))).Enum(iamy.ShellDialects...)
+		stateParameter   = kingpin.Flag("state-parameter", "An SSM parameter to also record pull state in, and to check pushes against").String()
+		usageLog         = kingpin.Flag("usage-log", "Opt in to appending a usage record of each run to this file, the command, flags, duration, resource counts and error class, without names of resources, accounts or files").Envar("IAMY_USAGE_LOG").String()
 		pull             = kingpin.Command("pull", "Syncs IAM users, groups and policies from the active AWS account to files")
 		pullDir          = pull.Flag("dir", "The directory to dump yaml files to").Default(defaultDir).Short('d').String()
 		pullCanDelete    = pull.Flag("delete", "Delete extraneous files from destination dir").Bool()
 		lookupCfn        = pull.Flag("accurate-cfn", "Fetch all known resource names from cloudformation to get exact filtering").Bool()
+		pullFormat       = pull.Flag("format", "Write a yaml file per resource, a json file per resource with json-files, or the account as one JSON or YAML document on stdout with json or yaml-document, in the snapshot format, without writing any files").Default("yaml").Enum("yaml", "json", "json-files", "yaml-document")
+		pullSnapshot     = pull.Flag("snapshot", "Also write the fetched account data to a snapshot file, as YAML when it ends in .yaml or .yml, otherwise as JSON").String()
+		pullPublish      = pull.Flag("publish-snapshot", "Also publish a JSON snapshot and a manifest of its SHA-256 digest to s3://BUCKET/PREFIX/ALIAS-ID/, in a bucket with Object Lock enabled, for tamper-evident records").PlaceHolder("S3-LOCATION").String()
+		pullPublishDays  = pull.Flag("publish-retention-days", "Lock the published snapshots for this many days, instead of the bucket's default retention").Int()
+		pullPublishMode  = pull.Flag("publish-retention-mode", "The Object Lock mode to lock the published snapshots with").Default("COMPLIANCE").Enum("COMPLIANCE", "GOVERNANCE")
+		pullSuggest      = pull.Flag("suggest-splits", fmt.Sprintf("Write suggestions for moving oversized inline policies to managed policies to %s in the account directory", iamy.SplitSuggestionsFileName)).Bool()
+		pullPolicyFiles  = pull.Flag("policy-files", fmt.Sprintf("Write the policy documents of managed and inline policies to standalone JSON files in %s, for the files to refer to with PolicyFile", iamy.PolicyFilesDirName)).Bool()
+		pullSplitPercent = pull.Flag("split-at-percent", "Suggest splitting the inline policies of entities using at least this percentage of their inline policy size quota, 0 to disable").Default("75").Float64()
+		pullSplitCount   = pull.Flag("split-at-count", "Suggest splitting the inline policies of entities with at least this many inline policies, 0 to disable").Default("0").Int()
 		push             = kingpin.Command("push", "Syncs IAM users, groups and policies from files to the active AWS account")
 		pushDir          = push.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		pushPlanJson     = push.Flag("plan-json", "Shorthand for --plan-output json=FILE").String()
+		pushPlanOutputs  = push.Flag("plan-output", fmt.Sprintf("Also render the plan to a file, as FORMAT=FILE where FORMAT is one of %s, repeat flag for multiple formats", strings.Join(iamy.PlanRendererNames(), ", "))).StringMap()
+		pushSavedPlan    = push.Flag("plan", "Only push if the changes are exactly those of a plan saved with --plan-output json=FILE, refusing if AWS or the files have changed since").ExistingFile()
+		pushTargets      = push.Flag("target", fmt.Sprintf("Only push resources selected by TYPE/PATTERN, eg. role/my-app-*, and the groups, roles and policies they refer to, repeat flag for multiple selectors. TYPE is one of %s", strings.Join(iamy.TargetTypeNames(), ", "))).Strings()
+		pushProtect      = push.Flag("protect", fmt.Sprintf("Never delete resources selected by TYPE/PATTERN, in addition to those in %s, repeat flag for multiple selectors", iamy.ProtectFileName)).Strings()
+		pushOutput       = push.Flag("output", fmt.Sprintf("Print the plan as text, or render it as one of %s without running the commands", strings.Join(iamy.PlanRendererNames(), ", "))).Default("text").Enum(append([]string{"text"}, iamy.PlanRendererNames()...)...)
+		pushDiffStyle    = push.Flag("diff", "How to show the changes before pushing them, as unified or side-by-side diffs of each resource's changed attributes, or as the aws commands that make them").Default("unified").Enum("unified", "side-by-side", "commands")
+		pushScriptFormat = push.Flag("script-format", "The shell to write shell plans for, bash and powershell scripts carry on past changes already made so they can be rerun").Default("sh").Enum(iamy.ScriptFormats...)
+		pushPrune        = push.Flag("prune", "Delete resources that are missing from the files, which are otherwise kept with a warning").Bool()
+		detectRenames    = push.Flag("detect-renames", "Rename and move groups, rename users marked RenamedFrom, and move attachments to renamed policies, instead of deleting and recreating them").Default("true").Bool()
+		pushWorkers      = push.Flag("workers", "How many aws commands to run at once").Default("1").Int()
+		pushRetries      = push.Flag("retries", "How many times to retry an aws command that fails because AWS throttled it, resuming the push from that command").Default("5").Int()
+		pushRetryDelay   = push.Flag("retry-delay", "The longest to wait before the first retry of a throttled command, doubling with each retry. The wait is random, up to this, so concurrent commands don't retry together").Default("1s").Duration()
+		pushRetryMax     = push.Flag("retry-max-delay", "The longest to wait before any retry of a throttled command").Default("30s").Duration()
+		pushExitCode     = push.Flag("detailed-exitcode", "Exit with 0 when AWS is up to date, 1 on errors, and 2 when there are changes, whether or not they're pushed").Bool()
+		pushContinue     = push.Flag("continue-on-error", "Keep applying changes to other resources after a command fails, and summarise the failures at the end").Bool()
+		pushVerify       = push.Flag("verify-before-apply", "Re-read each resource's policy documents just before changing it, and don't change it if they changed in AWS since the plan was made. With --continue-on-error, the other resources are still pushed").Bool()
+		pushJournal      = push.Flag("journal", "Record the commands applied to this file, to roll back or resume a push that fails part way. The file is removed once the push succeeds").String()
+		pushDocumentDir  = push.Flag("document-dir", "Write the JSON documents in aws commands to files in this directory, and refer to them with file:// instead of passing them on the command line").String()
+		pushKeepDocs     = push.Flag("keep-document-files", "Keep the --document-dir files once the commands succeed, which are otherwise removed").Bool()
+		pushRollback     = push.Flag("rollback", "Reverse the commands recorded in --journal, most recent first, instead of pushing").Bool()
+		pushRetention    = push.Flag("policy-version-retention", fmt.Sprintf("How many versions of a managed policy to keep when it's updated, including the new version, deleting older nondefault versions. Defaults to %d, deleting the oldest only when needed", iamy.MaxAllowedPolicyVersions)).Default("0").Int()
+		pushKeepVersions = push.Flag("keep-policy-versions", "Never delete policy versions, failing instead when a policy with the most versions IAM allows would be updated").Bool()
+		pushRateLimit    = push.Flag("rate-limit", "The most aws commands to start each second, 0 for no limit").Default("10").Float64()
+		pushQuotaWarnAt  = push.Flag("quota-warn-at", "Warn when the pushed files use at least this percentage of an IAM quota").Default("80").Float64()
+		pushQuotaLimits  = push.Flag("quota-limit", fmt.Sprintf("Check an IAM quota against a raised limit, as QUOTA=LIMIT where QUOTA is one of %s, repeat flag for multiple quotas", strings.Join(iamy.QuotaNames(), ", "))).StringMap()
+		pushMaxPullAge   = push.Flag("max-pull-age", "Warn when the files were last pulled longer ago than this, 0 to disable").Default("168h").Duration()
+		pushMaxDeletes   = push.Flag("max-deletes", "Refuse to push a plan deleting more resources than this without --force, negative for no limit").Default("-1").Int()
+		pushMaxChange    = push.Flag("max-change-percent", "Refuse to push a plan updating, renaming or deleting more than this percentage of the resources in AWS without --force, 0 for no limit").Default("0").Float64()
+		pushForce        = push.Flag("force", "Push plans exceeding --max-deletes or --max-change-percent").Bool()
+		pushAllAccounts  = push.Flag("all-accounts", "Push every account with a directory in --dir in turn, assuming --account-role in each, and summarise the accounts at the end").Bool()
+		pushAccountRole  = push.Flag("account-role", "The name or path/name of the role to assume in each account with --all-accounts").String()
 		format           = kingpin.Command("fmt", "Update YAML files to match expected format")
 		formatDir        = format.Flag("dir", "The base directory to format").Default(defaultDir).Short('d').ExistingDir()
 		formatCanDelete  = format.Flag("delete", "Delete extraneous files from destination dir").Bool()
+		formatRelayout   = format.Flag("relayout", fmt.Sprintf("First move the files in the default layout to the layout of %s", iamy.LayoutFileName)).Bool()
+		analyze          = kingpin.Command("analyze", "Reports on the policies in the YAML files")
+		analyzeJUnit     = analyze.Flag("junit", "Also write the results to this file as JUnit XML, with a test case for each file, or each quota, failing with its problems").String()
+		analyzeSarif     = analyze.Flag("sarif", "Also write the problems found to this file as SARIF, for GitHub code scanning and other SARIF tools to annotate the files with").String()
+		analyzeSourceIp  = analyze.Command("source-ip", "Reports aws:SourceIp conditions, checking for invalid and overlapping ranges and ranges outside an allowlist")
+		sourceIpDir      = analyzeSourceIp.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		sourceIpAllow    = analyzeSourceIp.Flag("allowlist", "A file of allowed addresses and CIDRs, one per line").ExistingFile()
+		sourceIpProblems = analyzeSourceIp.Flag("problems-only", "Only report ranges with problems").Bool()
+		analyzeTime      = analyze.Command("time-conditions", "Reports statements limited by DateGreaterThan/DateLessThan conditions that have expired or expire soon")
+		timeDir          = analyzeTime.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		timeWithin       = analyzeTime.Flag("expiring-within", "Report statements expiring within this long").Default("720h").Duration()
+		timeRemove       = analyzeTime.Flag("remove-expired", "Remove expired statements from the yaml files, for the next push to delete").Bool()
+		analyzeMfa       = analyze.Command("mfa", "Reports human access groups, policies and users that can act without MFA")
+		mfaDir           = analyzeMfa.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		mfaGroups        = analyzeMfa.Flag("human-group", "A group granting human access, which must require MFA, repeat flag for multiple groups").Strings()
+		mfaPolicies      = analyzeMfa.Flag("human-policy", "A managed policy granting human access, which must require MFA, repeat flag for multiple policies").Strings()
+		mfaUserTag       = analyzeMfa.Flag("human-user-tag", "A tag marking users as humans, who must be in an MFA enforcing group").String()
+		analyzeRegions   = analyze.Command("regions", "Checks aws:RequestedRegion conditions restrict every account to the approved regions")
+		regionsDir       = analyzeRegions.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		regionsApproved  = analyzeRegions.Flag("approved-region", "A region activity is allowed in, repeat flag for multiple regions").Required().Strings()
+		regionsBaseline  = analyzeRegions.Flag("baseline-policy", "The managed policy each account must deny requests outside the approved regions in").String()
+		analyzeBoundary  = analyze.Command("boundaries", "Reports identity policy grants that permissions boundaries make ineffective, and boundaries that don't restrict their principal")
+		boundaryDir      = analyzeBoundary.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		analyzeStale     = analyze.Command("stale", "Reports users, roles and managed policies created long ago that grant or are granted nothing: users in no group with no policies, roles with no policies, and policies attached to nothing")
+		staleDir         = analyzeStale.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		staleOlderThan   = analyzeStale.Flag("older-than", "Report resources created more than this long ago").Default("2160h").Duration()
+		analyzeEmpty     = analyze.Command("empty", "Reports groups with no members, managed policies attached to nothing, roles with no policies and instance profiles with no roles, leaving out protected resources")
+		emptyDir         = analyzeEmpty.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		emptyLastUsed    = analyzeEmpty.Flag("check-last-used", "Ask AWS when roles were last used, and only report roles unused for --unused-for").Bool()
+		emptyUnusedFor   = analyzeEmpty.Flag("unused-for", "With --check-last-used, only report roles not used for this long").Default("2160h").Duration()
+		emptyRemove      = analyzeEmpty.Flag("remove", "Remove the files of empty resources, so push --prune deletes them, roles only with --check-last-used").Bool()
+		analyzeOrgConds  = analyze.Command("org-conditions", "Reports statements that list more accounts than they should, which aws:PrincipalOrgID and aws:PrincipalOrgPaths conditions would replace")
+		orgCondsDir      = analyzeOrgConds.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		orgCondsMax      = analyzeOrgConds.Flag("max-accounts", "The most accounts a statement can list").Default("3").Int()
+		orgCondsInv      = analyzeOrgConds.Flag("inventory", "The organization inventory written by org inventory, to suggest the organization or unit to allow").ExistingFile()
+		analyzeDupes     = analyze.Command("duplicates", "Experimental. Reports policy documents stored more than once, within and across accounts")
+		dupesDir         = analyzeDupes.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		dupesJson        = analyzeDupes.Flag("json", "Write the location and hash of every policy document as JSON instead").Bool()
+		analyzeQuotas    = analyze.Command("quotas", "Reports how much of each IAM quota the YAML files use, warning about quotas that are nearly used up")
+		quotasDir        = analyzeQuotas.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		quotasWarnAt     = analyzeQuotas.Flag("warn-at", "Warn about quotas used to at least this percentage").Default("80").Float64()
+		quotasLimits     = analyzeQuotas.Flag("limit", fmt.Sprintf("Check a quota against a raised limit, as QUOTA=LIMIT where QUOTA is one of %s, repeat flag for multiple quotas", strings.Join(iamy.QuotaNames(), ", "))).StringMap()
+		quotasAll        = analyzeQuotas.Flag("all", "Report the usage of every quota, not only those over the warning threshold").Bool()
+		analyzeBuckets   = analyze.Command("bucket-policies", fmt.Sprintf("Reports buckets whose policies are missing the statements the mandates file, %s by default, requires", iamy.BucketPolicyMandatesFileName))
+		bucketsDir       = analyzeBuckets.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		bucketsMandates  = analyzeBuckets.Flag("mandates", "The mandates file, instead of the one in --dir").ExistingFile()
+		bucketsAdd       = analyzeBuckets.Flag("add-missing", "Add the missing statements to the yaml files, for the next push to apply").Bool()
+		check            = kingpin.Command("check", "Reports the resources in the active AWS account that have drifted from the files, without changing anything. Exits with 2 when there's drift")
+		checkDir         = check.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		checkAccurateCfn = check.Flag("accurate-cfn", "Fetch all known resource names from cloudformation to get exact filtering").Bool()
+		checkJson        = check.Flag("json", "Print the drifted resources as JSON").Bool()
+		checkHistory     = check.Flag("drift-history", "Record the drift of each run in this file, or in an S3 object with s3://BUCKET/KEY, for drift-trend to report on").PlaceHolder("LOCATION").String()
+		checkBudget      = check.Flag("drift-budget", "Only exit with 2 once more than this many resources have drifted for --budget-runs consecutive runs, requires --drift-history").Default("-1").Int()
+		checkBudgetRuns  = check.Flag("budget-runs", "How many consecutive runs the drift must exceed --drift-budget for").Default("3").Int()
+		driftTrend       = kingpin.Command("drift-trend", "Reports how each account's drift has changed over the runs check recorded in its --drift-history")
+		driftTrendFile   = driftTrend.Flag("history", "The drift history file, or s3://BUCKET/KEY").PlaceHolder("LOCATION").Required().String()
+		driftTrendAcct   = driftTrend.Flag("account", "Only report on this account, as ALIAS-ID, repeat flag for multiple accounts").Strings()
+		driftTrendLast   = driftTrend.Flag("last", "Only report on each account's most recent runs, 0 for all of them").Default("0").Int()
+		driftTrendJson   = driftTrend.Flag("json", "Write the trends and their runs as JSON").Bool()
+		explainDiff      = kingpin.Command("explain-diff", "Explains why the resources differ between the active AWS account and the files, with their canonical forms side by side and the attributes that differ after normalisation, to debug phantom drift")
+		explainSelector  = explainDiff.Arg("selector", fmt.Sprintf("The resources to explain, as TYPE/PATTERN, eg. role/app-server, where TYPE is one of %s", strings.Join(iamy.TargetTypeNames(), ", "))).Required().String()
+		explainDir       = explainDiff.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		explainAccurate  = explainDiff.Flag("accurate-cfn", "Fetch all known resource names from cloudformation to get exact filtering").Bool()
+		explainJson      = explainDiff.Flag("json", "Print the explanations as JSON").Bool()
+		show             = kingpin.Command("show", "Prints resources with their attachments, trust policy summary and highlighted policy documents")
+		showSelector     = show.Arg("selector", fmt.Sprintf("The resources to show, as TYPE/PATTERN, eg. role/app-server, where TYPE is one of %s", strings.Join(iamy.TargetTypeNames(), ", "))).Required().String()
+		showDir          = show.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		showLive         = show.Flag("live", "Show the resources in the active AWS account instead of the files").Bool()
+		importCmd        = kingpin.Command("import", "Writes the files of resources in the active AWS account, fetching only their service, to adopt resources created outside iamy without a full pull")
+		importSelector   = importCmd.Arg("selector", fmt.Sprintf("The resources to import, as TYPE/PATTERN, eg. role/my-existing-role, where TYPE is one of %s", strings.Join(iamy.TargetTypeNames(), ", "))).Required().String()
+		importDir        = importCmd.Flag("dir", "The directory to write yaml files to").Default(defaultDir).Short('d').ExistingDir()
+		importRefs       = importCmd.Flag("with-references", "Also import the groups, roles and managed policies the resources refer to that aren't in the files").Bool()
+		importOverwrite  = importCmd.Flag("overwrite", "Replace the files of resources that are already in the files, which are otherwise skipped").Bool()
+		restore          = kingpin.Command("restore", fmt.Sprintf("Writes back the files of deleted resources from those pull --delete archived in %s, or from a snapshot, for push to recreate them", iamy.ArchiveDirName))
+		restoreSelector  = restore.Arg("selector", fmt.Sprintf("The archived resources to restore, as TYPE/PATTERN, eg. role/app-server, where TYPE is one of %s", strings.Join(iamy.TargetTypeNames(), ", "))).String()
+		restoreDir       = restore.Flag("dir", "The directory the archive is in").Default(defaultDir).Short('d').ExistingDir()
+		restoreList      = restore.Flag("list", "List the archived files the selector selects, or all of them, with when they were deleted, instead of restoring them").Bool()
+		restoreFrom      = restore.Flag("from", "Restore the resources from this JSON or YAML snapshot, written by pull --snapshot, instead of the archive").ExistingFile()
+		restoreAs        = restore.Flag("as", "Restore the one resource selected under this name, when its name is taken in the files").String()
+		mergePull        = kingpin.Command("merge-pull", "Merges another operator's pull of the same account into the files, resource by resource, using the snapshot of the previous pull as the base, and lists the resources both changed as conflicts")
+		mergeDir         = mergePull.Flag("dir", "The directory of our files, which the merge is written to").Default(defaultDir).Short('d').ExistingDir()
+		mergeBase        = mergePull.Flag("base", "The snapshot written by pull --snapshot, or a directory of files, of the pull both sides started from").Required().ExistingFileOrDir()
+		mergeTheirs      = mergePull.Flag("theirs", "Their files, eg. a checkout of their commit, or a snapshot of their pull").Required().ExistingFileOrDir()
+		mergeAccount     = mergePull.Flag("account", "The account to merge, as ID or ALIAS-ID, when the base has several").String()
+		export           = kingpin.Command("export", "Converts the files to another tool's format")
+		exportTerraform  = export.Command("terraform", "Writes the users, groups, roles, managed policies, instance profiles and bucket policies in the files as Terraform resources, to bootstrap a Terraform config")
+		exportTfDir      = exportTerraform.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		exportTfAccount  = exportTerraform.Flag("account", "The account to export, as ID or ALIAS-ID, when the files have several").String()
+		exportTfOutput   = exportTerraform.Flag("output-dir", "Write each account to main.tf in a directory named for the account in this directory, instead of stdout").String()
+		exportTfImports  = exportTerraform.Flag("imports", "Also write the imports that adopt the existing resources, as import blocks for Terraform 1.5 and later, or as a script of terraform import commands for the --shell").Default("none").Enum("none", "blocks", "commands")
+		exportTfOnly     = exportTerraform.Flag("imports-only", "Only write the imports, for resources already in a Terraform config").Bool()
+		exportTfLive     = exportTerraform.Flag("live", "Export the resources in the active AWS account instead of the files").Bool()
+		exportCfn        = export.Command("cloudformation", "Writes the users, groups, roles, managed policies, instance profiles and bucket policies in the files as CloudFormation templates, with the resources to import to adopt them into stacks")
+		exportCfnDir     = exportCfn.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		exportCfnAccount = exportCfn.Flag("account", "The account to export, as ID or ALIAS-ID, when the files have several").String()
+		exportCfnOutput  = exportCfn.Flag("output-dir", "Write each account's templates and resources to import to a directory named for the account in this directory, instead of stdout").String()
+		exportCfnMax     = exportCfn.Flag("max-resources", "The most resources a template can have, the resources are split between templates beyond it").Default(fmt.Sprint(iamy.CfnMaxResources)).Int()
+		exportCfnImports = exportCfn.Flag("resources-to-import", "Write the resources to import to stdout instead of the template").Bool()
+		exportCfnLive    = exportCfn.Flag("live", "Export the resources in the active AWS account instead of the files").Bool()
+		exportPulumi     = export.Command("pulumi", "Writes the users, groups, roles, managed policies, instance profiles and bucket policies in the files as a Pulumi program, to seed a Pulumi project")
+		exportPuDir      = exportPulumi.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		exportPuAccount  = exportPulumi.Flag("account", "The account to export, as ID or ALIAS-ID, when the files have several").String()
+		exportPuOutput   = exportPulumi.Flag("output-dir", "Write each account to a Pulumi project in a directory named for the account in this directory, instead of stdout").String()
+		exportPuLanguage = exportPulumi.Flag("language", "The language of the program, a Pulumi.yaml, or a main.go").Default("yaml").Enum("yaml", "go")
+		exportPuImports  = exportPulumi.Flag("import", "Set the import option on each resource, for the first pulumi up to adopt the existing resources").Bool()
+		exportPuLive     = exportPulumi.Flag("live", "Export the resources in the active AWS account instead of the files").Bool()
+		org              = kingpin.Command("org", "Generates policies from the organization of the active AWS account")
+		orgInventory     = org.Command("inventory", "Prints the units and accounts of the organization as JSON, for org trust-policy and analyze org-conditions to read offline")
+		orgTrust         = org.Command("trust-policy", "Prints a trust policy allowing the principals of the organization, or of some of its units, to assume a role")
+		orgTrustUnits    = orgTrust.Flag("unit", "Only allow the principals in the accounts under this unit, by id, name or path, repeat flag for multiple units").Strings()
+		orgTrustActions  = orgTrust.Flag("action", "An action to allow, repeat flag for multiple actions").Default("sts:AssumeRole").Strings()
+		orgTrustInv      = orgTrust.Flag("inventory", "Read the organization from this inventory, written by org inventory, instead of AWS Organizations").ExistingFile()
+		orgTrustFormat   = orgTrust.Flag("format", "How to print the trust policy").Default("json").Enum("json", "yaml")
+		orgUpdate        = org.Command("update-accounts", "Updates the account lists of the statements in the files for the accounts that joined and left the organization since a previous inventory")
+		orgUpdateDir     = orgUpdate.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		orgUpdatePrev    = orgUpdate.Flag("previous", "The inventory written by org inventory before the accounts changed").Required().ExistingFile()
+		orgUpdateInv     = orgUpdate.Flag("inventory", "Read the current organization from this inventory instead of AWS Organizations").ExistingFile()
+		orgUpdateSave    = orgUpdate.Flag("save", "Write the current inventory over the previous one once the files are updated").Bool()
+		bucketPolicy     = kingpin.Command("bucket-policy", "Generates bucket policy statements from named templates of common patterns")
+		bucketPolicyList = bucketPolicy.Command("templates", "Lists the bucket policy templates and their parameters")
+		bucketPolicyGen  = bucketPolicy.Command("generate", "Prints a bucket policy of the templates' statements for a bucket, to paste into its file")
+		bpGenTemplates   = bucketPolicyGen.Arg("template", "A template to generate the statement of").Required().Strings()
+		bpGenBucket      = bucketPolicyGen.Flag("bucket", "The bucket the policy is for").Required().String()
+		bpGenParams      = bucketPolicyGen.Flag("param", "A template parameter, as NAME=VALUE, repeat flag for multiple parameters").StringMap()
+		bpGenFormat      = bucketPolicyGen.Flag("format", "How to print the bucket policy").Default("json").Enum("json", "yaml")
+		versions         = kingpin.Command("versions", "Lists the stored versions of the customer managed policies in the active AWS account")
+		versionsDir      = versions.Flag("dir", "The directory to read ignore rules from").Default(defaultDir).Short('d').ExistingDir()
+		versionsPrune    = versions.Flag("prune", "Delete the nondefault versions older than the --keep most recent of each policy").Bool()
+		versionsKeep     = versions.Flag("keep", "How many of the most recent versions of each policy to keep when pruning, including the default version").Default("1").Int()
+		anonymize        = kingpin.Command("anonymize", "Consistently pseudonymises account ids, names and ARNs in a JSON snapshot")
+		anonymizeFile    = anonymize.Arg("snapshot", "The JSON or YAML snapshot file to anonymize").Required().ExistingFile()
+		anonymizeSeed    = anonymize.Flag("seed", "A secret mixed into the generated pseudonyms").String()
+		anonymizeOutput  = anonymize.Flag("output", "The file to write the anonymized snapshot to, defaults to stdout").Short('o').String()
+		testCmd          = kingpin.Command("test", fmt.Sprintf("Checks principals are allowed and denied the requests the test matrix, %s by default, expects in each environment. Exits with 1 when a test fails", iamy.TestMatrixFileName))
+		testDir          = testCmd.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		testMatrix       = testCmd.Flag("matrix", "The test matrix file, instead of the one in --dir").ExistingFile()
+		testJUnit        = testCmd.Flag("junit", "Also write the results to this file as JUnit XML").String()
+		testEnvironments = testCmd.Flag("environment", "Only run the tests in this environment, repeat flag for multiple environments").Strings()
+		testOnline       = testCmd.Flag("online", "Decide the requests with the IAM policy simulator from the policies in the active AWS account instead of the files, skipping the environments in other accounts").Bool()
+		indexCmd         = kingpin.Command("index", fmt.Sprintf("Writes a reverse index of the files' statements by action and by principal to %s in --dir, for other tools to read. Pull refreshes it for the account it pulls", iamy.ReferenceIndexFileName))
+		indexDir         = indexCmd.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		indexOutput      = indexCmd.Flag("output", "The file to write the index to instead, which pull doesn't refresh").Short('o').String()
+		schemaCmd        = kingpin.Command("schema", "Prints the JSON Schema of a kind of yaml file, for editors and pre-commit hooks to validate the files with")
+		schemaKind       = schemaCmd.Arg("kind", fmt.Sprintf("The kind of file, one of %s", strings.Join(schemaKindNames(), ", "))).String()
+		schemaOutputDir  = schemaCmd.Flag("output-dir", "Write the schema of every kind of file to iamy-KIND.schema.json files in this directory instead").PlaceHolder("DIR").String()
+		report           = kingpin.Command("report", "Prints a flat inventory of the users with their groups and access key ages, the roles with their trust principals, or the policies with their attachment counts, for spreadsheets and auditors")
+		reportKind       = report.Arg("kind", fmt.Sprintf("The inventory, one of %s", strings.Join(iamy.ReportKinds, ", "))).Enum(iamy.ReportKinds...)
+		reportDir        = report.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		reportAccount    = report.Flag("account", "The account to report on, as ID or ALIAS-ID, when the files have several").String()
+		reportFormat     = report.Flag("format", "How to write the inventory, as comma or tab separated values").Default("csv").Enum("csv", "tsv")
+		reportOutputDir  = report.Flag("output-dir", "Write every inventory to KIND.FORMAT files in this directory instead").PlaceHolder("DIR").String()
+		reportLive       = report.Flag("live", "Report on the resources in the active AWS account instead of the files, with the ages of the users' access keys").Bool()
+		graph            = kingpin.Command("graph", "Prints a Graphviz DOT graph of the users, groups and their policies, the principals roles trust and the roles of instance profiles, to visualise the permission topology, eg. with iamy graph | dot -Tsvg > iamy.svg")
+		graphDir         = graph.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		graphAccount     = graph.Flag("account", "The account to graph, as ID or ALIAS-ID, when the files have several").String()
+		graphOutput      = graph.Flag("output", "The file to write the graph to, defaults to stdout").Short('o').String()
+		graphLive        = graph.Flag("live", "Graph the resources in the active AWS account instead of the files").Bool()
+		docs             = kingpin.Command("docs", "Writes a browsable site documenting the accounts, with a page for each user, group, role and managed policy linked to what they attach and are attached to, and their policy documents")
+		docsDir          = docs.Flag("dir", "The directory to load yaml files from").Default(defaultDir).Short('d').ExistingDir()
+		docsAccount      = docs.Flag("account", "The account to document, as ID or ALIAS-ID, when the files have several").String()
+		docsFormat       = docs.Flag("format", "How to write the pages, as markdown or as static HTML").Default("markdown").Enum(iamy.DocsFormats...)
+		docsOutputDir    = docs.Flag("output-dir", "The directory to write the site to").Required().PlaceHolder("DIR").String()
+		docsLive         = docs.Flag("live", "Document the resources in the active AWS account instead of the files").Bool()
+		usageCmd         = kingpin.Command("usage", "Summarises the usage log")
+		usageSummary     = usageCmd.Command("summary", "Summarises the runs in the usage log by command, with their failures by error class, durations and slowest phases")
+		usageSummaryLog  = usageSummary.Arg("log", "The usage log, instead of --usage-log").String()
+		usageSummaryJson = usageSummary.Flag("json", "Write the summary as JSON, for telemetry").Bool()
 	)
 	dryRun = kingpin.Flag("dry-run", "Show what would happen, but don't prompt to do it").Bool()
 
@@ -93,40 +377,568 @@ func main() {
 		log.SetOutput(ioutil.Discard)
 	}
 
+	if *noColor || os.Getenv("NO_COLOR") != "" {
+		color.NoColor = true
+	}
+
+	if *timezone != "" {
+		loc, err := time.LoadLocation(*timezone)
+		if err != nil {
+			ui.Error.Fatalf("Unknown --timezone %s: %s", *timezone, err)
+		}
+		ui.Location = loc
+	}
+
+	ui.Shell = *shellDialect
+	if ui.Shell == "" {
+		ui.Shell = iamy.DetectShellDialect()
+	}
+
 	if err := checkVersion(); err != nil {
 		panic(err)
 	}
 
+	if *configAggregator != "" && !accountIdReg.MatchString(*accountId) {
+		ui.Error.Fatal("--account-id ID or ALIAS-ID is required with --config-aggregator")
+	}
+	if *pushRollback && *pushJournal == "" {
+		ui.Error.Fatal("--rollback requires --journal")
+	}
+	if *pushKeepDocs && *pushDocumentDir == "" {
+		ui.Error.Fatal("--keep-document-files requires --document-dir")
+	}
+	if *pushRetention != 0 && (*pushRetention < 1 || *pushRetention > iamy.MaxAllowedPolicyVersions) {
+		ui.Error.Fatalf("--policy-version-retention must be between 1 and %d", iamy.MaxAllowedPolicyVersions)
+	}
+	if *pushAllAccounts && *pushAccountRole == "" {
+		ui.Error.Fatal("--all-accounts requires --account-role")
+	}
+	if *pushAllAccounts && (*pushJournal != "" || *pushSavedPlan != "" || len(*pushPlanOutputs) > 0 || *pushPlanJson != "" || *pushOutput != "text" || *configAggregator != "") {
+		ui.Error.Fatal("--all-accounts can't be used with --journal, --plan, --plan-output, --output or --config-aggregator, which are for one account")
+	}
+	if *restoreAs != "" && *restoreFrom == "" {
+		ui.Error.Fatal("--as requires --from")
+	}
+	if cmd == check.FullCommand() && *checkBudget >= 0 && *checkHistory == "" {
+		ui.Error.Fatal("--drift-budget requires --drift-history")
+	}
+	if *pullPublishDays != 0 && *pullPublish == "" {
+		ui.Error.Fatal("--publish-retention-days requires --publish-snapshot")
+	}
+	if *pullPublishDays < 0 {
+		ui.Error.Fatal("--publish-retention-days can't be negative")
+	}
+	if cmd == schemaCmd.FullCommand() && *schemaKind == "" && *schemaOutputDir == "" {
+		ui.Error.Fatal("schema requires a KIND or --output-dir")
+	}
+	if cmd == report.FullCommand() && *reportKind == "" && *reportOutputDir == "" {
+		ui.Error.Fatal("report requires a KIND or --output-dir")
+	}
+	if *restoreList && *restoreFrom != "" {
+		ui.Error.Fatal("--list lists the archive, it can't be used with --from")
+	}
+	if (*pullFormat == "json" || *pullFormat == "yaml-document") && (*pullCanDelete || *pullSuggest || *pullPolicyFiles) {
+		ui.Error.Fatalf("--delete, --suggest-splits and --policy-files write to the directory, they can't be used with --format %s", *pullFormat)
+	}
+	if *configAggregator != "" && *pullCanDelete {
+		ui.Error.Fatal("--delete can't be used with --config-aggregator, which only reads IAM data")
+	}
+
+	if *exportTfOnly && *exportTfImports == "none" {
+		ui.Error.Fatal("--imports-only requires --imports blocks or commands")
+	}
+	if (*exportTfLive && *exportTfAccount != "") || (*exportCfnLive && *exportCfnAccount != "") || (*exportPuLive && *exportPuAccount != "") {
+		ui.Error.Fatal("--account picks an account in the files, it can't be used with --live")
+	}
+	if *exportCfnImports && *exportCfnOutput != "" {
+		ui.Error.Fatal("--resources-to-import writes to stdout, --output-dir writes them beside the templates")
+	}
+	if cmd == analyzeDupes.FullCommand() && (*analyzeJUnit != "" || *analyzeSarif != "") {
+		ui.Error.Fatal("--junit and --sarif can't be used with analyze duplicates, which reports nothing to fail")
+	}
+	if len(*onlyKinds) > 0 && len(*excludeKinds) > 0 {
+		ui.Error.Fatal("--only and --exclude can't be used together")
+	}
+	if (len(*onlyKinds) > 0 || len(*excludeKinds) > 0) && *pullCanDelete {
+		ui.Error.Fatal("--delete can't be used with --only or --exclude, which leave files of the other types as they are")
+	}
+	var kinds []iamy.ResourceSelector
+	if len(*onlyKinds) > 0 || len(*excludeKinds) > 0 {
+		var err error
+		if kinds, err = iamy.ParseResourceKinds(append(*onlyKinds, *excludeKinds...), len(*excludeKinds) > 0); err != nil {
+			ui.Error.Fatal(err)
+		}
+	}
+
+	timings := &iamy.Timings{}
+
+	if cmd != usageSummary.FullCommand() {
+		ui.usage = newUsageRecorder(*usageLog, cmd, args, timings)
+		ui.Exit = func(code int) {
+			ui.usage.finish(ui, code)
+			os.Exit(code)
+		}
+	}
+
+	if *pushPlanJson != "" {
+		(*pushPlanOutputs)["json"] = *pushPlanJson
+	}
+
 	if *skipCfnTagged {
 		*skipTagged = append(*skipTagged, cloudformationStackNameTag)
 	}
 
+	exportSource := func(dir, account string, live bool) ExportSource {
+		return ExportSource{
+			Dir:                   dir,
+			Account:               account,
+			Live:                  live,
+			HeuristicCfnMatching:  true,
+			SkipTagged:            *skipTagged,
+			IncludeTagged:         *includeTagged,
+			SkipPathPrefixes:      *skipPathPrefixes,
+			SkipBucketPrefixes:    *skipBuckets,
+			IncludeBucketPatterns: *includeBuckets,
+			IncludeControlTower:   *includeCtrlTower,
+			Timings:               timings,
+			FallbackProfile:       *fallbackProfile,
+			FallbackRoleArn:       *fallbackRoleArn,
+		}
+	}
+
+	analyzeResults := ResultFiles{
+		JUnitFile: *analyzeJUnit,
+		SarifFile: *analyzeSarif,
+	}
+
 	switch cmd {
 	case push.FullCommand():
 		PushCommand(ui, PushCommandInput{
-			Dir:                  *pushDir,
-			HeuristicCfnMatching: !*lookupCfn,
-			SkipTagged:           *skipTagged,
-			IncludeTagged:        *includeTagged,
-			SkipPathPrefixes:     *skipPathPrefixes,
+			Dir:                   *pushDir,
+			HeuristicCfnMatching:  !*lookupCfn,
+			SkipTagged:            *skipTagged,
+			IncludeTagged:         *includeTagged,
+			SkipPathPrefixes:      *skipPathPrefixes,
+			SkipBucketPrefixes:    *skipBuckets,
+			IncludeBucketPatterns: *includeBuckets,
+			IncludeControlTower:   *includeCtrlTower,
+			Regions:               *regions,
+			Timings:               timings,
+			StateParameter:        *stateParameter,
+			MaxPullAge:            *pushMaxPullAge,
+			PlanOutputs:           *pushPlanOutputs,
+			Output:                *pushOutput,
+			DiffStyle:             *pushDiffStyle,
+			SavedPlan:             *pushSavedPlan,
+			ScriptFormat:          *pushScriptFormat,
+			Targets:               *pushTargets,
+			Kinds:                 kinds,
+			Protect:               *pushProtect,
+			QuotaWarnAt:           *pushQuotaWarnAt,
+			QuotaLimits:           *pushQuotaLimits,
+			Workers:               *pushWorkers,
+			RateLimit:             *pushRateLimit,
+			ContinueOnError:       *pushContinue,
+			VerifyBeforeApply:     *pushVerify,
+			Retry:                 iamy.RetryPolicy{Retries: *pushRetries, BaseDelay: *pushRetryDelay, MaxDelay: *pushRetryMax},
+			DetailedExitCode:      *pushExitCode,
+			Journal:               *pushJournal,
+			DocumentDir:           *pushDocumentDir,
+			KeepDocumentFiles:     *pushKeepDocs,
+			Rollback:              *pushRollback,
+			DetectRenames:         *detectRenames,
+			Prune:                 *pushPrune,
+			VersionRetention:      *pushRetention,
+			KeepVersions:          *pushKeepVersions,
+			FallbackProfile:       *fallbackProfile,
+			FallbackRoleArn:       *fallbackRoleArn,
+			ConfigAggregator:      *configAggregator,
+			AccountId:             *accountId,
+			BlastRadius:           iamy.BlastRadius{MaxDeletes: *pushMaxDeletes, MaxChangePercent: *pushMaxChange},
+			Force:                 *pushForce,
+			AllAccounts:           *pushAllAccounts,
+			AccountRole:           *pushAccountRole,
 		})
 
 	case pull.FullCommand():
 		PullCommand(ui, PullCommandInput{
-			Dir:                  *pullDir,
-			CanDelete:            *pullCanDelete,
-			HeuristicCfnMatching: !*lookupCfn,
-			SkipTagged:           *skipTagged,
-			IncludeTagged:        *includeTagged,
-			SkipPathPrefixes:     *skipPathPrefixes,
+			Dir:                   *pullDir,
+			CanDelete:             *pullCanDelete,
+			Format:                *pullFormat,
+			Kinds:                 kinds,
+			HeuristicCfnMatching:  !*lookupCfn,
+			SkipTagged:            *skipTagged,
+			IncludeTagged:         *includeTagged,
+			SkipPathPrefixes:      *skipPathPrefixes,
+			SkipBucketPrefixes:    *skipBuckets,
+			IncludeBucketPatterns: *includeBuckets,
+			IncludeControlTower:   *includeCtrlTower,
+			Regions:               *regions,
+			SnapshotFile:          *pullSnapshot,
+			PublishSnapshot:       *pullPublish,
+			PublishRetention:      iamy.SnapshotRetention{Mode: *pullPublishMode, Days: *pullPublishDays},
+			SuggestSplits:         *pullSuggest,
+			PolicyFiles:           *pullPolicyFiles,
+			SplitThresholds:       iamy.SplitThresholds{Percent: *pullSplitPercent, Count: *pullSplitCount},
+			Timings:               timings,
+			StateParameter:        *stateParameter,
+			FallbackProfile:       *fallbackProfile,
+			FallbackRoleArn:       *fallbackRoleArn,
+			ConfigAggregator:      *configAggregator,
+			AccountId:             *accountId,
 		})
 
 	case format.FullCommand():
 		FormatCommand(ui, FormatCommandInput{
 			Dir:       *formatDir,
 			CanDelete: *formatCanDelete,
+			Relayout:  *formatRelayout,
+		})
+
+	case analyzeSourceIp.FullCommand():
+		AnalyzeSourceIpCommand(ui, AnalyzeSourceIpCommandInput{
+			Dir:           *sourceIpDir,
+			AllowlistFile: *sourceIpAllow,
+			ProblemsOnly:  *sourceIpProblems,
+			ResultFiles:   analyzeResults,
+		})
+
+	case analyzeTime.FullCommand():
+		AnalyzeTimeConditionsCommand(ui, AnalyzeTimeConditionsCommandInput{
+			Dir:            *timeDir,
+			ExpiringWithin: *timeWithin,
+			RemoveExpired:  *timeRemove,
+			ResultFiles:    analyzeResults,
+		})
+
+	case analyzeMfa.FullCommand():
+		AnalyzeMfaCommand(ui, AnalyzeMfaCommandInput{
+			Dir: *mfaDir,
+			Designations: iamy.MfaDesignations{
+				Groups:   *mfaGroups,
+				Policies: *mfaPolicies,
+				UserTag:  *mfaUserTag,
+			},
+			ResultFiles: analyzeResults,
+		})
+
+	case analyzeRegions.FullCommand():
+		AnalyzeRegionsCommand(ui, AnalyzeRegionsCommandInput{
+			Dir:             *regionsDir,
+			ApprovedRegions: *regionsApproved,
+			BaselinePolicy:  *regionsBaseline,
+			ResultFiles:     analyzeResults,
+		})
+
+	case analyzeBoundary.FullCommand():
+		AnalyzeBoundariesCommand(ui, AnalyzeBoundariesCommandInput{
+			Dir:         *boundaryDir,
+			ResultFiles: analyzeResults,
+		})
+
+	case analyzeDupes.FullCommand():
+		AnalyzeDuplicatesCommand(ui, AnalyzeDuplicatesCommandInput{
+			Dir:  *dupesDir,
+			Json: *dupesJson,
+		})
+
+	case analyzeStale.FullCommand():
+		AnalyzeStaleCommand(ui, AnalyzeStaleCommandInput{
+			Dir:         *staleDir,
+			OlderThan:   *staleOlderThan,
+			ResultFiles: analyzeResults,
+		})
+
+	case analyzeEmpty.FullCommand():
+		AnalyzeEmptyCommand(ui, AnalyzeEmptyCommandInput{
+			Dir:           *emptyDir,
+			CheckLastUsed: *emptyLastUsed,
+			UnusedFor:     *emptyUnusedFor,
+			Remove:        *emptyRemove,
+			ResultFiles:   analyzeResults,
+		})
+
+	case analyzeOrgConds.FullCommand():
+		AnalyzeOrgConditionsCommand(ui, AnalyzeOrgConditionsCommandInput{
+			Dir:           *orgCondsDir,
+			MaxAccounts:   *orgCondsMax,
+			InventoryFile: *orgCondsInv,
+			ResultFiles:   analyzeResults,
+		})
+
+	case analyzeQuotas.FullCommand():
+		AnalyzeQuotasCommand(ui, AnalyzeQuotasCommandInput{
+			Dir:         *quotasDir,
+			WarnAt:      *quotasWarnAt,
+			QuotaLimits: *quotasLimits,
+			All:         *quotasAll,
+			ResultFiles: analyzeResults,
+		})
+
+	case analyzeBuckets.FullCommand():
+		AnalyzeBucketPoliciesCommand(ui, AnalyzeBucketPoliciesCommandInput{
+			Dir:          *bucketsDir,
+			MandatesFile: *bucketsMandates,
+			AddMissing:   *bucketsAdd,
+			ResultFiles:  analyzeResults,
+		})
+
+	case check.FullCommand():
+		CheckCommand(ui, CheckCommandInput{
+			Dir:                   *checkDir,
+			HeuristicCfnMatching:  !*checkAccurateCfn,
+			SkipTagged:            *skipTagged,
+			IncludeTagged:         *includeTagged,
+			SkipPathPrefixes:      *skipPathPrefixes,
+			SkipBucketPrefixes:    *skipBuckets,
+			IncludeBucketPatterns: *includeBuckets,
+			IncludeControlTower:   *includeCtrlTower,
+			Regions:               *regions,
+			Kinds:                 kinds,
+			Timings:               timings,
+			FallbackProfile:       *fallbackProfile,
+			FallbackRoleArn:       *fallbackRoleArn,
+			ConfigAggregator:      *configAggregator,
+			AccountId:             *accountId,
+			Json:                  *checkJson,
+			DriftHistory:          *checkHistory,
+			DriftBudget:           driftBudget(*checkBudget, *checkBudgetRuns),
 		})
+
+	case driftTrend.FullCommand():
+		DriftTrendCommand(ui, DriftTrendCommandInput{
+			History:  *driftTrendFile,
+			Accounts: *driftTrendAcct,
+			Last:     *driftTrendLast,
+			Json:     *driftTrendJson,
+		})
+
+	case explainDiff.FullCommand():
+		ExplainDiffCommand(ui, ExplainDiffCommandInput{
+			Dir:                   *explainDir,
+			Selector:              *explainSelector,
+			HeuristicCfnMatching:  !*explainAccurate,
+			SkipTagged:            *skipTagged,
+			IncludeTagged:         *includeTagged,
+			SkipPathPrefixes:      *skipPathPrefixes,
+			SkipBucketPrefixes:    *skipBuckets,
+			IncludeBucketPatterns: *includeBuckets,
+			IncludeControlTower:   *includeCtrlTower,
+			Regions:               *regions,
+			Timings:               timings,
+			FallbackProfile:       *fallbackProfile,
+			FallbackRoleArn:       *fallbackRoleArn,
+			Json:                  *explainJson,
+		})
+
+	case show.FullCommand():
+		ShowCommand(ui, ShowCommandInput{
+			Dir:                   *showDir,
+			Selector:              *showSelector,
+			Live:                  *showLive,
+			HeuristicCfnMatching:  true,
+			SkipTagged:            *skipTagged,
+			IncludeTagged:         *includeTagged,
+			SkipPathPrefixes:      *skipPathPrefixes,
+			SkipBucketPrefixes:    *skipBuckets,
+			IncludeBucketPatterns: *includeBuckets,
+			IncludeControlTower:   *includeCtrlTower,
+			Regions:               *regions,
+			Timings:               timings,
+			FallbackProfile:       *fallbackProfile,
+			FallbackRoleArn:       *fallbackRoleArn,
+		})
+
+	case importCmd.FullCommand():
+		ImportCommand(ui, ImportCommandInput{
+			Dir:                   *importDir,
+			Selector:              *importSelector,
+			WithReferences:        *importRefs,
+			Overwrite:             *importOverwrite,
+			HeuristicCfnMatching:  true,
+			SkipTagged:            *skipTagged,
+			IncludeTagged:         *includeTagged,
+			SkipPathPrefixes:      *skipPathPrefixes,
+			SkipBucketPrefixes:    *skipBuckets,
+			IncludeBucketPatterns: *includeBuckets,
+			IncludeControlTower:   *includeCtrlTower,
+			Regions:               *regions,
+			Timings:               timings,
+			FallbackProfile:       *fallbackProfile,
+			FallbackRoleArn:       *fallbackRoleArn,
+		})
+
+	case restore.FullCommand():
+		RestoreCommand(ui, RestoreCommandInput{
+			Dir:          *restoreDir,
+			Selector:     *restoreSelector,
+			List:         *restoreList,
+			SnapshotFile: *restoreFrom,
+			NewName:      *restoreAs,
+		})
+
+	case mergePull.FullCommand():
+		MergePullCommand(ui, MergePullCommandInput{
+			Dir:     *mergeDir,
+			Base:    *mergeBase,
+			Theirs:  *mergeTheirs,
+			Account: *mergeAccount,
+		})
+
+	case exportTerraform.FullCommand():
+		ExportTerraformCommand(ui, ExportTerraformCommandInput{
+			ExportSource: exportSource(*exportTfDir, *exportTfAccount, *exportTfLive),
+			OutputDir:    *exportTfOutput,
+			Imports:      *exportTfImports,
+			ImportsOnly:  *exportTfOnly,
+		})
+
+	case exportCfn.FullCommand():
+		ExportCloudFormationCommand(ui, ExportCloudFormationCommandInput{
+			ExportSource:      exportSource(*exportCfnDir, *exportCfnAccount, *exportCfnLive),
+			OutputDir:         *exportCfnOutput,
+			MaxResources:      *exportCfnMax,
+			ResourcesToImport: *exportCfnImports,
+		})
+
+	case exportPulumi.FullCommand():
+		ExportPulumiCommand(ui, ExportPulumiCommandInput{
+			ExportSource: exportSource(*exportPuDir, *exportPuAccount, *exportPuLive),
+			OutputDir:    *exportPuOutput,
+			Language:     *exportPuLanguage,
+			Imports:      *exportPuImports,
+		})
+
+	case orgInventory.FullCommand():
+		OrgInventoryCommand(ui, OrgCommandInput{
+			Timings:         timings,
+			FallbackProfile: *fallbackProfile,
+			FallbackRoleArn: *fallbackRoleArn,
+		})
+
+	case orgTrust.FullCommand():
+		OrgTrustPolicyCommand(ui, OrgTrustPolicyCommandInput{
+			OrgCommandInput: OrgCommandInput{
+				InventoryFile:   *orgTrustInv,
+				Timings:         timings,
+				FallbackProfile: *fallbackProfile,
+				FallbackRoleArn: *fallbackRoleArn,
+			},
+			Units:   *orgTrustUnits,
+			Actions: *orgTrustActions,
+			Format:  *orgTrustFormat,
+		})
+
+	case orgUpdate.FullCommand():
+		OrgUpdateAccountsCommand(ui, OrgUpdateAccountsCommandInput{
+			OrgCommandInput: OrgCommandInput{
+				InventoryFile:   *orgUpdateInv,
+				Timings:         timings,
+				FallbackProfile: *fallbackProfile,
+				FallbackRoleArn: *fallbackRoleArn,
+			},
+			Dir:          *orgUpdateDir,
+			PreviousFile: *orgUpdatePrev,
+			Save:         *orgUpdateSave,
+		})
+
+	case bucketPolicyList.FullCommand():
+		BucketPolicyTemplatesCommand(ui)
+
+	case bucketPolicyGen.FullCommand():
+		BucketPolicyGenerateCommand(ui, BucketPolicyGenerateCommandInput{
+			Templates: *bpGenTemplates,
+			Bucket:    *bpGenBucket,
+			Params:    *bpGenParams,
+			Format:    *bpGenFormat,
+		})
+
+	case versions.FullCommand():
+		VersionsCommand(ui, VersionsCommandInput{
+			Dir:                 *versionsDir,
+			SkipTagged:          *skipTagged,
+			IncludeTagged:       *includeTagged,
+			SkipPathPrefixes:    *skipPathPrefixes,
+			IncludeControlTower: *includeCtrlTower,
+			Timings:             timings,
+			FallbackProfile:     *fallbackProfile,
+			FallbackRoleArn:     *fallbackRoleArn,
+			Prune:               *versionsPrune,
+			Keep:                *versionsKeep,
+		})
+
+	case anonymize.FullCommand():
+		AnonymizeCommand(ui, AnonymizeCommandInput{
+			SnapshotFile: *anonymizeFile,
+			Seed:         *anonymizeSeed,
+			OutputFile:   *anonymizeOutput,
+		})
+
+	case testCmd.FullCommand():
+		TestCommand(ui, TestCommandInput{
+			Dir:             *testDir,
+			MatrixFile:      *testMatrix,
+			JUnitFile:       *testJUnit,
+			Environments:    *testEnvironments,
+			Online:          *testOnline,
+			Timings:         timings,
+			FallbackProfile: *fallbackProfile,
+			FallbackRoleArn: *fallbackRoleArn,
+		})
+
+	case schemaCmd.FullCommand():
+		SchemaCommand(ui, SchemaCommandInput{
+			Kind:      *schemaKind,
+			OutputDir: *schemaOutputDir,
+		})
+
+	case graph.FullCommand():
+		GraphCommand(ui, GraphCommandInput{
+			ExportSource: exportSource(*graphDir, *graphAccount, *graphLive),
+			Output:       *graphOutput,
+		})
+
+	case docs.FullCommand():
+		DocsCommand(ui, DocsCommandInput{
+			ExportSource: exportSource(*docsDir, *docsAccount, *docsLive),
+			Format:       *docsFormat,
+			OutputDir:    *docsOutputDir,
+		})
+
+	case report.FullCommand():
+		ReportCommand(ui, ReportCommandInput{
+			ExportSource: exportSource(*reportDir, *reportAccount, *reportLive),
+			Kind:         *reportKind,
+			Format:       *reportFormat,
+			OutputDir:    *reportOutputDir,
+		})
+
+	case indexCmd.FullCommand():
+		IndexCommand(ui, IndexCommandInput{
+			Dir:        *indexDir,
+			OutputFile: *indexOutput,
+		})
+
+	case usageSummary.FullCommand():
+		logFile := *usageSummaryLog
+		if logFile == "" {
+			logFile = *usageLog
+		}
+		if logFile == "" {
+			ui.Error.Fatal("Give the usage log to summarise, or set --usage-log or IAMY_USAGE_LOG")
+		}
+		UsageSummaryCommand(ui, UsageSummaryCommandInput{
+			LogFile: logFile,
+			Json:    *usageSummaryJson,
+		})
+	}
+
+	if *showTimings {
+		ui.PrintTimings(ui.Error, timings)
+	} else {
+		ui.PrintTimings(ui.Debug, timings)
 	}
+	ui.usage.finish(ui, 0)
 }
 
 func init() {
@@ -0,0 +1,303 @@
+package iamy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A PolicyStatement is a single statement of a policy document, located by
+// the file it's stored in so analysis results can be acted on. Source is
+// where it was written, which is another file when the resource's file
+// refers to a policy file or an anchor, or a template generates it
+type PolicyStatement struct {
+	File   string
+	Policy string
+	Index  int
+	Sid    string
+	Source Source
+
+	doc  *PolicyDocument
+	data map[string]interface{}
+}
+
+func (s PolicyStatement) String() string {
+	statement := fmt.Sprintf("#%d", s.Index)
+	if s.Sid != "" {
+		statement = s.Sid
+	}
+	if s.Source.File != "" && s.Source.File != s.File {
+		return fmt.Sprintf("%s %s statement %s, from %s", s.File, s.Policy, statement, s.Source)
+	}
+	return fmt.Sprintf("%s %s statement %s", s.File, s.Policy, statement)
+}
+
+// Location is where the statement was written, as file:line, for findings to
+// be reported in the file to change
+func (s PolicyStatement) Location() string {
+	if s.Source.File == "" {
+		return s.File
+	}
+	return s.Source.String()
+}
+
+// A Condition is a single condition key test in a statement
+type Condition struct {
+	Operator string
+	Key      string
+	Values   []string
+}
+
+// Conditions returns the statement's conditions ordered by operator and key
+func (s PolicyStatement) Conditions() []Condition {
+	result := []Condition{}
+	if conditions, ok := s.data["Condition"].(map[string]interface{}); ok {
+		for operator, keys := range conditions {
+			if keys, ok := keys.(map[string]interface{}); ok {
+				for key, value := range keys {
+					result = append(result, Condition{operator, key, conditionValues(value)})
+				}
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Operator != result[j].Operator {
+			return result[i].Operator < result[j].Operator
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// statements returns the statements of the policy document, which may be a
+// single statement or a list of them
+func (p *PolicyDocument) statements() []map[string]interface{} {
+	if p == nil {
+		return nil
+	}
+	doc, ok := p.value().(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	switch s := doc["Statement"].(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{s}
+	case []interface{}:
+		result := []map[string]interface{}{}
+		for _, item := range s {
+			if m, ok := item.(map[string]interface{}); ok {
+				result = append(result, m)
+			}
+		}
+		return result
+	}
+
+	return nil
+}
+
+type locatedPolicyDocument struct {
+	file     string
+	policy   string
+	doc      *PolicyDocument
+	resource AwsResource
+	// source is the file the document was written in, when it isn't file
+	source string
+}
+
+// policyDocuments returns every policy document in the account data
+func (a *AccountData) policyDocuments() []locatedPolicyDocument {
+	located := func(r AwsResource, policy string, doc *PolicyDocument) locatedPolicyDocument {
+		d := locatedPolicyDocument{file: a.ResourceFile(r), policy: policy, doc: doc, resource: r}
+		if source, ok := a.sources[doc]; ok && source.file != d.file {
+			d.source = source.file
+		}
+		return d
+	}
+	inline := func(r AwsResource, ips []InlinePolicy) []locatedPolicyDocument {
+		result := []locatedPolicyDocument{}
+		for _, ip := range ips {
+			result = append(result, located(r, fmt.Sprintf("InlinePolicies[%s]", ip.Name), ip.Policy))
+		}
+		return result
+	}
+
+	docs := []locatedPolicyDocument{}
+	for _, u := range a.Users {
+		docs = append(docs, inline(u, u.InlinePolicies)...)
+	}
+	for _, g := range a.Groups {
+		docs = append(docs, inline(g, g.InlinePolicies)...)
+	}
+	for _, r := range a.Roles {
+		docs = append(docs, located(r, "AssumeRolePolicyDocument", r.AssumeRolePolicyDocument))
+		docs = append(docs, inline(r, r.InlinePolicies)...)
+	}
+	for _, p := range a.Policies {
+		docs = append(docs, located(p, "Policy", p.Policy))
+	}
+	for _, bp := range a.BucketPolicies {
+		docs = append(docs, located(bp, "Policy", bp.Policy))
+	}
+	for _, ap := range a.AccessPoints {
+		docs = append(docs, located(ap, "Policy", ap.Policy))
+	}
+	for _, ap := range a.ObjectLambdaAccessPoints {
+		docs = append(docs, located(ap, "Policy", ap.Policy))
+	}
+	for _, p := range a.CodeArtifactDomainPolicies {
+		docs = append(docs, located(p, "Policy", p.Policy))
+	}
+	for _, p := range a.CodeArtifactRepositoryPolicies {
+		docs = append(docs, located(p, "Policy", p.Policy))
+	}
+	for _, p := range a.SesIdentityPolicies {
+		docs = append(docs, inline(p, p.Policies)...)
+	}
+	for _, p := range a.RestApiPolicies {
+		docs = append(docs, located(p, "Policy", p.Policy))
+	}
+	for _, ap := range a.MultiRegionAccessPoints {
+		docs = append(docs, located(ap, "Policy", ap.Policy))
+	}
+	for _, p := range a.GlacierVaultPolicies {
+		docs = append(docs, located(p, "Policy", p.Policy))
+		docs = append(docs, located(p, "LockPolicy", p.LockPolicy))
+	}
+	for _, p := range a.EcrRegistryPolicies {
+		docs = append(docs, located(p, "Policy", p.Policy))
+	}
+
+	return docs
+}
+
+// PolicyStatements returns every statement of every policy document in the
+// account data
+func (a *AccountData) PolicyStatements() []PolicyStatement {
+	result := []PolicyStatement{}
+	for _, d := range a.policyDocuments() {
+		for i, s := range d.doc.statements() {
+			sid, _ := s["Sid"].(string)
+			result = append(result, PolicyStatement{
+				File:   d.file,
+				Policy: d.policy,
+				Index:  i + 1,
+				Sid:    sid,
+				Source: a.statementSource(d, s),
+				doc:    d.doc,
+				data:   s,
+			})
+		}
+	}
+	return result
+}
+
+// principalPolicies resolves the policies attached to users, groups and
+// roles to their statements
+type principalPolicies struct {
+	data  *AccountData
+	byDoc map[*PolicyDocument][]PolicyStatement
+}
+
+func newPrincipalPolicies(data *AccountData) *principalPolicies {
+	pp := &principalPolicies{data: data, byDoc: map[*PolicyDocument][]PolicyStatement{}}
+	for _, s := range data.PolicyStatements() {
+		pp.byDoc[s.doc] = append(pp.byDoc[s.doc], s)
+	}
+	return pp
+}
+
+func (pp *principalPolicies) inlineStatements(ips []InlinePolicy) []PolicyStatement {
+	result := []PolicyStatement{}
+	for _, ip := range ips {
+		result = append(result, pp.byDoc[ip.Policy]...)
+	}
+	return result
+}
+
+// managedStatements returns the statements of the attached managed policies,
+// and the policies that aren't in the account data, eg. AWS managed policies
+func (pp *principalPolicies) managedStatements(refs []string) ([]PolicyStatement, []string) {
+	result := []PolicyStatement{}
+	unknown := []string{}
+	for _, ref := range refs {
+		if p := pp.findPolicy(ref); p != nil {
+			result = append(result, pp.byDoc[p.Policy]...)
+		} else {
+			unknown = append(unknown, ref)
+		}
+	}
+	return result, unknown
+}
+
+// findPolicy finds a managed policy by its reference as written by
+// normalisePolicyArn
+func (pp *principalPolicies) findPolicy(ref string) *Policy {
+	for _, p := range pp.data.Policies {
+		if strings.TrimPrefix(p.Path+p.Name, "/") == ref {
+			return p
+		}
+	}
+	return nil
+}
+
+func (pp *principalPolicies) findGroup(name string) *Group {
+	for _, g := range pp.data.Groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func (pp *principalPolicies) groupStatements(g *Group) ([]PolicyStatement, []string) {
+	statements, unknown := pp.managedStatements(g.Policies)
+	return append(pp.inlineStatements(g.InlinePolicies), statements...), unknown
+}
+
+// userStatements returns the statements of the user's inline and managed
+// policies and those of its groups
+func (pp *principalPolicies) userStatements(u *User) ([]PolicyStatement, []string) {
+	statements, unknown := pp.managedStatements(u.Policies)
+	statements = append(pp.inlineStatements(u.InlinePolicies), statements...)
+	for _, name := range u.Groups {
+		if g := pp.findGroup(name); g != nil {
+			groupStatements, groupUnknown := pp.groupStatements(g)
+			statements = append(statements, groupStatements...)
+			unknown = append(unknown, groupUnknown...)
+		}
+	}
+	return statements, unknown
+}
+
+func (pp *principalPolicies) roleStatements(r *Role) ([]PolicyStatement, []string) {
+	statements, unknown := pp.managedStatements(r.Policies)
+	return append(pp.inlineStatements(r.InlinePolicies), statements...), unknown
+}
+
+// conditionValues returns a condition value, which may be a single value or
+// a list, as a list of strings
+func conditionValues(v interface{}) []string {
+	switch vv := v.(type) {
+	case string:
+		return []string{vv}
+	case []interface{}:
+		result := []string{}
+		for _, i := range vv {
+			result = append(result, fmt.Sprint(i))
+		}
+		return result
+	case nil:
+		return nil
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// baseConditionOperator strips the set operator prefix and IfExists suffix
+// from a condition operator, eg. ForAnyValue:IpAddressIfExists is IpAddress
+func baseConditionOperator(operator string) string {
+	if idx := strings.Index(operator, ":"); idx >= 0 {
+		operator = operator[idx+1:]
+	}
+	return strings.TrimSuffix(operator, "IfExists")
+}
@@ -0,0 +1,134 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// AnchorsFileName is the file in the directory of YAML anchors that every
+// file can refer to with aliases and merge keys, eg. a trust policy shared by
+// many roles. It's a mapping, whose values are anchored:
+//
+//	Ec2Trust: &ec2-trust
+//	  Version: "2012-10-17"
+//	  Statement: ...
+//
+// for a role's file to have AssumeRolePolicyDocument: *ec2-trust
+const AnchorsFileName = ".iamy-anchors.yaml"
+
+// yamlReference matches anchors, aliases and merge keys
+var yamlReference = regexp.MustCompile(`(?m)(?:^|[\s\[{,])(?:[&*][^\s\[\]{},]+|<<\s*:)`)
+
+var yamlDocumentStart = regexp.MustCompile(`^---[ \t]*\n`)
+
+// usesReferences returns whether the YAML has anchors, aliases or merge
+// keys, which are expanded when the file is written
+func usesReferences(data []byte) bool {
+	return yamlReference.Match(data)
+}
+
+// A referencedFile is a file written with anchors, aliases or merge keys, as
+// it was read, and the content iamy would write for it instead
+type referencedFile struct {
+	data      []byte
+	canonical []byte
+}
+
+// anchors returns the anchors file of the directory, or nil without one
+func (f *YamlLoadDumper) anchors() ([]byte, error) {
+	if f.anchorsLoaded && f.anchorsDir == f.Dir {
+		return f.dirAnchors, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(f.Dir, AnchorsFileName))
+	if os.IsNotExist(err) {
+		data, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		var anchors map[string]interface{}
+		if err = yaml.Unmarshal(data, &anchors); err != nil {
+			return nil, validationError(AnchorsFileName, err)
+		}
+		if anchors == nil {
+			return nil, validationError(AnchorsFileName, errors.New("The anchors file must be a mapping"))
+		}
+	}
+	f.dirAnchors, f.anchorsDir, f.anchorsLoaded = data, f.Dir, true
+	return data, nil
+}
+
+// indentYaml indents every line of the YAML under a key of a mapping
+func indentYaml(data []byte) string {
+	s := strings.TrimSuffix(yamlDocumentStart.ReplaceAllString(string(data), ""), "\n")
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ") + "\n"
+}
+
+// unmarshalYaml unmarshals a file's YAML. A file referring to anchors it
+// doesn't define is read nested under the anchors file, for its aliases to
+// resolve to the anchors there
+func (f *YamlLoadDumper) unmarshalYaml(relativePath string, data []byte, v interface{}) error {
+	err := yaml.Unmarshal(data, v)
+	if err == nil || !strings.Contains(err.Error(), "unknown anchor") {
+		return err
+	}
+	anchors, aerr := f.anchors()
+	if aerr != nil || anchors == nil {
+		return err
+	}
+
+	const anchorsKey, resourceKey = ".iamy-anchors", ".iamy-resource"
+	nested := anchorsKey + ":\n" + indentYaml(anchors) + resourceKey + ":\n" + indentYaml(data)
+	var documents map[string]json.RawMessage
+	if err = yaml.Unmarshal([]byte(nested), &documents); err != nil {
+		return f.nestedYamlError(relativePath, anchors, err)
+	}
+	resource, err := yaml.JSONToYAML(documents[resourceKey])
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(resource, v)
+}
+
+// nestedYamlError returns the error of a file read nested under the anchors
+// file as an error of the file, or of the anchors file, at their own line
+func (f *YamlLoadDumper) nestedYamlError(relativePath string, anchors []byte, err error) error {
+	anchorLines := strings.Count(indentYaml(anchors), "\n")
+	match := yamlErrorLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		return &ErrValidation{File: relativePath, Err: err}
+	}
+	line, _ := strconv.Atoi(match[1])
+	file := relativePath
+	if line -= anchorLines + 2; line < 1 {
+		file, line = AnchorsFileName, line+anchorLines+1
+	}
+	message := yamlErrorLine.ReplaceAllString(err.Error(), fmt.Sprintf("line %d", line))
+	return &ErrValidation{File: file, Line: line, Err: errors.New(message)}
+}
+
+// keptReferences returns the file as it was read when it was written with
+// anchors, aliases or merge keys and its resource is unchanged, for fmt to
+// leave it as it is rather than expand it
+func (f *YamlLoadDumper) keptReferences(path string, content interface{}) ([]byte, bool) {
+	kept, ok := f.referenced[path]
+	if !ok || !f.KeepReferences {
+		return nil, false
+	}
+	canonical, err := f.styledFile(path, content)
+	if err != nil || !bytes.Equal(canonical, kept.canonical) {
+		return nil, false
+	}
+	return kept.data, true
+}
@@ -0,0 +1,91 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLoadYamlAnchors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iamy-anchors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(file, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(AnchorsFileName, `Ec2Trust: &ec2-trust
+  Version: "2012-10-17"
+  Statement:
+  - Effect: Allow
+    Principal:
+      Service: ec2.amazonaws.com
+    Action: sts:AssumeRole
+Role: &role
+  Description: An app server
+  MaxSessionDuration: 7200
+`)
+	app := `<<: *role
+AssumeRolePolicyDocument: *ec2-trust
+`
+	write("myalias-123/iam/role/app.yaml", app)
+	write("myalias-123/iam/role/worker.yaml", `Description: A worker
+AssumeRolePolicyDocument: *ec2-trust
+`)
+
+	files := YamlLoadDumper{Dir: dir}
+	accounts, err := files.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || len(accounts[0].Roles) != 2 {
+		t.Fatalf("Expected the two roles, got %v", accounts)
+	}
+	for _, r := range accounts[0].Roles {
+		if !strings.Contains(r.AssumeRolePolicyDocument.JsonString(), "ec2.amazonaws.com") {
+			t.Errorf("Expected %s to have the shared trust policy, got %s", r.Name, r.AssumeRolePolicyDocument.JsonString())
+		}
+		if r.Name == "app" && (r.Description != "An app server" || r.MaxSessionDuration != 7200) {
+			t.Errorf("Expected app to have the merged keys, got %+v", r)
+		}
+	}
+	if len(accounts[0].Warnings) != 0 {
+		t.Errorf("Expected no warnings about files with anchors, got %v", accounts[0].Warnings)
+	}
+
+	files.KeepReferences = true
+	if err := files.Dump(&accounts[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "myalias-123/iam/role/app.yaml")); string(b) != app {
+		t.Errorf("Expected fmt to keep the file with anchors, got\n%s", b)
+	}
+
+	files.KeepReferences = false
+	if err := files.Dump(&accounts[0], false); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "myalias-123/iam/role/app.yaml")); strings.Contains(string(b), "*") || !strings.Contains(string(b), "ec2.amazonaws.com") {
+		t.Errorf("Expected pull to write the file expanded, got\n%s", b)
+	}
+
+	write("myalias-123/iam/role/broken.yaml", "Description: broken\nAssumeRolePolicyDocument: *lambda-trust\n")
+	broken := YamlLoadDumper{Dir: dir}
+	_, err = broken.Load()
+	var validation *ErrValidation
+	if !errors.As(err, &validation) || validation.File != "myalias-123/iam/role/broken.yaml" || !strings.Contains(err.Error(), "unknown anchor 'lambda-trust'") {
+		t.Errorf("Expected an unknown anchor error for broken.yaml, got %v", err)
+	}
+}
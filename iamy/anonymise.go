@@ -0,0 +1,330 @@
+package iamy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var accountIdRegex = regexp.MustCompile(`\b\d{12}\b`)
+var iamArnRegex = regexp.MustCompile(`^(arn:aws[\w-]*:iam::[^:]*:)(user|group|role|policy|instance-profile)(/.*/|/)([^/]+)$`)
+var s3ArnRegex = regexp.MustCompile(`^(arn:aws[\w-]*:s3:::)([^/]+)(.*)$`)
+
+// Anonymiser consistently pseudonymises account ids, resource names and ARNs
+// in account data. The same Seed and input always produce the same output, and
+// references between resources (group memberships, policy attachments, ARNs in
+// policy documents) are rewritten with the same pseudonyms so the structure of
+// the account is preserved. Resource paths and tag keys are kept as they are.
+type Anonymiser struct {
+	Seed string
+}
+
+func (an *Anonymiser) hash(kind, s string) []byte {
+	h := sha256.Sum256([]byte(an.Seed + "\x00" + kind + "\x00" + s))
+	return h[:]
+}
+
+func (an *Anonymiser) pseudonym(kind, s string) string {
+	if s == "" {
+		return ""
+	}
+	return kind + "-" + hex.EncodeToString(an.hash(kind, s))[:10]
+}
+
+func (an *Anonymiser) accountId(id string) string {
+	n := binary.BigEndian.Uint64(an.hash("account", id)) % 1000000000000
+	return fmt.Sprintf("%012d", n)
+}
+
+func (an *Anonymiser) tags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+	result := make(map[string]string, len(tags))
+	for k, v := range tags {
+		result[k] = an.pseudonym("tag", v)
+	}
+	return result
+}
+
+func (an *Anonymiser) names(kind string, names []string) []string {
+	if names == nil {
+		return nil
+	}
+	result := make([]string, len(names))
+	for i, n := range names {
+		result[i] = an.pseudonym(kind, n)
+	}
+	return result
+}
+
+// policyRefs anonymises policy references as written by normalisePolicyArn,
+// either an ARN or a local policy's "path/name"
+func (an *Anonymiser) policyRefs(refs []string) []string {
+	if refs == nil {
+		return nil
+	}
+	result := make([]string, len(refs))
+	for i, ref := range refs {
+		result[i] = an.policyRef(ref)
+	}
+	return result
+}
+
+func (an *Anonymiser) policyRef(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	if strings.HasPrefix(ref, "arn:") {
+		return an.String(ref)
+	}
+	idx := strings.LastIndex(ref, "/")
+	return ref[:idx+1] + an.pseudonym("policy", ref[idx+1:])
+}
+
+// String anonymises a single string that may be or contain an ARN or account id
+func (an *Anonymiser) String(s string) string {
+	if m := iamArnRegex.FindStringSubmatch(s); m != nil {
+		// AWS managed policies aren't account specific
+		if strings.Contains(m[1], "::aws:") {
+			return s
+		}
+		prefix := accountIdRegex.ReplaceAllStringFunc(m[1], an.accountId)
+		if strings.ContainsAny(m[4], "*?") {
+			return prefix + m[2] + m[3] + m[4]
+		}
+		return prefix + m[2] + m[3] + an.pseudonym(m[2], m[4])
+	}
+	if m := s3ArnRegex.FindStringSubmatch(s); m != nil {
+		if strings.ContainsAny(m[2], "*?") {
+			return s
+		}
+		return m[1] + an.pseudonym("bucket", m[2]) + m[3]
+	}
+
+	return accountIdRegex.ReplaceAllStringFunc(s, an.accountId)
+}
+
+func (an *Anonymiser) policyDocumentData(i interface{}) interface{} {
+	switch v := i.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			// condition keys can contain account ids too, eg. aws:PrincipalAccount
+			result[an.String(key)] = an.policyDocumentData(val)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for idx, val := range v {
+			result[idx] = an.policyDocumentData(val)
+		}
+		return result
+	case string:
+		return an.String(v)
+	}
+
+	return i
+}
+
+func (an *Anonymiser) policyDocument(doc *PolicyDocument) *PolicyDocument {
+	if doc == nil {
+		return nil
+	}
+	return &PolicyDocument{data: recursivelyNormaliseAwsPolicy(an.policyDocumentData(doc.value()))}
+}
+
+func (an *Anonymiser) inlinePolicies(ips []InlinePolicy) []InlinePolicy {
+	if ips == nil {
+		return nil
+	}
+	result := make([]InlinePolicy, len(ips))
+	for i, ip := range ips {
+		result[i] = InlinePolicy{
+			Name:   an.pseudonym("inline-policy", ip.Name),
+			Policy: an.policyDocument(ip.Policy),
+		}
+	}
+	return result
+}
+
+// bucketAcl anonymises grants to canonical users and email addresses, group
+// grantees are well known uris
+func (an *Anonymiser) bucketAcl(acl *BucketAcl) *BucketAcl {
+	if acl == nil || acl.Canned != "" {
+		return acl
+	}
+	result := &BucketAcl{}
+	for _, g := range acl.Grants {
+		if !strings.HasPrefix(g.Grantee, "uri=") {
+			parts := strings.SplitN(g.Grantee, "=", 2)
+			g.Grantee = parts[0] + "=" + an.pseudonym("grantee", parts[len(parts)-1])
+		}
+		result.Grants = append(result.Grants, g)
+	}
+	return result
+}
+
+// AccountData returns an anonymised copy of data
+func (an *Anonymiser) AccountData(data *AccountData) *AccountData {
+	account := Account{Id: an.accountId(data.Account.Id)}
+	if data.Account.Alias != "" {
+		account.Alias = an.pseudonym("alias", data.Account.Alias)
+	}
+	result := NewAccountData(account.String())
+
+	for _, u := range data.Users {
+		result.addUser(&User{
+			iamService:          iamService{Name: an.pseudonym("user", u.Name), Path: u.Path},
+			Groups:              an.names("group", u.Groups),
+			InlinePolicies:      an.inlinePolicies(u.InlinePolicies),
+			Policies:            an.policyRefs(u.Policies),
+			PermissionsBoundary: an.policyRef(u.PermissionsBoundary),
+			Tags:                an.tags(u.Tags),
+		})
+	}
+	for _, g := range data.Groups {
+		result.addGroup(&Group{
+			iamService:     iamService{Name: an.pseudonym("group", g.Name), Path: g.Path},
+			InlinePolicies: an.inlinePolicies(g.InlinePolicies),
+			Policies:       an.policyRefs(g.Policies),
+		})
+	}
+	for _, r := range data.Roles {
+		result.addRole(&Role{
+			iamService:               iamService{Name: an.pseudonym("role", r.Name), Path: r.Path},
+			Description:              an.pseudonym("description", r.Description),
+			AssumeRolePolicyDocument: an.policyDocument(r.AssumeRolePolicyDocument),
+			InlinePolicies:           an.inlinePolicies(r.InlinePolicies),
+			Policies:                 an.policyRefs(r.Policies),
+			PermissionsBoundary:      an.policyRef(r.PermissionsBoundary),
+			MaxSessionDuration:       r.MaxSessionDuration,
+		})
+	}
+	for _, p := range data.Policies {
+		result.addPolicy(&Policy{
+			iamService:  iamService{Name: an.pseudonym("policy", p.Name), Path: p.Path},
+			Description: an.pseudonym("description", p.Description),
+			Policy:      an.policyDocument(p.Policy),
+			Tags:        an.tags(p.Tags),
+		})
+	}
+	for _, ip := range data.InstanceProfiles {
+		result.addInstanceProfile(&InstanceProfile{
+			iamService: iamService{Name: an.pseudonym("instance-profile", ip.Name), Path: ip.Path},
+			Roles:      an.names("role", ip.Roles),
+		})
+	}
+	for _, bp := range data.BucketPolicies {
+		result.addBucketPolicy(&BucketPolicy{
+			BucketName:        an.pseudonym("bucket", bp.BucketName),
+			Policy:            an.policyDocument(bp.Policy),
+			PublicAccessBlock: bp.PublicAccessBlock,
+			Acl:               an.bucketAcl(bp.Acl),
+			Tags:              an.tags(bp.Tags),
+		})
+	}
+	result.AccountPublicAccessBlock = data.AccountPublicAccessBlock
+	result.canonicalUserId = an.pseudonym("canonical-user", data.canonicalUserId)
+	for _, p := range data.CodeArtifactDomainPolicies {
+		result.addCodeArtifactDomainPolicy(&CodeArtifactDomainPolicy{
+			Region:     p.Region,
+			DomainName: an.pseudonym("codeartifact-domain", p.DomainName),
+			Policy:     an.policyDocument(p.Policy),
+		})
+	}
+	for _, p := range data.CodeArtifactRepositoryPolicies {
+		result.addCodeArtifactRepositoryPolicy(&CodeArtifactRepositoryPolicy{
+			Region:         p.Region,
+			DomainName:     an.pseudonym("codeartifact-domain", p.DomainName),
+			RepositoryName: an.pseudonym("codeartifact-repository", p.RepositoryName),
+			Policy:         an.policyDocument(p.Policy),
+		})
+	}
+	for _, p := range data.SesIdentityPolicies {
+		result.addSesIdentityPolicies(&SesIdentityPolicies{
+			Region:   p.Region,
+			Identity: an.pseudonym("ses-identity", p.Identity),
+			Policies: an.inlinePolicies(p.Policies),
+		})
+	}
+	for _, p := range data.RestApiPolicies {
+		result.addRestApiPolicy(&RestApiPolicy{
+			Region:    p.Region,
+			RestApiId: an.pseudonym("restapi", p.RestApiId),
+			Name:      an.pseudonym("restapi-name", p.Name),
+			Policy:    an.policyDocument(p.Policy),
+		})
+	}
+	for _, p := range data.AccessPoints {
+		result.addAccessPoint(&AccessPoint{
+			Region: p.Region,
+			Name:   an.pseudonym("accesspoint", p.Name),
+			Bucket: an.pseudonym("bucket", p.Bucket),
+			VpcId:  an.pseudonym("vpc", p.VpcId),
+			Policy: an.policyDocument(p.Policy),
+		})
+	}
+	for _, p := range data.ObjectLambdaAccessPoints {
+		result.addObjectLambdaAccessPoint(&ObjectLambdaAccessPoint{
+			Region:        p.Region,
+			Name:          an.pseudonym("objectlambda", p.Name),
+			Configuration: an.objectLambdaConfiguration(p.Configuration),
+			Policy:        an.policyDocument(p.Policy),
+		})
+	}
+	for _, p := range data.MultiRegionAccessPoints {
+		ap := &MultiRegionAccessPoint{
+			Name:              an.pseudonym("mrap", p.Name),
+			PublicAccessBlock: p.PublicAccessBlock,
+			Policy:            an.policyDocument(p.Policy),
+		}
+		for _, r := range p.Regions {
+			ap.Regions = append(ap.Regions, MultiRegionAccessPointRegion{Bucket: an.pseudonym("bucket", r.Bucket), Region: r.Region})
+		}
+		result.addMultiRegionAccessPoint(ap)
+	}
+	for _, p := range data.GlacierVaultPolicies {
+		result.addGlacierVaultPolicy(&GlacierVaultPolicy{
+			Region:     p.Region,
+			VaultName:  an.pseudonym("vault", p.VaultName),
+			Policy:     an.policyDocument(p.Policy),
+			LockPolicy: an.policyDocument(p.LockPolicy),
+			LockState:  p.LockState,
+		})
+	}
+	for _, p := range data.EcrRegistryPolicies {
+		result.addEcrRegistryPolicy(&EcrRegistryPolicy{
+			Region: p.Region,
+			Policy: an.policyDocument(p.Policy),
+		})
+	}
+
+	return result
+}
+
+// objectLambdaConfiguration keeps the supporting access point referring to
+// the anonymised access point
+func (an *Anonymiser) objectLambdaConfiguration(c ObjectLambdaConfiguration) ObjectLambdaConfiguration {
+	result := ObjectLambdaConfiguration{
+		CloudWatchMetricsEnabled: c.CloudWatchMetricsEnabled,
+		AllowedFeatures:          c.AllowedFeatures,
+	}
+	if idx := strings.LastIndex(c.SupportingAccessPoint, ":accesspoint/"); idx >= 0 {
+		result.SupportingAccessPoint = an.String(c.SupportingAccessPoint[:idx]) + ":accesspoint/" +
+			an.pseudonym("accesspoint", c.SupportingAccessPoint[idx+len(":accesspoint/"):])
+	} else {
+		result.SupportingAccessPoint = an.String(c.SupportingAccessPoint)
+	}
+	for _, t := range c.TransformationConfigurations {
+		t.ContentTransformation.AwsLambda = AwsLambdaTransformation{
+			FunctionArn:     an.String(t.ContentTransformation.AwsLambda.FunctionArn),
+			FunctionPayload: an.pseudonym("payload", t.ContentTransformation.AwsLambda.FunctionPayload),
+		}
+		result.TransformationConfigurations = append(result.TransformationConfigurations, t)
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package iamy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestdataAccount(t *testing.T) *AccountData {
+	d, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	y := YamlLoadDumper{Dir: filepath.Join(d, "testdata")}
+	accountData, err := y.Load()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return &accountData[0]
+}
+
+func TestAnonymiserIsDeterministic(t *testing.T) {
+	data := loadTestdataAccount(t)
+	an := Anonymiser{}
+
+	var first, second bytes.Buffer
+	if err := WriteSnapshot(&first, an.AccountData(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSnapshot(&second, an.AccountData(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.String() != second.String() {
+		t.Error("Expected anonymising the same data twice to give the same result")
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join("testdata", "snapshots", "myalias-123-anonymised.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != string(expected) {
+		t.Errorf("Anonymised snapshot doesn't match fixture, got:\n%s", first.String())
+	}
+}
+
+func TestAnonymiserPreservesReferences(t *testing.T) {
+	data := loadTestdataAccount(t)
+	anonymised := (&Anonymiser{Seed: "test"}).AccountData(data)
+
+	if anonymised.Account.Id == data.Account.Id || anonymised.Account.Alias == data.Account.Alias {
+		t.Errorf("Expected account to be anonymised, got %s", anonymised.Account)
+	}
+
+	if found, _ := anonymised.FindGroupByName(anonymised.Users[0].Groups[0], "/"); !found {
+		t.Errorf("Expected user group %s to reference an anonymised group", anonymised.Users[0].Groups[0])
+	}
+
+	if anonymised.Users[0].Policies[0] == "AmazonEC2ReadOnlyAccess" {
+		t.Error("Expected policy reference to be anonymised")
+	}
+
+	bucket := anonymised.BucketPolicies[0]
+	doc := bucket.Policy.JsonString()
+	if !strings.Contains(doc, "arn:aws:s3:::"+bucket.BucketName+"/*") {
+		t.Errorf("Expected bucket policy to reference the anonymised bucket name %s, got %s", bucket.BucketName, doc)
+	}
+	if strings.Contains(doc, "111111111111") {
+		t.Errorf("Expected account ids in policy documents to be anonymised, got %s", doc)
+	}
+}
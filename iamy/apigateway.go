@@ -0,0 +1,88 @@
+package iamy
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/apigateway"
+	"github.com/aws/aws-sdk-go/service/apigateway/apigatewayiface"
+)
+
+type apiGatewayClient struct {
+	sess    *session.Session
+	clients map[string]apigatewayiface.APIGatewayAPI
+	mutex   sync.Mutex
+}
+
+func newApiGatewayClient(sess *session.Session) *apiGatewayClient {
+	return &apiGatewayClient{
+		sess:    sess,
+		clients: map[string]apigatewayiface.APIGatewayAPI{},
+	}
+}
+
+func (c *apiGatewayClient) withRegion(region string) apigatewayiface.APIGatewayAPI {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.clients[region]; !ok {
+		c.clients[region] = apigateway.New(c.sess, aws.NewConfig().WithRegion(region))
+	}
+
+	return c.clients[region]
+}
+
+type restApi struct {
+	id         string
+	name       string
+	policyJson string
+	tags       map[string]string
+}
+
+func (c *apiGatewayClient) listRestApis(region string) ([]*restApi, error) {
+	apis := []*restApi{}
+	err := c.withRegion(region).GetRestApisPages(&apigateway.GetRestApisInput{},
+		func(resp *apigateway.GetRestApisOutput, lastPage bool) bool {
+			for _, item := range resp.Items {
+				api := restApi{
+					id:         aws.StringValue(item.Id),
+					name:       aws.StringValue(item.Name),
+					policyJson: unescapeRestApiPolicy(aws.StringValue(item.Policy)),
+					tags:       aws.StringValueMap(item.Tags),
+				}
+				apis = append(apis, &api)
+			}
+			return true
+		})
+
+	return apis, err
+}
+
+// listStages returns the names of the REST API's stages
+func (c *apiGatewayClient) listStages(region, restApiId string) ([]string, error) {
+	resp, err := c.withRegion(region).GetStages(&apigateway.GetStagesInput{RestApiId: aws.String(restApiId)})
+	if err != nil {
+		return nil, err
+	}
+	stages := []string{}
+	for _, item := range resp.Item {
+		stages = append(stages, aws.StringValue(item.StageName))
+	}
+	sort.Strings(stages)
+	return stages, nil
+}
+
+// unescapeRestApiPolicy undoes the escaping API Gateway applies to the
+// quotes in policies, which it returns as {\"Version\":...}
+func unescapeRestApiPolicy(policy string) string {
+	if policy == "" {
+		return ""
+	}
+	if unquoted, err := strconv.Unquote(`"` + policy + `"`); err == nil {
+		return unquoted
+	}
+	return policy
+}
@@ -0,0 +1,174 @@
+package iamy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ArchiveDirName is the directory pull --delete keeps a tombstone in for each
+// file it removes, at the same path as the file was in the directory, as yaml
+const ArchiveDirName = "archive"
+
+// tombstonePath returns the tombstone's path for the file, relative to the
+// directory
+func tombstonePath(file string) string {
+	return filepath.Join(ArchiveDirName, filepath.FromSlash(strings.TrimSuffix(file, filepath.Ext(file))+".yaml"))
+}
+
+// A Tombstone is the last known file of a resource that was deleted from AWS,
+// kept when pull --delete removed the file so it can be restored
+type Tombstone struct {
+	// File is where the file was, relative to the directory
+	File string `json:"File"`
+	// Resource is the kind, path and name of the resource, eg.
+	// iam/role/people/app, for files in a layout that doesn't give them
+	Resource string `json:"Resource,omitempty"`
+	// DeletedAt is when pull found the resource had been deleted
+	DeletedAt time.Time `json:"DeletedAt"`
+	Document  string    `json:"Document"`
+}
+
+var tombstoneResource = regexp.MustCompile(`^(?P<entity>` + entityPattern + `)(?P<resourcepath>/(?:[^/]+/)*)(?P<resourcename>[^/]+)$`)
+
+// Matches returns whether the selector selects the resource the tombstone is
+// for
+func (t Tombstone) Matches(s ResourceSelector) bool {
+	matched, result := namedMatch(tombstoneResource, t.Resource)
+	if t.Resource == "" {
+		_, entity, path, name, ok := defaultLayout.parse(t.File)
+		matched, result = ok, map[string]string{"entity": entity, "resourcepath": path, "resourcename": name}
+	}
+	if !matched {
+		return false
+	}
+	parts := strings.SplitN(result["entity"], "/", 2)
+	resourceType := ""
+	if len(parts) == 2 {
+		resourceType = parts[1]
+	}
+	return s.matchesName(parts[0], resourceType, result["resourcepath"], result["resourcename"])
+}
+
+// skippedByFetch returns whether the fetch of the account data skipped the
+// resource, for an ignore rule, skip option or as managed by Control Tower,
+// CloudFormation or AWS, which it warns about by type and name
+func skippedByFetch(accountData *AccountData, r AwsResource) bool {
+	cfnType, _ := resourceCfnType(r)
+	if cfnType == "" {
+		return false
+	}
+	key := fmt.Sprintf("%s %s", cfnType, r.ResourceName())
+	for _, w := range accountData.Warnings {
+		if (w.Category == WarningSkipped || w.Category == WarningControlTower) && w.Resource == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ArchiveDeleted keeps a tombstone for each file of the account that isn't
+// for a resource in the fetched accountData, before Dump removes them, and
+// returns them. Only the files of resources the fetch would have returned are
+// for deleted resources, so those of the kinds it wasn't restricted to, and
+// of resources it skipped, don't get one. The tombstones of resources that
+// exist again are removed
+func (f *YamlLoadDumper) ArchiveDeleted(accountData *AccountData, kinds []ResourceSelector, now time.Time) ([]Tombstone, error) {
+	layout, err := f.layout()
+	if err != nil {
+		return nil, err
+	}
+	kept := map[string]bool{}
+	for _, r := range accountData.resources() {
+		path, err := f.resourceFile(accountData.Account, r)
+		if err != nil {
+			return nil, err
+		}
+		kept[strings.TrimSuffix(path, filepath.Ext(path))] = true
+		if err := os.Remove(filepath.Join(f.Dir, tombstonePath(path))); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	archived := []Tombstone{}
+	files, err := f.accountFiles(accountData.Account)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range files {
+		if kept[strings.TrimSuffix(rel, filepath.Ext(rel))] {
+			continue
+		}
+
+		doc, err := ioutil.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		_, entity, path, name, _ := layout.parse(rel)
+		if !layout.hasPath {
+			if path, err = f.resourcePathInFile(rel); err != nil {
+				return nil, err
+			}
+		}
+		r, err := f.loadResource(NewAccountData(accountData.Account.String()), entity, path, name, func(v interface{}) error {
+			return f.unmarshalYamlFile(rel, v)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && (skippedByFetch(accountData, r) || !selectsResource(kinds, r)) {
+			continue
+		}
+		t := Tombstone{
+			File:      rel,
+			Resource:  entity + path + name,
+			DeletedAt: now.UTC().Truncate(time.Second),
+			Document:  string(doc),
+		}
+		archived = append(archived, t)
+		if err := writeYamlFile(filepath.Join(f.Dir, tombstonePath(rel)), t); err != nil {
+			return nil, err
+		}
+	}
+	return archived, nil
+}
+
+// LoadTombstones reads the tombstones in the archive directory, sorted by the
+// file they're for
+func (f *YamlLoadDumper) LoadTombstones() ([]Tombstone, error) {
+	archiveDir := filepath.Join(f.Dir, ArchiveDirName)
+	tombstones := []Tombstone{}
+	if _, err := os.Stat(archiveDir); os.IsNotExist(err) {
+		return tombstones, nil
+	}
+	err := filepath.Walk(archiveDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".yaml" {
+			return err
+		}
+		var t Tombstone
+		rel, _ := filepath.Rel(f.Dir, path)
+		if err := f.unmarshalYamlFile(rel, &t); err != nil {
+			return err
+		}
+		tombstones = append(tombstones, t)
+		return nil
+	})
+	return tombstones, err
+}
+
+// Restore writes the tombstone's file back, for the next push to recreate the
+// resource, and removes the tombstone
+func (f *YamlLoadDumper) Restore(t Tombstone) error {
+	path := filepath.Join(f.Dir, filepath.FromSlash(t.File))
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte(t.Document), 0666); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(f.Dir, tombstonePath(t.File)))
+}
@@ -0,0 +1,136 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchiveDeleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archivetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := NewAccountData("123")
+	data.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}})
+	data.addUser(&User{iamService: iamService{Name: "bob", Path: "/staff/"}})
+	yaml := YamlLoadDumper{Dir: dir}
+	if err = yaml.Dump(data, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob was deleted from AWS
+	pulled := NewAccountData("123")
+	pulled.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}})
+	deletedAt := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	archived, err := yaml.ArchiveDeleted(pulled, nil, deletedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 1 || archived[0].File != "123/iam/user/staff/bob.yaml" {
+		t.Fatalf("Expected bob's file to be archived, got %+v", archived)
+	}
+	if err = yaml.Dump(pulled, true); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := yaml.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || len(accounts[0].Users) != 1 {
+		t.Fatalf("Expected the archive not to be loaded as an account, got %+v", accounts)
+	}
+
+	tombstones, err := yaml.LoadTombstones()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tombstones) != 1 || !tombstones[0].DeletedAt.Equal(deletedAt) || tombstones[0].Document != archived[0].Document {
+		t.Fatalf("Expected bob's tombstone, got %+v", tombstones)
+	}
+	for _, c := range []struct {
+		selector string
+		matches  bool
+	}{
+		{"user/bob", true},
+		{"user/staff/*", true},
+		{"user/alice", false},
+		{"role/bob", false},
+	} {
+		s, _ := ParseResourceSelector(c.selector)
+		if tombstones[0].Matches(s) != c.matches {
+			t.Errorf("Expected %s matching bob's tombstone to be %v", c.selector, c.matches)
+		}
+	}
+
+	if err = yaml.Restore(tombstones[0]); err != nil {
+		t.Fatal(err)
+	}
+	if accounts, err = yaml.Load(); err != nil || len(accounts[0].Users) != 2 {
+		t.Fatalf("Expected bob to be restored, got %+v %v", accounts, err)
+	}
+	if tombstones, _ = yaml.LoadTombstones(); len(tombstones) != 0 {
+		t.Errorf("Expected the tombstone to be removed, got %+v", tombstones)
+	}
+
+	// a pull that finds bob again removes his tombstone
+	if _, err = yaml.ArchiveDeleted(pulled, nil, deletedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = yaml.ArchiveDeleted(data, nil, deletedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, ArchiveDirName, "123/iam/user/staff/bob.yaml")); !os.IsNotExist(err) {
+		t.Errorf("Expected the tombstone of a resource that exists again to be removed, got %v", err)
+	}
+}
+
+func TestArchiveDeletedSkipsResourcesNotFetched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archivetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	data := NewAccountData("123")
+	data.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}})
+	data.addUser(&User{iamService: iamService{Name: "deploy", Path: "/"}})
+	data.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: trust})
+	yaml := YamlLoadDumper{Dir: dir}
+	if err = yaml.Dump(data, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// deploy is in a stack the pull skips, and alice was deleted
+	pulled := NewAccountData("123")
+	pulled.Warnings.Add(WarningSkipped, "AWS::IAM::User deploy", "Skipping resource deploy tagged with aws:cloudformation:stack-name in stack deploy")
+	archived, err := yaml.ArchiveDeleted(pulled, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 2 || archived[0].File != "123/iam/role/app.yaml" || archived[1].File != "123/iam/user/alice.yaml" {
+		t.Errorf("Expected only the files of resources the pull didn't skip to be archived, got %+v", archived)
+	}
+
+	// a pull of only users doesn't fetch the role
+	if err = os.RemoveAll(filepath.Join(dir, ArchiveDirName)); err != nil {
+		t.Fatal(err)
+	}
+	kinds, err := ParseResourceKinds([]string{"users"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived, err = yaml.ArchiveDeleted(pulled, kinds, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 1 || archived[0].File != "123/iam/user/alice.yaml" {
+		t.Errorf("Expected only the files of the kinds pulled to be archived, got %+v", archived)
+	}
+}
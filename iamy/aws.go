@@ -1,13 +1,21 @@
 package iamy
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 	"github.com/pkg/errors"
 )
 
@@ -20,16 +28,76 @@ type AwsFetcher struct {
 	SkipTagged                            []string
 	IncludeTagged                         []string
 	SkipPathPrefixes                      []string
+	// SkipBucketPrefixes skips S3 buckets with names starting with any of the
+	// prefixes. IncludeBucketPatterns, if set, skips S3 buckets with names not
+	// matching any of the patterns, see filepath.Match for the syntax
+	SkipBucketPrefixes    []string
+	IncludeBucketPatterns []string
+	// IncludeControlTower fetches resources AWS Control Tower manages, which
+	// are skipped by default
+	IncludeControlTower bool
+	// Regions to fetch regional resources (API Gateway REST APIs, S3 Access Points,
+	// S3 Object Lambda Access Points, CodeArtifact domains and repositories, SES
+	// identities, Glacier vaults and ECR registry policies) from,
+	// defaults to the region of the AWS session
+	Regions []string
+	// Ignore extends and overrides the built-in ignore rules. If it's nil only
+	// the built-in rules apply
+	Ignore *IgnoreCatalogue
+	// Timings, if set, records how long each phase of the fetch takes
+	Timings *Timings
+	// FallbackProfile and FallbackRoleArn are the credentials to retry the
+	// parts of a fetch that fail with an authentication error with, eg. while
+	// credentials are being rotated. The role is assumed with the fallback
+	// profile if there is one, otherwise with the default credentials
+	FallbackProfile string
+	FallbackRoleArn string
+	// RoleArn is a role to assume with the default credentials to fetch the
+	// role's account, eg. to fetch several accounts with one set of
+	// credentials
+	RoleArn string
+	// Phases limits the fetch to the named phases, eg. "iam", when only some
+	// resources are needed. Every phase is fetched if it's empty
+	Phases []string
+	// ConfigAggregator is an AWS Config aggregator, in the account of the
+	// credentials, to read the IAM data of the account AccountId from instead
+	// of its IAM API, when there are no credentials for the account. The data
+	// is as current as the aggregator, other resources aren't fetched and
+	// instance profiles without roles are missing, so it's only for reports
+	// and drift detection
+	ConfigAggregator string
+	// AccountId is the account to read from ConfigAggregator, as id or
+	// alias-id, as the aggregator doesn't know account aliases
+	AccountId string
 
 	Debug *log.Logger
 
-	iam     *iamClient
-	s3      *s3Client
-	cfn     *cfnClient
-	tagging *resourceGroupsTaggingAPIClient
-	account *Account
-	data    AccountData
-
+	iam          *iamClient
+	s3           *s3Client
+	s3control    *s3ControlClient
+	cfn          *cfnClient
+	tagging      *resourceGroupsTaggingAPIClient
+	codeartifact *codeArtifactClient
+	ses          *sesClient
+	apigateway   *apiGatewayClient
+	glacier      *glacierClient
+	ecr          *ecrClient
+	config       *configServiceClient
+	orgs         *organizationsClient
+	account      *Account
+	data         AccountData
+	sess         *session.Session
+
+	usingFallback bool
+	// callerAccountId returns the account of a session's credentials,
+	// defaulting to asking STS
+	callerAccountId func(*session.Session) (string, error)
+	ignoreRules     []IgnoreRule
+	// configPolicyTags are the tags of managed policies by ARN, when the IAM
+	// data is read from a Config aggregator
+	configPolicyTags map[string]map[string]string
+
+	warningsMutex             sync.Mutex
 	descriptionFetchWaitGroup sync.WaitGroup
 	descriptionFetchError     error
 	policyTagFetchError       error
@@ -39,16 +107,260 @@ func (a *AwsFetcher) init() error {
 	var err error
 
 	s := awsSession()
+	if a.RoleArn != "" {
+		s = s.Copy(&aws.Config{Credentials: stscreds.NewCredentials(s, a.RoleArn)})
+	}
+	a.initClients(s)
+	if len(a.Regions) == 0 {
+		a.Regions = []string{aws.StringValue(a.sess.Config.Region)}
+	}
+
+	if a.ConfigAggregator != "" {
+		a.account = NewAccountFromString(a.AccountId)
+		a.data.Account = a.account
+		a.ignoreRules = a.Ignore.rulesFor(a.account)
+		return nil
+	}
+
+	a.account, err = a.getAccount()
+	if isAuthError(err) && a.hasFallback() && !a.usingFallback {
+		a.warn(WarningFallback, "account", fmt.Sprintf("Using %s after the primary credentials failed: %s", a.fallbackDescription(), err))
+		if err = a.switchToFallback(); err != nil {
+			return err
+		}
+		a.account, err = a.getAccount()
+	}
+	if err != nil {
+		return err
+	}
+	a.data.Account = a.account
+	a.ignoreRules = a.Ignore.rulesFor(a.account)
+
+	return nil
+}
+
+func (a *AwsFetcher) initClients(s *session.Session) {
+	a.sess = s
 	a.iam = newIamClient(s)
 	a.s3 = newS3Client(s)
+	a.s3control = newS3ControlClient(s)
 	a.cfn = newCfnClient(s)
 	a.tagging = newResourceGroupsTaggingAPIClient(s)
+	a.codeartifact = newCodeArtifactClient(s)
+	a.ses = newSesClient(s)
+	a.apigateway = newApiGatewayClient(s)
+	a.glacier = newGlacierClient(s)
+	a.ecr = newEcrClient(s)
+	a.config = newConfigServiceClient(s)
+	a.orgs = newOrganizationsClient(s)
+	a.s3.timings = a.Timings
+}
 
-	if a.account, err = a.getAccount(); err != nil {
-		return err
+func (a *AwsFetcher) hasFallback() bool {
+	return a.FallbackProfile != "" || a.FallbackRoleArn != ""
+}
+
+func (a *AwsFetcher) fallbackDescription() string {
+	parts := []string{}
+	if a.FallbackProfile != "" {
+		parts = append(parts, "profile "+a.FallbackProfile)
+	}
+	if a.FallbackRoleArn != "" {
+		parts = append(parts, "role "+a.FallbackRoleArn)
+	}
+	return "fallback credentials (" + strings.Join(parts, ", ") + ")"
+}
+
+// targetAccountId returns the id of the account being fetched, once it's
+// known or from the role assumed in it, otherwise an empty string
+func (a *AwsFetcher) targetAccountId() string {
+	if a.account != nil {
+		return a.account.Id
+	}
+	if a.RoleArn != "" {
+		return getAccountIdFromArn(a.RoleArn)
+	}
+	return ""
+}
+
+// switchToFallback replaces the clients with ones using the fallback
+// credentials, once they're checked to be for the account being fetched. It
+// must not be called while a fetch phase is running
+func (a *AwsFetcher) switchToFallback() error {
+	s, err := fallbackAwsSession(a.FallbackProfile, a.FallbackRoleArn)
+	if err != nil {
+		return errors.Wrap(err, "Error creating a session with the fallback credentials")
 	}
-	a.data = AccountData{
-		Account: a.account,
+	if target := a.targetAccountId(); target != "" {
+		callerAccountId := a.callerAccountId
+		if callerAccountId == nil {
+			callerAccountId = determineAccountIdViaGetCallerIdentity
+		}
+		id, err := callerAccountId(s)
+		if err != nil {
+			return errors.Wrap(err, "Error finding the account of the fallback credentials")
+		}
+		if id != target {
+			return fmt.Errorf("The %s are for account %s, not account %s being fetched", a.fallbackDescription(), id, target)
+		}
+	}
+	managedResources, stackNames := a.cfn.managedResources, a.cfn.stackNames
+	a.initClients(s)
+	a.cfn.managedResources, a.cfn.stackNames = managedResources, stackNames
+	a.usingFallback = true
+
+	return nil
+}
+
+// OptionsHash summarises the options that change which resources are
+// fetched, so data fetched with different options can be detected
+func (a *AwsFetcher) OptionsHash() string {
+	options := []string{
+		fmt.Sprintf("heuristic-cfn=%t", a.HeuristicCfnMatching),
+		"skip-tagged=" + strings.Join(sortedCopy(a.SkipTagged), ","),
+		"include-tagged=" + strings.Join(sortedCopy(a.IncludeTagged), ","),
+		"skip-path-prefix=" + strings.Join(sortedCopy(a.SkipPathPrefixes), ","),
+		"region=" + strings.Join(sortedCopy(a.Regions), ","),
+	}
+	// only included when set, so hashes recorded before these options existed
+	// still match
+	if len(a.SkipBucketPrefixes) > 0 {
+		options = append(options, "skip-bucket-prefix="+strings.Join(sortedCopy(a.SkipBucketPrefixes), ","))
+	}
+	if len(a.IncludeBucketPatterns) > 0 {
+		options = append(options, "include-bucket-pattern="+strings.Join(sortedCopy(a.IncludeBucketPatterns), ","))
+	}
+	// always included, as both skip resources by default
+	options = append(options,
+		fmt.Sprintf("include-control-tower=%t", a.IncludeControlTower),
+		"ignore="+ignoreRulesOption(a.ignoreRules))
+	h := sha256.Sum256([]byte(strings.Join(options, "\n")))
+	return hex.EncodeToString(h[:])[:12]
+}
+
+// IamClient is the IAM client of the account fetched, with the credentials
+// of the role assumed in it, or the fallback credentials once they're used.
+// The fetch must have run
+func (a *AwsFetcher) IamClient() iamiface.IAMAPI {
+	return a.iam.IAMAPI
+}
+
+// A fetchPhase is a part of a fetch that can be rerun with the fallback
+// credentials. reset discards anything a failed run added to the data
+type fetchPhase struct {
+	name        string
+	description string
+	fetch       func() error
+	reset       func()
+}
+
+func (a *AwsFetcher) cfnPhase() fetchPhase {
+	fetch := func() error {
+		return a.cfn.PopulateMangedResourceData()
+	}
+	return fetchPhase{"cfn stacks and resources", "CFN", fetch, func() {}}
+}
+
+func (a *AwsFetcher) fetchPhases() []fetchPhase {
+	return []fetchPhase{
+		{"iam", "IAM", a.fetchIamData, func() {
+			a.descriptionFetchWaitGroup.Wait()
+			a.descriptionFetchError = nil
+			a.policyTagFetchError = nil
+			a.data.Users = nil
+			a.data.Groups = nil
+			a.data.Roles = nil
+			a.data.Policies = nil
+			a.data.InstanceProfiles = nil
+			a.data.AwsManagedPolicyVersions = nil
+		}},
+		{"s3", "S3", a.fetchS3Data, func() {
+			a.data.BucketPolicies = nil
+			a.data.AccountPublicAccessBlock = nil
+			a.data.canonicalUserId = ""
+		}},
+		{"s3 access points", "S3 Access Point", a.fetchAccessPointData, func() {
+			a.data.AccessPoints = nil
+		}},
+		{"s3 object lambda access points", "S3 Object Lambda Access Point", a.fetchObjectLambdaAccessPointData, func() {
+			a.data.ObjectLambdaAccessPoints = nil
+		}},
+		{"s3 multi-region access points", "S3 Multi-Region Access Point", a.fetchMultiRegionAccessPointData, func() {
+			a.data.MultiRegionAccessPoints = nil
+		}},
+		{"codeartifact", "CodeArtifact", a.fetchCodeArtifactData, func() {
+			a.data.CodeArtifactDomainPolicies = nil
+			a.data.CodeArtifactRepositoryPolicies = nil
+		}},
+		{"ses", "SES", a.fetchSesData, func() {
+			a.data.SesIdentityPolicies = nil
+		}},
+		{"apigateway", "API Gateway", a.fetchApiGatewayData, func() {
+			a.data.RestApiPolicies = nil
+		}},
+		{"glacier", "Glacier", a.fetchGlacierData, func() {
+			a.data.GlacierVaultPolicies = nil
+		}},
+		{"ecr", "ECR", a.fetchEcrData, func() {
+			a.data.EcrRegistryPolicies = nil
+		}},
+	}
+}
+
+// runPhases runs the phases concurrently, returning an error for each
+func (a *AwsFetcher) runPhases(phases []fetchPhase) []error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(phases))
+
+	for i, phase := range phases {
+		log.Printf("Fetching %s data", phase.description)
+		wg.Add(1)
+		go func(i int, phase fetchPhase) {
+			defer wg.Done()
+			defer a.Timings.Track(phase.name)()
+			errs[i] = phase.fetch()
+		}(i, phase)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// runPhasesWithFallback runs the phases, and if any fail with an
+// authentication error reruns them with the fallback credentials
+func (a *AwsFetcher) runPhasesWithFallback(phases []fetchPhase) error {
+	errs := a.runPhases(phases)
+
+	if a.hasFallback() && !a.usingFallback {
+		retry := []fetchPhase{}
+		retryIdx := []int{}
+		for i, err := range errs {
+			if isAuthError(err) {
+				retry = append(retry, phases[i])
+				retryIdx = append(retryIdx, i)
+			}
+		}
+
+		if len(retry) > 0 {
+			if err := a.switchToFallback(); err != nil {
+				return err
+			}
+			for _, phase := range retry {
+				phase.reset()
+			}
+			for n, err := range a.runPhases(retry) {
+				if err == nil {
+					a.warn(WarningFallback, retry[n].name, fmt.Sprintf("Fetched %s data with %s after the primary credentials failed: %s", retry[n].description, a.fallbackDescription(), errs[retryIdx[n]]))
+				}
+				errs[retryIdx[n]] = err
+			}
+		}
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return errors.Wrapf(classifyAwsError(err), "Error fetching %s data", phases[i].description)
+		}
 	}
 
 	return nil
@@ -60,67 +372,410 @@ func (a *AwsFetcher) Fetch() (*AccountData, error) {
 		return nil, errors.Wrap(err, "Error in init")
 	}
 
-	if !a.HeuristicCfnMatching {
-		log.Println("Fetching CFN data")
-		if err := a.cfn.PopulateMangedResourceData(); err != nil {
-			return nil, errors.Wrap(err, "Error fetching CFN data")
+	if a.ConfigAggregator != "" {
+		data, err := a.fetchFromConfigAggregator()
+		if err != nil {
+			return nil, err
 		}
+		data.SortCanonically()
+		data.internStrings()
+		return data, nil
 	}
 
-	var wg sync.WaitGroup
-	var iamErr, s3Err error
-
-	log.Println("Fetching IAM data")
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		iamErr = a.fetchIamData()
-	}()
-
-	log.Println("Fetching S3 data")
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		s3Err = a.fetchS3Data()
-	}()
-
-	wg.Wait()
+	if !a.HeuristicCfnMatching {
+		if err := a.runPhasesWithFallback([]fetchPhase{a.cfnPhase()}); err != nil {
+			return nil, err
+		}
+	}
 
-	if iamErr != nil {
-		return nil, errors.Wrap(iamErr, "Error fetching IAM data")
+	phases := []fetchPhase{}
+	for _, phase := range a.fetchPhases() {
+		if len(a.Phases) == 0 || stringSliceContains(a.Phases, phase.name) {
+			phases = append(phases, phase)
+		}
 	}
-	if s3Err != nil {
-		return nil, errors.Wrap(s3Err, "Error fetching S3 data")
+	if err := a.runPhasesWithFallback(phases); err != nil {
+		return nil, err
 	}
 
+	a.data.Warnings = a.data.Warnings.unique()
+	a.data.SortCanonically()
+	a.data.internStrings()
+
 	return &a.data, nil
 }
 
 func (a *AwsFetcher) fetchS3Data() error {
-	buckets, err := a.s3.listAllBuckets()
+	buckets, canonicalUserId, err := a.s3.listAllBuckets(func(name string) bool {
+		if ok, reason := a.isSkippableBucketName(name); ok {
+			a.warnSkipped(CfnS3Bucket, name, reason)
+			return false
+		}
+		return true
+	})
 	if err != nil {
 		return errors.Wrap(err, "Error listing buckets")
 	}
+	a.data.canonicalUserId = canonicalUserId
 	for _, b := range buckets {
-		if b.policyJson == "" {
+		tags := userTags(b.tags)
+		if b.policyJson == "" && b.publicAccessBlock == nil && b.acl == nil && len(tags) == 0 {
 			continue
 		}
-		if ok, err := a.isSkippableManagedResource(CfnS3Bucket, b.name, b.tags, "__DONTSKIPS3__"); ok {
-			log.Printf(err)
+		if ok, err := a.isSkippableManagedResource(CfnS3Bucket, b.name, b.tags, nonIamResourcePath); ok {
+			a.warnSkipped(CfnS3Bucket, b.name, err)
+			continue
+		}
+
+		bp := BucketPolicy{
+			BucketName:        b.name,
+			PublicAccessBlock: b.publicAccessBlock,
+			Acl:               b.acl,
+			Tags:              tags,
+			systemTags:        systemTags(b.tags),
+		}
+		if b.policyJson != "" {
+			bp.Policy, err = NewPolicyDocumentFromJson(b.policyJson)
+			if err != nil {
+				return errors.Wrap(err, "Error creating Policy document")
+			}
+		}
+
+		a.data.BucketPolicies = append(a.data.BucketPolicies, &bp)
+	}
+
+	pab, err := a.s3control.getAccountPublicAccessBlock(a.account.Id)
+	if isAccessDeniedError(err) {
+		a.warn(WarningAccessDenied, "s3control", fmt.Sprintf("Skipping account Block Public Access configuration: %s", err))
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error fetching account Block Public Access configuration")
+	}
+	if pab != nil {
+		a.data.AccountPublicAccessBlock = &AccountPublicAccessBlock{*pab}
+	}
+
+	return nil
+}
+
+func (a *AwsFetcher) fetchAccessPointData() error {
+	for _, region := range a.Regions {
+		accessPoints, err := a.s3control.listAccessPoints(a.account.Id, region)
+		if isAccessDeniedError(err) {
+			a.warn(WarningAccessDenied, "s3control", fmt.Sprintf("Skipping S3 Access Points in %s: %s", region, err))
 			continue
 		}
+		if err != nil {
+			return errors.Wrapf(err, "Error listing S3 Access Points in %s", region)
+		}
+
+		for _, ap := range accessPoints {
+			if ok, err := a.isSkippableManagedResource(CfnS3AccessPoint, ap.name, map[string]string{}, nonIamResourcePath); ok {
+				a.warnSkipped(CfnS3AccessPoint, ap.name, err)
+				continue
+			}
+
+			p := AccessPoint{
+				Region: region,
+				Name:   ap.name,
+				Bucket: ap.bucket,
+				VpcId:  ap.vpcId,
+			}
+			if ap.policyJson != "" {
+				p.Policy, err = NewPolicyDocumentFromJson(ap.policyJson)
+				if err != nil {
+					return errors.Wrap(err, "Error creating Policy document")
+				}
+			}
+
+			a.data.addAccessPoint(&p)
+		}
+	}
+
+	return nil
+}
 
-		policyDoc, err := NewPolicyDocumentFromJson(b.policyJson)
+func (a *AwsFetcher) fetchObjectLambdaAccessPointData() error {
+	for _, region := range a.Regions {
+		accessPoints, err := a.s3control.listObjectLambdaAccessPoints(a.account.Id, region)
+		if isAccessDeniedError(err) {
+			a.warn(WarningAccessDenied, "s3control", fmt.Sprintf("Skipping S3 Object Lambda Access Points in %s: %s", region, err))
+			continue
+		}
 		if err != nil {
-			return errors.Wrap(err, "Error creating Policy document")
+			return errors.Wrapf(err, "Error listing S3 Object Lambda Access Points in %s", region)
 		}
 
-		bp := BucketPolicy{
-			BucketName: b.name,
-			Policy:     policyDoc,
+		for _, ap := range accessPoints {
+			if ok, err := a.isSkippableManagedResource(CfnS3ObjectLambda, ap.name, map[string]string{}, nonIamResourcePath); ok {
+				a.warnSkipped(CfnS3ObjectLambda, ap.name, err)
+				continue
+			}
+
+			p := ObjectLambdaAccessPoint{
+				Region:        region,
+				Name:          ap.name,
+				Configuration: ap.configuration,
+			}
+			if ap.policyJson != "" {
+				p.Policy, err = NewPolicyDocumentFromJson(ap.policyJson)
+				if err != nil {
+					return errors.Wrap(err, "Error creating Policy document")
+				}
+			}
+
+			a.data.addObjectLambdaAccessPoint(&p)
 		}
+	}
 
-		a.data.BucketPolicies = append(a.data.BucketPolicies, &bp)
+	return nil
+}
+
+func (a *AwsFetcher) fetchMultiRegionAccessPointData() error {
+	accessPoints, err := a.s3control.listMultiRegionAccessPoints(a.account.Id)
+	if isAccessDeniedError(err) {
+		a.warn(WarningAccessDenied, "s3control", fmt.Sprintf("Skipping S3 Multi-Region Access Points: %s", err))
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error listing S3 Multi-Region Access Points")
+	}
+
+	for _, ap := range accessPoints {
+		if ok, err := a.isSkippableManagedResource(CfnS3MultiRegion, ap.name, map[string]string{}, nonIamResourcePath); ok {
+			a.warnSkipped(CfnS3MultiRegion, ap.name, err)
+			continue
+		}
+
+		p := MultiRegionAccessPoint{
+			Name:              ap.name,
+			Regions:           ap.regions,
+			PublicAccessBlock: ap.publicAccessBlock,
+		}
+		if ap.policyJson != "" {
+			p.Policy, err = NewPolicyDocumentFromJson(ap.policyJson)
+			if err != nil {
+				return errors.Wrap(err, "Error creating Policy document")
+			}
+		}
+
+		a.data.addMultiRegionAccessPoint(&p)
+	}
+
+	return nil
+}
+
+func (a *AwsFetcher) fetchCodeArtifactData() error {
+	for _, region := range a.Regions {
+		domains, err := a.codeartifact.listOwnedDomains(region, a.account.Id)
+		if isAccessDeniedError(err) {
+			a.warn(WarningAccessDenied, "codeartifact", fmt.Sprintf("Skipping CodeArtifact in %s: %s", region, err))
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error listing CodeArtifact domains in %s", region)
+		}
+		for _, domain := range domains {
+			if ok, err := a.isSkippableManagedResource(CfnCodeArtifactDomain, domain, map[string]string{}, nonIamResourcePath); ok {
+				a.warnSkipped(CfnCodeArtifactDomain, domain, err)
+				continue
+			}
+
+			policyJson, err := a.codeartifact.getDomainPolicyDoc(region, domain)
+			if err != nil {
+				return err
+			}
+			if policyJson == "" {
+				continue
+			}
+			doc, err := NewPolicyDocumentFromJson(policyJson)
+			if err != nil {
+				return errors.Wrap(err, "Error creating Policy document")
+			}
+
+			a.data.addCodeArtifactDomainPolicy(&CodeArtifactDomainPolicy{
+				Region:     region,
+				DomainName: domain,
+				Policy:     doc,
+			})
+		}
+
+		repos, err := a.codeartifact.listOwnedRepositories(region, a.account.Id)
+		if err != nil {
+			return errors.Wrapf(err, "Error listing CodeArtifact repositories in %s", region)
+		}
+		for _, repo := range repos {
+			if ok, err := a.isSkippableManagedResource(CfnCodeArtifactRepository, repo.name, map[string]string{}, nonIamResourcePath); ok {
+				a.warnSkipped(CfnCodeArtifactRepository, repo.name, err)
+				continue
+			}
+
+			policyJson, err := a.codeartifact.getRepositoryPolicyDoc(region, repo.domain, repo.name)
+			if err != nil {
+				return err
+			}
+			if policyJson == "" {
+				continue
+			}
+			doc, err := NewPolicyDocumentFromJson(policyJson)
+			if err != nil {
+				return errors.Wrap(err, "Error creating Policy document")
+			}
+
+			a.data.addCodeArtifactRepositoryPolicy(&CodeArtifactRepositoryPolicy{
+				Region:         region,
+				DomainName:     repo.domain,
+				RepositoryName: repo.name,
+				Policy:         doc,
+			})
+		}
+	}
+
+	return nil
+}
+
+func (a *AwsFetcher) fetchSesData() error {
+	for _, region := range a.Regions {
+		identities, err := a.ses.listIdentities(region)
+		if isAccessDeniedError(err) {
+			a.warn(WarningAccessDenied, "ses", fmt.Sprintf("Skipping SES in %s: %s", region, err))
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error listing SES identities in %s", region)
+		}
+		for _, identity := range identities {
+			if ok, err := a.isSkippableManagedResource(CfnSesEmailIdentity, identity, map[string]string{}, nonIamResourcePath); ok {
+				a.warnSkipped(CfnSesEmailIdentity, identity, err)
+				continue
+			}
+
+			names, docs, err := a.ses.getIdentityPolicyDocs(region, identity)
+			if err != nil {
+				return err
+			}
+			if len(names) == 0 {
+				continue
+			}
+
+			p := SesIdentityPolicies{Region: region, Identity: identity}
+			for i, name := range names {
+				doc, err := NewPolicyDocumentFromJson(docs[i])
+				if err != nil {
+					return errors.Wrap(err, "Error creating Policy document")
+				}
+				p.Policies = append(p.Policies, InlinePolicy{Name: name, Policy: doc})
+			}
+
+			a.data.addSesIdentityPolicies(&p)
+		}
+	}
+
+	return nil
+}
+
+func (a *AwsFetcher) fetchApiGatewayData() error {
+	for _, region := range a.Regions {
+		apis, err := a.apigateway.listRestApis(region)
+		if isAccessDeniedError(err) {
+			a.warn(WarningAccessDenied, "apigateway", fmt.Sprintf("Skipping API Gateway in %s: %s", region, err))
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error listing REST APIs in %s", region)
+		}
+
+		for _, api := range apis {
+			if api.policyJson == "" {
+				continue
+			}
+			if ok, err := a.isSkippableManagedResource(CfnApiGatewayRestApi, api.id, api.tags, nonIamResourcePath); ok {
+				a.warnSkipped(CfnApiGatewayRestApi, api.id, err)
+				continue
+			}
+
+			doc, err := NewPolicyDocumentFromJson(api.policyJson)
+			if err != nil {
+				return errors.Wrap(err, "Error creating Policy document")
+			}
+			stages, err := a.apigateway.listStages(region, api.id)
+			if isAccessDeniedError(err) {
+				a.warn(WarningAccessDenied, restApiArn(region, api.id), fmt.Sprintf("Can't list the stages to redeploy when the policy changes: %s", err))
+			} else if err != nil {
+				return errors.Wrapf(err, "Error listing the stages of REST API %s in %s", api.id, region)
+			}
+
+			a.data.addRestApiPolicy(&RestApiPolicy{
+				Region:    region,
+				RestApiId: api.id,
+				Name:      api.name,
+				Policy:    doc,
+				stages:    stages,
+			})
+		}
+	}
+
+	return nil
+}
+
+func (a *AwsFetcher) fetchGlacierData() error {
+	for _, region := range a.Regions {
+		vaults, err := a.glacier.listVaults(region)
+		if isAccessDeniedError(err) {
+			a.warn(WarningAccessDenied, "glacier", fmt.Sprintf("Skipping Glacier in %s: %s", region, err))
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error listing Glacier vaults in %s", region)
+		}
+
+		for _, v := range vaults {
+			if v.policyJson == "" && v.lockPolicyJson == "" {
+				continue
+			}
+			if ok, err := a.isSkippableManagedResource(glacierVaultType, v.name, v.tags, nonIamResourcePath); ok {
+				a.warnSkipped(glacierVaultType, v.name, err)
+				continue
+			}
+
+			p := GlacierVaultPolicy{Region: region, VaultName: v.name, LockState: v.lockState}
+			if v.policyJson != "" {
+				if p.Policy, err = NewPolicyDocumentFromJson(v.policyJson); err != nil {
+					return errors.Wrap(err, "Error creating Policy document")
+				}
+			}
+			if v.lockPolicyJson != "" {
+				if p.LockPolicy, err = NewPolicyDocumentFromJson(v.lockPolicyJson); err != nil {
+					return errors.Wrap(err, "Error creating Policy document")
+				}
+			}
+			a.data.addGlacierVaultPolicy(&p)
+		}
+	}
+
+	return nil
+}
+
+func (a *AwsFetcher) fetchEcrData() error {
+	for _, region := range a.Regions {
+		policyJson, err := a.ecr.getRegistryPolicy(region)
+		if isAccessDeniedError(err) {
+			a.warn(WarningAccessDenied, "ecr", fmt.Sprintf("Skipping ECR registry policy in %s: %s", region, err))
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error fetching ECR registry policy in %s", region)
+		}
+		if policyJson == "" {
+			continue
+		}
+
+		doc, err := NewPolicyDocumentFromJson(policyJson)
+		if err != nil {
+			return errors.Wrap(err, "Error creating Policy document")
+		}
+		a.data.addEcrRegistryPolicy(&EcrRegistryPolicy{Region: region, Policy: doc})
 	}
 
 	return nil
@@ -129,6 +784,7 @@ func (a *AwsFetcher) fetchS3Data() error {
 func (a *AwsFetcher) fetchIamData() error {
 	var populateIamDataErr error
 	var populateInstanceProfileErr error
+	pageStart := time.Now()
 	err := a.iam.GetAccountAuthorizationDetailsPages(
 		&iam.GetAccountAuthorizationDetailsInput{
 			Filter: aws.StringSlice([]string{
@@ -139,7 +795,11 @@ func (a *AwsFetcher) fetchIamData() error {
 			}),
 		},
 		func(resp *iam.GetAccountAuthorizationDetailsOutput, lastPage bool) bool {
+			a.Timings.Record("iam auth details page", time.Since(pageStart))
+			stop := a.Timings.Track("iam auth details populate")
 			populateIamDataErr = a.populateIamData(resp)
+			stop()
+			pageStart = time.Now()
 			if populateIamDataErr != nil {
 				return false
 			}
@@ -153,6 +813,7 @@ func (a *AwsFetcher) fetchIamData() error {
 		return err
 	}
 	// Fetch instance profiles
+	defer a.Timings.Track("iam instance profiles")()
 	err = a.iam.ListInstanceProfilesPages(&iam.ListInstanceProfilesInput{},
 		func(resp *iam.ListInstanceProfilesOutput, lastPage bool) bool {
 			populateInstanceProfileErr = a.populateInstanceProfileData(resp)
@@ -167,7 +828,7 @@ func (a *AwsFetcher) fetchIamData() error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return a.fetchAwsManagedPolicyVersions()
 }
 
 func (a *AwsFetcher) populateInlinePolicies(source []*iam.PolicyDetail, target *[]InlinePolicy) error {
@@ -190,6 +851,7 @@ func (a *AwsFetcher) marshalPolicyDescriptionAsync(policyArn string, target *str
 	go func() {
 		defer a.descriptionFetchWaitGroup.Done()
 		log.Println("Fetching policy description for", policyArn)
+		defer a.Timings.Track("iam policy description")()
 
 		var err error
 		*target, err = a.iam.getPolicyDescription(policyArn)
@@ -214,6 +876,7 @@ func (a *AwsFetcher) marshalRoleAsync(roleName string, roleDescription *string,
 	go func() {
 		defer a.descriptionFetchWaitGroup.Done()
 		log.Println("Fetching role description for", roleName)
+		defer a.Timings.Track("iam role description")()
 
 		var err error
 		var sessionDuration int
@@ -230,7 +893,7 @@ func (a *AwsFetcher) marshalRoleAsync(roleName string, roleDescription *string,
 func (a *AwsFetcher) populateInstanceProfileData(resp *iam.ListInstanceProfilesOutput) error {
 	for _, profileResp := range resp.InstanceProfiles {
 		if ok, err := a.isSkippableManagedResource(CfnInstanceProfile, *profileResp.InstanceProfileName, map[string]string{}, *profileResp.Path); ok {
-			log.Printf(err)
+			a.warnSkipped(CfnInstanceProfile, *profileResp.InstanceProfileName, err)
 			continue
 		}
 
@@ -255,7 +918,7 @@ func (a *AwsFetcher) populateIamData(resp *iam.GetAccountAuthorizationDetailsOut
 		}
 
 		if ok, err := a.isSkippableManagedResource(CfnIamUser, *userResp.UserName, tags, *userResp.Path); ok {
-			log.Printf(err)
+			a.warnSkipped(CfnIamUser, *userResp.UserName, err)
 			continue
 		}
 
@@ -264,6 +927,7 @@ func (a *AwsFetcher) populateIamData(resp *iam.GetAccountAuthorizationDetailsOut
 				Name: *userResp.UserName,
 				Path: *userResp.Path,
 			},
+			CreateDate: userResp.CreateDate,
 		}
 
 		for _, g := range userResp.GroupList {
@@ -275,6 +939,9 @@ func (a *AwsFetcher) populateIamData(resp *iam.GetAccountAuthorizationDetailsOut
 		if err := a.populateInlinePolicies(userResp.UserPolicyList, &user.InlinePolicies); err != nil {
 			return err
 		}
+		if userResp.PermissionsBoundary != nil {
+			user.PermissionsBoundary = a.account.normalisePolicyArn(aws.StringValue(userResp.PermissionsBoundary.PermissionsBoundaryArn))
+		}
 		user.Tags = tags
 
 		a.data.Users = append(a.data.Users, &user)
@@ -282,7 +949,7 @@ func (a *AwsFetcher) populateIamData(resp *iam.GetAccountAuthorizationDetailsOut
 
 	for _, groupResp := range resp.GroupDetailList {
 		if ok, err := a.isSkippableManagedResource(CfnIamGroup, *groupResp.GroupName, map[string]string{}, *groupResp.Path); ok {
-			log.Printf(err)
+			a.warnSkipped(CfnIamGroup, *groupResp.GroupName, err)
 			continue
 		}
 
@@ -308,14 +975,17 @@ func (a *AwsFetcher) populateIamData(resp *iam.GetAccountAuthorizationDetailsOut
 		}
 
 		if ok, err := a.isSkippableManagedResource(CfnIamRole, *roleResp.RoleName, tags, *roleResp.Path); ok {
-			log.Printf(err)
+			a.warnSkipped(CfnIamRole, *roleResp.RoleName, err)
 			continue
 		}
 
-		role := Role{iamService: iamService{
-			Name: *roleResp.RoleName,
-			Path: *roleResp.Path,
-		}}
+		role := Role{
+			iamService: iamService{
+				Name: *roleResp.RoleName,
+				Path: *roleResp.Path,
+			},
+			CreateDate: roleResp.CreateDate,
+		}
 
 		if !a.SkipFetchingPolicyAndRoleDescriptions {
 			a.marshalRoleAsync(*roleResp.RoleName, &role.Description, &role.MaxSessionDuration)
@@ -332,6 +1002,9 @@ func (a *AwsFetcher) populateIamData(resp *iam.GetAccountAuthorizationDetailsOut
 		if err := a.populateInlinePolicies(roleResp.RolePolicyList, &role.InlinePolicies); err != nil {
 			return err
 		}
+		if roleResp.PermissionsBoundary != nil {
+			role.PermissionsBoundary = a.account.normalisePolicyArn(aws.StringValue(roleResp.PermissionsBoundary.PermissionsBoundaryArn))
+		}
 
 		a.data.addRole(&role)
 	}
@@ -341,15 +1014,21 @@ func (a *AwsFetcher) populateIamData(resp *iam.GetAccountAuthorizationDetailsOut
 		policyArns = append(policyArns, policyResp.Arn)
 	}
 
-	policyTags, err := a.tagging.getMultiplePolicyTags(policyArns)
-	if err != nil {
-		log.Printf("Error: %v", err)
-		return err
+	policyTags := a.configPolicyTags
+	if policyTags == nil {
+		var err error
+		stop := a.Timings.Track("iam policy tags")
+		policyTags, err = a.tagging.getMultiplePolicyTags(policyArns)
+		stop()
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return err
+		}
 	}
 
 	for _, policyResp := range resp.Policies {
 		if ok, err := a.isSkippableManagedResource(CfnIamPolicy, *policyResp.PolicyName, map[string]string{}, *policyResp.Path); ok {
-			log.Printf(err)
+			a.warnSkipped(CfnIamPolicy, *policyResp.PolicyName, err)
 			continue
 		}
 
@@ -367,7 +1046,10 @@ func (a *AwsFetcher) populateIamData(resp *iam.GetAccountAuthorizationDetailsOut
 			oldestVersionId:      findOldestPolicyVersionId(policyResp.PolicyVersionList),
 			numberOfVersions:     len(policyResp.PolicyVersionList),
 			nondefaultVersionIds: findNonDefaultPolicyVersionIds(policyResp.PolicyVersionList),
+			versions:             newPolicyVersions(*policyResp.Arn, policyResp.PolicyVersionList),
+			DefaultVersionId:     aws.StringValue(defaultPolicyVersion.VersionId),
 			Policy:               doc,
+			CreateDate:           policyResp.CreateDate,
 		}
 
 		if !a.SkipFetchingPolicyAndRoleDescriptions {
@@ -380,14 +1062,16 @@ func (a *AwsFetcher) populateIamData(resp *iam.GetAccountAuthorizationDetailsOut
 		}
 		// Need to do this _after_ we fetch tags for the Policy
 		if ok, err := a.isSkippableManagedResource(CfnIamPolicy, *policyResp.PolicyName, p.Tags, *policyResp.Path); ok {
-			log.Printf(err)
+			a.warnSkipped(CfnIamPolicy, *policyResp.PolicyName, err)
 			continue
 		}
 
 		a.data.addPolicy(&p)
 	}
 
+	stop := a.Timings.Track("iam description backfill wait")
 	a.descriptionFetchWaitGroup.Wait()
+	stop()
 
 	return a.descriptionFetchError
 }
@@ -401,11 +1085,13 @@ func findDefaultPolicyVersion(versions []*iam.PolicyVersion) *iam.PolicyVersion
 	panic("Expected a default policy version")
 }
 
+// findNonDefaultPolicyVersionIds returns the ids of the nondefault versions,
+// oldest first
 func findNonDefaultPolicyVersionIds(versions []*iam.PolicyVersion) []string {
 	ss := []string{}
-	for _, version := range versions {
-		if !*version.IsDefaultVersion {
-			ss = append(ss, *version.VersionId)
+	for _, version := range newPolicyVersions("", versions) {
+		if !version.IsDefault {
+			ss = append(ss, version.VersionId)
 		}
 	}
 	return ss
@@ -425,7 +1111,7 @@ func (a *AwsFetcher) getAccount() (*Account, error) {
 	var err error
 	acct := Account{}
 
-	acct.Id, err = GetAwsAccountId(awsSession(), a.Debug)
+	acct.Id, err = GetAwsAccountId(a.sess, a.Debug)
 	if err == aws.ErrMissingRegion {
 		return nil, errors.New("Error determining the AWS account id - check the AWS_REGION environment variable is set")
 	}
@@ -444,6 +1130,79 @@ func (a *AwsFetcher) getAccount() (*Account, error) {
 	return &acct, nil
 }
 
+// warn records a warning in the fetched data, it's safe to call concurrently
+func (a *AwsFetcher) warn(category WarningCategory, resource, message string) {
+	log.Println(message)
+
+	a.warningsMutex.Lock()
+	defer a.warningsMutex.Unlock()
+	a.data.Warnings.Add(category, resource, message)
+}
+
+func (a *AwsFetcher) warnSkipped(cfnType CfnResourceType, resourceIdentifier string, reason string) {
+	if strings.HasPrefix(reason, controlTowerSkipReason) {
+		a.warn(WarningControlTower, fmt.Sprintf("%s %s", cfnType, resourceIdentifier), reason)
+		return
+	}
+	a.warn(WarningSkipped, fmt.Sprintf("%s %s", cfnType, resourceIdentifier), reason)
+}
+
+// isSkippableBucketName checks the bucket name filters, which are checked
+// before fetching bucket details to save fetching them for skipped buckets
+func (a *AwsFetcher) isSkippableBucketName(name string) (bool, string) {
+	if len(a.IncludeBucketPatterns) > 0 {
+		included := false
+		for _, pattern := range a.IncludeBucketPatterns {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return true, fmt.Sprintf("Skipping bucket %s not matching %s", name, strings.Join(a.IncludeBucketPatterns, ", "))
+		}
+	}
+
+	for _, prefix := range a.SkipBucketPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true, fmt.Sprintf("Skipping bucket %s with name matching %s", name, prefix)
+		}
+	}
+
+	return false, ""
+}
+
+// nonIamResourcePath is passed as the path of resources that don't have
+// IAM paths, so they are never skipped by SkipPathPrefixes
+const nonIamResourcePath = "__DONTSKIPS3__"
+
+// isAccessDeniedError is true if err is an AWS error caused by the caller
+// not having permission to perform the request
+func isAccessDeniedError(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation":
+			return true
+		}
+	}
+	return false
+}
+
+// isAuthError returns whether err, or the error it wraps, is caused by the
+// credentials being invalid, expired or lacking permissions
+func isAuthError(err error) bool {
+	if awsErr, ok := errors.Cause(err).(awserr.Error); ok {
+		switch awsErr.Code() {
+		case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation",
+			"ExpiredToken", "ExpiredTokenException", "RequestExpired",
+			"InvalidClientTokenId", "UnrecognizedClientException",
+			"InvalidAccessKeyId", "SignatureDoesNotMatch", "NoCredentialProviders":
+			return true
+		}
+	}
+	return false
+}
+
 // isSkippableResource takes the resource identifier as a string and
 // checks it against known resources that we shouldn't need to manage as
 // it will already be managed by another process (such as Cloudformation
@@ -453,12 +1212,12 @@ func (a *AwsFetcher) getAccount() (*Account, error) {
 // reasoning why it was skipped.
 
 func (a *AwsFetcher) isSkippableManagedResource(cfnType CfnResourceType, resourceIdentifier string, tags map[string]string, resourcePath string) (bool, string) {
-	if len(a.IncludeTagged) > 0 {
-		for _, tag := range a.IncludeTagged {
-			if _, ok := tags[tag]; ok {
-				return false, ""
-			}
-		}
+	if a.isIncludedTagged(tags) {
+		return false, ""
+	}
+
+	if ok, reason := a.isIgnoredResource(cfnType, resourceIdentifier, tags, resourcePath); ok {
+		return true, reason
 	}
 
 	for _, tag := range a.SkipTagged {
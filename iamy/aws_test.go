@@ -1,12 +1,15 @@
 package iamy
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
 )
 
-const cloudformationStackNameTag = "aws:cloudformation:stack-name"
 const includeTestTag = "iamy-include"
 const testSkipPathPrefix = "/aws-reserved/"
 
@@ -127,6 +130,25 @@ func TestIncludeTagsOverrideSkip(t *testing.T) {
 	}
 }
 
+func TestSkippableBucketNames(t *testing.T) {
+	f := AwsFetcher{SkipBucketPrefixes: []string{"cdk-"}, IncludeBucketPatterns: []string{"cdk-*", "app-*-assets"}}
+
+	for name, expected := range map[string]bool{
+		"cdk-hnb659fds-assets-123-us-east-1": true,
+		"app-web-assets":                     false,
+		"app-web-logs":                       true,
+		"terraform-state":                    true,
+	} {
+		skipped, reason := f.isSkippableBucketName(name)
+		if skipped != expected {
+			t.Errorf("expected %s skipped to be %t but got %t", name, expected, skipped)
+		}
+		if skipped && reason == "" {
+			t.Errorf("expected a reason for skipping %s", name)
+		}
+	}
+}
+
 func TestSkippableIAMUserResource(t *testing.T) {
 	f := AwsFetcher{cfn: &cfnClient{}, SkipTagged: []string{cloudformationStackNameTag}, IncludeTagged: []string{includeTestTag}, SkipPathPrefixes: []string{}}
 	key := cloudformationStackNameTag
@@ -212,3 +234,89 @@ func TestSkippableIAMRoleResource_WithNoSkipTags(t *testing.T) {
 		t.Error("Expected to not skip role with CFN tags and SkipTagged: []string{}")
 	}
 }
+
+func TestSkippedResourcesAreWarnings(t *testing.T) {
+	f := AwsFetcher{cfn: &cfnClient{}, SkipTagged: []string{cloudformationStackNameTag}}
+	key := cloudformationStackNameTag
+	val := "my-stack"
+	userName := "my-user"
+	path := "/"
+	userList := []*iam.UserDetail{
+		{Tags: []*iam.Tag{{Key: &key, Value: &val}}, UserName: &userName, Path: &path},
+	}
+
+	f.populateIamData(&iam.GetAccountAuthorizationDetailsOutput{UserDetailList: userList})
+
+	if f.data.Warnings.Count(WarningSkipped) != 1 {
+		t.Fatalf("Expected 1 skipped warning, got %v", f.data.Warnings)
+	}
+	if f.data.Warnings[0].Resource != "AWS::IAM::User my-user" {
+		t.Errorf("Expected warning for my-user, got %s", f.data.Warnings[0])
+	}
+}
+
+func TestAuthFailuresAreRetriedWithFallbackCredentials(t *testing.T) {
+	f := AwsFetcher{FallbackRoleArn: "arn:aws:iam::123456789012:role/fallback", cfn: &cfnClient{}}
+
+	expiringCalls, okCalls, resets := 0, 0, 0
+	phases := []fetchPhase{
+		{"expiring", "Expiring", func() error {
+			expiringCalls++
+			if expiringCalls == 1 {
+				return errors.Wrap(awserr.New("ExpiredToken", "The security token included in the request is expired", nil), "Error listing")
+			}
+			return nil
+		}, func() { resets++ }},
+		{"ok", "OK", func() error {
+			okCalls++
+			return nil
+		}, func() {}},
+	}
+
+	if err := f.runPhasesWithFallback(phases); err != nil {
+		t.Fatalf("Expected the retry to succeed, got %s", err)
+	}
+	if expiringCalls != 2 || resets != 1 || okCalls != 1 {
+		t.Errorf("Expected only the failed phase to be reset and rerun, got %d calls, %d resets and %d calls", expiringCalls, resets, okCalls)
+	}
+	if !f.usingFallback {
+		t.Error("Expected the fetcher to be using the fallback credentials")
+	}
+	if f.data.Warnings.Count(WarningFallback) != 1 || f.data.Warnings[0].Resource != "expiring" {
+		t.Errorf("Expected a fallback warning for the retried phase, got %v", f.data.Warnings)
+	}
+}
+
+func TestFallbackCredentialsMustBeForTheFetchedAccount(t *testing.T) {
+	f := AwsFetcher{
+		FallbackProfile: "rotation",
+		account:         &Account{Id: "123456789012"},
+		cfn:             &cfnClient{},
+		callerAccountId: func(*session.Session) (string, error) { return "210987654321", nil },
+	}
+	expired := awserr.New("ExpiredToken", "The security token included in the request is expired", nil)
+	calls := 0
+	phases := []fetchPhase{{"expiring", "Expiring", func() error {
+		calls++
+		return expired
+	}, func() {}}}
+
+	err := f.runPhasesWithFallback(phases)
+	if err == nil || !strings.Contains(err.Error(), "are for account 210987654321, not account 123456789012") {
+		t.Errorf("Expected the fallback credentials of another account to be refused, got %v", err)
+	}
+	if calls != 1 || f.usingFallback {
+		t.Errorf("Expected the phase not to be retried with the fallback credentials, got %d calls", calls)
+	}
+
+	f.callerAccountId = func(*session.Session) (string, error) { return "123456789012", nil }
+	if err := f.runPhasesWithFallback(phases); err == nil {
+		t.Error("Expected the retried phase to fail again")
+	}
+	if calls != 3 || !f.usingFallback {
+		t.Errorf("Expected the phase to be retried with the fallback credentials, got %d calls", calls)
+	}
+	if n := f.data.Warnings.Count(WarningFallback); n != 0 {
+		t.Errorf("Expected no warning that the data was fetched when the retry failed, got %v", f.data.Warnings)
+	}
+}
@@ -1,10 +1,12 @@
 package iamy
 
 import (
+	"encoding/json"
 	"fmt"
-	"reflect"
 	"strconv"
 	"strings"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 )
 
 // MaxAllowedPolicyVersions are the number of Versions of a managed policy that can be stored
@@ -90,11 +92,25 @@ func mapTagsToString(tags map[string]string) string {
 type awsSyncCmdGenerator struct {
 	from, to *AccountData
 	cmds     CmdList
+	warnings Warnings
+
+	// fromIndex is built when it's first needed
+	fromIndex *PolicyIndex
+
+	renames []resourceRename
+
+	// versionRetention is how many versions of a policy to keep once a new
+	// one is created, and keepVersions stops versions being deleted
+	versionRetention int
+	keepVersions     bool
+	errors           []error
+
+	// iam lists the credentials of the users being deleted, created with the
+	// default credentials when it's first needed without one
+	iam *iamClient
 }
 
 func (a *awsSyncCmdGenerator) deleteOldEntities() {
-	iam := newIamClient(awsSession())
-
 	for _, fromInstanceProfile := range a.from.InstanceProfiles {
 		if found, _ := a.to.FindInstanceProfileByName(fromInstanceProfile.Name, fromInstanceProfile.Path); !found {
 			for _, roleName := range fromInstanceProfile.Roles {
@@ -125,8 +141,23 @@ func (a *awsSyncCmdGenerator) deleteOldEntities() {
 	}
 	for _, fromUser := range a.from.Users {
 		if found, _ := a.to.FindUserByName(fromUser.Name, fromUser.Path); !found {
-			// remove access keys
-			accessKeys, mfaDevices, hasLoginProfile := iam.MustGetSecurityCredsForUser(fromUser.Name)
+			// remove access keys, listed with the credentials of the
+			// account being planned for
+			if a.iam == nil {
+				a.iam = newIamClient(awsSession())
+			}
+			accessKeys, mfaDevices, hasLoginProfile, err := a.iam.getSecurityCredsForUser(fromUser.Name)
+			if err != nil {
+				a.errors = append(a.errors, fmt.Errorf("Error listing the credentials of user %s to delete: %s", fromUser.Name, err))
+				continue
+			}
+			if len(accessKeys) > 0 || hasLoginProfile {
+				msg := fmt.Sprintf("Deleting user also deletes its %d access keys", len(accessKeys))
+				if hasLoginProfile {
+					msg += " and console password"
+				}
+				a.warnings.Add(WarningPlan, Arn(fromUser, a.to.Account), msg)
+			}
 			for _, keyId := range accessKeys {
 				a.cmds.Add("aws", "iam", "delete-access-key",
 					"--user-name", fromUser.Name,
@@ -206,19 +237,49 @@ func (a *awsSyncCmdGenerator) deleteOldEntities() {
 	}
 }
 
+// retainPolicyVersions deletes the oldest nondefault versions of the policy
+// beyond those retained once a new version is created, returning whether the
+// new version can be created. When versions are kept and the policy has the
+// most versions it can, its update is a plan error
+func (a *awsSyncCmdGenerator) retainPolicyVersions(fromPolicy, toPolicy *Policy) bool {
+	arn := Arn(toPolicy, a.to.Account)
+	retention := MaxAllowedPolicyVersions
+	if a.versionRetention > 0 && a.versionRetention < MaxAllowedPolicyVersions {
+		retention = a.versionRetention
+	}
+
+	excess := excessVersions(fromPolicy.numberOfVersions+1, retention)
+	if excess == 0 {
+		return true
+	}
+	if a.keepVersions {
+		if fromPolicy.numberOfVersions < MaxAllowedPolicyVersions {
+			return true
+		}
+		a.errors = append(a.errors, fmt.Errorf("%s has %d versions and policy versions aren't deleted, so it can't be updated. Delete a version with iamy versions --prune first", arn, fromPolicy.numberOfVersions))
+		return false
+	}
+
+	ids := fromPolicy.nondefaultVersionIds
+	if excess < len(ids) {
+		ids = ids[:excess]
+	}
+	for _, id := range ids {
+		a.warnings.Add(WarningPlan, arn,
+			fmt.Sprintf("Policy has %d versions, the version %s will be deleted to keep %d", fromPolicy.numberOfVersions, id, retention))
+		a.cmds.Add("aws", "iam", "delete-policy-version",
+			"--policy-arn", arn,
+			"--version-id", id)
+	}
+	return true
+}
+
 func (a *awsSyncCmdGenerator) updatePolicies() {
 	// update policies
 	for _, toPolicy := range a.to.Policies {
 		if found, fromPolicy := a.from.FindPolicyByName(toPolicy.Name, toPolicy.Path); found {
 			// Update policy
-			if fromPolicy.Policy.JsonString() != toPolicy.Policy.JsonString() {
-
-				if fromPolicy.numberOfVersions >= MaxAllowedPolicyVersions {
-					a.cmds.Add("aws", "iam", "delete-policy-version",
-						"--policy-arn", Arn(toPolicy, a.to.Account),
-						"--version-id", fromPolicy.oldestVersionId)
-				}
-
+			if fromPolicy.Policy.JsonString() != toPolicy.Policy.JsonString() && a.retainPolicyVersions(fromPolicy, toPolicy) {
 				a.cmds.Add("aws", "iam", "create-policy-version",
 					"--policy-arn", Arn(toPolicy, a.to.Account),
 					"--set-as-default",
@@ -226,6 +287,11 @@ func (a *awsSyncCmdGenerator) updatePolicies() {
 				)
 			}
 		} else {
+			fromPolicy := a.renamedPolicy(toPolicy)
+			if fromPolicy == nil {
+				a.warnPolicyRename(toPolicy)
+			}
+
 			// Create policy
 			args := []string{
 				"iam", "create-policy",
@@ -238,6 +304,29 @@ func (a *awsSyncCmdGenerator) updatePolicies() {
 			// document last, for easier reading by end-user
 			args = append(args, "--policy-document", toPolicy.Policy.JsonString())
 			a.cmds.Add("aws", args...)
+
+			if fromPolicy != nil {
+				a.migratePolicyAttachments(fromPolicy, toPolicy)
+			}
+		}
+	}
+}
+
+// warnPolicyRename warns when a new policy has the same document as a policy
+// being deleted, as managed policies can't be renamed and the new policy will
+// have a different ARN
+func (a *awsSyncCmdGenerator) warnPolicyRename(toPolicy *Policy) {
+	if a.fromIndex == nil {
+		a.fromIndex = NewPolicyIndex(a.from)
+	}
+	for _, l := range a.fromIndex.Lookup(toPolicy.Policy.Hash()) {
+		fromPolicy, ok := l.resource.(*Policy)
+		if !ok {
+			continue
+		}
+		if found, _ := a.to.FindPolicyByName(fromPolicy.Name, fromPolicy.Path); !found {
+			a.warnings.Add(WarningPlan, Arn(toPolicy, a.to.Account),
+				fmt.Sprintf("Policy has the same document as %s, which will be deleted. Policies can't be renamed, so anything referring to the old ARN must be updated", Arn(fromPolicy, a.to.Account)))
 		}
 	}
 }
@@ -248,7 +337,7 @@ func (a *awsSyncCmdGenerator) updateRoles() {
 	for _, toRole := range a.to.Roles {
 		if found, fromRole := a.from.FindRoleByName(toRole.Name, toRole.Path); found {
 			// Update role
-			if !reflect.DeepEqual(fromRole.AssumeRolePolicyDocument, toRole.AssumeRolePolicyDocument) {
+			if !fromRole.AssumeRolePolicyDocument.equal(toRole.AssumeRolePolicyDocument) {
 				a.cmds.Add("aws", "iam", "update-assume-role-policy",
 					"--role-name", toRole.Name,
 					"--policy-document", toRole.AssumeRolePolicyDocument.JsonString())
@@ -283,6 +372,15 @@ func (a *awsSyncCmdGenerator) updateRoles() {
 					"--policy-arn", a.to.Account.policyArnFromString(p))
 			}
 
+			// update permissions boundary. A file without one leaves the
+			// boundary unmanaged, as files pulled before boundaries were
+			// managed don't have them, and removing one escalates privileges
+			if toRole.PermissionsBoundary != "" && fromRole.PermissionsBoundary != toRole.PermissionsBoundary {
+				a.cmds.Add("aws", "iam", "put-role-permissions-boundary",
+					"--role-name", toRole.Name,
+					"--permissions-boundary", a.to.Account.policyArnFromString(toRole.PermissionsBoundary))
+			}
+
 			// update max session duration
 			if fromRole.MaxSessionDuration != toRole.MaxSessionDuration {
 				a.cmds.Add("aws", "iam", "update-role",
@@ -304,6 +402,9 @@ func (a *awsSyncCmdGenerator) updateRoles() {
 			if toRole.MaxSessionDuration != 0 {
 				args = append(args, "--max-session-duration", strconv.Itoa(toRole.MaxSessionDuration))
 			}
+			if toRole.PermissionsBoundary != "" {
+				args = append(args, "--permissions-boundary", a.to.Account.policyArnFromString(toRole.PermissionsBoundary))
+			}
 			a.cmds.Add("aws", args...)
 
 			// add new inline policies
@@ -429,6 +530,15 @@ func (a *awsSyncCmdGenerator) updateUsers() {
 					"--policy-arn", a.to.Account.policyArnFromString(p))
 			}
 
+			// update permissions boundary. A file without one leaves the
+			// boundary unmanaged, as files pulled before boundaries were
+			// managed don't have them, and removing one escalates privileges
+			if toUser.PermissionsBoundary != "" && fromUser.PermissionsBoundary != toUser.PermissionsBoundary {
+				a.cmds.Add("aws", "iam", "put-user-permissions-boundary",
+					"--user-name", toUser.Name,
+					"--permissions-boundary", a.to.Account.policyArnFromString(toUser.PermissionsBoundary))
+			}
+
 			// remove old tags
 			for tagKey, _ := range mapStringSetDifference(fromUser.Tags, toUser.Tags) {
 				a.cmds.Add("aws", "iam", "untag-user",
@@ -445,16 +555,18 @@ func (a *awsSyncCmdGenerator) updateUsers() {
 
 		} else {
 			// Create user
-			if len(toUser.Tags) == 0 {
-				a.cmds.Add("aws", "iam", "create-user",
-					"--user-name", toUser.Name,
-					"--path", path(toUser.Path))
-			} else {
-				a.cmds.Add("aws", "iam", "create-user",
-					"--user-name", toUser.Name,
-					"--path", path(toUser.Path),
-					"--tags", mapTagsToString(toUser.Tags))
+			args := []string{
+				"iam", "create-user",
+				"--user-name", toUser.Name,
+				"--path", path(toUser.Path),
+			}
+			if len(toUser.Tags) != 0 {
+				args = append(args, "--tags", mapTagsToString(toUser.Tags))
 			}
+			if toUser.PermissionsBoundary != "" {
+				args = append(args, "--permissions-boundary", a.to.Account.policyArnFromString(toUser.PermissionsBoundary))
+			}
+			a.cmds.Add("aws", args...)
 
 			// add new groups
 			for _, g := range toUser.Groups {
@@ -514,28 +626,584 @@ func (a *awsSyncCmdGenerator) updateInstanceProfiles() {
 func (a *awsSyncCmdGenerator) updateBucketPolicies() {
 	for _, fromBucketPolicy := range a.from.BucketPolicies {
 		if found, _ := a.to.FindBucketPolicyByBucketName(fromBucketPolicy.BucketName); !found {
-			// remove bucket policy
-			a.cmds.Add("aws", "s3api", "delete-bucket-policy",
-				"--bucket", fromBucketPolicy.BucketName)
+			a.updateBucketPolicy(fromBucketPolicy, &BucketPolicy{BucketName: fromBucketPolicy.BucketName})
 		}
 	}
 
 	for _, toBucketPolicy := range a.to.BucketPolicies {
-		isToAccountUpToDate := false
-		if found, fromBucketPolicy := a.from.FindBucketPolicyByBucketName(toBucketPolicy.BucketName); found {
-			if fromBucketPolicy.Policy.JsonString() == toBucketPolicy.Policy.JsonString() {
-				isToAccountUpToDate = true
+		_, fromBucketPolicy := a.from.FindBucketPolicyByBucketName(toBucketPolicy.BucketName)
+		if fromBucketPolicy == nil {
+			fromBucketPolicy = &BucketPolicy{BucketName: toBucketPolicy.BucketName}
+		}
+		a.updateBucketPolicy(fromBucketPolicy, toBucketPolicy)
+	}
+}
+
+func (a *awsSyncCmdGenerator) updateBucketPolicy(from, to *BucketPolicy) {
+	if to.Policy == nil {
+		if from.Policy != nil {
+			a.cmds.Add("aws", "s3api", "delete-bucket-policy",
+				"--bucket", from.BucketName)
+		}
+	} else if from.Policy == nil || from.Policy.JsonString() != to.Policy.JsonString() {
+		a.cmds.Add("aws", "s3api", "put-bucket-policy",
+			"--bucket", to.BucketName,
+			"--policy", to.Policy.JsonString())
+	}
+
+	// a file without a PublicAccessBlock, Acl or Tags leaves them unmanaged,
+	// as files pulled before they were managed don't have them. They're only
+	// removed by an explicit empty value
+	switch {
+	case to.PublicAccessBlock == nil:
+	case to.PublicAccessBlock.empty():
+		if from.PublicAccessBlock != nil && !from.PublicAccessBlock.empty() {
+			a.cmds.Add("aws", "s3api", "delete-public-access-block",
+				"--bucket", from.BucketName)
+		}
+	case from.PublicAccessBlock == nil || *from.PublicAccessBlock != *to.PublicAccessBlock:
+		a.cmds.Add("aws", "s3api", "put-public-access-block",
+			"--bucket", to.BucketName,
+			"--public-access-block-configuration", to.PublicAccessBlock.cliArgument())
+	}
+
+	if to.Acl != nil && !from.Acl.equal(to.Acl) {
+		if to.Acl.Canned != "" {
+			a.cmds.Add("aws", "s3api", "put-bucket-acl",
+				"--bucket", to.BucketName,
+				"--acl", to.Acl.Canned)
+		} else {
+			a.cmds.Add("aws", "s3api", "put-bucket-acl",
+				"--bucket", to.BucketName,
+				"--access-control-policy", accessControlPolicy(a.from.canonicalUserId, to.Acl))
+		}
+	}
+
+	// bucket tags can only be replaced as a whole, which S3 refuses unless
+	// the aws: tags it adds, eg. for CloudFormation stacks, are kept
+	if to.Tags != nil && (len(mapStringSetDifference(from.Tags, to.Tags)) > 0 || len(mapStringSetDifference(to.Tags, from.Tags)) > 0) {
+		tags := map[string]string{}
+		for _, tt := range []map[string]string{from.systemTags, to.Tags} {
+			for k, v := range tt {
+				tags[k] = v
+			}
+		}
+		if len(tags) == 0 {
+			a.cmds.Add("aws", "s3api", "delete-bucket-tagging",
+				"--bucket", from.BucketName)
+		} else {
+			a.cmds.Add("aws", "s3api", "put-bucket-tagging",
+				"--bucket", to.BucketName,
+				"--tagging", bucketTagging(tags))
+		}
+	}
+}
+
+type bucketTag struct {
+	Key   string
+	Value string
+}
+
+// bucketTagging builds the --tagging for put-bucket-tagging, as JSON so tag
+// values can contain commas
+func bucketTagging(tags map[string]string) string {
+	tagSet := []bucketTag{}
+	for _, k := range sortedKeys(tags) {
+		tagSet = append(tagSet, bucketTag{k, tags[k]})
+	}
+
+	b, err := json.Marshal(map[string]interface{}{"TagSet": tagSet})
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+type accessControlPolicyGrantee struct {
+	Type         string
+	ID           string `json:",omitempty"`
+	URI          string `json:",omitempty"`
+	EmailAddress string `json:",omitempty"`
+}
+
+type accessControlPolicyGrant struct {
+	Grantee    accessControlPolicyGrantee
+	Permission string
+}
+
+// accessControlPolicy builds the --access-control-policy for put-bucket-acl,
+// keeping the owner's full control grant
+func accessControlPolicy(ownerId string, acl *BucketAcl) string {
+	grants := []accessControlPolicyGrant{{
+		Grantee:    accessControlPolicyGrantee{Type: "CanonicalUser", ID: ownerId},
+		Permission: "FULL_CONTROL",
+	}}
+	for _, g := range acl.grants() {
+		grantee := accessControlPolicyGrantee{}
+		parts := strings.SplitN(g.Grantee, "=", 2)
+		value := parts[len(parts)-1]
+		switch parts[0] {
+		case "uri":
+			grantee.Type, grantee.URI = "Group", value
+		case "emailAddress":
+			grantee.Type, grantee.EmailAddress = "AmazonCustomerByEmail", value
+		default:
+			grantee.Type, grantee.ID = "CanonicalUser", value
+		}
+		grants = append(grants, accessControlPolicyGrant{Grantee: grantee, Permission: g.Permission})
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"Grants": grants,
+		"Owner":  map[string]string{"ID": ownerId},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+func (a *awsSyncCmdGenerator) updateAccountPublicAccessBlock() {
+	// without the file the configuration is unmanaged, and it's only removed
+	// by a file with every setting false
+	from, to := a.from.AccountPublicAccessBlock, a.to.AccountPublicAccessBlock
+	switch {
+	case to == nil:
+	case to.empty():
+		if from != nil && !from.empty() {
+			a.cmds.Add("aws", "s3control", "delete-public-access-block",
+				"--account-id", a.from.Account.Id)
+		}
+	case from == nil || from.PublicAccessBlock != to.PublicAccessBlock:
+		a.cmds.Add("aws", "s3control", "put-public-access-block",
+			"--account-id", a.from.Account.Id,
+			"--public-access-block-configuration", to.PublicAccessBlock.cliArgument())
+	}
+}
+
+func (a *awsSyncCmdGenerator) deleteAccessPoint(ap *AccessPoint) {
+	a.cmds.Add("aws", "s3control", "delete-access-point",
+		"--region", ap.Region,
+		"--account-id", a.from.Account.Id,
+		"--name", ap.Name)
+}
+
+func (a *awsSyncCmdGenerator) createAccessPoint(ap *AccessPoint) {
+	args := []string{"s3control", "create-access-point",
+		"--region", ap.Region,
+		"--account-id", a.from.Account.Id,
+		"--name", ap.Name,
+		"--bucket", ap.Bucket}
+	if ap.VpcId != "" {
+		args = append(args, "--vpc-configuration", "VpcId="+ap.VpcId)
+	}
+	a.cmds.Add("aws", args...)
+}
+
+func (a *awsSyncCmdGenerator) updateAccessPoints() {
+	for _, fromAccessPoint := range a.from.AccessPoints {
+		if found, _ := a.to.FindAccessPointByName(fromAccessPoint.Region, fromAccessPoint.Name); !found {
+			a.deleteAccessPoint(fromAccessPoint)
+		}
+	}
+
+	for _, toAccessPoint := range a.to.AccessPoints {
+		found, fromAccessPoint := a.from.FindAccessPointByName(toAccessPoint.Region, toAccessPoint.Name)
+		if found && (fromAccessPoint.Bucket != toAccessPoint.Bucket || fromAccessPoint.VpcId != toAccessPoint.VpcId) {
+			a.warnings.Add(WarningPlan, fmt.Sprintf("arn:aws:s3:%s:%s:accesspoint/%s", toAccessPoint.Region, a.from.Account.Id, toAccessPoint.Name),
+				"The bucket and VPC of an access point can't be changed, so it will be deleted and recreated")
+			a.deleteAccessPoint(fromAccessPoint)
+			found, fromAccessPoint = false, nil
+		}
+		if !found {
+			a.createAccessPoint(toAccessPoint)
+			fromAccessPoint = &AccessPoint{}
+		}
+
+		if toAccessPoint.Policy == nil {
+			if fromAccessPoint.Policy != nil {
+				a.cmds.Add("aws", "s3control", "delete-access-point-policy",
+					"--region", toAccessPoint.Region,
+					"--account-id", a.from.Account.Id,
+					"--name", toAccessPoint.Name)
+			}
+		} else if fromAccessPoint.Policy == nil || fromAccessPoint.Policy.JsonString() != toAccessPoint.Policy.JsonString() {
+			a.cmds.Add("aws", "s3control", "put-access-point-policy",
+				"--region", toAccessPoint.Region,
+				"--account-id", a.from.Account.Id,
+				"--name", toAccessPoint.Name,
+				"--policy", toAccessPoint.Policy.JsonString())
+		}
+	}
+}
+
+func (a *awsSyncCmdGenerator) updateObjectLambdaAccessPoints() {
+	for _, fromAccessPoint := range a.from.ObjectLambdaAccessPoints {
+		if found, _ := a.to.FindObjectLambdaAccessPointByName(fromAccessPoint.Region, fromAccessPoint.Name); !found {
+			a.cmds.Add("aws", "s3control", "delete-access-point-for-object-lambda",
+				"--region", fromAccessPoint.Region,
+				"--account-id", a.from.Account.Id,
+				"--name", fromAccessPoint.Name)
+		}
+	}
+
+	for _, toAccessPoint := range a.to.ObjectLambdaAccessPoints {
+		found, fromAccessPoint := a.from.FindObjectLambdaAccessPointByName(toAccessPoint.Region, toAccessPoint.Name)
+		if !found {
+			a.cmds.Add("aws", "s3control", "create-access-point-for-object-lambda",
+				"--region", toAccessPoint.Region,
+				"--account-id", a.from.Account.Id,
+				"--name", toAccessPoint.Name,
+				"--configuration", toAccessPoint.Configuration.JsonString())
+			fromAccessPoint = &ObjectLambdaAccessPoint{Configuration: toAccessPoint.Configuration}
+		}
+
+		if fromAccessPoint.Configuration.JsonString() != toAccessPoint.Configuration.JsonString() {
+			a.cmds.Add("aws", "s3control", "put-access-point-configuration-for-object-lambda",
+				"--region", toAccessPoint.Region,
+				"--account-id", a.from.Account.Id,
+				"--name", toAccessPoint.Name,
+				"--configuration", toAccessPoint.Configuration.JsonString())
+		}
+
+		if toAccessPoint.Policy == nil {
+			if fromAccessPoint.Policy != nil {
+				a.cmds.Add("aws", "s3control", "delete-access-point-policy-for-object-lambda",
+					"--region", toAccessPoint.Region,
+					"--account-id", a.from.Account.Id,
+					"--name", toAccessPoint.Name)
+			}
+		} else if fromAccessPoint.Policy == nil || fromAccessPoint.Policy.JsonString() != toAccessPoint.Policy.JsonString() {
+			a.cmds.Add("aws", "s3control", "put-access-point-policy-for-object-lambda",
+				"--region", toAccessPoint.Region,
+				"--account-id", a.from.Account.Id,
+				"--name", toAccessPoint.Name,
+				"--policy", toAccessPoint.Policy.JsonString())
+		}
+	}
+}
+
+// multiRegionAccessPointDetails builds the details argument of the
+// s3control Multi-Region Access Point commands
+func multiRegionAccessPointDetails(details interface{}) string {
+	b, err := json.Marshal(details)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+func (a *awsSyncCmdGenerator) multiRegionAccessPointCmd(command string, details interface{}) {
+	a.cmds.Add("aws", "s3control", command,
+		"--region", multiRegionControlRegion,
+		"--account-id", a.from.Account.Id,
+		"--details", multiRegionAccessPointDetails(details))
+}
+
+// updateMultiRegionAccessPoints creates and deletes Multi-Region Access Points
+// and sets their policies. They're created asynchronously, so the policy of a
+// new access point is left for a later push
+func (a *awsSyncCmdGenerator) updateMultiRegionAccessPoints() {
+	type nameDetails struct {
+		Name string
+	}
+	type regionDetails struct {
+		Bucket string
+	}
+	type policyDetails struct {
+		Name   string
+		Policy string
+	}
+
+	for _, fromAccessPoint := range a.from.MultiRegionAccessPoints {
+		if found, _ := a.to.FindMultiRegionAccessPointByName(fromAccessPoint.Name); !found {
+			a.multiRegionAccessPointCmd("delete-multi-region-access-point", nameDetails{fromAccessPoint.Name})
+		}
+	}
+
+	for _, toAccessPoint := range a.to.MultiRegionAccessPoints {
+		arn := fmt.Sprintf("arn:aws:s3::%s:accesspoint/%s", a.from.Account.Id, toAccessPoint.Name)
+		found, fromAccessPoint := a.from.FindMultiRegionAccessPointByName(toAccessPoint.Name)
+		if !found {
+			regions := []regionDetails{}
+			for _, r := range toAccessPoint.Regions {
+				regions = append(regions, regionDetails{r.Bucket})
+			}
+			a.multiRegionAccessPointCmd("create-multi-region-access-point", struct {
+				Name              string
+				PublicAccessBlock *PublicAccessBlock `json:",omitempty"`
+				Regions           []regionDetails
+			}{toAccessPoint.Name, toAccessPoint.PublicAccessBlock, regions})
+			if toAccessPoint.Policy != nil {
+				a.warnings.Add(WarningPlan, arn,
+					"Multi-Region Access Points are created asynchronously, push again once it's created to set its policy")
+			}
+			continue
+		}
+
+		if fromAccessPoint.configurationJson() != toAccessPoint.configurationJson() {
+			a.warnings.Add(WarningPlan, arn,
+				"The buckets and Block Public Access configuration of a Multi-Region Access Point can't be changed, delete and recreate it to change them")
+		}
+
+		if toAccessPoint.Policy == nil {
+			if fromAccessPoint.Policy != nil {
+				a.warnings.Add(WarningPlan, arn,
+					"A Multi-Region Access Point policy can't be removed, so it will be left in place")
+			}
+		} else if fromAccessPoint.Policy == nil || fromAccessPoint.Policy.JsonString() != toAccessPoint.Policy.JsonString() {
+			a.multiRegionAccessPointCmd("put-multi-region-access-point-policy", policyDetails{toAccessPoint.Name, toAccessPoint.Policy.JsonString()})
+		}
+	}
+}
+
+func (a *awsSyncCmdGenerator) updateCodeArtifactPolicies() {
+	for _, fromDomainPolicy := range a.from.CodeArtifactDomainPolicies {
+		if found, _ := a.to.FindCodeArtifactDomainPolicyByDomainName(fromDomainPolicy.Region, fromDomainPolicy.DomainName); !found {
+			a.cmds.Add("aws", "codeartifact", "delete-domain-permissions-policy",
+				"--region", fromDomainPolicy.Region,
+				"--domain", fromDomainPolicy.DomainName)
+		}
+	}
+
+	for _, toDomainPolicy := range a.to.CodeArtifactDomainPolicies {
+		if found, fromDomainPolicy := a.from.FindCodeArtifactDomainPolicyByDomainName(toDomainPolicy.Region, toDomainPolicy.DomainName); found {
+			if fromDomainPolicy.Policy.JsonString() == toDomainPolicy.Policy.JsonString() {
+				continue
+			}
+		}
+
+		a.cmds.Add("aws", "codeartifact", "put-domain-permissions-policy",
+			"--region", toDomainPolicy.Region,
+			"--domain", toDomainPolicy.DomainName,
+			"--policy-document", toDomainPolicy.Policy.JsonString())
+	}
+
+	for _, fromRepositoryPolicy := range a.from.CodeArtifactRepositoryPolicies {
+		if found, _ := a.to.FindCodeArtifactRepositoryPolicyByName(fromRepositoryPolicy.Region, fromRepositoryPolicy.DomainName, fromRepositoryPolicy.RepositoryName); !found {
+			a.cmds.Add("aws", "codeartifact", "delete-repository-permissions-policy",
+				"--region", fromRepositoryPolicy.Region,
+				"--domain", fromRepositoryPolicy.DomainName,
+				"--repository", fromRepositoryPolicy.RepositoryName)
+		}
+	}
+
+	for _, toRepositoryPolicy := range a.to.CodeArtifactRepositoryPolicies {
+		if found, fromRepositoryPolicy := a.from.FindCodeArtifactRepositoryPolicyByName(toRepositoryPolicy.Region, toRepositoryPolicy.DomainName, toRepositoryPolicy.RepositoryName); found {
+			if fromRepositoryPolicy.Policy.JsonString() == toRepositoryPolicy.Policy.JsonString() {
+				continue
+			}
+		}
+
+		a.cmds.Add("aws", "codeartifact", "put-repository-permissions-policy",
+			"--region", toRepositoryPolicy.Region,
+			"--domain", toRepositoryPolicy.DomainName,
+			"--repository", toRepositoryPolicy.RepositoryName,
+			"--policy-document", toRepositoryPolicy.Policy.JsonString())
+	}
+}
+
+func (a *awsSyncCmdGenerator) updateSesIdentityPolicies() {
+	for _, fromIdentity := range a.from.SesIdentityPolicies {
+		if found, _ := a.to.FindSesIdentityPoliciesByIdentity(fromIdentity.Region, fromIdentity.Identity); !found {
+			for _, ip := range fromIdentity.Policies {
+				a.cmds.Add("aws", "ses", "delete-identity-policy",
+					"--region", fromIdentity.Region,
+					"--identity", fromIdentity.Identity,
+					"--policy-name", ip.Name)
+			}
+		}
+	}
+
+	for _, toIdentity := range a.to.SesIdentityPolicies {
+		fromPolicies := []InlinePolicy{}
+		if found, fromIdentity := a.from.FindSesIdentityPoliciesByIdentity(toIdentity.Region, toIdentity.Identity); found {
+			fromPolicies = fromIdentity.Policies
+		}
+
+		// remove old policies, put-identity-policy replaces changed ones
+		for _, ip := range inlinePolicySetDifference(fromPolicies, toIdentity.Policies) {
+			if !inlinePolicyNamesContain(toIdentity.Policies, ip.Name) {
+				a.cmds.Add("aws", "ses", "delete-identity-policy",
+					"--region", toIdentity.Region,
+					"--identity", toIdentity.Identity,
+					"--policy-name", ip.Name)
+			}
+		}
+
+		for _, ip := range inlinePolicySetDifference(toIdentity.Policies, fromPolicies) {
+			a.cmds.Add("aws", "ses", "put-identity-policy",
+				"--region", toIdentity.Region,
+				"--identity", toIdentity.Identity,
+				"--policy-name", ip.Name,
+				"--policy", ip.Policy.JsonString())
+		}
+	}
+}
+
+// restApiPolicyPatch builds the patch operations that set the policy of a REST API
+func restApiPolicyPatch(doc *PolicyDocument) string {
+	value := ""
+	if doc != nil {
+		value = doc.JsonString()
+	}
+	b, err := json.Marshal([]map[string]string{{
+		"op":    "replace",
+		"path":  "/policy",
+		"value": value,
+	}})
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// restApiArn is the ARN of a REST API, which warnings about it are for
+func restApiArn(region, restApiId string) string {
+	return fmt.Sprintf("arn:aws:apigateway:%s::/restapis/%s", region, restApiId)
+}
+
+// redeployRestApi deploys the stages of the REST API, as a change to its
+// policy only takes effect once it's deployed. The deployment also deploys
+// any other changes to the API since it was last deployed, so it's a plan
+// warning
+func (a *awsSyncCmdGenerator) redeployRestApi(region, restApiId string, fromPolicy *RestApiPolicy) {
+	arn := restApiArn(region, restApiId)
+	if fromPolicy == nil || len(fromPolicy.stages) == 0 {
+		a.warnings.Add(WarningPlan, arn, "REST API has no stages iamy can redeploy, deploy it for the policy to take effect")
+		return
+	}
+	for _, stage := range fromPolicy.stages {
+		a.cmds.Add("aws", "apigateway", "create-deployment",
+			"--region", region,
+			"--rest-api-id", restApiId,
+			"--stage-name", stage,
+			"--description", "iamy policy update")
+	}
+	a.warnings.Add(WarningPlan, arn, fmt.Sprintf("Redeploying stages %s for the policy to take effect, which also deploys any other changes to the API since it was last deployed", strings.Join(fromPolicy.stages, ", ")))
+}
+
+func (a *awsSyncCmdGenerator) updateRestApiPolicies() {
+	for _, fromPolicy := range a.from.RestApiPolicies {
+		if found, _ := a.to.FindRestApiPolicyById(fromPolicy.Region, fromPolicy.RestApiId); !found {
+			a.cmds.Add("aws", "apigateway", "update-rest-api",
+				"--region", fromPolicy.Region,
+				"--rest-api-id", fromPolicy.RestApiId,
+				"--patch-operations", restApiPolicyPatch(nil))
+			a.redeployRestApi(fromPolicy.Region, fromPolicy.RestApiId, fromPolicy)
+		}
+	}
+
+	for _, toPolicy := range a.to.RestApiPolicies {
+		found, fromPolicy := a.from.FindRestApiPolicyById(toPolicy.Region, toPolicy.RestApiId)
+		if found && fromPolicy.Policy.JsonString() == toPolicy.Policy.JsonString() {
+			continue
+		}
+
+		a.cmds.Add("aws", "apigateway", "update-rest-api",
+			"--region", toPolicy.Region,
+			"--rest-api-id", toPolicy.RestApiId,
+			"--patch-operations", restApiPolicyPatch(toPolicy.Policy))
+		a.redeployRestApi(toPolicy.Region, toPolicy.RestApiId, fromPolicy)
+	}
+}
+
+// glacierVaultPolicy builds the policy argument of set-vault-access-policy
+func glacierVaultPolicy(doc *PolicyDocument) string {
+	b, err := json.Marshal(map[string]string{"Policy": doc.JsonString()})
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+func (a *awsSyncCmdGenerator) updateGlacierVaultPolicies() {
+	for _, fromPolicy := range a.from.GlacierVaultPolicies {
+		if found, _ := a.to.FindGlacierVaultPolicyByName(fromPolicy.Region, fromPolicy.VaultName); !found && fromPolicy.Policy != nil {
+			a.cmds.Add("aws", "glacier", "delete-vault-access-policy",
+				"--account-id", glacierAccountId,
+				"--region", fromPolicy.Region,
+				"--vault-name", fromPolicy.VaultName)
+		}
+	}
+
+	for _, toPolicy := range a.to.GlacierVaultPolicies {
+		found, fromPolicy := a.from.FindGlacierVaultPolicyByName(toPolicy.Region, toPolicy.VaultName)
+		if !found {
+			fromPolicy = &GlacierVaultPolicy{}
+		}
+
+		if fromPolicy.LockPolicy.JsonString() != toPolicy.LockPolicy.JsonString() || fromPolicy.LockState != toPolicy.LockState {
+			a.warnings.Add(WarningPlan, fmt.Sprintf("arn:aws:glacier:%s:%s:vaults/%s", toPolicy.Region, a.from.Account.Id, toPolicy.VaultName),
+				"Vault lock policies aren't pushed, so the change to the lock policy will be ignored")
+		}
+
+		if fromPolicy.Policy.JsonString() == toPolicy.Policy.JsonString() {
+			continue
+		}
+		if toPolicy.Policy == nil {
+			a.cmds.Add("aws", "glacier", "delete-vault-access-policy",
+				"--account-id", glacierAccountId,
+				"--region", toPolicy.Region,
+				"--vault-name", toPolicy.VaultName)
+		} else {
+			a.cmds.Add("aws", "glacier", "set-vault-access-policy",
+				"--account-id", glacierAccountId,
+				"--region", toPolicy.Region,
+				"--vault-name", toPolicy.VaultName,
+				"--policy", glacierVaultPolicy(toPolicy.Policy))
+		}
+	}
+}
+
+// grantsReplication returns whether the registry policy allows another
+// account to replicate images to the registry
+func grantsReplication(doc *PolicyDocument) bool {
+	for _, s := range doc.statements() {
+		statement := PolicyStatement{data: s}
+		if isAllow(statement) && actionOverlaps(statement, "ecr:ReplicateImage") {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *awsSyncCmdGenerator) updateEcrRegistryPolicies() {
+	for _, fromPolicy := range a.from.EcrRegistryPolicies {
+		if found, _ := a.to.FindEcrRegistryPolicyByRegion(fromPolicy.Region); !found {
+			if grantsReplication(fromPolicy.Policy) {
+				a.warnings.Add(WarningPlan, fmt.Sprintf("arn:aws:ecr:%s:%s:registry", fromPolicy.Region, a.from.Account.Id),
+					"Deleting the registry policy stops other accounts replicating images to this registry")
 			}
+			a.cmds.Add("aws", "ecr", "delete-registry-policy",
+				"--region", fromPolicy.Region)
 		}
+	}
 
-		if !isToAccountUpToDate {
-			a.cmds.Add("aws", "s3api", "put-bucket-policy",
-				"--bucket", toBucketPolicy.BucketName,
-				"--policy", toBucketPolicy.Policy.JsonString())
+	for _, toPolicy := range a.to.EcrRegistryPolicies {
+		found, fromPolicy := a.from.FindEcrRegistryPolicyByRegion(toPolicy.Region)
+		if found && fromPolicy.Policy.JsonString() == toPolicy.Policy.JsonString() {
+			continue
 		}
+		a.cmds.Add("aws", "ecr", "put-registry-policy",
+			"--region", toPolicy.Region,
+			"--policy-text", toPolicy.Policy.JsonString())
 	}
 }
 
+// A SyncPlan is the commands needed to sync one account to another, and any
+// warnings about their effects
+type SyncPlan struct {
+	Cmds     CmdList
+	Warnings Warnings
+	// Errors are why the plan can't make the accounts match, eg. a policy
+	// that can't be updated without deleting versions
+	Errors []error
+
+	from, to *AccountData
+	renames  []resourceRename
+}
+
 func (a *awsSyncCmdGenerator) GenerateCmds() CmdList {
 	a.updatePolicies()
 	a.updateRoles()
@@ -543,12 +1211,92 @@ func (a *awsSyncCmdGenerator) GenerateCmds() CmdList {
 	a.updateUsers()
 	a.updateInstanceProfiles()
 	a.updateBucketPolicies()
+	a.updateAccountPublicAccessBlock()
+	a.updateAccessPoints()
+	a.updateObjectLambdaAccessPoints()
+	a.updateMultiRegionAccessPoints()
+	a.updateCodeArtifactPolicies()
+	a.updateSesIdentityPolicies()
+	a.updateRestApiPolicies()
+	a.updateGlacierVaultPolicies()
+	a.updateEcrRegistryPolicies()
 	a.deleteOldEntities()
 
+	a.cmds = a.cmds.dependencyOrdered()
 	return a.cmds
 }
 
+// PlanSync returns the plan to make the from account match the to account
+func PlanSync(from, to *AccountData) *SyncPlan {
+	return PlanSyncWithOptions(from, to, SyncOptions{})
+}
+
+// SyncOptions change how a sync is planned
+type SyncOptions struct {
+	// DisableRenameDetection plans renamed and moved users, groups, roles and
+	// policies as a delete and a create
+	DisableRenameDetection bool
+	// Protected selects resources that mustn't be deleted, even when they're
+	// missing from the files
+	Protected []ResourceSelector
+	// DisablePrune keeps the resources that are missing from the files,
+	// rather than deleting them
+	DisablePrune bool
+	// PolicyVersionRetention is how many versions of a managed policy to keep
+	// when a new version is created, including it, deleting the oldest
+	// nondefault versions beyond them. 0 keeps as many as IAM allows
+	PolicyVersionRetention int
+	// KeepPolicyVersions never deletes policy versions, making the update of
+	// a policy with the most versions IAM allows a plan error instead
+	KeepPolicyVersions bool
+	// Ownership is which policies are only observed, which are planned as
+	// they are in AWS whatever the files have
+	Ownership PolicyOwnership
+	// Iam lists the credentials of the users the plan deletes, so must use
+	// the credentials of the account planned for, eg. an assumed role's.
+	// Without it the default credentials are used
+	Iam iamiface.IAMAPI
+}
+
+// PlanSyncWithOptions returns the plan to make the from account match the to
+// account, changing how it's planned with opts
+func PlanSyncWithOptions(from, to *AccountData, opts SyncOptions) *SyncPlan {
+	a := awsSyncCmdGenerator{
+		from:             from,
+		to:               to,
+		cmds:             CmdList{},
+		warnings:         Warnings{},
+		versionRetention: opts.PolicyVersionRetention,
+		keepVersions:     opts.KeepPolicyVersions,
+	}
+	if opts.Iam != nil {
+		a.iam = &iamClient{opts.Iam}
+	}
+	var observed Warnings
+	a.to, observed = opts.Ownership.Observed(from, a.to)
+	a.warnings = append(a.warnings, observed...)
+	if len(opts.Protected) > 0 {
+		a.protect(opts.Protected)
+	}
+	if opts.DisablePrune {
+		a.keepUnpruned()
+	}
+	// renames delete the old resource, so are only detected once the
+	// resources that mustn't be deleted are kept
+	if !opts.DisableRenameDetection {
+		a.detectRenames()
+	}
+	cmds := a.GenerateCmds()
+	return &SyncPlan{
+		Cmds:     cmds,
+		Warnings: a.warnings,
+		Errors:   a.errors,
+		from:     from,
+		to:       a.to,
+		renames:  a.renames,
+	}
+}
+
 func AwsCliCmdsForSync(from, to *AccountData) CmdList {
-	a := awsSyncCmdGenerator{from, to, CmdList{}}
-	return a.GenerateCmds()
+	return PlanSync(from, to).Cmds
 }
@@ -5,6 +5,11 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 )
 
 func loadDataFrom(p string) *AccountData {
@@ -99,3 +104,489 @@ Actual:
 
 	}
 }
+
+func mustPolicyDocument(t *testing.T, jsonString string) *PolicyDocument {
+	doc, err := NewPolicyDocumentFromJson(jsonString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestCodeArtifactPolicySync(t *testing.T) {
+	oldDoc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123:root"},"Action":"codeartifact:ReadFromRepository","Resource":"*"}]}`)
+	newDoc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::456:root"},"Action":"codeartifact:ReadFromRepository","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addCodeArtifactDomainPolicy(&CodeArtifactDomainPolicy{Region: "us-east-1", DomainName: "unchanged", Policy: oldDoc})
+	remoteData.addCodeArtifactDomainPolicy(&CodeArtifactDomainPolicy{Region: "us-east-1", DomainName: "removed", Policy: oldDoc})
+	remoteData.addCodeArtifactRepositoryPolicy(&CodeArtifactRepositoryPolicy{Region: "us-east-1", DomainName: "unchanged", RepositoryName: "npm", Policy: oldDoc})
+
+	localData := NewAccountData("123")
+	localData.addCodeArtifactDomainPolicy(&CodeArtifactDomainPolicy{Region: "us-east-1", DomainName: "unchanged", Policy: oldDoc})
+	localData.addCodeArtifactDomainPolicy(&CodeArtifactDomainPolicy{Region: "eu-west-1", DomainName: "unchanged", Policy: oldDoc})
+	localData.addCodeArtifactRepositoryPolicy(&CodeArtifactRepositoryPolicy{Region: "us-east-1", DomainName: "unchanged", RepositoryName: "npm", Policy: newDoc})
+
+	awsCmds := AwsCliCmdsForSync(remoteData, localData)
+
+	expected := []string{
+		"aws codeartifact delete-domain-permissions-policy --region us-east-1 --domain removed",
+		"aws codeartifact put-domain-permissions-policy --region eu-west-1 --domain unchanged --policy-document '" + oldDoc.JsonString() + "'",
+		"aws codeartifact put-repository-permissions-policy --region us-east-1 --domain unchanged --repository npm --policy-document '" + newDoc.JsonString() + "'",
+	}
+	actual := awsCmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+}
+
+func TestSesIdentityPolicySync(t *testing.T) {
+	oldDoc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123:root"},"Action":"ses:SendEmail","Resource":"*"}]}`)
+	newDoc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::456:root"},"Action":"ses:SendEmail","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addSesIdentityPolicies(&SesIdentityPolicies{Region: "us-east-1", Identity: "example.com", Policies: []InlinePolicy{
+		{Name: "changed", Policy: oldDoc},
+		{Name: "removed", Policy: oldDoc},
+	}})
+	remoteData.addSesIdentityPolicies(&SesIdentityPolicies{Region: "us-east-1", Identity: "old@example.com", Policies: []InlinePolicy{
+		{Name: "delegate", Policy: oldDoc},
+	}})
+	remoteData.addSesIdentityPolicies(&SesIdentityPolicies{Region: "eu-west-1", Identity: "example.com", Policies: []InlinePolicy{
+		{Name: "changed", Policy: oldDoc},
+	}})
+
+	localData := NewAccountData("123")
+	localData.addSesIdentityPolicies(&SesIdentityPolicies{Region: "us-east-1", Identity: "example.com", Policies: []InlinePolicy{
+		{Name: "changed", Policy: newDoc},
+	}})
+	localData.addSesIdentityPolicies(&SesIdentityPolicies{Region: "eu-west-1", Identity: "example.com", Policies: []InlinePolicy{
+		{Name: "changed", Policy: oldDoc},
+	}})
+
+	awsCmds := AwsCliCmdsForSync(remoteData, localData)
+
+	expected := []string{
+		"aws ses delete-identity-policy --region us-east-1 --identity old@example.com --policy-name delegate",
+		"aws ses delete-identity-policy --region us-east-1 --identity example.com --policy-name removed",
+		"aws ses put-identity-policy --region us-east-1 --identity example.com --policy-name changed --policy '" + newDoc.JsonString() + "'",
+	}
+	actual := awsCmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+}
+
+func TestRestApiPolicySync(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"execute-api:Invoke","Resource":"*","Condition":{"NotIpAddress":{"aws:SourceIp":"10.0.0.0/8"}}}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addRestApiPolicy(&RestApiPolicy{Region: "us-east-1", RestApiId: "removed", Policy: doc, stages: []string{"prod", "test"}})
+
+	localData := NewAccountData("123")
+	localData.addRestApiPolicy(&RestApiPolicy{Region: "ap-southeast-2", RestApiId: "added", Policy: doc})
+
+	plan := PlanSync(remoteData, localData)
+	awsCmds := plan.Cmds
+
+	if len(awsCmds) != 4 {
+		t.Fatalf("Expected 4 commands, got:\n%s", awsCmds)
+	}
+	if awsCmds[0].String() != `aws apigateway update-rest-api --region us-east-1 --rest-api-id removed --patch-operations [{"op":"replace","path":"/policy","value":""}]` {
+		t.Errorf("Unexpected command to remove the policy: %s", awsCmds[0])
+	}
+	if awsCmds[1].String() != `aws apigateway create-deployment --region us-east-1 --rest-api-id removed --stage-name prod --description 'iamy policy update'` || awsCmds[2].Args[7] != "test" {
+		t.Errorf("Expected the stages to be redeployed, got:\n%s", awsCmds[1:3])
+	}
+	if awsCmds[3].Args[5] != "added" || !strings.Contains(awsCmds[3].Args[7], `\"execute-api:Invoke\"`) {
+		t.Errorf("Unexpected command to put the policy: %s", awsCmds[3])
+	}
+	if plan.Warnings.Count(WarningPlan) != 2 {
+		t.Errorf("Expected warnings for the deployment and the API with no stages to deploy, got %v", plan.Warnings)
+	}
+}
+
+func TestUnescapeRestApiPolicy(t *testing.T) {
+	escaped := `{\"Version\":\"2012-10-17\",\"Statement\":[]}`
+	if actual := unescapeRestApiPolicy(escaped); actual != `{"Version":"2012-10-17","Statement":[]}` {
+		t.Errorf("Expected policy to be unescaped, got %s", actual)
+	}
+}
+
+func TestPublicAccessBlockSync(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::public/*"}]}`)
+	blockAll := &PublicAccessBlock{BlockPublicAcls: true, IgnorePublicAcls: true, BlockPublicPolicy: true, RestrictPublicBuckets: true}
+
+	remoteData := NewAccountData("123")
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "public", Policy: doc, PublicAccessBlock: blockAll})
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "removed", PublicAccessBlock: blockAll})
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "unmanaged", PublicAccessBlock: blockAll})
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "unlisted", PublicAccessBlock: blockAll})
+
+	localData := NewAccountData("123")
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "public", Policy: doc, PublicAccessBlock: &PublicAccessBlock{BlockPublicAcls: true, IgnorePublicAcls: true}})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "private", PublicAccessBlock: blockAll})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "removed", PublicAccessBlock: &PublicAccessBlock{}})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "unmanaged", Tags: map[string]string{}})
+	localData.AccountPublicAccessBlock = &AccountPublicAccessBlock{*blockAll}
+
+	awsCmds := AwsCliCmdsForSync(remoteData, localData)
+
+	expected := []string{
+		"aws s3api put-public-access-block --bucket public --public-access-block-configuration BlockPublicAcls=true,IgnorePublicAcls=true,BlockPublicPolicy=false,RestrictPublicBuckets=false",
+		"aws s3api put-public-access-block --bucket private --public-access-block-configuration BlockPublicAcls=true,IgnorePublicAcls=true,BlockPublicPolicy=true,RestrictPublicBuckets=true",
+		"aws s3api delete-public-access-block --bucket removed",
+		"aws s3control put-public-access-block --account-id 123 --public-access-block-configuration BlockPublicAcls=true,IgnorePublicAcls=true,BlockPublicPolicy=true,RestrictPublicBuckets=true",
+	}
+	actual := awsCmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+
+	remoteData.AccountPublicAccessBlock = &AccountPublicAccessBlock{*blockAll}
+	localData.AccountPublicAccessBlock = nil
+	if actual := AwsCliCmdsForSync(remoteData, localData).String(); strings.Contains(actual, "s3control") {
+		t.Errorf("Expected the account configuration to be unmanaged without its file, got:\n%v", actual)
+	}
+	localData.AccountPublicAccessBlock = &AccountPublicAccessBlock{}
+	if actual := AwsCliCmdsForSync(remoteData, localData).String(); !strings.Contains(actual, "aws s3control delete-public-access-block --account-id 123") {
+		t.Errorf("Expected the account configuration to be removed by an empty file, got:\n%v", actual)
+	}
+}
+
+func TestBucketAclSync(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.canonicalUserId = "owner"
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "legacy", Acl: &BucketAcl{Canned: "public-read"}})
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "logs", Acl: &BucketAcl{Canned: "log-delivery-write"}})
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "unmanaged", Acl: &BucketAcl{Canned: "log-delivery-write"}})
+
+	localData := NewAccountData("123")
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "legacy", Acl: &BucketAcl{Canned: "private"}})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "unmanaged", Tags: map[string]string{"team": "data"}})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "logs", Acl: &BucketAcl{Grants: []BucketGrant{
+		{Grantee: logDeliveryGroupUri, Permission: "WRITE"},
+		{Grantee: logDeliveryGroupUri, Permission: "READ_ACP"},
+	}}})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "shared", Acl: &BucketAcl{Grants: []BucketGrant{
+		{Grantee: "id=partner", Permission: "READ"},
+	}}})
+
+	awsCmds := AwsCliCmdsForSync(remoteData, localData)
+
+	expected := []string{
+		"aws s3api put-bucket-acl --bucket legacy --acl private",
+		`aws s3api put-bucket-tagging --bucket unmanaged --tagging {"TagSet":[{"Key":"team","Value":"data"}]}`,
+		`aws s3api put-bucket-acl --bucket shared --access-control-policy {"Grants":[{"Grantee":{"Type":"CanonicalUser","ID":"owner"},"Permission":"FULL_CONTROL"},{"Grantee":{"Type":"CanonicalUser","ID":"partner"},"Permission":"READ"}],"Owner":{"ID":"owner"}}`,
+	}
+	actual := awsCmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+}
+
+func TestBucketTagsSync(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "untagged", Tags: map[string]string{"team": "data"}})
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "same", Tags: map[string]string{"team": "data"}})
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "retagged", Tags: map[string]string{"team": "data"}})
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "unmanaged", Tags: map[string]string{"team": "data"}})
+	remoteData.addBucketPolicy(&BucketPolicy{BucketName: "stack", Tags: map[string]string{"team": "data"}, systemTags: map[string]string{"aws:cloudformation:stack-name": "app"}})
+
+	localData := NewAccountData("123")
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "untagged", PublicAccessBlock: &PublicAccessBlock{BlockPublicAcls: true}, Tags: map[string]string{}})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "same", Tags: map[string]string{"team": "data"}})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "retagged", Tags: map[string]string{"team": "web", "cost-centre": "a,b"}})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "unmanaged", PublicAccessBlock: &PublicAccessBlock{BlockPublicAcls: true}})
+	localData.addBucketPolicy(&BucketPolicy{BucketName: "stack", Tags: map[string]string{}})
+
+	awsCmds := AwsCliCmdsForSync(remoteData, localData)
+
+	expected := []string{
+		"aws s3api put-public-access-block --bucket untagged --public-access-block-configuration BlockPublicAcls=true,IgnorePublicAcls=false,BlockPublicPolicy=false,RestrictPublicBuckets=false",
+		"aws s3api delete-bucket-tagging --bucket untagged",
+		`aws s3api put-bucket-tagging --bucket retagged --tagging {"TagSet":[{"Key":"cost-centre","Value":"a,b"},{"Key":"team","Value":"web"}]}`,
+		"aws s3api put-public-access-block --bucket unmanaged --public-access-block-configuration BlockPublicAcls=true,IgnorePublicAcls=false,BlockPublicPolicy=false,RestrictPublicBuckets=false",
+		`aws s3api put-bucket-tagging --bucket stack --tagging {"TagSet":[{"Key":"aws:cloudformation:stack-name","Value":"app"}]}`,
+	}
+	actual := awsCmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+}
+
+func TestAccessPointSync(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123:root"},"Action":"s3:GetObject","Resource":"arn:aws:s3:us-east-1:123:accesspoint/reader/object/*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addAccessPoint(&AccessPoint{Region: "us-east-1", Name: "removed", Bucket: "data"})
+	remoteData.addAccessPoint(&AccessPoint{Region: "us-east-1", Name: "reader", Bucket: "data", Policy: doc})
+	remoteData.addAccessPoint(&AccessPoint{Region: "us-east-1", Name: "moved", Bucket: "old"})
+
+	localData := NewAccountData("123")
+	localData.addAccessPoint(&AccessPoint{Region: "us-east-1", Name: "reader", Bucket: "data"})
+	localData.addAccessPoint(&AccessPoint{Region: "us-east-1", Name: "moved", Bucket: "new"})
+	localData.addAccessPoint(&AccessPoint{Region: "us-east-1", Name: "private", Bucket: "data", VpcId: "vpc-1"})
+
+	plan := PlanSync(remoteData, localData)
+
+	expected := []string{
+		"aws s3control delete-access-point --region us-east-1 --account-id 123 --name removed",
+		"aws s3control delete-access-point-policy --region us-east-1 --account-id 123 --name reader",
+		"aws s3control delete-access-point --region us-east-1 --account-id 123 --name moved",
+		"aws s3control create-access-point --region us-east-1 --account-id 123 --name moved --bucket new",
+		"aws s3control create-access-point --region us-east-1 --account-id 123 --name private --bucket data --vpc-configuration VpcId=vpc-1",
+	}
+	actual := plan.Cmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+	if plan.Warnings.Count(WarningPlan) != 1 {
+		t.Errorf("Expected a warning about recreating the moved access point, got %v", plan.Warnings)
+	}
+}
+
+func TestObjectLambdaAccessPointSync(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123:root"},"Action":"s3-object-lambda:GetObject","Resource":"arn:aws:s3-object-lambda:us-east-1:123:accesspoint/redacted"}]}`)
+	conf := func(function string) ObjectLambdaConfiguration {
+		c := ObjectLambdaConfiguration{SupportingAccessPoint: "arn:aws:s3:us-east-1:123:accesspoint/reader"}
+		c.TransformationConfigurations = []ObjectLambdaTransformationConfiguration{{Actions: []string{"GetObject"}}}
+		c.TransformationConfigurations[0].ContentTransformation.AwsLambda.FunctionArn = "arn:aws:lambda:us-east-1:123:function:" + function
+		return c
+	}
+
+	remoteData := NewAccountData("123")
+	remoteData.addObjectLambdaAccessPoint(&ObjectLambdaAccessPoint{Region: "us-east-1", Name: "removed", Configuration: conf("redact")})
+	remoteData.addObjectLambdaAccessPoint(&ObjectLambdaAccessPoint{Region: "us-east-1", Name: "redacted", Configuration: conf("redact")})
+
+	localData := NewAccountData("123")
+	localData.addObjectLambdaAccessPoint(&ObjectLambdaAccessPoint{Region: "us-east-1", Name: "redacted", Configuration: conf("redact-v2"), Policy: doc})
+	localData.addObjectLambdaAccessPoint(&ObjectLambdaAccessPoint{Region: "us-east-1", Name: "resized", Configuration: conf("resize")})
+
+	plan := PlanSync(remoteData, localData)
+
+	expected := []string{
+		"aws s3control delete-access-point-for-object-lambda --region us-east-1 --account-id 123 --name removed",
+		`aws s3control put-access-point-configuration-for-object-lambda --region us-east-1 --account-id 123 --name redacted --configuration {"SupportingAccessPoint":"arn:aws:s3:us-east-1:123:accesspoint/reader","TransformationConfigurations":[{"Actions":["GetObject"],"ContentTransformation":{"AwsLambda":{"FunctionArn":"arn:aws:lambda:us-east-1:123:function:redact-v2"}}}]}`,
+		"aws s3control put-access-point-policy-for-object-lambda --region us-east-1 --account-id 123 --name redacted --policy '" + doc.JsonString() + "'",
+		`aws s3control create-access-point-for-object-lambda --region us-east-1 --account-id 123 --name resized --configuration {"SupportingAccessPoint":"arn:aws:s3:us-east-1:123:accesspoint/reader","TransformationConfigurations":[{"Actions":["GetObject"],"ContentTransformation":{"AwsLambda":{"FunctionArn":"arn:aws:lambda:us-east-1:123:function:resize"}}}]}`,
+	}
+	actual := plan.Cmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+}
+
+func TestPermissionsBoundarySync(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}})
+	remoteData.addUser(&User{iamService: iamService{Name: "carol", Path: "/"}, PermissionsBoundary: "developer-boundary"})
+	remoteData.addRole(&Role{iamService: iamService{Name: "deploy", Path: "/"}, PermissionsBoundary: "arn:aws:iam::aws:policy/PowerUserAccess"})
+
+	localData := NewAccountData("123")
+	localData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, PermissionsBoundary: "boundaries/developer-boundary"})
+	localData.addUser(&User{iamService: iamService{Name: "carol", Path: "/"}})
+	localData.addUser(&User{iamService: iamService{Name: "dave", Path: "/"}, PermissionsBoundary: "developer-boundary"})
+	localData.addRole(&Role{iamService: iamService{Name: "deploy", Path: "/"}, PermissionsBoundary: "deploy-boundary"})
+
+	awsCmds := AwsCliCmdsForSync(remoteData, localData)
+
+	expected := []string{
+		"aws iam create-user --user-name dave --path / --permissions-boundary arn:aws:iam::123:policy/developer-boundary",
+		"aws iam put-role-permissions-boundary --role-name deploy --permissions-boundary arn:aws:iam::123:policy/deploy-boundary",
+		"aws iam put-user-permissions-boundary --user-name bob --permissions-boundary arn:aws:iam::123:policy/boundaries/developer-boundary",
+	}
+	actual := awsCmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+}
+
+func TestGlacierVaultPolicySync(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123:root"},"Action":"glacier:UploadArchive","Resource":"*"}]}`)
+	lock := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"glacier:DeleteArchive","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addGlacierVaultPolicy(&GlacierVaultPolicy{Region: "us-east-1", VaultName: "removed", Policy: doc})
+	remoteData.addGlacierVaultPolicy(&GlacierVaultPolicy{Region: "us-east-1", VaultName: "locked", Policy: doc, LockPolicy: lock, LockState: "Locked"})
+
+	localData := NewAccountData("123")
+	localData.addGlacierVaultPolicy(&GlacierVaultPolicy{Region: "us-east-1", VaultName: "locked", LockPolicy: doc, LockState: "Locked"})
+	localData.addGlacierVaultPolicy(&GlacierVaultPolicy{Region: "ap-southeast-2", VaultName: "added", Policy: doc})
+
+	plan := PlanSync(remoteData, localData)
+
+	expected := []string{
+		"aws glacier delete-vault-access-policy --account-id - --region us-east-1 --vault-name removed",
+		"aws glacier delete-vault-access-policy --account-id - --region us-east-1 --vault-name locked",
+		`aws glacier set-vault-access-policy --account-id - --region ap-southeast-2 --vault-name added --policy '{"Policy":"{\n  \"Statement\": [\n    {\n      \"Action\": \"glacier:UploadArchive\",\n      \"Effect\": \"Allow\",\n      \"Principal\": {\n        \"AWS\": \"arn:aws:iam::123:root\"\n      },\n      \"Resource\": \"*\"\n    }\n  ],\n  \"Version\": \"2012-10-17\"\n}"}'`,
+	}
+	actual := plan.Cmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+	if plan.Warnings.Count(WarningPlan) != 1 {
+		t.Errorf("Expected a warning about the ignored lock policy change, got %v", plan.Warnings)
+	}
+}
+
+func TestMultiRegionAccessPointSync(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123:root"},"Action":"s3:GetObject","Resource":"arn:aws:s3::123:accesspoint/reader.mrap/object/*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addMultiRegionAccessPoint(&MultiRegionAccessPoint{Name: "removed", Regions: []MultiRegionAccessPointRegion{{Bucket: "a", Region: "us-east-1"}}})
+	remoteData.addMultiRegionAccessPoint(&MultiRegionAccessPoint{Name: "reader", Regions: []MultiRegionAccessPointRegion{{Bucket: "a", Region: "us-east-1"}}})
+	remoteData.addMultiRegionAccessPoint(&MultiRegionAccessPoint{Name: "moved", Regions: []MultiRegionAccessPointRegion{{Bucket: "a", Region: "us-east-1"}}, Policy: doc})
+
+	localData := NewAccountData("123")
+	localData.addMultiRegionAccessPoint(&MultiRegionAccessPoint{Name: "reader", Regions: []MultiRegionAccessPointRegion{{Bucket: "a"}}, Policy: doc})
+	localData.addMultiRegionAccessPoint(&MultiRegionAccessPoint{Name: "moved", Regions: []MultiRegionAccessPointRegion{{Bucket: "b"}}, Policy: doc})
+	localData.addMultiRegionAccessPoint(&MultiRegionAccessPoint{Name: "added", Regions: []MultiRegionAccessPointRegion{{Bucket: "b"}, {Bucket: "a"}}, PublicAccessBlock: &PublicAccessBlock{BlockPublicAcls: true}, Policy: doc})
+
+	plan := PlanSync(remoteData, localData)
+
+	expected := []string{
+		`aws s3control delete-multi-region-access-point --region us-west-2 --account-id 123 --details {"Name":"removed"}`,
+		`aws s3control put-multi-region-access-point-policy --region us-west-2 --account-id 123 --details '{"Name":"reader","Policy":"{\n  \"Statement\": [\n    {\n      \"Action\": \"s3:GetObject\",\n      \"Effect\": \"Allow\",\n      \"Principal\": {\n        \"AWS\": \"arn:aws:iam::123:root\"\n      },\n      \"Resource\": \"arn:aws:s3::123:accesspoint/reader.mrap/object/*\"\n    }\n  ],\n  \"Version\": \"2012-10-17\"\n}"}'`,
+		`aws s3control create-multi-region-access-point --region us-west-2 --account-id 123 --details {"Name":"added","PublicAccessBlock":{"BlockPublicAcls":true,"IgnorePublicAcls":false,"BlockPublicPolicy":false,"RestrictPublicBuckets":false},"Regions":[{"Bucket":"a"},{"Bucket":"b"}]}`,
+	}
+	actual := plan.Cmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+	if plan.Warnings.Count(WarningPlan) != 2 {
+		t.Errorf("Expected warnings about the moved and added access points, got %v", plan.Warnings)
+	}
+}
+
+func TestEcrRegistryPolicySync(t *testing.T) {
+	replication := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::456:root"},"Action":["ecr:CreateRepository","ecr:ReplicateImage"],"Resource":"arn:aws:ecr:us-east-1:123:repository/*"}]}`)
+	pull := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::456:root"},"Action":"ecr:BatchImportUpstreamImage","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addEcrRegistryPolicy(&EcrRegistryPolicy{Region: "us-east-1", Policy: replication})
+	remoteData.addEcrRegistryPolicy(&EcrRegistryPolicy{Region: "us-west-2", Policy: pull})
+
+	localData := NewAccountData("123")
+	localData.addEcrRegistryPolicy(&EcrRegistryPolicy{Region: "us-west-2", Policy: pull})
+	localData.addEcrRegistryPolicy(&EcrRegistryPolicy{Region: "ap-southeast-2", Policy: pull})
+
+	plan := PlanSync(remoteData, localData)
+
+	expected := []string{
+		"aws ecr delete-registry-policy --region us-east-1",
+		"aws ecr put-registry-policy --region ap-southeast-2 --policy-text '" + pull.JsonString() + "'",
+	}
+	actual := plan.Cmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+	if plan.Warnings.Count(WarningPlan) != 1 {
+		t.Errorf("Expected a warning about stopping replication, got %v", plan.Warnings)
+	}
+}
+
+func TestPolicyRenameIsWarned(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc})
+
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "s3-reader", Path: "/"}, Policy: doc})
+
+	plan := PlanSyncWithOptions(remoteData, localData, SyncOptions{DisableRenameDetection: true})
+	if plan.Warnings.Count(WarningPlan) != 1 || !strings.Contains(plan.Warnings[0].Message, "arn:aws:iam::123:policy/reader") {
+		t.Errorf("Expected a warning about the renamed policy, got %v", plan.Warnings)
+	}
+
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "s3-reader", Path: "/"}, Policy: doc})
+	localData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc})
+	if plan = PlanSync(remoteData, localData); plan.Warnings.Count(WarningPlan) != 0 {
+		t.Errorf("Expected no warnings when neither policy is deleted, got %v", plan.Warnings)
+	}
+}
+
+func TestCmdsAreDependencyOrdered(t *testing.T) {
+	readDoc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+	writeDoc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: readDoc})
+	remoteData.addGroup(&Group{iamService: iamService{Name: "readers", Path: "/"}, Policies: []string{"reader"}})
+	remoteData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, Groups: []string{"readers"}})
+
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "writer", Path: "/"}, Policy: writeDoc})
+	localData.addGroup(&Group{iamService: iamService{Name: "writers", Path: "/"}, Policies: []string{"writer"}})
+	localData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, Groups: []string{"writers"}})
+
+	expected := []string{
+		"aws iam create-policy --policy-name writer --path / --policy-document '" + writeDoc.JsonString() + "'",
+		"aws iam create-group --group-name writers --path /",
+		"aws iam attach-group-policy --group-name writers --policy-arn arn:aws:iam::123:policy/writer",
+		"aws iam add-user-to-group --user-name bob --group-name writers",
+		"aws iam remove-user-from-group --user-name bob --group-name readers",
+		"aws iam detach-group-policy --group-name readers --policy-arn arn:aws:iam::123:policy/reader",
+		"aws iam delete-group --group-name readers",
+		"aws iam delete-policy --policy-arn arn:aws:iam::123:policy/reader",
+	}
+	actual := PlanSync(remoteData, localData).Cmds.String()
+
+	if actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+}
+
+type fakeUserCredsIam struct {
+	iamiface.IAMAPI
+	keys map[string][]string
+}
+
+func (f *fakeUserCredsIam) ListAccessKeys(input *iam.ListAccessKeysInput) (*iam.ListAccessKeysOutput, error) {
+	keys, ok := f.keys[*input.UserName]
+	if !ok {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "The user cannot be found", nil)
+	}
+	resp := &iam.ListAccessKeysOutput{}
+	for _, k := range keys {
+		resp.AccessKeyMetadata = append(resp.AccessKeyMetadata, &iam.AccessKeyMetadata{AccessKeyId: aws.String(k)})
+	}
+	return resp, nil
+}
+
+func (f *fakeUserCredsIam) ListMFADevices(input *iam.ListMFADevicesInput) (*iam.ListMFADevicesOutput, error) {
+	return &iam.ListMFADevicesOutput{}, nil
+}
+
+func (f *fakeUserCredsIam) GetLoginProfile(input *iam.GetLoginProfileInput) (*iam.GetLoginProfileOutput, error) {
+	return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "Login Profile cannot be found", nil)
+}
+
+func TestDeletedUserCredentialsListedWithAccountClient(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}})
+	localData := NewAccountData("123")
+
+	plan := PlanSyncWithOptions(remoteData, localData, SyncOptions{Iam: &fakeUserCredsIam{keys: map[string][]string{"bob": {"AKIAEXAMPLE"}}}})
+	expected := "aws iam delete-access-key --user-name bob --access-key-id AKIAEXAMPLE\naws iam delete-user --user-name bob"
+	if actual := plan.Cmds.String(); actual != expected {
+		t.Errorf("Expected:\n%v\nActual:\n%v", expected, actual)
+	}
+
+	plan = PlanSyncWithOptions(remoteData, localData, SyncOptions{Iam: &fakeUserCredsIam{}})
+	if len(plan.Errors) != 1 || strings.Contains(plan.Cmds.String(), "delete-user") {
+		t.Errorf("Expected a plan error rather than deleting a user whose credentials can't be listed, got %v\n%v", plan.Errors, plan.Cmds)
+	}
+}
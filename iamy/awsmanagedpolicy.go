@@ -0,0 +1,102 @@
+package iamy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func isAwsManagedPolicyArn(arn string) bool {
+	return strings.Contains(arn, ":iam::aws:policy/")
+}
+
+// awsManagedPolicyArns returns the AWS managed policies the users, groups and
+// roles attach or have as their permissions boundary, sorted
+func (a *AccountData) awsManagedPolicyArns() []string {
+	refs := []string{}
+	for _, u := range a.Users {
+		refs = append(append(refs, u.Policies...), u.PermissionsBoundary)
+	}
+	for _, g := range a.Groups {
+		refs = append(refs, g.Policies...)
+	}
+	for _, r := range a.Roles {
+		refs = append(append(refs, r.Policies...), r.PermissionsBoundary)
+	}
+
+	arns := []string{}
+	for _, ref := range refs {
+		if isAwsManagedPolicyArn(ref) && !stringSliceContains(arns, ref) {
+			arns = append(arns, ref)
+		}
+	}
+	sort.Strings(arns)
+	return arns
+}
+
+// fetchAwsManagedPolicyVersions records the default version of each AWS
+// managed policy the fetched users, groups and roles refer to
+func (a *AwsFetcher) fetchAwsManagedPolicyVersions() error {
+	defer a.Timings.Track("iam aws managed policy versions")()
+
+	versions := map[string]string{}
+	for _, arn := range a.data.awsManagedPolicyArns() {
+		version, err := a.iam.getPolicyDefaultVersion(arn)
+		if isAccessDeniedError(err) {
+			a.warn(WarningAccessDenied, arn, fmt.Sprintf("Skipping AWS managed policy version: %s", err))
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error fetching the version of %s", arn)
+		}
+		versions[arn] = version
+	}
+	a.data.AwsManagedPolicyVersions = versions
+	return nil
+}
+
+// An AwsManagedPolicyUpdate is an AWS managed policy that AWS has changed
+// the default version of since it was recorded
+type AwsManagedPolicyUpdate struct {
+	Arn         string
+	FromVersion string
+	ToVersion   string
+}
+
+// AwsManagedPolicyUpdates returns the AWS managed policies whose default
+// version differs from the recorded one, sorted by ARN. Policies that weren't
+// recorded are new references rather than updates, so aren't included
+func AwsManagedPolicyUpdates(recorded, current map[string]string) []AwsManagedPolicyUpdate {
+	updates := []AwsManagedPolicyUpdate{}
+	for arn, version := range current {
+		if from, ok := recorded[arn]; ok && from != version {
+			updates = append(updates, AwsManagedPolicyUpdate{arn, from, version})
+		}
+	}
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].Arn < updates[j].Arn
+	})
+	return updates
+}
+
+// AwsManagedPolicyDiff returns the statements AWS removed and added in the
+// update, fetching both versions. AWS keeps every version of its managed
+// policies
+func (a *AwsFetcher) AwsManagedPolicyDiff(u AwsManagedPolicyUpdate) (string, error) {
+	from, err := a.iam.getPolicyVersionDocument(u.Arn, u.FromVersion)
+	if err != nil {
+		return "", errors.Wrapf(err, "Error fetching %s version %s", u.Arn, u.FromVersion)
+	}
+	to, err := a.iam.getPolicyVersionDocument(u.Arn, u.ToVersion)
+	if err != nil {
+		return "", errors.Wrapf(err, "Error fetching %s version %s", u.Arn, u.ToVersion)
+	}
+
+	name := u.Arn[strings.LastIndex(u.Arn, "/")+1:]
+	return policyDiff(
+		[]locatedPolicyDocument{{policy: name, doc: from}},
+		[]locatedPolicyDocument{{policy: name, doc: to}},
+	), nil
+}
@@ -0,0 +1,81 @@
+package iamy
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+type fakeIam struct {
+	iamiface.IAMAPI
+	defaultVersions map[string]string
+	documents       map[string]string
+}
+
+func (f *fakeIam) GetPolicy(input *iam.GetPolicyInput) (*iam.GetPolicyOutput, error) {
+	return &iam.GetPolicyOutput{Policy: &iam.Policy{DefaultVersionId: aws.String(f.defaultVersions[*input.PolicyArn])}}, nil
+}
+
+func (f *fakeIam) GetPolicyVersion(input *iam.GetPolicyVersionInput) (*iam.GetPolicyVersionOutput, error) {
+	doc := url.QueryEscape(f.documents[*input.PolicyArn+" "+*input.VersionId])
+	return &iam.GetPolicyVersionOutput{PolicyVersion: &iam.PolicyVersion{Document: aws.String(doc)}}, nil
+}
+
+func TestAwsManagedPolicyUpdates(t *testing.T) {
+	readOnly := "arn:aws:iam::aws:policy/ReadOnlyAccess"
+	boundary := "arn:aws:iam::aws:policy/PowerUserAccess"
+
+	data := NewAccountData("123")
+	data.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, Policies: []string{readOnly, "reader"}, PermissionsBoundary: boundary})
+	data.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, Policies: []string{readOnly}})
+
+	f := AwsFetcher{
+		iam: &iamClient{&fakeIam{
+			defaultVersions: map[string]string{readOnly: "v3", boundary: "v7"},
+			documents: map[string]string{
+				readOnly + " v2": `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`,
+				readOnly + " v3": `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:Get*","s3:List*"],"Resource":"*"}]}`,
+			},
+		}},
+		data: *data,
+	}
+	if err := f.fetchAwsManagedPolicyVersions(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{readOnly: "v3", boundary: "v7"}; !reflect.DeepEqual(f.data.AwsManagedPolicyVersions, expected) {
+		t.Errorf("Expected %v, got %v", expected, f.data.AwsManagedPolicyVersions)
+	}
+
+	recorded := map[string]string{readOnly: "v2", boundary: "v7", "arn:aws:iam::aws:policy/Unused": "v1"}
+	updates := AwsManagedPolicyUpdates(recorded, f.data.AwsManagedPolicyVersions)
+	if expected := []AwsManagedPolicyUpdate{{readOnly, "v2", "v3"}}; !reflect.DeepEqual(updates, expected) {
+		t.Fatalf("Expected %v, got %v", expected, updates)
+	}
+
+	diff, err := f.AwsManagedPolicyDiff(updates[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# ReadOnlyAccess
+- {
+-   "Action": "s3:Get*",
+-   "Effect": "Allow",
+-   "Resource": "*"
+- }
++ {
++   "Action": [
++     "s3:Get*",
++     "s3:List*"
++   ],
++   "Effect": "Allow",
++   "Resource": "*"
++ }
+`
+	if diff != expected {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expected, diff)
+	}
+}
@@ -2,7 +2,10 @@ package iamy
 
 import (
 	"log"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 )
 
@@ -22,3 +25,41 @@ func awsSession() *session.Session {
 
 	return sess
 }
+
+// fallbackAwsSession returns a session using the shared config profile, or
+// the default credentials if profile is empty, assuming roleArn if it's set
+func fallbackAwsSession(profile, roleArn string) (*session.Session, error) {
+	s, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           profile,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if roleArn != "" {
+		s = s.Copy(&aws.Config{Credentials: stscreds.NewCredentials(s, roleArn)})
+	}
+
+	return s, nil
+}
+
+// RoleCredentialsEnv returns a function returning the environment variables
+// that give the aws CLI the credentials of the role, assumed with the default
+// credentials and assumed again once they expire
+func RoleCredentialsEnv(roleArn string) func() ([]string, error) {
+	creds := stscreds.NewCredentials(awsSession(), roleArn, func(p *stscreds.AssumeRoleProvider) {
+		p.Duration = time.Hour
+	})
+	return func() ([]string, error) {
+		v, err := creds.Get()
+		if err != nil {
+			return nil, err
+		}
+		return []string{
+			"AWS_ACCESS_KEY_ID=" + v.AccessKeyID,
+			"AWS_SECRET_ACCESS_KEY=" + v.SecretAccessKey,
+			"AWS_SESSION_TOKEN=" + v.SessionToken,
+		}, nil
+	}
+}
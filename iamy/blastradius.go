@@ -0,0 +1,58 @@
+package iamy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A BlastRadius limits how much of an account one push may change, so an
+// empty or truncated checkout can't delete most of an account
+type BlastRadius struct {
+	// MaxDeletes is the most resources a plan may delete, negative for no
+	// limit
+	MaxDeletes int
+	// MaxChangePercent is the most of the resources in AWS, as a percentage,
+	// a plan may update, rename or delete, 0 for no limit. Creating resources
+	// leaves those in AWS as they are, so creates aren't counted
+	MaxChangePercent float64
+}
+
+// ErrBlastRadius is a plan that changes more of the account than the blast
+// radius allows. Reasons are the limits it exceeds
+type ErrBlastRadius struct {
+	Reasons []string
+}
+
+func (e *ErrBlastRadius) Error() string {
+	return "The plan changes more than push allows without --force:\n  " + strings.Join(e.Reasons, "\n  ")
+}
+
+// CheckBlastRadius returns an *ErrBlastRadius when the plan deletes or
+// changes more resources than the blast radius allows
+func (p *SyncPlan) CheckBlastRadius(b BlastRadius) error {
+	deletes, changes := 0, 0
+	for _, ch := range p.jsonPlan().Changes {
+		switch ch.Action {
+		case "delete":
+			deletes++
+			changes++
+		case "update", "rename":
+			changes++
+		}
+	}
+
+	reasons := []string{}
+	if b.MaxDeletes >= 0 && deletes > b.MaxDeletes {
+		reasons = append(reasons, fmt.Sprintf("%d resources would be deleted, more than the %d allowed", deletes, b.MaxDeletes))
+	}
+	if total := len(p.from.resources()); b.MaxChangePercent > 0 && total > 0 {
+		if percent := float64(changes) / float64(total) * 100; percent > b.MaxChangePercent {
+			reasons = append(reasons, fmt.Sprintf("%d of the %d resources in AWS (%.0f%%) would change, more than the %g%% allowed", changes, total, percent, b.MaxChangePercent))
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &ErrBlastRadius{reasons}
+	}
+	return nil
+}
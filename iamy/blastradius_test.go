@@ -0,0 +1,48 @@
+package iamy
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheckBlastRadius(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	for _, name := range []string{"reader", "writer", "admin", "auditor"} {
+		remoteData.addPolicy(&Policy{iamService: iamService{Name: name, Path: "/"}, Policy: doc})
+	}
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc})
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: doc})
+	plan := PlanSync(remoteData, localData)
+
+	cases := []struct {
+		blastRadius BlastRadius
+		reasons     []string
+	}{
+		{BlastRadius{MaxDeletes: -1}, nil},
+		{BlastRadius{MaxDeletes: 3, MaxChangePercent: 75}, nil},
+		{BlastRadius{MaxDeletes: 2}, []string{"3 resources would be deleted, more than the 2 allowed"}},
+		{BlastRadius{MaxDeletes: -1, MaxChangePercent: 50}, []string{"3 of the 4 resources in AWS (75%) would change, more than the 50% allowed"}},
+	}
+	for _, c := range cases {
+		err := plan.CheckBlastRadius(c.blastRadius)
+		var exceeded *ErrBlastRadius
+		if c.reasons == nil {
+			if err != nil {
+				t.Errorf("Expected %+v to allow the plan, got %v", c.blastRadius, err)
+			}
+			continue
+		}
+		if !errors.As(err, &exceeded) || len(exceeded.Reasons) != len(c.reasons) || exceeded.Reasons[0] != c.reasons[0] {
+			t.Errorf("Expected %+v to refuse the plan with %q, got %v", c.blastRadius, c.reasons, err)
+		}
+	}
+
+	// a new account is all creates, which any blast radius allows
+	if err := PlanSync(NewAccountData("123"), localData).CheckBlastRadius(BlastRadius{MaxDeletes: 0, MaxChangePercent: 1}); err != nil {
+		t.Errorf("Expected creates to be allowed, got %v", err)
+	}
+}
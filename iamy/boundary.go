@@ -0,0 +1,289 @@
+package iamy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A BoundaryFinding is an identity policy grant that a principal's
+// permissions boundary makes ineffective, or a permissions boundary that
+// doesn't restrict the principal
+type BoundaryFinding struct {
+	Principal string
+	Boundary  string
+	Statement *PolicyStatement
+	Problem   string
+}
+
+func (f BoundaryFinding) String() string {
+	if f.Statement == nil {
+		return fmt.Sprintf("%s (boundary %s): %s", f.Principal, f.Boundary, f.Problem)
+	}
+	return fmt.Sprintf("%s (boundary %s): %s %s", f.Principal, f.Boundary, f.Statement, f.Problem)
+}
+
+// globsOverlap returns whether some string matches both patterns, which may
+// use the IAM wildcards * and ?
+func globsOverlap(a, b string) bool {
+	switch {
+	case a == "" && b == "":
+		return true
+	case a != "" && a[0] == '*':
+		return globsOverlap(a[1:], b) || (b != "" && globsOverlap(a, b[1:]))
+	case b != "" && b[0] == '*':
+		return globsOverlap(a, b[1:]) || (a != "" && globsOverlap(a[1:], b))
+	case a == "" || b == "":
+		return false
+	}
+	return (a[0] == '?' || b[0] == '?' || a[0] == b[0]) && globsOverlap(a[1:], b[1:])
+}
+
+// globCovers returns whether every string matching pattern q also matches
+// pattern p
+func globCovers(p, q string) bool {
+	switch {
+	case p == "":
+		return q == ""
+	case p[0] == '*':
+		return globCovers(p[1:], q) || (q != "" && globCovers(p, q[1:]))
+	case q == "" || q[0] == '*':
+		return false
+	case q[0] == '?':
+		return p[0] == '?' && globCovers(p[1:], q[1:])
+	}
+	return (p[0] == '?' || p[0] == q[0]) && globCovers(p[1:], q[1:])
+}
+
+func statementActions(s PolicyStatement, key string) []string {
+	result := []string{}
+	for _, a := range conditionValues(s.data[key]) {
+		result = append(result, strings.ToLower(a))
+	}
+	return result
+}
+
+// actionOverlaps returns whether the statement applies to some of the
+// actions matching action
+func actionOverlaps(s PolicyStatement, action string) bool {
+	action = strings.ToLower(action)
+	if _, ok := s.data["NotAction"]; ok {
+		for _, p := range statementActions(s, "NotAction") {
+			if globCovers(p, action) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, p := range statementActions(s, "Action") {
+		if globsOverlap(p, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// actionCovers returns whether the statement applies to every action
+// matching action
+func actionCovers(s PolicyStatement, action string) bool {
+	action = strings.ToLower(action)
+	if _, ok := s.data["NotAction"]; ok {
+		for _, p := range statementActions(s, "NotAction") {
+			if globsOverlap(p, action) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, p := range statementActions(s, "Action") {
+		if globCovers(p, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceMatches returns whether the statement applies to the resource
+func resourceMatches(s PolicyStatement, arn string) bool {
+	if _, ok := s.data["NotResource"]; ok {
+		for _, p := range conditionValues(s.data["NotResource"]) {
+			if globsOverlap(p, arn) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, p := range conditionValues(s.data["Resource"]) {
+		if globsOverlap(p, arn) {
+			return true
+		}
+	}
+	return false
+}
+
+func isUnconditional(s PolicyStatement) bool {
+	return len(s.Conditions()) == 0
+}
+
+// A permissionsBoundary is the statements of a boundary policy. Resources
+// and conditions of its Allow statements aren't compared to those of identity
+// policies, so an action is only treated as outside the boundary if no Allow
+// mentions it at all, or an unconditional Deny on every resource covers it
+type permissionsBoundary struct {
+	allows []PolicyStatement
+	denies []PolicyStatement
+}
+
+func newPermissionsBoundary(statements []PolicyStatement) permissionsBoundary {
+	b := permissionsBoundary{}
+	for _, s := range statements {
+		if isAllow(s) {
+			b.allows = append(b.allows, s)
+		} else {
+			b.denies = append(b.denies, s)
+		}
+	}
+	return b
+}
+
+func (b permissionsBoundary) allowsAction(action string) bool {
+	for _, s := range b.allows {
+		if actionOverlaps(s, action) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b permissionsBoundary) deniesAction(action string) bool {
+	for _, s := range b.denies {
+		if actionCovers(s, action) && isUnconditional(s) && appliesToAllResources(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func appliesToAllResources(s PolicyStatement) bool {
+	return stringSliceContains(conditionValues(s.data["Resource"]), "*")
+}
+
+// allowsEverything returns whether the boundary allows every action on every
+// resource, and so restricts nothing
+func (b permissionsBoundary) allowsEverything() bool {
+	if len(b.denies) > 0 {
+		return false
+	}
+	for _, s := range b.allows {
+		if actionCovers(s, "*") && isUnconditional(s) && appliesToAllResources(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ineffectiveActions returns the actions an identity policy statement allows
+// that the boundary doesn't
+func (b permissionsBoundary) ineffectiveActions(s PolicyStatement) []string {
+	result := []string{}
+	for _, action := range conditionValues(s.data["Action"]) {
+		if !b.allowsAction(action) || b.deniesAction(action) {
+			result = append(result, action)
+		}
+	}
+	return result
+}
+
+// effectivelyAllows returns whether an unconditional statement of both the
+// identity policies and the boundary allows the action on the resource
+func (b permissionsBoundary) effectivelyAllows(identity []PolicyStatement, action, arn string) bool {
+	if b.deniesAction(action) {
+		return false
+	}
+	allowed := func(statements []PolicyStatement) bool {
+		for _, s := range statements {
+			if isAllow(s) && isUnconditional(s) && actionCovers(s, action) && resourceMatches(s, arn) {
+				return true
+			}
+		}
+		return false
+	}
+	return allowed(identity) && allowed(b.allows)
+}
+
+// boundaryEscapeActions are the actions that would let a principal remove or
+// replace its own permissions boundary
+var boundaryEscapeActions = map[string][]string{
+	"user": {"iam:DeleteUserPermissionsBoundary", "iam:PutUserPermissionsBoundary"},
+	"role": {"iam:DeleteRolePermissionsBoundary", "iam:PutRolePermissionsBoundary"},
+}
+
+type boundaryPrincipal struct {
+	kind       string
+	name       string
+	arn        string
+	boundary   string
+	statements []PolicyStatement
+}
+
+// BoundaryReport checks the users and roles with permissions boundaries,
+// intersecting the boundary with their identity policies. It reports identity
+// policy statements granting actions the boundary doesn't allow, which are
+// dead grants, and boundaries that don't restrict the principal because they
+// allow everything or the principal can remove them. Boundaries that aren't in
+// the account data, eg. AWS managed policies, are reported as unchecked
+func BoundaryReport(data *AccountData) []BoundaryFinding {
+	pp := newPrincipalPolicies(data)
+
+	principals := []boundaryPrincipal{}
+	for _, u := range data.Users {
+		if u.PermissionsBoundary != "" {
+			statements, _ := pp.userStatements(u)
+			principals = append(principals, boundaryPrincipal{"user", u.Name, data.Account.arnFor("user", u.Path, u.Name), u.PermissionsBoundary, statements})
+		}
+	}
+	for _, r := range data.Roles {
+		if r.PermissionsBoundary != "" {
+			statements, _ := pp.roleStatements(r)
+			principals = append(principals, boundaryPrincipal{"role", r.Name, data.Account.arnFor("role", r.Path, r.Name), r.PermissionsBoundary, statements})
+		}
+	}
+	sort.SliceStable(principals, func(i, j int) bool {
+		if principals[i].kind != principals[j].kind {
+			return principals[i].kind == "user"
+		}
+		return principals[i].name < principals[j].name
+	})
+
+	findings := []BoundaryFinding{}
+	for _, p := range principals {
+		principal := p.kind + " " + p.name
+		policy := pp.findPolicy(p.boundary)
+		if policy == nil {
+			findings = append(findings, BoundaryFinding{Principal: principal, Boundary: p.boundary, Problem: "boundary policy can't be checked, it isn't in the yaml files"})
+			continue
+		}
+		b := newPermissionsBoundary(pp.byDoc[policy.Policy])
+
+		if b.allowsEverything() {
+			findings = append(findings, BoundaryFinding{Principal: principal, Boundary: p.boundary, Problem: "boundary allows every action on every resource, so restricts nothing"})
+		}
+		for _, action := range boundaryEscapeActions[p.kind] {
+			if b.effectivelyAllows(p.statements, action, p.arn) {
+				findings = append(findings, BoundaryFinding{Principal: principal, Boundary: p.boundary, Problem: fmt.Sprintf("boundary can be removed by the %s with %s", p.kind, action)})
+			}
+		}
+
+		for _, s := range p.statements {
+			if !isAllow(s) {
+				continue
+			}
+			s := s
+			if dead := b.ineffectiveActions(s); len(dead) > 0 {
+				findings = append(findings, BoundaryFinding{principal, p.boundary, &s, "grants actions the boundary doesn't allow: " + strings.Join(dead, ", ")})
+			}
+		}
+	}
+
+	return findings
+}
@@ -0,0 +1,68 @@
+package iamy
+
+import "testing"
+
+func TestGlobs(t *testing.T) {
+	overlapping := [][2]string{{"s3:get*", "s3:*object"}, {"*", "iam:passrole"}, {"s3:getobject", "s3:getobject"}, {"ec2:?escribe*", "ec2:describeinstances"}}
+	for _, c := range overlapping {
+		if !globsOverlap(c[0], c[1]) || !globsOverlap(c[1], c[0]) {
+			t.Errorf("Expected %s and %s to overlap", c[0], c[1])
+		}
+	}
+	if globsOverlap("s3:get*", "s3:put*") {
+		t.Error("Expected s3:get* and s3:put* not to overlap")
+	}
+
+	if !globCovers("s3:*", "s3:get*") || !globCovers("*", "s3:getobject") {
+		t.Error("Expected s3:* and * to cover narrower patterns")
+	}
+	if globCovers("s3:get*", "s3:*") || globCovers("s3:get?bject", "s3:get*") {
+		t.Error("Expected narrower patterns not to cover wider ones")
+	}
+}
+
+func TestBoundaryReport(t *testing.T) {
+	boundary := `{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Action":["s3:*","iam:*"],"Resource":"*"},
+		{"Effect":"Deny","Action":"s3:DeleteBucket","Resource":"*"}]}`
+	allowAll := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`
+	developer := `{"Version":"2012-10-17","Statement":[
+		{"Sid":"S3","Effect":"Allow","Action":["s3:Get*","s3:DeleteBucket"],"Resource":"*"},
+		{"Sid":"Ec2","Effect":"Allow","Action":"ec2:*","Resource":"*"},
+		{"Sid":"Iam","Effect":"Allow","Action":"iam:Get*","Resource":"*"}]}`
+	escape := `{"Version":"2012-10-17","Statement":[{"Sid":"Escape","Effect":"Allow","Action":"iam:*PermissionsBoundary","Resource":"arn:aws:iam::123:role/*"}]}`
+
+	data := NewAccountData("123")
+	data.addPolicy(&Policy{iamService: iamService{Name: "boundary", Path: "/"}, Policy: mustPolicyDocument(t, boundary)})
+	data.addPolicy(&Policy{iamService: iamService{Name: "allow-all", Path: "/"}, Policy: mustPolicyDocument(t, allowAll)})
+	data.addPolicy(&Policy{iamService: iamService{Name: "developer", Path: "/"}, Policy: mustPolicyDocument(t, developer)})
+	data.addGroup(&Group{iamService: iamService{Name: "developers", Path: "/"}, Policies: []string{"developer"}})
+	data.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}, Groups: []string{"developers"}, PermissionsBoundary: "boundary"})
+	data.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, Groups: []string{"developers"}})
+	data.addUser(&User{iamService: iamService{Name: "carol", Path: "/"}, PermissionsBoundary: "arn:aws:iam::aws:policy/PowerUserAccess"})
+	data.addRole(&Role{
+		iamService:          iamService{Name: "deploy", Path: "/"},
+		InlinePolicies:      []InlinePolicy{{Name: "escape", Policy: mustPolicyDocument(t, escape)}},
+		PermissionsBoundary: "boundary",
+	})
+	data.addRole(&Role{iamService: iamService{Name: "admin", Path: "/"}, Policies: []string{"developer"}, PermissionsBoundary: "allow-all"})
+
+	findings := BoundaryReport(data)
+
+	expected := []string{
+		"user alice (boundary boundary): 123/iam/policy/developer.yaml Policy statement S3 grants actions the boundary doesn't allow: s3:DeleteBucket",
+		"user alice (boundary boundary): 123/iam/policy/developer.yaml Policy statement Ec2 grants actions the boundary doesn't allow: ec2:*",
+		"user carol (boundary arn:aws:iam::aws:policy/PowerUserAccess): boundary policy can't be checked, it isn't in the yaml files",
+		"role admin (boundary allow-all): boundary allows every action on every resource, so restricts nothing",
+		"role deploy (boundary boundary): boundary can be removed by the role with iam:DeleteRolePermissionsBoundary",
+		"role deploy (boundary boundary): boundary can be removed by the role with iam:PutRolePermissionsBoundary",
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("Expected %d findings, got %v", len(expected), findings)
+	}
+	for i, f := range findings {
+		if f.String() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], f.String())
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// BucketPolicyMandatesFileName is the file in the yaml directory that lists
+// the statements the organization requires in bucket policies
+const BucketPolicyMandatesFileName = ".iamy-bucket-policies.yaml"
+
+// A BucketPolicyTemplate is a named statement for a common bucket policy
+// pattern, generated for a bucket from its parameters
+type BucketPolicyTemplate struct {
+	Name        string
+	Description string
+	Params      []string
+
+	statement func(bucket string, params map[string]string) map[string]interface{}
+}
+
+func bucketArns(bucket string) []interface{} {
+	return []interface{}{"arn:aws:s3:::" + bucket, "arn:aws:s3:::" + bucket + "/*"}
+}
+
+// paramList splits a comma separated parameter into its values
+func paramList(value string) []interface{} {
+	values := []interface{}{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// BucketPolicyTemplates are the named statements, by name
+var BucketPolicyTemplates = []BucketPolicyTemplate{
+	{
+		Name:        "tls-only",
+		Description: "Denies requests that don't use TLS",
+		statement: func(bucket string, params map[string]string) map[string]interface{} {
+			return map[string]interface{}{
+				"Sid":       "DenyInsecureTransport",
+				"Effect":    "Deny",
+				"Principal": "*",
+				"Action":    "s3:*",
+				"Resource":  bucketArns(bucket),
+				"Condition": map[string]interface{}{"Bool": map[string]interface{}{"aws:SecureTransport": "false"}},
+			}
+		},
+	},
+	{
+		Name:        "bucket-owner-full-control",
+		Description: "Denies uploads that don't give the bucket owner full control of the object with the bucket-owner-full-control ACL",
+		statement: func(bucket string, params map[string]string) map[string]interface{} {
+			return map[string]interface{}{
+				"Sid":       "RequireBucketOwnerFullControl",
+				"Effect":    "Deny",
+				"Principal": "*",
+				"Action":    "s3:PutObject",
+				"Resource":  "arn:aws:s3:::" + bucket + "/*",
+				"Condition": map[string]interface{}{"StringNotEquals": map[string]interface{}{"s3:x-amz-acl": "bucket-owner-full-control"}},
+			}
+		},
+	},
+	{
+		Name:        "vpce-only",
+		Description: "Denies requests that don't come through the VPC endpoints in the vpce parameter, a comma separated list",
+		Params:      []string{"vpce"},
+		statement: func(bucket string, params map[string]string) map[string]interface{} {
+			return map[string]interface{}{
+				"Sid":       "DenyOutsideVpcEndpoints",
+				"Effect":    "Deny",
+				"Principal": "*",
+				"Action":    "s3:*",
+				"Resource":  bucketArns(bucket),
+				"Condition": map[string]interface{}{"StringNotEquals": map[string]interface{}{"aws:SourceVpce": paramList(params["vpce"])}},
+			}
+		},
+	},
+}
+
+// FindBucketPolicyTemplate returns the named template
+func FindBucketPolicyTemplate(name string) (*BucketPolicyTemplate, error) {
+	names := []string{}
+	for i, t := range BucketPolicyTemplates {
+		if t.Name == name {
+			return &BucketPolicyTemplates[i], nil
+		}
+		names = append(names, t.Name)
+	}
+	return nil, fmt.Errorf("There's no bucket policy template %s, use one of %s", name, strings.Join(names, ", "))
+}
+
+// Statement returns the template's statement for the bucket, which must have
+// every parameter the template needs
+func (t *BucketPolicyTemplate) Statement(bucket string, params map[string]string) (map[string]interface{}, error) {
+	for _, p := range t.Params {
+		if len(paramList(params[p])) == 0 {
+			return nil, fmt.Errorf("Bucket policy template %s needs the %s parameter", t.Name, p)
+		}
+	}
+	// round trip the statement through JSON, so it's normalised like the
+	// statements of policies read from the files
+	j, err := json.Marshal(t.statement(bucket, params))
+	if err != nil {
+		return nil, err
+	}
+	var s map[string]interface{}
+	if err = json.Unmarshal(j, &s); err != nil {
+		return nil, err
+	}
+	return recursivelyNormaliseAwsPolicy(s).(map[string]interface{}), nil
+}
+
+// BucketPolicyFromTemplates returns a bucket policy of the named templates'
+// statements for the bucket
+func BucketPolicyFromTemplates(bucket string, names []string, params map[string]string) (*PolicyDocument, error) {
+	statements := []interface{}{}
+	for _, name := range names {
+		t, err := FindBucketPolicyTemplate(name)
+		if err != nil {
+			return nil, err
+		}
+		s, err := t.Statement(bucket, params)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, s)
+	}
+	return &PolicyDocument{data: map[string]interface{}{"Version": "2012-10-17", "Statement": statements}}, nil
+}
+
+// patternsCover is true when every value matches one of the patterns, which
+// may use the policy wildcards * and ?, matching case insensitively
+func patternsCover(patterns, values []string) bool {
+Values:
+	for _, v := range values {
+		for _, p := range patterns {
+			pattern := strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(p))
+			if regexp.MustCompile("(?i)^" + pattern + "$").MatchString(v) {
+				continue Values
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// isAnyPrincipal is true for the principal "*" and {"AWS": "*"}
+func isAnyPrincipal(principal interface{}) bool {
+	if m, ok := principal.(map[string]interface{}); ok && len(m) == 1 {
+		principal = m["AWS"]
+	}
+	values := conditionValues(principal)
+	return len(values) == 1 && values[0] == "*"
+}
+
+// satisfies is true when the statement is at least as strict as the
+// template's deny statement: it denies everyone at least its actions on its
+// resources, with the same conditions, exempting no more values than it does
+func satisfies(s PolicyStatement, required map[string]interface{}) bool {
+	if s.data["Effect"] != required["Effect"] || !isAnyPrincipal(s.data["Principal"]) {
+		return false
+	}
+	if !patternsCover(conditionValues(s.data["Action"]), conditionValues(required["Action"])) ||
+		!patternsCover(conditionValues(s.data["Resource"]), conditionValues(required["Resource"])) {
+		return false
+	}
+
+	want := PolicyStatement{data: required}.Conditions()
+	have := s.Conditions()
+	if len(have) != len(want) {
+		return false
+	}
+	for i := range want {
+		if baseConditionOperator(have[i].Operator) != baseConditionOperator(want[i].Operator) ||
+			!strings.EqualFold(have[i].Key, want[i].Key) ||
+			len(have[i].Values) == 0 || len(stringSetDifference(have[i].Values, want[i].Values)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// A BucketPolicyMandate requires the template's statement in the policy of
+// every bucket matching one of Buckets, or of every bucket without them
+type BucketPolicyMandate struct {
+	Template string            `json:"Template"`
+	Params   map[string]string `json:"Params,omitempty"`
+	Buckets  []string          `json:"Buckets,omitempty"`
+}
+
+// BucketPolicyMandates are the statements the organization requires in
+// bucket policies. Buckets matching one of Exempt need none of them
+type BucketPolicyMandates struct {
+	Required []BucketPolicyMandate `json:"Required"`
+	Exempt   []string              `json:"Exempt,omitempty"`
+}
+
+// LoadBucketPolicyMandates reads and checks a mandates file
+func LoadBucketPolicyMandates(file string) (*BucketPolicyMandates, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := BucketPolicyMandates{}
+	if err = yaml.Unmarshal(data, &m); err != nil {
+		return nil, validationError(file, err)
+	}
+	if len(m.Required) == 0 {
+		return nil, validationError(file, errors.New("There are no Required statements"))
+	}
+	for _, r := range m.Required {
+		t, err := FindBucketPolicyTemplate(r.Template)
+		if err == nil {
+			_, err = t.Statement("bucket", r.Params)
+		}
+		if err != nil {
+			return nil, validationError(file, err)
+		}
+	}
+	return &m, nil
+}
+
+func bucketMatches(patterns []string, bucket string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, bucket); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// A BucketPolicyFinding is a bucket policy missing a mandated statement
+type BucketPolicyFinding struct {
+	File     string
+	Bucket   string
+	Template string
+
+	bucketPolicy *BucketPolicy
+	statement    map[string]interface{}
+}
+
+func (f BucketPolicyFinding) String() string {
+	return fmt.Sprintf("%s: bucket %s has no %s statement", f.File, f.Bucket, f.Template)
+}
+
+// BucketPolicyReport returns the mandated statements missing from the
+// policies of the account's buckets, ordered by bucket
+func BucketPolicyReport(data *AccountData, mandates *BucketPolicyMandates) ([]BucketPolicyFinding, error) {
+	buckets := append([]*BucketPolicy{}, data.BucketPolicies...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].BucketName < buckets[j].BucketName })
+
+	statements := newPrincipalPolicies(data).byDoc
+	findings := []BucketPolicyFinding{}
+	for _, bp := range buckets {
+		if bucketMatches(mandates.Exempt, bp.BucketName) {
+			continue
+		}
+	Mandates:
+		for _, r := range mandates.Required {
+			if len(r.Buckets) > 0 && !bucketMatches(r.Buckets, bp.BucketName) {
+				continue
+			}
+			t, err := FindBucketPolicyTemplate(r.Template)
+			if err != nil {
+				return nil, err
+			}
+			required, err := t.Statement(bp.BucketName, r.Params)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range statements[bp.Policy] {
+				if satisfies(s, required) {
+					continue Mandates
+				}
+			}
+			findings = append(findings, BucketPolicyFinding{data.ResourceFile(bp), bp.BucketName, t.Name, bp, required})
+		}
+	}
+	return findings, nil
+}
+
+// AddMissingStatements adds the statements the findings are missing to their
+// bucket policies, creating the policies of buckets without one, and returns
+// the bucket policies it changed
+func AddMissingStatements(findings []BucketPolicyFinding) []AwsResource {
+	changed := []AwsResource{}
+	seen := map[*BucketPolicy]bool{}
+	for _, f := range findings {
+		if f.bucketPolicy.Policy == nil || f.bucketPolicy.Policy.value() == nil {
+			f.bucketPolicy.Policy = &PolicyDocument{data: map[string]interface{}{"Version": "2012-10-17"}}
+		}
+		doc, ok := f.bucketPolicy.Policy.value().(map[string]interface{})
+		if !ok {
+			continue
+		}
+		statements := []interface{}{}
+		for _, s := range f.bucketPolicy.Policy.statements() {
+			statements = append(statements, s)
+		}
+		doc["Statement"] = append(statements, f.statement)
+		if !seen[f.bucketPolicy] {
+			seen[f.bucketPolicy] = true
+			changed = append(changed, f.bucketPolicy)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,74 @@
+package iamy
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBucketPolicyFromTemplates(t *testing.T) {
+	doc, err := BucketPolicyFromTemplates("logs", []string{"tls-only", "vpce-only"}, map[string]string{"vpce": "vpce-1, vpce-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, _ := json.Marshal(doc)
+	expected := `{"Statement":[{"Action":"s3:*","Condition":{"Bool":{"aws:SecureTransport":"false"}},"Effect":"Deny","Principal":"*","Resource":["arn:aws:s3:::logs","arn:aws:s3:::logs/*"],"Sid":"DenyInsecureTransport"},{"Action":"s3:*","Condition":{"StringNotEquals":{"aws:SourceVpce":["vpce-1","vpce-2"]}},"Effect":"Deny","Principal":"*","Resource":["arn:aws:s3:::logs","arn:aws:s3:::logs/*"],"Sid":"DenyOutsideVpcEndpoints"}],"Version":"2012-10-17"}`
+	if string(j) != expected {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expected, j)
+	}
+
+	if _, err := BucketPolicyFromTemplates("logs", []string{"vpce-only"}, nil); err == nil || !strings.Contains(err.Error(), "needs the vpce parameter") {
+		t.Errorf("Expected the missing parameter to be an error, got %v", err)
+	}
+	if _, err := BucketPolicyFromTemplates("logs", []string{"tls"}, nil); err == nil {
+		t.Error("Expected an unknown template to be an error")
+	}
+}
+
+func TestBucketPolicyReport(t *testing.T) {
+	data := NewAccountData("myalias-123")
+	data.BucketPolicies = []*BucketPolicy{
+		{
+			BucketName: "assets",
+			Policy:     mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":{"AWS":"*"},"Action":"*","Resource":"arn:aws:s3:::*","Condition":{"Bool":{"aws:SecureTransport":false}}}]}`),
+		},
+		{
+			BucketName: "data-lake",
+			Policy:     mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:*","Resource":["arn:aws:s3:::data-lake","arn:aws:s3:::data-lake/*"],"Condition":{"StringNotEquals":{"aws:SourceVpce":["vpce-1","vpce-9"]}}}]}`),
+		},
+		{BucketName: "public-site"},
+		{BucketName: "uploads"},
+	}
+	mandates := &BucketPolicyMandates{
+		Required: []BucketPolicyMandate{
+			{Template: "tls-only"},
+			{Template: "vpce-only", Params: map[string]string{"vpce": "vpce-1,vpce-2"}, Buckets: []string{"data-*"}},
+		},
+		Exempt: []string{"public-*"},
+	}
+
+	findings, err := BucketPolicyReport(data, mandates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := []string{}
+	for _, f := range findings {
+		actual = append(actual, f.String())
+	}
+	expected := []string{
+		"myalias-123/s3/data-lake.yaml: bucket data-lake has no tls-only statement",
+		"myalias-123/s3/data-lake.yaml: bucket data-lake has no vpce-only statement",
+		"myalias-123/s3/uploads.yaml: bucket uploads has no tls-only statement",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+
+	if changed := AddMissingStatements(findings); len(changed) != 2 {
+		t.Errorf("Expected 2 changed bucket policies, got %d", len(changed))
+	}
+	if findings, _ = BucketPolicyReport(data, mandates); len(findings) != 0 {
+		t.Errorf("Expected no findings once the statements are added, got %v", findings)
+	}
+}
@@ -0,0 +1,118 @@
+package iamy
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// SortCanonically puts the account data in its canonical order, so data
+// fetched or loaded in any order is dumped and compared the same way:
+//   - resources of each type by path and name
+//   - the groups, policies and roles resources are attached to by name
+//   - inline policies by name, and bucket ACL grants by grantee
+//   - policy statements by Sid, then by their normalised JSON
+//
+// Tags and the keys of policy documents are maps, which are always written
+// with their keys sorted
+func (a *AccountData) SortCanonically() {
+	sortResources(a.Users)
+	sortResources(a.Groups)
+	sortResources(a.Roles)
+	sortResources(a.Policies)
+	sortResources(a.InstanceProfiles)
+	sortResources(a.BucketPolicies)
+	sortResources(a.CodeArtifactDomainPolicies)
+	sortResources(a.CodeArtifactRepositoryPolicies)
+	sortResources(a.SesIdentityPolicies)
+	sortResources(a.RestApiPolicies)
+	sortResources(a.AccessPoints)
+	sortResources(a.ObjectLambdaAccessPoints)
+	sortResources(a.GlacierVaultPolicies)
+	sortResources(a.MultiRegionAccessPoints)
+	sortResources(a.EcrRegistryPolicies)
+
+	for _, u := range a.Users {
+		sort.Strings(u.Groups)
+		sort.Strings(u.Policies)
+		sortInlinePolicies(u.InlinePolicies)
+	}
+	for _, g := range a.Groups {
+		sort.Strings(g.Policies)
+		sortInlinePolicies(g.InlinePolicies)
+	}
+	for _, r := range a.Roles {
+		sort.Strings(r.Policies)
+		sortInlinePolicies(r.InlinePolicies)
+	}
+	for _, p := range a.InstanceProfiles {
+		sort.Strings(p.Roles)
+	}
+	for _, bp := range a.BucketPolicies {
+		if bp.Acl != nil {
+			sortBucketGrants(bp.Acl.Grants)
+		}
+	}
+	for _, p := range a.SesIdentityPolicies {
+		sortInlinePolicies(p.Policies)
+	}
+	for _, d := range a.policyDocuments() {
+		d.doc.sortStatements()
+	}
+}
+
+// sortResources sorts a slice of resources of one type by path and name
+func sortResources(resources interface{}) {
+	v := reflect.ValueOf(resources)
+	key := func(i int) string {
+		return resourceKey(v.Index(i).Interface().(AwsResource))
+	}
+	sort.SliceStable(resources, func(i, j int) bool { return key(i) < key(j) })
+}
+
+func sortInlinePolicies(policies []InlinePolicy) {
+	sort.SliceStable(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+}
+
+// sortStatements sorts the statements of the policy document by Sid, then by
+// their normalised JSON, which statements without a Sid are ordered by
+func (p *PolicyDocument) sortStatements() {
+	if p == nil {
+		return
+	}
+	// a document that wasn't parsed is kept unparsed once it's sorted
+	if !p.parsed() {
+		defer p.compact()
+	}
+	doc, ok := p.value().(map[string]interface{})
+	if !ok {
+		return
+	}
+	statements, ok := doc["Statement"].([]interface{})
+	if !ok || len(statements) < 2 {
+		return
+	}
+
+	type sortable struct {
+		sid, json string
+		statement interface{}
+	}
+	keyed := make([]sortable, len(statements))
+	for i, s := range statements {
+		keyed[i].statement = s
+		if m, ok := s.(map[string]interface{}); ok {
+			keyed[i].sid, _ = m["Sid"].(string)
+		}
+		b, _ := json.Marshal(recursivelyNormaliseAwsPolicy(s))
+		keyed[i].json = string(b)
+	}
+	sort.SliceStable(keyed, func(i, j int) bool {
+		if keyed[i].sid != keyed[j].sid {
+			return keyed[i].sid < keyed[j].sid
+		}
+		return keyed[i].json < keyed[j].json
+	})
+	for i := range keyed {
+		statements[i] = keyed[i].statement
+	}
+}
@@ -0,0 +1,64 @@
+package iamy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortCanonically(t *testing.T) {
+	build := func(reversed bool) *AccountData {
+		data := NewAccountData("myalias-123")
+		roles := []*Role{
+			{
+				iamService: iamService{Name: "app", Path: "/"},
+				Policies:   []string{"b", "a"},
+				InlinePolicies: []InlinePolicy{
+					{Name: "write", Policy: mustPolicyDocument(t, `{"Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"},{"Sid":"Read","Effect":"Allow","Action":"s3:GetObject","Resource":"*"},{"Effect":"Allow","Action":"s3:DeleteObject","Resource":"*"}]}`)},
+					{Name: "read", Policy: mustPolicyDocument(t, `{"Statement":{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}}`)},
+				},
+			},
+			{iamService: iamService{Name: "admin", Path: "/ops/"}},
+			{iamService: iamService{Name: "admin", Path: "/"}},
+		}
+		if reversed {
+			for i, j := 0, len(roles)-1; i < j; i, j = i+1, j-1 {
+				roles[i], roles[j] = roles[j], roles[i]
+			}
+			ips := roles[2].InlinePolicies
+			ips[0], ips[1] = ips[1], ips[0]
+			roles[2].Policies = []string{"a", "b"}
+		}
+		for _, r := range roles {
+			data.addRole(r)
+		}
+		data.SortCanonically()
+		return data
+	}
+
+	data := build(false)
+	names := []string{}
+	for _, r := range data.Roles {
+		names = append(names, r.ResourcePath()+r.ResourceName())
+	}
+	if !reflect.DeepEqual(names, []string{"/admin", "/app", "/ops/admin"}) {
+		t.Errorf("Expected the roles sorted by path and name, got %v", names)
+	}
+	app := data.Roles[1]
+	if !reflect.DeepEqual(app.Policies, []string{"a", "b"}) || app.InlinePolicies[0].Name != "read" {
+		t.Errorf("Expected the role's policies sorted, got %v and %v", app.Policies, app.InlinePolicies)
+	}
+	actions := []string{}
+	for _, s := range app.InlinePolicies[1].Policy.statements() {
+		actions = append(actions, s["Action"].(string))
+	}
+	if !reflect.DeepEqual(actions, []string{"s3:DeleteObject", "s3:PutObject", "s3:GetObject"}) {
+		t.Errorf("Expected the statements without a Sid first, then by Sid, got %v", actions)
+	}
+
+	other := build(true)
+	for i := range data.Roles {
+		if a, b := resourceJson(data.Roles[i]), resourceJson(other.Roles[i]); a != b {
+			t.Errorf("Expected the same role in either order, got %s and %s", a, b)
+		}
+	}
+}
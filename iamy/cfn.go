@@ -15,21 +15,33 @@ import (
 
 var cfnResourceRegexp = regexp.MustCompile(`-[A-Z0-9]{10,20}$`)
 
+// CloudFormation tags the resources it creates with their stack name
+const cloudformationStackNameTag = "aws:cloudformation:stack-name"
+
 type CfnResourceType string
 
 const (
-	CfnIamPolicy       = "AWS::IAM::Policy"
-	CfnIamRole         = "AWS::IAM::Role"
-	CfnIamUser         = "AWS::IAM::User"
-	CfnIamGroup        = "AWS::IAM::Group"
-	CfnInstanceProfile = "AWS::IAM::InstanceProfile"
-	CfnS3Bucket        = "AWS::S3::Bucket"
-	UpperCaseLetters   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	CfnIamPolicy              = "AWS::IAM::Policy"
+	CfnIamRole                = "AWS::IAM::Role"
+	CfnIamUser                = "AWS::IAM::User"
+	CfnIamGroup               = "AWS::IAM::Group"
+	CfnInstanceProfile        = "AWS::IAM::InstanceProfile"
+	CfnS3Bucket               = "AWS::S3::Bucket"
+	CfnCodeArtifactDomain     = "AWS::CodeArtifact::Domain"
+	CfnCodeArtifactRepository = "AWS::CodeArtifact::Repository"
+	CfnSesEmailIdentity       = "AWS::SES::EmailIdentity"
+	CfnApiGatewayRestApi      = "AWS::ApiGateway::RestApi"
+	CfnS3AccessPoint          = "AWS::S3::AccessPoint"
+	CfnS3ObjectLambda         = "AWS::S3ObjectLambda::AccessPoint"
+	CfnS3MultiRegion          = "AWS::S3::MultiRegionAccessPoint"
+	UpperCaseLetters          = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 )
 
 type cfnClient struct {
 	cloudformationiface.CloudFormationAPI
 	managedResources map[string]CfnResourceTypes
+	// stackNames is the stack that manages each managed resource
+	stackNames map[string]string
 }
 
 func newCfnClient(sess *session.Session) *cfnClient {
@@ -42,6 +54,7 @@ func newCfnClient(sess *session.Session) *cfnClient {
 // resources that are managed by cloudformation. This list can then be checked by IsManagedResource
 func (c *cfnClient) PopulateMangedResourceData() error {
 	c.managedResources = map[string]CfnResourceTypes{}
+	c.stackNames = map[string]string{}
 	var nextStack *string
 
 	for {
@@ -108,6 +121,7 @@ func (c *cfnClient) PopulateMangedResourceData() error {
 					}
 
 					c.managedResources[name] = append(c.managedResources[name], resType)
+					c.stackNames[name] = *stack.StackName
 				}
 
 				nextResource = resources.NextToken
@@ -145,9 +159,20 @@ func (c *cfnClient) IsManagedResource(cfnType CfnResourceType, resourceIdentifie
 	return false
 }
 
+// StackName returns the stack managing the resource, which is only known if
+// PopulateMangedResourceData has been called
+func (c *cfnClient) StackName(cfnType CfnResourceType, resourceIdentifier string) string {
+	if !c.managedResources[resourceIdentifier].contains(cfnType) {
+		return ""
+	}
+	return c.stackNames[resourceIdentifier]
+}
+
 func (r CfnResourceType) isInterestingResource() bool {
 	switch r {
-	case CfnIamPolicy, CfnIamRole, CfnIamUser, CfnIamGroup, CfnInstanceProfile, CfnS3Bucket:
+	case CfnIamPolicy, CfnIamRole, CfnIamUser, CfnIamGroup, CfnInstanceProfile, CfnS3Bucket,
+		CfnCodeArtifactDomain, CfnCodeArtifactRepository, CfnSesEmailIdentity, CfnApiGatewayRestApi,
+		CfnS3AccessPoint, CfnS3ObjectLambda, CfnS3MultiRegion:
 		return true
 	}
 
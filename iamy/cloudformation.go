@@ -0,0 +1,270 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CfnMaxResources is how many resources a CloudFormation template can have
+const CfnMaxResources = 500
+
+const (
+	cfnIamManagedPolicy = "AWS::IAM::ManagedPolicy"
+	cfnS3BucketPolicy   = "AWS::S3::BucketPolicy"
+)
+
+// cfnResource is a CloudFormation resource, with the identifier to import it
+// by
+type cfnResource struct {
+	logicalId  string
+	Type       string                 `json:"Type"`
+	Deletion   string                 `json:"DeletionPolicy"`
+	Replace    string                 `json:"UpdateReplacePolicy"`
+	Properties map[string]interface{} `json:"Properties"`
+	identifier map[string]string
+}
+
+type cfnInlinePolicy struct {
+	PolicyName     string          `json:"PolicyName"`
+	PolicyDocument *PolicyDocument `json:"PolicyDocument"`
+}
+
+type cfnTag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+var cfnLogicalIdInvalid = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// cloudFormationExporter converts account data to CloudFormation resources,
+// with logical ids unique across the templates. Resources refer to each other
+// by name and ARN rather than Ref, so they can be split between templates
+type cloudFormationExporter struct {
+	data       *AccountData
+	resources  []cfnResource
+	logicalIds map[string]bool
+	warnings   Warnings
+}
+
+// logicalId returns a logical id no other resource has, from the resource
+// kind and name, eg. RoleAppServer for the role app-server
+func (e *cloudFormationExporter) logicalId(kind, name string) string {
+	id := kind
+	for _, word := range cfnLogicalIdInvalid.Split(name, -1) {
+		if word != "" {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	if len(id) > 240 {
+		id = id[:240]
+	}
+	unique := id
+	for i := 2; e.logicalIds[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", id, i)
+	}
+	e.logicalIds[unique] = true
+	return unique
+}
+
+func (e *cloudFormationExporter) add(kind, name, resourceType string, identifier map[string]string, properties map[string]interface{}) {
+	e.resources = append(e.resources, cfnResource{
+		logicalId:  e.logicalId(kind, name),
+		Type:       resourceType,
+		Deletion:   "Retain",
+		Replace:    "Retain",
+		Properties: properties,
+		identifier: identifier,
+	})
+}
+
+func (e *cloudFormationExporter) policyArns(refs []string) []string {
+	arns := []string{}
+	for _, ref := range refs {
+		arns = append(arns, e.data.Account.policyArnFromString(ref))
+	}
+	return arns
+}
+
+// principalProperties sets the inline policies, managed policies and
+// permissions boundary properties of a user, group or role
+func (e *cloudFormationExporter) principalProperties(properties map[string]interface{}, inline []InlinePolicy, managed []string, boundary string) {
+	if len(inline) > 0 {
+		policies := []cfnInlinePolicy{}
+		for _, p := range inline {
+			policies = append(policies, cfnInlinePolicy{p.Name, p.Policy})
+		}
+		properties["Policies"] = policies
+	}
+	if len(managed) > 0 {
+		properties["ManagedPolicyArns"] = e.policyArns(managed)
+	}
+	if boundary != "" {
+		properties["PermissionsBoundary"] = e.data.Account.policyArnFromString(boundary)
+	}
+}
+
+func cfnTags(tags map[string]string) []cfnTag {
+	result := []cfnTag{}
+	for k, v := range tags {
+		result = append(result, cfnTag{k, v})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+func (e *cloudFormationExporter) export() {
+	a := e.data
+	for _, p := range a.Policies {
+		properties := map[string]interface{}{"ManagedPolicyName": p.Name, "Path": p.Path, "PolicyDocument": p.Policy}
+		if p.Description != "" {
+			properties["Description"] = p.Description
+		}
+		if len(p.Tags) > 0 {
+			e.warnings.Add(WarningExport, Arn(p, a.Account), "CloudFormation managed policies have no tags, the tags aren't exported")
+		}
+		e.add("Policy", p.Name, cfnIamManagedPolicy, map[string]string{"PolicyArn": Arn(p, a.Account)}, properties)
+	}
+
+	for _, g := range a.Groups {
+		properties := map[string]interface{}{"GroupName": g.Name, "Path": g.Path}
+		e.principalProperties(properties, g.InlinePolicies, g.Policies, "")
+		e.add("Group", g.Name, CfnIamGroup, map[string]string{"GroupName": g.Name}, properties)
+	}
+
+	for _, u := range a.Users {
+		properties := map[string]interface{}{"UserName": u.Name, "Path": u.Path}
+		if len(u.Groups) > 0 {
+			properties["Groups"] = u.Groups
+		}
+		if len(u.Tags) > 0 {
+			properties["Tags"] = cfnTags(u.Tags)
+		}
+		e.principalProperties(properties, u.InlinePolicies, u.Policies, u.PermissionsBoundary)
+		e.add("User", u.Name, CfnIamUser, map[string]string{"UserName": u.Name}, properties)
+	}
+
+	for _, r := range a.Roles {
+		properties := map[string]interface{}{"RoleName": r.Name, "Path": r.Path, "AssumeRolePolicyDocument": r.AssumeRolePolicyDocument}
+		if r.Description != "" {
+			properties["Description"] = r.Description
+		}
+		if r.MaxSessionDuration > 0 {
+			properties["MaxSessionDuration"] = r.MaxSessionDuration
+		}
+		e.principalProperties(properties, r.InlinePolicies, r.Policies, r.PermissionsBoundary)
+		e.add("Role", r.Name, CfnIamRole, map[string]string{"RoleName": r.Name}, properties)
+	}
+
+	for _, ip := range a.InstanceProfiles {
+		if len(ip.Roles) == 0 {
+			e.warnings.Add(WarningExport, Arn(ip, a.Account), "CloudFormation instance profiles must have a role, not exported")
+			continue
+		}
+		properties := map[string]interface{}{"InstanceProfileName": ip.Name, "Path": ip.Path, "Roles": ip.Roles}
+		e.add("InstanceProfile", ip.Name, CfnInstanceProfile, map[string]string{"InstanceProfileName": ip.Name}, properties)
+	}
+
+	for _, bp := range a.BucketPolicies {
+		if bp.PublicAccessBlock != nil || bp.Acl != nil || len(bp.Tags) > 0 {
+			e.warnings.Add(WarningExport, "s3/"+bp.BucketName, "Only the bucket policy is exported, not its public access block, ACL or tags")
+		}
+		if bp.Policy == nil {
+			continue
+		}
+		e.add("BucketPolicy", bp.BucketName, cfnS3BucketPolicy, map[string]string{"Bucket": bp.BucketName}, map[string]interface{}{"Bucket": bp.BucketName, "PolicyDocument": bp.Policy})
+	}
+
+	for _, r := range a.resources() {
+		switch r.(type) {
+		case *User, *Group, *Role, *Policy, *InstanceProfile, *BucketPolicy:
+			continue
+		}
+		e.warnings.Add(WarningExport, resourceKey(r), "Not exported, only IAM resources and bucket policies are")
+	}
+}
+
+// A CloudFormationTemplate is a template of exported resources, all retained
+// when they're removed from the stack, as CloudFormation resource import
+// requires
+type CloudFormationTemplate struct {
+	Description string
+	resources   []cfnResource
+}
+
+// WriteTemplate writes the template as JSON
+func (t CloudFormationTemplate) WriteTemplate(w io.Writer) error {
+	resources := map[string]cfnResource{}
+	for _, r := range t.resources {
+		resources[r.logicalId] = r
+	}
+	return writeCfnJson(w, map[string]interface{}{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Description":              t.Description,
+		"Resources":                resources,
+	})
+}
+
+// WriteResourcesToImport writes the resources to import into a stack created
+// from the template, for the --resources-to-import of aws cloudformation
+// create-change-set --change-set-type IMPORT
+func (t CloudFormationTemplate) WriteResourcesToImport(w io.Writer) error {
+	type resourceToImport struct {
+		ResourceType       string            `json:"ResourceType"`
+		LogicalResourceId  string            `json:"LogicalResourceId"`
+		ResourceIdentifier map[string]string `json:"ResourceIdentifier"`
+	}
+	imports := []resourceToImport{}
+	for _, r := range t.resources {
+		imports = append(imports, resourceToImport{r.Type, r.logicalId, r.identifier})
+	}
+	return writeCfnJson(w, imports)
+}
+
+func writeCfnJson(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// A CloudFormationExport is the account's users, groups, roles, managed
+// policies, instance profiles and bucket policies as CloudFormation
+// templates, split so no template has more than the maximum resources.
+// Warnings are the resources CloudFormation can't represent
+type CloudFormationExport struct {
+	Account   *Account
+	Templates []CloudFormationTemplate
+	Warnings  Warnings
+}
+
+// ExportCloudFormation converts the account data to CloudFormation templates
+// of at most maxResources resources each
+func ExportCloudFormation(data *AccountData, maxResources int) (*CloudFormationExport, error) {
+	if maxResources < 1 || maxResources > CfnMaxResources {
+		return nil, fmt.Errorf("A CloudFormation template can have 1 to %d resources, not %d", CfnMaxResources, maxResources)
+	}
+	e := cloudFormationExporter{
+		data:       data,
+		logicalIds: map[string]bool{},
+	}
+	e.export()
+
+	x := CloudFormationExport{Account: data.Account, Templates: []CloudFormationTemplate{}, Warnings: e.warnings}
+	parts := (len(e.resources) + maxResources - 1) / maxResources
+	for i := 0; i < parts; i++ {
+		end := (i + 1) * maxResources
+		if end > len(e.resources) {
+			end = len(e.resources)
+		}
+		description := fmt.Sprintf("Exported by iamy from account %s", data.Account)
+		if parts > 1 {
+			description += fmt.Sprintf(", part %d of %d", i+1, parts)
+		}
+		x.Templates = append(x.Templates, CloudFormationTemplate{description, e.resources[i*maxResources : end]})
+	}
+	return &x, nil
+}
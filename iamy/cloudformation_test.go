@@ -0,0 +1,104 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExportCloudFormation(t *testing.T) {
+	selfService := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"iam:ChangePassword","Resource":"arn:aws:iam::*:user/${aws:username}"}]}`
+	trust := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":{"Service":"ec2.amazonaws.com"}}]}`
+
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{iamService: iamService{Name: "self-service", Path: "/people/"}, Policy: mustPolicyDocument(t, selfService)})
+	data.addGroup(&Group{iamService: iamService{Name: "developers", Path: "/"}, Policies: []string{"people/self-service"}})
+	data.addUser(&User{iamService: iamService{Name: "alice.smith", Path: "/"}, Groups: []string{"developers"}, Tags: map[string]string{"team": "payments"}})
+	data.addRole(&Role{iamService: iamService{Name: "app-server", Path: "/"}, AssumeRolePolicyDocument: mustPolicyDocument(t, trust), InlinePolicies: []InlinePolicy{{Name: "self", Policy: mustPolicyDocument(t, selfService)}}})
+	data.addInstanceProfile(&InstanceProfile{iamService: iamService{Name: "app-server", Path: "/"}, Roles: []string{"app-server"}})
+	data.addResource(&EcrRegistryPolicy{Region: "ap-southeast-2", Policy: mustPolicyDocument(t, trust)})
+
+	x, err := ExportCloudFormation(data, CfnMaxResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Templates) != 1 {
+		t.Fatalf("Expected one template, got %d", len(x.Templates))
+	}
+	var b bytes.Buffer
+	if err = x.Templates[0].WriteTemplate(&b); err != nil {
+		t.Fatal(err)
+	}
+	var template struct {
+		Resources map[string]struct {
+			Type           string
+			DeletionPolicy string
+			Properties     map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(b.Bytes(), &template); err != nil {
+		t.Fatal(err)
+	}
+	if len(template.Resources) != 5 {
+		t.Fatalf("Expected 5 resources, got %s", b.String())
+	}
+	role := template.Resources["RoleAppServer"]
+	if role.Type != "AWS::IAM::Role" || role.DeletionPolicy != "Retain" || role.Properties["RoleName"] != "app-server" {
+		t.Errorf("Unexpected role %+v", role)
+	}
+	if p := template.Resources["GroupDevelopers"].Properties["ManagedPolicyArns"]; len(p.([]interface{})) != 1 || p.([]interface{})[0] != "arn:aws:iam::123:policy/people/self-service" {
+		t.Errorf("Expected the group's managed policy by ARN, got %v", p)
+	}
+	for _, s := range []string{`"Resource": "arn:aws:iam::*:user/${aws:username}"`, `"PolicyName": "self"`, `"Key": "team"`, `"InstanceProfileName": "app-server"`} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Expected the template to contain %s, got\n%s", s, b.String())
+		}
+	}
+
+	b.Reset()
+	if err = x.Templates[0].WriteResourcesToImport(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"ResourceType": "AWS::IAM::ManagedPolicy",
+    "LogicalResourceId": "PolicySelfService",
+    "ResourceIdentifier": {
+      "PolicyArn": "arn:aws:iam::123:policy/people/self-service"
+    }`) {
+		t.Errorf("Expected the managed policy to be imported by ARN, got\n%s", b.String())
+	}
+
+	if len(x.Warnings) != 1 || x.Warnings[0].Category != WarningExport {
+		t.Errorf("Expected a warning that the ECR registry policy isn't exported, got %v", x.Warnings)
+	}
+}
+
+func TestExportCloudFormationSplitsTemplates(t *testing.T) {
+	data := NewAccountData("123")
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		data.addGroup(&Group{iamService: iamService{Name: name, Path: "/"}})
+	}
+	x, err := ExportCloudFormation(data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Templates) != 3 || len(x.Templates[2].resources) != 1 || x.Templates[2].Description != "Exported by iamy from account 123, part 3 of 3" {
+		t.Errorf("Expected the groups to be split between 3 templates, got %+v", x.Templates)
+	}
+	if _, err := ExportCloudFormation(data, CfnMaxResources+1); err == nil {
+		t.Error("Expected an error for more resources than a template can have")
+	}
+}
+
+func TestCloudFormationLogicalIdsAreUnique(t *testing.T) {
+	e := cloudFormationExporter{logicalIds: map[string]bool{}}
+	for _, c := range []struct{ name, expected string }{
+		{"app-server", "RoleAppServer"},
+		{"app.server", "RoleAppServer2"},
+		{"123_deploy", "Role123Deploy"},
+	} {
+		if id := e.logicalId("Role", c.name); id != c.expected {
+			t.Errorf("Expected %s to be %s, got %s", c.name, c.expected, id)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package iamy
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codeartifact"
+	"github.com/aws/aws-sdk-go/service/codeartifact/codeartifactiface"
+)
+
+type codeArtifactClient struct {
+	sess    *session.Session
+	clients map[string]codeartifactiface.CodeArtifactAPI
+	mutex   sync.Mutex
+}
+
+func newCodeArtifactClient(sess *session.Session) *codeArtifactClient {
+	return &codeArtifactClient{
+		sess:    sess,
+		clients: map[string]codeartifactiface.CodeArtifactAPI{},
+	}
+}
+
+func (c *codeArtifactClient) withRegion(region string) codeartifactiface.CodeArtifactAPI {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.clients[region]; !ok {
+		c.clients[region] = codeartifact.New(c.sess, aws.NewConfig().WithRegion(region))
+	}
+
+	return c.clients[region]
+}
+
+type codeArtifactRepository struct {
+	domain string
+	name   string
+}
+
+// listOwnedDomains lists the names of the CodeArtifact domains in region owned by accountId
+func (c *codeArtifactClient) listOwnedDomains(region, accountId string) ([]string, error) {
+	domains := []string{}
+	err := c.withRegion(region).ListDomainsPages(&codeartifact.ListDomainsInput{},
+		func(resp *codeartifact.ListDomainsOutput, lastPage bool) bool {
+			for _, d := range resp.Domains {
+				if d.Owner == nil || *d.Owner == accountId {
+					domains = append(domains, *d.Name)
+				}
+			}
+			return true
+		})
+
+	return domains, err
+}
+
+// listOwnedRepositories lists the CodeArtifact repositories in region in domains owned by accountId
+func (c *codeArtifactClient) listOwnedRepositories(region, accountId string) ([]codeArtifactRepository, error) {
+	repos := []codeArtifactRepository{}
+	err := c.withRegion(region).ListRepositoriesPages(&codeartifact.ListRepositoriesInput{},
+		func(resp *codeartifact.ListRepositoriesOutput, lastPage bool) bool {
+			for _, r := range resp.Repositories {
+				if r.DomainOwner == nil || *r.DomainOwner == accountId {
+					repos = append(repos, codeArtifactRepository{domain: *r.DomainName, name: *r.Name})
+				}
+			}
+			return true
+		})
+
+	return repos, err
+}
+
+func (c *codeArtifactClient) getDomainPolicyDoc(region, domain string) (string, error) {
+	resp, err := c.withRegion(region).GetDomainPermissionsPolicy(&codeartifact.GetDomainPermissionsPolicyInput{
+		Domain: aws.String(domain),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == codeartifact.ErrCodeResourceNotFoundException {
+			return "", nil
+		}
+		return "", fmt.Errorf("GetDomainPermissionsPolicy for %s: %s", domain, err.Error())
+	}
+
+	return aws.StringValue(resp.Policy.Document), nil
+}
+
+func (c *codeArtifactClient) getRepositoryPolicyDoc(region, domain, repository string) (string, error) {
+	resp, err := c.withRegion(region).GetRepositoryPermissionsPolicy(&codeartifact.GetRepositoryPermissionsPolicyInput{
+		Domain:     aws.String(domain),
+		Repository: aws.String(repository),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == codeartifact.ErrCodeResourceNotFoundException {
+			return "", nil
+		}
+		return "", fmt.Errorf("GetRepositoryPermissionsPolicy for %s/%s: %s", domain, repository, err.Error())
+	}
+
+	return aws.StringValue(resp.Policy.Document), nil
+}
@@ -0,0 +1,186 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/configservice"
+	"github.com/aws/aws-sdk-go/service/configservice/configserviceiface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+)
+
+type configServiceClient struct {
+	configserviceiface.ConfigServiceAPI
+}
+
+func newConfigServiceClient(sess *session.Session) *configServiceClient {
+	return &configServiceClient{
+		configservice.New(sess),
+	}
+}
+
+// A configItem is a resource recorded by AWS Config, as an aggregator query
+// returns it. The configuration of IAM resources has the same fields as
+// GetAccountAuthorizationDetails returns, in camel case
+type configItem struct {
+	ResourceType  string          `json:"resourceType"`
+	Configuration json.RawMessage `json:"configuration"`
+	Tags          []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"tags"`
+}
+
+// selectIamItems returns the IAM users, groups, roles and customer managed
+// policies the aggregator has recorded for the account
+func (c *configServiceClient) selectIamItems(aggregator, accountId string) ([]configItem, error) {
+	expression := fmt.Sprintf("SELECT resourceType, configuration, tags WHERE accountId = '%s' AND resourceType IN ('AWS::IAM::User', 'AWS::IAM::Group', 'AWS::IAM::Role', 'AWS::IAM::Policy')", accountId)
+
+	items := []configItem{}
+	var itemErr error
+	err := c.SelectAggregateResourceConfigPages(&configservice.SelectAggregateResourceConfigInput{
+		ConfigurationAggregatorName: aws.String(aggregator),
+		Expression:                  aws.String(expression),
+	}, func(resp *configservice.SelectAggregateResourceConfigOutput, lastPage bool) bool {
+		for _, result := range resp.Results {
+			item := configItem{}
+			if itemErr = json.Unmarshal([]byte(*result), &item); itemErr != nil {
+				return false
+			}
+			items = append(items, item)
+		}
+		return true
+	})
+	if itemErr != nil {
+		return nil, errors.Wrap(itemErr, "Error reading AWS Config query results")
+	}
+	return items, err
+}
+
+// configAuthorizationDetails converts the Config items to the output of
+// GetAccountAuthorizationDetails, and the instance profiles of the roles to
+// the output of ListInstanceProfiles, so they can be populated the same way.
+// It also returns the tags of the managed policies, and the role and policy
+// descriptions by ARN, which the IAM API returns separately
+func configAuthorizationDetails(items []configItem) (*iam.GetAccountAuthorizationDetailsOutput, *iam.ListInstanceProfilesOutput, map[string]map[string]string, map[string]string, error) {
+	details := &iam.GetAccountAuthorizationDetailsOutput{}
+	profiles := &iam.ListInstanceProfilesOutput{}
+	policyTags := map[string]map[string]string{}
+	descriptions := map[string]string{}
+	profileIndex := map[string]*iam.InstanceProfile{}
+
+	for _, item := range items {
+		var extra struct {
+			Arn         string `json:"arn"`
+			Description string `json:"description"`
+		}
+		if err := json.Unmarshal(item.Configuration, &extra); err != nil {
+			return nil, nil, nil, nil, errors.Wrapf(err, "Error reading %s configuration", item.ResourceType)
+		}
+		if extra.Description != "" {
+			descriptions[extra.Arn] = extra.Description
+		}
+
+		var err error
+		switch item.ResourceType {
+		case "AWS::IAM::User":
+			user := &iam.UserDetail{}
+			err = json.Unmarshal(item.Configuration, user)
+			details.UserDetailList = append(details.UserDetailList, user)
+		case "AWS::IAM::Group":
+			group := &iam.GroupDetail{}
+			err = json.Unmarshal(item.Configuration, group)
+			details.GroupDetailList = append(details.GroupDetailList, group)
+		case "AWS::IAM::Role":
+			role := &iam.RoleDetail{}
+			err = json.Unmarshal(item.Configuration, role)
+			details.RoleDetailList = append(details.RoleDetailList, role)
+			for _, p := range role.InstanceProfileList {
+				if _, ok := profileIndex[aws.StringValue(p.InstanceProfileName)]; !ok {
+					profileIndex[aws.StringValue(p.InstanceProfileName)] = p
+					profiles.InstanceProfiles = append(profiles.InstanceProfiles, p)
+				}
+			}
+		case "AWS::IAM::Policy":
+			policy := &iam.ManagedPolicyDetail{}
+			err = json.Unmarshal(item.Configuration, policy)
+			for _, v := range policy.PolicyVersionList {
+				if v.CreateDate == nil {
+					v.CreateDate = &time.Time{}
+				}
+			}
+			details.Policies = append(details.Policies, policy)
+			tags := map[string]string{}
+			for _, t := range item.Tags {
+				tags[t.Key] = t.Value
+			}
+			policyTags[aws.StringValue(policy.Arn)] = tags
+		}
+		if err != nil {
+			return nil, nil, nil, nil, errors.Wrapf(err, "Error reading %s configuration", item.ResourceType)
+		}
+	}
+
+	return details, profiles, policyTags, descriptions, nil
+}
+
+// fetchIamDataFromConfig fetches the IAM data of the account from the AWS
+// Config aggregator
+func (a *AwsFetcher) fetchIamDataFromConfig() error {
+	items, err := a.config.selectIamItems(a.ConfigAggregator, a.account.Id)
+	if err != nil {
+		return err
+	}
+	details, profiles, policyTags, descriptions, err := configAuthorizationDetails(items)
+	if err != nil {
+		return err
+	}
+
+	a.configPolicyTags = policyTags
+	// the descriptions are in the configuration, so aren't fetched from IAM
+	a.SkipFetchingPolicyAndRoleDescriptions = true
+	if err = a.populateIamData(details); err != nil {
+		return err
+	}
+	if err = a.populateInstanceProfileData(profiles); err != nil {
+		return err
+	}
+
+	for _, r := range a.data.Roles {
+		r.Description = descriptions[Arn(r, a.account)]
+	}
+	for _, p := range a.data.Policies {
+		p.Description = descriptions[Arn(p, a.account)]
+	}
+	return nil
+}
+
+// fetchFromConfigAggregator fetches the IAM data from the Config aggregator,
+// skipping the other phases as the aggregator doesn't record their policies
+func (a *AwsFetcher) fetchFromConfigAggregator() (*AccountData, error) {
+	a.warn(WarningReadReplica, a.account.Id, fmt.Sprintf("Read from AWS Config aggregator %s, which can lag behind IAM, and doesn't have instance profiles without roles", a.ConfigAggregator))
+
+	for _, phase := range a.fetchPhases() {
+		if len(a.Phases) > 0 && !stringSliceContains(a.Phases, phase.name) {
+			continue
+		}
+		if phase.name != "iam" {
+			a.warn(WarningSkipped, phase.name, fmt.Sprintf("Skipping %s data, which isn't read from AWS Config aggregators", phase.description))
+			continue
+		}
+		stop := a.Timings.Track("iam from config aggregator")
+		err := a.fetchIamDataFromConfig()
+		stop()
+		if err != nil {
+			return nil, errors.Wrap(classifyAwsError(err), "Error fetching IAM data from AWS Config")
+		}
+	}
+
+	a.data.Warnings = a.data.Warnings.unique()
+
+	return &a.data, nil
+}
@@ -0,0 +1,66 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/configservice"
+	"github.com/aws/aws-sdk-go/service/configservice/configserviceiface"
+)
+
+type fakeConfigService struct {
+	configserviceiface.ConfigServiceAPI
+	expression string
+	results    []string
+}
+
+func (f *fakeConfigService) SelectAggregateResourceConfigPages(input *configservice.SelectAggregateResourceConfigInput, fn func(*configservice.SelectAggregateResourceConfigOutput, bool) bool) error {
+	f.expression = *input.Expression
+	fn(&configservice.SelectAggregateResourceConfigOutput{Results: aws.StringSlice(f.results)}, true)
+	return nil
+}
+
+func TestFetchIamDataFromConfig(t *testing.T) {
+	trust := `%7B%22Version%22%3A%222012-10-17%22%2C%22Statement%22%3A%5B%7B%22Effect%22%3A%22Allow%22%2C%22Principal%22%3A%7B%22Service%22%3A%22ec2.amazonaws.com%22%7D%2C%22Action%22%3A%22sts%3AAssumeRole%22%7D%5D%7D`
+	read := `%7B%22Version%22%3A%222012-10-17%22%2C%22Statement%22%3A%5B%7B%22Effect%22%3A%22Allow%22%2C%22Action%22%3A%22s3%3AGetObject%22%2C%22Resource%22%3A%22%2A%22%7D%5D%7D`
+	config := &fakeConfigService{results: []string{
+		`{"resourceType":"AWS::IAM::User","configuration":{"userName":"bob","path":"/","groupList":["admins"],"attachedManagedPolicies":[{"policyName":"reader","policyArn":"arn:aws:iam::123456789012:policy/reader"}],"userPolicyList":[],"tags":[{"key":"team","value":"ops"}]}}`,
+		`{"resourceType":"AWS::IAM::Group","configuration":{"groupName":"admins","path":"/","groupPolicyList":[{"policyName":"read","policyDocument":"` + read + `"}]}}`,
+		`{"resourceType":"AWS::IAM::Role","configuration":{"roleName":"app","path":"/","arn":"arn:aws:iam::123456789012:role/app","description":"The app","assumeRolePolicyDocument":"` + trust + `","instanceProfileList":[{"instanceProfileName":"app","path":"/","roles":[{"roleName":"app"}]}]}}`,
+		`{"resourceType":"AWS::IAM::Policy","configuration":{"policyName":"reader","path":"/","arn":"arn:aws:iam::123456789012:policy/reader","policyVersionList":[{"versionId":"v2","isDefaultVersion":true,"document":"` + read + `","createDate":"2021-03-04T01:41:38.000Z"},{"versionId":"v1","isDefaultVersion":false,"document":"` + read + `","createDate":"2020-03-04T01:41:38.000Z"}]},"tags":[{"key":"team","value":"ops"}]}`,
+	}}
+	f := AwsFetcher{
+		ConfigAggregator: "org",
+		AccountId:        "prod-123456789012",
+		cfn:              &cfnClient{},
+		config:           &configServiceClient{config},
+		account:          NewAccountFromString("prod-123456789012"),
+	}
+
+	if err := f.fetchIamDataFromConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(config.expression, "accountId = '123456789012'") {
+		t.Errorf("Expected the query to select the account, got %s", config.expression)
+	}
+	if len(f.data.Users) != 1 || f.data.Users[0].Groups[0] != "admins" || f.data.Users[0].Policies[0] != "reader" || f.data.Users[0].Tags["team"] != "ops" {
+		t.Errorf("Unexpected users %+v", f.data.Users)
+	}
+	if len(f.data.Groups) != 1 || f.data.Groups[0].InlinePolicies[0].Name != "read" {
+		t.Errorf("Unexpected groups %+v", f.data.Groups)
+	}
+	if len(f.data.Roles) != 1 || f.data.Roles[0].Description != "The app" || !strings.Contains(f.data.Roles[0].AssumeRolePolicyDocument.JsonString(), "ec2.amazonaws.com") {
+		t.Errorf("Unexpected roles %+v", f.data.Roles)
+	}
+	if len(f.data.InstanceProfiles) != 1 || f.data.InstanceProfiles[0].Roles[0] != "app" {
+		t.Errorf("Unexpected instance profiles %+v", f.data.InstanceProfiles)
+	}
+	if len(f.data.Policies) != 1 {
+		t.Fatalf("Unexpected policies %+v", f.data.Policies)
+	}
+	if p := f.data.Policies[0]; p.numberOfVersions != 2 || p.oldestVersionId != "v1" || p.Tags["team"] != "ops" {
+		t.Errorf("Unexpected policy %+v", p)
+	}
+}
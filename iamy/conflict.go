@@ -0,0 +1,212 @@
+package iamy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// A ConcurrentChangeGuard checks the resources a plan changes still have the
+// policy documents the plan was made from, before the first command changing
+// each runs, so changes made in AWS meanwhile aren't overwritten
+type ConcurrentChangeGuard struct {
+	// Read reads the resource's policy documents from AWS, by the names
+	// analysis reports use, eg. InlinePolicies[name]. It returns nil when the
+	// resource no longer exists, and false when resources of its type can't
+	// be read
+	Read func(r AwsResource) (map[string]*PolicyDocument, bool, error)
+
+	before    map[string]AwsResource
+	accountId string
+
+	mutex   sync.Mutex
+	checked map[string]error
+}
+
+// NewConcurrentChangeGuard returns a guard for the plan's commands as they
+// are now, so it's made after the commands are final
+func NewConcurrentChangeGuard(plan *SyncPlan, read func(r AwsResource) (map[string]*PolicyDocument, bool, error)) *ConcurrentChangeGuard {
+	g := &ConcurrentChangeGuard{
+		Read:      read,
+		before:    map[string]AwsResource{},
+		accountId: plan.from.Account.Id,
+		checked:   map[string]error{},
+	}
+	for _, ch := range plan.jsonPlan().Changes {
+		if ch.Before == nil {
+			continue
+		}
+		for _, c := range ch.Commands {
+			g.before[strings.Join(c.Argv, "\x00")] = ch.Before
+		}
+	}
+	return g
+}
+
+// Verify returns an *ErrConcurrentChange when the resource the command
+// changes has changed in AWS since the plan was made. Each resource is only
+// read before its first command, as its later commands follow the changes of
+// the earlier ones. Commands creating resources aren't checked
+func (g *ConcurrentChangeGuard) Verify(c Cmd) error {
+	before, ok := g.before[strings.Join(append([]string{c.Name}, c.Args...), "\x00")]
+	if !ok {
+		return nil
+	}
+	key := resourceKey(before)
+	g.mutex.Lock()
+	err, checked := g.checked[key]
+	g.mutex.Unlock()
+	if checked {
+		return err
+	}
+
+	err = g.verify(key, before)
+	g.mutex.Lock()
+	g.checked[key] = err
+	g.mutex.Unlock()
+	return err
+}
+
+func (g *ConcurrentChangeGuard) verify(key string, before AwsResource) error {
+	current, ok, err := g.Read(before)
+	if err != nil || !ok {
+		return err
+	}
+	if current == nil {
+		return &ErrConcurrentChange{Resource: key}
+	}
+
+	planned := NewAccountData(g.accountId)
+	planned.addResource(before)
+	hashes := map[string]string{}
+	for _, d := range planned.policyDocuments() {
+		hashes[d.policy] = d.doc.Hash()
+	}
+	names := []string{}
+	for name := range hashes {
+		names = append(names, name)
+	}
+	for name := range current {
+		if _, ok := hashes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if current[name].Hash() != hashes[name] {
+			return &ErrConcurrentChange{Resource: key, Policy: name}
+		}
+	}
+	return nil
+}
+
+// ReadPolicyDocuments reads the policy documents of an IAM user, group, role
+// or managed policy, or of a bucket, from AWS, for a ConcurrentChangeGuard.
+// The fetcher must have fetched the account first
+func (a *AwsFetcher) ReadPolicyDocuments(r AwsResource) (map[string]*PolicyDocument, bool, error) {
+	docs := map[string]*PolicyDocument{}
+	add := func(name, encoded string, err error) error {
+		if err != nil {
+			return err
+		}
+		doc, err := NewPolicyDocumentFromEncodedJson(encoded)
+		if err != nil {
+			return err
+		}
+		docs[name] = doc
+		return nil
+	}
+	inline := func(names []*string, get func(name string) (string, error)) error {
+		for _, name := range names {
+			doc, err := get(aws.StringValue(name))
+			if err = add(fmt.Sprintf("InlinePolicies[%s]", aws.StringValue(name)), doc, err); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	switch r := r.(type) {
+	case *User:
+		names := []*string{}
+		err = a.iam.ListUserPoliciesPages(&iam.ListUserPoliciesInput{UserName: aws.String(r.Name)}, func(resp *iam.ListUserPoliciesOutput, lastPage bool) bool {
+			names = append(names, resp.PolicyNames...)
+			return true
+		})
+		if err == nil {
+			err = inline(names, func(name string) (string, error) {
+				resp, err := a.iam.GetUserPolicy(&iam.GetUserPolicyInput{UserName: aws.String(r.Name), PolicyName: aws.String(name)})
+				if err != nil {
+					return "", err
+				}
+				return aws.StringValue(resp.PolicyDocument), nil
+			})
+		}
+	case *Group:
+		names := []*string{}
+		err = a.iam.ListGroupPoliciesPages(&iam.ListGroupPoliciesInput{GroupName: aws.String(r.Name)}, func(resp *iam.ListGroupPoliciesOutput, lastPage bool) bool {
+			names = append(names, resp.PolicyNames...)
+			return true
+		})
+		if err == nil {
+			err = inline(names, func(name string) (string, error) {
+				resp, err := a.iam.GetGroupPolicy(&iam.GetGroupPolicyInput{GroupName: aws.String(r.Name), PolicyName: aws.String(name)})
+				if err != nil {
+					return "", err
+				}
+				return aws.StringValue(resp.PolicyDocument), nil
+			})
+		}
+	case *Role:
+		var resp *iam.GetRoleOutput
+		if resp, err = a.iam.GetRole(&iam.GetRoleInput{RoleName: aws.String(r.Name)}); err == nil {
+			err = add("AssumeRolePolicyDocument", aws.StringValue(resp.Role.AssumeRolePolicyDocument), nil)
+		}
+		names := []*string{}
+		if err == nil {
+			err = a.iam.ListRolePoliciesPages(&iam.ListRolePoliciesInput{RoleName: aws.String(r.Name)}, func(resp *iam.ListRolePoliciesOutput, lastPage bool) bool {
+				names = append(names, resp.PolicyNames...)
+				return true
+			})
+		}
+		if err == nil {
+			err = inline(names, func(name string) (string, error) {
+				resp, err := a.iam.GetRolePolicy(&iam.GetRolePolicyInput{RoleName: aws.String(r.Name), PolicyName: aws.String(name)})
+				if err != nil {
+					return "", err
+				}
+				return aws.StringValue(resp.PolicyDocument), nil
+			})
+		}
+	case *Policy:
+		arn := Arn(r, a.account)
+		var version string
+		if version, err = a.iam.getPolicyDefaultVersion(arn); err == nil {
+			docs["Policy"], err = a.iam.getPolicyVersionDocument(arn, version)
+		}
+	case *BucketPolicy:
+		var region, policy string
+		if region, err = a.s3.bucketRegion(r.BucketName); err == nil {
+			policy, err = a.s3.GetBucketPolicyDoc(r.BucketName, region)
+		}
+		if err == nil && policy != "" {
+			docs["Policy"], err = NewPolicyDocumentFromJson(policy)
+		}
+	default:
+		return nil, false, nil
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == iam.ErrCodeNoSuchEntityException {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return docs, true, nil
+}
@@ -0,0 +1,73 @@
+package iamy
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestConcurrentChangeGuard(t *testing.T) {
+	read := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+	write := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]}`)
+	list := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:ListBucket","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: read})
+	remoteData.addGroup(&Group{iamService: iamService{Name: "writers", Path: "/"}, InlinePolicies: []InlinePolicy{{"write", write}}})
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: list})
+	localData.addGroup(&Group{iamService: iamService{Name: "writers", Path: "/"}, InlinePolicies: []InlinePolicy{{"write", list}}})
+	localData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}})
+	plan := PlanSync(remoteData, localData)
+
+	// someone changed the policy in AWS since the plan, but not the group
+	reads := map[string]int{}
+	guard := NewConcurrentChangeGuard(plan, func(r AwsResource) (map[string]*PolicyDocument, bool, error) {
+		reads[resourceKey(r)]++
+		switch r.ResourceType() {
+		case "policy":
+			return map[string]*PolicyDocument{"Policy": write}, true, nil
+		case "group":
+			return map[string]*PolicyDocument{"InlinePolicies[write]": write}, true, nil
+		}
+		return nil, false, nil
+	})
+
+	ran := []string{}
+	executor := Executor{
+		Workers:         1,
+		ContinueOnError: true,
+		Verify:          guard.Verify,
+		Run: func(c Cmd) error {
+			ran = append(ran, c.Args[1])
+			return nil
+		},
+	}
+	err := executor.Execute(plan.Cmds)
+	var failures ApplyErrors
+	var conflict *ErrConcurrentChange
+	if !errors.As(err, &failures) || len(failures) != 1 || !errors.As(failures[0].Err, &conflict) || conflict.Resource != "iam/policy/reader" || conflict.Policy != "Policy" {
+		t.Fatalf("Expected the policy's change in AWS to fail its commands, got %v", err)
+	}
+	for _, op := range ran {
+		if op == "create-policy-version" {
+			t.Errorf("Expected the policy not to be updated, ran %v", ran)
+		}
+	}
+	if reads["iam/group/writers"] != 1 || reads["iam/user/bob"] != 0 {
+		t.Errorf("Expected the group to be read once and the created user not at all, got %v", reads)
+	}
+
+	// the group was deleted in AWS
+	guard.Read = func(r AwsResource) (map[string]*PolicyDocument, bool, error) {
+		return nil, true, nil
+	}
+	guard.checked = map[string]error{}
+	for _, c := range plan.Cmds {
+		if c.Args[1] == "put-group-policy" {
+			if err := guard.Verify(c); !errors.As(err, &conflict) || conflict.Policy != "" {
+				t.Errorf("Expected the group's deletion to be a conflict, got %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package iamy
+
+import (
+	"regexp"
+	"strings"
+)
+
+// controlTowerSkipReason starts the reason given for skipping resources
+// managed by AWS Control Tower, followed by the component they belong to
+const controlTowerSkipReason = "Managed by AWS Control Tower "
+
+// CloudFormation names the stacks of stack set instances
+// StackSet-<stack set name>-<uuid>
+var controlTowerStackRegex = regexp.MustCompile(`^StackSet-(AWSControlTower.+)-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// controlTowerStackSetComponent describes the Control Tower stack set, eg.
+// AWSControlTowerBP-BASELINE-ROLES is baseline BASELINE-ROLES and
+// AWSControlTowerGuardrailAWS-GR-IAM-USER-MFA-ENABLED is guardrail
+// AWS-GR-IAM-USER-MFA-ENABLED
+func controlTowerStackSetComponent(stackSet string) string {
+	switch {
+	case strings.HasPrefix(stackSet, "AWSControlTowerBP-"):
+		return "baseline " + strings.TrimPrefix(stackSet, "AWSControlTowerBP-")
+	case strings.HasPrefix(stackSet, "AWSControlTowerGuardrail"):
+		return "guardrail " + strings.TrimPrefix(stackSet, "AWSControlTowerGuardrail")
+	}
+	return stackSet
+}
+
+// controlTowerComponent returns the Control Tower baseline or guardrail that
+// manages the resource, or an empty string if Control Tower doesn't manage
+// it. The stack is known from CloudFormation with --accurate-cfn, otherwise
+// from the stack name tag. Resources Control Tower creates outside stack
+// sets, or that aren't tagged, are recognised by their names
+func (a *AwsFetcher) controlTowerComponent(cfnType CfnResourceType, resourceIdentifier string, tags map[string]string) string {
+	stackName := a.cfn.StackName(cfnType, resourceIdentifier)
+	if stackName == "" {
+		stackName = tags[cloudformationStackNameTag]
+	}
+	if m := controlTowerStackRegex.FindStringSubmatch(stackName); m != nil {
+		return controlTowerStackSetComponent(m[1])
+	}
+
+	switch cfnType {
+	case CfnIamRole, CfnIamPolicy, CfnS3Bucket:
+		if strings.HasPrefix(resourceIdentifier, "aws-controltower-") || strings.HasPrefix(resourceIdentifier, "AWSControlTower") {
+			return "landing zone"
+		}
+	}
+
+	return ""
+}
+
+// ControlTowerComponents counts the resources skipped because Control Tower
+// manages them by the baseline or guardrail they belong to
+func (ww Warnings) ControlTowerComponents() map[string]int {
+	result := map[string]int{}
+	for _, w := range ww {
+		if w.Category == WarningControlTower {
+			result[strings.TrimPrefix(w.Message, controlTowerSkipReason)]++
+		}
+	}
+	return result
+}
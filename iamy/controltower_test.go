@@ -0,0 +1,65 @@
+package iamy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestControlTowerResourcesSkipped(t *testing.T) {
+	cfn := &cfnClient{
+		managedResources: map[string]CfnResourceTypes{
+			"aws-controltower-ConfigRecorderRole": {CfnIamRole},
+		},
+		stackNames: map[string]string{
+			"aws-controltower-ConfigRecorderRole": "StackSet-AWSControlTowerBP-BASELINE-CONFIG-0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b",
+		},
+	}
+	f := AwsFetcher{cfn: cfn}
+
+	resources := []struct {
+		cfnType   CfnResourceType
+		name      string
+		tags      map[string]string
+		component string
+	}{
+		{CfnIamRole, "aws-controltower-ConfigRecorderRole", map[string]string{}, "baseline BASELINE-CONFIG"},
+		{CfnIamRole, "GuardrailLambdaRole", map[string]string{cloudformationStackNameTag: "StackSet-AWSControlTowerGuardrailAWS-GR-IAM-USER-MFA-ENABLED-12345678-9abc-def0-1234-56789abcdef0"}, "guardrail AWS-GR-IAM-USER-MFA-ENABLED"},
+		{CfnIamRole, "AWSControlTowerExecution", map[string]string{}, "landing zone"},
+		{CfnS3Bucket, "aws-controltower-logs-123-ap-southeast-2", map[string]string{}, "landing zone"},
+		{CfnIamPolicy, "AWSControlTowerAdminPolicy", map[string]string{}, "landing zone"},
+	}
+	for _, r := range resources {
+		skipped, reason := f.isSkippableManagedResource(r.cfnType, r.name, r.tags, "/")
+		if expected := controlTowerSkipReason + r.component; !skipped || reason != expected {
+			t.Errorf("Expected %s %s to be skipped with %q, got %t %q", r.cfnType, r.name, expected, skipped, reason)
+		}
+	}
+
+	if skipped, _ := f.isSkippableManagedResource(CfnIamUser, "aws-controltower-admin", map[string]string{}, "/"); skipped {
+		t.Error("Expected a user not to be recognised by its name")
+	}
+	if skipped, _ := f.isSkippableManagedResource(CfnIamRole, "deploy", map[string]string{cloudformationStackNameTag: "StackSet-deploy-roles-12345678-9abc-def0-1234-56789abcdef0"}, "/"); skipped {
+		t.Error("Expected a role from another stack set not to be skipped")
+	}
+
+	f.IncludeControlTower = true
+	if skipped, _ := f.isSkippableManagedResource(CfnIamRole, "AWSControlTowerExecution", map[string]string{}, "/"); skipped {
+		t.Error("Expected Control Tower roles to be fetched with IncludeControlTower")
+	}
+}
+
+func TestWarningsControlTowerComponents(t *testing.T) {
+	f := AwsFetcher{}
+	f.warnSkipped(CfnIamRole, "aws-controltower-ConfigRecorderRole", controlTowerSkipReason+"baseline BASELINE-CONFIG")
+	f.warnSkipped(CfnIamRole, "aws-controltower-AdministratorExecutionRole", controlTowerSkipReason+"baseline BASELINE-ROLES")
+	f.warnSkipped(CfnIamRole, "aws-controltower-ReadOnlyExecutionRole", controlTowerSkipReason+"baseline BASELINE-ROLES")
+	f.warnSkipped(CfnIamRole, "deploy-ABCDEFGHIJ12", "CloudFormation generated resource deploy-ABCDEFGHIJ12")
+
+	if count := f.data.Warnings.Count(WarningSkipped); count != 1 {
+		t.Errorf("Expected 1 skipped warning, got %d", count)
+	}
+	expected := map[string]int{"baseline BASELINE-CONFIG": 1, "baseline BASELINE-ROLES": 2}
+	if actual := f.data.Warnings.ControlTowerComponents(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
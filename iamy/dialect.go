@@ -0,0 +1,143 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ShellDialects are the shells commands can be quoted for. powershell is
+// PowerShell 7.3 and later, and powershell5 is Windows PowerShell 5.1 and
+// the PowerShell versions before 7.3, which pass arguments to programs
+// differently
+var ShellDialects = []string{"posix", "powershell", "powershell5", "cmd", "fish"}
+
+// DetectShellDialect guesses the dialect of the shell iamy was run from. On
+// Windows that's PowerShell, unless cmd's PROMPT is set, and Windows
+// PowerShell unless the module path has PowerShell 7's modules. Elsewhere
+// it's fish or PowerShell when either is the login shell or running,
+// otherwise posix
+func DetectShellDialect() string {
+	if runtime.GOOS == "windows" {
+		if os.Getenv("PROMPT") != "" {
+			return "cmd"
+		}
+		if strings.Contains(strings.ToLower(os.Getenv("PSModulePath")), `\powershell\7\`) {
+			return "powershell"
+		}
+		return "powershell5"
+	}
+	switch filepath.Base(os.Getenv("SHELL")) {
+	case "fish":
+		return "fish"
+	case "pwsh":
+		return "powershell"
+	}
+	if os.Getenv("FISH_VERSION") != "" {
+		return "fish"
+	}
+	return "posix"
+}
+
+// Quoted returns the command as it's typed in the shell dialect, quoting the
+// arguments with characters the shell would interpret. For cmd, JSON
+// arguments are compacted onto one line, as cmd can't continue a quoted
+// argument over lines. For powershell, arguments are passed as PowerShell 7.3
+// and later do by default, and for powershell5 as Windows PowerShell does
+func (c Cmd) Quoted(dialect string) string {
+	quote := posixQuote
+	switch dialect {
+	case "powershell":
+		quote = powershellQuote
+	case "powershell5":
+		quote = powershellLegacyQuote
+	case "cmd":
+		quote = cmdQuote
+	case "fish":
+		quote = fishQuote
+	}
+
+	parts := []string{c.Name}
+	for _, a := range c.Args {
+		if a != "" && strings.Trim(a, plainArgChars) == "" {
+			parts = append(parts, a)
+		} else {
+			parts = append(parts, quote(a))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// plainArgChars are the characters no dialect needs quoted
+const plainArgChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_+=:,./-"
+
+func posixQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote quotes the argument as a fish single quoted string, where
+// backslash escapes quotes and backslashes
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// cmdQuote quotes the argument for the Windows command line parsing programs
+// like aws use, escaping the cmd metacharacters that cmd's own quoting leaves
+// exposed, as cmd toggles quoting at every double quote, escaped or not
+func cmdQuote(s string) string {
+	var compact bytes.Buffer
+	if json.Valid([]byte(s)) && json.Compact(&compact, []byte(s)) == nil {
+		s = compact.String()
+	}
+	arg := `"` + windowsArgEscape(s, true) + `"`
+
+	var escaped strings.Builder
+	quoted := false
+	for _, r := range arg {
+		if r == '"' {
+			quoted = !quoted
+		} else if !quoted && strings.ContainsRune("^&|<>()%!", r) {
+			escaped.WriteByte('^')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// windowsArgEscape escapes the double quotes in the argument for the Windows
+// command line parsing programs like aws use, doubling the backslashes before
+// them, and before the closing quote when the argument is to be quoted, so
+// they aren't taken as escaping it
+func windowsArgEscape(s string, quoted bool) string {
+	var arg strings.Builder
+	backslashes := 0
+	for _, r := range s {
+		switch r {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			arg.WriteString(strings.Repeat(`\`, backslashes*2+1))
+		default:
+			arg.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		arg.WriteRune(r)
+	}
+	if quoted {
+		backslashes *= 2
+	}
+	arg.WriteString(strings.Repeat(`\`, backslashes))
+	return arg.String()
+}
+
+// powershellLegacyQuote quotes the argument as a PowerShell verbatim string
+// for Windows PowerShell, which passes it to programs as it is, wrapped in
+// double quotes when it has whitespace, so its double quotes must be escaped
+// for the program's command line parsing
+func powershellLegacyQuote(s string) string {
+	return powershellQuote(windowsArgEscape(s, strings.ContainsAny(s, " \t\n")))
+}
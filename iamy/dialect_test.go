@@ -0,0 +1,21 @@
+package iamy
+
+import (
+	"testing"
+)
+
+func TestCmdQuoted(t *testing.T) {
+	c := Cmd{"aws", []string{"iam", "put-role-policy", "--role-name", "it's", "--policy-document", "{\n  \"Action\": \"s3:Get*\",\n  \"Resource\": \"arn:aws:s3:::a&b\\\\\"\n}"}}
+
+	for dialect, expected := range map[string]string{
+		"posix":       `aws iam put-role-policy --role-name 'it'\''s' --policy-document '{` + "\n" + `  "Action": "s3:Get*",` + "\n" + `  "Resource": "arn:aws:s3:::a&b\\"` + "\n}'",
+		"fish":        `aws iam put-role-policy --role-name 'it\'s' --policy-document '{` + "\n" + `  "Action": "s3:Get*",` + "\n" + `  "Resource": "arn:aws:s3:::a&b\\\\"` + "\n}'",
+		"powershell":  `aws iam put-role-policy --role-name 'it''s' --policy-document '{` + "\n" + `  "Action": "s3:Get*",` + "\n" + `  "Resource": "arn:aws:s3:::a&b\\"` + "\n}'",
+		"powershell5": `aws iam put-role-policy --role-name 'it''s' --policy-document '{` + "\n" + `  \"Action\": \"s3:Get*\",` + "\n" + `  \"Resource\": \"arn:aws:s3:::a&b\\\\\"` + "\n}'",
+		"cmd":         `aws iam put-role-policy --role-name "it's" --policy-document "{\"Action\":\"s3:Get*\",\"Resource\":\"arn:aws:s3:::a^&b\\\\\"}"`,
+	} {
+		if actual := c.Quoted(dialect); actual != expected {
+			t.Errorf("Expected %s command\n%s\ngot\n%s", dialect, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package iamy
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DocsFormats are the formats iamy docs writes its pages in
+var DocsFormats = []string{"markdown", "html"}
+
+// A DocsPage is a page of the documentation, at a slash separated path
+// relative to the root of the site
+type DocsPage struct {
+	Path    string
+	Content []byte
+}
+
+// A docsFormat renders the parts of a page in a markup. The inline content
+// the block methods take is already rendered by text, code and link
+type docsFormat interface {
+	ext() string
+	text(s string) string
+	code(s string) string
+	link(inline, href string) string
+	heading(b *bytes.Buffer, level int, inline string)
+	list(b *bytes.Buffer, items []string)
+	table(b *bytes.Buffer, header []string, rows [][]string)
+	codeBlock(b *bytes.Buffer, lang, s string)
+	page(title string, body *bytes.Buffer) []byte
+}
+
+type markdownDocs struct{}
+
+func (markdownDocs) ext() string          { return ".md" }
+func (markdownDocs) text(s string) string { return markdownEscaper.Replace(s) }
+
+func (markdownDocs) code(s string) string {
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
+
+func (markdownDocs) link(inline, href string) string {
+	return "[" + inline + "](" + href + ")"
+}
+
+func (markdownDocs) heading(b *bytes.Buffer, level int, inline string) {
+	fmt.Fprintf(b, "%s %s\n\n", strings.Repeat("#", level), inline)
+}
+
+func (markdownDocs) list(b *bytes.Buffer, items []string) {
+	for _, item := range items {
+		fmt.Fprintf(b, "- %s\n", item)
+	}
+	b.WriteString("\n")
+}
+
+func (markdownDocs) table(b *bytes.Buffer, header []string, rows [][]string) {
+	fmt.Fprintf(b, "| %s |\n|%s\n", strings.Join(header, " | "), strings.Repeat(" --- |", len(header)))
+	for _, row := range rows {
+		fmt.Fprintf(b, "| %s |\n", strings.Join(row, " | "))
+	}
+	b.WriteString("\n")
+}
+
+func (markdownDocs) codeBlock(b *bytes.Buffer, lang, s string) {
+	fmt.Fprintf(b, "```%s\n%s\n```\n\n", lang, s)
+}
+
+func (markdownDocs) page(title string, body *bytes.Buffer) []byte {
+	return body.Bytes()
+}
+
+type htmlDocs struct{}
+
+// htmlDocsStyle keeps the pages readable without any other files
+const htmlDocsStyle = `body { font-family: Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }`
+
+func (htmlDocs) ext() string          { return ".html" }
+func (htmlDocs) text(s string) string { return html.EscapeString(s) }
+func (htmlDocs) code(s string) string { return "<code>" + html.EscapeString(s) + "</code>" }
+
+func (htmlDocs) link(inline, href string) string {
+	return `<a href="` + html.EscapeString(href) + `">` + inline + "</a>"
+}
+
+func (htmlDocs) heading(b *bytes.Buffer, level int, inline string) {
+	fmt.Fprintf(b, "<h%d>%s</h%d>\n", level, inline, level)
+}
+
+func (htmlDocs) list(b *bytes.Buffer, items []string) {
+	b.WriteString("<ul>\n")
+	for _, item := range items {
+		fmt.Fprintf(b, "<li>%s</li>\n", item)
+	}
+	b.WriteString("</ul>\n")
+}
+
+func (htmlDocs) table(b *bytes.Buffer, header []string, rows [][]string) {
+	fmt.Fprintf(b, "<table>\n<tr><th>%s</th></tr>\n", strings.Join(header, "</th><th>"))
+	for _, row := range rows {
+		fmt.Fprintf(b, "<tr><td>%s</td></tr>\n", strings.Join(row, "</td><td>"))
+	}
+	b.WriteString("</table>\n")
+}
+
+func (htmlDocs) codeBlock(b *bytes.Buffer, lang, s string) {
+	fmt.Fprintf(b, "<pre><code class=\"language-%s\">%s</code></pre>\n", lang, html.EscapeString(s))
+}
+
+func (htmlDocs) page(title string, body *bytes.Buffer) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", html.EscapeString(title), htmlDocsStyle)
+	b.Write(body.Bytes())
+	b.WriteString("</body>\n</html>\n")
+	return b.Bytes()
+}
+
+// docsSite generates the pages of an account, linking resources to the pages
+// of the resources they refer to
+type docsSite struct {
+	f     docsFormat
+	data  *AccountData
+	pages map[string]string
+
+	// users and instance profiles refer to groups and roles by name, which is
+	// unique whatever their path
+	groups map[string]*Group
+	roles  map[string]*Role
+}
+
+// docsName is the name the pages show a resource as, with its path
+func docsName(r AwsResource) string {
+	return strings.TrimPrefix(r.ResourcePath(), "/") + r.ResourceName()
+}
+
+func (s *docsSite) pagePath(r AwsResource) string {
+	return s.data.Account.String() + "/" + r.ResourceType() + "/" + docsName(r) + s.f.ext()
+}
+
+// relativeLink links from the page to another page of the site
+func (s *docsSite) relativeLink(from, to, inline string) string {
+	href, err := filepath.Rel(filepath.Dir(filepath.FromSlash(from)), filepath.FromSlash(to))
+	if err != nil {
+		href = to
+	}
+	return s.f.link(inline, filepath.ToSlash(href))
+}
+
+// resourceLink links to the page of the resource with the ARN, or shows the
+// ARN when the site has no page for it, such as an AWS managed policy
+func (s *docsSite) resourceLink(from, arn, name string) string {
+	if page, ok := s.pages[arn]; ok {
+		return s.relativeLink(from, page, s.f.text(name))
+	}
+	return s.f.code(arn)
+}
+
+func (s *docsSite) policyLink(from, ref string) string {
+	return s.resourceLink(from, s.data.Account.policyArnFromString(ref), ref)
+}
+
+func (s *docsSite) policyLinks(from string, refs []string) []string {
+	links := []string{}
+	for _, ref := range refs {
+		links = append(links, s.policyLink(from, ref))
+	}
+	return links
+}
+
+func (s *docsSite) groupLink(from, name string) string {
+	if g, ok := s.groups[name]; ok {
+		return s.resourceLink(from, Arn(g, s.data.Account), docsName(g))
+	}
+	return s.f.text(name)
+}
+
+func (s *docsSite) roleLink(from, name string) string {
+	if r, ok := s.roles[name]; ok {
+		return s.resourceLink(from, Arn(r, s.data.Account), docsName(r))
+	}
+	return s.f.text(name)
+}
+
+// section writes a heading and a list of its items, unless there are none
+func (s *docsSite) section(b *bytes.Buffer, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	s.f.heading(b, 2, s.f.text(title))
+	s.f.list(b, items)
+}
+
+// attributes writes the attributes of a resource as a table, leaving out
+// those without a value
+func (s *docsSite) attributes(b *bytes.Buffer, rows [][]string) {
+	table := [][]string{}
+	for _, row := range rows {
+		if row[1] != "" {
+			table = append(table, []string{s.f.text(row[0]), row[1]})
+		}
+	}
+	s.f.table(b, []string{"Attribute", "Value"}, table)
+}
+
+func (s *docsSite) created(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return s.f.text(t.UTC().Format(time.RFC3339))
+}
+
+func (s *docsSite) tags(b *bytes.Buffer, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	keys := []string{}
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := [][]string{}
+	for _, k := range keys {
+		rows = append(rows, []string{s.f.text(k), s.f.text(tags[k])})
+	}
+	s.f.heading(b, 2, s.f.text("Tags"))
+	s.f.table(b, []string{"Key", "Value"}, rows)
+}
+
+func (s *docsSite) inlinePolicies(b *bytes.Buffer, policies []InlinePolicy) {
+	if len(policies) == 0 {
+		return
+	}
+	s.f.heading(b, 2, s.f.text("Inline policies"))
+	for _, p := range policies {
+		s.f.heading(b, 3, s.f.text(p.Name))
+		s.f.codeBlock(b, "json", p.Policy.JsonString())
+	}
+}
+
+func (s *docsSite) page(path, title string, body *bytes.Buffer) DocsPage {
+	return DocsPage{Path: path, Content: s.f.page(title, body)}
+}
+
+func (s *docsSite) userPage(u *User) DocsPage {
+	from := s.pagePath(u)
+	var b bytes.Buffer
+	s.f.heading(&b, 1, s.f.text("User "+docsName(u)))
+	boundary := ""
+	if u.PermissionsBoundary != "" {
+		boundary = s.policyLink(from, u.PermissionsBoundary)
+	}
+	s.attributes(&b, [][]string{
+		{"ARN", s.f.code(Arn(u, s.data.Account))},
+		{"Permissions boundary", boundary},
+		{"Created", s.created(u.CreateDate)},
+	})
+	groups := []string{}
+	for _, name := range u.Groups {
+		groups = append(groups, s.groupLink(from, name))
+	}
+	s.section(&b, "Groups", groups)
+	s.section(&b, "Managed policies", s.policyLinks(from, u.Policies))
+	s.inlinePolicies(&b, u.InlinePolicies)
+	s.tags(&b, u.Tags)
+	return s.page(from, "User "+docsName(u), &b)
+}
+
+func (s *docsSite) groupPage(g *Group) DocsPage {
+	from := s.pagePath(g)
+	var b bytes.Buffer
+	s.f.heading(&b, 1, s.f.text("Group "+docsName(g)))
+	s.attributes(&b, [][]string{
+		{"ARN", s.f.code(Arn(g, s.data.Account))},
+	})
+	members := []string{}
+	for _, u := range s.data.Users {
+		if stringSliceContains(u.Groups, g.Name) {
+			members = append(members, s.resourceLink(from, Arn(u, s.data.Account), docsName(u)))
+		}
+	}
+	s.section(&b, "Members", members)
+	s.section(&b, "Managed policies", s.policyLinks(from, g.Policies))
+	s.inlinePolicies(&b, g.InlinePolicies)
+	return s.page(from, "Group "+docsName(g), &b)
+}
+
+func (s *docsSite) rolePage(r *Role) DocsPage {
+	from := s.pagePath(r)
+	var b bytes.Buffer
+	s.f.heading(&b, 1, s.f.text("Role "+docsName(r)))
+	boundary, duration := "", ""
+	if r.PermissionsBoundary != "" {
+		boundary = s.policyLink(from, r.PermissionsBoundary)
+	}
+	if r.MaxSessionDuration != 0 {
+		duration = s.f.text(fmt.Sprintf("%d seconds", r.MaxSessionDuration))
+	}
+	s.attributes(&b, [][]string{
+		{"ARN", s.f.code(Arn(r, s.data.Account))},
+		{"Description", s.f.text(r.Description)},
+		{"Permissions boundary", boundary},
+		{"Max session duration", duration},
+		{"Created", s.created(r.CreateDate)},
+	})
+	principals := []string{}
+	for _, p := range trustPrincipals(r.AssumeRolePolicyDocument) {
+		principals = append(principals, s.f.code(p))
+	}
+	s.section(&b, "Trusted principals", principals)
+	profiles := []string{}
+	for _, p := range s.data.InstanceProfiles {
+		if stringSliceContains(p.Roles, r.Name) {
+			profiles = append(profiles, s.f.text(docsName(p)))
+		}
+	}
+	s.section(&b, "Instance profiles", profiles)
+	s.section(&b, "Managed policies", s.policyLinks(from, r.Policies))
+	s.inlinePolicies(&b, r.InlinePolicies)
+	s.f.heading(&b, 2, s.f.text("Trust policy"))
+	s.f.codeBlock(&b, "json", r.AssumeRolePolicyDocument.JsonString())
+	return s.page(from, "Role "+docsName(r), &b)
+}
+
+func (s *docsSite) policyPage(p *Policy) DocsPage {
+	from := s.pagePath(p)
+	ref := policyRef(p)
+	var b bytes.Buffer
+	s.f.heading(&b, 1, s.f.text("Policy "+docsName(p)))
+	s.attributes(&b, [][]string{
+		{"ARN", s.f.code(Arn(p, s.data.Account))},
+		{"Description", s.f.text(p.Description)},
+		{"Created", s.created(p.CreateDate)},
+	})
+	attached, boundaryOf := []string{}, []string{}
+	principal := func(r AwsResource, policies []string, boundary string) {
+		link := s.f.text(r.ResourceType()+" ") + s.resourceLink(from, Arn(r, s.data.Account), docsName(r))
+		if stringSliceContains(policies, ref) {
+			attached = append(attached, link)
+		}
+		if boundary == ref {
+			boundaryOf = append(boundaryOf, link)
+		}
+	}
+	for _, u := range s.data.Users {
+		principal(u, u.Policies, u.PermissionsBoundary)
+	}
+	for _, g := range s.data.Groups {
+		principal(g, g.Policies, "")
+	}
+	for _, r := range s.data.Roles {
+		principal(r, r.Policies, r.PermissionsBoundary)
+	}
+	s.section(&b, "Attached to", attached)
+	s.section(&b, "Permissions boundary of", boundaryOf)
+	s.f.heading(&b, 2, s.f.text("Policy document"))
+	s.f.codeBlock(&b, "json", p.Policy.JsonString())
+	s.tags(&b, p.Tags)
+	return s.page(from, "Policy "+docsName(p), &b)
+}
+
+// indexPage lists the resources of the account, linking to their pages
+func (s *docsSite) indexPage() DocsPage {
+	from := s.data.Account.String() + "/index" + s.f.ext()
+	a := s.data.Account
+	var b bytes.Buffer
+	s.f.heading(&b, 1, s.f.text("Account "+a.String()))
+
+	join := func(links []string) string { return strings.Join(links, ", ") }
+	link := func(r AwsResource) string { return s.resourceLink(from, Arn(r, a), docsName(r)) }
+	table := func(title string, header []string, rows [][]string) {
+		if len(rows) == 0 {
+			return
+		}
+		s.f.heading(&b, 2, s.f.text(title))
+		s.f.table(&b, header, rows)
+	}
+
+	rows := [][]string{}
+	for _, u := range s.data.Users {
+		groups := []string{}
+		for _, name := range u.Groups {
+			groups = append(groups, s.groupLink(from, name))
+		}
+		rows = append(rows, []string{link(u), join(groups), join(s.policyLinks(from, u.Policies))})
+	}
+	table("Users", []string{"User", "Groups", "Managed policies"}, rows)
+
+	rows = [][]string{}
+	for _, g := range s.data.Groups {
+		rows = append(rows, []string{link(g), join(s.policyLinks(from, g.Policies))})
+	}
+	table("Groups", []string{"Group", "Managed policies"}, rows)
+
+	rows = [][]string{}
+	for _, r := range s.data.Roles {
+		rows = append(rows, []string{link(r), s.f.text(r.Description), join(s.policyLinks(from, r.Policies))})
+	}
+	table("Roles", []string{"Role", "Description", "Managed policies"}, rows)
+
+	rows = [][]string{}
+	for _, p := range s.data.Policies {
+		rows = append(rows, []string{link(p), s.f.text(p.Description)})
+	}
+	table("Managed policies", []string{"Policy", "Description"}, rows)
+
+	rows = [][]string{}
+	for _, p := range s.data.InstanceProfiles {
+		roles := []string{}
+		for _, name := range p.Roles {
+			roles = append(roles, s.roleLink(from, name))
+		}
+		rows = append(rows, []string{s.f.text(docsName(p)), join(roles)})
+	}
+	table("Instance profiles", []string{"Instance profile", "Roles"}, rows)
+
+	awsPolicies := []string{}
+	for _, arn := range s.data.awsManagedPolicyArns() {
+		awsPolicies = append(awsPolicies, s.f.code(arn))
+	}
+	s.section(&b, "AWS managed policies", awsPolicies)
+	return s.page(from, "Account "+a.String(), &b)
+}
+
+// GenerateDocs returns the pages of a browsable site documenting the accounts,
+// in markdown or as HTML: an index of the accounts, and for each account an
+// index of its resources and a page for each user, group, role and customer
+// managed policy. The pages link to the groups, roles and policies resources
+// refer to and the principals policies are attached to, and show the policy
+// documents
+func GenerateDocs(accounts []*AccountData, format string) ([]DocsPage, error) {
+	var f docsFormat
+	switch format {
+	case "markdown":
+		f = markdownDocs{}
+	case "html":
+		f = htmlDocs{}
+	default:
+		return nil, fmt.Errorf("Unknown docs format %s, expected one of %s", format, strings.Join(DocsFormats, ", "))
+	}
+
+	pages := []DocsPage{}
+	var index bytes.Buffer
+	f.heading(&index, 1, f.text("IAM documentation"))
+	accountLinks := []string{}
+	for _, data := range accounts {
+		s := &docsSite{f: f, data: data, pages: map[string]string{}, groups: map[string]*Group{}, roles: map[string]*Role{}}
+		for _, r := range data.resources() {
+			switch r.(type) {
+			case *User, *Group, *Role, *Policy:
+				s.pages[Arn(r, data.Account)] = s.pagePath(r)
+			}
+		}
+		for _, g := range data.Groups {
+			s.groups[g.Name] = g
+		}
+		for _, r := range data.Roles {
+			s.roles[r.Name] = r
+		}
+
+		accountIndex := s.indexPage()
+		pages = append(pages, accountIndex)
+		accountLinks = append(accountLinks, f.link(f.text(data.Account.String()), accountIndex.Path))
+		for _, u := range data.Users {
+			pages = append(pages, s.userPage(u))
+		}
+		for _, g := range data.Groups {
+			pages = append(pages, s.groupPage(g))
+		}
+		for _, r := range data.Roles {
+			pages = append(pages, s.rolePage(r))
+		}
+		for _, p := range data.Policies {
+			pages = append(pages, s.policyPage(p))
+		}
+	}
+	f.list(&index, accountLinks)
+	return append([]DocsPage{{Path: "index" + f.ext(), Content: f.page("IAM documentation", &index)}}, pages...), nil
+}
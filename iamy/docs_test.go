@@ -0,0 +1,110 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateDocs(t *testing.T) {
+	readOnly := "arn:aws:iam::aws:policy/ReadOnlyAccess"
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	policy := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+
+	data := NewAccountData("myalias-123")
+	data.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}, Groups: []string{"devs"}, PermissionsBoundary: "boundary"})
+	data.addGroup(&Group{iamService: iamService{Name: "devs", Path: "/"}, Policies: []string{"team/reader", readOnly}})
+	data.addRole(&Role{iamService: iamService{Name: "app", Path: "/services/"}, Description: "Runs <the> app", AssumeRolePolicyDocument: trust, Policies: []string{"team/reader"},
+		InlinePolicies: []InlinePolicy{{Name: "s3", Policy: policy}}})
+	data.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/team/"}, Description: "Reads things", Policy: policy})
+	data.addPolicy(&Policy{iamService: iamService{Name: "boundary", Path: "/"}, Policy: policy})
+	data.addInstanceProfile(&InstanceProfile{iamService: iamService{Name: "app", Path: "/"}, Roles: []string{"app"}})
+
+	pages, err := GenerateDocs([]*AccountData{data}, "markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := map[string]string{}
+	paths := []string{}
+	for _, p := range pages {
+		byPath[p.Path] = string(p.Content)
+		paths = append(paths, p.Path)
+	}
+	expectedPaths := []string{
+		"index.md",
+		"myalias-123/index.md",
+		"myalias-123/user/alice.md",
+		"myalias-123/group/devs.md",
+		"myalias-123/role/services/app.md",
+		"myalias-123/policy/team/reader.md",
+		"myalias-123/policy/boundary.md",
+	}
+	if strings.Join(paths, ",") != strings.Join(expectedPaths, ",") {
+		t.Fatalf("Expected pages %v, got %v", expectedPaths, paths)
+	}
+
+	expected := map[string][]string{
+		"index.md": {"- [myalias-123](myalias-123/index.md)"},
+		"myalias-123/index.md": {
+			"| [alice](user/alice.md) | [devs](group/devs.md) |  |",
+			"| [services/app](role/services/app.md) | Runs &lt;the&gt; app | [team/reader](policy/team/reader.md) |",
+			"| app | [services/app](role/services/app.md) |",
+			"- `arn:aws:iam::aws:policy/ReadOnlyAccess`",
+		},
+		"myalias-123/user/alice.md": {
+			"| Permissions boundary | [boundary](../policy/boundary.md) |",
+			"- [devs](../group/devs.md)",
+		},
+		"myalias-123/group/devs.md": {
+			"- [alice](../user/alice.md)",
+			"- [team/reader](../policy/team/reader.md)",
+			"- `arn:aws:iam::aws:policy/ReadOnlyAccess`",
+		},
+		"myalias-123/role/services/app.md": {
+			"- `Service ec2.amazonaws.com`",
+			"## Instance profiles\n\n- app",
+			"- [team/reader](../../policy/team/reader.md)",
+			"### s3\n\n```json\n{",
+			"## Trust policy",
+		},
+		"myalias-123/policy/team/reader.md": {
+			"| Description | Reads things |",
+			"- group [devs](../../group/devs.md)",
+			"- role [services/app](../../role/services/app.md)",
+			"## Policy document\n\n```json\n{",
+		},
+		"myalias-123/policy/boundary.md": {
+			"## Permissions boundary of\n\n- user [alice](../user/alice.md)",
+		},
+	}
+	for path, contents := range expected {
+		for _, c := range contents {
+			if !strings.Contains(byPath[path], c) {
+				t.Errorf("Expected %s to contain %q, got:\n%s", path, c, byPath[path])
+			}
+		}
+	}
+
+	pages, err = GenerateDocs([]*AccountData{data}, "html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pages {
+		if p.Path != "myalias-123/role/services/app.html" {
+			continue
+		}
+		for _, c := range []string{
+			"<title>Role services/app</title>",
+			"<td>Description</td><td>Runs &lt;the&gt; app</td>",
+			`<li><a href="../../policy/team/reader.html">team/reader</a></li>`,
+			`<pre><code class="language-json">{`,
+		} {
+			if !strings.Contains(string(p.Content), c) {
+				t.Errorf("Expected %s to contain %q, got:\n%s", p.Path, c, p.Content)
+			}
+		}
+	}
+
+	if _, err = GenerateDocs([]*AccountData{data}, "pdf"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
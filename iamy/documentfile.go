@@ -0,0 +1,65 @@
+package iamy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteDocumentFiles writes the JSON documents in the commands' arguments to
+// files in dir, and returns the commands with file:// references to them
+// instead, so large policies don't exceed command line length limits. Files
+// are named by the command and a hash of the document, so planning the same
+// change again refers to the same file. It also returns the files written
+func WriteDocumentFiles(cmds CmdList, dir string) (CmdList, []string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	result := CmdList{}
+	files := []string{}
+	for _, c := range cmds {
+		args := make([]string, len(c.Args))
+		for i, a := range c.Args {
+			args[i] = a
+			if !isJsonDocument(a) || len(c.Args) < 2 {
+				continue
+			}
+			h := sha256.Sum256([]byte(a))
+			file := filepath.Join(dir, c.Args[1]+"-"+hex.EncodeToString(h[:])[:12]+".json")
+			if !stringSliceContains(files, file) {
+				if err := ioutil.WriteFile(file, []byte(a), 0644); err != nil {
+					return nil, nil, err
+				}
+				files = append(files, file)
+			}
+			args[i] = "file://" + file
+		}
+		result = append(result, Cmd{c.Name, args})
+	}
+	return result, files, nil
+}
+
+// isJsonDocument returns whether the argument is a JSON object or array
+func isJsonDocument(arg string) bool {
+	trimmed := strings.TrimSpace(arg)
+	return (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed))
+}
+
+// RemoveDocumentFiles removes the files WriteDocumentFiles wrote
+func RemoveDocumentFiles(files []string) error {
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDocumentFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "documentfiletest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	doc := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+	cmds := CmdList{}
+	cmds.Add("aws", "iam", "put-role-policy", "--role-name", "app", "--policy-name", "read", "--policy-document", doc)
+	cmds.Add("aws", "iam", "put-user-policy", "--user-name", "bob", "--policy-name", "read", "--policy-document", doc)
+	cmds.Add("aws", "iam", "delete-role", "--role-name", "old")
+
+	result, files, err := WriteDocumentFiles(cmds, filepath.Join(dir, "documents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected a file for each command's document, got %v", files)
+	}
+	ref := cmdFlag(result[0], "--policy-document")
+	if !strings.HasPrefix(ref, "file://") || !strings.HasPrefix(filepath.Base(ref), "put-role-policy-") {
+		t.Errorf("Expected a file reference, got %s", ref)
+	}
+	if content, err := ioutil.ReadFile(strings.TrimPrefix(ref, "file://")); err != nil || string(content) != doc {
+		t.Errorf("Expected the document to be written, got %s %v", content, err)
+	}
+	if result[2].String() != cmds[2].String() || cmdFlag(cmds[0], "--policy-document") != doc {
+		t.Errorf("Expected commands without documents and the original commands to be unchanged")
+	}
+
+	again, _, _ := WriteDocumentFiles(cmds, filepath.Join(dir, "documents"))
+	if again.String() != result.String() {
+		t.Errorf("Expected the same files to be referred to when planned again")
+	}
+
+	if err = RemoveDocumentFiles(files); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected the files to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package iamy
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A Drift is a resource that differs between AWS and the files. Action is
+// what push would do about it, create, delete, update or rename, and
+// Attributes are the attributes of the resource that differ. RenamedFrom is
+// the resource a renamed resource is in AWS
+type Drift struct {
+	Resource    string           `json:"Resource"`
+	RenamedFrom string           `json:"RenamedFrom,omitempty"`
+	Action      string           `json:"Action"`
+	Attributes  []AttributeDrift `json:"Attributes,omitempty"`
+}
+
+// An AttributeDrift is an attribute of a resource that differs between AWS
+// and the files, as a diff of the attribute's JSON. The diff of a policy
+// document is of its statements, compared normalised so reordering isn't a
+// change
+type AttributeDrift struct {
+	Name string `json:"Name"`
+	Diff string `json:"Diff"`
+}
+
+// DetectDrift returns the resources that differ between AWS and the files,
+// the changes push would make without the commands. Resources missing from
+// the files are listed last, and are found without planning their deletion,
+// which would query AWS for what depends on them. Renames aren't detected, so
+// a renamed resource is a delete and a create
+func DetectDrift(aws, files *AccountData) []Drift {
+	plan := PlanSyncWithOptions(aws, files, SyncOptions{DisableRenameDetection: true, DisablePrune: true})
+	drifts := []Drift{}
+	for _, d := range plan.Drifts() {
+		if d.Action != "update" {
+			d.Attributes = nil
+		}
+		drifts = append(drifts, d)
+	}
+
+	inFiles := map[string]bool{}
+	for _, r := range files.resources() {
+		inFiles[resourceKey(r)] = true
+	}
+	for _, r := range aws.resources() {
+		if !inFiles[resourceKey(r)] {
+			drifts = append(drifts, Drift{Resource: resourceKey(r), Action: "delete"})
+		}
+	}
+	return drifts
+}
+
+// Drifts returns the resources the plan changes, with the attributes it
+// changes. Every attribute of a created resource is added, and the attributes
+// of a deleted resource aren't listed
+func (p *SyncPlan) Drifts() []Drift {
+	drifts := []Drift{}
+	for _, ch := range p.jsonPlan().Changes {
+		d := Drift{Resource: ch.Resource, RenamedFrom: ch.RenamedFrom, Action: ch.Action}
+		if ch.Action != "delete" {
+			d.Attributes = attributeDrifts(ch.Before, ch.After)
+		}
+		drifts = append(drifts, d)
+	}
+	return drifts
+}
+
+// attributeDrifts compares the resources' attributes as they're written to
+// files. A missing resource has no attributes
+func attributeDrifts(before, after AwsResource) []AttributeDrift {
+	drifts, _ := compareAttributes(before, after)
+	return drifts
+}
+
+// compareAttributes returns the attributes that differ between the
+// resources, and the names of those that differ only until they're
+// normalised, eg. policy documents with reordered statements
+func compareAttributes(before, after AwsResource) ([]AttributeDrift, []string) {
+	attributes := func(r AwsResource) map[string]interface{} {
+		result := map[string]interface{}{}
+		if r == nil {
+			return result
+		}
+		if err := json.Unmarshal([]byte(comparableJson(r)), &result); err != nil {
+			panic(err)
+		}
+		return result
+	}
+	from, to := attributes(before), attributes(after)
+
+	names := []string{}
+	for name := range from {
+		names = append(names, name)
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	drifts := []AttributeDrift{}
+	normalised := []string{}
+	for _, name := range names {
+		if reflect.DeepEqual(from[name], to[name]) {
+			continue
+		}
+		if diff := attributeDiff(from[name], to[name]); diff != "" {
+			drifts = append(drifts, AttributeDrift{name, diff})
+		} else {
+			normalised = append(normalised, name)
+		}
+	}
+	return drifts, normalised
+}
+
+// attributeDiff returns a diff of the attribute's values, or of their
+// statements when both are policy documents
+func attributeDiff(before, after interface{}) string {
+	var b strings.Builder
+	beforeDoc, beforeIsPolicy := policyDocumentValue(before)
+	afterDoc, afterIsPolicy := policyDocumentValue(after)
+	if beforeIsPolicy && afterIsPolicy {
+		removed, added := diffStatements(beforeDoc, afterDoc)
+		for _, s := range removed {
+			b.WriteString("- " + strings.ReplaceAll(s, "\n", "\n- ") + "\n")
+		}
+		for _, s := range added {
+			b.WriteString("+ " + strings.ReplaceAll(s, "\n", "\n+ ") + "\n")
+		}
+		return b.String()
+	}
+
+	for _, v := range []struct {
+		prefix string
+		value  interface{}
+	}{{"- ", before}, {"+ ", after}} {
+		if v.value == nil {
+			continue
+		}
+		j, err := json.MarshalIndent(v.value, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		b.WriteString(v.prefix + strings.ReplaceAll(string(j), "\n", "\n"+v.prefix) + "\n")
+	}
+	return b.String()
+}
+
+// policyDocumentValue returns the attribute value as a policy document, if
+// it is one
+func policyDocumentValue(v interface{}) (*PolicyDocument, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if _, ok := m["Statement"]; !ok {
+		return nil, false
+	}
+	j, err := json.Marshal(m)
+	if err != nil {
+		return nil, false
+	}
+	doc, err := NewPolicyDocumentFromJson(string(j))
+	if err != nil {
+		return nil, false
+	}
+	return doc, true
+}
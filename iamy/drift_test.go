@@ -0,0 +1,61 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectDrift(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	otherTrust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, Description: "old", AssumeRolePolicyDocument: trust})
+	remoteData.addRole(&Role{iamService: iamService{Name: "same", Path: "/"}, AssumeRolePolicyDocument: trust})
+	remoteData.addUser(&User{iamService: iamService{Name: "manual", Path: "/"}})
+
+	localData := NewAccountData("123")
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, Description: "new", AssumeRolePolicyDocument: otherTrust})
+	localData.addRole(&Role{iamService: iamService{Name: "same", Path: "/"}, AssumeRolePolicyDocument: trust})
+	localData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}})
+
+	actions := map[string]Drift{}
+	for _, d := range DetectDrift(remoteData, localData) {
+		actions[d.Resource] = d
+	}
+	if len(actions) != 3 || actions["iam/user/bob"].Action != "create" || actions["iam/user/manual"].Action != "delete" {
+		t.Fatalf("Unexpected drift %+v", actions)
+	}
+
+	app := actions["iam/role/app"]
+	if app.Action != "update" || len(app.Attributes) != 2 {
+		t.Fatalf("Expected the role's description and trust policy to have drifted, got %+v", app.Attributes)
+	}
+	if a := app.Attributes[0]; a.Name != "AssumeRolePolicyDocument" || !strings.Contains(a.Diff, `-   "Principal": {`+"\n"+`-     "Service": "ec2.amazonaws.com"`) || !strings.Contains(a.Diff, `+     "Service": "lambda.amazonaws.com"`) {
+		t.Errorf("Unexpected trust policy diff:\n%s", a.Diff)
+	}
+	if a := app.Attributes[1]; a.Name != "Description" || a.Diff != "- \"old\"\n+ \"new\"\n" {
+		t.Errorf("Unexpected description diff:\n%s", a.Diff)
+	}
+}
+
+func TestSyncPlanDrifts(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addGroup(&Group{iamService: iamService{Name: "developers", Path: "/"}, Policies: []string{"read"}})
+	localData := NewAccountData("123")
+	localData.addGroup(&Group{iamService: iamService{Name: "engineers", Path: "/"}, Policies: []string{"read"}})
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, Description: "App servers", AssumeRolePolicyDocument: trust})
+
+	drifts := PlanSync(remoteData, localData).Drifts()
+	if len(drifts) != 2 {
+		t.Fatalf("Expected a rename and a create, got %+v", drifts)
+	}
+	if d := drifts[0]; d.Action != "rename" || d.Resource != "iam/group/engineers" || d.RenamedFrom != "iam/group/developers" || len(d.Attributes) != 0 {
+		t.Errorf("Expected the group to be renamed without changes, got %+v", d)
+	}
+	if d := drifts[1]; d.Action != "create" || len(d.Attributes) != 2 || d.Attributes[1].Diff != "+ \"App servers\"\n" {
+		t.Errorf("Expected every attribute of the role to be added, got %+v", d)
+	}
+}
@@ -0,0 +1,231 @@
+package iamy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// MaxDriftRuns is how many runs the drift history keeps for each account
+const MaxDriftRuns = 500
+
+// A DriftRun is the drift a check found, by what push would do about it
+type DriftRun struct {
+	Time     time.Time      `json:"Time"`
+	Drifts   int            `json:"Drifts"`
+	ByAction map[string]int `json:"ByAction,omitempty"`
+}
+
+// NewDriftRun counts the drifts of a check
+func NewDriftRun(now time.Time, drifts []Drift) DriftRun {
+	run := DriftRun{Time: now.UTC().Truncate(time.Second), Drifts: len(drifts)}
+	for _, d := range drifts {
+		if run.ByAction == nil {
+			run.ByAction = map[string]int{}
+		}
+		run.ByAction[d.Action]++
+	}
+	return run
+}
+
+// A DriftHistory is the runs of check for each account, oldest first, keyed
+// by account
+type DriftHistory map[string][]DriftRun
+
+// parseS3Location splits an s3://bucket/key location, returning false for a
+// local file
+func parseS3Location(location string) (bucket, key string, ok bool) {
+	if !strings.HasPrefix(location, "s3://") {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(location, "s3://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// ReadDriftHistory reads the drift history from a file, or from an S3 object
+// with an s3://bucket/key location. A history that doesn't exist yet is empty
+func ReadDriftHistory(location string) (DriftHistory, error) {
+	var data []byte
+	var err error
+	if bucket, key, ok := parseS3Location(location); ok {
+		data, err = readS3Object(bucket, key)
+	} else {
+		data, err = ioutil.ReadFile(location)
+		if os.IsNotExist(err) {
+			data, err = nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var history DriftHistory
+	if err = yaml.Unmarshal(data, &history); err != nil {
+		return nil, errors.Wrapf(err, "Error reading drift history %s", location)
+	}
+	if history == nil {
+		history = DriftHistory{}
+	}
+	return history, nil
+}
+
+// RecordDriftRun adds the run to the account's drift history, keeping the
+// most recent MaxDriftRuns runs, and returns the account's runs
+func RecordDriftRun(location string, account *Account, run DriftRun) ([]DriftRun, error) {
+	history, err := ReadDriftHistory(location)
+	if err != nil {
+		return nil, err
+	}
+	runs := append(history[account.String()], run)
+	if len(runs) > MaxDriftRuns {
+		runs = runs[len(runs)-MaxDriftRuns:]
+	}
+	history[account.String()] = runs
+
+	data, err := yaml.Marshal(history)
+	if err != nil {
+		return nil, err
+	}
+	if bucket, key, ok := parseS3Location(location); ok {
+		return runs, writeS3Object(bucket, key, data)
+	}
+	if dir := filepath.Dir(location); dir != "" {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return runs, ioutil.WriteFile(location, data, 0644)
+}
+
+func readS3Object(bucket, key string) ([]byte, error) {
+	c := newS3Client(awsSession())
+	region, err := c.bucketRegion(bucket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error finding the region of bucket %s", bucket)
+	}
+	resp, err := c.withRegion(region).GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading s3://%s/%s", bucket, key)
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func writeS3Object(bucket, key string, data []byte) error {
+	c := newS3Client(awsSession())
+	region, err := c.bucketRegion(bucket)
+	if err != nil {
+		return errors.Wrapf(err, "Error finding the region of bucket %s", bucket)
+	}
+	_, err = c.withRegion(region).PutObject(&s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: bytes.NewReader(data)})
+	return errors.Wrapf(err, "Error writing s3://%s/%s", bucket, key)
+}
+
+// A DriftBudget is the most drifted resources an account should have. It's
+// exceeded when the drift stays above Limit for Runs consecutive runs, so a
+// change in progress doesn't exceed it
+type DriftBudget struct {
+	Limit int
+	Runs  int
+}
+
+// ConsecutiveOverBudget returns how many of the most recent runs in a row
+// found more drift than the limit
+func ConsecutiveOverBudget(runs []DriftRun, limit int) int {
+	n := 0
+	for i := len(runs) - 1; i >= 0 && runs[i].Drifts > limit; i-- {
+		n++
+	}
+	return n
+}
+
+// Exceeded returns whether the drift of the runs exceeds the budget
+func (b DriftBudget) Exceeded(runs []DriftRun) bool {
+	need := b.Runs
+	if need < 1 {
+		need = 1
+	}
+	return ConsecutiveOverBudget(runs, b.Limit) >= need
+}
+
+func (b DriftBudget) String() string {
+	return fmt.Sprintf("more than %d drifted resources for %d consecutive runs", b.Limit, b.Runs)
+}
+
+// A DriftTrend summarises an account's drift history
+type DriftTrend struct {
+	Account string     `json:"Account"`
+	Runs    int        `json:"Runs"`
+	From    time.Time  `json:"From"`
+	To      time.Time  `json:"To"`
+	Latest  int        `json:"Latest"`
+	Min     int        `json:"Min"`
+	Max     int        `json:"Max"`
+	Mean    float64    `json:"Mean"`
+	Change  int        `json:"Change"`
+	History []DriftRun `json:"History"`
+}
+
+// DriftTrends summarises the drift history of each account, or of the
+// accounts given, over at most the last runs of each, or all of them
+func DriftTrends(history DriftHistory, accounts []string, last int) []DriftTrend {
+	names := []string{}
+	for account := range history {
+		if len(accounts) == 0 || stringSliceContains(accounts, account) {
+			names = append(names, account)
+		}
+	}
+	sort.Strings(names)
+
+	trends := []DriftTrend{}
+	for _, account := range names {
+		runs := history[account]
+		if last > 0 && len(runs) > last {
+			runs = runs[len(runs)-last:]
+		}
+		if len(runs) == 0 {
+			continue
+		}
+		t := DriftTrend{
+			Account: account,
+			Runs:    len(runs),
+			From:    runs[0].Time,
+			To:      runs[len(runs)-1].Time,
+			Latest:  runs[len(runs)-1].Drifts,
+			Min:     runs[0].Drifts,
+			Max:     runs[0].Drifts,
+			Change:  runs[len(runs)-1].Drifts - runs[0].Drifts,
+			History: runs,
+		}
+		total := 0
+		for _, r := range runs {
+			total += r.Drifts
+			if r.Drifts < t.Min {
+				t.Min = r.Drifts
+			}
+			if r.Drifts > t.Max {
+				t.Max = r.Drifts
+			}
+		}
+		t.Mean = float64(total) / float64(len(runs))
+		trends = append(trends, t)
+	}
+	return trends
+}
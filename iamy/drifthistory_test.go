@@ -0,0 +1,55 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDriftHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iamy-drift-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history", "drift.yaml")
+
+	account := &Account{Id: "123456789012", Alias: "myalias"}
+	start := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	budget := DriftBudget{Limit: 2, Runs: 3}
+	var runs []DriftRun
+	for i, n := range []int{1, 3, 5, 4} {
+		drifts := make([]Drift, n)
+		for j := range drifts {
+			drifts[j].Action = "update"
+		}
+		if runs, err = RecordDriftRun(file, account, NewDriftRun(start.Add(time.Duration(i)*time.Hour), drifts)); err != nil {
+			t.Fatal(err)
+		}
+		if exceeded := budget.Exceeded(runs); exceeded != (i == 3) {
+			t.Errorf("Expected the budget exceeded only after 3 runs over it, got %v after run %d", exceeded, i)
+		}
+	}
+
+	history, err := ReadDriftHistory(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := history[account.String()]; len(runs) != 4 || runs[3].ByAction["update"] != 4 {
+		t.Fatalf("Expected the 4 runs recorded, got %+v", history)
+	}
+
+	trends := DriftTrends(history, nil, 3)
+	if len(trends) != 1 {
+		t.Fatalf("Expected the account's trend, got %+v", trends)
+	}
+	tr := trends[0]
+	if tr.Runs != 3 || tr.Latest != 4 || tr.Min != 3 || tr.Max != 5 || tr.Mean != 4 || tr.Change != 1 {
+		t.Errorf("Expected the trend of the last 3 runs, got %+v", tr)
+	}
+	if trends := DriftTrends(history, []string{"other-111111111111"}, 0); len(trends) != 0 {
+		t.Errorf("Expected no trends for another account, got %+v", trends)
+	}
+}
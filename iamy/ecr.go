@@ -0,0 +1,49 @@
+package iamy
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+)
+
+type ecrClient struct {
+	sess    *session.Session
+	clients map[string]ecriface.ECRAPI
+	mutex   sync.Mutex
+}
+
+func newEcrClient(sess *session.Session) *ecrClient {
+	return &ecrClient{
+		sess:    sess,
+		clients: map[string]ecriface.ECRAPI{},
+	}
+}
+
+func (c *ecrClient) withRegion(region string) ecriface.ECRAPI {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.clients[region]; !ok {
+		c.clients[region] = ecr.New(c.sess, aws.NewConfig().WithRegion(region))
+	}
+
+	return c.clients[region]
+}
+
+// getRegistryPolicy returns the private registry's permissions policy in the
+// region, or an empty string if it doesn't have one
+func (c *ecrClient) getRegistryPolicy(region string) (string, error) {
+	resp, err := c.withRegion(region).GetRegistryPolicy(&ecr.GetRegistryPolicyInput{})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ecr.ErrCodeRegistryPolicyNotFoundException {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(resp.PolicyText), nil
+}
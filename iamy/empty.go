@@ -0,0 +1,126 @@
+package iamy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/pkg/errors"
+)
+
+// An EmptyResource is a group, managed policy, role or instance profile that
+// holds or grants nothing, so can probably be deleted. It's Removable when
+// its file can be removed without checking anything more, which a role is only
+// once it's known to be unused
+type EmptyResource struct {
+	Resource  AwsResource
+	File      string
+	Problem   string
+	Removable bool
+}
+
+// FetchRoleLastUsed returns when each of the roles was last used to make a
+// request, by role name. Roles that haven't been used since AWS started
+// tracking it are missing
+func FetchRoleLastUsed(roles []*Role) (map[string]time.Time, error) {
+	return fetchRoleLastUsed(newIamClient(awsSession()), roles)
+}
+
+func fetchRoleLastUsed(client iamiface.IAMAPI, roles []*Role) (map[string]time.Time, error) {
+	lastUsed := map[string]time.Time{}
+	for _, r := range roles {
+		resp, err := client.GetRole(&iam.GetRoleInput{RoleName: aws.String(r.Name)})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error getting when role %s was last used", r.Name)
+		}
+		if resp.Role.RoleLastUsed != nil && resp.Role.RoleLastUsed.LastUsedDate != nil {
+			lastUsed[r.Name] = aws.TimeValue(resp.Role.RoleLastUsed.LastUsedDate)
+		}
+	}
+	return lastUsed, nil
+}
+
+// usedPolicyRefs returns the managed policies the users, groups and roles
+// attach or use as a permissions boundary, as they refer to them
+func (a *AccountData) usedPolicyRefs() []string {
+	used := []string{}
+	for _, u := range a.Users {
+		used = append(append(used, u.Policies...), u.PermissionsBoundary)
+	}
+	for _, g := range a.Groups {
+		used = append(used, g.Policies...)
+	}
+	for _, r := range a.Roles {
+		used = append(append(used, r.Policies...), r.PermissionsBoundary)
+	}
+	return used
+}
+
+// EmptyReport returns the resources of the account that are empty: groups no
+// user is in, customer managed policies attached to nothing and not used as a
+// permissions boundary, roles with no policies, and instance profiles with no
+// roles. Roles in an instance profile aren't empty, as the profile would be
+// left referring to a missing role. With lastUsed, when roles were last used
+// by name, roles used since unusedSince aren't empty either, and without it
+// roles aren't Removable, as they may still be assumed. Resources the
+// protected selectors match are never empty
+func EmptyReport(data *AccountData, protected []ResourceSelector, lastUsed map[string]time.Time, unusedSince time.Time) []EmptyResource {
+	result := []EmptyResource{}
+	add := func(r AwsResource, problem string) {
+		for _, s := range protected {
+			if s.matches(r) {
+				return
+			}
+		}
+		_, isRole := r.(*Role)
+		result = append(result, EmptyResource{
+			Resource:  r,
+			File:      data.ResourceFile(r),
+			Problem:   problem,
+			Removable: !isRole || lastUsed != nil,
+		})
+	}
+
+	members := []string{}
+	for _, u := range data.Users {
+		members = append(members, u.Groups...)
+	}
+	for _, g := range data.Groups {
+		if !stringSliceContains(members, g.Name) {
+			add(g, "has no members")
+		}
+	}
+
+	used := data.usedPolicyRefs()
+	for _, p := range data.Policies {
+		if !stringSliceContains(used, policyRef(p)) {
+			add(p, "isn't attached to anything")
+		}
+	}
+
+	inProfiles := []string{}
+	for _, p := range data.InstanceProfiles {
+		inProfiles = append(inProfiles, p.Roles...)
+	}
+	for _, r := range data.Roles {
+		if len(r.Policies) > 0 || len(r.InlinePolicies) > 0 || stringSliceContains(inProfiles, r.Name) {
+			continue
+		}
+		if lastUsed == nil {
+			add(r, "has no policies")
+		} else if used, ok := lastUsed[r.Name]; !ok {
+			add(r, "has no policies and has never been used")
+		} else if used.Before(unusedSince) {
+			add(r, fmt.Sprintf("has no policies and was last used %s", used.UTC().Format(time.RFC3339)))
+		}
+	}
+
+	for _, p := range data.InstanceProfiles {
+		if len(p.Roles) == 0 {
+			add(p, "has no roles")
+		}
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+package iamy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+type fakeRoleLastUsedIam struct {
+	iamiface.IAMAPI
+	lastUsed map[string]time.Time
+}
+
+func (f *fakeRoleLastUsedIam) GetRole(input *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	role := &iam.Role{RoleName: input.RoleName, RoleLastUsed: &iam.RoleLastUsed{}}
+	if used, ok := f.lastUsed[*input.RoleName]; ok {
+		role.RoleLastUsed.LastUsedDate = aws.Time(used)
+	}
+	return &iam.GetRoleOutput{Role: role}, nil
+}
+
+func TestEmptyReport(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	policy := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+
+	data := NewAccountData("123")
+	data.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}, Groups: []string{"devs"}, PermissionsBoundary: "boundary"})
+	data.addGroup(&Group{iamService: iamService{Name: "devs", Path: "/"}, Policies: []string{"team/reader"}})
+	data.addGroup(&Group{iamService: iamService{Name: "nobody", Path: "/"}})
+	data.addGroup(&Group{iamService: iamService{Name: "break-glass", Path: "/"}})
+	data.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/team/"}, Policy: policy})
+	data.addPolicy(&Policy{iamService: iamService{Name: "boundary", Path: "/"}, Policy: policy})
+	data.addPolicy(&Policy{iamService: iamService{Name: "orphan", Path: "/"}, Policy: policy})
+	data.addRole(&Role{iamService: iamService{Name: "idle", Path: "/app/"}, AssumeRolePolicyDocument: trust})
+	data.addRole(&Role{iamService: iamService{Name: "busy", Path: "/"}, AssumeRolePolicyDocument: trust})
+	data.addRole(&Role{iamService: iamService{Name: "never", Path: "/"}, AssumeRolePolicyDocument: trust})
+	data.addRole(&Role{iamService: iamService{Name: "server", Path: "/"}, AssumeRolePolicyDocument: trust})
+	data.addRole(&Role{iamService: iamService{Name: "reader", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{"team/reader"}})
+	data.addInstanceProfile(&InstanceProfile{iamService: iamService{Name: "server", Path: "/"}, Roles: []string{"server"}})
+	data.addInstanceProfile(&InstanceProfile{iamService: iamService{Name: "spare", Path: "/"}})
+
+	protected, _ := ParseResourceSelector("group/break-glass")
+	report := func(lastUsed map[string]time.Time, unusedSince time.Time) []string {
+		found := []string{}
+		for _, e := range EmptyReport(data, []ResourceSelector{protected}, lastUsed, unusedSince) {
+			found = append(found, resourceKey(e.Resource)+": "+e.Problem+" in "+e.File)
+		}
+		return found
+	}
+	check := func(expected, found []string) {
+		t.Helper()
+		if len(found) != len(expected) {
+			t.Fatalf("Expected %v, got %v", expected, found)
+		}
+		for i := range expected {
+			if found[i] != expected[i] {
+				t.Errorf("Expected %s, got %s", expected[i], found[i])
+			}
+		}
+	}
+
+	check([]string{
+		"iam/group/nobody: has no members in 123/iam/group/nobody.yaml",
+		"iam/policy/orphan: isn't attached to anything in 123/iam/policy/orphan.yaml",
+		"iam/role/app/idle: has no policies in 123/iam/role/app/idle.yaml",
+		"iam/role/busy: has no policies in 123/iam/role/busy.yaml",
+		"iam/role/never: has no policies in 123/iam/role/never.yaml",
+		"iam/instance-profile/spare: has no roles in 123/iam/instance-profile/spare.yaml",
+	}, report(nil, time.Time{}))
+
+	unusedSince := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	lastUsed, err := fetchRoleLastUsed(&fakeRoleLastUsedIam{lastUsed: map[string]time.Time{
+		"idle": time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		"busy": time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+	}}, data.Roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check([]string{
+		"iam/group/nobody: has no members in 123/iam/group/nobody.yaml",
+		"iam/policy/orphan: isn't attached to anything in 123/iam/policy/orphan.yaml",
+		"iam/role/app/idle: has no policies and was last used 2021-06-01T00:00:00Z in 123/iam/role/app/idle.yaml",
+		"iam/role/never: has no policies and has never been used in 123/iam/role/never.yaml",
+		"iam/instance-profile/spare: has no roles in 123/iam/instance-profile/spare.yaml",
+	}, report(lastUsed, unusedSince))
+
+	removable := func(lastUsed map[string]time.Time) []string {
+		found := []string{}
+		for _, e := range EmptyReport(data, []ResourceSelector{protected}, lastUsed, unusedSince) {
+			if e.Removable {
+				found = append(found, resourceKey(e.Resource))
+			}
+		}
+		return found
+	}
+	check([]string{
+		"iam/group/nobody",
+		"iam/policy/orphan",
+		"iam/instance-profile/spare",
+	}, removable(nil))
+	check([]string{
+		"iam/group/nobody",
+		"iam/policy/orphan",
+		"iam/role/app/idle",
+		"iam/role/never",
+		"iam/instance-profile/spare",
+	}, removable(lastUsed))
+}
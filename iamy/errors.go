@@ -0,0 +1,156 @@
+package iamy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+)
+
+// The error types below are returned, possibly wrapped, so callers can tell
+// failures apart with errors.As instead of matching messages. Each keeps the
+// error it classifies, which gives its message
+
+// ErrThrottled is a request AWS rejected as too many were made
+type ErrThrottled struct {
+	Err error
+}
+
+func (e *ErrThrottled) Error() string { return e.Err.Error() }
+func (e *ErrThrottled) Unwrap() error { return e.Err }
+
+// ErrAccessDenied is a request the credentials aren't allowed to make. Action
+// is the IAM action that was denied, like iam:ListUsers, when AWS says
+type ErrAccessDenied struct {
+	Action string
+	Err    error
+}
+
+func (e *ErrAccessDenied) Error() string { return e.Err.Error() }
+func (e *ErrAccessDenied) Unwrap() error { return e.Err }
+
+// ErrResourceConflict is a request that conflicts with a resource's state in
+// AWS, such as creating a resource that exists or deleting one still in use
+type ErrResourceConflict struct {
+	Err error
+}
+
+func (e *ErrResourceConflict) Error() string { return e.Err.Error() }
+func (e *ErrResourceConflict) Unwrap() error { return e.Err }
+
+// ErrLimitExceeded is a request that would exceed an AWS quota, such as
+// creating a version of a managed policy that has the most versions it can
+type ErrLimitExceeded struct {
+	Err error
+}
+
+func (e *ErrLimitExceeded) Error() string { return e.Err.Error() }
+func (e *ErrLimitExceeded) Unwrap() error { return e.Err }
+
+// ErrConcurrentChange is a resource that changed in AWS after the plan was
+// made, so the commands changing it weren't run, to not overwrite the change.
+// Policy is the policy document that changed, or empty when the resource was
+// deleted. A managed policy whose default version has changed since the plan
+// was made has the version the plan was made from and its version in AWS
+type ErrConcurrentChange struct {
+	Resource string
+	Policy   string
+
+	PlannedVersion string
+	CurrentVersion string
+}
+
+func (e *ErrConcurrentChange) Error() string {
+	if e.PlannedVersion != "" {
+		return fmt.Sprintf("%s was at version %s when the plan was made but its default version is %s, it was changed in AWS since, not superseding the change", e.Resource, e.PlannedVersion, e.CurrentVersion)
+	}
+	if e.Policy == "" {
+		return fmt.Sprintf("%s was deleted in AWS after the plan was made, not changing it", e.Resource)
+	}
+	return fmt.Sprintf("%s %s was changed in AWS after the plan was made, not overwriting the change", e.Resource, e.Policy)
+}
+
+// ErrValidation is a file that couldn't be read. File is relative to the
+// directory it was read from, and Line is the line of the problem, or 0 when
+// it isn't known
+type ErrValidation struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ErrValidation) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("Error reading %s, line %d: %s", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("Error reading %s: %s", e.File, e.Err)
+}
+
+func (e *ErrValidation) Unwrap() error { return e.Err }
+
+var yamlErrorLine = regexp.MustCompile(`\bline (\d+)\b`)
+
+// validationError returns err as an ErrValidation of the file, with the line
+// yaml errors include in their message
+func validationError(file string, err error) error {
+	line := 0
+	if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		line, _ = strconv.Atoi(match[1])
+	}
+	return &ErrValidation{File: file, Line: line, Err: err}
+}
+
+var deniedAction = regexp.MustCompile(`perform: ([\w-]+:\w+)`)
+
+// classifyErrorCode returns err as the error type for the AWS error code, or
+// err itself when the code isn't classified
+func classifyErrorCode(code, action string, err error) error {
+	switch code {
+	case "Throttling", "ThrottlingException", "ThrottledException", "RequestThrottled",
+		"RequestThrottledException", "RequestLimitExceeded", "TooManyRequestsException", "SlowDown":
+		return &ErrThrottled{err}
+	case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation":
+		if match := deniedAction.FindStringSubmatch(err.Error()); action == "" && match != nil {
+			action = match[1]
+		}
+		return &ErrAccessDenied{action, err}
+	case "EntityAlreadyExists", "DeleteConflict", "ConcurrentModification", "ConflictException",
+		"ResourceInUseException", "BucketAlreadyExists", "BucketAlreadyOwnedByYou", "OperationAborted":
+		return &ErrResourceConflict{err}
+	case "LimitExceeded", "LimitExceededException":
+		return &ErrLimitExceeded{err}
+	}
+	return err
+}
+
+// classifyAwsError returns err as one of the error types above when it's
+// caused by an AWS SDK error with a classified code
+func classifyAwsError(err error) error {
+	if awsErr, ok := errors.Cause(err).(awserr.Error); ok {
+		return classifyErrorCode(awsErr.Code(), "", err)
+	}
+	return err
+}
+
+var cliError = regexp.MustCompile(`An error occurred \(([\w.]+)\) when calling the (\w+) operation.*`)
+
+// CmdError returns the error of an aws command that failed, with the AWS
+// error in its output, as one of the error types above when the error's code
+// is classified
+func CmdError(c Cmd, output string, err error) error {
+	match := cliError.FindStringSubmatch(output)
+	if match == nil {
+		return fmt.Errorf("%s: %s", c, err)
+	}
+
+	service := ""
+	if len(c.Args) > 0 {
+		service = c.Args[0]
+	}
+	if service == "s3api" {
+		service = "s3"
+	}
+	return classifyErrorCode(match[1], service+":"+match[2], fmt.Errorf("%s: %s", c, match[0]))
+}
@@ -0,0 +1,76 @@
+package iamy
+
+import (
+	stderrors "errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+)
+
+func TestClassifyAwsError(t *testing.T) {
+	throttled := errors.Wrap(awserr.New("Throttling", "Rate exceeded", nil), "Error listing users")
+	var errThrottled *ErrThrottled
+	if err := errors.Wrap(classifyAwsError(throttled), "Error fetching IAM data"); !stderrors.As(err, &errThrottled) {
+		t.Errorf("Expected ErrThrottled, got %#v", err)
+	}
+
+	denied := awserr.New("AccessDenied", "User: arn:aws:iam::123:user/bob is not authorized to perform: iam:ListRoles on resource: arn:aws:iam::123:role/", nil)
+	var errDenied *ErrAccessDenied
+	if err := classifyAwsError(denied); !stderrors.As(err, &errDenied) || errDenied.Action != "iam:ListRoles" || err.Error() != denied.Error() {
+		t.Errorf("Expected ErrAccessDenied for iam:ListRoles, got %#v", err)
+	}
+
+	other := awserr.New("NoSuchEntity", "The role cannot be found", nil)
+	if err := classifyAwsError(other); err != other {
+		t.Errorf("Expected an unclassified error to be returned as is, got %#v", err)
+	}
+}
+
+func TestCmdError(t *testing.T) {
+	c := Cmd{Name: "aws", Args: []string{"iam", "create-role", "--role-name", "app"}}
+
+	err := CmdError(c, "\nAn error occurred (EntityAlreadyExists) when calling the CreateRole operation: Role with name app already exists.\n", stderrors.New("exit status 254"))
+	var errConflict *ErrResourceConflict
+	if !stderrors.As(err, &errConflict) {
+		t.Errorf("Expected ErrResourceConflict, got %#v", err)
+	}
+	if expected := "aws iam create-role --role-name app: An error occurred (EntityAlreadyExists) when calling the CreateRole operation: Role with name app already exists."; err.Error() != expected {
+		t.Errorf("Expected %s, got %s", expected, err)
+	}
+
+	err = CmdError(c, "An error occurred (AccessDenied) when calling the CreateRole operation: User is not authorized", stderrors.New("exit status 254"))
+	var errDenied *ErrAccessDenied
+	if !stderrors.As(err, &errDenied) || errDenied.Action != "iam:CreateRole" {
+		t.Errorf("Expected ErrAccessDenied for iam:CreateRole, got %#v", err)
+	}
+
+	if err = CmdError(c, "command not found", stderrors.New("exit status 127")); err.Error() != "aws iam create-role --role-name app: exit status 127" {
+		t.Errorf("Unexpected error %s", err)
+	}
+}
+
+func TestYamlLoadValidationError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errorstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "123", "iam", "user", "bob.yaml")
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(file, []byte("Groups:\n- admins\nTags:\n  team: a: b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = (&YamlLoadDumper{Dir: dir}).Load()
+	var errValidation *ErrValidation
+	if !stderrors.As(err, &errValidation) || errValidation.File != "123/iam/user/bob.yaml" || errValidation.Line != 4 {
+		t.Errorf("Expected ErrValidation for line 4 of the user's file, got %#v", err)
+	}
+}
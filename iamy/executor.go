@@ -0,0 +1,281 @@
+package iamy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An Executor runs a plan's commands concurrently. Commands run phase by
+// phase, so everything a command refers to exists by the time it runs, and
+// the commands for the same resource run in order. Within a phase, the
+// commands for different resources are shared between the workers
+type Executor struct {
+	// Workers is how many commands can run at once, at least one
+	Workers int
+	// RateLimit is the most commands to start each second, or 0 for no limit
+	RateLimit float64
+	// Run runs a command
+	Run func(Cmd) error
+	// ContinueOnError keeps running the commands for other resources after a
+	// command fails, skipping only those that must run after it, and returns
+	// every failure as ApplyErrors
+	ContinueOnError bool
+	// Journal records the commands that succeed, if set
+	Journal *Journal
+	// Retry is how commands AWS throttles are retried
+	Retry RetryPolicy
+	// OnRetry is called before waiting to retry a throttled command, if set
+	OnRetry func(c Cmd, err error, wait time.Duration)
+	// Verify is called before running each command, if set, and the command
+	// fails with its error instead of running, eg. to check the resource
+	// hasn't changed since the plan was made
+	Verify func(Cmd) error
+
+	// PolicyVersions reads the stored versions of a managed policy, oldest
+	// first, if set. A create-policy-version command that fails as the policy
+	// has the most versions it can, eg. as a version was made after the plan,
+	// deletes the oldest nondefault version and runs again. Leave it unset
+	// for policy versions to never be deleted
+	PolicyVersions func(policyArn string) ([]PolicyVersion, error)
+	// OnVersionLimit is called with the version deleted to make room for the
+	// command's new version, if set
+	OnVersionLimit func(c Cmd, deleted PolicyVersion)
+
+	// Hooks are run around the changes by Apply
+	Hooks []ApplyHook
+	// RunHook runs a hook's shell command
+	RunHook func(command string, event HookEvent) error
+
+	sleep func(time.Duration)
+}
+
+// lane is the commands of a phase that must run in order. s3control commands
+// share a lane as Object Lambda Access Points depend on their supporting
+// access points, and commands that can't be attributed to a resource share
+// another
+func (c Cmd) lane() string {
+	if len(c.Args) > 0 && c.Args[0] == "s3control" {
+		return "s3control"
+	}
+	if scope, ok := newCmdScope(c); ok {
+		return scope.service + "/" + scope.resourceType + "/" + scope.path + "/" + scope.name
+	}
+	return ""
+}
+
+// referencedLanes returns the lanes of the resources the command refers to,
+// its own and, for IAM commands, the users, groups, roles, instance profiles
+// and managed policies it names, eg. the policy a role is attached to
+func (c Cmd) referencedLanes() []string {
+	lanes := []string{c.lane()}
+	if len(c.Args) < 2 || c.Args[0] != "iam" {
+		return lanes
+	}
+	for _, f := range []struct{ flag, resourceType string }{
+		{"--instance-profile-name", "instance-profile"},
+		{"--role-name", "role"},
+		{"--group-name", "group"},
+		{"--user-name", "user"},
+		{"--policy-arn", "policy"},
+		{"--permissions-boundary", "policy"},
+	} {
+		name := cmdFlag(c, f.flag)
+		if name == "" {
+			continue
+		}
+		if f.resourceType == "policy" {
+			name = name[strings.LastIndex(name, "/")+1:]
+		}
+		lanes = append(lanes, "iam/"+f.resourceType+"//"+name)
+	}
+	return lanes
+}
+
+// phases splits the commands into runs of commands in the same phase, and
+// each run into lanes in the order they first appear
+func (cc CmdList) phases() [][]CmdList {
+	result := [][]CmdList{}
+	for i := 0; i < len(cc); {
+		lanes := []CmdList{}
+		laneIndex := map[string]int{}
+		j := i
+		for ; j < len(cc) && cc[j].phase() == cc[i].phase(); j++ {
+			key := cc[j].lane()
+			if _, ok := laneIndex[key]; !ok {
+				laneIndex[key] = len(lanes)
+				lanes = append(lanes, CmdList{})
+			}
+			lanes[laneIndex[key]] = append(lanes[laneIndex[key]], cc[j])
+		}
+		result = append(result, lanes)
+		i = j
+	}
+	return result
+}
+
+// An ApplyFailure is a command that failed, and the commands that were
+// skipped as they must run after it, for the same resource or referring to it. Resource is the
+// changed resource the command is for, when Apply can tell
+type ApplyFailure struct {
+	Resource string
+	Cmd      Cmd
+	Err      error
+	Skipped  CmdList
+}
+
+// ApplyErrors are the commands that failed when running with ContinueOnError
+type ApplyErrors []*ApplyFailure
+
+func (e ApplyErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Err.Error()
+	}
+	return fmt.Sprintf("%d commands failed", len(e))
+}
+
+// Execute runs the commands, returning the first error. Once a command fails
+// no more are started, but those already running are waited for. With
+// ContinueOnError, the commands in other lanes keep running, unless they refer
+// to the resource of a failed lane, and every failure is returned as
+// ApplyErrors
+func (e Executor) Execute(cmds CmdList) error {
+	workers := e.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	bucket := newTokenBucket(e.RateLimit, workers)
+
+	var mutex sync.Mutex
+	failures := ApplyErrors{}
+	failedLanes := map[string]*ApplyFailure{}
+	// failure returns the failure a command is skipped after, if any, which
+	// is that of its lane or of a lane of a resource it refers to, whose
+	// commands ran in an earlier phase
+	failure := func(c Cmd) *ApplyFailure {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !e.ContinueOnError && len(failures) > 0 {
+			return failures[0]
+		}
+		for _, lane := range c.referencedLanes() {
+			if f, ok := failedLanes[lane]; ok {
+				// the lane's later commands are skipped too
+				failedLanes[c.lane()] = f
+				return f
+			}
+		}
+		return nil
+	}
+
+	for _, lanes := range cmds.phases() {
+		var wg sync.WaitGroup
+		next := make(chan CmdList)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for lane := range next {
+					for i, c := range lane {
+						if f := failure(c); f != nil {
+							mutex.Lock()
+							f.Skipped = append(f.Skipped, lane[i:]...)
+							mutex.Unlock()
+							break
+						}
+						bucket.wait()
+						if err := e.run(c); err != nil {
+							mutex.Lock()
+							f := &ApplyFailure{Cmd: c, Err: err, Skipped: append(CmdList{}, lane[i+1:]...)}
+							failures = append(failures, f)
+							failedLanes[c.lane()] = f
+							mutex.Unlock()
+							break
+						}
+					}
+				}
+			}()
+		}
+		for _, lane := range lanes {
+			next <- lane
+		}
+		close(next)
+		wg.Wait()
+
+		if !e.ContinueOnError && len(failures) > 0 {
+			return failures[0].Err
+		}
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// run runs the command, retrying it while AWS throttles it, and records it
+// in the journal once it succeeds
+func (e Executor) run(c Cmd) error {
+	if e.Verify != nil {
+		if err := e.Verify(c); err != nil {
+			return err
+		}
+	}
+	undo, note := e.Journal.undo(c)
+	err := e.runWithRetries(c)
+	if deleted, derr := e.deleteOldestPolicyVersion(c, err); derr != nil {
+		return derr
+	} else if deleted {
+		err = e.runWithRetries(c)
+	}
+	if err != nil {
+		return err
+	}
+	return e.Journal.record(c, undo, note)
+}
+
+// A tokenBucket limits how often commands start. It holds up to burst tokens,
+// refilled at rate tokens a second, and each command takes one
+type tokenBucket struct {
+	interval time.Duration
+	burst    int
+	now      func() time.Time
+	sleep    func(time.Duration)
+
+	mutex sync.Mutex
+	// next is when the bucket is next empty
+	next time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := &tokenBucket{burst: burst, now: time.Now, sleep: time.Sleep}
+	if rate > 0 {
+		b.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return b
+}
+
+// take takes a token, returning how long to wait for it
+func (b *tokenBucket) take() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	if full := now.Add(-time.Duration(b.burst-1) * b.interval); b.next.Before(full) {
+		b.next = full
+	}
+	wait := b.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	b.next = b.next.Add(b.interval)
+	return wait
+}
+
+func (b *tokenBucket) wait() {
+	if b.interval == 0 {
+		return
+	}
+	b.sleep(b.take())
+}
@@ -0,0 +1,251 @@
+package iamy
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExecutorRunsPhasesAndLanesInOrder(t *testing.T) {
+	cmds := CmdList{}
+	cmds.Add("aws", "iam", "create-policy", "--policy-name", "reader")
+	cmds.Add("aws", "iam", "create-group", "--group-name", "readers")
+	cmds.Add("aws", "iam", "create-role", "--role-name", "app")
+	cmds.Add("aws", "iam", "attach-group-policy", "--group-name", "readers", "--policy-arn", "arn:aws:iam::123:policy/reader")
+	cmds.Add("aws", "iam", "attach-role-policy", "--role-name", "app", "--policy-arn", "arn:aws:iam::123:policy/reader")
+	cmds.Add("aws", "iam", "put-role-policy", "--role-name", "app", "--policy-name", "inline")
+
+	var mutex sync.Mutex
+	ran := []string{}
+	executor := Executor{
+		Workers: 4,
+		Run: func(c Cmd) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			ran = append(ran, c.Args[1]+" "+c.Args[3])
+			return nil
+		},
+	}
+	if err := executor.Execute(cmds.dependencyOrdered()); err != nil {
+		t.Fatal(err)
+	}
+
+	position := map[string]int{}
+	for i, r := range ran {
+		position[r] = i
+	}
+	for _, before := range [][2]string{
+		{"create-policy reader", "create-group readers"},
+		{"create-policy reader", "create-role app"},
+		{"create-group readers", "attach-group-policy readers"},
+		{"create-role app", "attach-role-policy app"},
+		{"attach-role-policy app", "put-role-policy app"},
+	} {
+		if position[before[0]] > position[before[1]] {
+			t.Errorf("Expected %s to run before %s, ran %v", before[0], before[1], ran)
+		}
+	}
+	if len(ran) != len(cmds) {
+		t.Errorf("Expected every command to run, ran %v", ran)
+	}
+}
+
+func TestExecutorStopsAtFirstError(t *testing.T) {
+	cmds := CmdList{}
+	cmds.Add("aws", "iam", "create-role", "--role-name", "app")
+	cmds.Add("aws", "iam", "attach-role-policy", "--role-name", "app", "--policy-arn", "arn:aws:iam::123:policy/reader")
+
+	ran := []string{}
+	executor := Executor{
+		Workers: 2,
+		Run: func(c Cmd) error {
+			ran = append(ran, c.Args[1])
+			return errors.New("AccessDenied")
+		},
+	}
+	if err := executor.Execute(cmds); err == nil || err.Error() != "AccessDenied" {
+		t.Errorf("Expected the command's error, got %v", err)
+	}
+	if strings.Join(ran, " ") != "create-role" {
+		t.Errorf("Expected no commands after the failure, ran %v", ran)
+	}
+}
+
+func TestExecutorContinuesOnError(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+
+	remoteData := NewAccountData("123")
+	localData := NewAccountData("123")
+	localData.addRole(&Role{iamService: iamService{Name: "broken", Path: "/"}, AssumeRolePolicyDocument: doc, Policies: []string{"reader"}})
+	localData.addRole(&Role{iamService: iamService{Name: "ok", Path: "/"}, AssumeRolePolicyDocument: doc, Policies: []string{"reader"}})
+	plan := PlanSync(remoteData, localData)
+
+	ran := []string{}
+	posted := []string{}
+	executor := Executor{
+		ContinueOnError: true,
+		Run: func(c Cmd) error {
+			ran = append(ran, c.Args[1]+" "+cmdFlag(c, "--role-name"))
+			if cmdFlag(c, "--role-name") == "broken" {
+				return errors.New("MalformedPolicyDocument")
+			}
+			return nil
+		},
+		Hooks: []ApplyHook{{Id: "notify", Resource: "iam/role/*", PostFunc: func(e HookEvent) error {
+			posted = append(posted, e.Change.Resource)
+			return nil
+		}}},
+	}
+
+	err := executor.Apply(plan)
+	failures, ok := err.(ApplyErrors)
+	if !ok || len(failures) != 1 {
+		t.Fatalf("Expected a single failure, got %v", err)
+	}
+	if f := failures[0]; f.Resource != "iam/role/broken" || f.Cmd.Args[1] != "create-role" || f.Err.Error() != "MalformedPolicyDocument" || len(f.Skipped) != 1 || f.Skipped[0].Args[1] != "attach-role-policy" {
+		t.Errorf("Unexpected failure: %+v", f)
+	}
+	if expected := "create-role broken create-role ok attach-role-policy ok"; strings.Join(ran, " ") != expected {
+		t.Errorf("Expected %s, ran %v", expected, ran)
+	}
+	if strings.Join(posted, " ") != "iam/role/ok" {
+		t.Errorf("Expected post hooks for only the changes that succeeded, got %v", posted)
+	}
+}
+
+func TestExecutorSkipsCommandsReferringToFailedResources(t *testing.T) {
+	cmds := CmdList{}
+	cmds.Add("aws", "iam", "create-policy", "--policy-name", "reader", "--path", "/team/", "--policy-document", "{}")
+	cmds.Add("aws", "iam", "create-user", "--user-name", "alice", "--path", "/")
+	cmds.Add("aws", "iam", "create-role", "--role-name", "app", "--path", "/", "--assume-role-policy-document", "{}")
+	cmds.Add("aws", "iam", "attach-role-policy", "--role-name", "app", "--policy-arn", "arn:aws:iam::123:policy/team/reader")
+	cmds.Add("aws", "iam", "put-role-policy", "--role-name", "app", "--policy-name", "inline", "--policy-document", "{}")
+	cmds.Add("aws", "iam", "put-user-permissions-boundary", "--user-name", "alice", "--permissions-boundary", "arn:aws:iam::123:policy/team/reader")
+	cmds.Add("aws", "iam", "attach-group-policy", "--group-name", "readers", "--policy-arn", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+
+	ran := []string{}
+	executor := Executor{
+		ContinueOnError: true,
+		Run: func(c Cmd) error {
+			ran = append(ran, c.Args[1])
+			if c.Args[1] == "create-policy" {
+				return errors.New("MalformedPolicyDocument")
+			}
+			return nil
+		},
+	}
+	err := executor.Execute(cmds.dependencyOrdered())
+	failures, ok := err.(ApplyErrors)
+	if !ok || len(failures) != 1 {
+		t.Fatalf("Expected a single failure, got %v", err)
+	}
+	skipped := []string{}
+	for _, c := range failures[0].Skipped {
+		skipped = append(skipped, c.Args[1])
+	}
+	sort.Strings(skipped)
+	if expected := "attach-role-policy put-role-policy put-user-permissions-boundary"; strings.Join(skipped, " ") != expected {
+		t.Errorf("Expected the commands referring to the policy, and their resources' later commands, to be skipped, got %v", skipped)
+	}
+	sort.Strings(ran)
+	if expected := "attach-group-policy create-policy create-role create-user"; strings.Join(ran, " ") != expected {
+		t.Errorf("Expected %s, ran %v", expected, ran)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newTokenBucket(2, 3)
+	b.now = func() time.Time { return now }
+
+	waits := []time.Duration{}
+	for i := 0; i < 5; i++ {
+		waits = append(waits, b.take())
+	}
+	expected := []time.Duration{0, 0, 0, 500 * time.Millisecond, time.Second}
+	for i := range expected {
+		if waits[i] != expected[i] {
+			t.Errorf("Expected waits %v, got %v", expected, waits)
+			break
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if wait := b.take(); wait != 0 {
+		t.Errorf("Expected the bucket to refill, waited %v", wait)
+	}
+}
+
+func TestExecutorRetriesThrottledCommands(t *testing.T) {
+	cmds := CmdList{}
+	cmds.Add("aws", "iam", "create-role", "--role-name", "app")
+	cmds.Add("aws", "iam", "create-role", "--role-name", "worker")
+
+	attempts := map[string]int{}
+	waits := []time.Duration{}
+	e := Executor{
+		Retry: RetryPolicy{Retries: 3, BaseDelay: time.Second, MaxDelay: 3 * time.Second},
+		Run: func(c Cmd) error {
+			attempts[c.String()]++
+			if strings.Contains(c.String(), "app") && attempts[c.String()] < 3 {
+				return &ErrThrottled{errors.New("Rate exceeded")}
+			}
+			if strings.Contains(c.String(), "worker") {
+				return errors.New("NoSuchEntity")
+			}
+			return nil
+		},
+		sleep: func(d time.Duration) { waits = append(waits, d) },
+	}
+	err := e.Execute(cmds)
+	if err == nil || err.Error() != "NoSuchEntity" {
+		t.Errorf("Expected other errors not to be retried, got %v", err)
+	}
+	if attempts[cmds[0].String()] != 3 || attempts[cmds[1].String()] != 1 {
+		t.Errorf("Expected the throttled command to be retried until it succeeded, got %v", attempts)
+	}
+	if len(waits) != 2 || waits[0] > time.Second || waits[1] > 2*time.Second {
+		t.Errorf("Expected waits up to a doubling delay, got %v", waits)
+	}
+
+	if d := e.Retry.delay(5); d != 3*time.Second {
+		t.Errorf("Expected the delay to be capped, got %s", d)
+	}
+
+	e.Retry.Retries = 1
+	attempts = map[string]int{}
+	if err = e.Execute(cmds[:1]); err == nil || attempts[cmds[0].String()] != 2 {
+		t.Errorf("Expected to give up after the retries, got %v after %d attempts", err, attempts[cmds[0].String()])
+	}
+}
+
+func TestExecutorDeletesOldestPolicyVersionAtLimit(t *testing.T) {
+	arn := "arn:aws:iam::123:policy/reader"
+	cmds := CmdList{}
+	cmds.Add("aws", "iam", "create-policy-version", "--policy-arn", arn, "--set-as-default", "--policy-document", "{}")
+
+	ran := []string{}
+	deleted := ""
+	executor := Executor{
+		Run: func(c Cmd) error {
+			ran = append(ran, c.Args[1]+" "+cmdFlag(c, "--version-id"))
+			if c.Args[1] == "create-policy-version" && len(ran) == 1 {
+				return CmdError(c, "An error occurred (LimitExceeded) when calling the CreatePolicyVersion operation: A managed policy can have up to 5 versions.", errors.New("exit status 254"))
+			}
+			return nil
+		},
+		PolicyVersions: func(policyArn string) ([]PolicyVersion, error) {
+			return []PolicyVersion{{PolicyArn: policyArn, VersionId: "v1", IsDefault: true}, {PolicyArn: policyArn, VersionId: "v2"}, {PolicyArn: policyArn, VersionId: "v3"}}, nil
+		},
+		OnVersionLimit: func(c Cmd, v PolicyVersion) { deleted = v.VersionId },
+	}
+	if err := executor.Execute(cmds); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ran, ", ") != "create-policy-version , delete-policy-version v2, create-policy-version " || deleted != "v2" {
+		t.Errorf("Expected the oldest nondefault version deleted before creating the version again, ran %v", ran)
+	}
+}
@@ -0,0 +1,88 @@
+package iamy
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// A DiffExplanation is why the differ considers a resource changed. Remote
+// and Local are the resource in AWS and in the files, as indented JSON in the
+// canonical form they're compared in, and empty when it's missing. Action is
+// what push would do about it, and empty when nothing. Attributes are the
+// attributes that differ after normalisation, Normalised those that differ
+// only until they're normalised, and Commands the commands push would run
+type DiffExplanation struct {
+	Resource   string           `json:"Resource"`
+	Remote     string           `json:"Remote,omitempty"`
+	Local      string           `json:"Local,omitempty"`
+	Action     string           `json:"Action,omitempty"`
+	Attributes []AttributeDrift `json:"Attributes,omitempty"`
+	Normalised []string         `json:"Normalised,omitempty"`
+	Commands   []PlanCommand    `json:"Commands,omitempty"`
+}
+
+// Phantom is whether push would run commands for the resource though none
+// of its attributes differ after normalisation, which is a differ bug
+func (e DiffExplanation) Phantom() bool {
+	return len(e.Commands) > 0 && len(e.Attributes) == 0 && e.Remote != "" && e.Local != ""
+}
+
+// ExplainDiff explains the differences between AWS and the files for each
+// resource the selector selects. The plan is made of the selected resources
+// and those they refer to, without detecting renames or planning deletions
+func ExplainDiff(aws, files *AccountData, selector ResourceSelector) []DiffExplanation {
+	from, to := SelectResources(aws, files, []ResourceSelector{selector})
+	plan := PlanSyncWithOptions(from, to, SyncOptions{DisableRenameDetection: true, DisablePrune: true})
+	changes := map[string]PlanChange{}
+	for _, ch := range plan.jsonPlan().Changes {
+		changes[ch.Resource] = ch
+	}
+
+	remote, local := map[string]AwsResource{}, map[string]AwsResource{}
+	keys := []string{}
+	for _, r := range aws.Select(selector) {
+		remote[resourceKey(r)] = r
+		keys = append(keys, resourceKey(r))
+	}
+	for _, r := range files.Select(selector) {
+		if _, ok := remote[resourceKey(r)]; !ok {
+			keys = append(keys, resourceKey(r))
+		}
+		local[resourceKey(r)] = r
+	}
+	sort.Strings(keys)
+
+	explanations := []DiffExplanation{}
+	for _, key := range keys {
+		e := DiffExplanation{
+			Resource: key,
+			Remote:   canonicalJson(remote[key]),
+			Local:    canonicalJson(local[key]),
+			Action:   changes[key].Action,
+			Commands: changes[key].Commands,
+		}
+		switch {
+		case remote[key] == nil:
+			e.Action = "create"
+		case local[key] == nil:
+			e.Action = "delete"
+		default:
+			e.Attributes, e.Normalised = compareAttributes(remote[key], local[key])
+		}
+		explanations = append(explanations, e)
+	}
+	return explanations
+}
+
+// canonicalJson returns the resource as indented JSON, with its policy
+// documents normalised, or empty for a missing resource
+func canonicalJson(r AwsResource) string {
+	if r == nil {
+		return ""
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
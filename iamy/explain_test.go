@@ -0,0 +1,54 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainDiff(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"},{"Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	reordered := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":"sts:AssumeRole"},{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, Description: "old", AssumeRolePolicyDocument: trust})
+	remoteData.addRole(&Role{iamService: iamService{Name: "app-manual", Path: "/"}, AssumeRolePolicyDocument: trust})
+	remoteData.addRole(&Role{iamService: iamService{Name: "other", Path: "/"}, Description: "old", AssumeRolePolicyDocument: trust})
+
+	localData := NewAccountData("123")
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, Description: "new", AssumeRolePolicyDocument: reordered})
+	localData.addRole(&Role{iamService: iamService{Name: "app-worker", Path: "/"}, AssumeRolePolicyDocument: trust})
+	localData.addRole(&Role{iamService: iamService{Name: "other", Path: "/"}, Description: "new", AssumeRolePolicyDocument: trust})
+
+	selector, err := ParseResourceSelector("role/app*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	explanations := ExplainDiff(remoteData, localData, selector)
+	if len(explanations) != 3 {
+		t.Fatalf("Expected the three selected roles to be explained, got %+v", explanations)
+	}
+
+	app := explanations[0]
+	if app.Resource != "iam/role/app" || app.Action != "update" || len(app.Commands) == 0 {
+		t.Fatalf("Expected the role to be updated, got %+v", app)
+	}
+	if !strings.Contains(app.Remote, `"Description": "old"`) || !strings.Contains(app.Local, `"Description": "new"`) {
+		t.Errorf("Expected the canonical forms of the role, got\n%s\n%s", app.Remote, app.Local)
+	}
+	if len(app.Attributes) != 1 || app.Attributes[0].Name != "Description" {
+		t.Errorf("Expected only the description to differ after normalisation, got %+v", app.Attributes)
+	}
+	if len(app.Normalised) != 1 || app.Normalised[0] != "AssumeRolePolicyDocument" {
+		t.Errorf("Expected the reordered trust policy to be equal once normalised, got %v", app.Normalised)
+	}
+	if app.Phantom() {
+		t.Error("Expected a role with a changed description not to be phantom drift")
+	}
+
+	if e := explanations[1]; e.Resource != "iam/role/app-manual" || e.Action != "delete" || e.Local != "" {
+		t.Errorf("Expected the role missing from the files to be explained as a delete, got %+v", e)
+	}
+	if e := explanations[2]; e.Resource != "iam/role/app-worker" || e.Action != "create" || e.Remote != "" || len(e.Commands) == 0 {
+		t.Errorf("Expected the role missing from AWS to be explained as a create, got %+v", e)
+	}
+}
@@ -0,0 +1,74 @@
+package iamy
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+// Run with eg. go test ./iamy -run '^$' -fuzz FuzzNewPolicyDocumentFromEncodedJson
+// Seed inputs live in testdata/fuzz/<FuzzTestName>
+
+func FuzzNewPolicyDocumentFromEncodedJson(f *testing.F) {
+	f.Add(url.QueryEscape(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":"*"}]}`))
+	f.Add(`%7B%22Version%22%3A%222012-10-17%22%7D`)
+	f.Add(`null`)
+
+	f.Fuzz(func(t *testing.T, encoded string) {
+		doc, err := NewPolicyDocumentFromEncodedJson(encoded)
+		if err != nil {
+			return
+		}
+
+		// normalising must be idempotent, otherwise pull and push will disagree
+		first := doc.JsonString()
+		again, err := NewPolicyDocumentFromJson(first)
+		if err != nil {
+			t.Fatalf("Normalised document doesn't parse: %s\n%s", err, first)
+		}
+		if second := again.JsonString(); first != second {
+			t.Fatalf("Normalising isn't idempotent:\n%s\n%s", first, second)
+		}
+	})
+}
+
+func FuzzYamlLoad(f *testing.F) {
+	f.Add([]byte("AssumeRolePolicyDocument:\n  Statement:\n  - Action: sts:AssumeRole\n    Effect: Allow\n    Principal:\n      Service: ec2.amazonaws.com\n"))
+	f.Add([]byte("Policies:\n- ReadOnly\nInlinePolicies:\n- Name: a\n  Policy: {}\n"))
+	f.Add([]byte("Policy: ~\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var r Role
+		if err := yaml.Unmarshal(data, &r); err != nil {
+			return
+		}
+
+		// anything we load we must be able to dump and load again
+		out, err := yaml.Marshal(r)
+		if err != nil {
+			t.Fatalf("Loaded role can't be dumped: %s", err)
+		}
+		var again Role
+		if err = yaml.Unmarshal(out, &again); err != nil {
+			t.Fatalf("Dumped role can't be loaded: %s\n%s", err, out)
+		}
+	})
+}
+
+func FuzzNormalisePolicyArn(f *testing.F) {
+	f.Add("123456789012", "arn:aws:iam::123456789012:policy/path/name")
+	f.Add("123456789012", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+	f.Add("123456789012", "name")
+
+	f.Fuzz(func(t *testing.T, accountId, arn string) {
+		a := Account{Id: accountId}
+		if !strings.HasPrefix(arn, "arn:") {
+			return
+		}
+		if roundTripped := a.policyArnFromString(a.normalisePolicyArn(arn)); roundTripped != arn {
+			t.Fatalf("Expected %s to round trip, got %s", arn, roundTripped)
+		}
+	})
+}
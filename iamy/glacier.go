@@ -0,0 +1,122 @@
+package iamy
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/aws/aws-sdk-go/service/glacier/glacieriface"
+)
+
+// glacierVaultType labels skipped vaults. CloudFormation has no Glacier vault
+// resource, so vaults are only skipped by their tags and names
+const glacierVaultType CfnResourceType = "AWS::Glacier::Vault"
+
+// glacierAccountId is the account id Glacier accepts for the account of the
+// credentials used
+const glacierAccountId = "-"
+
+type glacierClient struct {
+	sess    *session.Session
+	clients map[string]glacieriface.GlacierAPI
+	mutex   sync.Mutex
+}
+
+func newGlacierClient(sess *session.Session) *glacierClient {
+	return &glacierClient{
+		sess:    sess,
+		clients: map[string]glacieriface.GlacierAPI{},
+	}
+}
+
+func (c *glacierClient) withRegion(region string) glacieriface.GlacierAPI {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.clients[region]; !ok {
+		c.clients[region] = glacier.New(c.sess, aws.NewConfig().WithRegion(region))
+	}
+
+	return c.clients[region]
+}
+
+type glacierVault struct {
+	name           string
+	policyJson     string
+	lockPolicyJson string
+	lockState      string
+	tags           map[string]string
+}
+
+func (c *glacierClient) listVaults(region string) ([]*glacierVault, error) {
+	names := []string{}
+	err := c.withRegion(region).ListVaultsPages(&glacier.ListVaultsInput{AccountId: aws.String(glacierAccountId)},
+		func(resp *glacier.ListVaultsOutput, lastPage bool) bool {
+			for _, v := range resp.VaultList {
+				names = append(names, aws.StringValue(v.VaultName))
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	vaults := []*glacierVault{}
+	for _, name := range names {
+		v, err := c.getVault(region, name)
+		if err != nil {
+			return nil, err
+		}
+		vaults = append(vaults, v)
+	}
+
+	return vaults, nil
+}
+
+func (c *glacierClient) getVault(region, name string) (*glacierVault, error) {
+	client := c.withRegion(region)
+	v := glacierVault{name: name}
+
+	policyResp, err := client.GetVaultAccessPolicy(&glacier.GetVaultAccessPolicyInput{
+		AccountId: aws.String(glacierAccountId),
+		VaultName: aws.String(name),
+	})
+	if err != nil && !isGlacierNotFound(err) {
+		return nil, err
+	}
+	if err == nil && policyResp.Policy != nil {
+		v.policyJson = aws.StringValue(policyResp.Policy.Policy)
+	}
+
+	lockResp, err := client.GetVaultLock(&glacier.GetVaultLockInput{
+		AccountId: aws.String(glacierAccountId),
+		VaultName: aws.String(name),
+	})
+	if err != nil && !isGlacierNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		v.lockPolicyJson = aws.StringValue(lockResp.Policy)
+		v.lockState = aws.StringValue(lockResp.State)
+	}
+
+	tagsResp, err := client.ListTagsForVault(&glacier.ListTagsForVaultInput{
+		AccountId: aws.String(glacierAccountId),
+		VaultName: aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	v.tags = aws.StringValueMap(tagsResp.Tags)
+
+	return &v, nil
+}
+
+// isGlacierNotFound is true for the error Glacier returns for a vault without
+// an access policy or vault lock
+func isGlacierNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == glacier.ErrCodeResourceNotFoundException
+}
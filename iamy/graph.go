@@ -0,0 +1,173 @@
+package iamy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The shapes the graph draws each type of node as
+var graphShapes = map[string]string{
+	"user":             "ellipse",
+	"group":            "folder",
+	"role":             "box",
+	"policy":           "note",
+	"instance-profile": "component",
+	"principal":        "diamond",
+}
+
+// dotString quotes a string as a DOT ID
+func dotString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// A dotGraph writes a DOT graph, declaring each node once
+type dotGraph struct {
+	w        *bufio.Writer
+	declared map[string]bool
+}
+
+func (g *dotGraph) line(indent, format string, args ...interface{}) {
+	fmt.Fprintf(g.w, indent+format+"\n", args...)
+}
+
+// node declares a node of a type, with its type and name as its label
+func (g *dotGraph) node(indent, id, nodeType, name string) {
+	if g.declared[id] {
+		return
+	}
+	g.declared[id] = true
+	g.line(indent, "%s [shape=%s, label=%s];", dotString(id), graphShapes[nodeType], dotString(nodeType+"\n"+name))
+}
+
+func (g *dotGraph) edge(indent, from, to, label, style string) {
+	attrs := []string{"label=" + dotString(label)}
+	if style != "" {
+		attrs = append(attrs, "style="+style)
+	}
+	g.line(indent, "%s -> %s [%s];", dotString(from), dotString(to), strings.Join(attrs, ", "))
+}
+
+// policyNode returns the node of a managed policy a user, group or role
+// refers to, and its name
+func policyNode(account *Account, ref string) (string, string) {
+	arn := account.policyArnFromString(ref)
+	return arn, arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// WriteDotGraph writes the accounts' permission topology as a Graphviz DOT
+// graph, for dot and other Graphviz tools to draw: users to the groups they
+// are in, users, groups and roles to the managed policies they attach and
+// their permissions boundaries, roles to the principals their trust policies
+// allow to assume them, and instance profiles to their roles. Each account is
+// a cluster, and the principals and AWS managed policies, which can be shared
+// between accounts, are outside them
+func WriteDotGraph(w io.Writer, accounts []*AccountData) error {
+	g := &dotGraph{w: bufio.NewWriter(w), declared: map[string]bool{}}
+	g.line("", "digraph iamy {")
+	g.line("\t", "rankdir=LR;")
+	g.line("\t", "node [fontname=Helvetica];")
+	g.line("\t", "edge [fontname=Helvetica, fontsize=10];")
+
+	// the nodes shared between accounts
+	principals := []string{}
+	awsPolicies := []string{}
+	for _, data := range accounts {
+		for _, r := range data.Roles {
+			for _, p := range trustPrincipals(r.AssumeRolePolicyDocument) {
+				if !stringSliceContains(principals, p) {
+					principals = append(principals, p)
+				}
+			}
+		}
+		for _, arn := range data.awsManagedPolicyArns() {
+			if !stringSliceContains(awsPolicies, arn) {
+				awsPolicies = append(awsPolicies, arn)
+			}
+		}
+	}
+	sort.Strings(principals)
+	sort.Strings(awsPolicies)
+	for _, p := range principals {
+		g.node("\t", "principal:"+p, "principal", p)
+	}
+	for _, arn := range awsPolicies {
+		g.node("\t", arn, "policy", "aws/"+arn[strings.LastIndex(arn, "/")+1:])
+	}
+
+	for i, data := range accounts {
+		a := data.Account
+		g.line("\t", "subgraph %s {", dotString(fmt.Sprintf("cluster_%d", i)))
+		g.line("\t\t", "label=%s;", dotString(a.String()))
+
+		for _, p := range data.Policies {
+			g.node("\t\t", Arn(p, a), "policy", p.Name)
+		}
+		// users and instance profiles refer to groups and roles by name,
+		// which is unique whatever their path
+		groups, roles := map[string]string{}, map[string]string{}
+		for _, grp := range data.Groups {
+			g.node("\t\t", Arn(grp, a), "group", grp.Name)
+			groups[grp.Name] = Arn(grp, a)
+		}
+		for _, u := range data.Users {
+			g.node("\t\t", Arn(u, a), "user", u.Name)
+		}
+		for _, r := range data.Roles {
+			g.node("\t\t", Arn(r, a), "role", r.Name)
+			roles[r.Name] = Arn(r, a)
+		}
+		for _, p := range data.InstanceProfiles {
+			g.node("\t\t", Arn(p, a), "instance-profile", p.Name)
+		}
+
+		attachments := func(from string, refs []string, boundary string) {
+			for _, ref := range refs {
+				id, name := policyNode(a, ref)
+				g.node("\t\t", id, "policy", name)
+				g.edge("\t\t", from, id, "attaches", "")
+			}
+			if boundary != "" {
+				id, name := policyNode(a, boundary)
+				g.node("\t\t", id, "policy", name)
+				g.edge("\t\t", from, id, "boundary", "dashed")
+			}
+		}
+		for _, u := range data.Users {
+			for _, name := range u.Groups {
+				id, ok := groups[name]
+				if !ok {
+					id = a.arnFor("group", "/", name)
+				}
+				g.node("\t\t", id, "group", name)
+				g.edge("\t\t", Arn(u, a), id, "member of", "")
+			}
+			attachments(Arn(u, a), u.Policies, u.PermissionsBoundary)
+		}
+		for _, grp := range data.Groups {
+			attachments(Arn(grp, a), grp.Policies, "")
+		}
+		for _, r := range data.Roles {
+			attachments(Arn(r, a), r.Policies, r.PermissionsBoundary)
+			for _, p := range trustPrincipals(r.AssumeRolePolicyDocument) {
+				g.edge("\t\t", Arn(r, a), "principal:"+p, "trusts", "")
+			}
+		}
+		for _, p := range data.InstanceProfiles {
+			for _, name := range p.Roles {
+				id, ok := roles[name]
+				if !ok {
+					id = a.arnFor("role", "/", name)
+				}
+				g.node("\t\t", id, "role", name)
+				g.edge("\t\t", Arn(p, a), id, "contains", "")
+			}
+		}
+		g.line("\t", "}")
+	}
+
+	g.line("", "}")
+	return g.w.Flush()
+}
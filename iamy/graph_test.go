@@ -0,0 +1,50 @@
+package iamy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteDotGraph(t *testing.T) {
+	readOnly := "arn:aws:iam::aws:policy/ReadOnlyAccess"
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	policy := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+
+	data := NewAccountData("myalias-123")
+	data.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}, Groups: []string{"devs"}, PermissionsBoundary: "boundary"})
+	data.addGroup(&Group{iamService: iamService{Name: "devs", Path: "/team/"}, Policies: []string{"reader", readOnly}})
+	data.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{readOnly}})
+	data.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: policy})
+	data.addInstanceProfile(&InstanceProfile{iamService: iamService{Name: "app", Path: "/"}, Roles: []string{"app"}})
+	other := NewAccountData("456")
+	other.addRole(&Role{iamService: iamService{Name: "web\"server", Path: "/"}, AssumeRolePolicyDocument: trust})
+
+	var b bytes.Buffer
+	if err := WriteDotGraph(&b, []*AccountData{data, other}); err != nil {
+		t.Fatal(err)
+	}
+	graph := b.String()
+
+	for _, line := range []string{
+		"digraph iamy {\n",
+		"\t\"principal:Service ec2.amazonaws.com\" [shape=diamond, label=\"principal\\nService ec2.amazonaws.com\"];\n",
+		"\t\"arn:aws:iam::aws:policy/ReadOnlyAccess\" [shape=note, label=\"policy\\naws/ReadOnlyAccess\"];\n",
+		"\tsubgraph \"cluster_0\" {\n\t\tlabel=\"myalias-123\";\n",
+		"\t\t\"arn:aws:iam::123:user/alice\" -> \"arn:aws:iam::123:group/team/devs\" [label=\"member of\"];\n",
+		"\t\t\"arn:aws:iam::123:user/alice\" -> \"arn:aws:iam::123:policy/boundary\" [label=\"boundary\", style=dashed];\n",
+		"\t\t\"arn:aws:iam::123:group/team/devs\" -> \"arn:aws:iam::123:policy/reader\" [label=\"attaches\"];\n",
+		"\t\t\"arn:aws:iam::123:group/team/devs\" -> \"arn:aws:iam::aws:policy/ReadOnlyAccess\" [label=\"attaches\"];\n",
+		"\t\t\"arn:aws:iam::123:role/app\" -> \"principal:Service ec2.amazonaws.com\" [label=\"trusts\"];\n",
+		"\t\t\"arn:aws:iam::123:instance-profile/app\" -> \"arn:aws:iam::123:role/app\" [label=\"contains\"];\n",
+		"\tsubgraph \"cluster_1\" {\n\t\tlabel=\"456\";\n",
+		"\t\t\"arn:aws:iam::456:role/web\\\"server\" [shape=box, label=\"role\\nweb\\\"server\"];\n",
+	} {
+		if !strings.Contains(graph, line) {
+			t.Errorf("Expected the graph to have %q, got\n%s", line, graph)
+		}
+	}
+	if n := strings.Count(graph, "[shape=diamond"); n != 1 {
+		t.Errorf("Expected the principal declared once, got %d in\n%s", n, graph)
+	}
+}
@@ -0,0 +1,197 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// HooksFileName is the file in the yaml directory that configures the hooks
+// push runs around applying changes
+const HooksFileName = ".iamy-hooks.yaml"
+
+// An ApplyHook is run around applying the changes to resources matching it.
+// Resource is a pattern of the resource's file in the account directory
+// without the extension, as in the JSON plan, and Account a pattern of the
+// account id or alias-id, where * and ? match any characters, including /.
+// Actions limits the hook to changes with those actions
+type ApplyHook struct {
+	Id       string   `json:"Id"`
+	Resource string   `json:"Resource"`
+	Account  string   `json:"Account,omitempty"`
+	Actions  []string `json:"Actions,omitempty"`
+	// Pre and Post are shell commands run before and after the changes
+	Pre  string `json:"Pre,omitempty"`
+	Post string `json:"Post,omitempty"`
+
+	// PreFunc and PostFunc are called instead of running Pre and Post, for
+	// programs using iamy as a library
+	PreFunc  func(HookEvent) error `json:"-"`
+	PostFunc func(HookEvent) error `json:"-"`
+}
+
+// A HookEvent is a hook being run for a change
+type HookEvent struct {
+	Hook    string
+	Stage   string
+	Account *Account
+	Change  PlanChange
+}
+
+// The stages hooks run at
+const (
+	HookStagePre  = "pre"
+	HookStagePost = "post"
+)
+
+var hookActions = []string{"create", "update", "delete", "rename"}
+
+func (h ApplyHook) matches(account *Account, c PlanChange) bool {
+	if h.Account != "" && !globCovers(h.Account, account.Id) && !globCovers(h.Account, account.String()) {
+		return false
+	}
+	if len(h.Actions) > 0 && !stringSliceContains(h.Actions, c.Action) {
+		return false
+	}
+	return globCovers(h.Resource, c.Resource) || (c.RenamedFrom != "" && globCovers(h.Resource, c.RenamedFrom))
+}
+
+func (h ApplyHook) validate() error {
+	if h.Id == "" {
+		return errors.New("Hooks must have an Id")
+	}
+	if h.Resource == "" {
+		return errors.Errorf("Hook %s must have a Resource", h.Id)
+	}
+	if h.Pre == "" && h.Post == "" && h.PreFunc == nil && h.PostFunc == nil {
+		return errors.Errorf("Hook %s must have a Pre or Post command", h.Id)
+	}
+	for _, a := range h.Actions {
+		if !stringSliceContains(hookActions, a) {
+			return errors.Errorf("Hook %s has an unknown action %s", h.Id, a)
+		}
+	}
+	return nil
+}
+
+// LoadApplyHooks reads the hooks file in dir. Without one there are no hooks
+func LoadApplyHooks(dir string) ([]ApplyHook, error) {
+	file := struct {
+		Hooks []ApplyHook `json:"Hooks"`
+	}{}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, HooksFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		return nil, validationError(HooksFileName, err)
+	}
+	for _, h := range file.Hooks {
+		if err := h.validate(); err != nil {
+			return nil, validationError(HooksFileName, err)
+		}
+	}
+
+	return file.Hooks, nil
+}
+
+// runHooks runs the hooks for the stage of every change matching them, in
+// the order of the hooks and then the changes
+func (e Executor) runHooks(stage string, account *Account, changes []PlanChange) error {
+	for _, h := range e.Hooks {
+		command, fn := h.Pre, h.PreFunc
+		if stage == HookStagePost {
+			command, fn = h.Post, h.PostFunc
+		}
+		if command == "" && fn == nil {
+			continue
+		}
+
+		for _, c := range changes {
+			if !h.matches(account, c) {
+				continue
+			}
+			event := HookEvent{Hook: h.Id, Stage: stage, Account: account, Change: c}
+			var err error
+			if fn != nil {
+				err = fn(event)
+			} else {
+				err = e.RunHook(command, event)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "%s hook %s for %s", stage, h.Id, c.Resource)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply runs the plan's commands. Pre hooks run before any command, and a
+// failing pre hook stops the plan being applied. Post hooks run once every
+// command has succeeded, or with ContinueOnError, for the changes whose
+// commands all succeeded
+func (e Executor) Apply(plan *SyncPlan) error {
+	p := plan.jsonPlan()
+
+	if err := e.runHooks(HookStagePre, p.Account, p.Changes); err != nil {
+		return err
+	}
+	err := e.Execute(plan.Cmds)
+	failures, ok := err.(ApplyErrors)
+	if err != nil && !ok {
+		return err
+	}
+
+	succeeded := []PlanChange{}
+	for _, c := range p.Changes {
+		if !failures.attribute(c) {
+			succeeded = append(succeeded, c)
+		}
+	}
+	if err := e.runHooks(HookStagePost, p.Account, succeeded); err != nil {
+		if len(failures) == 0 {
+			return err
+		}
+		failures = append(failures, &ApplyFailure{Err: err})
+	}
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// attribute sets the resource of the failures of the change's commands,
+// returning whether any of its commands failed or were skipped
+func (e ApplyErrors) attribute(change PlanChange) bool {
+	inChange := func(c Cmd) bool {
+		for _, pc := range change.Commands {
+			if pc.Shell == c.String() {
+				return true
+			}
+		}
+		return false
+	}
+
+	found := false
+	for _, f := range e {
+		if inChange(f.Cmd) {
+			f.Resource = change.Resource
+			found = true
+			continue
+		}
+		for _, c := range f.Skipped {
+			if inChange(c) {
+				found = true
+			}
+		}
+	}
+	return found
+}
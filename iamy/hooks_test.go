@@ -0,0 +1,102 @@
+package iamy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadApplyHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hookstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if hooks, err := LoadApplyHooks(dir); err != nil || len(hooks) != 0 {
+		t.Errorf("Expected no hooks without a hooks file, got %v %v", hooks, err)
+	}
+
+	file := `
+Hooks:
+- Id: invalidate-cache
+  Resource: iam/role/app-*
+  Actions: [update]
+  Post: ./invalidate-cache.sh
+`
+	if err = ioutil.WriteFile(filepath.Join(dir, HooksFileName), []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := LoadApplyHooks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 1 || hooks[0].Id != "invalidate-cache" || hooks[0].Post != "./invalidate-cache.sh" || !reflect.DeepEqual(hooks[0].Actions, []string{"update"}) {
+		t.Errorf("Unexpected hooks: %+v", hooks)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, HooksFileName), []byte("Hooks:\n- Id: bad\n  Resource: iam/*\n  Actions: [modify]\n  Pre: echo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadApplyHooks(dir); err == nil || !strings.Contains(err.Error(), "unknown action modify") {
+		t.Errorf("Expected an unknown action error, got %v", err)
+	}
+}
+
+func TestApplyRunsHooksAroundCommands(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addRole(&Role{iamService: iamService{Name: "app-web", Path: "/"}, AssumeRolePolicyDocument: doc})
+	localData := NewAccountData("123")
+	localData.addRole(&Role{iamService: iamService{Name: "app-web", Path: "/"}, AssumeRolePolicyDocument: doc, Policies: []string{"reader"}})
+	localData.addRole(&Role{iamService: iamService{Name: "other", Path: "/"}, AssumeRolePolicyDocument: doc})
+	plan := PlanSync(remoteData, localData)
+
+	ran := []string{}
+	executor := Executor{
+		Run: func(c Cmd) error {
+			ran = append(ran, c.Args[1])
+			return nil
+		},
+		Hooks: []ApplyHook{
+			{Id: "notify", Resource: "iam/role/app-*", Pre: "./notify.sh"},
+			{Id: "invalidate", Resource: "iam/role/*", Actions: []string{"update"}, PostFunc: func(e HookEvent) error {
+				ran = append(ran, "post "+e.Hook+" "+e.Change.Resource)
+				return nil
+			}},
+		},
+		RunHook: func(command string, e HookEvent) error {
+			ran = append(ran, e.Stage+" "+command+" "+e.Change.Resource)
+			return nil
+		},
+	}
+	if err := executor.Apply(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"pre ./notify.sh iam/role/app-web",
+		"create-role",
+		"attach-role-policy",
+		"post invalidate iam/role/app-web",
+	}
+	if !reflect.DeepEqual(ran, expected) {
+		t.Errorf("Expected %v, ran %v", expected, ran)
+	}
+
+	ran = []string{}
+	executor.RunHook = func(string, HookEvent) error {
+		return errors.New("owner not notified")
+	}
+	if err := executor.Apply(plan); err == nil || !strings.Contains(err.Error(), "pre hook notify for iam/role/app-web") {
+		t.Errorf("Expected the pre hook's error, got %v", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("Expected no commands after a pre hook failed, ran %v", ran)
+	}
+}
@@ -25,6 +25,22 @@ func (c *iamClient) getPolicyDescription(arn string) (string, error) {
 	return "", err
 }
 
+func (c *iamClient) getPolicyDefaultVersion(arn string) (string, error) {
+	resp, err := c.GetPolicy(&iam.GetPolicyInput{PolicyArn: &arn})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.Policy.DefaultVersionId), nil
+}
+
+func (c *iamClient) getPolicyVersionDocument(arn, versionId string) (*PolicyDocument, error) {
+	resp, err := c.GetPolicyVersion(&iam.GetPolicyVersionInput{PolicyArn: &arn, VersionId: &versionId})
+	if err != nil {
+		return nil, err
+	}
+	return NewPolicyDocumentFromEncodedJson(aws.StringValue(resp.PolicyVersion.Document))
+}
+
 func (c *iamClient) getPolicyTags(arn string) (map[string]string, error) {
 	resp, err := c.ListPolicyTags(&iam.ListPolicyTagsInput{PolicyArn: &arn})
 	if err == nil && resp.Tags != nil {
@@ -52,13 +68,15 @@ func (c *iamClient) getRole(name string) (string, int, error) {
 	return description, int(sessionDuration), err
 }
 
-func (c *iamClient) MustGetSecurityCredsForUser(username string) (accessKeyIds, mfaIds []string, hasLoginProfile bool) {
+// getSecurityCredsForUser returns the ids of the user's access keys and MFA
+// devices, and whether it has a console password
+func (c *iamClient) getSecurityCredsForUser(username string) (accessKeyIds, mfaIds []string, hasLoginProfile bool, err error) {
 	// access keys
 	listUsersResp, err := c.ListAccessKeys(&iam.ListAccessKeysInput{
 		UserName: aws.String(username),
 	})
 	if err != nil {
-		panic(err)
+		return nil, nil, false, err
 	}
 	for _, m := range listUsersResp.AccessKeyMetadata {
 		accessKeyIds = append(accessKeyIds, *m.AccessKeyId)
@@ -69,19 +87,15 @@ func (c *iamClient) MustGetSecurityCredsForUser(username string) (accessKeyIds,
 		UserName: aws.String(username),
 	})
 	if err != nil {
-		panic(err)
+		return nil, nil, false, err
 	}
 	for _, m := range mfaResp.MFADevices {
 		mfaIds = append(mfaIds, *m.SerialNumber)
 	}
 
-	// login profile
+	// login profile, which is missing without a console password
 	_, err = c.GetLoginProfile(&iam.GetLoginProfileInput{
 		UserName: aws.String(username),
 	})
-	if err == nil {
-		hasLoginProfile = true
-	}
-
-	return
+	return accessKeyIds, mfaIds, err == nil, nil
 }
@@ -0,0 +1,293 @@
+package iamy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// IgnoreFileName is the file in the yaml directory that extends and
+// overrides the built-in ignore rules
+const IgnoreFileName = ".iamy-ignore.yaml"
+
+// An IgnoreRule skips resources AWS creates and manages itself, which would
+// otherwise reappear in every pull. Name and Path are patterns where * and ?
+// match any characters, including /. A resource must match every field set
+type IgnoreRule struct {
+	Id     string `json:"Id"`
+	Type   string `json:"Type,omitempty"`
+	Name   string `json:"Name,omitempty"`
+	Path   string `json:"Path,omitempty"`
+	Tag    string `json:"Tag,omitempty"`
+	Reason string `json:"Reason,omitempty"`
+}
+
+func (r IgnoreRule) String() string {
+	if r.Reason == "" {
+		return r.Id
+	}
+	return fmt.Sprintf("%s (%s)", r.Id, r.Reason)
+}
+
+// ignoreRuleTypes are the resource types rules can be limited to
+var ignoreRuleTypes = map[CfnResourceType]string{
+	CfnIamUser:                "user",
+	CfnIamGroup:               "group",
+	CfnIamRole:                "role",
+	CfnIamPolicy:              "policy",
+	CfnInstanceProfile:        "instance-profile",
+	CfnS3Bucket:               "bucket",
+	CfnS3AccessPoint:          "accesspoint",
+	CfnS3ObjectLambda:         "objectlambda",
+	CfnS3MultiRegion:          "mrap",
+	CfnCodeArtifactDomain:     "codeartifact-domain",
+	CfnCodeArtifactRepository: "codeartifact-repository",
+	CfnSesEmailIdentity:       "ses-identity",
+	CfnApiGatewayRestApi:      "restapi",
+	glacierVaultType:          "vault",
+}
+
+func isIgnoreRuleType(t string) bool {
+	for _, v := range ignoreRuleTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (r IgnoreRule) matches(cfnType CfnResourceType, name, path string, tags map[string]string) bool {
+	if r.Type != "" && r.Type != ignoreRuleTypes[cfnType] {
+		return false
+	}
+	if r.Name != "" && !globCovers(r.Name, name) {
+		return false
+	}
+	if r.Path != "" && (path == nonIamResourcePath || !globCovers(r.Path, path)) {
+		return false
+	}
+	if r.Tag != "" {
+		if _, ok := tags[r.Tag]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (r IgnoreRule) validate() error {
+	if r.Id == "" {
+		return errors.New("Ignore rules must have an Id")
+	}
+	if r.Type != "" && !isIgnoreRuleType(r.Type) {
+		return errors.Errorf("Ignore rule %s has an unknown Type %s", r.Id, r.Type)
+	}
+	if r.Name == "" && r.Path == "" && r.Tag == "" {
+		return errors.Errorf("Ignore rule %s must have a Name, Path or Tag", r.Id)
+	}
+	return nil
+}
+
+// BuiltinIgnoreRules are the resources AWS features create in accounts that
+// iamy ignores unless an ignore file disables the rule
+var BuiltinIgnoreRules = []IgnoreRule{
+	{Id: "sso-reserved-roles", Type: "role", Path: "/aws-reserved/sso.amazonaws.com/*", Reason: "IAM Identity Center creates a role for each permission set assigned to the account"},
+	{Id: "stackset-execution-roles", Type: "role", Name: "stacksets-exec-*", Reason: "created by service-managed CloudFormation StackSets"},
+}
+
+// IgnoreRules adds rules, and disables rules by their Id. Disable entries are
+// patterns, so "*" disables every built-in rule
+type IgnoreRules struct {
+	Disable []string     `json:"Disable,omitempty"`
+	Rules   []IgnoreRule `json:"Rules,omitempty"`
+}
+
+// An IgnoreCatalogue is the contents of an ignore file. Its rules apply to
+// every account, and Accounts adds and disables rules for a single account,
+// keyed by account id or alias-id as in the yaml directory
+type IgnoreCatalogue struct {
+	IgnoreRules
+	Accounts map[string]IgnoreRules `json:"Accounts,omitempty"`
+}
+
+func isDisabledRule(disable []string, id string) bool {
+	for _, d := range disable {
+		if globCovers(d, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesFor returns the built-in rules that aren't disabled for the account
+// and the rules added for it. A nil catalogue returns the built-in rules
+func (c *IgnoreCatalogue) rulesFor(account *Account) []IgnoreRule {
+	if c == nil {
+		return BuiltinIgnoreRules
+	}
+
+	layers := []IgnoreRules{c.IgnoreRules}
+	for key, rules := range c.Accounts {
+		if key == account.Id || key == account.String() {
+			layers = append(layers, rules)
+		}
+	}
+
+	disable := []string{}
+	for _, l := range layers {
+		disable = append(disable, l.Disable...)
+	}
+
+	result := []IgnoreRule{}
+	for _, r := range BuiltinIgnoreRules {
+		if !isDisabledRule(disable, r.Id) {
+			result = append(result, r)
+		}
+	}
+	for _, l := range layers {
+		result = append(result, l.Rules...)
+	}
+
+	return result
+}
+
+// ignoreRulesOption describes the rules for OptionsHash
+func ignoreRulesOption(rules []IgnoreRule) string {
+	descriptions := []string{}
+	for _, r := range rules {
+		descriptions = append(descriptions, strings.Join([]string{r.Id, r.Type, r.Name, r.Path, r.Tag}, ":"))
+	}
+	sort.Strings(descriptions)
+	return strings.Join(descriptions, ",")
+}
+
+// LoadIgnoreCatalogue reads the ignore file in dir. Without one, only the
+// built-in rules apply
+func LoadIgnoreCatalogue(dir string) (*IgnoreCatalogue, error) {
+	c := IgnoreCatalogue{}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, IgnoreFileName))
+	if os.IsNotExist(err) {
+		return &c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(data, &c); err != nil {
+		return nil, validationError(IgnoreFileName, err)
+	}
+
+	rules := c.Rules
+	for _, a := range c.Accounts {
+		rules = append(rules, a.Rules...)
+	}
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, validationError(IgnoreFileName, err)
+		}
+	}
+
+	return &c, nil
+}
+
+func (a *AwsFetcher) isIncludedTagged(tags map[string]string) bool {
+	for _, tag := range a.IncludeTagged {
+		if _, ok := tags[tag]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnoredResource returns whether the resource is skipped by an ignore rule
+// or as managed by Control Tower, and why. Unlike the other skip options,
+// these skip resources by default
+func (a *AwsFetcher) isIgnoredResource(cfnType CfnResourceType, resourceIdentifier string, tags map[string]string, resourcePath string) (bool, string) {
+	if a.isIncludedTagged(tags) {
+		return false, ""
+	}
+	if !a.IncludeControlTower {
+		if component := a.controlTowerComponent(cfnType, resourceIdentifier, tags); component != "" {
+			return true, controlTowerSkipReason + component
+		}
+	}
+	for _, rule := range a.ignoreRules {
+		if rule.matches(cfnType, resourceIdentifier, resourcePath, tags) {
+			return true, fmt.Sprintf("Skipping resource %s matching ignore rule %s", resourceIdentifier, rule)
+		}
+	}
+	return false, ""
+}
+
+// resourceCfnType is the type the fetch checks the skip rules of the resource
+// for, and its tags, or an empty type for resources that are never skipped
+func resourceCfnType(r AwsResource) (CfnResourceType, map[string]string) {
+	switch r := r.(type) {
+	case *User:
+		return CfnIamUser, r.Tags
+	case *Group:
+		return CfnIamGroup, nil
+	case *Role:
+		return CfnIamRole, nil
+	case *Policy:
+		return CfnIamPolicy, r.Tags
+	case *InstanceProfile:
+		return CfnInstanceProfile, nil
+	case *BucketPolicy:
+		return CfnS3Bucket, r.Tags
+	case *AccessPoint:
+		return CfnS3AccessPoint, nil
+	case *ObjectLambdaAccessPoint:
+		return CfnS3ObjectLambda, nil
+	case *MultiRegionAccessPoint:
+		return CfnS3MultiRegion, nil
+	case *CodeArtifactDomainPolicy:
+		return CfnCodeArtifactDomain, nil
+	case *CodeArtifactRepositoryPolicy:
+		return CfnCodeArtifactRepository, nil
+	case *SesIdentityPolicies:
+		return CfnSesEmailIdentity, nil
+	case *RestApiPolicy:
+		return CfnApiGatewayRestApi, nil
+	case *GlacierVaultPolicy:
+		return glacierVaultType, nil
+	}
+	return "", nil
+}
+
+// WithoutIgnored returns the data of the files without the resources the
+// fetch skips for an ignore rule or as managed by Control Tower, so they're
+// neither created nor deleted. Files pulled before a rule applied still have
+// the resources, which aren't in the fetched data. Each is warned about as
+// skipped. The fetch must have run, as the rules are for its account
+func (a *AwsFetcher) WithoutIgnored(data *AccountData) *AccountData {
+	warnings := Warnings{}
+	result := data.filter(func(r AwsResource) bool {
+		cfnType, tags := resourceCfnType(r)
+		if cfnType == "" {
+			return true
+		}
+		resourcePath := nonIamResourcePath
+		if r.Service() == "iam" {
+			resourcePath = r.ResourcePath()
+		}
+		ok, reason := a.isIgnoredResource(cfnType, r.ResourceName(), tags, resourcePath)
+		if ok {
+			category := WarningSkipped
+			if strings.HasPrefix(reason, controlTowerSkipReason) {
+				category = WarningControlTower
+			}
+			warnings.Add(category, data.ResourceFile(r), reason+", so the file is ignored")
+		}
+		return !ok
+	})
+	result.Warnings = append(append(Warnings{}, data.Warnings...), warnings...)
+	result.AwsManagedPolicyVersions = data.AwsManagedPolicyVersions
+	return result
+}
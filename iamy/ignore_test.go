@@ -0,0 +1,137 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadIgnoreCatalogue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ignoretest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := LoadIgnoreCatalogue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules := c.rulesFor(&Account{Id: "123"}); len(rules) != len(BuiltinIgnoreRules) {
+		t.Errorf("Expected only the built-in rules without an ignore file, got %v", rules)
+	}
+
+	file := `
+Disable: [stackset-execution-*]
+Rules:
+- Id: ci-roles
+  Type: role
+  Path: /ci/*
+Accounts:
+  sandbox-456:
+    Disable: ["*"]
+    Rules:
+    - Id: scratch-buckets
+      Type: bucket
+      Tag: scratch
+`
+	if err = ioutil.WriteFile(filepath.Join(dir, IgnoreFileName), []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err = LoadIgnoreCatalogue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(rules []IgnoreRule) []string {
+		result := []string{}
+		for _, r := range rules {
+			result = append(result, r.Id)
+		}
+		return result
+	}
+	if actual := ids(c.rulesFor(&Account{Id: "123", Alias: "prod"})); !reflect.DeepEqual(actual, []string{"sso-reserved-roles", "ci-roles"}) {
+		t.Errorf("Unexpected rules for prod-123: %v", actual)
+	}
+	if actual := ids(c.rulesFor(&Account{Id: "456", Alias: "sandbox"})); !reflect.DeepEqual(actual, []string{"ci-roles", "scratch-buckets"}) {
+		t.Errorf("Unexpected rules for sandbox-456: %v", actual)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, IgnoreFileName), []byte("Rules:\n- Id: everything\n  Type: role\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadIgnoreCatalogue(dir); err == nil {
+		t.Error("Expected an error for a rule matching every role")
+	}
+}
+
+func TestIgnoreRulesSkipResources(t *testing.T) {
+	f := AwsFetcher{cfn: &cfnClient{}, ignoreRules: (*IgnoreCatalogue)(nil).rulesFor(&Account{Id: "123"})}
+
+	skippables := []struct {
+		cfnType CfnResourceType
+		name    string
+		path    string
+	}{
+		{CfnIamRole, "AWSReservedSSO_AdministratorAccess_0123456789abcdef", "/aws-reserved/sso.amazonaws.com/ap-southeast-2/"},
+		{CfnIamRole, "aws-controltower-AdministratorExecutionRole", "/"},
+		{CfnIamRole, "AWSControlTowerExecution", "/"},
+		{CfnS3Bucket, "aws-controltower-logs-123-ap-southeast-2", nonIamResourcePath},
+	}
+	for _, s := range skippables {
+		if skipped, _ := f.isSkippableManagedResource(s.cfnType, s.name, map[string]string{}, s.path); !skipped {
+			t.Errorf("Expected %s %s to be skipped", s.cfnType, s.name)
+		}
+	}
+
+	if skipped, _ := f.isSkippableManagedResource(CfnIamUser, "aws-controltower-AdministratorExecutionRole", map[string]string{}, "/"); skipped {
+		t.Error("Expected a user not to match a role rule")
+	}
+	if skipped, _ := f.isSkippableManagedResource(CfnIamRole, "deploy", map[string]string{}, "/aws-reserved/"); skipped {
+		t.Error("Expected a role outside the SSO path not to be skipped")
+	}
+}
+
+func TestWithoutIgnoredSkipsFilesOfIgnoredResources(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	f := AwsFetcher{cfn: &cfnClient{}, ignoreRules: (*IgnoreCatalogue)(nil).rulesFor(&Account{Id: "123"})}
+
+	localData := NewAccountData("123")
+	localData.addRole(&Role{iamService: iamService{Name: "AWSReservedSSO_Admin_0123456789abcdef", Path: "/aws-reserved/sso.amazonaws.com/"}, AssumeRolePolicyDocument: trust})
+	localData.addRole(&Role{iamService: iamService{Name: "stacksets-exec-0123456789abcdef", Path: "/"}, AssumeRolePolicyDocument: trust})
+	localData.addRole(&Role{iamService: iamService{Name: "aws-controltower-AdministratorExecutionRole", Path: "/"}, AssumeRolePolicyDocument: trust})
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: trust})
+
+	data := f.WithoutIgnored(localData)
+	if len(data.Roles) != 1 || data.Roles[0].Name != "app" {
+		t.Errorf("Expected only the app role to be kept, got %v", data.Roles)
+	}
+	if data.Warnings.Count(WarningSkipped) != 2 || data.Warnings.Count(WarningControlTower) != 1 {
+		t.Errorf("Expected a warning for each ignored file, got %v", data.Warnings)
+	}
+	if len(localData.Roles) != 4 || len(localData.Warnings) != 0 {
+		t.Error("Expected the files' data to be unchanged")
+	}
+
+	f.IncludeControlTower = true
+	if data := f.WithoutIgnored(localData); len(data.Roles) != 2 {
+		t.Errorf("Expected the Control Tower role to be kept with IncludeControlTower, got %v", data.Roles)
+	}
+}
+
+func TestOptionsHashIncludesDefaultSkipRules(t *testing.T) {
+	f := AwsFetcher{ignoreRules: (*IgnoreCatalogue)(nil).rulesFor(&Account{Id: "123"})}
+	builtin := f.OptionsHash()
+
+	f.ignoreRules = nil
+	if f.OptionsHash() == builtin {
+		t.Error("Expected the built-in ignore rules to change the hash")
+	}
+	f.ignoreRules = BuiltinIgnoreRules
+	f.IncludeControlTower = true
+	if f.OptionsHash() == builtin {
+		t.Error("Expected including Control Tower resources to change the hash")
+	}
+}
@@ -0,0 +1,39 @@
+package iamy
+
+// ImportResources returns the resources in AWS the selector selects, to write
+// to the files of a resource created outside iamy. With withReferences, the
+// groups, roles and managed policies they refer to are imported too. The
+// resources that already have files are returned separately, as importing
+// them would overwrite their files
+func ImportResources(aws, files *AccountData, selector ResourceSelector, withReferences bool) (imported, existing []AwsResource) {
+	selected := aws.Select(selector)
+	if withReferences {
+		_, withDependencies := SelectResources(files, aws, []ResourceSelector{selector})
+		selected = withDependencies.resources()
+	}
+
+	inFiles := map[string]bool{}
+	for _, r := range files.resources() {
+		inFiles[resourceKey(r)] = true
+	}
+	imported, existing = []AwsResource{}, []AwsResource{}
+	for _, r := range selected {
+		if inFiles[resourceKey(r)] {
+			existing = append(existing, r)
+		} else {
+			imported = append(imported, r)
+		}
+	}
+	return imported, existing
+}
+
+// ResourceFile returns the file the resource was loaded from, or the template
+// generating it, relative to the directory. Resources that weren't loaded
+// from the files are in their yaml file in the layout of the files the data
+// was loaded from
+func (a *AccountData) ResourceFile(r AwsResource) string {
+	if file, ok := a.loadedFrom[r]; ok {
+		return file
+	}
+	return a.layout.file(a.Account, r) + ".yaml"
+}
@@ -0,0 +1,81 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportResources(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addRole(&Role{iamService: iamService{Name: "hand-made", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{"reader", "writer"}})
+	remoteData.addRole(&Role{iamService: iamService{Name: "other", Path: "/"}, AssumeRolePolicyDocument: trust})
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: trust})
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "writer", Path: "/"}, Policy: trust})
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: trust})
+
+	selector, _ := ParseResourceSelector("role/hand-made")
+	imported, existing := ImportResources(remoteData, localData, selector, false)
+	if len(imported) != 1 || resourceKey(imported[0]) != "iam/role/hand-made" || len(existing) != 0 {
+		t.Errorf("Expected only the role to be imported, got %v %v", imported, existing)
+	}
+
+	imported, existing = ImportResources(remoteData, localData, selector, true)
+	if len(imported) != 2 || resourceKey(imported[1]) != "iam/policy/writer" || len(existing) != 1 || resourceKey(existing[0]) != "iam/policy/reader" {
+		t.Errorf("Expected the role and the policy missing from the files to be imported, got %v %v", imported, existing)
+	}
+}
+
+func TestResourceFileIsTheFileLoadedFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iamy-resourcefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(file, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("myalias-123/iam/group/devs.json", `{}`)
+	write("myalias-123/iam/group/ops.yaml", `{}`)
+	write("templates/groups.yaml.tmpl", `Account: myalias-123
+Resources:
+  iam/group/generated: {}
+`)
+
+	files := YamlLoadDumper{Dir: dir}
+	accounts, err := files.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || len(accounts[0].Groups) != 3 {
+		t.Fatalf("Expected an account with 3 groups, got %+v", accounts)
+	}
+	kinds, _ := ParseResourceKinds([]string{"groups"}, false)
+	data := FilterResourceKinds(&accounts[0], kinds)
+	expected := map[string]string{
+		"devs":      "myalias-123/iam/group/devs.json",
+		"ops":       "myalias-123/iam/group/ops.yaml",
+		"generated": "templates/groups.yaml.tmpl",
+	}
+	for _, g := range data.Groups {
+		if file := data.ResourceFile(g); file != expected[g.Name] {
+			t.Errorf("Expected group %s to be in %s, got %s", g.Name, expected[g.Name], file)
+		}
+	}
+
+	missing := &Group{iamService: iamService{Name: "new", Path: "/"}}
+	if file := data.ResourceFile(missing); file != "myalias-123/iam/group/new.yaml" {
+		t.Errorf("Expected a group not in the files to be in its file in the layout, got %s", file)
+	}
+}
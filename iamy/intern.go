@@ -0,0 +1,81 @@
+package iamy
+
+import "sync"
+
+// stringTable holds one copy of each string interned, so the resources and
+// policy documents of large accounts that repeat the same ARNs, actions and
+// documents share it instead of each holding their own. A table is made for
+// the data of each load or fetch, and is freed with it
+type stringTable struct {
+	sync.Mutex
+	strings map[string]string
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: map[string]string{}}
+}
+
+// intern returns the one copy of the string
+func (t *stringTable) intern(s string) string {
+	t.Lock()
+	defer t.Unlock()
+	if i, ok := t.strings[s]; ok {
+		return i
+	}
+	t.strings[s] = s
+	return s
+}
+
+func (t *stringTable) internSlice(ss []string) {
+	for i, s := range ss {
+		ss[i] = t.intern(s)
+	}
+}
+
+// internValue returns the data of a parsed policy document with its keys and
+// strings interned
+func (t *stringTable) internValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return t.intern(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[t.intern(k)] = t.internValue(child)
+		}
+		return m
+	case []interface{}:
+		for i, child := range v {
+			v[i] = t.internValue(child)
+		}
+	}
+	return v
+}
+
+// internStrings interns the policy documents, and the names and ARNs the
+// resources refer to each other by, which most resources repeat
+func (a *AccountData) internStrings() {
+	if a.interned == nil {
+		a.interned = newStringTable()
+	}
+	t := a.interned
+
+	for _, u := range a.Users {
+		t.internSlice(u.Groups)
+		t.internSlice(u.Policies)
+		u.PermissionsBoundary = t.intern(u.PermissionsBoundary)
+	}
+	for _, g := range a.Groups {
+		t.internSlice(g.Policies)
+	}
+	for _, r := range a.Roles {
+		t.internSlice(r.Policies)
+		r.PermissionsBoundary = t.intern(r.PermissionsBoundary)
+	}
+	for _, p := range a.InstanceProfiles {
+		t.internSlice(p.Roles)
+	}
+	for _, d := range a.policyDocuments() {
+		d.doc.intern(t)
+	}
+}
@@ -0,0 +1,73 @@
+package iamy
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+const internTestPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+
+// accountWithRepeatedPolicies returns account data with n roles that all
+// have the same trust policy
+func accountWithRepeatedPolicies(tb testing.TB, n int) *AccountData {
+	data := NewAccountData("123")
+	for i := 0; i < n; i++ {
+		doc, err := NewPolicyDocumentFromJson(internTestPolicy)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		data.addRole(&Role{iamService: iamService{Name: fmt.Sprintf("role-%d", i), Path: "/"}, AssumeRolePolicyDocument: doc})
+	}
+	return data
+}
+
+func TestInternedPolicyDocuments(t *testing.T) {
+	data := accountWithRepeatedPolicies(t, 2)
+	data.internStrings()
+
+	doc := data.Roles[0].AssumeRolePolicyDocument
+	if _, ok := data.interned.strings[doc.json]; !ok {
+		t.Error("Expected the document's JSON to be interned")
+	}
+	if doc.statements()[0]["Action"] != "sts:AssumeRole" {
+		t.Fatalf("Unexpected statements %v", doc.statements())
+	}
+	if _, ok := data.interned.strings["sts:AssumeRole"]; !ok {
+		t.Error("Expected the actions of parsed documents to be interned")
+	}
+
+	other := accountWithRepeatedPolicies(t, 1)
+	other.internStrings()
+	if other.interned == data.interned {
+		t.Error("Expected each account data to have its own table")
+	}
+}
+
+// heapAlloc returns the bytes allocated on the heap once garbage is collected
+func heapAlloc() int64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return int64(m.HeapAlloc)
+}
+
+// BenchmarkInternStrings reports the memory account data with repeated
+// policies holds on to, with and without interning its strings
+func BenchmarkInternStrings(b *testing.B) {
+	for _, interned := range []bool{false, true} {
+		b.Run(fmt.Sprintf("interned=%t", interned), func(b *testing.B) {
+			var retained int64
+			for i := 0; i < b.N; i++ {
+				before := heapAlloc()
+				data := accountWithRepeatedPolicies(b, 1000)
+				if interned {
+					data.internStrings()
+				}
+				retained += heapAlloc() - before
+				runtime.KeepAlive(data)
+			}
+			b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+		})
+	}
+}
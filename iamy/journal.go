@@ -0,0 +1,458 @@
+package iamy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A JournalEntry is a command push applied, and the commands that reverse it.
+// Note says why the command can't be reversed, or can only be in part
+type JournalEntry struct {
+	Time time.Time `json:"Time"`
+	Cmd  Cmd       `json:"Cmd"`
+	Undo CmdList   `json:"Undo,omitempty"`
+	Note string    `json:"Note,omitempty"`
+}
+
+// A Journal records the commands push applies to a file, one JSON entry a
+// line, as each finishes. The commands reversing each one are worked out
+// before it runs, from the AWS data the plan was made from and, for policy
+// versions, from IAM, so a push that fails part way can be rolled back.
+// Pushing again with the same journal resumes it instead
+type Journal struct {
+	Path    string
+	Entries []JournalEntry
+
+	from      *AccountData
+	iam       *iamClient
+	originals map[string]Cmd
+	mutex     sync.Mutex
+}
+
+// OpenJournal reads the journal at path, if it exists. from is the AWS data
+// the commands about to be applied were planned from
+func OpenJournal(path string, from *AccountData) (*Journal, error) {
+	j := &Journal{Path: path, from: from}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 10*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		entry := JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, &ErrValidation{File: path, Line: line, Err: err}
+		}
+		j.Entries = append(j.Entries, entry)
+	}
+	return j, scanner.Err()
+}
+
+// Unapplied returns the commands the journal doesn't record as applied, so
+// a resumed push doesn't repeat changes IAM hasn't made visible yet
+func (j *Journal) Unapplied(cmds CmdList) CmdList {
+	applied := map[string]int{}
+	for _, e := range j.Entries {
+		applied[e.Cmd.String()]++
+	}
+	result := CmdList{}
+	for _, c := range cmds {
+		if applied[c.String()] > 0 {
+			applied[c.String()]--
+			continue
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// RecordOriginals records each of the rewritten commands as the original
+// command at the same index, eg. one whose documents WriteDocumentFiles moved
+// to files as the command with the documents inline, so a resumed push matches
+// the commands it plans, which are inline, with those applied
+func (j *Journal) RecordOriginals(rewritten, original CmdList) {
+	if j == nil {
+		return
+	}
+	j.originals = map[string]Cmd{}
+	for i, c := range rewritten {
+		j.originals[c.String()] = original[i]
+	}
+}
+
+// RollbackPlan returns the commands reversing the journal, most recent
+// first, and the notes of the commands that can't be fully reversed
+func (j *Journal) RollbackPlan() (CmdList, []string) {
+	cmds := CmdList{}
+	notes := []string{}
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		e := j.Entries[i]
+		cmds = append(cmds, e.Undo...)
+		if e.Note != "" {
+			notes = append(notes, fmt.Sprintf("%s: %s", e.Cmd, e.Note))
+		}
+	}
+	return cmds, notes
+}
+
+// Rollback runs the commands reversing the journal, most recent first. The
+// journal is rewritten as each entry is reversed, so a failed rollback can be
+// retried, and removed once they all are
+func (j *Journal) Rollback(run func(Cmd) error) error {
+	for len(j.Entries) > 0 {
+		e := j.Entries[len(j.Entries)-1]
+		for _, c := range e.Undo {
+			if err := run(c); err != nil {
+				return err
+			}
+		}
+		j.Entries = j.Entries[:len(j.Entries)-1]
+		if err := j.write(); err != nil {
+			return err
+		}
+	}
+	return j.Remove()
+}
+
+// Remove removes the journal file, once the push it records is complete
+func (j *Journal) Remove() error {
+	err := os.Remove(j.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (j *Journal) write() error {
+	f, err := os.Create(j.Path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range j.Entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// record appends the applied command to the journal, syncing the file so the
+// entry survives the push being killed
+func (j *Journal) record(c Cmd, undo CmdList, note string) error {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if original, ok := j.originals[c.String()]; ok {
+		c = original
+	}
+	entry := JournalEntry{Time: time.Now().UTC(), Cmd: c, Undo: undo, Note: note}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error writing journal")
+	}
+	if _, err = f.Write(append(data, '\n')); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error writing journal")
+	}
+	j.Entries = append(j.Entries, entry)
+	return nil
+}
+
+func (j *Journal) iamClient() *iamClient {
+	if j.iam == nil {
+		j.iam = newIamClient(awsSession())
+	}
+	return j.iam
+}
+
+// undo returns the commands reversing the command, before it runs. Only IAM
+// commands are reversed
+func (j *Journal) undo(c Cmd) (CmdList, string) {
+	if j == nil {
+		return nil, ""
+	}
+	if len(c.Args) < 2 || c.Args[0] != "iam" {
+		return nil, "Only IAM commands can be reversed"
+	}
+
+	undo := CmdList{}
+	action := c.Args[1]
+	// the user, group or role of policy commands
+	entity := strings.TrimSuffix(action[strings.Index(action, "-")+1:], "-policy")
+	entityFlag := "--" + entity + "-name"
+	unknown := "The resource isn't in the AWS data the push was planned from"
+
+	switch action {
+	case "attach-user-policy", "attach-group-policy", "attach-role-policy":
+		undo.Add(c.Name, append([]string{"iam", "detach-" + entity + "-policy"}, c.Args[2:]...)...)
+	case "detach-user-policy", "detach-group-policy", "detach-role-policy":
+		undo.Add(c.Name, append([]string{"iam", "attach-" + entity + "-policy"}, c.Args[2:]...)...)
+	case "add-user-to-group":
+		undo.Add(c.Name, append([]string{"iam", "remove-user-from-group"}, c.Args[2:]...)...)
+	case "remove-user-from-group":
+		undo.Add(c.Name, append([]string{"iam", "add-user-to-group"}, c.Args[2:]...)...)
+	case "add-role-to-instance-profile":
+		undo.Add(c.Name, append([]string{"iam", "remove-role-from-instance-profile"}, c.Args[2:]...)...)
+	case "remove-role-from-instance-profile":
+		undo.Add(c.Name, append([]string{"iam", "add-role-to-instance-profile"}, c.Args[2:]...)...)
+
+	case "put-user-policy", "put-group-policy", "put-role-policy":
+		name, policyName := cmdFlag(c, entityFlag), cmdFlag(c, "--policy-name")
+		if ip := j.inlinePolicy(entity, name, policyName); ip != nil {
+			undo.Add(c.Name, "iam", action, entityFlag, name, "--policy-name", policyName, "--policy-document", ip.Policy.JsonString())
+		} else {
+			undo.Add(c.Name, "iam", "delete-"+entity+"-policy", entityFlag, name, "--policy-name", policyName)
+		}
+	case "delete-user-policy", "delete-group-policy", "delete-role-policy":
+		name, policyName := cmdFlag(c, entityFlag), cmdFlag(c, "--policy-name")
+		ip := j.inlinePolicy(entity, name, policyName)
+		if ip == nil {
+			return nil, unknown
+		}
+		undo.Add(c.Name, "iam", "put-"+entity+"-policy", entityFlag, name, "--policy-name", policyName, "--policy-document", ip.Policy.JsonString())
+
+	case "update-assume-role-policy":
+		role := j.role(cmdFlag(c, "--role-name"))
+		if role == nil {
+			return nil, unknown
+		}
+		undo.Add(c.Name, "iam", action, "--role-name", role.Name, "--policy-document", role.AssumeRolePolicyDocument.JsonString())
+	case "update-role":
+		role := j.role(cmdFlag(c, "--role-name"))
+		if role == nil {
+			return nil, unknown
+		}
+		undo.Add(c.Name, "iam", action, "--role-name", role.Name, "--max-session-duration", strconv.Itoa(maxSessionDuration(role)))
+	case "put-role-permissions-boundary", "delete-role-permissions-boundary":
+		role := j.role(cmdFlag(c, "--role-name"))
+		if role == nil {
+			return nil, unknown
+		}
+		undo = j.permissionsBoundaryUndo(c.Name, "role", role.Name, role.PermissionsBoundary)
+	case "put-user-permissions-boundary", "delete-user-permissions-boundary":
+		user := j.user(cmdFlag(c, "--user-name"))
+		if user == nil {
+			return nil, unknown
+		}
+		undo = j.permissionsBoundaryUndo(c.Name, "user", user.Name, user.PermissionsBoundary)
+
+	case "create-policy-version":
+		arn := cmdFlag(c, "--policy-arn")
+		version, err := j.iamClient().getPolicyDefaultVersion(arn)
+		if err != nil {
+			return nil, fmt.Sprintf("The default version couldn't be read: %s", err)
+		}
+		undo.Add(c.Name, "iam", "set-default-policy-version", "--policy-arn", arn, "--version-id", version)
+	case "delete-policy-version":
+		arn := cmdFlag(c, "--policy-arn")
+		doc, err := j.iamClient().getPolicyVersionDocument(arn, cmdFlag(c, "--version-id"))
+		if err != nil {
+			return nil, fmt.Sprintf("The version couldn't be read: %s", err)
+		}
+		undo.Add(c.Name, "iam", "create-policy-version", "--policy-arn", arn, "--policy-document", doc.JsonString())
+		return undo, "The version is recreated with a new version id"
+
+	case "create-user", "create-group", "create-role", "create-instance-profile":
+		resourceType := strings.TrimPrefix(action, "create-")
+		flag := "--" + resourceType + "-name"
+		undo.Add(c.Name, "iam", "delete-"+resourceType, flag, cmdFlag(c, flag))
+	case "create-policy":
+		policy := &Policy{iamService: iamService{Name: cmdFlag(c, "--policy-name"), Path: cmdFlag(c, "--path")}}
+		undo.Add(c.Name, "iam", "delete-policy", "--policy-arn", Arn(policy, j.account()))
+
+	case "delete-user":
+		user := j.user(cmdFlag(c, "--user-name"))
+		if user == nil {
+			return nil, unknown
+		}
+		args := []string{"iam", "create-user", "--user-name", user.Name, "--path", path(user.Path)}
+		if len(user.Tags) != 0 {
+			args = append(args, "--tags", mapTagsToString(user.Tags))
+		}
+		if user.PermissionsBoundary != "" {
+			args = append(args, "--permissions-boundary", j.account().policyArnFromString(user.PermissionsBoundary))
+		}
+		undo.Add(c.Name, args...)
+		return undo, "The user's access keys, MFA devices and console password can't be restored"
+	case "delete-group":
+		group := j.group(cmdFlag(c, "--group-name"))
+		if group == nil {
+			return nil, unknown
+		}
+		undo.Add(c.Name, "iam", "create-group", "--group-name", group.Name, "--path", path(group.Path))
+	case "delete-role":
+		role := j.role(cmdFlag(c, "--role-name"))
+		if role == nil {
+			return nil, unknown
+		}
+		args := []string{"iam", "create-role", "--role-name", role.Name, "--path", path(role.Path), "--assume-role-policy-document", role.AssumeRolePolicyDocument.JsonString()}
+		if role.Description != "" {
+			args = append(args, "--description", role.Description)
+		}
+		if role.MaxSessionDuration != 0 {
+			args = append(args, "--max-session-duration", strconv.Itoa(role.MaxSessionDuration))
+		}
+		if role.PermissionsBoundary != "" {
+			args = append(args, "--permissions-boundary", j.account().policyArnFromString(role.PermissionsBoundary))
+		}
+		undo.Add(c.Name, args...)
+		return undo, "The role is recreated with a new unique id, so trust policies referring to the old one don't apply to it"
+	case "delete-policy":
+		policy := j.policy(cmdFlag(c, "--policy-arn"))
+		if policy == nil {
+			return nil, unknown
+		}
+		args := []string{"iam", "create-policy", "--policy-name", policy.Name, "--path", path(policy.Path)}
+		if policy.Description != "" {
+			args = append(args, "--description", policy.Description)
+		}
+		args = append(args, "--policy-document", policy.Policy.JsonString())
+		undo.Add(c.Name, args...)
+	case "delete-instance-profile":
+		name := cmdFlag(c, "--instance-profile-name")
+		profile := j.instanceProfile(name)
+		if profile == nil {
+			return nil, unknown
+		}
+		undo.Add(c.Name, "iam", "create-instance-profile", "--instance-profile-name", name, "--path", path(profile.Path))
+
+	default:
+		return nil, fmt.Sprintf("%s commands aren't reversed", action)
+	}
+
+	return undo, ""
+}
+
+func (j *Journal) permissionsBoundaryUndo(name, entity, entityName, boundary string) CmdList {
+	undo := CmdList{}
+	if boundary == "" {
+		undo.Add(name, "iam", "delete-"+entity+"-permissions-boundary", "--"+entity+"-name", entityName)
+	} else {
+		undo.Add(name, "iam", "put-"+entity+"-permissions-boundary", "--"+entity+"-name", entityName, "--permissions-boundary", j.account().policyArnFromString(boundary))
+	}
+	return undo
+}
+
+// maxSessionDuration is the role's maximum session duration in seconds, which
+// is an hour unless set
+func maxSessionDuration(r *Role) int {
+	if r.MaxSessionDuration == 0 {
+		return 3600
+	}
+	return r.MaxSessionDuration
+}
+
+func (j *Journal) account() *Account {
+	if j.from == nil || j.from.Account == nil {
+		return &Account{}
+	}
+	return j.from.Account
+}
+
+func (j *Journal) user(name string) *User {
+	if j.from != nil {
+		for _, u := range j.from.Users {
+			if u.Name == name {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+func (j *Journal) group(name string) *Group {
+	if j.from != nil {
+		for _, g := range j.from.Groups {
+			if g.Name == name {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+func (j *Journal) role(name string) *Role {
+	if j.from != nil {
+		for _, r := range j.from.Roles {
+			if r.Name == name {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+func (j *Journal) policy(arn string) *Policy {
+	if j.from != nil {
+		for _, p := range j.from.Policies {
+			if Arn(p, j.from.Account) == arn {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+func (j *Journal) instanceProfile(name string) *InstanceProfile {
+	if j.from != nil {
+		for _, ip := range j.from.InstanceProfiles {
+			if ip.Name == name {
+				return ip
+			}
+		}
+	}
+	return nil
+}
+
+func (j *Journal) inlinePolicy(entity, name, policyName string) *InlinePolicy {
+	var inlinePolicies []InlinePolicy
+	switch entity {
+	case "user":
+		if u := j.user(name); u != nil {
+			inlinePolicies = u.InlinePolicies
+		}
+	case "group":
+		if g := j.group(name); g != nil {
+			inlinePolicies = g.InlinePolicies
+		}
+	case "role":
+		if r := j.role(name); r != nil {
+			inlinePolicies = r.InlinePolicies
+		}
+	}
+	for i := range inlinePolicies {
+		if inlinePolicies[i].Name == policyName {
+			return &inlinePolicies[i]
+		}
+	}
+	return nil
+}
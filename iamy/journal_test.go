@@ -0,0 +1,149 @@
+package iamy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJournalRollsBackAndResumes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journaltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "push.journal")
+
+	readerArn := "arn:aws:iam::123:policy/reader"
+	from := NewAccountData("123")
+	from.addRole(&Role{
+		iamService:               iamService{Name: "app", Path: "/"},
+		AssumeRolePolicyDocument: mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`),
+		InlinePolicies:           []InlinePolicy{{Name: "inline", Policy: mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)}},
+		Policies:                 []string{"reader"},
+	})
+	from.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:ListBucket","Resource":"*"}]}`)})
+
+	cmds := CmdList{}
+	cmds.Add("aws", "iam", "put-role-policy", "--role-name", "app", "--policy-name", "inline", "--policy-document", "{}")
+	cmds.Add("aws", "iam", "detach-role-policy", "--role-name", "app", "--policy-arn", readerArn)
+	cmds.Add("aws", "iam", "delete-policy-version", "--version-id", "v1", "--policy-arn", readerArn)
+	cmds.Add("aws", "iam", "create-user", "--user-name", "bob", "--path", "/")
+	cmds.Add("aws", "s3api", "delete-bucket-policy", "--bucket", "logs")
+	cmds.Add("aws", "iam", "create-group", "--group-name", "readers", "--path", "/")
+
+	journal, err := OpenJournal(path, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.iam = &iamClient{&fakeIam{documents: map[string]string{
+		readerArn + " v1": `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+	}}}
+	executor := Executor{
+		Journal: journal,
+		Run: func(c Cmd) error {
+			if c.Args[1] == "create-group" {
+				return errors.New("throttled")
+			}
+			return nil
+		},
+	}
+	if err := executor.Execute(cmds); err == nil {
+		t.Fatal("Expected the push to fail")
+	}
+
+	// the journal is read back as a resumed push would
+	journal, err = OpenJournal(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journal.Entries) != 5 {
+		t.Fatalf("Expected the 5 applied commands to be journaled, got %+v", journal.Entries)
+	}
+	if remaining := journal.Unapplied(cmds); !reflect.DeepEqual(remaining, cmds[5:]) {
+		t.Errorf("Expected only the failed command to remain, got %v", remaining)
+	}
+
+	rollback, notes := journal.RollbackPlan()
+	actions := []string{}
+	for _, c := range rollback {
+		actions = append(actions, c.Args[1])
+	}
+	if expected := []string{"delete-user", "create-policy-version", "attach-role-policy", "put-role-policy"}; !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Expected rollback plan %v, got:\n%s", expected, rollback)
+	}
+	if doc := cmdFlag(rollback[3], "--policy-document"); !strings.Contains(doc, "s3:GetObject") {
+		t.Errorf("Expected the inline policy to be put back, got %s", doc)
+	}
+	if len(notes) != 2 {
+		t.Errorf("Expected notes for the bucket policy and policy version, got %v", notes)
+	}
+
+	ran := CmdList{}
+	err = journal.Rollback(func(c Cmd) error {
+		if c.Args[1] == "attach-role-policy" {
+			return errors.New("throttled")
+		}
+		ran = append(ran, c)
+		return nil
+	})
+	if err == nil || len(ran) != 2 {
+		t.Fatalf("Expected the rollback to stop at the failure, got %v %v", ran, err)
+	}
+	if journal, err = OpenJournal(path, nil); err != nil || len(journal.Entries) != 2 {
+		t.Fatalf("Expected the reversed entries to be removed from the journal, got %v %v", journal, err)
+	}
+
+	if err = journal.Rollback(func(c Cmd) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be removed, got %v", err)
+	}
+}
+
+func TestJournalRecordsDocumentCommandsInline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journaltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "push.journal")
+
+	cmds := CmdList{}
+	cmds.Add("aws", "iam", "put-role-policy", "--role-name", "app", "--policy-name", "inline", "--policy-document", `{"Version":"2012-10-17"}`)
+	cmds.Add("aws", "iam", "create-group", "--group-name", "readers", "--path", "/")
+
+	journal, err := OpenJournal(path, NewAccountData("123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withFiles, _, err := WriteDocumentFiles(cmds, filepath.Join(dir, "documents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.RecordOriginals(withFiles, cmds)
+	executor := Executor{
+		Journal: journal,
+		Run: func(c Cmd) error {
+			if c.Args[1] == "create-group" {
+				return errors.New("throttled")
+			}
+			return nil
+		},
+	}
+	if err := executor.Execute(withFiles); err == nil {
+		t.Fatal("Expected the push to fail")
+	}
+
+	if journal, err = OpenJournal(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if remaining := journal.Unapplied(cmds); !reflect.DeepEqual(remaining, cmds[1:]) {
+		t.Errorf("Expected the applied command with a document file to be matched, got %v", remaining)
+	}
+}
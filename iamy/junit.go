@@ -0,0 +1,157 @@
+package iamy
+
+import (
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A JUnitCase is a test case of a JUnit report, in the named suite. It
+// passes unless it has a Failure, an Error or is Skipped, each the message
+// saying why. Lines are the line of the file each line of the Failure is
+// about, or 0 for the whole file, when the case is of a file
+type JUnitCase struct {
+	Suite     string
+	ClassName string
+	Name      string
+	Failure   string
+	Error     string
+	Skipped   string
+	Lines     []int
+}
+
+// fileLine matches a problem's key that's a line of a file, as file:line
+var fileLine = regexp.MustCompile(`^(.+):(\d+)$`)
+
+// FileCases returns a case for each file of the account's resources, in the
+// suite, failing with the problems found in that file. Problems are keyed by
+// their file, or by file:line, eg. the Location of a statement, which can be
+// a policy file or template rather than a resource's file. Problems keyed by
+// something other than a file, eg. the account, are cases of their own
+func FileCases(suite string, a *AccountData, problems map[string][]string) []JUnitCase {
+	byFile := map[string][]string{}
+	lines := map[string][]int{}
+	for _, r := range a.resources() {
+		file := filepath.Clean(a.ResourceFile(r))
+		byFile[file] = byFile[file]
+	}
+	keys := []string{}
+	for key := range problems {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		file, line := key, 0
+		if m := fileLine.FindStringSubmatch(key); m != nil {
+			file = m[1]
+			line, _ = strconv.Atoi(m[2])
+		}
+		file = filepath.Clean(file)
+		byFile[file] = append(byFile[file], problems[key]...)
+		for _, p := range problems[key] {
+			for range strings.Split(p, "\n") {
+				lines[file] = append(lines[file], line)
+			}
+		}
+	}
+	files := []string{}
+	for file := range byFile {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	cases := []JUnitCase{}
+	for _, file := range files {
+		cases = append(cases, JUnitCase{Suite: suite, ClassName: suite, Name: file, Failure: strings.Join(byFile[file], "\n"), Lines: lines[file]})
+	}
+	return cases
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+// junitMessage is the first line of a message as the message attribute,
+// with the whole message as the text, which CI servers show in full
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func newJUnitMessage(message string) *junitMessage {
+	return &junitMessage{strings.SplitN(message, "\n", 2)[0], message}
+}
+
+// WriteJUnit writes the cases as JUnit XML, with a test suite for each
+// suite in the order they're first named, for CI servers to show
+func WriteJUnit(w io.Writer, cases []JUnitCase) error {
+	report := junitTestSuites{}
+	suites := map[string]int{}
+	for _, c := range cases {
+		i, ok := suites[c.Suite]
+		if !ok {
+			i = len(report.Suites)
+			suites[c.Suite] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: c.Suite})
+		}
+		suite := &report.Suites[i]
+
+		tc := junitTestCase{Name: c.Name, ClassName: c.ClassName}
+		switch {
+		case c.Error != "":
+			tc.Error = newJUnitMessage(c.Error)
+			suite.Errors++
+		case c.Failure != "":
+			tc.Failure = newJUnitMessage(c.Failure)
+			suite.Failures++
+		case c.Skipped != "":
+			tc.Skipped = newJUnitMessage(c.Skipped)
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+	for _, s := range report.Suites {
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Errors += s.Errors
+		report.Skipped += s.Skipped
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,46 @@
+package iamy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFileCases(t *testing.T) {
+	data := NewAccountData("myalias-123")
+	data.addRole(&Role{iamService: iamService{Name: "deployer", Path: "/"}})
+	data.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}})
+
+	cases := FileCases("analyze mfa", data, map[string][]string{
+		"myalias-123/iam/user/alice.yaml": {"first problem", "second problem"},
+		"myalias-123":                     {"account problem"},
+	})
+
+	expected := []JUnitCase{
+		{Suite: "analyze mfa", ClassName: "analyze mfa", Name: "myalias-123"},
+		{Suite: "analyze mfa", ClassName: "analyze mfa", Name: "myalias-123/iam/role/deployer.yaml"},
+		{Suite: "analyze mfa", ClassName: "analyze mfa", Name: "myalias-123/iam/user/alice.yaml"},
+	}
+	if len(cases) != len(expected) {
+		t.Fatalf("Expected %d cases, got %v", len(expected), cases)
+	}
+	for i, c := range cases {
+		if c.Name != expected[i].Name || c.Suite != expected[i].Suite {
+			t.Errorf("Expected case %s, got %s", expected[i].Name, c.Name)
+		}
+	}
+	if cases[1].Failure != "" {
+		t.Errorf("Expected a file without problems to pass, got %q", cases[1].Failure)
+	}
+	if cases[2].Failure != "first problem\nsecond problem" {
+		t.Errorf("Expected the file's problems as its failure, got %q", cases[2].Failure)
+	}
+
+	var b bytes.Buffer
+	if err := WriteJUnit(&b, cases); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `<failure message="first problem">first problem&#xA;second problem</failure>`) {
+		t.Errorf("Expected the first problem as the failure message and all of them as its text, got\n%s", b.String())
+	}
+}
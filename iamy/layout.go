@@ -0,0 +1,284 @@
+package iamy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+)
+
+// LayoutFileName is the file in the directory that sets the layout of the
+// resources' files
+const LayoutFileName = ".iamy-layout.yaml"
+
+// DefaultLayoutTemplate is the layout of the files when the directory has no
+// layout file, eg. myalias-123456789012/iam/role/people/app.yaml
+const DefaultLayoutTemplate = "{{.Account}}/{{.Kind}}{{.Path}}{{.Name}}"
+
+// pathFileKey is the key a resource's path is kept under in its file when the
+// layout doesn't include the path
+const pathFileKey = "Path"
+
+// A Layout is the scheme of the resources' file names, a template of each
+// file relative to the directory, without its extension. The template can
+// use:
+//
+//	{{.Account}}      the account, as ALIAS-ID
+//	{{.Kind}}         the service and type, eg. iam/role or s3
+//	{{.Path}}         the path, eg. /people/, or the region of regional resources
+//	{{.Name}}         the name
+//	{{.Tag "team"}}   the value of a tag, or untagged
+//
+// Kind and Name are required. Without Account the directory holds the files
+// of Account alone, and without Path each file keeps the resource's path.
+// PolicyStyle is how the files' policy documents are written, one of
+// PolicyStyles, and StatementOrder the order their statements are written
+// in, one of StatementOrders
+type Layout struct {
+	Template       string `json:"Template"`
+	Account        string `json:"Account,omitempty"`
+	PolicyStyle    string `json:"PolicyStyle,omitempty"`
+	StatementOrder string `json:"StatementOrder,omitempty"`
+
+	template *template.Template
+	regex    *regexp.Regexp
+	hasPath  bool
+}
+
+var layoutAction = regexp.MustCompile(`\{\{\s*(.*?)\s*\}\}`)
+var layoutTag = regexp.MustCompile(`^\.Tag\s+"[^"/]+"$`)
+var layoutPathSlashes = regexp.MustCompile(`/*\{\{\s*\.Path\s*\}\}/*`)
+
+// NewLayout compiles a layout template, to write the files with and to read
+// the resources back from their file names
+func NewLayout(tmpl, account string) (*Layout, error) {
+	// the path begins and ends with a slash, so the slashes around it in the
+	// template are dropped to not double them
+	tmpl = layoutPathSlashes.ReplaceAllString(strings.TrimSpace(tmpl), "{{.Path}}")
+	l := Layout{Template: tmpl, Account: account}
+
+	var err error
+	if l.template, err = template.New("").Option("missingkey=error").Parse(tmpl); err != nil {
+		return nil, err
+	}
+
+	pattern := "^"
+	found := map[string]bool{}
+	last := 0
+	for _, m := range layoutAction.FindAllStringSubmatchIndex(tmpl, -1) {
+		pattern += regexp.QuoteMeta(tmpl[last:m[0]])
+		last = m[1]
+		action := tmpl[m[2]:m[3]]
+		if found[action] && !layoutTag.MatchString(action) {
+			return nil, fmt.Errorf("%s is in the layout template twice", action)
+		}
+		found[action] = true
+		switch {
+		case action == ".Account":
+			pattern += `(?P<account>[^/]+)`
+		case action == ".Kind":
+			pattern += `(?P<entity>` + entityPattern + `)`
+		case action == ".Path":
+			pattern += `(?P<resourcepath>/(?:[^/]+/)*)`
+			l.hasPath = true
+		case action == ".Name":
+			pattern += `(?P<resourcename>[^/]+)`
+		case layoutTag.MatchString(action):
+			pattern += `[^/]+`
+		default:
+			return nil, fmt.Errorf("Unsupported {{%s}} in the layout template, use .Account, .Kind, .Path, .Name or .Tag \"key\"", action)
+		}
+	}
+	pattern += regexp.QuoteMeta(tmpl[last:]) + `\.(yaml|json)$`
+
+	switch {
+	case !found[".Kind"] || !found[".Name"]:
+		return nil, fmt.Errorf("The layout template needs {{.Kind}} and {{.Name}}")
+	case !found[".Account"] && !accountReg.MatchString(account):
+		return nil, fmt.Errorf("The layout template has no {{.Account}}, so Account must be the ALIAS-ID of the account the directory holds")
+	case found[".Account"] && account != "":
+		return nil, fmt.Errorf("Account is only for layout templates without {{.Account}}")
+	}
+	if l.regex, err = regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+var defaultLayout = func() *Layout {
+	l, err := NewLayout(DefaultLayoutTemplate, "")
+	if err != nil {
+		panic(err)
+	}
+	return l
+}()
+
+// LoadLayout reads the layout file in the directory, returning the default
+// layout when there isn't one
+func LoadLayout(dir string) (*Layout, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, LayoutFileName))
+	if os.IsNotExist(err) {
+		return defaultLayout, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l Layout
+	if err = yaml.Unmarshal(data, &l); err != nil {
+		return nil, validationError(LayoutFileName, err)
+	}
+	if l.Template == "" {
+		l.Template = DefaultLayoutTemplate
+	}
+	layout, err := NewLayout(l.Template, l.Account)
+	if err != nil {
+		return nil, validationError(LayoutFileName, err)
+	}
+	if l.PolicyStyle != "" && !stringSliceContains(PolicyStyles, l.PolicyStyle) {
+		return nil, validationError(LayoutFileName, fmt.Errorf("Unknown PolicyStyle %s, use one of %s", l.PolicyStyle, strings.Join(PolicyStyles, ", ")))
+	}
+	if l.StatementOrder != "" && !stringSliceContains(StatementOrders, l.StatementOrder) {
+		return nil, validationError(LayoutFileName, fmt.Errorf("Unknown StatementOrder %s, use one of %s", l.StatementOrder, strings.Join(StatementOrders, ", ")))
+	}
+	layout.PolicyStyle = l.PolicyStyle
+	layout.StatementOrder = l.StatementOrder
+	return layout, nil
+}
+
+// IsDefault returns whether the layout is the default one
+func (l *Layout) IsDefault() bool {
+	return l == nil || l.Template == defaultLayout.Template && l.Account == ""
+}
+
+type layoutData struct {
+	Account string
+	Kind    string
+	Path    string
+	Name    string
+	tags    map[string]string
+}
+
+// Tag returns the value of the resource's tag, or untagged, so the file
+// always has a directory for it
+func (d layoutData) Tag(key string) string {
+	if v := d.tags[key]; v != "" && v != "." && v != ".." && !strings.ContainsAny(v, `/\`) {
+		return v
+	}
+	return "untagged"
+}
+
+// resourceTags returns the tags of the resources that have them
+func resourceTags(r AwsResource) map[string]string {
+	switch r := r.(type) {
+	case *User:
+		return r.Tags
+	case *Policy:
+		return r.Tags
+	case *BucketPolicy:
+		return r.Tags
+	}
+	return nil
+}
+
+// resourceKind returns the resource's service and type, as the files are
+// grouped by, eg. iam/role
+func resourceKind(r AwsResource) string {
+	if r.ResourceType() == "" {
+		return r.Service()
+	}
+	return r.Service() + "/" + r.ResourceType()
+}
+
+// file returns the resource's file, relative to the directory, without its
+// extension
+func (l *Layout) file(a *Account, r AwsResource) string {
+	if l == nil {
+		l = defaultLayout
+	}
+	data := layoutData{a.String(), resourceKind(r), r.ResourcePath(), r.ResourceName(), resourceTags(r)}
+	buf := &bytes.Buffer{}
+	if err := l.template.Execute(buf, data); err != nil {
+		panic(err)
+	}
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+buf.String())), "/")
+}
+
+// parse returns the account, kind, path and name of the resource in a file,
+// or false when the file isn't one in the layout. Without the path in the
+// layout, the path is empty, for the file to give
+func (l *Layout) parse(file string) (account, entity, resourcePath, name string, ok bool) {
+	matched, result := namedMatch(l.regex, file)
+	if !matched {
+		return "", "", "", "", false
+	}
+	account = result["account"]
+	if account == "" {
+		account = l.Account
+	}
+	return account, result["entity"], result["resourcepath"], result["resourcename"], true
+}
+
+// Relayout moves the files in the default layout to the layout of the
+// directory, removing the directories it empties, and returns the files
+// moved, as their old and new names
+func (f *YamlLoadDumper) Relayout() ([][2]string, error) {
+	layout, err := f.layout()
+	if err != nil {
+		return nil, err
+	}
+	moved := [][2]string{}
+	if layout.IsDefault() {
+		return moved, nil
+	}
+
+	old := YamlLoadDumper{Dir: f.Dir, Format: f.Format, Layout: defaultLayout}
+	accounts, err := old.Load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		data := &accounts[i]
+		for _, r := range data.resources() {
+			oldFile := ""
+			for _, ext := range []string{".yaml", ".json"} {
+				candidate := defaultLayout.file(data.Account, r) + ext
+				if _, err := os.Stat(filepath.Join(f.Dir, filepath.FromSlash(candidate))); err == nil {
+					oldFile = candidate
+					break
+				}
+			}
+			newFile, err := f.resourceFile(data.Account, r)
+			if err != nil {
+				return nil, err
+			}
+			if oldFile == "" || oldFile == newFile {
+				continue
+			}
+			if err := f.writeResource(data.Account, r); err != nil {
+				return nil, err
+			}
+			if err := os.Remove(filepath.Join(f.Dir, filepath.FromSlash(oldFile))); err != nil {
+				return nil, err
+			}
+			removeEmptyDirs(f.Dir, filepath.Dir(filepath.Join(f.Dir, filepath.FromSlash(oldFile))))
+			moved = append(moved, [2]string{oldFile, newFile})
+		}
+	}
+	return moved, nil
+}
+
+// removeEmptyDirs removes dir and its parents while they're empty, up to root
+func removeEmptyDirs(root, dir string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
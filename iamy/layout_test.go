@@ -0,0 +1,135 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNewLayoutErrors(t *testing.T) {
+	for _, c := range []struct {
+		template, account, expected string
+	}{
+		{"{{.Account}}/{{.Name}}", "", "needs {{.Kind}} and {{.Name}}"},
+		{"{{.Account}}/{{.Kind}}/{{.Resource.Name}}", "", "Unsupported {{.Resource.Name}}"},
+		{"{{.Kind}}/{{.Name}}", "", "Account must be the ALIAS-ID"},
+		{"{{.Account}}/{{.Kind}}/{{.Name}}", "myalias-123", "Account is only for"},
+		{"{{.Account}}/{{.Kind}}/{{.Name}}/{{.Name}}", "", ".Name is in the layout template twice"},
+	} {
+		if _, err := NewLayout(c.template, c.account); err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("Expected %s to fail with %q, got %v", c.template, c.expected, err)
+		}
+	}
+}
+
+func TestLayoutFile(t *testing.T) {
+	l, err := NewLayout(`{{.Tag "team"}}/{{.Kind}}/{{.Path}}/{{.Name}}`, "myalias-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := NewAccountFromString("myalias-123")
+	for _, c := range []struct {
+		resource AwsResource
+		expected string
+	}{
+		{&User{iamService: iamService{Name: "billy", Path: "/people/"}, Tags: map[string]string{"team": "payments"}}, "payments/iam/user/people/billy"},
+		{&Role{iamService: iamService{Name: "app", Path: "/"}}, "untagged/iam/role/app"},
+		{&BucketPolicy{BucketName: "my-bucket"}, "untagged/s3/my-bucket"},
+	} {
+		file := l.file(account, c.resource)
+		if file != c.expected {
+			t.Errorf("Expected %s, got %s", c.expected, file)
+		}
+		accountId, entity, path, name, ok := l.parse(file + ".yaml")
+		key := resourceKind(c.resource) + c.resource.ResourcePath() + c.resource.ResourceName()
+		if !ok || accountId != "myalias-123" || entity+path+name != key {
+			t.Errorf("Expected %s to parse as %s, got %s %s%s%s", file, key, accountId, entity, path, name)
+		}
+	}
+}
+
+func TestRelayout(t *testing.T) {
+	data := loadTestdataAccount(t)
+	dir, err := ioutil.TempDir("", "iamy-layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := (&YamlLoadDumper{Dir: dir}).Dump(data, false); err != nil {
+		t.Fatal(err)
+	}
+	layout := "Template: '{{.Kind}}/{{.Tag \"team\"}}/{{.Name}}'\nAccount: myalias-123\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, LayoutFileName), []byte(layout), 0644); err != nil {
+		t.Fatal(err)
+	}
+	y := YamlLoadDumper{Dir: dir}
+
+	loaded, err := y.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 0 {
+		t.Errorf("Expected no resources in the new layout before moving the files, got %d accounts", len(loaded))
+	}
+
+	moved, err := y.Relayout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 5 {
+		t.Errorf("Expected 5 files moved, got %v", moved)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "myalias-123")); !os.IsNotExist(err) {
+		t.Errorf("Expected the emptied account directory to be removed, got %v", err)
+	}
+	files := []string{}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	sort.Strings(files)
+	expected := []string{
+		LayoutFileName,
+		"iam/group/untagged/DevOps.yaml",
+		"iam/policy/untagged/TestPolicyAccess.yaml",
+		"iam/role/untagged/ecsInstanceRole.yaml",
+		"iam/user/untagged/billy.blogs.yaml",
+		"s3/untagged/my-bucket.yaml",
+	}
+	if strings.Join(files, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected files\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(files, "\n"))
+	}
+	user, _ := ioutil.ReadFile(filepath.Join(dir, "iam/user/untagged/billy.blogs.yaml"))
+	if !strings.Contains(string(user), "Path: /foo/\n") {
+		t.Errorf("Expected the user's file to keep its path, got\n%s", user)
+	}
+
+	loaded, err = y.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || len(loaded[0].Warnings) != 0 {
+		t.Fatalf("Expected one account without warnings, got %+v", loaded)
+	}
+	if loaded[0].ResourceFile(loaded[0].Users[0]) != "iam/user/untagged/billy.blogs.yaml" {
+		t.Errorf("Expected the user's file in the new layout, got %s", loaded[0].ResourceFile(loaded[0].Users[0]))
+	}
+	before, after := map[string]string{}, map[string]string{}
+	for _, r := range data.resources() {
+		before[resourceKey(r)] = resourceJson(r)
+	}
+	for _, r := range loaded[0].resources() {
+		after[resourceKey(r)] = resourceJson(r)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("Expected the resources to be unchanged by the layout\nExpected: %v\nActual:   %v", before, after)
+	}
+}
@@ -1,5 +1,7 @@
 package iamy
 
+import "sort"
+
 func mapStringSetDifference(aa, bb map[string]string) map[string]string {
 	rr := make(map[string]string)
 	for k, v := range aa {
@@ -9,3 +11,12 @@ func mapStringSetDifference(aa, bb map[string]string) map[string]string {
 	}
 	return rr
 }
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
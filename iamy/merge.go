@@ -0,0 +1,155 @@
+package iamy
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A MergeConflict is a resource both sides of a merge changed from the base
+// in different ways. Ours and Theirs are how each side changed it, added,
+// changed or deleted, and Attributes are the attributes both changed to
+// different values
+type MergeConflict struct {
+	Resource   string   `json:"Resource"`
+	Ours       string   `json:"Ours"`
+	Theirs     string   `json:"Theirs"`
+	Attributes []string `json:"Attributes,omitempty"`
+}
+
+// A MergeResult is the account data two pulls of the same account merge to.
+// Theirs are the changes taken from their side, and Conflicts the resources
+// left as they are on our side, for an operator to resolve
+type MergeResult struct {
+	Data      *AccountData
+	Theirs    []MergeChange
+	Conflicts []MergeConflict
+}
+
+// A MergeChange is a change their side made to a resource, added, changed
+// or deleted, that the merge takes
+type MergeChange struct {
+	Resource string `json:"Resource"`
+	Action   string `json:"Action"`
+
+	// resource is their resource, or the base's when they deleted it
+	resource AwsResource
+}
+
+// sameResource returns whether the resources are the same once normalised,
+// where a missing resource is only the same as another missing one
+func sameResource(a, b AwsResource) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return comparableJson(a) == comparableJson(b) || len(attributeDrifts(a, b)) == 0
+}
+
+// mergeAction is how a side of a merge changed a resource from the base
+func mergeAction(base, side AwsResource) string {
+	switch {
+	case base == nil:
+		return "added"
+	case side == nil:
+		return "deleted"
+	}
+	return "changed"
+}
+
+// changedAttributes returns the names of the attributes that differ between
+// the resources
+func changedAttributes(before, after AwsResource) []string {
+	names := []string{}
+	for _, d := range attributeDrifts(before, after) {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// MergeAccounts merges the account data of two pulls of the same account,
+// ours and theirs, made since the base, resource by resource as a 3-way
+// merge. A resource only one side changed from the base takes that side's
+// change, and one both changed the same way takes the change. A resource
+// both changed differently is a conflict, which is left as it is on our
+// side. Resources are compared normalised, so reordered statements aren't a
+// change
+func MergeAccounts(base, ours, theirs *AccountData) (*MergeResult, error) {
+	if ours.Account.Id != theirs.Account.Id || base.Account.Id != ours.Account.Id {
+		return nil, fmt.Errorf("Can't merge different accounts %s, %s and %s", base.Account, ours.Account, theirs.Account)
+	}
+
+	index := func(data *AccountData) map[string]AwsResource {
+		byKey := map[string]AwsResource{}
+		for _, r := range data.resources() {
+			byKey[resourceKey(r)] = r
+		}
+		return byKey
+	}
+	baseByKey, oursByKey, theirsByKey := index(base), index(ours), index(theirs)
+	keys := []string{}
+	for _, byKey := range []map[string]AwsResource{baseByKey, oursByKey, theirsByKey} {
+		for key := range byKey {
+			if !stringSliceContains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	merged := NewAccountData(ours.Account.String())
+	merged.Account = ours.Account
+	merged.AwsManagedPolicyVersions = ours.AwsManagedPolicyVersions
+	merged.layout = ours.layout
+	merged.canonicalUserId = ours.canonicalUserId
+	result := &MergeResult{Data: merged, Theirs: []MergeChange{}, Conflicts: []MergeConflict{}}
+
+	for _, key := range keys {
+		b, o, t := baseByKey[key], oursByKey[key], theirsByKey[key]
+		keep := o
+		switch {
+		case sameResource(o, t) || sameResource(b, t):
+		case sameResource(b, o):
+			keep = t
+			ch := MergeChange{Resource: key, Action: mergeAction(b, t), resource: t}
+			if t == nil {
+				ch.resource = b
+			}
+			result.Theirs = append(result.Theirs, ch)
+		default:
+			conflict := MergeConflict{Resource: key, Ours: mergeAction(b, o), Theirs: mergeAction(b, t)}
+			if o != nil && t != nil {
+				oursChanged, theirsChanged := changedAttributes(b, o), changedAttributes(b, t)
+				for _, name := range changedAttributes(o, t) {
+					if stringSliceContains(oursChanged, name) && stringSliceContains(theirsChanged, name) {
+						conflict.Attributes = append(conflict.Attributes, name)
+					}
+				}
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+		}
+		if keep != nil {
+			merged.addResource(keep)
+		}
+	}
+	merged.SortCanonically()
+	return result, nil
+}
+
+// DumpMerge writes the changes the merge took from their side to the files
+// of the account, writing the files of the resources they added or changed
+// and removing those of the resources they deleted. The other files are left
+// as they are
+func (f *YamlLoadDumper) DumpMerge(result *MergeResult) error {
+	account := result.Data.Account
+	for _, ch := range result.Theirs {
+		if ch.Action != "deleted" {
+			if err := f.writeResource(account, ch.resource); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := f.RemoveResources(account, []AwsResource{ch.resource}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
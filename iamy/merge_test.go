@@ -0,0 +1,125 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMergeAccounts(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	doc := func(actions string) *PolicyDocument {
+		return mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":`+actions+`,"Resource":"*"}]}`)
+	}
+	role := func(name, description string, policies ...string) *Role {
+		return &Role{iamService: iamService{Name: name, Path: "/"}, Description: description, AssumeRolePolicyDocument: trust, Policies: policies}
+	}
+
+	base := NewAccountData("myalias-123")
+	for _, name := range []string{"ours-changed", "ours-deleted", "theirs-changed", "theirs-deleted", "both-changed", "unchanged"} {
+		base.addRole(role(name, "base"))
+	}
+	base.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc(`["s3:GetObject","s3:ListBucket"]`)})
+
+	ours := NewAccountData("myalias-123")
+	ours.addRole(role("ours-changed", "ours"))
+	ours.addRole(role("theirs-changed", "base"))
+	ours.addRole(role("theirs-deleted", "base"))
+	ours.addRole(role("both-changed", "ours", "reader"))
+	ours.addRole(role("unchanged", "base"))
+	ours.addRole(role("both-added", "same"))
+	ours.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc(`["s3:ListBucket","s3:GetObject"]`)})
+
+	theirs := NewAccountData("myalias-123")
+	theirs.addRole(role("ours-changed", "base"))
+	theirs.addRole(role("ours-deleted", "base"))
+	theirs.addRole(role("theirs-changed", "theirs"))
+	theirs.addRole(role("both-changed", "theirs", "reader"))
+	theirs.addRole(role("unchanged", "base"))
+	theirs.addRole(role("both-added", "same"))
+	theirs.addRole(role("theirs-added", "theirs"))
+	theirs.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc(`["s3:GetObject","s3:ListBucket"]`)})
+
+	result, err := MergeAccounts(base, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := []string{}
+	for _, r := range result.Data.Roles {
+		merged = append(merged, r.Name+" "+r.Description)
+	}
+	if expected := []string{"both-added same", "both-changed ours", "ours-changed ours", "theirs-added theirs", "theirs-changed theirs", "unchanged base"}; !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected roles %v, got %v", expected, merged)
+	}
+	expectedTheirs := []MergeChange{
+		{Resource: "iam/role/theirs-added", Action: "added"},
+		{Resource: "iam/role/theirs-changed", Action: "changed"},
+		{Resource: "iam/role/theirs-deleted", Action: "deleted"},
+	}
+	for i := range result.Theirs {
+		result.Theirs[i].resource = nil
+	}
+	if !reflect.DeepEqual(result.Theirs, expectedTheirs) {
+		t.Errorf("Expected their changes %v, got %v", expectedTheirs, result.Theirs)
+	}
+	expectedConflicts := []MergeConflict{{Resource: "iam/role/both-changed", Ours: "changed", Theirs: "changed", Attributes: []string{"Description"}}}
+	if !reflect.DeepEqual(result.Conflicts, expectedConflicts) {
+		t.Errorf("Expected conflicts %v, got %v", expectedConflicts, result.Conflicts)
+	}
+
+	if _, err = MergeAccounts(base, ours, NewAccountData("456")); err == nil {
+		t.Error("Expected an error merging different accounts")
+	}
+}
+
+func TestDumpMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mergetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := NewAccountData("123")
+	base.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}})
+	base.addUser(&User{iamService: iamService{Name: "bob", Path: "/staff/"}})
+	yaml := YamlLoadDumper{Dir: dir}
+	if err = yaml.Dump(base, true); err != nil {
+		t.Fatal(err)
+	}
+	// our carol is only in the files, and their dave is added and bob deleted
+	if err = yaml.WriteResources(base.Account, []AwsResource{&User{iamService: iamService{Name: "carol", Path: "/"}}}); err != nil {
+		t.Fatal(err)
+	}
+	theirs := NewAccountData("123")
+	theirs.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}})
+	theirs.addUser(&User{iamService: iamService{Name: "dave", Path: "/"}, Groups: []string{"admins"}})
+
+	loaded, err := yaml.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := MergeAccounts(base, &loaded[0], theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = yaml.DumpMerge(result); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err = yaml.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []string{}
+	for _, u := range loaded[0].Users {
+		users = append(users, u.Path+u.Name)
+	}
+	if expected := []string{"/alice", "/carol", "/dave"}; !reflect.DeepEqual(users, expected) {
+		t.Errorf("Expected users %v, got %v", expected, users)
+	}
+	if !reflect.DeepEqual(loaded[0].Users[2].Groups, []string{"admins"}) {
+		t.Errorf("Expected their dave, got %v", loaded[0].Users[2])
+	}
+}
@@ -0,0 +1,212 @@
+package iamy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const mfaPresentConditionKey = "aws:multifactorauthpresent"
+const mfaAgeConditionKey = "aws:multifactorauthage"
+
+// MfaDesignations says which IAM entities are for humans, and so must
+// require MFA
+type MfaDesignations struct {
+	// Groups and Policies grant human access, so their Allow statements must
+	// require MFA unless every member is in an MFA enforcing group
+	Groups   []string
+	Policies []string
+	// UserTag, if set, marks the users with that tag as human users
+	UserTag string
+}
+
+// An MfaFinding is a principal that can act without MFA, and the statements
+// that allow it to
+type MfaFinding struct {
+	Principal  string
+	Problem    string
+	Statements []PolicyStatement
+}
+
+// requiresMfa returns whether the statement only applies when MFA was used.
+// IfExists and set operators also match requests without the MFA keys, eg.
+// ones signed with access keys, so only the plain operators count
+func requiresMfa(s PolicyStatement) bool {
+	for _, c := range s.Conditions() {
+		key := strings.ToLower(c.Key)
+		switch {
+		case key == mfaPresentConditionKey && c.Operator == "Bool":
+			if len(c.Values) == 1 && strings.ToLower(c.Values[0]) == "true" {
+				return true
+			}
+		case key == mfaAgeConditionKey && (c.Operator == "NumericLessThan" || c.Operator == "NumericLessThanEquals"):
+			return true
+		}
+	}
+	return false
+}
+
+// enforcesMfa returns whether the statement is a Deny for requests made
+// without MFA, as in the AWS "force MFA" example policy
+func enforcesMfa(s PolicyStatement) bool {
+	if effect, _ := s.data["Effect"].(string); effect != "Deny" || !deniesEverything(s) {
+		return false
+	}
+	for _, c := range s.Conditions() {
+		if strings.ToLower(c.Key) == mfaPresentConditionKey && baseConditionOperator(c.Operator) == "Bool" &&
+			len(c.Values) == 1 && strings.ToLower(c.Values[0]) == "false" {
+			return true
+		}
+	}
+	return false
+}
+
+// deniesEverything returns whether a Deny statement covers every action on
+// every resource, other than the IAM and STS actions that the example policy
+// exempts with NotAction so users can set up MFA
+func deniesEverything(s PolicyStatement) bool {
+	if !stringSliceContains(conditionValues(s.data["Resource"]), "*") {
+		return false
+	}
+	if notActions, ok := s.data["NotAction"]; ok {
+		for _, a := range conditionValues(notActions) {
+			service := strings.ToLower(strings.SplitN(a, ":", 2)[0])
+			if service != "iam" && service != "sts" {
+				return false
+			}
+		}
+		return true
+	}
+	return stringSliceContains(conditionValues(s.data["Action"]), "*")
+}
+
+func isAllow(s PolicyStatement) bool {
+	effect, _ := s.data["Effect"].(string)
+	return effect == "Allow"
+}
+
+type mfaAuditor struct {
+	*principalPolicies
+	designations MfaDesignations
+}
+
+func (m *mfaAuditor) isEnforcingGroup(g *Group) bool {
+	statements, _ := m.groupStatements(g)
+	for _, s := range statements {
+		if enforcesMfa(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mfaAuditor) isHumanUser(u *User) bool {
+	if m.designations.UserTag != "" {
+		if _, ok := u.Tags[m.designations.UserTag]; ok {
+			return true
+		}
+	}
+	for _, g := range u.Groups {
+		if stringSliceContains(m.designations.Groups, g) {
+			return true
+		}
+	}
+	for _, p := range u.Policies {
+		if stringSliceContains(m.designations.Policies, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func allowsWithoutMfa(statements []PolicyStatement) []PolicyStatement {
+	result := []PolicyStatement{}
+	for _, s := range statements {
+		if isAllow(s) && !requiresMfa(s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func unknownPoliciesProblem(unknown []string) string {
+	if len(unknown) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", and attached policies that can't be checked (%s)", strings.Join(unknown, ", "))
+}
+
+// MfaReport checks that the designated human access groups and policies
+// require MFA, and that human users are in an MFA enforcing group, ie. one
+// with a policy denying requests made without MFA. It returns the principals
+// that can act without MFA
+func MfaReport(data *AccountData, designations MfaDesignations) []MfaFinding {
+	m := mfaAuditor{newPrincipalPolicies(data), designations}
+
+	findings := []MfaFinding{}
+
+	for _, name := range sortedCopy(designations.Groups) {
+		g := m.findGroup(name)
+		if g == nil {
+			findings = append(findings, MfaFinding{Principal: "group " + name, Problem: "designated group doesn't exist"})
+			continue
+		}
+		if m.isEnforcingGroup(g) {
+			continue
+		}
+		statements, unknown := m.groupStatements(g)
+		if allows := allowsWithoutMfa(statements); len(allows) > 0 || len(unknown) > 0 {
+			findings = append(findings, MfaFinding{
+				Principal:  "group " + name,
+				Problem:    "allows actions without MFA" + unknownPoliciesProblem(unknown),
+				Statements: allows,
+			})
+		}
+	}
+
+	for _, name := range sortedCopy(designations.Policies) {
+		p := m.findPolicy(name)
+		if p == nil {
+			findings = append(findings, MfaFinding{Principal: "policy " + name, Problem: "designated policy doesn't exist"})
+			continue
+		}
+		if allows := allowsWithoutMfa(m.byDoc[p.Policy]); len(allows) > 0 {
+			findings = append(findings, MfaFinding{Principal: "policy " + name, Problem: "allows actions without MFA", Statements: allows})
+		}
+	}
+
+	users := append([]*User{}, data.Users...)
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	for _, u := range users {
+		if !m.isHumanUser(u) {
+			continue
+		}
+
+		enforced := false
+		statements, unknown := m.managedStatements(u.Policies)
+		statements = append(m.inlineStatements(u.InlinePolicies), statements...)
+		for _, name := range u.Groups {
+			if g := m.findGroup(name); g != nil {
+				if m.isEnforcingGroup(g) {
+					enforced = true
+				}
+				groupStatements, groupUnknown := m.groupStatements(g)
+				statements = append(statements, groupStatements...)
+				unknown = append(unknown, groupUnknown...)
+			}
+		}
+		if enforced {
+			continue
+		}
+
+		if allows := allowsWithoutMfa(statements); len(allows) > 0 || len(unknown) > 0 {
+			findings = append(findings, MfaFinding{
+				Principal:  "user " + u.Name,
+				Problem:    "isn't in an MFA enforcing group and is allowed actions without MFA" + unknownPoliciesProblem(unknown),
+				Statements: allows,
+			})
+		}
+	}
+
+	return findings
+}
@@ -0,0 +1,76 @@
+package iamy
+
+import "testing"
+
+func TestMfaReport(t *testing.T) {
+	forceMfa := `{"Version":"2012-10-17","Statement":[{"Sid":"DenyWithoutMFA","Effect":"Deny","NotAction":"iam:*MFADevice","Resource":"*","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}]}`
+	readOnly := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`
+	mfaReadOnly := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"}}}]}`
+
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{iamService: iamService{Name: "force-mfa", Path: "/"}, Policy: mustPolicyDocument(t, forceMfa)})
+	data.addPolicy(&Policy{iamService: iamService{Name: "read-only", Path: "/humans/"}, Policy: mustPolicyDocument(t, readOnly)})
+	data.addPolicy(&Policy{iamService: iamService{Name: "mfa-read-only", Path: "/"}, Policy: mustPolicyDocument(t, mfaReadOnly)})
+	data.addGroup(&Group{iamService: iamService{Name: "enforced", Path: "/"}, Policies: []string{"force-mfa", "humans/read-only"}})
+	data.addGroup(&Group{iamService: iamService{Name: "developers", Path: "/"}, Policies: []string{"humans/read-only", "arn:aws:iam::aws:policy/ReadOnlyAccess"}})
+	data.addGroup(&Group{iamService: iamService{Name: "auditors", Path: "/"}, Policies: []string{"mfa-read-only"}})
+	data.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}, Groups: []string{"enforced", "developers"}})
+	data.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, Groups: []string{"developers"}})
+	data.addUser(&User{iamService: iamService{Name: "carol", Path: "/"}, Groups: []string{"auditors"}})
+	data.addUser(&User{iamService: iamService{Name: "deploy", Path: "/"}, Policies: []string{"humans/read-only"}})
+	data.addUser(&User{iamService: iamService{Name: "dave", Path: "/"}, Policies: []string{"humans/read-only"}, Tags: map[string]string{"human": "true"}})
+
+	findings := MfaReport(data, MfaDesignations{
+		Groups:   []string{"developers", "auditors", "enforced"},
+		Policies: []string{"mfa-read-only", "missing"},
+		UserTag:  "human",
+	})
+
+	expected := map[string]int{
+		"group developers": 1,
+		"policy missing":   0,
+		"user bob":         1,
+		"user dave":        1,
+	}
+	if len(findings) != len(expected) {
+		t.Errorf("Expected %d findings, got %v", len(expected), findings)
+	}
+	for _, f := range findings {
+		count, ok := expected[f.Principal]
+		if !ok {
+			t.Errorf("Unexpected finding for %s: %s", f.Principal, f.Problem)
+			continue
+		}
+		if len(f.Statements) != count {
+			t.Errorf("Expected %d statements for %s, got %v", count, f.Principal, f.Statements)
+		}
+	}
+}
+
+func TestMfaConditions(t *testing.T) {
+	cases := []struct {
+		statement string
+		requires  bool
+		enforces  bool
+	}{
+		{`{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"}}}`, true, false},
+		{`{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"true"}}}`, false, false},
+		{`{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"NumericLessThan":{"aws:MultiFactorAuthAge":"3600"}}}`, true, false},
+		{`{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"NumericLessThanIfExists":{"aws:MultiFactorAuthAge":"3600"}}}`, false, false},
+		{`{"Effect":"Deny","Action":"*","Resource":"*","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}`, false, true},
+		{`{"Effect":"Deny","NotAction":["iam:*MFADevice","sts:GetSessionToken"],"Resource":"*","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}`, false, true},
+		{`{"Effect":"Deny","Action":"s3:DeleteBucket","Resource":"*","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}`, false, false},
+		{`{"Effect":"Deny","NotAction":"s3:*","Resource":"*","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}`, false, false},
+		{`{"Effect":"Deny","Action":"*","Resource":"arn:aws:s3:::bucket","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}`, false, false},
+	}
+	for _, c := range cases {
+		doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[`+c.statement+`]}`)
+		s := PolicyStatement{data: doc.statements()[0]}
+		if got := requiresMfa(s); got != c.requires {
+			t.Errorf("Expected requiresMfa %t for %s", c.requires, c.statement)
+		}
+		if got := enforcesMfa(s); got != c.enforces {
+			t.Errorf("Expected enforcesMfa %t for %s", c.enforces, c.statement)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package iamy
 
 import (
+	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Account struct {
@@ -67,11 +70,20 @@ func (s iamService) ResourcePath() string {
 }
 
 type User struct {
-	iamService     `json:"-"`
-	Groups         []string          `json:"Groups,omitempty"`
-	InlinePolicies []InlinePolicy    `json:"InlinePolicies,omitempty"`
-	Policies       []string          `json:"Policies,omitempty"`
-	Tags           map[string]string `json:"Tags,omitempty"`
+	iamService          `json:"-"`
+	Groups              []string          `json:"Groups,omitempty"`
+	InlinePolicies      []InlinePolicy    `json:"InlinePolicies,omitempty"`
+	Policies            []string          `json:"Policies,omitempty"`
+	PermissionsBoundary string            `json:"PermissionsBoundary,omitempty"`
+	Tags                map[string]string `json:"Tags,omitempty"`
+	// CreateDate is only informational, when the user was created in AWS, as
+	// of the pull. It isn't compared, and push doesn't change it
+	CreateDate *time.Time `json:"CreateDate,omitempty"`
+	// RenamedFrom is the name of the user in AWS that push renames to the
+	// user, keeping its access keys, password and MFA devices. Users are
+	// never renamed without it, as a user with the same groups and policies
+	// may be a different person. It isn't compared, and pull doesn't write it
+	RenamedFrom string `json:"RenamedFrom,omitempty"`
 }
 
 func (u User) ResourceType() string {
@@ -98,9 +110,17 @@ type Policy struct {
 	numberOfVersions     int
 	oldestVersionId      string
 	nondefaultVersionIds []string
-	Description          string            `json:"Description,omitempty"`
-	Policy               *PolicyDocument   `json:"Policy"`
-	Tags                 map[string]string `json:"Tags,omitempty"`
+	versions             []PolicyVersion
+	Description          string `json:"Description,omitempty"`
+	// DefaultVersionId is only informational, the default version when the
+	// policy was pulled. Push refuses to supersede a different version, which
+	// was made outside iamy since the pull
+	DefaultVersionId string            `json:"DefaultVersionId,omitempty"`
+	Policy           *PolicyDocument   `json:"Policy"`
+	Tags             map[string]string `json:"Tags,omitempty"`
+	// CreateDate is only informational, when the policy was created in AWS,
+	// as of the pull
+	CreateDate *time.Time `json:"CreateDate,omitempty"`
 }
 
 func (p Policy) ResourceType() string {
@@ -113,7 +133,11 @@ type Role struct {
 	AssumeRolePolicyDocument *PolicyDocument `json:"AssumeRolePolicyDocument"`
 	InlinePolicies           []InlinePolicy  `json:"InlinePolicies,omitempty"`
 	Policies                 []string        `json:"Policies,omitempty"`
+	PermissionsBoundary      string          `json:"PermissionsBoundary,omitempty"`
 	MaxSessionDuration       int             `json:"MaxSessionDuration,omitempty"`
+	// CreateDate is only informational, when the role was created in AWS, as
+	// of the pull
+	CreateDate *time.Time `json:"CreateDate,omitempty"`
 }
 
 type InstanceProfile struct {
@@ -130,8 +154,15 @@ func (r Role) ResourceType() string {
 }
 
 type BucketPolicy struct {
-	BucketName string          `json:"-"`
-	Policy     *PolicyDocument `json:"Policy"`
+	BucketName        string             `json:"-"`
+	Policy            *PolicyDocument    `json:"Policy,omitempty"`
+	PublicAccessBlock *PublicAccessBlock `json:"PublicAccessBlock,omitempty"`
+	Acl               *BucketAcl         `json:"Acl,omitempty"`
+	Tags              map[string]string  `json:"Tags,omitempty"`
+
+	// systemTags are the aws: tags of the bucket in AWS, which aren't in the
+	// files, as they can't be set, but must be kept when tagging the bucket
+	systemTags map[string]string
 }
 
 func (bp BucketPolicy) Service() string {
@@ -150,14 +181,468 @@ func (bp BucketPolicy) ResourcePath() string {
 	return "/"
 }
 
+// BucketAcl is a bucket's access control list. The bucket owner's full control
+// grant is implied, so a private bucket has no BucketAcl. ACLs that match a
+// canned ACL are stored as that canned ACL rather than as grants
+type BucketAcl struct {
+	Canned string        `json:"Canned,omitempty"`
+	Grants []BucketGrant `json:"Grants,omitempty"`
+}
+
+// BucketGrant is a single grant in a bucket ACL. The Grantee is written the
+// way the aws cli expects it, eg. id=<canonical user id> or uri=<group uri>
+type BucketGrant struct {
+	Grantee    string `json:"Grantee"`
+	Permission string `json:"Permission"`
+}
+
+const allUsersGroupUri = "uri=http://acs.amazonaws.com/groups/global/AllUsers"
+const authenticatedUsersGroupUri = "uri=http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+const logDeliveryGroupUri = "uri=http://acs.amazonaws.com/groups/s3/LogDelivery"
+
+// cannedBucketAcls are the grants, besides the owner's full control, that
+// make up each canned ACL
+var cannedBucketAcls = map[string][]BucketGrant{
+	"public-read": {
+		{Grantee: allUsersGroupUri, Permission: "READ"},
+	},
+	"public-read-write": {
+		{Grantee: allUsersGroupUri, Permission: "READ"},
+		{Grantee: allUsersGroupUri, Permission: "WRITE"},
+	},
+	"authenticated-read": {
+		{Grantee: authenticatedUsersGroupUri, Permission: "READ"},
+	},
+	"log-delivery-write": {
+		{Grantee: logDeliveryGroupUri, Permission: "READ_ACP"},
+		{Grantee: logDeliveryGroupUri, Permission: "WRITE"},
+	},
+}
+
+// newBucketAcl returns the BucketAcl for grants, which must not include the
+// owner's full control grant, or nil if the bucket is private
+func newBucketAcl(grants []BucketGrant) *BucketAcl {
+	if len(grants) == 0 {
+		return nil
+	}
+	sortBucketGrants(grants)
+	for canned, cannedGrants := range cannedBucketAcls {
+		if bucketGrantsEqual(grants, cannedGrants) {
+			return &BucketAcl{Canned: canned}
+		}
+	}
+	return &BucketAcl{Grants: grants}
+}
+
+// grants returns the grants the ACL is made up of
+func (acl *BucketAcl) grants() []BucketGrant {
+	if acl == nil {
+		return nil
+	}
+	if acl.Canned != "" {
+		return cannedBucketAcls[acl.Canned]
+	}
+	grants := append([]BucketGrant{}, acl.Grants...)
+	sortBucketGrants(grants)
+	return grants
+}
+
+func (acl *BucketAcl) equal(other *BucketAcl) bool {
+	return bucketGrantsEqual(acl.grants(), other.grants())
+}
+
+func sortBucketGrants(grants []BucketGrant) {
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Grantee != grants[j].Grantee {
+			return grants[i].Grantee < grants[j].Grantee
+		}
+		return grants[i].Permission < grants[j].Permission
+	})
+}
+
+func bucketGrantsEqual(a, b []BucketGrant) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// PublicAccessBlock is an S3 Block Public Access configuration
+type PublicAccessBlock struct {
+	BlockPublicAcls       bool `json:"BlockPublicAcls"`
+	IgnorePublicAcls      bool `json:"IgnorePublicAcls"`
+	BlockPublicPolicy     bool `json:"BlockPublicPolicy"`
+	RestrictPublicBuckets bool `json:"RestrictPublicBuckets"`
+}
+
+// empty returns whether every setting is false, the same as having no Block
+// Public Access configuration
+func (p PublicAccessBlock) empty() bool {
+	return p == PublicAccessBlock{}
+}
+
+func (p PublicAccessBlock) cliArgument() string {
+	return fmt.Sprintf("BlockPublicAcls=%t,IgnorePublicAcls=%t,BlockPublicPolicy=%t,RestrictPublicBuckets=%t",
+		p.BlockPublicAcls, p.IgnorePublicAcls, p.BlockPublicPolicy, p.RestrictPublicBuckets)
+}
+
+const accountPublicAccessBlockName = "public-access-block"
+
+// AccountPublicAccessBlock is the Block Public Access configuration that
+// applies to every bucket in the account
+type AccountPublicAccessBlock struct {
+	PublicAccessBlock
+}
+
+func (p AccountPublicAccessBlock) Service() string {
+	return "s3control"
+}
+
+func (p AccountPublicAccessBlock) ResourceType() string {
+	return ""
+}
+
+func (p AccountPublicAccessBlock) ResourceName() string {
+	return accountPublicAccessBlockName
+}
+
+func (p AccountPublicAccessBlock) ResourcePath() string {
+	return "/"
+}
+
+type CodeArtifactDomainPolicy struct {
+	Region     string          `json:"-"`
+	DomainName string          `json:"-"`
+	Policy     *PolicyDocument `json:"Policy"`
+}
+
+func (p CodeArtifactDomainPolicy) Service() string {
+	return "codeartifact"
+}
+
+func (p CodeArtifactDomainPolicy) ResourceType() string {
+	return "domain"
+}
+
+func (p CodeArtifactDomainPolicy) ResourceName() string {
+	return p.DomainName
+}
+
+func (p CodeArtifactDomainPolicy) ResourcePath() string {
+	return "/" + p.Region + "/"
+}
+
+type CodeArtifactRepositoryPolicy struct {
+	Region         string          `json:"-"`
+	DomainName     string          `json:"-"`
+	RepositoryName string          `json:"-"`
+	Policy         *PolicyDocument `json:"Policy"`
+}
+
+func (p CodeArtifactRepositoryPolicy) Service() string {
+	return "codeartifact"
+}
+
+func (p CodeArtifactRepositoryPolicy) ResourceType() string {
+	return "repository"
+}
+
+func (p CodeArtifactRepositoryPolicy) ResourceName() string {
+	return p.RepositoryName
+}
+
+func (p CodeArtifactRepositoryPolicy) ResourcePath() string {
+	return "/" + p.Region + "/" + p.DomainName + "/"
+}
+
+type SesIdentityPolicies struct {
+	Region   string         `json:"-"`
+	Identity string         `json:"-"`
+	Policies []InlinePolicy `json:"Policies"`
+}
+
+func (p SesIdentityPolicies) Service() string {
+	return "ses"
+}
+
+func (p SesIdentityPolicies) ResourceType() string {
+	return "identity"
+}
+
+func (p SesIdentityPolicies) ResourceName() string {
+	return p.Identity
+}
+
+func (p SesIdentityPolicies) ResourcePath() string {
+	return "/" + p.Region + "/"
+}
+
+type RestApiPolicy struct {
+	Region    string          `json:"-"`
+	RestApiId string          `json:"-"`
+	Name      string          `json:"Name,omitempty"`
+	Policy    *PolicyDocument `json:"Policy"`
+
+	// stages are the stages of the REST API when fetched, which are
+	// redeployed for a change to its policy to take effect
+	stages []string
+}
+
+func (p RestApiPolicy) Service() string {
+	return "apigateway"
+}
+
+func (p RestApiPolicy) ResourceType() string {
+	return "restapi"
+}
+
+func (p RestApiPolicy) ResourceName() string {
+	return p.RestApiId
+}
+
+func (p RestApiPolicy) ResourcePath() string {
+	return "/" + p.Region + "/"
+}
+
+// AccessPoint is an S3 Access Point and its policy. The bucket and VPC can't
+// be changed, so changing them recreates the access point
+type AccessPoint struct {
+	Region string          `json:"-"`
+	Name   string          `json:"-"`
+	Bucket string          `json:"Bucket"`
+	VpcId  string          `json:"VpcId,omitempty"`
+	Policy *PolicyDocument `json:"Policy,omitempty"`
+}
+
+func (p AccessPoint) Service() string {
+	return "s3control"
+}
+
+func (p AccessPoint) ResourceType() string {
+	return "accesspoint"
+}
+
+func (p AccessPoint) ResourceName() string {
+	return p.Name
+}
+
+func (p AccessPoint) ResourcePath() string {
+	return "/" + p.Region + "/"
+}
+
+// ObjectLambdaAccessPoint is an S3 Object Lambda Access Point, the
+// transformations it applies to objects fetched through it, and its policy
+type ObjectLambdaAccessPoint struct {
+	Region        string                    `json:"-"`
+	Name          string                    `json:"-"`
+	Configuration ObjectLambdaConfiguration `json:"Configuration"`
+	Policy        *PolicyDocument           `json:"Policy,omitempty"`
+}
+
+// ObjectLambdaConfiguration is written the way the aws cli expects it for
+// --configuration
+type ObjectLambdaConfiguration struct {
+	SupportingAccessPoint        string                                    `json:"SupportingAccessPoint"`
+	CloudWatchMetricsEnabled     bool                                      `json:"CloudWatchMetricsEnabled,omitempty"`
+	AllowedFeatures              []string                                  `json:"AllowedFeatures,omitempty"`
+	TransformationConfigurations []ObjectLambdaTransformationConfiguration `json:"TransformationConfigurations"`
+}
+
+type ObjectLambdaTransformationConfiguration struct {
+	Actions               []string                          `json:"Actions"`
+	ContentTransformation ObjectLambdaContentTransformation `json:"ContentTransformation"`
+}
+
+type ObjectLambdaContentTransformation struct {
+	AwsLambda AwsLambdaTransformation `json:"AwsLambda"`
+}
+
+type AwsLambdaTransformation struct {
+	FunctionArn     string `json:"FunctionArn"`
+	FunctionPayload string `json:"FunctionPayload,omitempty"`
+}
+
+func (p ObjectLambdaAccessPoint) Service() string {
+	return "s3control"
+}
+
+func (p ObjectLambdaAccessPoint) ResourceType() string {
+	return "objectlambda"
+}
+
+func (p ObjectLambdaAccessPoint) ResourceName() string {
+	return p.Name
+}
+
+func (p ObjectLambdaAccessPoint) ResourcePath() string {
+	return "/" + p.Region + "/"
+}
+
+// MultiRegionAccessPoint is an S3 Multi-Region Access Point and its policy.
+// Its buckets and Block Public Access configuration can't be changed once
+// it's created
+type MultiRegionAccessPoint struct {
+	Name              string                         `json:"-"`
+	Regions           []MultiRegionAccessPointRegion `json:"Regions"`
+	PublicAccessBlock *PublicAccessBlock             `json:"PublicAccessBlock,omitempty"`
+	Policy            *PolicyDocument                `json:"Policy,omitempty"`
+}
+
+// MultiRegionAccessPointRegion is a bucket a Multi-Region Access Point routes
+// requests to. Region is only informational, it's the bucket's region
+type MultiRegionAccessPointRegion struct {
+	Bucket string `json:"Bucket"`
+	Region string `json:"Region,omitempty"`
+}
+
+func (p MultiRegionAccessPoint) Service() string {
+	return "s3control"
+}
+
+func (p MultiRegionAccessPoint) ResourceType() string {
+	return "mrap"
+}
+
+func (p MultiRegionAccessPoint) ResourceName() string {
+	return p.Name
+}
+
+func (p MultiRegionAccessPoint) ResourcePath() string {
+	return "/"
+}
+
+// configurationJson is the immutable part of the access point, for comparison
+func (p MultiRegionAccessPoint) configurationJson() string {
+	buckets := []string{}
+	for _, r := range p.Regions {
+		buckets = append(buckets, r.Bucket)
+	}
+	b, err := json.Marshal(struct {
+		Buckets           []string
+		PublicAccessBlock *PublicAccessBlock
+	}{buckets, p.PublicAccessBlock})
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// GlacierVaultPolicy is a Glacier vault's access policy and vault lock
+// policy. A vault lock policy can't be changed once it's locked, so it's only
+// pulled for reference and never pushed
+type GlacierVaultPolicy struct {
+	Region     string          `json:"-"`
+	VaultName  string          `json:"-"`
+	Policy     *PolicyDocument `json:"Policy,omitempty"`
+	LockPolicy *PolicyDocument `json:"LockPolicy,omitempty"`
+	LockState  string          `json:"LockState,omitempty"`
+}
+
+func (p GlacierVaultPolicy) Service() string {
+	return "glacier"
+}
+
+func (p GlacierVaultPolicy) ResourceType() string {
+	return "vault"
+}
+
+func (p GlacierVaultPolicy) ResourceName() string {
+	return p.VaultName
+}
+
+func (p GlacierVaultPolicy) ResourcePath() string {
+	return "/" + p.Region + "/"
+}
+
+// EcrRegistryPolicy is the permissions policy of an account's private ECR
+// registry in a region, which grants other accounts permission to replicate
+// images to it and to create repositories
+type EcrRegistryPolicy struct {
+	Region string          `json:"-"`
+	Policy *PolicyDocument `json:"Policy"`
+}
+
+func (p EcrRegistryPolicy) Service() string {
+	return "ecr"
+}
+
+func (p EcrRegistryPolicy) ResourceType() string {
+	return "registry"
+}
+
+func (p EcrRegistryPolicy) ResourceName() string {
+	return p.Region
+}
+
+func (p EcrRegistryPolicy) ResourcePath() string {
+	return "/"
+}
+
+// normalise sorts the unordered lists of the configuration, so equivalent
+// configurations compare equal
+func (c *ObjectLambdaConfiguration) normalise() {
+	sort.Strings(c.AllowedFeatures)
+	for _, t := range c.TransformationConfigurations {
+		sort.Strings(t.Actions)
+	}
+}
+
+func (c ObjectLambdaConfiguration) JsonString() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
 type AccountData struct {
-	Account          *Account
-	Users            []*User
-	Groups           []*Group
-	Roles            []*Role
-	Policies         []*Policy
-	BucketPolicies   []*BucketPolicy
-	InstanceProfiles []*InstanceProfile
+	Account                        *Account
+	Users                          []*User
+	Groups                         []*Group
+	Roles                          []*Role
+	Policies                       []*Policy
+	BucketPolicies                 []*BucketPolicy
+	AccountPublicAccessBlock       *AccountPublicAccessBlock
+	InstanceProfiles               []*InstanceProfile
+	CodeArtifactDomainPolicies     []*CodeArtifactDomainPolicy
+	CodeArtifactRepositoryPolicies []*CodeArtifactRepositoryPolicy
+	SesIdentityPolicies            []*SesIdentityPolicies
+	RestApiPolicies                []*RestApiPolicy
+	AccessPoints                   []*AccessPoint
+	ObjectLambdaAccessPoints       []*ObjectLambdaAccessPoint
+	GlacierVaultPolicies           []*GlacierVaultPolicy
+	MultiRegionAccessPoints        []*MultiRegionAccessPoint
+	EcrRegistryPolicies            []*EcrRegistryPolicy
+
+	// Warnings are the problems found while fetching or loading the data
+	Warnings Warnings
+
+	// AwsManagedPolicyVersions are the default versions of the AWS managed
+	// policies the users, groups and roles refer to, by ARN, when fetched
+	AwsManagedPolicyVersions map[string]string
+
+	// layout is the layout of the files the data was loaded from
+	layout *Layout
+
+	// loadedFrom is the file each resource was loaded from, or the template
+	// generating it, relative to the directory
+	loadedFrom map[AwsResource]string
+
+	// sources are where the policy documents loaded from the files were
+	// written
+	sources map[*PolicyDocument]documentSource
+
+	// canonicalUserId is the S3 canonical user id of the account, needed to
+	// keep the owner's grant when replacing a bucket ACL
+	canonicalUserId string
+
+	// interned is the table the strings of the data are interned in
+	interned *stringTable
 }
 
 func NewAccountData(account string) *AccountData {
@@ -171,6 +656,101 @@ func NewAccountData(account string) *AccountData {
 	}
 }
 
+// resources returns every resource in the account data, in the order they're
+// dumped
+func (a *AccountData) resources() []AwsResource {
+	result := []AwsResource{}
+	for _, u := range a.Users {
+		result = append(result, u)
+	}
+	for _, g := range a.Groups {
+		result = append(result, g)
+	}
+	for _, r := range a.Roles {
+		result = append(result, r)
+	}
+	for _, p := range a.Policies {
+		result = append(result, p)
+	}
+	for _, p := range a.InstanceProfiles {
+		result = append(result, p)
+	}
+	for _, bp := range a.BucketPolicies {
+		result = append(result, bp)
+	}
+	if a.AccountPublicAccessBlock != nil {
+		result = append(result, a.AccountPublicAccessBlock)
+	}
+	for _, p := range a.CodeArtifactDomainPolicies {
+		result = append(result, p)
+	}
+	for _, p := range a.CodeArtifactRepositoryPolicies {
+		result = append(result, p)
+	}
+	for _, p := range a.SesIdentityPolicies {
+		result = append(result, p)
+	}
+	for _, p := range a.RestApiPolicies {
+		result = append(result, p)
+	}
+	for _, ap := range a.AccessPoints {
+		result = append(result, ap)
+	}
+	for _, ap := range a.ObjectLambdaAccessPoints {
+		result = append(result, ap)
+	}
+	for _, ap := range a.MultiRegionAccessPoints {
+		result = append(result, ap)
+	}
+	for _, p := range a.GlacierVaultPolicies {
+		result = append(result, p)
+	}
+	for _, p := range a.EcrRegistryPolicies {
+		result = append(result, p)
+	}
+	return result
+}
+
+// addResource adds a resource of any type to the account data
+func (a *AccountData) addResource(r AwsResource) {
+	switch r := r.(type) {
+	case *User:
+		a.addUser(r)
+	case *Group:
+		a.addGroup(r)
+	case *Role:
+		a.addRole(r)
+	case *Policy:
+		a.addPolicy(r)
+	case *InstanceProfile:
+		a.addInstanceProfile(r)
+	case *BucketPolicy:
+		a.addBucketPolicy(r)
+	case *AccountPublicAccessBlock:
+		a.AccountPublicAccessBlock = r
+	case *CodeArtifactDomainPolicy:
+		a.addCodeArtifactDomainPolicy(r)
+	case *CodeArtifactRepositoryPolicy:
+		a.addCodeArtifactRepositoryPolicy(r)
+	case *SesIdentityPolicies:
+		a.addSesIdentityPolicies(r)
+	case *RestApiPolicy:
+		a.addRestApiPolicy(r)
+	case *AccessPoint:
+		a.addAccessPoint(r)
+	case *ObjectLambdaAccessPoint:
+		a.addObjectLambdaAccessPoint(r)
+	case *MultiRegionAccessPoint:
+		a.addMultiRegionAccessPoint(r)
+	case *GlacierVaultPolicy:
+		a.addGlacierVaultPolicy(r)
+	case *EcrRegistryPolicy:
+		a.addEcrRegistryPolicy(r)
+	default:
+		panic(fmt.Sprintf("Unknown resource type %T", r))
+	}
+}
+
 func (a *AccountData) addUser(u *User) {
 	a.Users = append(a.Users, u)
 }
@@ -195,6 +775,22 @@ func (a *AccountData) addBucketPolicy(bp *BucketPolicy) {
 	a.BucketPolicies = append(a.BucketPolicies, bp)
 }
 
+func (a *AccountData) addCodeArtifactDomainPolicy(p *CodeArtifactDomainPolicy) {
+	a.CodeArtifactDomainPolicies = append(a.CodeArtifactDomainPolicies, p)
+}
+
+func (a *AccountData) addCodeArtifactRepositoryPolicy(p *CodeArtifactRepositoryPolicy) {
+	a.CodeArtifactRepositoryPolicies = append(a.CodeArtifactRepositoryPolicies, p)
+}
+
+func (a *AccountData) addSesIdentityPolicies(p *SesIdentityPolicies) {
+	a.SesIdentityPolicies = append(a.SesIdentityPolicies, p)
+}
+
+func (a *AccountData) addRestApiPolicy(p *RestApiPolicy) {
+	a.RestApiPolicies = append(a.RestApiPolicies, p)
+}
+
 func (a *AccountData) FindUserByName(name, path string) (bool, *User) {
 	for _, u := range a.Users {
 		if u.Name == name && u.Path == path {
@@ -255,6 +851,118 @@ func (a *AccountData) FindBucketPolicyByBucketName(name string) (bool, *BucketPo
 	return false, nil
 }
 
+func (a *AccountData) FindCodeArtifactDomainPolicyByDomainName(region, domain string) (bool, *CodeArtifactDomainPolicy) {
+	for _, p := range a.CodeArtifactDomainPolicies {
+		if p.Region == region && p.DomainName == domain {
+			return true, p
+		}
+	}
+
+	return false, nil
+}
+
+func (a *AccountData) FindCodeArtifactRepositoryPolicyByName(region, domain, repository string) (bool, *CodeArtifactRepositoryPolicy) {
+	for _, p := range a.CodeArtifactRepositoryPolicies {
+		if p.Region == region && p.DomainName == domain && p.RepositoryName == repository {
+			return true, p
+		}
+	}
+
+	return false, nil
+}
+
+func (a *AccountData) FindSesIdentityPoliciesByIdentity(region, identity string) (bool, *SesIdentityPolicies) {
+	for _, p := range a.SesIdentityPolicies {
+		if p.Region == region && p.Identity == identity {
+			return true, p
+		}
+	}
+
+	return false, nil
+}
+
+func (a *AccountData) addAccessPoint(p *AccessPoint) {
+	a.AccessPoints = append(a.AccessPoints, p)
+}
+
+func (a *AccountData) FindAccessPointByName(region, name string) (bool, *AccessPoint) {
+	for _, p := range a.AccessPoints {
+		if p.Region == region && p.Name == name {
+			return true, p
+		}
+	}
+
+	return false, nil
+}
+
+func (a *AccountData) addObjectLambdaAccessPoint(p *ObjectLambdaAccessPoint) {
+	p.Configuration.normalise()
+	a.ObjectLambdaAccessPoints = append(a.ObjectLambdaAccessPoints, p)
+}
+
+func (a *AccountData) FindObjectLambdaAccessPointByName(region, name string) (bool, *ObjectLambdaAccessPoint) {
+	for _, p := range a.ObjectLambdaAccessPoints {
+		if p.Region == region && p.Name == name {
+			return true, p
+		}
+	}
+
+	return false, nil
+}
+
+func (a *AccountData) addMultiRegionAccessPoint(p *MultiRegionAccessPoint) {
+	sort.Slice(p.Regions, func(i, j int) bool { return p.Regions[i].Bucket < p.Regions[j].Bucket })
+	a.MultiRegionAccessPoints = append(a.MultiRegionAccessPoints, p)
+}
+
+func (a *AccountData) FindMultiRegionAccessPointByName(name string) (bool, *MultiRegionAccessPoint) {
+	for _, p := range a.MultiRegionAccessPoints {
+		if p.Name == name {
+			return true, p
+		}
+	}
+
+	return false, nil
+}
+
+func (a *AccountData) addGlacierVaultPolicy(p *GlacierVaultPolicy) {
+	a.GlacierVaultPolicies = append(a.GlacierVaultPolicies, p)
+}
+
+func (a *AccountData) FindGlacierVaultPolicyByName(region, name string) (bool, *GlacierVaultPolicy) {
+	for _, p := range a.GlacierVaultPolicies {
+		if p.Region == region && p.VaultName == name {
+			return true, p
+		}
+	}
+
+	return false, nil
+}
+
+func (a *AccountData) addEcrRegistryPolicy(p *EcrRegistryPolicy) {
+	a.EcrRegistryPolicies = append(a.EcrRegistryPolicies, p)
+}
+
+func (a *AccountData) FindEcrRegistryPolicyByRegion(region string) (bool, *EcrRegistryPolicy) {
+	for _, p := range a.EcrRegistryPolicies {
+		if p.Region == region {
+			return true, p
+		}
+	}
+
+	return false, nil
+}
+
+func (a *AccountData) FindRestApiPolicyById(region, id string) (bool, *RestApiPolicy) {
+	for _, p := range a.RestApiPolicies {
+		if p.Region == region && p.RestApiId == id {
+			return true, p
+		}
+	}
+
+	return false, nil
+}
+
 func (a *Account) arnFor(key, path, name string) string {
 	return fmt.Sprintf("arn:aws:iam::%s:%s%s%s", a.Id, key, path, name)
 }
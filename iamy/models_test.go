@@ -27,3 +27,19 @@ func TestNewAccountFromStringWithNoAlias(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expected, a.Alias)
 	}
 }
+
+func TestNewBucketAclUsesCannedAcls(t *testing.T) {
+	if acl := newBucketAcl([]BucketGrant{}); acl != nil {
+		t.Errorf("Expected a private bucket to have no acl, got %v", acl)
+	}
+
+	acl := newBucketAcl([]BucketGrant{{Grantee: allUsersGroupUri, Permission: "READ"}})
+	if acl.Canned != "public-read" || len(acl.Grants) != 0 {
+		t.Errorf("Expected public-read, got %v", acl)
+	}
+
+	acl = newBucketAcl([]BucketGrant{{Grantee: allUsersGroupUri, Permission: "READ_ACP"}})
+	if acl.Canned != "" || len(acl.Grants) != 1 {
+		t.Errorf("Expected the grant to be kept, got %v", acl)
+	}
+}
@@ -0,0 +1,97 @@
+package iamy
+
+import "sort"
+
+// The phases of a plan. Commands run phase by phase, so policies exist before
+// they're attached, principals exist before they're associated with each
+// other, and everything is detached before it's deleted, in the reverse order
+// it's created
+const (
+	phaseRename = iota
+	phaseCreatePolicy
+	phaseCreatePrincipal
+	phaseAssociate
+	phaseResourcePolicy
+	phaseDisassociate
+	phaseDeleteInstanceProfile
+	phaseDeleteUser
+	phaseDeleteGroup
+	phaseDeleteRole
+	phaseDeletePolicy
+)
+
+var iamCmdPhases = map[string]int{
+	"update-group": phaseRename,
+	"update-user":  phaseRename,
+
+	"create-policy":         phaseCreatePolicy,
+	"create-policy-version": phaseCreatePolicy,
+	"delete-policy-version": phaseCreatePolicy,
+
+	"create-role":               phaseCreatePrincipal,
+	"update-role":               phaseCreatePrincipal,
+	"update-assume-role-policy": phaseCreatePrincipal,
+	"create-group":              phaseCreatePrincipal,
+	"create-user":               phaseCreatePrincipal,
+	"create-instance-profile":   phaseCreatePrincipal,
+
+	"attach-role-policy":            phaseAssociate,
+	"attach-group-policy":           phaseAssociate,
+	"attach-user-policy":            phaseAssociate,
+	"put-role-policy":               phaseAssociate,
+	"put-group-policy":              phaseAssociate,
+	"put-user-policy":               phaseAssociate,
+	"put-role-permissions-boundary": phaseAssociate,
+	"put-user-permissions-boundary": phaseAssociate,
+	"add-user-to-group":             phaseAssociate,
+	"add-role-to-instance-profile":  phaseAssociate,
+	"tag-user":                      phaseAssociate,
+
+	"detach-role-policy":                phaseDisassociate,
+	"detach-group-policy":               phaseDisassociate,
+	"detach-user-policy":                phaseDisassociate,
+	"delete-role-policy":                phaseDisassociate,
+	"delete-group-policy":               phaseDisassociate,
+	"delete-user-policy":                phaseDisassociate,
+	"delete-role-permissions-boundary":  phaseDisassociate,
+	"delete-user-permissions-boundary":  phaseDisassociate,
+	"remove-user-from-group":            phaseDisassociate,
+	"remove-role-from-instance-profile": phaseDisassociate,
+	"untag-user":                        phaseDisassociate,
+	"delete-access-key":                 phaseDisassociate,
+	"deactivate-mfa-device":             phaseDisassociate,
+	"delete-login-profile":              phaseDisassociate,
+
+	"delete-instance-profile": phaseDeleteInstanceProfile,
+	"delete-user":             phaseDeleteUser,
+	"delete-group":            phaseDeleteGroup,
+	"delete-role":             phaseDeleteRole,
+	"delete-policy":           phaseDeletePolicy,
+
+	// deleted in a later phase than it's deactivated in, as the command
+	// doesn't name the user so isn't run in order with the user's commands
+	"delete-virtual-mfa-device": phaseDeleteUser,
+}
+
+// phase returns the phase the command runs in. Commands for services other
+// than IAM set resource policies, which can refer to IAM principals, so they
+// run once the principals are created and before any are deleted
+func (c Cmd) phase() int {
+	if len(c.Args) >= 2 && c.Args[0] == "iam" {
+		if phase, ok := iamCmdPhases[c.Args[1]]; ok {
+			return phase
+		}
+	}
+	return phaseResourcePolicy
+}
+
+// dependencyOrdered returns the commands ordered by phase. Commands in the
+// same phase keep their order, so eg. an old policy version is still deleted
+// before a new one is created
+func (cc CmdList) dependencyOrdered() CmdList {
+	ordered := append(CmdList{}, cc...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].phase() < ordered[j].phase()
+	})
+	return ordered
+}
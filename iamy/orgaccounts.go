@@ -0,0 +1,207 @@
+package iamy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An AccountListUpdate is a list of accounts in a statement, in its AWS
+// principals or an account condition, updated for a change in the
+// organization. Units are the units the list enumerates every account of,
+// whose new accounts are Added, and Removed are the accounts that left the
+// organization. Note explains a change that couldn't be made
+type AccountListUpdate struct {
+	Statement PolicyStatement
+	ListedIn  string
+	Units     []string
+	Added     []string
+	Removed   []string
+	Note      string
+}
+
+func (u AccountListUpdate) String() string {
+	changes := []string{}
+	if len(u.Added) > 0 {
+		changes = append(changes, fmt.Sprintf("adds %s for %s", strings.Join(u.Added, ", "), strings.Join(u.Units, ", ")))
+	}
+	if len(u.Removed) > 0 {
+		changes = append(changes, fmt.Sprintf("removes %s, which left the organization", strings.Join(u.Removed, ", ")))
+	}
+	if u.Note != "" {
+		changes = append(changes, u.Note)
+	}
+	return fmt.Sprintf("%s %s: %s", u.Statement, u.ListedIn, strings.Join(changes, ", "))
+}
+
+// accountEntry is an entry of an account list, split around its account id,
+// eg. arn:aws:iam:: and :root
+type accountEntry struct {
+	account, prefix, suffix string
+}
+
+func parseAccountEntry(v string) (accountEntry, bool) {
+	m := accountIdInPrincipal.FindStringSubmatchIndex(v)
+	if m == nil {
+		return accountEntry{}, false
+	}
+	return accountEntry{v[m[2]:m[3]], v[:m[2]], v[m[3]:]}, true
+}
+
+// updateAccountList returns the new values of an account list, and the
+// update, or false when the list doesn't change
+func updateAccountList(values []string, previous, current *OrgInventory) ([]string, AccountListUpdate, bool) {
+	update := AccountListUpdate{Units: []string{}, Added: []string{}, Removed: []string{}}
+	listed := map[string]bool{}
+	forms := map[string]map[string]bool{}
+	for _, v := range values {
+		if e, ok := parseAccountEntry(v); ok {
+			listed[e.account] = true
+			form := e.prefix + "\x00" + e.suffix
+			if forms[form] == nil {
+				forms[form] = map[string]bool{}
+			}
+			forms[form][e.account] = true
+		}
+	}
+
+	removed := map[string]bool{}
+	for account := range listed {
+		_, wasMember := previous.account(account)
+		_, isMember := current.account(account)
+		if wasMember && !isMember {
+			removed[account] = true
+			update.Removed = append(update.Removed, account)
+		}
+	}
+
+	covered := []OrgUnit{}
+	for _, u := range previous.Units {
+		members := 0
+		all := true
+		for _, a := range previous.Accounts {
+			if strings.HasPrefix(a.Path, u.Path) {
+				members++
+				all = all && listed[a.Id]
+			}
+		}
+		if all && members > 1 {
+			covered = append(covered, u)
+		}
+	}
+	sort.Slice(covered, func(i, j int) bool { return covered[i].Path < covered[j].Path })
+	for i, u := range covered {
+		if i == 0 || !strings.HasPrefix(u.Path, update.Units[len(update.Units)-1]) {
+			update.Units = append(update.Units, u.Path)
+		}
+	}
+	for _, a := range current.Accounts {
+		for _, path := range update.Units {
+			if strings.HasPrefix(a.Path, path) && !listed[a.Id] {
+				update.Added = append(update.Added, a.Id)
+				break
+			}
+		}
+	}
+	for i, path := range update.Units {
+		if u, err := previous.unit(path); err == nil && u.Name != "" {
+			update.Units[i] = u.Name
+		}
+	}
+
+	// new accounts are listed in the forms every listed account has, eg.
+	// the root ARN or a deploy role in each account
+	common := []string{}
+	for form, accounts := range forms {
+		if len(accounts) == len(listed) {
+			common = append(common, form)
+		}
+	}
+	if len(update.Added) > 0 && len(common) == 0 {
+		update.Note = fmt.Sprintf("%s aren't added, the accounts aren't listed alike", strings.Join(update.Added, ", "))
+		update.Added = []string{}
+	}
+	sort.Strings(update.Added)
+	sort.Strings(update.Removed)
+	if len(update.Added) == 0 && len(update.Removed) == 0 && update.Note == "" {
+		return nil, update, false
+	}
+
+	result := []string{}
+	for _, v := range values {
+		if e, ok := parseAccountEntry(v); !ok || !removed[e.account] {
+			result = append(result, v)
+		}
+	}
+	for _, account := range update.Added {
+		for _, form := range common {
+			parts := strings.SplitN(form, "\x00", 2)
+			result = append(result, parts[0]+account+parts[1])
+		}
+	}
+	sort.Strings(result)
+	if len(result) == 0 {
+		update.Note = "every listed account left the organization, so the statement is left to remove by hand"
+		update.Removed = []string{}
+		return nil, update, true
+	}
+	return result, update, true
+}
+
+// listValue returns a list of condition or principal values as a policy
+// stores them
+func listValue(values []string) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	result := []interface{}{}
+	for _, v := range values {
+		result = append(result, v)
+	}
+	return result
+}
+
+// UpdateAccountLists updates the account lists of the account data's
+// statements for the change in the organization from the previous inventory
+// to the current one. A list of every account of a unit, with at least two
+// accounts, gets the unit's new accounts, in the forms every listed account
+// is listed in, and accounts that left the organization are removed from
+// every list. The resources are changed in place, and the changed resources
+// are returned with the updates
+func UpdateAccountLists(data *AccountData, previous, current *OrgInventory) ([]AccountListUpdate, []AwsResource) {
+	updates := []AccountListUpdate{}
+	changed := []AwsResource{}
+	for _, d := range data.policyDocuments() {
+		docChanged := false
+		for i, s := range d.doc.statements() {
+			sid, _ := s["Sid"].(string)
+			statement := PolicyStatement{File: d.file, Policy: d.policy, Index: i + 1, Sid: sid, doc: d.doc, data: s}
+			apply := func(listedIn string, values []string, set func(interface{})) {
+				if result, u, ok := updateAccountList(values, previous, current); ok {
+					u.Statement, u.ListedIn = statement, listedIn
+					updates = append(updates, u)
+					if len(u.Added) > 0 || len(u.Removed) > 0 {
+						set(listValue(result))
+						docChanged = true
+					}
+				}
+			}
+
+			if p, ok := s["Principal"].(map[string]interface{}); ok {
+				apply("Principal", conditionValues(p["AWS"]), func(v interface{}) { p["AWS"] = v })
+			}
+			conditions, _ := s["Condition"].(map[string]interface{})
+			for _, c := range statement.Conditions() {
+				if _, ok := orgConditionKeys[strings.ToLower(c.Key)]; ok {
+					keys := conditions[c.Operator].(map[string]interface{})
+					key := c.Key
+					apply(key+" condition", c.Values, func(v interface{}) { keys[key] = v })
+				}
+			}
+		}
+		if docChanged && (len(changed) == 0 || changed[len(changed)-1] != d.resource) {
+			changed = append(changed, d.resource)
+		}
+	}
+	return updates, changed
+}
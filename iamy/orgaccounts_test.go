@@ -0,0 +1,52 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUpdateAccountLists(t *testing.T) {
+	previous := testOrgInventory(t)
+	current := testOrgInventory(t)
+	current.Accounts = append(current.Accounts, OrgAccount{"666666666666", "new-prod", "o-abc/r-1/ou-workloads/ou-prod/"})
+	for i, a := range current.Accounts {
+		if a.Id == "555555555555" {
+			current.Accounts = append(current.Accounts[:i], current.Accounts[i+1:]...)
+			break
+		}
+	}
+
+	prod := `{"Version":"2012-10-17","Statement":[{"Sid":"Prod","Effect":"Allow","Principal":{"AWS":["arn:aws:iam::222222222222:role/deploy","arn:aws:iam::333333333333:role/deploy"]},"Action":"sts:AssumeRole"}]}`
+	mixed := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::222222222222:root","arn:aws:iam::333333333333:role/deploy"]},"Action":"sts:AssumeRole"}]}`
+	bucket := `{"Version":"2012-10-17","Statement":[{"Sid":"Logs","Effect":"Allow","Principal":{"Service":"logging.s3.amazonaws.com"},"Action":"s3:PutObject","Resource":"*","Condition":{"StringEquals":{"aws:SourceAccount":["111111111111","555555555555"]}}}]}`
+	unrelated := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::222222222222:root"},"Action":"sts:AssumeRole"}]}`
+
+	data := NewAccountData("123")
+	data.addRole(&Role{iamService: iamService{Name: "deploy", Path: "/"}, AssumeRolePolicyDocument: mustPolicyDocument(t, prod)})
+	data.addRole(&Role{iamService: iamService{Name: "mixed", Path: "/"}, AssumeRolePolicyDocument: mustPolicyDocument(t, mixed)})
+	data.addRole(&Role{iamService: iamService{Name: "unrelated", Path: "/"}, AssumeRolePolicyDocument: mustPolicyDocument(t, unrelated)})
+	data.addBucketPolicy(&BucketPolicy{BucketName: "logs", Policy: mustPolicyDocument(t, bucket)})
+
+	updates, changed := UpdateAccountLists(data, previous, current)
+	if len(updates) != 3 || len(changed) != 2 {
+		t.Fatalf("Expected 3 updates of 2 resources, got %v %v", updates, changed)
+	}
+	if s := updates[0].String(); s != "123/iam/role/deploy.yaml AssumeRolePolicyDocument statement Prod Principal: adds 666666666666 for prod" {
+		t.Errorf("Unexpected update %s", s)
+	}
+	if !strings.Contains(data.Roles[0].AssumeRolePolicyDocument.JsonString(), `"arn:aws:iam::666666666666:role/deploy"`) {
+		t.Errorf("Expected the new account's deploy role to be trusted, got %s", data.Roles[0].AssumeRolePolicyDocument.JsonString())
+	}
+	if u := updates[1]; len(u.Added) != 0 || !strings.Contains(u.Note, "aren't listed alike") {
+		t.Errorf("Expected accounts listed differently not to be extended, got %s", u)
+	}
+	if strings.Contains(data.Roles[1].AssumeRolePolicyDocument.JsonString(), "666666666666") {
+		t.Error("Expected the mixed list not to change")
+	}
+	if u := updates[2]; u.ListedIn != "aws:SourceAccount condition" || len(u.Removed) != 1 || u.Removed[0] != "555555555555" {
+		t.Errorf("Expected the account that left to be removed from the condition, got %s", u)
+	}
+	if s := data.BucketPolicies[0].Policy.JsonString(); !strings.Contains(s, `"aws:SourceAccount": "111111111111"`) {
+		t.Errorf("Expected only the remaining account in the condition, got %s", s)
+	}
+}
@@ -0,0 +1,193 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
+)
+
+type organizationsClient struct {
+	organizationsiface.OrganizationsAPI
+}
+
+func newOrganizationsClient(sess *session.Session) *organizationsClient {
+	return &organizationsClient{
+		organizations.New(sess),
+	}
+}
+
+// An OrgUnit is an organizational unit, or the root, of an organization.
+// Path is its path in aws:PrincipalOrgPaths form, eg.
+// o-a1b2c3d4e5/r-ab12/ou-ab12-11111111/
+type OrgUnit struct {
+	Id   string `json:"Id"`
+	Name string `json:"Name"`
+	Path string `json:"Path"`
+}
+
+// An OrgAccount is an account in an organization, with the path of the unit
+// it's in
+type OrgAccount struct {
+	Id   string `json:"Id"`
+	Name string `json:"Name"`
+	Path string `json:"Path"`
+}
+
+// An OrgInventory is the units and accounts of an organization
+type OrgInventory struct {
+	Id       string       `json:"Id"`
+	Units    []OrgUnit    `json:"Units"`
+	Accounts []OrgAccount `json:"Accounts"`
+}
+
+// inventory walks the organization from its roots, listing every unit and
+// account
+func (c *organizationsClient) inventory() (*OrgInventory, error) {
+	org, err := c.DescribeOrganization(&organizations.DescribeOrganizationInput{})
+	if err != nil {
+		return nil, err
+	}
+	inv := OrgInventory{Id: aws.StringValue(org.Organization.Id), Units: []OrgUnit{}, Accounts: []OrgAccount{}}
+
+	var walk func(unit OrgUnit) error
+	walk = func(unit OrgUnit) error {
+		inv.Units = append(inv.Units, unit)
+		err := c.ListAccountsForParentPages(&organizations.ListAccountsForParentInput{ParentId: aws.String(unit.Id)},
+			func(resp *organizations.ListAccountsForParentOutput, lastPage bool) bool {
+				for _, a := range resp.Accounts {
+					inv.Accounts = append(inv.Accounts, OrgAccount{aws.StringValue(a.Id), aws.StringValue(a.Name), unit.Path})
+				}
+				return true
+			})
+		if err != nil {
+			return err
+		}
+		children := []OrgUnit{}
+		err = c.ListOrganizationalUnitsForParentPages(&organizations.ListOrganizationalUnitsForParentInput{ParentId: aws.String(unit.Id)},
+			func(resp *organizations.ListOrganizationalUnitsForParentOutput, lastPage bool) bool {
+				for _, ou := range resp.OrganizationalUnits {
+					id := aws.StringValue(ou.Id)
+					children = append(children, OrgUnit{id, aws.StringValue(ou.Name), unit.Path + id + "/"})
+				}
+				return true
+			})
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	roots := []OrgUnit{}
+	err = c.ListRootsPages(&organizations.ListRootsInput{}, func(resp *organizations.ListRootsOutput, lastPage bool) bool {
+		for _, r := range resp.Roots {
+			id := aws.StringValue(r.Id)
+			roots = append(roots, OrgUnit{id, aws.StringValue(r.Name), inv.Id + "/" + id + "/"})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roots {
+		if err := walk(r); err != nil {
+			return nil, err
+		}
+	}
+	return &inv, nil
+}
+
+// FetchOrgInventory returns the units and accounts of the organization of
+// the credentials' account, which must be its management account or a
+// delegated administrator
+func (a *AwsFetcher) FetchOrgInventory() (*OrgInventory, error) {
+	if a.account == nil {
+		if err := a.init(); err != nil {
+			return nil, err
+		}
+	}
+	return a.orgs.inventory()
+}
+
+// unit returns the unit with the id, name or path, or an error when no unit
+// or several have it
+func (inv *OrgInventory) unit(ref string) (OrgUnit, error) {
+	found := []OrgUnit{}
+	for _, u := range inv.Units {
+		if u.Id == ref || u.Name == ref || u.Path == ref || u.Path == ref+"/" {
+			found = append(found, u)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return OrgUnit{}, fmt.Errorf("No organizational unit %s in %s", ref, inv.Id)
+	case 1:
+		return found[0], nil
+	}
+	ids := []string{}
+	for _, u := range found {
+		ids = append(ids, u.Id)
+	}
+	return OrgUnit{}, fmt.Errorf("Several organizational units are named %s, use one of %s", ref, strings.Join(ids, ", "))
+}
+
+// account returns the account with the id, if it's in the organization
+func (inv *OrgInventory) account(id string) (OrgAccount, bool) {
+	for _, a := range inv.Accounts {
+		if a.Id == id {
+			return a, true
+		}
+	}
+	return OrgAccount{}, false
+}
+
+// OrgTrustPolicy returns a trust policy allowing the principals of the
+// organization to perform the actions, eg. sts:AssumeRole, with an
+// aws:PrincipalOrgID condition. When units are given, by id, name or path,
+// only the principals in the accounts under them are allowed, with an
+// aws:PrincipalOrgPaths condition instead
+func OrgTrustPolicy(inv *OrgInventory, actions []string, units []string) (*PolicyDocument, error) {
+	condition := map[string]interface{}{"StringEquals": map[string]interface{}{"aws:PrincipalOrgID": inv.Id}}
+	if len(units) > 0 {
+		paths := []string{}
+		for _, ref := range units {
+			u, err := inv.unit(ref)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, u.Path+"*")
+		}
+		sort.Strings(paths)
+		condition = map[string]interface{}{"ForAnyValue:StringLike": map[string]interface{}{"aws:PrincipalOrgPaths": paths}}
+	}
+
+	var action interface{} = actions
+	if len(actions) == 1 {
+		action = actions[0]
+	}
+	j, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []interface{}{
+			map[string]interface{}{
+				"Effect":    "Allow",
+				"Principal": map[string]interface{}{"AWS": "*"},
+				"Action":    action,
+				"Condition": condition,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewPolicyDocumentFromJson(string(j))
+}
@@ -0,0 +1,89 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
+)
+
+type fakeOrganizations struct {
+	organizationsiface.OrganizationsAPI
+	units    map[string][]string
+	accounts map[string][]string
+}
+
+func (f *fakeOrganizations) DescribeOrganization(*organizations.DescribeOrganizationInput) (*organizations.DescribeOrganizationOutput, error) {
+	return &organizations.DescribeOrganizationOutput{Organization: &organizations.Organization{Id: aws.String("o-abc")}}, nil
+}
+
+func (f *fakeOrganizations) ListRootsPages(input *organizations.ListRootsInput, fn func(*organizations.ListRootsOutput, bool) bool) error {
+	fn(&organizations.ListRootsOutput{Roots: []*organizations.Root{{Id: aws.String("r-1"), Name: aws.String("Root")}}}, true)
+	return nil
+}
+
+func (f *fakeOrganizations) ListOrganizationalUnitsForParentPages(input *organizations.ListOrganizationalUnitsForParentInput, fn func(*organizations.ListOrganizationalUnitsForParentOutput, bool) bool) error {
+	resp := &organizations.ListOrganizationalUnitsForParentOutput{}
+	for _, name := range f.units[*input.ParentId] {
+		resp.OrganizationalUnits = append(resp.OrganizationalUnits, &organizations.OrganizationalUnit{Id: aws.String("ou-" + name), Name: aws.String(name)})
+	}
+	fn(resp, true)
+	return nil
+}
+
+func (f *fakeOrganizations) ListAccountsForParentPages(input *organizations.ListAccountsForParentInput, fn func(*organizations.ListAccountsForParentOutput, bool) bool) error {
+	resp := &organizations.ListAccountsForParentOutput{}
+	for _, id := range f.accounts[*input.ParentId] {
+		resp.Accounts = append(resp.Accounts, &organizations.Account{Id: aws.String(id), Name: aws.String("account-" + id)})
+	}
+	fn(resp, true)
+	return nil
+}
+
+func testOrgInventory(t *testing.T) *OrgInventory {
+	c := organizationsClient{&fakeOrganizations{
+		units:    map[string][]string{"r-1": {"workloads", "security"}, "ou-workloads": {"prod"}},
+		accounts: map[string][]string{"r-1": {"111111111111"}, "ou-prod": {"222222222222", "333333333333"}, "ou-workloads": {"444444444444"}, "ou-security": {"555555555555"}},
+	}}
+	inv, err := c.inventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+func TestOrgInventory(t *testing.T) {
+	inv := testOrgInventory(t)
+	if inv.Id != "o-abc" || len(inv.Units) != 4 || len(inv.Accounts) != 5 {
+		t.Fatalf("Unexpected inventory %+v", inv)
+	}
+	if a, ok := inv.account("333333333333"); !ok || a.Path != "o-abc/r-1/ou-workloads/ou-prod/" {
+		t.Errorf("Expected the account's path through its units, got %+v", a)
+	}
+}
+
+func TestOrgTrustPolicy(t *testing.T) {
+	inv := testOrgInventory(t)
+
+	doc, err := OrgTrustPolicy(inv, []string{"sts:AssumeRole"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.Join(strings.Fields(doc.JsonString()), ""); !strings.Contains(s, `"Action":"sts:AssumeRole"`) || !strings.Contains(s, `"StringEquals":{"aws:PrincipalOrgID":"o-abc"}`) {
+		t.Errorf("Expected a trust policy of the organization, got %s", s)
+	}
+
+	doc, err = OrgTrustPolicy(inv, []string{"sts:AssumeRole", "sts:TagSession"}, []string{"prod", "ou-security"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.Join(strings.Fields(doc.JsonString()), ""); !strings.Contains(s, `"ForAnyValue:StringLike":{"aws:PrincipalOrgPaths":["o-abc/r-1/ou-security/*","o-abc/r-1/ou-workloads/ou-prod/*"]}`) {
+		t.Errorf("Expected a trust policy of the units, got %s", s)
+	}
+
+	if _, err := OrgTrustPolicy(inv, []string{"sts:AssumeRole"}, []string{"staging"}); err == nil {
+		t.Error("Expected an error for a unit that isn't in the organization")
+	}
+}
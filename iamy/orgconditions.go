@@ -0,0 +1,146 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var accountIdInPrincipal = regexp.MustCompile(`^(?:arn:aws[a-z-]*:(?:iam|sts)::)?(\d{12})(?::|$)`)
+
+// orgConditionKeys are the organization condition keys that replace a list
+// of accounts, by where the accounts are listed
+var orgConditionKeys = map[string][2]string{
+	"principal":            {"aws:PrincipalOrgID", "aws:PrincipalOrgPaths"},
+	"aws:principalaccount": {"aws:PrincipalOrgID", "aws:PrincipalOrgPaths"},
+	"aws:sourceaccount":    {"aws:SourceOrgID", "aws:SourceOrgPaths"},
+	"aws:sourceowner":      {"aws:SourceOrgID", "aws:SourceOrgPaths"},
+}
+
+// An OrgConditionFinding is a statement that enumerates more accounts than
+// it should, in its Principal or in an account condition, where an
+// organization condition would be shorter and keep up with new accounts
+type OrgConditionFinding struct {
+	Statement  PolicyStatement
+	ListedIn   string
+	Accounts   []string
+	Suggestion string
+}
+
+func (f OrgConditionFinding) String() string {
+	return fmt.Sprintf("%s: lists %d accounts in %s, %s", f.Statement, len(f.Accounts), f.ListedIn, f.Suggestion)
+}
+
+// LoadOrgInventory reads an organization inventory written as JSON by iamy
+// org inventory
+func LoadOrgInventory(file string) (*OrgInventory, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var inv OrgInventory
+	if err := json.Unmarshal(b, &inv); err != nil {
+		return nil, validationError(file, err)
+	}
+	return &inv, nil
+}
+
+// listedAccounts returns the distinct accounts of a list of AWS principals or
+// account ids
+func listedAccounts(principals []string) []string {
+	seen := map[string]bool{}
+	accounts := []string{}
+	for _, p := range principals {
+		if m := accountIdInPrincipal.FindStringSubmatch(p); m != nil && !seen[m[1]] {
+			seen[m[1]] = true
+			accounts = append(accounts, m[1])
+		}
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// orgSuggestion suggests the organization condition to replace the list of
+// accounts with. With an inventory, the accounts outside the organization
+// are named, and the unit that holds all the accounts is suggested when
+// it's narrower than the organization
+func orgSuggestion(accounts []string, keys [2]string, inv *OrgInventory) string {
+	if inv == nil {
+		return fmt.Sprintf("use an %s or %s condition instead", keys[0], keys[1])
+	}
+
+	outside := []string{}
+	var common []string
+	for _, id := range accounts {
+		a, ok := inv.account(id)
+		if !ok {
+			outside = append(outside, id)
+			continue
+		}
+		path := strings.Split(strings.TrimSuffix(a.Path, "/"), "/")
+		if common == nil {
+			common = path
+			continue
+		}
+		i := 0
+		for i < len(common) && i < len(path) && common[i] == path[i] {
+			i++
+		}
+		common = common[:i]
+	}
+	if len(outside) > 0 {
+		return fmt.Sprintf("%s aren't in %s, so it can't be replaced by an organization condition", strings.Join(outside, ", "), inv.Id)
+	}
+	if len(common) <= 2 {
+		return fmt.Sprintf("use an %s condition of %s instead", keys[0], inv.Id)
+	}
+
+	path := strings.Join(common, "/") + "/"
+	others := 0
+	for _, a := range inv.Accounts {
+		if strings.HasPrefix(a.Path, path) {
+			others++
+		}
+	}
+	others -= len(accounts)
+	suggestion := fmt.Sprintf("use an %s condition of %s* instead", keys[1], path)
+	if others > 0 {
+		suggestion += fmt.Sprintf(", which also allows %d other accounts", others)
+	}
+	return suggestion
+}
+
+// OrgConditionReport reports the statements that allow more than
+// maxAccounts accounts by listing them, in their AWS principals or in an
+// aws:PrincipalAccount, aws:SourceAccount or aws:SourceOwner condition. The
+// inventory of the organization is optional, and makes the suggestions
+// specific
+func OrgConditionReport(data *AccountData, maxAccounts int, inv *OrgInventory) []OrgConditionFinding {
+	findings := []OrgConditionFinding{}
+	for _, s := range data.PolicyStatements() {
+		if effect, _ := s.data["Effect"].(string); effect != "Allow" {
+			continue
+		}
+		if p, ok := s.data["Principal"].(map[string]interface{}); ok {
+			if accounts := listedAccounts(conditionValues(p["AWS"])); len(accounts) > maxAccounts {
+				findings = append(findings, OrgConditionFinding{s, "Principal", accounts, orgSuggestion(accounts, orgConditionKeys["principal"], inv)})
+			}
+		}
+		for _, c := range s.Conditions() {
+			keys, ok := orgConditionKeys[strings.ToLower(c.Key)]
+			if !ok {
+				continue
+			}
+			if op := baseConditionOperator(c.Operator); op != "StringEquals" && op != "StringLike" {
+				continue
+			}
+			if accounts := listedAccounts(c.Values); len(accounts) > maxAccounts {
+				findings = append(findings, OrgConditionFinding{s, c.Key + " condition", accounts, orgSuggestion(accounts, keys, inv)})
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,40 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOrgConditionReport(t *testing.T) {
+	enumerated := `{"Version":"2012-10-17","Statement":[{"Sid":"Prod","Effect":"Allow","Principal":{"AWS":["arn:aws:iam::222222222222:root","arn:aws:iam::333333333333:role/deploy","arn:aws:iam::333333333333:role/ci"]},"Action":"sts:AssumeRole"}]}`
+	outside := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["111111111111","999999999999","555555555555"]},"Action":"sts:AssumeRole"}]}`
+	bucket := `{"Version":"2012-10-17","Statement":[{"Sid":"Logs","Effect":"Allow","Principal":{"Service":"logging.s3.amazonaws.com"},"Action":"s3:PutObject","Resource":"*","Condition":{"StringEquals":{"aws:SourceAccount":["111111111111","222222222222","555555555555"]}}}]}`
+
+	data := NewAccountData("123")
+	data.addRole(&Role{iamService: iamService{Name: "deploy", Path: "/"}, AssumeRolePolicyDocument: mustPolicyDocument(t, enumerated)})
+	data.addRole(&Role{iamService: iamService{Name: "partners", Path: "/"}, AssumeRolePolicyDocument: mustPolicyDocument(t, outside)})
+	data.addBucketPolicy(&BucketPolicy{BucketName: "logs", Policy: mustPolicyDocument(t, bucket)})
+
+	if findings := OrgConditionReport(data, 3, nil); len(findings) != 0 {
+		t.Errorf("Expected no statement to list more than 3 accounts, got %v", findings)
+	}
+
+	findings := OrgConditionReport(data, 1, nil)
+	if len(findings) != 3 {
+		t.Fatalf("Expected 3 statements listing more than one account, got %v", findings)
+	}
+	if s := findings[0].String(); s != "123/iam/role/deploy.yaml AssumeRolePolicyDocument statement Prod: lists 2 accounts in Principal, use an aws:PrincipalOrgID or aws:PrincipalOrgPaths condition instead" {
+		t.Errorf("Unexpected finding %s", s)
+	}
+
+	findings = OrgConditionReport(data, 1, testOrgInventory(t))
+	for i, suggestion := range []string{
+		"use an aws:PrincipalOrgPaths condition of o-abc/r-1/ou-workloads/ou-prod/* instead",
+		"999999999999 aren't in o-abc",
+		"use an aws:SourceOrgID condition of o-abc instead",
+	} {
+		if !strings.HasPrefix(findings[i].Suggestion, suggestion) {
+			t.Errorf("Expected the suggestion %q, got %q", suggestion, findings[i].Suggestion)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package iamy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+)
+
+// OwnershipFileName is the file in the yaml directory that sets which of the
+// accounts' policies iamy manages, and which it only observes because
+// another tool manages them
+const OwnershipFileName = ".iamy-ownership.yaml"
+
+const (
+	// OwnershipManage is for policies push changes to match the files
+	OwnershipManage = "manage"
+	// OwnershipObserve is for policies that are pulled and checked, but that
+	// push leaves as they are in AWS
+	OwnershipObserve = "observe"
+)
+
+// A PolicyOwnership is whether iamy manages or only observes the inline
+// policies of users, groups and roles, and the customer managed policies and
+// the policies attached to users, groups and roles. Both are managed by
+// default
+type PolicyOwnership struct {
+	InlinePolicies  string `json:"InlinePolicies,omitempty"`
+	ManagedPolicies string `json:"ManagedPolicies,omitempty"`
+}
+
+func (o PolicyOwnership) validate() error {
+	for name, v := range map[string]string{"InlinePolicies": o.InlinePolicies, "ManagedPolicies": o.ManagedPolicies} {
+		if v != "" && v != OwnershipManage && v != OwnershipObserve {
+			return fmt.Errorf("%s must be %s or %s, not %s", name, OwnershipManage, OwnershipObserve, v)
+		}
+	}
+	return nil
+}
+
+// LoadPolicyOwnership reads the ownership of the account's policies from the
+// ownership file in dir, eg.
+//
+//	Default:
+//	  InlinePolicies: manage
+//	Accounts:
+//	  myalias-123456789012:
+//	    InlinePolicies: observe
+//
+// An account, keyed by ALIAS-ID or ID, overrides the default. Without the
+// file every policy is managed
+func LoadPolicyOwnership(dir string, account *Account) (PolicyOwnership, error) {
+	file := struct {
+		Default  PolicyOwnership            `json:"Default"`
+		Accounts map[string]PolicyOwnership `json:"Accounts"`
+	}{}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, OwnershipFileName))
+	if os.IsNotExist(err) {
+		return PolicyOwnership{}, nil
+	}
+	if err != nil {
+		return PolicyOwnership{}, err
+	}
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		return PolicyOwnership{}, validationError(OwnershipFileName, err)
+	}
+
+	ownership := file.Default
+	if err = ownership.validate(); err != nil {
+		return PolicyOwnership{}, validationError(OwnershipFileName, err)
+	}
+	for name, o := range file.Accounts {
+		if err = o.validate(); err != nil {
+			return PolicyOwnership{}, validationError(OwnershipFileName, fmt.Errorf("%s: %s", name, err))
+		}
+	}
+	for _, name := range []string{account.Id, account.String()} {
+		if o, ok := file.Accounts[name]; ok {
+			if o.InlinePolicies != "" {
+				ownership.InlinePolicies = o.InlinePolicies
+			}
+			if o.ManagedPolicies != "" {
+				ownership.ManagedPolicies = o.ManagedPolicies
+			}
+		}
+	}
+	return ownership, nil
+}
+
+// Observed returns a copy of the files' data with the policies the ownership
+// only observes as they are in AWS, so nothing plans changes to them, and a
+// warning about each resource whose observed policies differ in the files
+func (o PolicyOwnership) Observed(aws, files *AccountData) (*AccountData, Warnings) {
+	inline := o.InlinePolicies == OwnershipObserve
+	managed := o.ManagedPolicies == OwnershipObserve
+	if !inline && !managed {
+		return files, nil
+	}
+
+	warnings := Warnings{}
+	warn := func(r AwsResource, what string) {
+		warnings.Add(WarningObserved, Arn(r, files.Account), fmt.Sprintf("The files change its %s, which are only observed, so push leaves them as they are in AWS", what))
+	}
+	warnPolicy := func(p *Policy, message string) {
+		warnings.Add(WarningObserved, Arn(p, files.Account), message+", but managed policies are only observed, so push leaves it as it is in AWS")
+	}
+	observeInline := func(r AwsResource, filesValue *[]InlinePolicy, awsValue []InlinePolicy) {
+		if len(inlinePolicySetDifference(*filesValue, awsValue))+len(inlinePolicySetDifference(awsValue, *filesValue)) > 0 {
+			warn(r, "inline policies")
+		}
+		*filesValue = awsValue
+	}
+	observeAttached := func(r AwsResource, filesValue *[]string, awsValue []string) {
+		if len(stringSetDifference(*filesValue, awsValue))+len(stringSetDifference(awsValue, *filesValue)) > 0 {
+			warn(r, "attached policies")
+		}
+		*filesValue = awsValue
+	}
+
+	result := files.filter(func(r AwsResource) bool {
+		_, ok := r.(*Policy)
+		return !ok || !managed
+	})
+	for i, u := range result.Users {
+		copied := *u
+		_, inAws := aws.FindUserByName(u.Name, u.Path)
+		if inAws == nil {
+			inAws = &User{}
+		}
+		if inline {
+			observeInline(&copied, &copied.InlinePolicies, inAws.InlinePolicies)
+		}
+		if managed {
+			observeAttached(&copied, &copied.Policies, inAws.Policies)
+		}
+		result.Users[i] = &copied
+	}
+	for i, g := range result.Groups {
+		copied := *g
+		_, inAws := aws.FindGroupByName(g.Name, g.Path)
+		if inAws == nil {
+			inAws = &Group{}
+		}
+		if inline {
+			observeInline(&copied, &copied.InlinePolicies, inAws.InlinePolicies)
+		}
+		if managed {
+			observeAttached(&copied, &copied.Policies, inAws.Policies)
+		}
+		result.Groups[i] = &copied
+	}
+	for i, r := range result.Roles {
+		copied := *r
+		_, inAws := aws.FindRoleByName(r.Name, r.Path)
+		if inAws == nil {
+			inAws = &Role{}
+		}
+		if inline {
+			observeInline(&copied, &copied.InlinePolicies, inAws.InlinePolicies)
+		}
+		if managed {
+			observeAttached(&copied, &copied.Policies, inAws.Policies)
+		}
+		result.Roles[i] = &copied
+	}
+
+	if managed {
+		for _, p := range files.Policies {
+			if found, inAws := aws.FindPolicyByName(p.Name, p.Path); !found {
+				warnPolicy(p, "The files add it")
+			} else if comparableJson(p) != comparableJson(inAws) {
+				warnPolicy(p, "The files change it")
+			}
+		}
+		for _, p := range aws.Policies {
+			result.addPolicy(p)
+			if found, _ := files.FindPolicyByName(p.Name, p.Path); !found {
+				warnPolicy(p, "The files are missing it")
+			}
+		}
+	}
+	return result, warnings
+}
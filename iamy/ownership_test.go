@@ -0,0 +1,78 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPolicyOwnership(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ownershiptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	account := NewAccountFromString("myalias-123")
+
+	if o, err := LoadPolicyOwnership(dir, account); err != nil || o != (PolicyOwnership{}) {
+		t.Errorf("Expected every policy managed without an ownership file, got %v %v", o, err)
+	}
+
+	file := "Default:\n  ManagedPolicies: observe\nAccounts:\n  myalias-123:\n    InlinePolicies: observe\n    ManagedPolicies: manage\n  other-456:\n    InlinePolicies: observe\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, OwnershipFileName), []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := LoadPolicyOwnership(dir, account); err != nil || o != (PolicyOwnership{InlinePolicies: OwnershipObserve, ManagedPolicies: OwnershipManage}) {
+		t.Errorf("Expected the account's ownership, got %v %v", o, err)
+	}
+	if o, err := LoadPolicyOwnership(dir, NewAccountFromString("789")); err != nil || o != (PolicyOwnership{ManagedPolicies: OwnershipObserve}) {
+		t.Errorf("Expected the default ownership, got %v %v", o, err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, OwnershipFileName), []byte("Default:\n  InlinePolicies: ignore\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadPolicyOwnership(dir, account); err == nil || !strings.Contains(err.Error(), "InlinePolicies must be manage or observe") {
+		t.Errorf("Expected an error for an unknown ownership, got %v", err)
+	}
+}
+
+func TestPlanSyncWithObservedPolicies(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	doc := func(action string) *PolicyDocument {
+		return mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"`+action+`","Resource":"*"}]}`)
+	}
+
+	remoteData := NewAccountData("123")
+	remoteData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{"reader"}, InlinePolicies: []InlinePolicy{{Name: "s3", Policy: doc("s3:GetObject")}}})
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc("s3:GetObject")})
+	localData := NewAccountData("123")
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{"writer"}, InlinePolicies: []InlinePolicy{{Name: "s3", Policy: doc("s3:PutObject")}}})
+	localData.addPolicy(&Policy{iamService: iamService{Name: "writer", Path: "/"}, Policy: doc("s3:PutObject")})
+
+	plan := PlanSyncWithOptions(remoteData, localData, SyncOptions{DisablePrune: true, Ownership: PolicyOwnership{InlinePolicies: OwnershipObserve}})
+	if actual := plan.Cmds.String(); strings.Contains(actual, "put-role-policy") || !strings.Contains(actual, "attach-role-policy --role-name app --policy-arn arn:aws:iam::123:policy/writer") {
+		t.Errorf("Expected the attachments planned but not the inline policy, got:\n%s", actual)
+	}
+	if plan.Warnings.Count(WarningObserved) != 1 {
+		t.Errorf("Expected a warning about the observed inline policy, got %v", plan.Warnings)
+	}
+
+	plan = PlanSyncWithOptions(remoteData, localData, SyncOptions{DisablePrune: true, Ownership: PolicyOwnership{ManagedPolicies: OwnershipObserve}})
+	if actual := plan.Cmds.String(); !strings.Contains(actual, "put-role-policy --role-name app --policy-name s3") || strings.Contains(actual, "policy/writer") || strings.Contains(actual, "detach") {
+		t.Errorf("Expected the inline policy planned but not the managed policies, got:\n%s", actual)
+	}
+	if n := plan.Warnings.Count(WarningObserved); n != 3 {
+		t.Errorf("Expected warnings about the attachment and both policies, got %v", plan.Warnings)
+	}
+
+	observed, _ := PolicyOwnership{InlinePolicies: OwnershipObserve, ManagedPolicies: OwnershipObserve}.Observed(remoteData, localData)
+	if drifts := DetectDrift(remoteData, observed); len(drifts) != 0 {
+		t.Errorf("Expected no drift in observed policies, got %+v", drifts)
+	}
+	if localData.Roles[0].Policies[0] != "writer" {
+		t.Errorf("Expected the files' data to be unchanged, got %v", localData.Roles[0])
+	}
+}
@@ -0,0 +1,245 @@
+package iamy
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PlanFormatVersion is the version of the JSON plan format
+const PlanFormatVersion = 1
+
+// A PlanCommand is a command of a plan, as both its arguments and the shell
+// command printed by push
+type PlanCommand struct {
+	Argv        []string `json:"Argv"`
+	Shell       string   `json:"Shell"`
+	Destructive bool     `json:"Destructive"`
+}
+
+func newPlanCommand(c Cmd) PlanCommand {
+	return PlanCommand{append([]string{c.Name}, c.Args...), c.String(), c.IsDestructive()}
+}
+
+// A PlanChange is a resource that differs between AWS and the files. Resource
+// is the resource's file in the account directory without the extension, and
+// Before and After are the resource as it's written to the file. A renamed or
+// moved resource is one change, and RenamedFrom is its file in AWS
+type PlanChange struct {
+	Resource    string        `json:"Resource"`
+	RenamedFrom string        `json:"RenamedFrom,omitempty"`
+	Action      string        `json:"Action"`
+	Before      AwsResource   `json:"Before,omitempty"`
+	After       AwsResource   `json:"After,omitempty"`
+	Commands    []PlanCommand `json:"Commands,omitempty"`
+}
+
+// A JsonPlan is a sync plan for CI systems and reviewers. Every command is
+// listed in Commands in the order it runs, and those that can be attributed
+// to a changed resource are also listed in its change
+type JsonPlan struct {
+	FormatVersion int           `json:"FormatVersion"`
+	Account       *Account      `json:"Account"`
+	Changes       []PlanChange  `json:"Changes"`
+	Commands      []PlanCommand `json:"Commands"`
+	Warnings      Warnings      `json:"Warnings,omitempty"`
+}
+
+func resourceKey(r AwsResource) string {
+	return r.Service() + "/" + r.ResourceType() + r.ResourcePath() + r.ResourceName()
+}
+
+func resourceJson(r AwsResource) string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// comparableJson is the resource's JSON without its informational
+// attributes, which only record what was pulled, to compare resources by
+func comparableJson(r AwsResource) string {
+	switch r := r.(type) {
+	case *Policy:
+		if r.DefaultVersionId != "" || r.CreateDate != nil {
+			c := *r
+			c.DefaultVersionId = ""
+			c.CreateDate = nil
+			return resourceJson(&c)
+		}
+	case *User:
+		if r.CreateDate != nil || r.RenamedFrom != "" {
+			c := *r
+			c.CreateDate = nil
+			c.RenamedFrom = ""
+			return resourceJson(&c)
+		}
+	case *Role:
+		if r.CreateDate != nil {
+			c := *r
+			c.CreateDate = nil
+			return resourceJson(&c)
+		}
+	}
+	return resourceJson(r)
+}
+
+func cmdFlag(c Cmd, flag string) string {
+	for i := 0; i < len(c.Args)-1; i++ {
+		if c.Args[i] == flag {
+			return c.Args[i+1]
+		}
+	}
+	return ""
+}
+
+// cmdScope is the resource a command changes, as far as can be told from its
+// arguments. path is the resource's path, or empty when the command doesn't
+// tell it
+type cmdScope struct {
+	service, resourceType, name, path string
+}
+
+func newCmdScope(c Cmd) (cmdScope, bool) {
+	if len(c.Args) < 2 {
+		return cmdScope{}, false
+	}
+	service, op := c.Args[0], c.Args[1]
+	region := cmdFlag(c, "--region")
+	regionPath := "/" + region + "/"
+
+	switch service {
+	case "iam":
+		for _, f := range []struct{ flag, resourceType string }{
+			{"--instance-profile-name", "instance-profile"},
+			{"--role-name", "role"},
+			{"--group-name", "group"},
+			{"--user-name", "user"},
+			{"--policy-name", "policy"},
+		} {
+			if name := cmdFlag(c, f.flag); name != "" {
+				return cmdScope{"iam", f.resourceType, name, ""}, true
+			}
+		}
+		if arn := cmdFlag(c, "--policy-arn"); arn != "" {
+			return cmdScope{"iam", "policy", arn[strings.LastIndex(arn, "/")+1:], ""}, true
+		}
+	case "s3api":
+		if bucket := cmdFlag(c, "--bucket"); bucket != "" {
+			return cmdScope{"s3", "", bucket, ""}, true
+		}
+	case "s3control":
+		switch {
+		case strings.Contains(op, "multi-region"):
+			var details struct{ Name string }
+			if json.Unmarshal([]byte(cmdFlag(c, "--details")), &details) == nil && details.Name != "" {
+				return cmdScope{"s3control", "mrap", details.Name, ""}, true
+			}
+		case strings.Contains(op, "object-lambda"):
+			return cmdScope{"s3control", "objectlambda", cmdFlag(c, "--name"), regionPath}, true
+		case strings.Contains(op, "access-point"):
+			return cmdScope{"s3control", "accesspoint", cmdFlag(c, "--name"), regionPath}, true
+		case strings.Contains(op, "public-access-block"):
+			return cmdScope{"s3control", "", accountPublicAccessBlockName, ""}, true
+		}
+	case "codeartifact":
+		if repo := cmdFlag(c, "--repository"); repo != "" {
+			return cmdScope{"codeartifact", "repository", repo, regionPath + cmdFlag(c, "--domain") + "/"}, true
+		}
+		return cmdScope{"codeartifact", "domain", cmdFlag(c, "--domain"), regionPath}, true
+	case "ses":
+		return cmdScope{"ses", "identity", cmdFlag(c, "--identity"), regionPath}, true
+	case "apigateway":
+		return cmdScope{"apigateway", "restapi", cmdFlag(c, "--rest-api-id"), regionPath}, true
+	case "glacier":
+		return cmdScope{"glacier", "vault", cmdFlag(c, "--vault-name"), regionPath}, true
+	case "ecr":
+		return cmdScope{"ecr", "registry", region, ""}, true
+	}
+
+	return cmdScope{}, false
+}
+
+func (s cmdScope) matches(r AwsResource) bool {
+	if s.service != r.Service() || s.resourceType != r.ResourceType() || s.name != r.ResourceName() {
+		return false
+	}
+	return s.path == "" || r.ResourcePath() == s.path
+}
+
+// jsonPlan describes the plan's changes resource by resource
+func (p *SyncPlan) jsonPlan() *JsonPlan {
+	plan := JsonPlan{
+		FormatVersion: PlanFormatVersion,
+		Account:       p.to.Account,
+		Changes:       []PlanChange{},
+		Commands:      []PlanCommand{},
+		Warnings:      p.Warnings,
+	}
+
+	changes := map[string]*PlanChange{}
+	keys := []string{}
+	change := func(r AwsResource) *PlanChange {
+		key := resourceKey(r)
+		if _, ok := changes[key]; !ok {
+			changes[key] = &PlanChange{Resource: key}
+			keys = append(keys, key)
+		}
+		return changes[key]
+	}
+	for _, r := range p.from.resources() {
+		change(r).Before = r
+	}
+	for _, r := range p.to.resources() {
+		change(r).After = r
+	}
+	for _, rename := range p.renames {
+		fromKey := resourceKey(rename.from)
+		ch := change(rename.to)
+		ch.RenamedFrom = fromKey
+		ch.Before = rename.from
+		delete(changes, fromKey)
+	}
+
+	for _, c := range p.Cmds {
+		pc := newPlanCommand(c)
+		plan.Commands = append(plan.Commands, pc)
+
+		scope, ok := newCmdScope(c)
+		if !ok {
+			continue
+		}
+		for _, key := range keys {
+			ch, ok := changes[key]
+			if !ok {
+				continue
+			}
+			if (ch.After != nil && scope.matches(ch.After)) || (ch.Before != nil && scope.matches(ch.Before)) {
+				ch.Commands = append(ch.Commands, pc)
+				break
+			}
+		}
+	}
+
+	for _, key := range keys {
+		ch, ok := changes[key]
+		if !ok {
+			continue
+		}
+		switch {
+		case ch.RenamedFrom != "":
+			ch.Action = "rename"
+		case ch.Before == nil:
+			ch.Action = "create"
+		case ch.After == nil:
+			ch.Action = "delete"
+		case comparableJson(ch.Before) != comparableJson(ch.After) || len(ch.Commands) > 0:
+			ch.Action = "update"
+		default:
+			continue
+		}
+		plan.Changes = append(plan.Changes, *ch)
+	}
+
+	return &plan
+}
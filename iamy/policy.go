@@ -1,11 +1,13 @@
 package iamy
 
 import (
+	"bytes"
 	"encoding/json"
 	"log"
 	"net/url"
 	"reflect"
 	"sort"
+	"sync"
 )
 
 func NewPolicyDocumentFromJson(jsonString string) (*PolicyDocument, error) {
@@ -29,9 +31,89 @@ func NewPolicyDocumentFromEncodedJson(encoded string) (*PolicyDocument, error) {
 
 // PolicyDocument represents an AWS policy document.
 // It normalises the data when Marshaling and Unmarshaling JSON
-// the same way AWS does to avoid conflicts when diffing
+// the same way AWS does to avoid conflicts when diffing.
+//
+// A document read from JSON is kept as its normalised JSON, which is all
+// comparing and writing it needs. It's only parsed into data on first
+// access, as the parsed documents are most of the memory of large accounts.
+// Once the document is interned in its account data's table, identical
+// documents share their JSON and the strings of their data. The data isn't
+// shared, so can be changed
 type PolicyDocument struct {
-	data interface{}
+	mu       sync.Mutex
+	json     string
+	data     interface{}
+	interned *stringTable
+}
+
+// value returns the data of the document, parsing it on first access
+func (p *PolicyDocument) value() interface{} {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.json != "" {
+		var data interface{}
+		if err := json.Unmarshal([]byte(p.json), &data); err != nil {
+			// the JSON was written by MarshalJSON
+			panic(err)
+		}
+		if p.interned != nil {
+			data = p.interned.internValue(data)
+		}
+		p.data, p.json = data, ""
+	}
+	return p.data
+}
+
+// intern interns the document's JSON in the table, or its data when it's
+// parsed, and keeps the table to intern the data it's parsed into later
+func (p *PolicyDocument) intern(t *stringTable) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.interned = t
+	if p.json != "" {
+		p.json = t.intern(p.json)
+	} else {
+		p.data = t.internValue(p.data)
+	}
+}
+
+// compact replaces the parsed data of the document with its normalised JSON,
+// until it's next accessed
+func (p *PolicyDocument) compact() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.json != "" {
+		return
+	}
+	if b, err := json.Marshal(recursivelyNormaliseAwsPolicy(p.data)); err == nil {
+		p.data, p.json = nil, string(b)
+		if p.interned != nil {
+			p.json = p.interned.intern(p.json)
+		}
+	}
+}
+
+// parsed returns whether the document's data has been parsed
+func (p *PolicyDocument) parsed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.json == ""
+}
+
+// equal returns whether the documents are the same once normalised
+func (p *PolicyDocument) equal(other *PolicyDocument) bool {
+	if p == nil || other == nil {
+		return p == other
+	}
+	a, errA := json.Marshal(p)
+	b, errB := json.Marshal(other)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
 }
 
 func (p *PolicyDocument) JsonString() string {
@@ -43,14 +125,28 @@ func (p *PolicyDocument) JsonString() string {
 	return string(jsonBytes)
 }
 
-func (p PolicyDocument) MarshalJSON() ([]byte, error) {
+func (p *PolicyDocument) MarshalJSON() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.json != "" {
+		return []byte(p.json), nil
+	}
 	return json.Marshal(recursivelyNormaliseAwsPolicy(p.data))
 }
 
 func (p *PolicyDocument) UnmarshalJSON(jsonData []byte) error {
-	err := json.Unmarshal(jsonData, &p.data)
-	p.data = recursivelyNormaliseAwsPolicy(p.data)
-	return err
+	var data interface{}
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return err
+	}
+	b, err := json.Marshal(recursivelyNormaliseAwsPolicy(data))
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data, p.json = nil, string(b)
+	return nil
 }
 
 // RecursivelyNormaliseAwsPolicy recursively searches i for slices
@@ -58,6 +154,9 @@ func (p *PolicyDocument) UnmarshalJSON(jsonData []byte) error {
 //  1. slices of length 1 become single strings
 //  2. slices of length > 1 are sorted
 func recursivelyNormaliseAwsPolicy(i interface{}) interface{} {
+	if i == nil {
+		return nil
+	}
 
 	switch reflect.TypeOf(i).Kind() {
 
@@ -66,8 +165,12 @@ func recursivelyNormaliseAwsPolicy(i interface{}) interface{} {
 		newMap := reflect.MakeMap(origMap.Type())
 		for _, key := range origMap.MapKeys() {
 			originalValue := origMap.MapIndex(key).Interface()
-			newValue := recursivelyNormaliseAwsPolicy(originalValue)
-			newMap.SetMapIndex(key, reflect.ValueOf(newValue))
+			newValue := reflect.ValueOf(recursivelyNormaliseAwsPolicy(originalValue))
+			if !newValue.IsValid() {
+				// SetMapIndex deletes the key when given the zero Value
+				newValue = reflect.Zero(origMap.Type().Elem())
+			}
+			newMap.SetMapIndex(key, newValue)
 		}
 		return newMap.Interface()
 
@@ -91,13 +194,11 @@ func recursivelyNormaliseAwsPolicy(i interface{}) interface{} {
 					sort.Strings(ss)
 					return stringSliceToInterfaceSlice(ss)
 				} else {
-					origSlice := reflect.ValueOf(ii)
-					newSlice := reflect.MakeSlice(origSlice.Type(), 0, origSlice.Cap())
+					newSlice := make([]interface{}, 0, len(ii))
 					for _, originalValue := range ii {
-						newValue := recursivelyNormaliseAwsPolicy(originalValue)
-						newSlice = reflect.Append(newSlice, reflect.ValueOf(newValue))
+						newSlice = append(newSlice, recursivelyNormaliseAwsPolicy(originalValue))
 					}
-					return newSlice.Interface()
+					return newSlice
 				}
 			}
 		}
@@ -133,3 +133,46 @@ func TestNewPolicyDocumentFromJson(t *testing.T) {
 		t.Errorf("Error decoding policy %s", err)
 	}
 }
+
+func TestNewPolicyDocumentFromJsonWithNulls(t *testing.T) {
+	for _, input := range []string{`null`, `{"Statement":[null]}`, `{"Statement":[{"Condition":null}]}`} {
+		doc, err := NewPolicyDocumentFromJson(input)
+		if err != nil {
+			t.Errorf("Error decoding policy %s: %s", input, err)
+			continue
+		}
+		again, err := NewPolicyDocumentFromJson(doc.JsonString())
+		if err != nil {
+			t.Errorf("Error decoding normalised policy %s: %s", doc.JsonString(), err)
+			continue
+		}
+		if doc.JsonString() != again.JsonString() {
+			t.Errorf("Expected normalising %s to be idempotent, got %s and %s", input, doc.JsonString(), again.JsonString())
+		}
+	}
+}
+
+func TestPolicyDocumentParsesLazily(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":"*"}]}`)
+	same := mustPolicyDocument(t, `{"Statement":[{"Resource":["*"],"Action":["s3:PutObject","s3:GetObject"],"Effect":"Allow"}],"Version":"2012-10-17"}`)
+	if doc.parsed() || same.parsed() {
+		t.Fatal("Expected the documents to be left unparsed until they're accessed")
+	}
+	if !doc.equal(same) || doc.Hash() != same.Hash() {
+		t.Error("Expected documents the same once normalised to be equal")
+	}
+	if doc.parsed() {
+		t.Error("Expected comparing documents not to parse them")
+	}
+
+	if statements := doc.statements(); len(statements) != 1 || statements[0]["Effect"] != "Allow" {
+		t.Fatalf("Unexpected statements %v", statements)
+	}
+	if !doc.parsed() || !doc.equal(same) {
+		t.Error("Expected the parsed document to still equal the unparsed one")
+	}
+	doc.value().(map[string]interface{})["Version"] = "2008-10-17"
+	if doc.equal(same) {
+		t.Error("Expected a change to the parsed document to be kept")
+	}
+}
@@ -0,0 +1,83 @@
+package iamy
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+func statementJson(s map[string]interface{}) string {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// diffStatements returns the statements only in before and only in after.
+// Statements are compared normalised, so reordering statements or the values
+// in them isn't a change
+func diffStatements(before, after *PolicyDocument) (removed, added []string) {
+	count := map[string]int{}
+	for _, s := range before.statements() {
+		count[statementJson(s)]++
+	}
+	for _, s := range after.statements() {
+		j := statementJson(s)
+		if count[j] > 0 {
+			count[j]--
+		} else {
+			added = append(added, j)
+		}
+	}
+	for _, s := range before.statements() {
+		j := statementJson(s)
+		if count[j] > 0 {
+			count[j]--
+			removed = append(removed, j)
+		}
+	}
+	return removed, added
+}
+
+// policyDiff describes the changes to a resource's policy documents as a
+// unified diff of their statements, with a comment naming each changed
+// document, and the file it's written in when that's a policy file, template
+// or anchor shared with other resources. It's empty if no statements changed
+func policyDiff(before, after []locatedPolicyDocument) string {
+	names := []string{}
+	docs := map[string][2]*PolicyDocument{}
+	sources := map[string]string{}
+	for i, located := range [][]locatedPolicyDocument{before, after} {
+		for _, d := range located {
+			pair, ok := docs[d.policy]
+			if !ok {
+				names = append(names, d.policy)
+			}
+			pair[i] = d.doc
+			docs[d.policy] = pair
+			if d.source != "" {
+				sources[d.policy] = d.source
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		removed, added := diffStatements(docs[name][0], docs[name][1])
+		if len(removed) == 0 && len(added) == 0 {
+			continue
+		}
+		if source, ok := sources[name]; ok {
+			b.WriteString("# " + name + ", from " + source + "\n")
+		} else {
+			b.WriteString("# " + name + "\n")
+		}
+		for _, s := range removed {
+			b.WriteString("- " + strings.ReplaceAll(s, "\n", "\n- ") + "\n")
+		}
+		for _, s := range added {
+			b.WriteString("+ " + strings.ReplaceAll(s, "\n", "\n+ ") + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,47 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyDiff(t *testing.T) {
+	before := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Action":["s3:GetObject","s3:ListBucket"],"Resource":"*"},
+		{"Effect":"Allow","Action":"sqs:SendMessage","Resource":"*"}]}`)
+	reordered := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Action":"sqs:SendMessage","Resource":"*"},
+		{"Effect":"Allow","Action":["s3:ListBucket","s3:GetObject"],"Resource":"*"}]}`)
+	after := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Action":["s3:GetObject","s3:ListBucket"],"Resource":"*"},
+		{"Effect":"Allow","Action":"sqs:ReceiveMessage","Resource":"*"}]}`)
+
+	located := func(doc *PolicyDocument) []locatedPolicyDocument {
+		return []locatedPolicyDocument{{policy: "Policy", doc: doc}}
+	}
+
+	if diff := policyDiff(located(before), located(reordered)); diff != "" {
+		t.Errorf("Expected reordering not to be a change, got:\n%s", diff)
+	}
+
+	expected := `# Policy
+- {
+-   "Action": "sqs:SendMessage",
+-   "Effect": "Allow",
+-   "Resource": "*"
+- }
++ {
++   "Action": "sqs:ReceiveMessage",
++   "Effect": "Allow",
++   "Resource": "*"
++ }
+`
+	if diff := policyDiff(located(before), located(after)); diff != expected {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expected, diff)
+	}
+
+	fromTemplate := []locatedPolicyDocument{{policy: "Policy", doc: after, source: "templates/services.yaml.tmpl"}}
+	if diff := policyDiff(located(before), fromTemplate); !strings.HasPrefix(diff, "# Policy, from templates/services.yaml.tmpl\n") {
+		t.Errorf("Expected the diff to name the template the document is from, got:\n%s", diff)
+	}
+}
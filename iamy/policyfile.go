@@ -0,0 +1,244 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// PolicyFilesDirName is the directory pull --policy-files writes the policy
+// documents to, as standalone JSON files
+const PolicyFilesDirName = "policies"
+
+// policyFileKey is the key of a file holding a policy document, relative to
+// the file referring to it, in place of the document under Policy, eg.
+//
+//	InlinePolicies:
+//	- Name: s3-read
+//	  PolicyFile: ../../../policies/s3-read.json
+const policyFileKey = "PolicyFile"
+
+// A policyFileRef is a policy document a resource's file refers to. Inline
+// is the name of the inline policy it's for, or empty for the resource's own
+// Policy, and File is relative to the directory
+type policyFileRef struct {
+	Inline string
+	File   string
+}
+
+// eachPolicyHolder calls fn with the content of a resource's file, and each
+// of its inline policies with the inline policy's name, as the mappings that
+// have a Policy or PolicyFile
+func eachPolicyHolder(content map[string]interface{}, fn func(m map[string]interface{}, inline string) error) error {
+	if err := fn(content, ""); err != nil {
+		return err
+	}
+	inlines, _ := content["InlinePolicies"].([]interface{})
+	for _, ip := range inlines {
+		if m, ok := ip.(map[string]interface{}); ok {
+			name, _ := m["Name"].(string)
+			if err := fn(m, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolvePolicyFile returns the file a resource's file refers to, relative to
+// the directory, which it must be in
+func resolvePolicyFile(relativePath string, ref interface{}) (string, error) {
+	s, ok := ref.(string)
+	if !ok || s == "" || filepath.IsAbs(s) || strings.HasPrefix(filepath.ToSlash(s), "/") {
+		return "", fmt.Errorf("%s must be the file of a policy document, relative to this file", policyFileKey)
+	}
+	file := filepath.ToSlash(filepath.Join(filepath.Dir(filepath.FromSlash(relativePath)), filepath.FromSlash(s)))
+	if file == ".." || strings.HasPrefix(file, "../") {
+		return "", fmt.Errorf("%s %s isn't in the directory", policyFileKey, s)
+	}
+	return file, nil
+}
+
+// expandPolicyFiles returns the resource's file with the policy documents it
+// refers to in place of their PolicyFile, and the files it refers to
+func (f *YamlLoadDumper) expandPolicyFiles(relativePath string, data []byte) ([]byte, []policyFileRef, error) {
+	if !bytes.Contains(data, []byte(policyFileKey)) {
+		return data, nil, nil
+	}
+	var content map[string]interface{}
+	if err := f.unmarshalYaml(relativePath, data, &content); err != nil || content == nil {
+		// the error is reported when the file is read as the resource
+		return data, nil, nil
+	}
+
+	refs := []policyFileRef{}
+	err := eachPolicyHolder(content, func(m map[string]interface{}, inline string) error {
+		ref, ok := m[policyFileKey]
+		if !ok {
+			return nil
+		}
+		if _, ok := m["Policy"]; ok {
+			return fmt.Errorf("Both Policy and %s are set, use one of them", policyFileKey)
+		}
+		file, err := resolvePolicyFile(relativePath, ref)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(file)))
+		if err != nil {
+			return errors.Wrapf(err, "Can't read %s %s", policyFileKey, ref)
+		}
+		var doc interface{}
+		if err = yaml.Unmarshal(b, &doc); err != nil {
+			return errors.Wrapf(err, "%s %s isn't a valid policy document", policyFileKey, ref)
+		}
+		m["Policy"] = doc
+		delete(m, policyFileKey)
+		refs = append(refs, policyFileRef{inline, file})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, validationError(relativePath, err)
+	}
+	if len(refs) == 0 {
+		return data, nil, nil
+	}
+	expanded, err := json.Marshal(content)
+	return expanded, refs, err
+}
+
+// policyFileRefs returns the policy files the resources' files refer to, by
+// the file referring to them. They're recorded as the files are loaded, or
+// found the first time they're needed when they weren't
+func (f *YamlLoadDumper) policyFileRefs() (map[string][]policyFileRef, error) {
+	if f.policyFiles != nil && f.policyFilesDir == f.Dir {
+		return f.policyFiles, nil
+	}
+	refs := map[string][]policyFileRef{}
+	files, err := f.getFilesRecursively()
+	if err != nil {
+		return nil, err
+	}
+	for _, fp := range files {
+		if (!strings.HasSuffix(fp, ".yaml") && !strings.HasSuffix(fp, ".json")) || !isResourceFileDir(fp) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(fp)))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Contains(data, []byte(policyFileKey)) {
+			continue
+		}
+		var content map[string]interface{}
+		if f.unmarshalYaml(fp, data, &content) != nil || content == nil {
+			continue
+		}
+		eachPolicyHolder(content, func(m map[string]interface{}, inline string) error {
+			if file, err := resolvePolicyFile(fp, m[policyFileKey]); err == nil {
+				refs[fp] = append(refs[fp], policyFileRef{inline, file})
+			}
+			return nil
+		})
+	}
+	f.policyFiles, f.policyFilesDir = refs, f.Dir
+	return refs, nil
+}
+
+// isResourceFileDir returns whether the file is outside the directories of
+// files that aren't resources, eg. the policy files
+func isResourceFileDir(relativePath string) bool {
+	for _, dir := range []string{ArchiveDirName, PolicyFilesDirName, TemplatesDirName} {
+		if strings.HasPrefix(relativePath, dir+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// withPolicyFiles returns what is written to a resource's file with its
+// policy documents in the files it referred to, and the documents to write
+// to them. With newFiles, the documents of files that didn't refer to a file
+// are written to files in PolicyFilesDirName. A file that several resources
+// refer to is left as it is when the document differs from it, with the
+// document in the resource's file instead
+func (f *YamlLoadDumper) withPolicyFiles(relativePath string, content interface{}, newFiles bool) (interface{}, map[string]interface{}, error) {
+	all, err := f.policyFileRefs()
+	if err != nil {
+		return nil, nil, err
+	}
+	refs := all[relativePath]
+	if len(refs) == 0 && !newFiles {
+		return content, nil, nil
+	}
+	uses := map[string]int{}
+	for _, fileRefs := range all {
+		for _, ref := range fileRefs {
+			uses[ref.File]++
+		}
+	}
+
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil || m == nil {
+		return content, nil, err
+	}
+
+	docs := map[string]interface{}{}
+	eachPolicyHolder(m, func(holder map[string]interface{}, inline string) error {
+		doc, ok := holder["Policy"]
+		if !ok || doc == nil {
+			return nil
+		}
+		file := ""
+		for _, ref := range refs {
+			if ref.Inline == inline {
+				file = ref.File
+			}
+		}
+		switch {
+		case file == "" && !newFiles:
+			return nil
+		case file == "":
+			file = PolicyFilesDirName + "/" + strings.TrimSuffix(relativePath, filepath.Ext(relativePath))
+			if inline != "" {
+				file += "/" + inline
+			}
+			file += ".json"
+		case uses[file] > 1 && !sameDocument(filepath.Join(f.Dir, filepath.FromSlash(file)), doc):
+			return nil
+		}
+		rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(relativePath)), filepath.FromSlash(file))
+		if err != nil {
+			return nil
+		}
+		holder[policyFileKey] = filepath.ToSlash(rel)
+		delete(holder, "Policy")
+		docs[file] = doc
+		return nil
+	})
+	return m, docs, nil
+}
+
+// sameDocument returns whether the policy file has the document, normalised
+func sameDocument(file string, doc interface{}) bool {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	var existing interface{}
+	if err = yaml.Unmarshal(b, &existing); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(recursivelyNormaliseAwsPolicy(existing), recursivelyNormaliseAwsPolicy(doc))
+}
@@ -0,0 +1,90 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPolicyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iamy-policy-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(file, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(file string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	s3Read := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+	write("policies/s3-read.json", s3Read)
+	write("myalias-123/iam/policy/reader.yaml", "PolicyFile: ../../../policies/s3-read.json\n")
+	write("myalias-123/iam/role/app.yaml", `AssumeRolePolicyDocument:
+  Version: "2012-10-17"
+InlinePolicies:
+- Name: s3-read
+  PolicyFile: ../../../policies/s3-read.json
+`)
+
+	files := YamlLoadDumper{Dir: dir}
+	accounts, err := files.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || len(accounts[0].Policies) != 1 || len(accounts[0].Roles) != 1 {
+		t.Fatalf("Expected the policy and the role, got %v", accounts)
+	}
+	data := &accounts[0]
+	role := data.Roles[0]
+	if !strings.Contains(data.Policies[0].Policy.JsonString(), "s3:GetObject") || !strings.Contains(role.InlinePolicies[0].Policy.JsonString(), "s3:GetObject") {
+		t.Errorf("Expected the documents of the policy file, got %s and %s", data.Policies[0].Policy.JsonString(), role.InlinePolicies[0].Policy.JsonString())
+	}
+
+	// the role's document changing doesn't change the file the policy shares,
+	// it's written in the role's file instead
+	role.InlinePolicies[0].Policy = mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]}`)
+	if err = files.Dump(data, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("myalias-123/iam/policy/reader.yaml"); got != "PolicyFile: ../../../policies/s3-read.json\n" {
+		t.Errorf("Expected the policy to keep referring to its policy file, got %s", got)
+	}
+	if got := read("policies/s3-read.json"); !strings.Contains(got, "s3:GetObject") {
+		t.Errorf("Expected the shared policy file unchanged, got %s", got)
+	}
+	if got := read("myalias-123/iam/role/app.yaml"); strings.Contains(got, "PolicyFile") || !strings.Contains(got, "s3:PutObject") {
+		t.Errorf("Expected the role's document in its file, got %s", got)
+	}
+
+	// pull --policy-files writes the documents to policy files
+	pulled := YamlLoadDumper{Dir: dir, PolicyFiles: true}
+	if err = pulled.Dump(data, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("myalias-123/iam/role/app.yaml"); !strings.Contains(got, "PolicyFile: ../../../policies/myalias-123/iam/role/app/s3-read.json") {
+		t.Errorf("Expected the role to refer to a new policy file, got %s", got)
+	}
+	if got := read("policies/myalias-123/iam/role/app/s3-read.json"); !strings.Contains(got, "s3:PutObject") {
+		t.Errorf("Expected the role's document in the new policy file, got %s", got)
+	}
+
+	write("myalias-123/iam/policy/outside.yaml", "PolicyFile: ../../../../s3-read.json\n")
+	if _, err = (&YamlLoadDumper{Dir: dir}).Load(); err == nil || !strings.Contains(err.Error(), "isn't in the directory") {
+		t.Errorf("Expected an error for a policy file outside the directory, got %v", err)
+	}
+}
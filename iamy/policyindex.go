@@ -0,0 +1,113 @@
+package iamy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Hash returns a hash of the normalised policy document, so documents that
+// only differ in ways AWS ignores, eg. the order of actions, hash the same.
+// A nil document hashes to an empty string
+func (p *PolicyDocument) Hash() string {
+	if p == nil {
+		return ""
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		panic(err)
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// A PolicyLocation is where a policy document is stored, and its hash
+type PolicyLocation struct {
+	Account string `json:"Account"`
+	File    string `json:"File"`
+	Policy  string `json:"Policy"`
+	Hash    string `json:"Hash"`
+
+	resource AwsResource
+}
+
+// A PolicyIndex finds policy documents by their hash. This is experimental,
+// and only used for duplicate and rename detection so far
+type PolicyIndex struct {
+	locations []PolicyLocation
+	byHash    map[string][]int
+}
+
+// NewPolicyIndex hashes every policy document of the accounts concurrently
+func NewPolicyIndex(accounts ...*AccountData) *PolicyIndex {
+	locations := []PolicyLocation{}
+	docs := []*PolicyDocument{}
+	for _, data := range accounts {
+		for _, d := range data.policyDocuments() {
+			if d.doc == nil {
+				continue
+			}
+			locations = append(locations, PolicyLocation{Account: data.Account.String(), File: d.file, Policy: d.policy, resource: d.resource})
+			docs = append(docs, d.doc)
+		}
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				locations[i].Hash = docs[i].Hash()
+			}
+		}()
+	}
+	for i := range docs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	idx := &PolicyIndex{locations: locations, byHash: map[string][]int{}}
+	for i, l := range locations {
+		idx.byHash[l.Hash] = append(idx.byHash[l.Hash], i)
+	}
+	return idx
+}
+
+// Locations returns every indexed policy document in the order of the
+// accounts and their files
+func (idx *PolicyIndex) Locations() []PolicyLocation {
+	return idx.locations
+}
+
+// Lookup returns where policy documents with the hash are stored
+func (idx *PolicyIndex) Lookup(hash string) []PolicyLocation {
+	result := []PolicyLocation{}
+	for _, i := range idx.byHash[hash] {
+		result = append(result, idx.locations[i])
+	}
+	return result
+}
+
+// Duplicates returns the locations of documents stored more than once,
+// grouped by document and ordered by where each is first stored
+func (idx *PolicyIndex) Duplicates() [][]PolicyLocation {
+	first := []int{}
+	for _, indexes := range idx.byHash {
+		if len(indexes) > 1 {
+			first = append(first, indexes[0])
+		}
+	}
+	sort.Ints(first)
+
+	result := [][]PolicyLocation{}
+	for _, i := range first {
+		result = append(result, idx.Lookup(idx.locations[i].Hash))
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package iamy
+
+import (
+	"testing"
+)
+
+func TestPolicyDocumentHashIsNormalised(t *testing.T) {
+	a := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:PutObject","s3:GetObject"],"Resource":"*"}]}`)
+	b := mustPolicyDocument(t, `{"Statement":[{"Resource":["*"],"Action":["s3:GetObject","s3:PutObject"],"Effect":"Allow"}],"Version":"2012-10-17"}`)
+	c := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+
+	if a.Hash() != b.Hash() {
+		t.Error("Expected documents differing only in order to hash the same")
+	}
+	if a.Hash() == c.Hash() {
+		t.Error("Expected different documents to hash differently")
+	}
+	if (*PolicyDocument)(nil).Hash() != "" {
+		t.Error("Expected a nil document to have no hash")
+	}
+}
+
+func TestPolicyIndexDuplicates(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+	other := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]}`)
+
+	prod := NewAccountData("123")
+	prod.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc})
+	prod.addPolicy(&Policy{iamService: iamService{Name: "writer", Path: "/"}, Policy: other})
+	staging := NewAccountData("456")
+	staging.addPolicy(&Policy{iamService: iamService{Name: "s3-reader", Path: "/"}, Policy: doc})
+
+	idx := NewPolicyIndex(prod, staging)
+	if len(idx.Locations()) != 3 {
+		t.Fatalf("Expected 3 indexed documents, got %v", idx.Locations())
+	}
+
+	duplicates := idx.Duplicates()
+	if len(duplicates) != 1 || len(duplicates[0]) != 2 {
+		t.Fatalf("Expected one document stored twice, got %v", duplicates)
+	}
+	if duplicates[0][0].File != "123/iam/policy/reader.yaml" || duplicates[0][1].File != "456/iam/policy/s3-reader.yaml" {
+		t.Errorf("Unexpected duplicate locations %v", duplicates[0])
+	}
+	if found := idx.Lookup(other.Hash()); len(found) != 1 || found[0].Account != "123" {
+		t.Errorf("Expected to find writer by its hash, got %v", found)
+	}
+}
@@ -0,0 +1,330 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// The styles policy documents can be written to the files in, set with
+// PolicyStyle in the layout file
+const (
+	// PolicyStyleCollapsed writes lists of one value as the value, the way
+	// AWS returns them. It's the default
+	PolicyStyleCollapsed = "collapsed"
+	// PolicyStyleExpanded writes actions, resources, principals and condition
+	// values as lists, even of one value
+	PolicyStyleExpanded = "expanded"
+	// PolicyStyleCompact writes each policy document as JSON on one line
+	PolicyStyleCompact = "compact"
+	// PolicyStyleConsole writes each policy document as JSON the way the AWS
+	// console does, indented by four spaces, with Version first and the keys
+	// of each statement in the order of Sid, Effect, Principal, Action,
+	// Resource and Condition
+	PolicyStyleConsole = "console"
+)
+
+// PolicyStyles are the styles policy documents can be written in
+var PolicyStyles = []string{PolicyStyleCollapsed, PolicyStyleExpanded, PolicyStyleCompact, PolicyStyleConsole}
+
+// policyDocumentKeys are the keys the resources' files hold policy documents
+// under
+var policyDocumentKeys = []string{"Policy", "AssumeRolePolicyDocument", "LockPolicy"}
+
+// consoleKeyOrder is the order the AWS console writes the keys of policy
+// documents and their statements in. Other keys follow, sorted
+var consoleKeyOrder = []string{"Version", "Id", "Statement", "Sid", "Effect", "Principal", "NotPrincipal", "Action", "NotAction", "Resource", "NotResource", "Condition"}
+
+// policyListKeys are the keys of a statement whose values can be lists
+var policyListKeys = []string{"Action", "NotAction", "Resource", "NotResource"}
+
+// isPolicyDocument returns whether the value under a key of a resource's
+// file is a policy document
+func isPolicyDocument(key string, v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok || !stringSliceContains(policyDocumentKeys, key) {
+		return false
+	}
+	_, hasStatement := m["Statement"]
+	_, hasVersion := m["Version"]
+	return hasStatement || hasVersion
+}
+
+// genericContent returns the content of a file as maps, lists and values
+func genericContent(content interface{}) (interface{}, error) {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	err = json.Unmarshal(b, &generic)
+	return generic, err
+}
+
+// eachPolicyDocument replaces each policy document in the content of a
+// resource's file with what fn returns for it
+func eachPolicyDocument(v interface{}, fn func(doc interface{}) interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if isPolicyDocument(k, child) {
+				v[k] = fn(child)
+			} else {
+				eachPolicyDocument(child, fn)
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			eachPolicyDocument(child, fn)
+		}
+	}
+}
+
+// expandPolicyLists returns the policy document with the values of its
+// statements that can be lists as lists
+func expandPolicyLists(doc interface{}) interface{} {
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return doc
+	}
+	asList := func(v interface{}) interface{} {
+		if s, ok := v.(string); ok {
+			return []interface{}{s}
+		}
+		return v
+	}
+	expandStatement := func(s interface{}) {
+		statement, ok := s.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, key := range policyListKeys {
+			if v, ok := statement[key]; ok {
+				statement[key] = asList(v)
+			}
+		}
+		for _, key := range []string{"Principal", "NotPrincipal"} {
+			if principals, ok := statement[key].(map[string]interface{}); ok {
+				for k, v := range principals {
+					principals[k] = asList(v)
+				}
+			}
+		}
+		if conditions, ok := statement["Condition"].(map[string]interface{}); ok {
+			for _, c := range conditions {
+				if values, ok := c.(map[string]interface{}); ok {
+					for k, v := range values {
+						values[k] = asList(v)
+					}
+				}
+			}
+		}
+	}
+	switch s := m["Statement"].(type) {
+	case []interface{}:
+		for _, statement := range s {
+			expandStatement(statement)
+		}
+	default:
+		expandStatement(s)
+	}
+	return m
+}
+
+// A jsonStyle is how JSON is written, on one line when it has no indent
+type jsonStyle struct {
+	indent  string
+	console bool
+}
+
+// docStyle is the style policy documents are written in JSON in
+func docStyle(style string) jsonStyle {
+	switch style {
+	case PolicyStyleCompact:
+		return jsonStyle{}
+	case PolicyStyleConsole:
+		return jsonStyle{indent: "    ", console: true}
+	}
+	return jsonStyle{indent: "  "}
+}
+
+// orderedKeys returns the keys of a map in the order the style writes them
+func (s jsonStyle) orderedKeys(m map[string]interface{}) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if !s.console {
+		return keys
+	}
+	ordered := []string{}
+	for _, k := range consoleKeyOrder {
+		if _, ok := m[k]; ok {
+			ordered = append(ordered, k)
+		}
+	}
+	for _, k := range keys {
+		if !stringSliceContains(consoleKeyOrder, k) {
+			ordered = append(ordered, k)
+		}
+	}
+	return ordered
+}
+
+// write writes the value as JSON, with its lines after the first prefixed
+// by prefix. The policy documents in it are written in the style of docs
+func (s jsonStyle) write(b *bytes.Buffer, v interface{}, prefix string, docs jsonStyle) error {
+	newline := func(depth int) {
+		if s.indent != "" {
+			b.WriteString("\n" + prefix + strings.Repeat(s.indent, depth))
+		}
+	}
+	separator := ":"
+	if s.indent != "" {
+		separator = ": "
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+		b.WriteString("{")
+		for i, k := range s.orderedKeys(v) {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			newline(1)
+			key, _ := json.Marshal(k)
+			b.Write(key)
+			b.WriteString(separator)
+			child, childStyle := v[k], s
+			if isPolicyDocument(k, child) {
+				childStyle = docs
+			}
+			if err := childStyle.write(b, child, prefix+s.indent, docs); err != nil {
+				return err
+			}
+		}
+		newline(0)
+		b.WriteString("}")
+	case []interface{}:
+		if len(v) == 0 {
+			b.WriteString("[]")
+			return nil
+		}
+		b.WriteString("[")
+		for i, child := range v {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			newline(1)
+			if err := s.write(b, child, prefix+s.indent, docs); err != nil {
+				return err
+			}
+		}
+		newline(0)
+		b.WriteString("]")
+	default:
+		j, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(j)
+	}
+	return nil
+}
+
+// styledJson returns the content of a file as JSON, with its policy
+// documents in the style. A file of a policy document alone is written in
+// the style too
+func styledJson(content interface{}, style string, document bool) ([]byte, error) {
+	if style == "" || style == PolicyStyleCollapsed {
+		return json.MarshalIndent(content, "", "  ")
+	}
+	generic, err := genericContent(content)
+	if err != nil {
+		return nil, err
+	}
+	if style == PolicyStyleExpanded {
+		if document {
+			generic = expandPolicyLists(generic)
+		}
+		eachPolicyDocument(generic, expandPolicyLists)
+		return json.MarshalIndent(generic, "", "  ")
+	}
+
+	var b bytes.Buffer
+	s := jsonStyle{indent: "  "}
+	if document {
+		s = docStyle(style)
+	}
+	err = s.write(&b, generic, "", docStyle(style))
+	return b.Bytes(), err
+}
+
+// styledYaml returns the content of a file as YAML, with its policy documents
+// in the style. Compact and console policy documents are written as JSON,
+// which is YAML too
+func styledYaml(content interface{}, style string) ([]byte, error) {
+	if style == "" || style == PolicyStyleCollapsed {
+		return yaml.Marshal(content)
+	}
+	generic, err := genericContent(content)
+	if err != nil {
+		return nil, err
+	}
+	if style == PolicyStyleExpanded {
+		eachPolicyDocument(generic, expandPolicyLists)
+		return yaml.Marshal(generic)
+	}
+
+	// the documents are replaced by placeholders, which are replaced by the
+	// documents' JSON once the rest is YAML
+	docs := []interface{}{}
+	eachPolicyDocument(generic, func(doc interface{}) interface{} {
+		docs = append(docs, doc)
+		return fmt.Sprintf("iamy-policy-document-%d", len(docs)-1)
+	})
+	y, err := yaml.Marshal(generic)
+	if err != nil || len(docs) == 0 {
+		return y, err
+	}
+
+	lines := strings.SplitAfter(string(y), "\n")
+	for i, line := range lines {
+		for n := range docs {
+			placeholder := fmt.Sprintf(": iamy-policy-document-%d\n", n)
+			if !strings.HasSuffix(line, placeholder) {
+				continue
+			}
+			indent := line[:len(line)-len(strings.TrimLeft(line, " -"))]
+			var b bytes.Buffer
+			if err = docStyle(style).write(&b, docs[n], strings.Repeat(" ", len(indent)), jsonStyle{}); err != nil {
+				return nil, err
+			}
+			lines[i] = strings.TrimSuffix(line, placeholder) + ": " + b.String() + "\n"
+		}
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+func writeStyledJsonFile(path string, content interface{}, style string, document bool) error {
+	b, err := styledJson(content, style, document)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0666)
+}
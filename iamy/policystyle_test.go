@@ -0,0 +1,78 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicyStyles(t *testing.T) {
+	data := loadTestdataAccount(t)
+	role := "myalias-123/iam/role/ecsInstanceRole"
+	expected := map[string]string{
+		PolicyStyleExpanded: "  - Action:\n    - sts:AssumeRole\n",
+		PolicyStyleCompact:  `AssumeRolePolicyDocument: {"Statement":[{"Action":"sts:AssumeRole",`,
+		PolicyStyleConsole:  "AssumeRolePolicyDocument: {\n    \"Version\": \"2008-10-17\",\n    \"Statement\": [\n        {\n            \"Sid\": \"\",\n            \"Effect\": \"Allow\",\n",
+	}
+
+	for _, style := range PolicyStyles {
+		for _, format := range []string{"yaml", "json"} {
+			dir, err := ioutil.TempDir("", "iamy-policy-style")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if err = ioutil.WriteFile(filepath.Join(dir, LayoutFileName), []byte("PolicyStyle: "+style+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			y := YamlLoadDumper{Dir: dir, Format: format}
+			if err = y.Dump(data, false); err != nil {
+				t.Fatalf("%s %s: %s", style, format, err)
+			}
+			if format == "yaml" && expected[style] != "" {
+				b, _ := ioutil.ReadFile(filepath.Join(dir, role+".yaml"))
+				if !strings.Contains(string(b), expected[style]) {
+					t.Errorf("%s: expected the role's file to contain\n%s\ngot\n%s", style, expected[style], b)
+				}
+			}
+
+			loaded, err := y.Load()
+			if err != nil {
+				t.Fatalf("%s %s: %s", style, format, err)
+			}
+			if len(loaded) != 1 {
+				t.Fatalf("%s %s: expected 1 account to be loaded, got %d", style, format, len(loaded))
+			}
+			if cmds := AwsCliCmdsForSync(data, &loaded[0]); len(cmds) > 0 {
+				t.Errorf("%s %s: expected the files to load as the data, got:\n%s", style, format, cmds)
+			}
+			if n := loaded[0].Warnings.Count(WarningNormalised); n != 0 {
+				t.Errorf("%s %s: expected the files iamy wrote not to need formatting, got %v", style, format, loaded[0].Warnings)
+			}
+
+			before := readDir(dir)
+			if err = y.Dump(&loaded[0], false); err != nil {
+				t.Fatal(err)
+			}
+			if after := readDir(dir); !reflect.DeepEqual(before, after) {
+				t.Errorf("%s %s: expected dumping loaded data to be stable\n%s", style, format, describeDirDifference(before, after))
+			}
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "iamy-policy-style")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, LayoutFileName), []byte("PolicyStyle: pretty\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadLayout(dir); err == nil || !strings.Contains(err.Error(), "Unknown PolicyStyle") {
+		t.Errorf("Expected an error for an unknown style, got %v", err)
+	}
+}
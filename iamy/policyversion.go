@@ -0,0 +1,173 @@
+package iamy
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+)
+
+// A PolicyVersion is a stored version of a customer managed policy
+type PolicyVersion struct {
+	PolicyArn string
+	VersionId string
+	IsDefault bool
+	Created   time.Time
+}
+
+// newPolicyVersions returns the policy's versions, oldest first
+func newPolicyVersions(arn string, versions []*iam.PolicyVersion) []PolicyVersion {
+	result := []PolicyVersion{}
+	for _, v := range versions {
+		result = append(result, PolicyVersion{
+			PolicyArn: arn,
+			VersionId: aws.StringValue(v.VersionId),
+			IsDefault: aws.BoolValue(v.IsDefaultVersion),
+			Created:   aws.TimeValue(v.CreateDate),
+		})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Created.Before(result[j].Created)
+	})
+	return result
+}
+
+// PolicyVersions returns the stored versions of the account's customer
+// managed policies, oldest first for each policy
+func (a *AccountData) PolicyVersions() []PolicyVersion {
+	result := []PolicyVersion{}
+	for _, p := range a.Policies {
+		result = append(result, p.versions...)
+	}
+	return result
+}
+
+// PrunablePolicyVersions returns the nondefault versions of each policy older
+// than its keep most recent versions, counting the default version
+func PrunablePolicyVersions(versions []PolicyVersion, keep int) []PolicyVersion {
+	byPolicy := map[string][]PolicyVersion{}
+	arns := []string{}
+	for _, v := range versions {
+		if _, ok := byPolicy[v.PolicyArn]; !ok {
+			arns = append(arns, v.PolicyArn)
+		}
+		byPolicy[v.PolicyArn] = append(byPolicy[v.PolicyArn], v)
+	}
+
+	result := []PolicyVersion{}
+	for _, arn := range arns {
+		vv := byPolicy[arn]
+		for _, v := range vv[:excessVersions(len(vv), keep)] {
+			if !v.IsDefault {
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+// excessVersions is how many of the oldest of stored versions are beyond the
+// keep most recent
+func excessVersions(stored, keep int) int {
+	if stored <= keep {
+		return 0
+	}
+	return stored - keep
+}
+
+// PolicyVersionDeleteCmds returns the commands deleting the versions
+func PolicyVersionDeleteCmds(versions []PolicyVersion) CmdList {
+	cmds := CmdList{}
+	for _, v := range versions {
+		cmds.Add("aws", "iam", "delete-policy-version",
+			"--policy-arn", v.PolicyArn,
+			"--version-id", v.VersionId)
+	}
+	return cmds
+}
+
+// PolicyDefaultVersion reads the id of the managed policy's default version
+// from AWS
+func (a *AwsFetcher) PolicyDefaultVersion(policyArn string) (string, error) {
+	version, err := a.iam.getPolicyDefaultVersion(policyArn)
+	return version, classifyAwsError(err)
+}
+
+// A PolicyVersionGuard checks the managed policies a plan creates a version
+// of still have the default version the plan was made from, before the
+// version is created, so a version made in AWS meanwhile isn't superseded
+type PolicyVersionGuard struct {
+	// DefaultVersion reads the id of the policy's default version from AWS
+	DefaultVersion func(policyArn string) (string, error)
+
+	planned map[string]string
+}
+
+// NewPolicyVersionGuard returns a guard for the default versions of the
+// policies the plan was made from
+func NewPolicyVersionGuard(plan *SyncPlan, defaultVersion func(policyArn string) (string, error)) *PolicyVersionGuard {
+	g := &PolicyVersionGuard{DefaultVersion: defaultVersion, planned: map[string]string{}}
+	for _, p := range plan.from.Policies {
+		if p.DefaultVersionId != "" {
+			g.planned[Arn(p, plan.from.Account)] = p.DefaultVersionId
+		}
+	}
+	return g
+}
+
+// Verify returns an *ErrConcurrentChange when the command creates a version
+// of a policy whose default version has changed since the plan was made
+func (g *PolicyVersionGuard) Verify(c Cmd) error {
+	if len(c.Args) < 2 || c.Args[1] != "create-policy-version" {
+		return nil
+	}
+	arn := cmdFlag(c, "--policy-arn")
+	planned, ok := g.planned[arn]
+	if !ok {
+		return nil
+	}
+	current, err := g.DefaultVersion(arn)
+	if err != nil {
+		return err
+	}
+	if current != planned {
+		return &ErrConcurrentChange{Resource: arn, Policy: "Policy", PlannedVersion: planned, CurrentVersion: current}
+	}
+	return nil
+}
+
+// ReadPolicyVersions reads the stored versions of the managed policy from
+// AWS, oldest first
+func (a *AwsFetcher) ReadPolicyVersions(policyArn string) ([]PolicyVersion, error) {
+	resp, err := a.iam.ListPolicyVersions(&iam.ListPolicyVersionsInput{PolicyArn: &policyArn})
+	if err != nil {
+		return nil, classifyAwsError(err)
+	}
+	return newPolicyVersions(policyArn, resp.Versions), nil
+}
+
+// deleteOldestPolicyVersion deletes the oldest nondefault version of the
+// policy a create-policy-version command failed to create a version of, as
+// the policy has the most versions it can, returning whether it did
+func (e Executor) deleteOldestPolicyVersion(c Cmd, err error) (bool, error) {
+	var limit *ErrLimitExceeded
+	if e.PolicyVersions == nil || len(c.Args) < 2 || c.Args[1] != "create-policy-version" || !errors.As(err, &limit) {
+		return false, nil
+	}
+	versions, verr := e.PolicyVersions(cmdFlag(c, "--policy-arn"))
+	if verr != nil {
+		return false, verr
+	}
+	for _, v := range versions {
+		if v.IsDefault {
+			continue
+		}
+		if e.OnVersionLimit != nil {
+			e.OnVersionLimit(c, v)
+		}
+		return true, e.run(PolicyVersionDeleteCmds([]PolicyVersion{v})[0])
+	}
+	return false, nil
+}
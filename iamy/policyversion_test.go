@@ -0,0 +1,123 @@
+package iamy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+)
+
+func TestPrunablePolicyVersions(t *testing.T) {
+	day := func(d int) *time.Time {
+		t := time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	versions := append(
+		newPolicyVersions("arn:aws:iam::123:policy/a", []*iam.PolicyVersion{
+			{VersionId: aws.String("v3"), IsDefaultVersion: aws.Bool(false), CreateDate: day(3)},
+			{VersionId: aws.String("v1"), IsDefaultVersion: aws.Bool(false), CreateDate: day(1)},
+			{VersionId: aws.String("v4"), IsDefaultVersion: aws.Bool(true), CreateDate: day(4)},
+			{VersionId: aws.String("v2"), IsDefaultVersion: aws.Bool(false), CreateDate: day(2)},
+		}),
+		newPolicyVersions("arn:aws:iam::123:policy/b", []*iam.PolicyVersion{
+			// the default version was set back to the oldest
+			{VersionId: aws.String("v1"), IsDefaultVersion: aws.Bool(true), CreateDate: day(1)},
+			{VersionId: aws.String("v2"), IsDefaultVersion: aws.Bool(false), CreateDate: day(2)},
+			{VersionId: aws.String("v3"), IsDefaultVersion: aws.Bool(false), CreateDate: day(3)},
+		})...,
+	)
+
+	ids := []string{}
+	for _, v := range PrunablePolicyVersions(versions, 2) {
+		ids = append(ids, v.PolicyArn[len("arn:aws:iam::123:policy/"):]+" "+v.VersionId)
+	}
+	if expected := []string{"a v1", "a v2"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+	if n := len(PrunablePolicyVersions(versions, 1)); n != 4 {
+		t.Errorf("Expected every nondefault version beyond the most recent to be prunable, got %d", n)
+	}
+}
+
+func TestPlanSyncPolicyVersionRetention(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addPolicy(&Policy{
+		iamService:           iamService{Name: "reader", Path: "/"},
+		numberOfVersions:     4,
+		nondefaultVersionIds: []string{"v1", "v2", "v3"},
+		Policy:               mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`),
+	})
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{
+		iamService: iamService{Name: "reader", Path: "/"},
+		Policy:     mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:ListBucket","Resource":"*"}]}`),
+	})
+
+	plan := PlanSyncWithOptions(remoteData, localData, SyncOptions{PolicyVersionRetention: 2})
+	actions := []string{}
+	for _, c := range plan.Cmds {
+		actions = append(actions, c.Args[1]+" "+cmdFlag(c, "--version-id"))
+	}
+	if expected := []string{"delete-policy-version v1", "delete-policy-version v2", "delete-policy-version v3", "create-policy-version "}; !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Expected %v, got %v", expected, actions)
+	}
+
+	if plan = PlanSync(remoteData, localData); len(plan.Cmds) != 1 {
+		t.Errorf("Expected no versions to be deleted below the quota, got\n%s", plan.Cmds)
+	}
+
+	remoteData.Policies[0].numberOfVersions = 5
+	plan = PlanSyncWithOptions(remoteData, localData, SyncOptions{KeepPolicyVersions: true})
+	if len(plan.Cmds) != 0 || len(plan.Errors) != 1 {
+		t.Errorf("Expected a plan error rather than deleting a version, got %v\n%s", plan.Errors, plan.Cmds)
+	}
+}
+
+func TestPlanSyncPulledPolicyVersion(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addPolicy(&Policy{
+		iamService:       iamService{Name: "reader", Path: "/"},
+		numberOfVersions: 2,
+		DefaultVersionId: "v3",
+		Policy:           mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`),
+	})
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{
+		iamService:       iamService{Name: "reader", Path: "/"},
+		DefaultVersionId: "v2",
+		Policy:           mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:ListBucket","Resource":"*"}]}`),
+	})
+
+	// the file's version is only informational, it's out of date once a push
+	// creates a version
+	plan := PlanSync(remoteData, localData)
+	if len(plan.Errors) != 0 || len(plan.Cmds) != 1 {
+		t.Fatalf("Expected the policy to be updated, got %v\n%s", plan.Errors, plan.Cmds)
+	}
+
+	current := "v3"
+	guard := NewPolicyVersionGuard(plan, func(policyArn string) (string, error) {
+		if policyArn != "arn:aws:iam::123:policy/reader" {
+			t.Errorf("Unexpected policy %s", policyArn)
+		}
+		return current, nil
+	})
+	if err := guard.Verify(plan.Cmds[0]); err != nil {
+		t.Errorf("Expected the version the plan was made from to be superseded, got %s", err)
+	}
+	current = "v4"
+	var concurrent *ErrConcurrentChange
+	if err := guard.Verify(plan.Cmds[0]); !errors.As(err, &concurrent) || concurrent.PlannedVersion != "v3" || concurrent.CurrentVersion != "v4" {
+		t.Errorf("Expected an error for the version made since the plan, got %v", err)
+	}
+
+	// the version alone isn't a change
+	localData.Policies[0].DefaultVersionId = "v1"
+	localData.Policies[0].Policy = remoteData.Policies[0].Policy
+	if plan = PlanSync(remoteData, localData); len(plan.Errors) != 0 || len(plan.Cmds) != 0 || len(plan.Drifts()) != 0 {
+		t.Errorf("Expected no changes when only the version differs, got %v\n%s", plan.Errors, plan.Cmds)
+	}
+}
@@ -0,0 +1,119 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+)
+
+// ProtectFileName is the file in the yaml directory that lists the resources
+// push must never delete
+const ProtectFileName = ".iamy-protect.yaml"
+
+// LoadProtectedResources reads the selectors of the resources push must never
+// delete from the protect file in dir. Without one no resources are protected
+func LoadProtectedResources(dir string) ([]ResourceSelector, error) {
+	file := struct {
+		Protect []string `json:"Protect"`
+	}{}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, ProtectFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		return nil, validationError(ProtectFileName, err)
+	}
+
+	selectors := []ResourceSelector{}
+	for _, p := range file.Protect {
+		s, err := ParseResourceSelector(p)
+		if err != nil {
+			return nil, validationError(ProtectFileName, err)
+		}
+		selectors = append(selectors, s)
+	}
+	return selectors, nil
+}
+
+// protect keeps the protected resources that are missing from the files, so
+// nothing deletes them. Each is warned about, as the files are probably
+// missing them by mistake
+func (a *awsSyncCmdGenerator) protect(selectors []ResourceSelector) {
+	a.keepMissing(func(r AwsResource) (WarningCategory, string, bool) {
+		for _, s := range selectors {
+			if s.matches(r) {
+				return WarningPlan, "Protected from deletion by " + s.String() + ", but missing from the files, so it won't be deleted", true
+			}
+		}
+		return "", "", false
+	})
+}
+
+// keepUnpruned keeps every resource that is missing from the files, when
+// deleting them isn't opted into. Renames delete the old name, so the kept
+// resources aren't renamed either, but users and groups are still moved.
+// Users the files say a new user is RenamedFrom aren't kept, as the files
+// ask for them to be renamed, so they're renamed as with --prune
+func (a *awsSyncCmdGenerator) keepUnpruned() {
+	renamedFrom := map[string]bool{}
+	for _, u := range a.to.Users {
+		if found, _ := a.from.FindUserByName(u.Name, u.Path); !found && u.RenamedFrom != "" {
+			renamedFrom[u.RenamedFrom] = true
+		}
+	}
+
+	a.keepMissing(func(r AwsResource) (WarningCategory, string, bool) {
+		if u, ok := r.(*User); ok && renamedFrom[u.Name] {
+			return "", "", false
+		}
+		return WarningPrune, "Missing from the files, but deletes aren't enabled, so it won't be deleted", true
+	})
+}
+
+// movedKey is the key of a user or group by its name alone, which is unique
+// whatever its path, so one at another path in the files is moved in place
+// rather than deleted. Other resources have none
+func movedKey(r AwsResource) string {
+	switch r.(type) {
+	case *User, *Group:
+		return r.ResourceType() + ":" + r.ResourceName()
+	}
+	return ""
+}
+
+// keepMissing keeps the resources in AWS that are missing from the files and
+// that keep selects, by planning against a copy of the files' data that
+// includes them, so nothing deletes them. Each is warned about with the
+// category and message keep returns
+func (a *awsSyncCmdGenerator) keepMissing(keep func(AwsResource) (WarningCategory, string, bool)) {
+	inTo := map[string]bool{}
+	for _, r := range a.to.resources() {
+		inTo[resourceKey(r)] = true
+		if key := movedKey(r); key != "" {
+			inTo[key] = true
+		}
+	}
+
+	to := a.to.filter(func(AwsResource) bool { return true })
+	for _, r := range a.from.resources() {
+		if inTo[resourceKey(r)] || (movedKey(r) != "" && inTo[movedKey(r)]) {
+			continue
+		}
+		if category, message, ok := keep(r); ok {
+			to.addResource(r)
+			name := resourceKey(r)
+			if r.Service() == "iam" {
+				name = Arn(r, a.to.Account)
+			}
+			a.warnings.Add(category, name, message)
+		}
+	}
+	a.to = to
+}
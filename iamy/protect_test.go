@@ -0,0 +1,80 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadProtectedResources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protecttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if selectors, err := LoadProtectedResources(dir); err != nil || len(selectors) != 0 {
+		t.Errorf("Expected nothing protected without a protect file, got %v %v", selectors, err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, ProtectFileName), []byte("Protect:\n- role/break-glass-*\n- bucket/audit-logs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	selectors, err := LoadProtectedResources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []ResourceSelector{{"role", "break-glass-*"}, {"bucket", "audit-logs"}}; !reflect.DeepEqual(selectors, expected) {
+		t.Errorf("Expected %v, got %v", expected, selectors)
+	}
+}
+
+func TestProtectedResourcesAreNotDeleted(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123:root"},"Action":"sts:AssumeRole"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addRole(&Role{iamService: iamService{Name: "break-glass-admin", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{"admin"}})
+	remoteData.addRole(&Role{iamService: iamService{Name: "old-app", Path: "/"}, AssumeRolePolicyDocument: trust})
+	localData := NewAccountData("123")
+
+	plan := PlanSyncWithOptions(remoteData, localData, SyncOptions{Protected: []ResourceSelector{{"role", "break-glass-*"}}})
+
+	expected := "aws iam delete-role --role-name old-app"
+	if actual := plan.Cmds.String(); actual != expected {
+		t.Errorf("Expected:\n%v\nActual:\n%v", expected, actual)
+	}
+	if plan.Warnings.Count(WarningPlan) != 1 || !strings.Contains(plan.Warnings[0].String(), "arn:aws:iam::123:role/break-glass-admin") {
+		t.Errorf("Expected a warning about the protected role, got %v", plan.Warnings)
+	}
+	for _, c := range plan.jsonPlan().Changes {
+		if c.Resource == "iam/role/break-glass-admin" {
+			t.Errorf("Expected the protected role to be unchanged, got %+v", c)
+		}
+	}
+	if len(localData.Roles) != 0 {
+		t.Errorf("Expected the files' data to be unchanged, got %v", localData.Roles)
+	}
+}
+
+func TestPlanSyncWithoutPrune(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	remoteData := NewAccountData("123")
+	remoteData.addRole(&Role{iamService: iamService{Name: "old-app", Path: "/"}, AssumeRolePolicyDocument: trust})
+	remoteData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}})
+	localData := NewAccountData("123")
+	localData.addUser(&User{iamService: iamService{Name: "bob", Path: "/staff/"}})
+	localData.addGroup(&Group{iamService: iamService{Name: "readers", Path: "/"}})
+
+	plan := PlanSyncWithOptions(remoteData, localData, SyncOptions{DisablePrune: true})
+
+	expected := "aws iam update-user --user-name bob --new-path /staff/\naws iam create-group --group-name readers --path /"
+	if actual := plan.Cmds.String(); actual != expected {
+		t.Errorf("Expected:\n%v\nActual:\n%v", expected, actual)
+	}
+	if plan.Warnings.Count(WarningPrune) != 1 || !strings.Contains(plan.Warnings[len(plan.Warnings)-1].String(), "arn:aws:iam::123:role/old-app") {
+		t.Errorf("Expected a warning about the role that isn't deleted, got %v", plan.Warnings)
+	}
+}
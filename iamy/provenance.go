@@ -0,0 +1,187 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A Source is where something was written in the files, the file relative to
+// the directory and the line in it, or 0 when the line isn't known
+type Source struct {
+	File string
+	Line int
+}
+
+func (s Source) String() string {
+	if s.Line == 0 {
+		return s.File
+	}
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// A documentSource is where a policy document loaded from the files was
+// written, which is the file of a policy file, template or anchor when the
+// resource's file doesn't have the document itself, and the line of each of
+// its statements by their normalised JSON, as the statements are sorted once
+// they're loaded
+type documentSource struct {
+	file  string
+	lines map[string]int
+}
+
+// effectKey matches the Effect every statement has, to find the statements
+// without a Sid in the order they're written
+var effectKey = regexp.MustCompile(`"?\bEffect"?\s*:`)
+
+// yamlAlias matches a key whose value is an alias of an anchor
+var yamlAlias = regexp.MustCompile(`^"?\w+"?\s*:\s*\*([^\s\[\]{},]+)`)
+
+func statementKey(s map[string]interface{}) string {
+	b, _ := json.Marshal(recursivelyNormaliseAwsPolicy(s))
+	return string(b)
+}
+
+// lineAt returns the line of the offset in the text
+func lineAt(text string, offset int) int {
+	return strings.Count(text[:offset], "\n") + 1
+}
+
+// findFrom returns the offset of the first match of the pattern in the text
+// from the offset, or -1 when there's none
+func findFrom(text string, from int, pattern string) int {
+	loc := regexp.MustCompile(pattern).FindStringSubmatchIndex(text[from:])
+	if loc == nil {
+		return -1
+	}
+	if len(loc) > 2 && loc[2] >= 0 {
+		return from + loc[2]
+	}
+	return from + loc[0]
+}
+
+// keyPattern matches the key in YAML or JSON, its name as the first group
+func keyPattern(key string) string {
+	return `(?:^|[\s{,\-])("?` + regexp.QuoteMeta(key) + `"?\s*:)`
+}
+
+// statementLines returns the line of each statement of the document, written
+// in the text from the offset. A statement with a Sid is found by it, and
+// the others by their Effect
+func statementLines(text string, start int, doc *PolicyDocument) map[string]int {
+	lines := map[string]int{}
+	effects := effectKey.FindAllStringIndex(text[start:], -1)
+	for i, s := range doc.statements() {
+		at := start
+		if sid, _ := s["Sid"].(string); sid != "" {
+			if found := findFrom(text, start, keyPattern("Sid")+`\s*["']?`+regexp.QuoteMeta(sid)+`["']?\s*(?:$|[,}\n])`); found >= 0 {
+				at = found
+			} else if i < len(effects) {
+				at = start + effects[i][0]
+			}
+		} else if i < len(effects) {
+			at = start + effects[i][0]
+		}
+		if key := statementKey(s); lines[key] == 0 {
+			lines[key] = lineAt(text, at)
+		}
+	}
+	return lines
+}
+
+// documentStart returns the file a resource's policy document was written
+// in, its text, and the offset the document starts at. The resource's file
+// is the file it was loaded from, or the template generating it
+func (f *YamlLoadDumper) documentStart(file string, d locatedPolicyDocument, read func(string) (string, error)) (string, string, int, error) {
+	key, inline := d.policy, ""
+	if strings.HasPrefix(key, "InlinePolicies[") {
+		key, inline = "Policy", strings.TrimSuffix(strings.TrimPrefix(key, "InlinePolicies["), "]")
+	}
+	if key == "Policy" {
+		for _, ref := range f.policyFiles[file] {
+			if ref.Inline == inline {
+				text, err := read(ref.File)
+				return ref.File, text, 0, err
+			}
+		}
+	}
+
+	text, err := read(file)
+	if err != nil {
+		return "", "", 0, err
+	}
+	start := 0
+	if inline != "" {
+		if start = findFrom(text, 0, keyPattern("Name")+`\s*["']?`+regexp.QuoteMeta(inline)+`["']?\s*(?:$|[,}\n])`); start < 0 {
+			return file, text, 0, nil
+		}
+	}
+	if at := findFrom(text, start, keyPattern(key)); at >= 0 {
+		start = at
+	}
+
+	// a document that's an alias is written where its anchor is, in the file
+	// or in the anchors file
+	alias := yamlAlias.FindStringSubmatch(text[start:])
+	if alias == nil {
+		return file, text, start, nil
+	}
+	anchor := `&` + regexp.QuoteMeta(alias[1]) + `(?:$|[\s\[\]{},])`
+	if at := findFrom(text, 0, anchor); at >= 0 {
+		return file, text, at, nil
+	}
+	anchors, err := f.anchors()
+	if err != nil || anchors == nil {
+		return file, text, start, err
+	}
+	if at := findFrom(string(anchors), 0, anchor); at >= 0 {
+		return AnchorsFileName, string(anchors), at, nil
+	}
+	return file, text, start, nil
+}
+
+// recordSources records where the statements of the account's policy
+// documents were written, for findings to point to the file to change, which
+// is the file of a policy file, template or anchor the resource's file
+// shares with others
+func (f *YamlLoadDumper) recordSources(data *AccountData) error {
+	texts := map[string]string{}
+	read := func(file string) (string, error) {
+		if text, ok := texts[file]; ok {
+			return text, nil
+		}
+		b, err := ioutil.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(file)))
+		texts[file] = string(b)
+		return string(b), err
+	}
+
+	data.sources = map[*PolicyDocument]documentSource{}
+	for _, d := range data.policyDocuments() {
+		if d.doc == nil {
+			continue
+		}
+		file, ok := data.loadedFrom[d.resource]
+		if !ok {
+			continue
+		}
+		source, text, start, err := f.documentStart(file, d, read)
+		if err != nil {
+			return err
+		}
+		data.sources[d.doc] = documentSource{source, statementLines(text, start, d.doc)}
+	}
+	return nil
+}
+
+// statementSource returns where the statement of the document was written,
+// or its resource's file when the document wasn't loaded from the files
+func (a *AccountData) statementSource(d locatedPolicyDocument, s map[string]interface{}) Source {
+	source, ok := a.sources[d.doc]
+	if !ok {
+		return Source{File: d.file}
+	}
+	return Source{source.file, source.lines[statementKey(s)]}
+}
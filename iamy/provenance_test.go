@@ -0,0 +1,136 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatementSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iamy-sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(file, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(AnchorsFileName, `Ec2Trust: &ec2-trust
+  Version: "2012-10-17"
+  Statement:
+  - Effect: Allow
+    Principal:
+      Service: ec2.amazonaws.com
+    Action: sts:AssumeRole
+`)
+	write("policies/s3-read.json", `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Action": "s3:GetObject",
+      "Resource": "*"
+    }
+  ]
+}
+`)
+	write("myalias-123/iam/role/app.yaml", `AssumeRolePolicyDocument: *ec2-trust
+InlinePolicies:
+- Name: logs
+  Policy:
+    Version: "2012-10-17"
+    Statement:
+    - Sid: WriteLogs
+      Effect: Allow
+      Action: logs:PutLogEvents
+      Resource: "*"
+    - Effect: Allow
+      Action: logs:CreateLogStream
+      Resource: "*"
+- Name: s3-read
+  PolicyFile: ../../../policies/s3-read.json
+`)
+	write("templates/services.yaml.tmpl", `Account: myalias-123
+Resources:
+{{- range list "api" "worker" }}
+  iam/role/services/{{ . }}:
+    AssumeRolePolicyDocument:
+      Version: "2012-10-17"
+      Statement:
+      - Effect: Allow
+        Principal:
+          Service: ecs-tasks.amazonaws.com
+        Action: sts:AssumeRole
+{{- end }}
+`)
+
+	files := YamlLoadDumper{Dir: dir}
+	accounts, err := files.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 {
+		t.Fatalf("Expected one account, got %d", len(accounts))
+	}
+
+	expected := map[string]string{
+		"myalias-123/iam/role/app.yaml AssumeRolePolicyDocument":       ".iamy-anchors.yaml:4",
+		"myalias-123/iam/role/app.yaml InlinePolicies[logs] WriteLogs": "myalias-123/iam/role/app.yaml:7",
+		"myalias-123/iam/role/app.yaml InlinePolicies[logs] #2":        "myalias-123/iam/role/app.yaml:11",
+		"myalias-123/iam/role/app.yaml InlinePolicies[s3-read]":        "policies/s3-read.json:5",
+		"templates/services.yaml.tmpl AssumeRolePolicyDocument":        "templates/services.yaml.tmpl:8",
+	}
+	statements := accounts[0].PolicyStatements()
+	if len(statements) != 6 {
+		t.Errorf("Expected 6 statements, got %v", statements)
+	}
+	found := map[string]string{}
+	for _, s := range statements {
+		key := s.File + " " + s.Policy
+		if s.Sid != "" {
+			key += " " + s.Sid
+		} else if s.Policy == "InlinePolicies[logs]" {
+			key += " #2"
+		}
+		found[key] = s.Location()
+	}
+	for key, location := range expected {
+		if found[key] != location {
+			t.Errorf("Expected %s to be written at %s, got %q", key, location, found[key])
+		}
+	}
+	for _, s := range statements {
+		if s.Policy == "InlinePolicies[s3-read]" && s.String() != "myalias-123/iam/role/app.yaml InlinePolicies[s3-read] statement #1, from policies/s3-read.json:5" {
+			t.Errorf("Expected the statement to name the file it's from, got %s", s)
+		}
+	}
+}
+
+func TestFileCasesLocateProblemsAtTheirLines(t *testing.T) {
+	data := NewAccountData("myalias-123")
+	cases := FileCases("analyze mfa", data, map[string][]string{
+		"templates/services.yaml.tmpl:8": {"first", "second"},
+		"myalias-123":                    {"account"},
+	})
+	if len(cases) != 2 {
+		t.Fatalf("Expected a case for the template and the account, got %+v", cases)
+	}
+	template := cases[1]
+	if template.Name != "templates/services.yaml.tmpl" || template.Failure != "first\nsecond" || len(template.Lines) != 2 || template.Lines[1] != 8 {
+		t.Errorf("Expected the problems in the template at line 8, got %+v", template)
+	}
+	if locations := sarifLocations("accounts", template.Name, template.Lines[0]); len(locations) != 1 || locations[0].PhysicalLocation.Region.StartLine != 8 {
+		t.Errorf("Expected a SARIF location at line 8, got %+v", locations)
+	}
+	if cases[0].Name != "myalias-123" || cases[0].Lines[0] != 0 {
+		t.Errorf("Expected the account's problem to be of no line, got %+v", cases[0])
+	}
+}
@@ -0,0 +1,307 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// pulumiType is a Terraform resource type as a Pulumi module and type, eg.
+// iam and RolePolicyAttachment for aws_iam_role_policy_attachment
+func pulumiType(resourceType string) (module, name string) {
+	parts := strings.Split(strings.TrimPrefix(resourceType, "aws_"), "_")
+	return parts[0], pascalCase(parts[1:])
+}
+
+func pascalCase(words []string) string {
+	result := ""
+	for _, w := range words {
+		if w != "" {
+			result += strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return result
+}
+
+// pulumiEscape escapes the ${ interpolation sequences in Pulumi YAML
+// strings, which are common in policies as IAM policy variables
+func pulumiEscape(s string) string {
+	return strings.ReplaceAll(s, "${", "$${")
+}
+
+// A PulumiExport is the account's users, groups, roles, managed policies,
+// instance profiles and bucket policies as a Pulumi program. Pulumi's AWS
+// provider is bridged from Terraform's, so the resources and their import
+// ids are those of the Terraform export. Warnings are the resources Pulumi
+// can't represent
+type PulumiExport struct {
+	Account  *Account
+	Warnings Warnings
+
+	blocks []tfBlock
+	// names are the Pulumi resource names of the blocks, which are unique
+	// across resource types
+	names map[string]string
+}
+
+// ExportPulumi converts the account data to Pulumi resources
+func ExportPulumi(data *AccountData) (*PulumiExport, error) {
+	x, err := ExportTerraform(data)
+	if err != nil {
+		return nil, err
+	}
+	p := PulumiExport{Account: x.Account, Warnings: x.Warnings, blocks: x.blocks, names: map[string]string{}}
+	taken := map[string]bool{}
+	for _, block := range x.blocks {
+		name := block.label
+		if taken[name] {
+			_, typeName := pulumiType(block.resourceType)
+			name += "-" + strings.ToLower(strings.Join(pascalWords(typeName), "-"))
+		}
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s-%d", name, i)
+		}
+		taken[name] = true
+		p.names[block.resourceType+"."+block.label] = name
+	}
+	return &p, nil
+}
+
+// pascalWords splits a PascalCase name into its words
+func pascalWords(s string) []string {
+	words := []string{}
+	start := 0
+	for i := 1; i < len(s); i++ {
+		if s[i] >= 'A' && s[i] <= 'Z' {
+			words = append(words, s[start:i])
+			start = i
+		}
+	}
+	return append(words, s[start:])
+}
+
+func (x *PulumiExport) name(resourceType, label string) string {
+	return x.names[resourceType+"."+label]
+}
+
+// yamlValue renders an attribute value as Pulumi YAML, indented for the
+// properties of a resource
+func (x *PulumiExport) yamlValue(v interface{}, indent string) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(pulumiEscape(v)), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case map[string]string:
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		lines := []string{}
+		for _, k := range keys {
+			lines = append(lines, fmt.Sprintf("\n%s  %s: %s", indent, strconv.Quote(k), strconv.Quote(pulumiEscape(v[k]))))
+		}
+		return strings.Join(lines, ""), nil
+	case *PolicyDocument:
+		j, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		y, err := yaml.JSONToYAML([]byte(pulumiEscape(string(j))))
+		if err != nil {
+			return "", err
+		}
+		doc := strings.ReplaceAll(strings.TrimSuffix(string(y), "\n"), "\n", "\n"+indent+"    ")
+		return fmt.Sprintf("\n%s  fn::toJSON:\n%s    %s", indent, indent, doc), nil
+	case tfRef:
+		return strconv.Quote(fmt.Sprintf("${%s.%s}", x.name(v.resourceType, v.label), v.attr)), nil
+	case []interface{}:
+		lines := []string{}
+		for _, item := range v {
+			s, err := x.yamlValue(item, indent+"  ")
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines, fmt.Sprintf("\n%s  - %s", indent, s))
+		}
+		return strings.Join(lines, ""), nil
+	}
+	return "", fmt.Errorf("Can't export %v to Pulumi", v)
+}
+
+// WriteYaml writes the resources as a Pulumi YAML program, a Pulumi.yaml of
+// the project. With imports, each resource has the import option, for the
+// next pulumi up to adopt the existing resources
+func (x *PulumiExport) WriteYaml(w io.Writer, project string, imports bool) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "name: %s\nruntime: yaml\ndescription: %s\nresources:\n", project, strconv.Quote("Exported by iamy from account "+x.Account.String()))
+	for _, block := range x.blocks {
+		module, typeName := pulumiType(block.resourceType)
+		fmt.Fprintf(&b, "  %s:\n    type: aws:%s:%s\n    properties:\n", x.name(block.resourceType, block.label), module, typeName)
+		for _, attr := range block.attrs {
+			value, err := x.yamlValue(attr.value, "      ")
+			if err != nil {
+				return err
+			}
+			separator := " "
+			if strings.HasPrefix(value, "\n") {
+				separator = ""
+			}
+			fmt.Fprintf(&b, "      %s:%s%s\n", camelCase(attr.name), separator, value)
+		}
+		if imports {
+			fmt.Fprintf(&b, "    options:\n      import: %s\n", strconv.Quote(block.importId))
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func camelCase(snake string) string {
+	p := pascalCase(strings.Split(snake, "_"))
+	return strings.ToLower(p[:1]) + p[1:]
+}
+
+// goIdent returns the Go variable of a block, its label in camel case with
+// its type, so it can't be a keyword or an imported package
+func goIdent(block tfBlock) string {
+	_, typeName := pulumiType(block.resourceType)
+	words := strings.FieldsFunc(block.label, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	ident := pascalCase(words)
+	if ident == "" || ident[0] >= '0' && ident[0] <= '9' {
+		return "r" + ident + typeName
+	}
+	return strings.ToLower(ident[:1]) + ident[1:] + typeName
+}
+
+// goValue renders an attribute value as a Pulumi Go SDK input
+func (x *PulumiExport) goValue(v interface{}, idents map[string]string) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return "pulumi.String(" + strconv.Quote(v) + ")", nil
+	case int:
+		return "pulumi.Int(" + strconv.Itoa(v) + ")", nil
+	case map[string]string:
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		s := "pulumi.StringMap{\n"
+		for _, k := range keys {
+			s += strconv.Quote(k) + ": pulumi.String(" + strconv.Quote(v[k]) + "),\n"
+		}
+		return s + "}", nil
+	case *PolicyDocument:
+		j, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(string(j), "`") {
+			return "pulumi.String(" + strconv.Quote(string(j)) + ")", nil
+		}
+		return "pulumi.String(`" + string(j) + "`)", nil
+	case tfRef:
+		return idents[v.resourceType+"."+v.label] + "." + pascalCase([]string{v.attr}), nil
+	case []interface{}:
+		s := "pulumi.StringArray{\n"
+		for _, item := range v {
+			value, err := x.goValue(item, idents)
+			if err != nil {
+				return "", err
+			}
+			s += value + ",\n"
+		}
+		return s + "}", nil
+	}
+	return "", fmt.Errorf("Can't export %v to Pulumi", v)
+}
+
+// WriteGo writes the resources as a Pulumi Go program, a main.go. With
+// imports, each resource has the Import option, for the next pulumi up to
+// adopt the existing resources
+func (x *PulumiExport) WriteGo(w io.Writer, imports bool) error {
+	referenced := map[string]bool{}
+	var findRefs func(v interface{})
+	findRefs = func(v interface{}) {
+		switch v := v.(type) {
+		case tfRef:
+			referenced[v.resourceType+"."+v.label] = true
+		case []interface{}:
+			for _, item := range v {
+				findRefs(item)
+			}
+		}
+	}
+	modules := map[string]bool{}
+	idents := map[string]string{}
+	identTaken := map[string]bool{}
+	for _, block := range x.blocks {
+		for _, attr := range block.attrs {
+			findRefs(attr.value)
+		}
+		module, _ := pulumiType(block.resourceType)
+		modules[module] = true
+		ident := goIdent(block)
+		for i := 2; identTaken[ident]; i++ {
+			ident = fmt.Sprintf("%s%d", goIdent(block), i)
+		}
+		identTaken[ident] = true
+		idents[block.resourceType+"."+block.label] = ident
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Exported by iamy from account %s\npackage main\n\nimport (\n", x.Account)
+	for _, module := range []string{"iam", "s3"} {
+		if modules[module] {
+			fmt.Fprintf(&b, "%q\n", "github.com/pulumi/pulumi-aws/sdk/v6/go/aws/"+module)
+		}
+	}
+	b.WriteString("\"github.com/pulumi/pulumi/sdk/v3/go/pulumi\"\n)\n\nfunc main() {\npulumi.Run(func(ctx *pulumi.Context) error {\n")
+
+	errDeclared := false
+	for _, block := range x.blocks {
+		module, typeName := pulumiType(block.resourceType)
+		key := block.resourceType + "." + block.label
+		assign := "_, err ="
+		switch {
+		case referenced[key]:
+			assign = idents[key] + ", err :="
+		case !errDeclared:
+			assign = "_, err :="
+		}
+		errDeclared = true
+
+		fmt.Fprintf(&b, "%s %s.New%s(ctx, %q, &%s.%sArgs{\n", assign, module, typeName, x.name(block.resourceType, block.label), module, typeName)
+		for _, attr := range block.attrs {
+			value, err := x.goValue(attr.value, idents)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&b, "%s: %s,\n", pascalCase(strings.Split(attr.name, "_")), value)
+		}
+		b.WriteString("}")
+		if imports {
+			fmt.Fprintf(&b, ", pulumi.Import(pulumi.ID(%q))", block.importId)
+		}
+		b.WriteString(")\nif err != nil {\nreturn err\n}\n")
+	}
+	b.WriteString("return nil\n})\n}\n")
+
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(source)
+	return err
+}
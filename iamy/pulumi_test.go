@@ -0,0 +1,69 @@
+package iamy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestExportPulumi(t *testing.T) {
+	selfService := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"iam:ChangePassword","Resource":"arn:aws:iam::*:user/${aws:username}"}]}`
+	trust := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":{"Service":"ec2.amazonaws.com"}}]}`
+
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{iamService: iamService{Name: "self-service", Path: "/people/"}, Policy: mustPolicyDocument(t, selfService)})
+	data.addGroup(&Group{iamService: iamService{Name: "developers", Path: "/"}, Policies: []string{"people/self-service"}})
+	data.addUser(&User{iamService: iamService{Name: "alice.smith", Path: "/"}, Groups: []string{"developers", "elsewhere"}, Tags: map[string]string{"team": "payments"}})
+	data.addRole(&Role{iamService: iamService{Name: "app-server", Path: "/"}, AssumeRolePolicyDocument: mustPolicyDocument(t, trust), MaxSessionDuration: 7200})
+	data.addInstanceProfile(&InstanceProfile{iamService: iamService{Name: "app-server", Path: "/"}, Roles: []string{"app-server"}})
+
+	x, err := ExportPulumi(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := x.WriteYaml(&b, "iamy-myalias-123", true); err != nil {
+		t.Fatal(err)
+	}
+	var program map[string]interface{}
+	if err := yaml.Unmarshal(b.Bytes(), &program); err != nil {
+		t.Fatalf("Expected valid YAML, got %s\n%s", err, b.String())
+	}
+	for _, s := range []string{
+		"  self-service:\n    type: aws:iam:Policy\n    properties:\n      name: \"self-service\"\n      path: \"/people/\"\n      policy:\n        fn::toJSON:\n",
+		`Resource: arn:aws:iam::*:user/$${aws:username}`,
+		`      policyArn: "${self-service.arn}"`,
+		"      groups:\n        - \"${developers.name}\"\n        - \"elsewhere\"",
+		"      tags:\n        \"team\": \"payments\"",
+		"      maxSessionDuration: 7200",
+		"  app-server-instance-profile:\n    type: aws:iam:InstanceProfile",
+		"    options:\n      import: \"arn:aws:iam::123:policy/people/self-service\"",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Expected the YAML program to contain\n%s\ngot\n%s", s, b.String())
+		}
+	}
+
+	b.Reset()
+	if err := x.WriteGo(&b, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"\"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam\"",
+		"selfServicePolicy, err := iam.NewPolicy(ctx, \"self-service\", &iam.PolicyArgs{",
+		"_, err = iam.NewGroupPolicyAttachment(ctx, \"developers_self-service\", &iam.GroupPolicyAttachmentArgs{\n\t\t\tGroup:     developersGroup.Name,\n\t\t\tPolicyArn: selfServicePolicy.Arn,\n\t\t}, pulumi.Import(pulumi.ID(\"developers/arn:aws:iam::123:policy/people/self-service\")))",
+		"Groups: pulumi.StringArray{\n\t\t\t\tdevelopersGroup.Name,\n\t\t\t\tpulumi.String(\"elsewhere\"),",
+		"MaxSessionDuration: pulumi.Int(7200),",
+		"Role: appServerRole.Name,",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Expected the Go program to contain\n%s\ngot\n%s", s, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "aws/s3") {
+		t.Error("Expected the s3 package not to be imported without bucket policies")
+	}
+}
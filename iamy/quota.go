@@ -0,0 +1,140 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultIamQuotas are the default IAM quotas the quota report checks, by
+// name. Roles and policies per account can be raised, so their limits can be
+// overridden
+var DefaultIamQuotas = map[string]int{
+	// roles per account
+	"roles": 1000,
+	// customer managed policies per account
+	"policies": 1500,
+	// versions stored per managed policy
+	"policy-versions": MaxAllowedPolicyVersions,
+	// characters in all of an entity's inline policies, without whitespace
+	"user-inline-policy-size":  2048,
+	"group-inline-policy-size": 5120,
+	"role-inline-policy-size":  10240,
+}
+
+// QuotaNames returns the names of the quotas the quota report checks, sorted
+func QuotaNames() []string {
+	names := []string{}
+	for name := range DefaultIamQuotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseQuotaLimits parses overridden quota limits, as limits by quota name,
+// into the limits to check against
+func ParseQuotaLimits(overrides map[string]string) (map[string]int, error) {
+	limits := map[string]int{}
+	for name, limit := range DefaultIamQuotas {
+		limits[name] = limit
+	}
+	for name, s := range overrides {
+		if _, ok := DefaultIamQuotas[name]; !ok {
+			return nil, errors.Errorf("Unknown quota %s, expected one of %s", name, strings.Join(QuotaNames(), ", "))
+		}
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			return nil, errors.Errorf("Invalid limit %s for quota %s", s, name)
+		}
+		limits[name] = limit
+	}
+	return limits, nil
+}
+
+// A QuotaUsage is how much of a quota an account, or a resource in it, uses
+type QuotaUsage struct {
+	Quota    string
+	Resource string
+	Used     int
+	Limit    int
+}
+
+// Percent returns how much of the quota is used, as a percentage
+func (u QuotaUsage) Percent() float64 {
+	return float64(u.Used) * 100 / float64(u.Limit)
+}
+
+func (u QuotaUsage) String() string {
+	return fmt.Sprintf("%s %s: %d of %d (%.0f%%)", u.Resource, u.Quota, u.Used, u.Limit, u.Percent())
+}
+
+func inlinePolicySize(policies []InlinePolicy) int {
+	size := 0
+	for _, p := range policies {
+		if data, err := json.Marshal(p.Policy); err == nil {
+			size += len(data)
+		}
+	}
+	return size
+}
+
+// QuotaReport returns the usage of each quota by the planned account data,
+// once it's pushed, against the limits by quota name. current is the account
+// data in AWS, and gives the versions already stored for each policy. It can
+// be nil, when each policy is counted as having a single version
+func QuotaReport(planned, current *AccountData, limits map[string]int) []QuotaUsage {
+	account := planned.Account.String()
+	usages := []QuotaUsage{
+		{"roles", account, len(planned.Roles), limits["roles"]},
+		{"policies", account, len(planned.Policies), limits["policies"]},
+	}
+
+	for _, p := range planned.Policies {
+		versions := 1
+		if current != nil {
+			if found, c := current.FindPolicyByName(p.Name, p.Path); found {
+				versions = c.numberOfVersions
+				if c.Policy.JsonString() != p.Policy.JsonString() {
+					versions++
+				}
+				if versions > MaxAllowedPolicyVersions {
+					// push deletes the oldest version rather than exceed the quota
+					versions = MaxAllowedPolicyVersions
+				}
+			}
+		}
+		usages = append(usages, QuotaUsage{"policy-versions", Arn(p, planned.Account), versions, limits["policy-versions"]})
+	}
+
+	for _, u := range planned.Users {
+		usages = append(usages, QuotaUsage{"user-inline-policy-size", Arn(u, planned.Account), inlinePolicySize(u.InlinePolicies), limits["user-inline-policy-size"]})
+	}
+	for _, g := range planned.Groups {
+		usages = append(usages, QuotaUsage{"group-inline-policy-size", Arn(g, planned.Account), inlinePolicySize(g.InlinePolicies), limits["group-inline-policy-size"]})
+	}
+	for _, r := range planned.Roles {
+		usages = append(usages, QuotaUsage{"role-inline-policy-size", Arn(r, planned.Account), inlinePolicySize(r.InlinePolicies), limits["role-inline-policy-size"]})
+	}
+
+	return usages
+}
+
+// QuotaWarnings warns about each quota used to at least warnAt percent of its
+// limit, and about each quota that is exceeded
+func QuotaWarnings(usages []QuotaUsage, warnAt float64) Warnings {
+	warnings := Warnings{}
+	for _, u := range usages {
+		switch {
+		case u.Used > u.Limit:
+			warnings.Add(WarningQuota, u.Resource, fmt.Sprintf("Exceeds the %s quota, using %d of %d", u.Quota, u.Used, u.Limit))
+		case u.Percent() >= warnAt:
+			warnings.Add(WarningQuota, u.Resource, fmt.Sprintf("Uses %.0f%% of the %s quota, %d of %d", u.Percent(), u.Quota, u.Used, u.Limit))
+		}
+	}
+	return warnings
+}
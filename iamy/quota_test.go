@@ -0,0 +1,73 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQuotaLimits(t *testing.T) {
+	limits, err := ParseQuotaLimits(map[string]string{"roles": "5000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits["roles"] != 5000 || limits["policies"] != 1500 {
+		t.Errorf("Unexpected limits: %v", limits)
+	}
+
+	if _, err := ParseQuotaLimits(map[string]string{"lambdas": "10"}); err == nil || !strings.Contains(err.Error(), "Unknown quota lambdas") {
+		t.Errorf("Expected an unknown quota error, got %v", err)
+	}
+	if _, err := ParseQuotaLimits(map[string]string{"roles": "lots"}); err == nil {
+		t.Error("Expected an invalid limit error")
+	}
+}
+
+func TestQuotaReport(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+	updated := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]}`)
+
+	current := NewAccountData("123")
+	current.addPolicy(&Policy{iamService: iamService{Name: "full", Path: "/"}, numberOfVersions: 5, Policy: doc})
+	current.addPolicy(&Policy{iamService: iamService{Name: "changed", Path: "/"}, numberOfVersions: 3, Policy: doc})
+
+	planned := NewAccountData("123")
+	planned.addPolicy(&Policy{iamService: iamService{Name: "full", Path: "/"}, Policy: updated})
+	planned.addPolicy(&Policy{iamService: iamService{Name: "changed", Path: "/"}, Policy: updated})
+	planned.addPolicy(&Policy{iamService: iamService{Name: "new", Path: "/"}, Policy: doc})
+	planned.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, InlinePolicies: []InlinePolicy{{"a", doc}, {"b", updated}}})
+
+	limits, _ := ParseQuotaLimits(map[string]string{"user-inline-policy-size": "150", "policies": "4"})
+	usages := map[string]QuotaUsage{}
+	for _, u := range QuotaReport(planned, current, limits) {
+		usages[u.Quota+" "+u.Resource] = u
+	}
+
+	for key, expected := range map[string]int{
+		"policies 123": 3,
+		"roles 123":    0,
+		"policy-versions arn:aws:iam::123:policy/full":      5,
+		"policy-versions arn:aws:iam::123:policy/changed":   4,
+		"policy-versions arn:aws:iam::123:policy/new":       1,
+		"user-inline-policy-size arn:aws:iam::123:user/bob": 192,
+	} {
+		if u, ok := usages[key]; !ok || u.Used != expected {
+			t.Errorf("Expected %s to be %d, got %+v", key, expected, u)
+		}
+	}
+
+	warnings := QuotaWarnings(QuotaReport(planned, current, limits), 75)
+	expected := []string{
+		"[quota] 123: Uses 75% of the policies quota, 3 of 4",
+		"[quota] arn:aws:iam::123:policy/full: Uses 100% of the policy-versions quota, 5 of 5",
+		"[quota] arn:aws:iam::123:policy/changed: Uses 80% of the policy-versions quota, 4 of 5",
+		"[quota] arn:aws:iam::123:user/bob: Exceeds the user-inline-policy-size quota, using 192 of 150",
+	}
+	if len(warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, got %v", len(expected), warnings)
+	}
+	for i, w := range warnings {
+		if w.String() != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], w)
+		}
+	}
+}
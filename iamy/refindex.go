@@ -0,0 +1,207 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReferenceIndexFileName is the file in the directory the reference index is
+// written to, and that pull refreshes when it's there
+const ReferenceIndexFileName = ".iamy-index.json"
+
+// An IndexedStatement is a statement of a policy document in the files
+type IndexedStatement struct {
+	Account   string   `json:"Account"`
+	File      string   `json:"File"`
+	Resource  string   `json:"Resource"`
+	Policy    string   `json:"Policy"`
+	Index     int      `json:"Index"`
+	Sid       string   `json:"Sid,omitempty"`
+	Effect    string   `json:"Effect"`
+	Actions   []string `json:"Actions,omitempty"`
+	Resources []string `json:"Resources,omitempty"`
+}
+
+// A ReferenceIndex is a reverse index of the policy documents in the files,
+// for other tools to look up without parsing them:
+//
+//	Actions     the statements with each action, lowercased as actions are
+//	            case insensitive, and the resources they grant or deny it on
+//	TrustedBy   the statements with each principal, eg. the trust policies
+//	            of the roles it can assume
+//
+// Statements with NotAction or NotPrincipal aren't indexed by them, as they
+// refer to everything but their values
+type ReferenceIndex struct {
+	// Accounts are when each account was last indexed
+	Accounts  map[string]time.Time          `json:"Accounts"`
+	Actions   map[string][]IndexedStatement `json:"Actions"`
+	TrustedBy map[string][]IndexedStatement `json:"TrustedBy"`
+}
+
+// NewReferenceIndex indexes the accounts
+func NewReferenceIndex(now time.Time, accounts ...*AccountData) *ReferenceIndex {
+	idx := &ReferenceIndex{
+		Accounts:  map[string]time.Time{},
+		Actions:   map[string][]IndexedStatement{},
+		TrustedBy: map[string][]IndexedStatement{},
+	}
+	for _, data := range accounts {
+		idx.Update(now, data)
+	}
+	return idx
+}
+
+// LoadReferenceIndex reads an index file
+func LoadReferenceIndex(file string) (*ReferenceIndex, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	idx := NewReferenceIndex(time.Time{})
+	if err = json.Unmarshal(b, idx); err != nil {
+		return nil, validationError(file, err)
+	}
+	return idx, nil
+}
+
+// statements are the index's statements, without when the accounts were
+// indexed
+func (idx *ReferenceIndex) statements() interface{} {
+	return []map[string][]IndexedStatement{idx.Actions, idx.TrustedBy}
+}
+
+// Write writes the index file
+func (idx *ReferenceIndex) Write(file string) error {
+	return writeJsonFile(file, idx)
+}
+
+// RefreshReferenceIndex updates the account in the directory's index file,
+// when it has one and the account's statements changed, returning whether it
+// did
+func (f *YamlLoadDumper) RefreshReferenceIndex(now time.Time, data *AccountData) (bool, error) {
+	file := filepath.Join(f.Dir, ReferenceIndexFileName)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return false, nil
+	}
+	idx, err := LoadReferenceIndex(file)
+	if err != nil {
+		return false, err
+	}
+	layout, err := f.layout()
+	if err != nil {
+		return false, err
+	}
+	// the files are indexed in the layout of the directory, which data
+	// fetched from AWS doesn't have
+	indexed := *data
+	indexed.layout = layout
+	before, err := json.Marshal(idx.statements())
+	if err != nil {
+		return false, err
+	}
+	_, indexedBefore := idx.Accounts[data.Account.String()]
+	idx.Update(now, &indexed)
+	after, err := json.Marshal(idx.statements())
+	if err != nil {
+		return false, err
+	}
+	if indexedBefore && bytes.Equal(before, after) {
+		return false, nil
+	}
+	return true, idx.Write(file)
+}
+
+// principalValues returns the principals of a statement, eg. an account's
+// root ARN or a service, or * for everyone
+func principalValues(principal interface{}) []string {
+	m, ok := principal.(map[string]interface{})
+	if !ok {
+		return conditionValues(principal)
+	}
+	values := []string{}
+	for _, v := range m {
+		values = append(values, conditionValues(v)...)
+	}
+	return values
+}
+
+// Update replaces the account's entries with its current resources, so an
+// index of many accounts is refreshed one account at a time
+func (idx *ReferenceIndex) Update(now time.Time, data *AccountData) {
+	account := data.Account.String()
+	remove := func(byKey map[string][]IndexedStatement) {
+		for key, statements := range byKey {
+			kept := []IndexedStatement{}
+			for _, s := range statements {
+				if s.Account != account {
+					kept = append(kept, s)
+				}
+			}
+			if len(kept) == 0 {
+				delete(byKey, key)
+			} else {
+				byKey[key] = kept
+			}
+		}
+	}
+	remove(idx.Actions)
+	remove(idx.TrustedBy)
+
+	for _, d := range data.policyDocuments() {
+		for i, s := range d.doc.statements() {
+			sid, _ := s["Sid"].(string)
+			effect, _ := s["Effect"].(string)
+			statement := IndexedStatement{
+				Account:   account,
+				File:      d.file,
+				Resource:  resourceKind(d.resource) + d.resource.ResourcePath() + d.resource.ResourceName(),
+				Policy:    d.policy,
+				Index:     i,
+				Sid:       sid,
+				Effect:    effect,
+				Actions:   conditionValues(s["Action"]),
+				Resources: conditionValues(s["Resource"]),
+			}
+			seen := map[string]bool{}
+			for _, action := range statement.Actions {
+				action = strings.ToLower(action)
+				if !seen[action] {
+					seen[action] = true
+					idx.Actions[action] = append(idx.Actions[action], statement)
+				}
+			}
+			seenPrincipals := map[string]bool{}
+			for _, principal := range principalValues(s["Principal"]) {
+				if !seenPrincipals[principal] {
+					seenPrincipals[principal] = true
+					idx.TrustedBy[principal] = append(idx.TrustedBy[principal], statement)
+				}
+			}
+		}
+	}
+
+	for _, byKey := range []map[string][]IndexedStatement{idx.Actions, idx.TrustedBy} {
+		for _, statements := range byKey {
+			sort.SliceStable(statements, func(i, j int) bool {
+				if statements[i].Account != statements[j].Account {
+					return statements[i].Account < statements[j].Account
+				}
+				if statements[i].File != statements[j].File {
+					return statements[i].File < statements[j].File
+				}
+				if statements[i].Policy != statements[j].Policy {
+					return statements[i].Policy < statements[j].Policy
+				}
+				return statements[i].Index < statements[j].Index
+			})
+		}
+	}
+	idx.Accounts[account] = now.UTC().Truncate(time.Second)
+}
@@ -0,0 +1,74 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReferenceIndex(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	app := NewAccountData("app-111111111111")
+	app.addRole(&Role{
+		iamService:               iamService{Name: "deployer", Path: "/"},
+		AssumeRolePolicyDocument: mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::222222222222:root"},"Action":"sts:AssumeRole"}]}`),
+		InlinePolicies: []InlinePolicy{{Name: "deploy", Policy: mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[
+			{"Sid":"Read","Effect":"Allow","Action":["s3:GetObject","S3:GetObject"],"Resource":"arn:aws:s3:::artifacts/*"}
+		]}`)}},
+	})
+	tools := NewAccountData("tools-222222222222")
+	tools.addPolicy(&Policy{
+		iamService: iamService{Name: "readers", Path: "/"},
+		Policy:     mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}}`),
+	})
+
+	idx := NewReferenceIndex(now, app, tools)
+	if get := idx.Actions["s3:getobject"]; len(get) != 2 || get[0].Account != "app-111111111111" || get[0].Sid != "Read" || get[0].Resource != "iam/role/deployer" || get[1].Resources[0] != "*" {
+		t.Errorf("Expected s3:GetObject once in each account, got %+v", get)
+	}
+	if trusted := idx.TrustedBy["arn:aws:iam::222222222222:root"]; len(trusted) != 1 || trusted[0].Policy != "AssumeRolePolicyDocument" {
+		t.Errorf("Expected the deployer's trust policy, got %+v", trusted)
+	}
+
+	// updating an account replaces only its statements
+	app.Roles = nil
+	idx.Update(now.Add(time.Hour), app)
+	if get := idx.Actions["s3:getobject"]; len(get) != 1 || get[0].Account != "tools-222222222222" {
+		t.Errorf("Expected only the tools account's statement, got %+v", get)
+	}
+	if _, ok := idx.TrustedBy["arn:aws:iam::222222222222:root"]; ok || !idx.Accounts["app-111111111111"].Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected the app account reindexed, got %+v", idx)
+	}
+
+	dir, err := ioutil.TempDir("", "iamy-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ReferenceIndexFileName)
+	if err = idx.Write(file); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadReferenceIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Actions) != len(idx.Actions) || len(loaded.Accounts) != 2 {
+		t.Errorf("Expected the index to round trip, got %+v", loaded)
+	}
+
+	// a pull that changes none of the account's statements leaves the file
+	files := YamlLoadDumper{Dir: dir}
+	if refreshed, err := files.RefreshReferenceIndex(now.Add(2*time.Hour), tools); err != nil || refreshed {
+		t.Errorf("Expected the index not to be rewritten, got %v %v", refreshed, err)
+	}
+	tools.Policies = nil
+	if refreshed, err := files.RefreshReferenceIndex(now.Add(2*time.Hour), tools); err != nil || !refreshed {
+		t.Errorf("Expected the index to be rewritten, got %v %v", refreshed, err)
+	}
+	if loaded, err = LoadReferenceIndex(file); err != nil || len(loaded.Actions) != 0 || !loaded.Accounts["tools-222222222222"].Equal(now.Add(2*time.Hour)) {
+		t.Errorf("Expected the tools account reindexed, got %+v %v", loaded, err)
+	}
+}
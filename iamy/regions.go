@@ -0,0 +1,156 @@
+package iamy
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+const requestedRegionConditionKey = "aws:requestedregion"
+
+// A RegionFinding is a statement, or an account missing a statement, that
+// would permit activity outside the approved regions
+type RegionFinding struct {
+	Account   string
+	Statement *PolicyStatement
+	Problem   string
+}
+
+func (f RegionFinding) String() string {
+	if f.Statement == nil {
+		return fmt.Sprintf("%s: %s", f.Account, f.Problem)
+	}
+	return fmt.Sprintf("%s: %s", f.Statement, f.Problem)
+}
+
+// knownRegions returns the regions of every partition the AWS SDK knows of,
+// which region wildcards are expanded against
+func knownRegions() []string {
+	regions := []string{}
+	for _, p := range endpoints.DefaultPartitions() {
+		for id := range p.Regions() {
+			regions = append(regions, id)
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// regionsMatching expands condition values, which may use the StringLike
+// wildcards * and ?, to the known regions they match
+func regionsMatching(values []string, like bool) []string {
+	result := []string{}
+	for _, v := range values {
+		if !like || !strings.ContainsAny(v, "*?") {
+			result = append(result, v)
+			continue
+		}
+		for _, r := range knownRegions() {
+			if ok, _ := filepath.Match(v, r); ok {
+				result = append(result, r)
+			}
+		}
+	}
+	return result
+}
+
+// requestedRegionCondition returns the regions a statement's
+// aws:RequestedRegion condition matches, and whether the condition is
+// negated, eg. StringNotEquals
+func requestedRegionCondition(s PolicyStatement) (regions []string, negated bool, ok bool) {
+	for _, c := range s.Conditions() {
+		if strings.ToLower(c.Key) != requestedRegionConditionKey {
+			continue
+		}
+		switch baseConditionOperator(c.Operator) {
+		case "StringEquals", "StringEqualsIgnoreCase":
+			return regionsMatching(c.Values, false), false, true
+		case "StringLike":
+			return regionsMatching(c.Values, true), false, true
+		case "StringNotEquals", "StringNotEqualsIgnoreCase":
+			return regionsMatching(c.Values, false), true, true
+		case "StringNotLike":
+			return regionsMatching(c.Values, true), true, true
+		}
+	}
+	return nil, false, false
+}
+
+// deniesAllActions is true for statements with Action "*" or with NotAction,
+// which baseline region denies use to exempt global services
+func deniesAllActions(s PolicyStatement) bool {
+	if _, ok := s.data["NotAction"]; ok {
+		return true
+	}
+	for _, a := range conditionValues(s.data["Action"]) {
+		if a == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// RegionReport checks the account's aws:RequestedRegion conditions against
+// the approved regions. The account must have a baseline statement denying
+// requests outside the approved regions, in baselinePolicy if it's set, and no
+// statement may allow, or exempt from a deny, a region that isn't approved
+func RegionReport(data *AccountData, approved []string, baselinePolicy string) []RegionFinding {
+	findings := []RegionFinding{}
+	hasBaseline := false
+
+	baselineFile := ""
+	if baselinePolicy != "" {
+		for _, p := range data.Policies {
+			if strings.TrimPrefix(p.Path+p.Name, "/") == baselinePolicy {
+				baselineFile = data.ResourceFile(p)
+			}
+		}
+		if baselineFile == "" {
+			findings = append(findings, RegionFinding{Account: data.Account.String(), Problem: fmt.Sprintf("baseline policy %s doesn't exist", baselinePolicy)})
+		}
+	}
+
+	for _, s := range data.PolicyStatements() {
+		regions, negated, ok := requestedRegionCondition(s)
+		if !ok {
+			continue
+		}
+		s := s
+		effect, _ := s.data["Effect"].(string)
+
+		switch {
+		case effect == "Deny" && negated:
+			if disallowed := stringSetDifference(regions, approved); len(disallowed) > 0 {
+				findings = append(findings, RegionFinding{data.Account.String(), &s, "exempts regions that aren't approved: " + strings.Join(disallowed, ", ")})
+			}
+			if baselineFile == "" || s.File == baselineFile {
+				hasBaseline = true
+				if missing := stringSetDifference(approved, regions); len(missing) > 0 {
+					findings = append(findings, RegionFinding{data.Account.String(), &s, "denies approved regions: " + strings.Join(missing, ", ")})
+				}
+				if !deniesAllActions(s) {
+					findings = append(findings, RegionFinding{data.Account.String(), &s, "only denies some actions, use Action \"*\" or NotAction"})
+				}
+			}
+		case effect == "Allow" && !negated:
+			if disallowed := stringSetDifference(regions, approved); len(disallowed) > 0 {
+				findings = append(findings, RegionFinding{data.Account.String(), &s, "allows regions that aren't approved: " + strings.Join(disallowed, ", ")})
+			}
+		case effect == "Allow" && negated:
+			findings = append(findings, RegionFinding{data.Account.String(), &s, "allows every region except " + strings.Join(regions, ", ")})
+		}
+	}
+
+	if !hasBaseline && (baselinePolicy == "" || baselineFile != "") {
+		problem := "no statement denies requests outside the approved regions"
+		if baselinePolicy != "" {
+			problem = fmt.Sprintf("baseline policy %s doesn't deny requests outside the approved regions", baselinePolicy)
+		}
+		findings = append(findings, RegionFinding{Account: data.Account.String(), Problem: problem})
+	}
+
+	return findings
+}
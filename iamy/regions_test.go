@@ -0,0 +1,45 @@
+package iamy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegionReport(t *testing.T) {
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{
+		iamService: iamService{Name: "region-baseline", Path: "/"},
+		Policy:     mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Sid":"DenyOtherRegions","Effect":"Deny","NotAction":["iam:*","sts:*"],"Resource":"*","Condition":{"StringNotEquals":{"aws:RequestedRegion":["ap-southeast-2","us-west-2"]}}}]}`),
+	})
+	data.addPolicy(&Policy{
+		iamService: iamService{Name: "europe", Path: "/"},
+		Policy:     mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Sid":"AllowEurope","Effect":"Allow","Action":"ec2:*","Resource":"*","Condition":{"StringLike":{"aws:RequestedRegion":"eu-west-*"}}},{"Sid":"AllowSydney","Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"StringEquals":{"aws:RequestedRegion":"ap-southeast-2"}}}]}`),
+	})
+
+	actual := []string{}
+	for _, f := range RegionReport(data, []string{"ap-southeast-2", "us-east-1"}, "region-baseline") {
+		actual = append(actual, f.Statement.Sid+": "+f.Problem)
+	}
+
+	expected := []string{
+		"DenyOtherRegions: exempts regions that aren't approved: us-west-2",
+		"DenyOtherRegions: denies approved regions: us-east-1",
+		"AllowEurope: allows regions that aren't approved: eu-west-1, eu-west-2, eu-west-3",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestRegionReportRequiresBaseline(t *testing.T) {
+	data := NewAccountData("myalias-123")
+
+	findings := RegionReport(data, []string{"ap-southeast-2"}, "")
+	if len(findings) != 1 || findings[0].Statement != nil {
+		t.Fatalf("Expected a finding for the account, got %v", findings)
+	}
+	if findings[0].String() != "myalias-123: no statement denies requests outside the approved regions" {
+		t.Errorf("Unexpected finding %s", findings[0])
+	}
+}
@@ -0,0 +1,267 @@
+package iamy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A resourceRename is a resource in AWS that has been renamed or moved in
+// the files
+type resourceRename struct {
+	from, to AwsResource
+}
+
+// matchRenames pairs resources only in AWS with resources only in the files
+// that have the same content. Resources with the same content as more than
+// one other aren't paired, as which is the rename can't be told
+func matchRenames(fromOnly, toOnly []AwsResource) []resourceRename {
+	count := func(rr []AwsResource, content string) (int, AwsResource) {
+		n := 0
+		var match AwsResource
+		for _, r := range rr {
+			if comparableJson(r) == content {
+				n++
+				match = r
+			}
+		}
+		return n, match
+	}
+
+	result := []resourceRename{}
+	for _, t := range toOnly {
+		content := comparableJson(t)
+		if n, f := count(fromOnly, content); n == 1 {
+			if n, _ := count(toOnly, content); n == 1 {
+				result = append(result, resourceRename{f, t})
+			}
+		}
+	}
+	return result
+}
+
+func policyRef(p *Policy) string {
+	return strings.TrimPrefix(p.Path+p.Name, "/")
+}
+
+func replaceString(ss []string, old, new string) []string {
+	result := []string{}
+	for _, s := range ss {
+		if s == old {
+			s = new
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// detectRenames renames and moves users and groups in place, as IAM keeps
+// their credentials, memberships and attachments. Users are only renamed
+// when the files name the user they're renamed from, and moved when they
+// keep their name. Roles and policies can't
+// be renamed, so they're recreated, and the attachments of a renamed policy
+// are moved to the new policy before the old one is deleted. The planned
+// commands are generated against a copy of the AWS data with the renames
+// applied, so the renamed resources are updated rather than recreated
+func (a *awsSyncCmdGenerator) detectRenames() {
+	from := *a.from
+	from.Users = append([]*User{}, a.from.Users...)
+	from.Groups = append([]*Group{}, a.from.Groups...)
+	from.Roles = append([]*Role{}, a.from.Roles...)
+	a.from = &from
+
+	a.renameGroups()
+	a.renameUsers()
+
+	fromRoles, toRoles := []AwsResource{}, []AwsResource{}
+	for _, r := range a.from.Roles {
+		if found, _ := a.to.FindRoleByName(r.Name, r.Path); !found {
+			fromRoles = append(fromRoles, r)
+		}
+	}
+	for _, r := range a.to.Roles {
+		if found, _ := a.from.FindRoleByName(r.Name, r.Path); !found {
+			toRoles = append(toRoles, r)
+		}
+	}
+	for _, rename := range matchRenames(fromRoles, toRoles) {
+		a.renames = append(a.renames, rename)
+		a.warnings.Add(WarningPlan, Arn(rename.to, a.to.Account),
+			fmt.Sprintf("Role is a rename of %s, roles can't be renamed or moved so it will be recreated. Anything referring to the old ARN, eg. trust and resource policies, must be updated", Arn(rename.from, a.to.Account)))
+	}
+
+	fromPolicies, toPolicies := []AwsResource{}, []AwsResource{}
+	for _, p := range a.from.Policies {
+		if found, _ := a.to.FindPolicyByName(p.Name, p.Path); !found {
+			fromPolicies = append(fromPolicies, p)
+		}
+	}
+	for _, p := range a.to.Policies {
+		if found, _ := a.from.FindPolicyByName(p.Name, p.Path); !found {
+			toPolicies = append(toPolicies, p)
+		}
+	}
+	a.renames = append(a.renames, matchRenames(fromPolicies, toPolicies)...)
+}
+
+func (a *awsSyncCmdGenerator) renameGroups() {
+	fromOnly, toOnly := []AwsResource{}, []AwsResource{}
+	for _, g := range a.from.Groups {
+		if found, _ := a.to.FindGroupByName(g.Name, g.Path); !found {
+			fromOnly = append(fromOnly, g)
+		}
+	}
+	for _, g := range a.to.Groups {
+		if found, _ := a.from.FindGroupByName(g.Name, g.Path); !found {
+			toOnly = append(toOnly, g)
+		}
+	}
+
+	for _, rename := range matchRenames(fromOnly, toOnly) {
+		fromGroup, toGroup := rename.from.(*Group), rename.to.(*Group)
+		a.renames = append(a.renames, rename)
+
+		args := []string{"iam", "update-group", "--group-name", fromGroup.Name}
+		if fromGroup.Name != toGroup.Name {
+			args = append(args, "--new-group-name", toGroup.Name)
+		}
+		if fromGroup.Path != toGroup.Path {
+			args = append(args, "--new-path", path(toGroup.Path))
+		}
+		a.cmds.Add("aws", args...)
+
+		for i, g := range a.from.Groups {
+			if g == fromGroup {
+				a.from.Groups[i] = toGroup
+			}
+		}
+		for i, u := range a.from.Users {
+			if stringSliceContains(u.Groups, fromGroup.Name) {
+				renamed := *u
+				renamed.Groups = replaceString(u.Groups, fromGroup.Name, toGroup.Name)
+				a.from.Users[i] = &renamed
+			}
+		}
+	}
+}
+
+// renameUsers renames the users in AWS that users in the files are marked as
+// RenamedFrom, and moves the users whose name is the same but path isn't. A
+// user's access keys, password and MFA devices go with it, so users are never
+// renamed by their content, which a different person may share
+func (a *awsSyncCmdGenerator) renameUsers() {
+	fromOnly := []*User{}
+	for _, u := range a.from.Users {
+		if found, _ := a.to.FindUserByName(u.Name, u.Path); !found {
+			fromOnly = append(fromOnly, u)
+		}
+	}
+
+	for _, toUser := range a.to.Users {
+		if found, _ := a.from.FindUserByName(toUser.Name, toUser.Path); found {
+			continue
+		}
+		name := toUser.Name
+		if toUser.RenamedFrom != "" {
+			name = toUser.RenamedFrom
+		}
+		var fromUser *User
+		for _, u := range fromOnly {
+			if u.Name == name {
+				fromUser = u
+			}
+		}
+		if fromUser == nil {
+			if toUser.RenamedFrom != "" {
+				a.warnings.Add(WarningPlan, Arn(toUser, a.to.Account),
+					fmt.Sprintf("User is renamed from %s, which isn't in AWS or is protected from deletion, so it will be created", toUser.RenamedFrom))
+			}
+			continue
+		}
+		a.renames = append(a.renames, resourceRename{fromUser, toUser})
+
+		args := []string{"iam", "update-user", "--user-name", fromUser.Name}
+		if fromUser.Name != toUser.Name {
+			args = append(args, "--new-user-name", toUser.Name)
+			a.warnings.Add(WarningPlan, Arn(toUser, a.to.Account),
+				fmt.Sprintf("User is renamed from %s and keeps its access keys, password and MFA devices", fromUser.Name))
+		}
+		if fromUser.Path != toUser.Path {
+			args = append(args, "--new-path", path(toUser.Path))
+		}
+		a.cmds.Add("aws", args...)
+
+		for i, u := range a.from.Users {
+			if u == fromUser {
+				a.from.Users[i] = toUser
+			}
+		}
+	}
+}
+
+// renamedPolicy returns the policy in AWS that the policy in the files is a
+// rename of
+func (a *awsSyncCmdGenerator) renamedPolicy(toPolicy *Policy) *Policy {
+	for _, rename := range a.renames {
+		if rename.to == toPolicy {
+			return rename.from.(*Policy)
+		}
+	}
+	return nil
+}
+
+// migratePolicyAttachments attaches a renamed policy to the users, groups
+// and roles the old policy is attached to, and that the files attach it to,
+// before detaching the old policy, so they're never without its permissions
+func (a *awsSyncCmdGenerator) migratePolicyAttachments(fromPolicy, toPolicy *Policy) {
+	oldRef, newRef := policyRef(fromPolicy), policyRef(toPolicy)
+	oldArn, newArn := a.to.Account.policyArnFromString(oldRef), a.to.Account.policyArnFromString(newRef)
+	a.warnings.Add(WarningPlan, newArn,
+		fmt.Sprintf("Policy is a rename of %s, policies can't be renamed so its attachments will be moved to a new policy. Anything else referring to the old ARN must be updated", oldArn))
+
+	for i, u := range a.from.Users {
+		found, toUser := a.to.FindUserByName(u.Name, u.Path)
+		if !found {
+			continue
+		}
+		renamed := *u
+		if stringSliceContains(u.Policies, oldRef) && stringSliceContains(toUser.Policies, newRef) {
+			a.cmds.Add("aws", "iam", "attach-user-policy", "--user-name", u.Name, "--policy-arn", newArn)
+			a.cmds.Add("aws", "iam", "detach-user-policy", "--user-name", u.Name, "--policy-arn", oldArn)
+			renamed.Policies = replaceString(u.Policies, oldRef, newRef)
+		}
+		if u.PermissionsBoundary == oldRef && toUser.PermissionsBoundary == newRef {
+			a.cmds.Add("aws", "iam", "put-user-permissions-boundary", "--user-name", u.Name, "--permissions-boundary", newArn)
+			renamed.PermissionsBoundary = newRef
+		}
+		a.from.Users[i] = &renamed
+	}
+
+	for i, g := range a.from.Groups {
+		found, toGroup := a.to.FindGroupByName(g.Name, g.Path)
+		if found && stringSliceContains(g.Policies, oldRef) && stringSliceContains(toGroup.Policies, newRef) {
+			a.cmds.Add("aws", "iam", "attach-group-policy", "--group-name", g.Name, "--policy-arn", newArn)
+			a.cmds.Add("aws", "iam", "detach-group-policy", "--group-name", g.Name, "--policy-arn", oldArn)
+			renamed := *g
+			renamed.Policies = replaceString(g.Policies, oldRef, newRef)
+			a.from.Groups[i] = &renamed
+		}
+	}
+
+	for i, r := range a.from.Roles {
+		found, toRole := a.to.FindRoleByName(r.Name, r.Path)
+		if !found {
+			continue
+		}
+		renamed := *r
+		if stringSliceContains(r.Policies, oldRef) && stringSliceContains(toRole.Policies, newRef) {
+			a.cmds.Add("aws", "iam", "attach-role-policy", "--role-name", r.Name, "--policy-arn", newArn)
+			a.cmds.Add("aws", "iam", "detach-role-policy", "--role-name", r.Name, "--policy-arn", oldArn)
+			renamed.Policies = replaceString(r.Policies, oldRef, newRef)
+		}
+		if r.PermissionsBoundary == oldRef && toRole.PermissionsBoundary == newRef {
+			a.cmds.Add("aws", "iam", "put-role-permissions-boundary", "--role-name", r.Name, "--permissions-boundary", newArn)
+			renamed.PermissionsBoundary = newRef
+		}
+		a.from.Roles[i] = &renamed
+	}
+}
@@ -0,0 +1,152 @@
+package iamy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUserAndGroupRenames(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addGroup(&Group{iamService: iamService{Name: "devs", Path: "/"}, Policies: []string{"reader"}})
+	remoteData.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}, Groups: []string{"devs"}})
+
+	localData := NewAccountData("123")
+	localData.addGroup(&Group{iamService: iamService{Name: "developers", Path: "/team/"}, Policies: []string{"reader"}})
+	localData.addUser(&User{iamService: iamService{Name: "alice.smith", Path: "/"}, Groups: []string{"developers"}, RenamedFrom: "alice"})
+
+	plan := PlanSync(remoteData, localData)
+
+	expected := []string{
+		"aws iam update-group --group-name devs --new-group-name developers --new-path /team/",
+		"aws iam update-user --user-name alice --new-user-name alice.smith",
+	}
+	if actual := plan.Cmds.String(); actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+	if plan.Warnings.Count(WarningPlan) != 1 || !strings.Contains(plan.Warnings[0].Message, "keeps its access keys") {
+		t.Errorf("Expected a warning about the renamed user's credentials, got %v", plan.Warnings)
+	}
+
+	changes := plan.jsonPlan().Changes
+	if len(changes) != 2 {
+		t.Fatalf("Expected the user and group to be a change each, got %+v", changes)
+	}
+	for _, c := range changes {
+		if c.Resource == "iam/group/team/developers" && (c.Action != "rename" || c.RenamedFrom != "iam/group/devs" || len(c.Commands) != 1) {
+			t.Errorf("Expected the group to be one renamed change, got %+v", c)
+		}
+	}
+}
+
+func TestUsersAreOnlyRenamedWhenMarked(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}, Groups: []string{"devs"}})
+	remoteData.addUser(&User{iamService: iamService{Name: "carol", Path: "/"}})
+	localData := NewAccountData("123")
+	localData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, Groups: []string{"devs"}})
+	localData.addUser(&User{iamService: iamService{Name: "dave", Path: "/"}, RenamedFrom: "carol"})
+
+	plan := PlanSync(remoteData, localData)
+
+	if actual := plan.Cmds.String(); strings.Contains(actual, "--user-name alice --new-user-name") || !strings.Contains(actual, "create-user --user-name bob") || !strings.Contains(actual, "update-user --user-name carol --new-user-name dave") {
+		t.Errorf("Expected only the marked user to be renamed, got:\n%v", actual)
+	}
+}
+
+func TestMarkedUsersAreRenamedWithoutPrune(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}})
+	remoteData.addUser(&User{iamService: iamService{Name: "carol", Path: "/"}})
+	localData := NewAccountData("123")
+	localData.addUser(&User{iamService: iamService{Name: "dave", Path: "/"}, RenamedFrom: "carol"})
+
+	plan := PlanSyncWithOptions(remoteData, localData, SyncOptions{DisablePrune: true})
+
+	if actual := plan.Cmds.String(); actual != "aws iam update-user --user-name carol --new-user-name dave" {
+		t.Errorf("Expected the marked user to be renamed and the other kept, got:\n%v", actual)
+	}
+	if plan.Warnings.Count(WarningPrune) != 1 || !strings.Contains(fmt.Sprint(plan.Warnings), "user/alice") {
+		t.Errorf("Expected only the unmarked user to be kept, got %v", plan.Warnings)
+	}
+}
+
+func TestProtectedUsersAreNotRenamed(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addUser(&User{iamService: iamService{Name: "carol", Path: "/"}})
+	localData := NewAccountData("123")
+	localData.addUser(&User{iamService: iamService{Name: "dave", Path: "/"}, RenamedFrom: "carol"})
+
+	plan := PlanSyncWithOptions(remoteData, localData, SyncOptions{Protected: []ResourceSelector{{"user", "carol"}}})
+
+	if actual := plan.Cmds.String(); strings.Contains(actual, "update-user") || !strings.Contains(actual, "create-user --user-name dave") {
+		t.Errorf("Expected the user to be created rather than renamed, got:\n%v", actual)
+	}
+	if !strings.Contains(fmt.Sprint(plan.Warnings), "renamed from carol, which isn't in AWS or is protected") {
+		t.Errorf("Expected a warning that the protected user isn't renamed, got %v", plan.Warnings)
+	}
+}
+
+func TestPolicyRenameMigratesAttachments(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "old_reader", Path: "/"}, Policy: doc})
+	remoteData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, Policies: []string{"old_reader"}})
+	remoteData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: doc, Policies: []string{"old_reader"}, PermissionsBoundary: "old_reader"})
+
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc})
+	localData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, Policies: []string{"reader"}})
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: doc, Policies: []string{"reader"}, PermissionsBoundary: "reader"})
+
+	plan := PlanSync(remoteData, localData)
+
+	expected := []string{
+		"aws iam create-policy --policy-name reader --path / --policy-document '" + doc.JsonString() + "'",
+		"aws iam attach-user-policy --user-name bob --policy-arn arn:aws:iam::123:policy/reader",
+		"aws iam attach-role-policy --role-name app --policy-arn arn:aws:iam::123:policy/reader",
+		"aws iam put-role-permissions-boundary --role-name app --permissions-boundary arn:aws:iam::123:policy/reader",
+		"aws iam detach-user-policy --user-name bob --policy-arn arn:aws:iam::123:policy/old_reader",
+		"aws iam detach-role-policy --role-name app --policy-arn arn:aws:iam::123:policy/old_reader",
+		"aws iam delete-policy --policy-arn arn:aws:iam::123:policy/old_reader",
+	}
+	if actual := plan.Cmds.String(); actual != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%v\nActual:\n%v", strings.Join(expected, "\n"), actual)
+	}
+	if plan.Warnings.Count(WarningPlan) != 1 {
+		t.Errorf("Expected a warning about the renamed policy's ARN, got %v", plan.Warnings)
+	}
+}
+
+func TestRoleRenameIsRecreated(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: doc})
+	localData := NewAccountData("123")
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/services/"}, AssumeRolePolicyDocument: doc})
+
+	plan := PlanSync(remoteData, localData)
+	if plan.Cmds.Count() != 2 || plan.Warnings.Count(WarningPlan) != 1 || !strings.Contains(plan.Warnings[0].Message, "arn:aws:iam::123:role/app") {
+		t.Errorf("Expected the role to be recreated with a warning, got:\n%v\n%v", plan.Cmds, plan.Warnings)
+	}
+
+	plan = PlanSyncWithOptions(remoteData, localData, SyncOptions{DisableRenameDetection: true})
+	if plan.Warnings.Count(WarningPlan) != 0 {
+		t.Errorf("Expected no warnings without rename detection, got %v", plan.Warnings)
+	}
+}
+
+func TestAmbiguousRenamesAreNotMatched(t *testing.T) {
+	remoteData := NewAccountData("123")
+	remoteData.addGroup(&Group{iamService: iamService{Name: "a", Path: "/"}})
+	remoteData.addGroup(&Group{iamService: iamService{Name: "b", Path: "/"}})
+	localData := NewAccountData("123")
+	localData.addGroup(&Group{iamService: iamService{Name: "c", Path: "/"}})
+
+	plan := PlanSync(remoteData, localData)
+	if strings.Contains(plan.Cmds.String(), "update-group") {
+		t.Errorf("Expected groups with the same content not to be renamed, got:\n%v", plan.Cmds)
+	}
+}
@@ -0,0 +1,325 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A PlanRenderer writes a sync plan in an output format, so one plan can be
+// rendered for people reviewing a change and for the machines applying it
+type PlanRenderer interface {
+	Render(w io.Writer, plan *SyncPlan) error
+}
+
+// PlanRenderers are the renderers by the name they're selected with
+var PlanRenderers = map[string]PlanRenderer{
+	"shell":    ShellRenderer{},
+	"json":     JsonRenderer{},
+	"markdown": MarkdownRenderer{},
+	"github":   GithubCommentRenderer{},
+}
+
+// PlanRendererNames returns the names of the renderers, sorted
+func PlanRendererNames() []string {
+	names := []string{}
+	for name := range PlanRenderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ScriptFormats are the formats ShellRenderer can write scripts in
+var ScriptFormats = []string{"sh", "bash", "powershell"}
+
+// ShellRenderer writes the commands as a shell script that stops at the
+// first failure. As sh, the script is the commands as they're listed. As bash
+// and PowerShell, commands that create or remove IAM entities carry on when
+// they fail because the change is already made, so the script can be rerun
+// after a failure part way through. PowerShell scripts pass arguments to
+// programs the legacy way, so they run the same in Windows PowerShell 5.1
+// and PowerShell 7
+type ShellRenderer struct {
+	// Format is one of ScriptFormats, sh by default
+	Format string
+}
+
+func (r ShellRenderer) Render(w io.Writer, plan *SyncPlan) error {
+	var lines []string
+	switch r.Format {
+	case "", "sh":
+		lines = []string{"#!/bin/sh", fmt.Sprintf("# iamy plan for %s", plan.to.Account), "set -e"}
+		for _, c := range plan.Cmds {
+			lines = append(lines, c.String())
+		}
+	case "bash":
+		lines = []string{"#!/usr/bin/env bash", fmt.Sprintf("# iamy plan for %s", plan.to.Account), "set -euo pipefail", "", bashTolerate, ""}
+		for _, c := range plan.Cmds {
+			line := c.Quoted("posix")
+			if code := c.completedErrorCode(); code != "" {
+				line = "tolerate " + code + " " + line
+			}
+			lines = append(lines, line)
+		}
+	case "powershell":
+		lines = []string{fmt.Sprintf("# iamy plan for %s", plan.to.Account), "$ErrorActionPreference = 'Stop'", "$PSNativeCommandArgumentPassing = 'Legacy'", "", powershellInvoke, ""}
+		for _, c := range plan.Cmds {
+			args := []string{powershellQuote(c.Name)}
+			for _, a := range c.Args {
+				args = append(args, powershellLegacyQuote(a))
+			}
+			line := "Invoke-IamyCommand"
+			if code := c.completedErrorCode(); code != "" {
+				line += " -Tolerate " + powershellQuote(code)
+			}
+			lines = append(lines, line+" -Command @("+strings.Join(args, ", ")+")")
+		}
+	default:
+		return fmt.Errorf("Unknown script format %s, expected one of %s", r.Format, strings.Join(ScriptFormats, ", "))
+	}
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// completedErrorCode returns the error code the command fails with when its
+// change has already been made, for commands that create or remove IAM
+// entities and associations. Other commands either succeed when rerun, or
+// would make another change, like creating another policy version
+func (c Cmd) completedErrorCode() string {
+	if len(c.Args) < 2 || c.Args[0] != "iam" || c.Args[1] == "create-policy-version" {
+		return ""
+	}
+	op := c.Args[1]
+	switch {
+	case strings.HasPrefix(op, "create-"):
+		return "EntityAlreadyExists"
+	case strings.HasPrefix(op, "delete-"), strings.HasPrefix(op, "detach-"), strings.HasPrefix(op, "remove-"), op == "deactivate-mfa-device":
+		return "NoSuchEntity"
+	}
+	return ""
+}
+
+const bashTolerate = `# tolerate runs a command, carrying on if it fails with the error code given,
+# which means its change has already been made
+tolerate() {
+  local code="$1" out
+  shift
+  if ! out="$("$@" 2>&1)"; then
+    if [[ "$out" == *"($code)"* ]]; then
+      echo "Already done: $*" >&2
+      return 0
+    fi
+    echo "$out" >&2
+    return 1
+  fi
+  if [[ -n "$out" ]]; then
+    echo "$out"
+  fi
+}`
+
+const powershellInvoke = `# Invoke-IamyCommand runs a command, stopping the script if it fails, unless
+# it fails with the Tolerate error code, which means its change has already
+# been made
+function Invoke-IamyCommand {
+    param([string[]]$Command, [string]$Tolerate)
+    $program, $arguments = $Command
+    $out = & $program @arguments 2>&1 | Out-String
+    if ($LASTEXITCODE -ne 0) {
+        if ($Tolerate -and $out.Contains("($Tolerate)")) {
+            Write-Warning "Already done: $($Command -join ' ')"
+            return
+        }
+        throw "$($Command -join ' ') failed: $out"
+    }
+    $out
+}`
+
+// powershellQuote quotes the argument as a PowerShell verbatim string
+func powershellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// JsonRenderer writes the plan resource by resource as JSON, for CI systems
+// to consume instead of parsing the commands
+type JsonRenderer struct{}
+
+func (JsonRenderer) Render(w io.Writer, plan *SyncPlan) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(plan.jsonPlan())
+}
+
+// MarkdownRenderer writes a summary of the changed resources and the plan
+// warnings, followed by a collapsed section for each type of resource with
+// the changes to each resource's policy statements and its commands
+type MarkdownRenderer struct{}
+
+func (MarkdownRenderer) Render(w io.Writer, plan *SyncPlan) error {
+	p := plan.jsonPlan()
+	_, err := io.WriteString(w, markdownSummary(p, len(p.Changes))+markdownDetails(plan, p))
+	return err
+}
+
+// markdownDetails describes each change, grouped by the type of resource
+func markdownDetails(plan *SyncPlan, p *JsonPlan) string {
+	docs := map[AwsResource][]locatedPolicyDocument{}
+	for _, data := range []*AccountData{plan.from, plan.to} {
+		for _, d := range data.policyDocuments() {
+			docs[d.resource] = append(docs[d.resource], d)
+		}
+	}
+
+	groups := []string{}
+	changes := map[string][]PlanChange{}
+	attributed := map[string]int{}
+	for _, c := range p.Changes {
+		r := c.After
+		if r == nil {
+			r = c.Before
+		}
+		group := strings.TrimSuffix(r.Service()+"/"+r.ResourceType(), "/")
+		if _, ok := changes[group]; !ok {
+			groups = append(groups, group)
+		}
+		changes[group] = append(changes[group], c)
+		for _, cmd := range c.Commands {
+			attributed[cmd.Shell]++
+		}
+	}
+
+	var b strings.Builder
+	for _, group := range groups {
+		fmt.Fprintf(&b, "\n<details><summary><code>%s</code> (%d)</summary>\n", group, len(changes[group]))
+		for _, c := range changes[group] {
+			fmt.Fprintf(&b, "\n#### `%s` %s\n", c.Resource, c.Action)
+			if c.RenamedFrom != "" {
+				fmt.Fprintf(&b, "\nRenamed from `%s`\n", c.RenamedFrom)
+			}
+			if diff := policyDiff(docs[c.Before], docs[c.After]); diff != "" {
+				b.WriteString("\n```diff\n" + diff + "```\n")
+			}
+			if len(c.Commands) > 0 {
+				b.WriteString("\n```sh\n")
+				for _, cmd := range c.Commands {
+					b.WriteString(cmd.Shell + "\n")
+				}
+				b.WriteString("```\n")
+			}
+		}
+		b.WriteString("\n</details>\n")
+	}
+
+	other := []string{}
+	for _, cmd := range p.Commands {
+		if attributed[cmd.Shell] > 0 {
+			attributed[cmd.Shell]--
+		} else {
+			other = append(other, cmd.Shell)
+		}
+	}
+	if len(other) > 0 {
+		fmt.Fprintf(&b, "\n<details><summary>Other commands (%d)</summary>\n\n```sh\n%s\n```\n\n</details>\n", len(other), strings.Join(other, "\n"))
+	}
+
+	return b.String()
+}
+
+// markdownSummary summarises the plan, listing up to maxRows changes
+func markdownSummary(p *JsonPlan, maxRows int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### iamy plan for %s\n\n", p.Account)
+
+	if len(p.Changes) == 0 && len(p.Commands) == 0 {
+		b.WriteString("Already up to date\n")
+	} else {
+		b.WriteString("| Resource | Action | Commands |\n| --- | --- | --- |\n")
+		for i, c := range p.Changes {
+			if i == maxRows {
+				fmt.Fprintf(&b, "| %d more | | |\n", len(p.Changes)-maxRows)
+				break
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %d |\n", c.Resource, c.Action, len(c.Commands))
+		}
+
+		destructive := 0
+		for _, c := range p.Commands {
+			if c.Destructive {
+				destructive++
+			}
+		}
+		actions := []string{}
+		for _, action := range []string{"create", "update", "rename", "delete"} {
+			n := 0
+			for _, c := range p.Changes {
+				if c.Action == action {
+					n++
+				}
+			}
+			if n > 0 {
+				actions = append(actions, fmt.Sprintf("%d %s", n, action))
+			}
+		}
+		fmt.Fprintf(&b, "\n%d resources changed (%s) by %d commands (%d destructive)\n", len(p.Changes), strings.Join(actions, ", "), len(p.Commands), destructive)
+	}
+
+	if len(p.Warnings) > 0 {
+		b.WriteString("\n#### Warnings\n\n")
+		for _, w := range p.Warnings {
+			fmt.Fprintf(&b, "- %s\n", markdownEscaper.Replace(w.String()))
+		}
+	}
+
+	return b.String()
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`", "<", "&lt;", ">", "&gt;")
+
+// GithubCommentMarker starts the body of GitHub pull request comments, so
+// tooling can find and update the comment for an account instead of adding
+// another on every run
+const GithubCommentMarker = "<!-- iamy-plan:%s -->"
+
+// githubCommentMaxLength is the longest comment GitHub accepts
+const githubCommentMaxLength = 65536
+
+// GithubCommentRenderer writes a pull request comment body, the markdown
+// summary followed by the commands in a collapsed section. The summary's
+// changes and the commands are cut short rather than exceed GitHub's comment
+// length limit
+type GithubCommentRenderer struct{}
+
+func (GithubCommentRenderer) Render(w io.Writer, plan *SyncPlan) error {
+	p := plan.jsonPlan()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, GithubCommentMarker+"\n", p.Account)
+	rows := len(p.Changes)
+	summary := markdownSummary(p, rows)
+	for len(summary) > githubCommentMaxLength/2 && rows > 0 {
+		rows /= 2
+		summary = markdownSummary(p, rows)
+	}
+	b.WriteString(summary)
+
+	if len(p.Commands) > 0 {
+		const start, end = "\n<details><summary>Commands</summary>\n\n```sh\n", "```\n</details>\n"
+		const truncated = "# ... commands cut short to fit in a comment, see the plan in CI\n"
+
+		b.WriteString(start)
+		for _, c := range p.Commands {
+			line := c.Shell + "\n"
+			if b.Len()+len(line)+len(truncated)+len(end) > githubCommentMaxLength {
+				b.WriteString(truncated)
+				break
+			}
+			b.WriteString(line)
+		}
+		b.WriteString(end)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
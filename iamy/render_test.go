@@ -0,0 +1,173 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyncPlanJson(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+	other := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "unchanged", Path: "/"}, Policy: doc})
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "changed", Path: "/"}, Policy: doc})
+	remoteData.addGlacierVaultPolicy(&GlacierVaultPolicy{Region: "us-east-1", VaultName: "archive", Policy: doc})
+
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "unchanged", Path: "/"}, Policy: doc})
+	localData.addPolicy(&Policy{iamService: iamService{Name: "changed", Path: "/"}, Policy: other})
+	localData.addRole(&Role{iamService: iamService{Name: "reader", Path: "/"}, AssumeRolePolicyDocument: doc, Policies: []string{"unchanged"}})
+	localData.addGlacierVaultPolicy(&GlacierVaultPolicy{Region: "ap-southeast-2", VaultName: "archive", Policy: doc})
+
+	plan := PlanSync(remoteData, localData)
+
+	var buf bytes.Buffer
+	if err := (JsonRenderer{}).Render(&buf, plan); err != nil {
+		t.Fatal(err)
+	}
+	var actual struct {
+		Changes []struct {
+			Resource string
+			Action   string
+			Before   map[string]interface{}
+			After    map[string]interface{}
+			Commands []struct{ Argv []string }
+		}
+		Commands []struct {
+			Shell       string
+			Destructive bool
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(actual.Commands) != len(plan.Cmds) {
+		t.Errorf("Expected all %d commands, got %d", len(plan.Cmds), len(actual.Commands))
+	}
+
+	summary := map[string]string{}
+	commands := map[string]int{}
+	for _, c := range actual.Changes {
+		summary[c.Resource] = c.Action
+		commands[c.Resource] = len(c.Commands)
+	}
+	expected := map[string]string{
+		"iam/policy/changed":                   "update",
+		"iam/role/reader":                      "create",
+		"glacier/vault/us-east-1/archive":      "delete",
+		"glacier/vault/ap-southeast-2/archive": "create",
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, summary)
+	}
+	for resource, count := range map[string]int{
+		"iam/policy/changed":                   1,
+		"iam/role/reader":                      2,
+		"glacier/vault/us-east-1/archive":      1,
+		"glacier/vault/ap-southeast-2/archive": 1,
+	} {
+		if commands[resource] != count {
+			t.Errorf("Expected %d commands for %s, got %d", count, resource, commands[resource])
+		}
+	}
+}
+
+func TestPlanRenderers(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addPolicy(&Policy{iamService: iamService{Name: "old_reader", Path: "/"}, Policy: doc})
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: doc})
+
+	plan := PlanSyncWithOptions(remoteData, localData, SyncOptions{DisableRenameDetection: true})
+
+	render := func(name string) string {
+		var buf bytes.Buffer
+		if err := PlanRenderers[name].Render(&buf, plan); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	shell := render("shell")
+	if !strings.HasPrefix(shell, "#!/bin/sh\n# iamy plan for 123\nset -e\naws iam create-policy") || !strings.HasSuffix(shell, "aws iam delete-policy --policy-arn arn:aws:iam::123:policy/old_reader\n") {
+		t.Errorf("Unexpected shell script:\n%s", shell)
+	}
+
+	var script bytes.Buffer
+	if err := (ShellRenderer{Format: "bash"}).Render(&script, plan); err != nil {
+		t.Fatal(err)
+	}
+	bash := script.String()
+	if !strings.HasPrefix(bash, "#!/usr/bin/env bash\n# iamy plan for 123\nset -euo pipefail\n") ||
+		!strings.Contains(bash, "\ntolerate EntityAlreadyExists aws iam create-policy --policy-name reader --path / --policy-document '{\n") ||
+		!strings.HasSuffix(bash, "\ntolerate NoSuchEntity aws iam delete-policy --policy-arn arn:aws:iam::123:policy/old_reader\n") {
+		t.Errorf("Unexpected bash script:\n%s", bash)
+	}
+
+	script.Reset()
+	if err := (ShellRenderer{Format: "powershell"}).Render(&script, plan); err != nil {
+		t.Fatal(err)
+	}
+	powershell := script.String()
+	if !strings.HasPrefix(powershell, "# iamy plan for 123\n$ErrorActionPreference = 'Stop'\n") ||
+		!strings.HasSuffix(powershell, "\nInvoke-IamyCommand -Tolerate 'NoSuchEntity' -Command @('aws', 'iam', 'delete-policy', '--policy-arn', 'arn:aws:iam::123:policy/old_reader')\n") {
+		t.Errorf("Unexpected PowerShell script:\n%s", powershell)
+	}
+
+	if powershellQuote("it's") != "'it''s'" || powershellLegacyQuote(`{"a": "it's \\"}`) != `'{\"a\": \"it''s \\\\\"}'` {
+		t.Errorf("Expected quotes in arguments to be escaped")
+	}
+
+	markdown := render("markdown")
+	for _, expected := range []string{
+		"### iamy plan for 123\n",
+		"| `iam/policy/reader` | create | 1 |\n",
+		"| `iam/policy/old_reader` | delete | 1 |\n",
+		"2 resources changed (1 create, 1 delete) by 2 commands (1 destructive)\n",
+		"#### Warnings\n\n- [plan] arn:aws:iam::123:policy/reader: Policy has the same document as arn:aws:iam::123:policy/old\\_reader",
+		"<details><summary><code>iam/policy</code> (2)</summary>\n\n#### `iam/policy/old_reader` delete\n\n```diff\n# Policy\n- {\n-   \"Action\": \"s3:GetObject\",\n",
+		"#### `iam/policy/reader` create\n\n```diff\n# Policy\n+ {\n",
+	} {
+		if !strings.Contains(markdown, expected) {
+			t.Errorf("Expected markdown to contain %q, got:\n%s", expected, markdown)
+		}
+	}
+
+	github := render("github")
+	if !strings.HasPrefix(github, "<!-- iamy-plan:123 -->\n### iamy plan for 123\n") || strings.Contains(github, "```diff") || !strings.Contains(github, "```sh\naws iam create-policy") {
+		t.Errorf("Unexpected GitHub comment:\n%s", github)
+	}
+
+	upToDate := &SyncPlan{from: localData, to: localData}
+	var buf bytes.Buffer
+	if err := (MarkdownRenderer{}).Render(&buf, upToDate); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "### iamy plan for 123\n\nAlready up to date\n" {
+		t.Errorf("Unexpected markdown for an empty plan:\n%s", buf.String())
+	}
+}
+
+func TestGithubCommentIsCutShort(t *testing.T) {
+	localData := NewAccountData("123")
+	for i := 0; i < 2000; i++ {
+		localData.addUser(&User{iamService: iamService{Name: fmt.Sprintf("user-with-a-long-name-%d", i), Path: "/"}})
+	}
+	plan := PlanSync(NewAccountData("123"), localData)
+
+	var buf bytes.Buffer
+	if err := (GithubCommentRenderer{}).Render(&buf, plan); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > githubCommentMaxLength || !strings.Contains(buf.String(), "commands cut short") || !strings.HasSuffix(buf.String(), "```\n</details>\n") {
+		t.Errorf("Expected the comment to be cut short to %d characters, got %d", githubCommentMaxLength, buf.Len())
+	}
+}
@@ -0,0 +1,232 @@
+package iamy
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/pkg/errors"
+)
+
+// ReportKinds are the inventories iamy report writes, each a table with a
+// row for each resource
+var ReportKinds = []string{"users", "roles", "policies"}
+
+// reportListSeparator separates the values of a list in a cell, so each
+// resource stays on one row
+const reportListSeparator = "; "
+
+// An AccessKey is the metadata of a user's access key, for the ages of the
+// keys in the users inventory. The files don't hold access keys, so they're
+// only known for AWS
+type AccessKey struct {
+	Id      string
+	Status  string
+	Created time.Time
+}
+
+// FetchAccessKeys returns the access keys of the account's users, by the ARN
+// of each user
+func FetchAccessKeys(data *AccountData) (map[string][]AccessKey, error) {
+	return fetchAccessKeys(newIamClient(awsSession()), data)
+}
+
+func fetchAccessKeys(client iamiface.IAMAPI, data *AccountData) (map[string][]AccessKey, error) {
+	keys := map[string][]AccessKey{}
+	for _, u := range data.Users {
+		err := client.ListAccessKeysPages(&iam.ListAccessKeysInput{UserName: aws.String(u.Name)}, func(resp *iam.ListAccessKeysOutput, lastPage bool) bool {
+			for _, m := range resp.AccessKeyMetadata {
+				keys[Arn(u, data.Account)] = append(keys[Arn(u, data.Account)], AccessKey{
+					Id:      aws.StringValue(m.AccessKeyId),
+					Status:  aws.StringValue(m.Status),
+					Created: aws.TimeValue(m.CreateDate),
+				})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error listing the access keys of user %s", u.Name)
+		}
+	}
+	return keys, nil
+}
+
+// InventoryReport returns the kind of inventory of the accounts as rows,
+// after a header row. Lists of values are joined into one cell, and the ages
+// of resources are as of now, from when the pull recorded they were created.
+// The keys are the users' access keys, by ARN. Without keys the columns of
+// access keys are left empty, as they aren't known
+func InventoryReport(kind string, accounts []*AccountData, keys map[string][]AccessKey, now time.Time) ([][]string, error) {
+	switch kind {
+	case "users":
+		return usersInventory(accounts, keys, now), nil
+	case "roles":
+		return rolesInventory(accounts, now), nil
+	case "policies":
+		return policiesInventory(accounts, now), nil
+	}
+	return nil, fmt.Errorf("Unknown report %s, expected one of %s", kind, strings.Join(ReportKinds, ", "))
+}
+
+func usersInventory(accounts []*AccountData, keys map[string][]AccessKey, now time.Time) [][]string {
+	rows := [][]string{{"Account", "Name", "Path", "Arn", "Groups", "Policies", "InlinePolicies", "PermissionsBoundary", "CreateDate", "AgeDays", "AccessKeys", "ActiveAccessKeys", "OldestActiveKeyAgeDays", "AccessKeyAges"}}
+	for _, data := range accounts {
+		for _, u := range data.Users {
+			row := []string{data.Account.String(), u.Name, u.Path, Arn(u, data.Account),
+				joinReportList(u.Groups), joinReportList(u.Policies), inlinePolicyNames(u.InlinePolicies), u.PermissionsBoundary}
+			row = append(row, createdCells(u.CreateDate, now)...)
+			if keys == nil {
+				rows = append(rows, append(row, "", "", "", ""))
+				continue
+			}
+
+			userKeys := keys[Arn(u, data.Account)]
+			active, oldest := 0, -1
+			ages := []string{}
+			for _, k := range userKeys {
+				age := ageDays(k.Created, now)
+				if k.Status == iam.StatusTypeActive {
+					active++
+					if age > oldest {
+						oldest = age
+					}
+				}
+				ages = append(ages, fmt.Sprintf("%s (%s, %d days)", k.Id, k.Status, age))
+			}
+			oldestCell := ""
+			if oldest >= 0 {
+				oldestCell = fmt.Sprint(oldest)
+			}
+			rows = append(rows, append(row, fmt.Sprint(len(userKeys)), fmt.Sprint(active), oldestCell, strings.Join(ages, reportListSeparator)))
+		}
+	}
+	return rows
+}
+
+// createdCells are the cells of when a resource was created and how many
+// days old it is, left empty when the pull didn't record it
+func createdCells(created *time.Time, now time.Time) []string {
+	if created == nil {
+		return []string{"", ""}
+	}
+	return []string{created.UTC().Format(time.RFC3339), fmt.Sprint(ageDays(*created, now))}
+}
+
+// ageDays is how many whole days old something created at the time is
+func ageDays(created, now time.Time) int {
+	return int(math.Floor(now.Sub(created).Hours() / 24))
+}
+
+func rolesInventory(accounts []*AccountData, now time.Time) [][]string {
+	rows := [][]string{{"Account", "Name", "Path", "Arn", "Description", "TrustPrincipals", "Policies", "InlinePolicies", "PermissionsBoundary", "MaxSessionDuration", "CreateDate", "AgeDays"}}
+	for _, data := range accounts {
+		for _, r := range data.Roles {
+			duration := ""
+			if r.MaxSessionDuration != 0 {
+				duration = fmt.Sprint(r.MaxSessionDuration)
+			}
+			row := []string{data.Account.String(), r.Name, r.Path, Arn(r, data.Account), r.Description,
+				joinReportList(trustPrincipals(r.AssumeRolePolicyDocument)), joinReportList(r.Policies), inlinePolicyNames(r.InlinePolicies),
+				r.PermissionsBoundary, duration}
+			rows = append(rows, append(row, createdCells(r.CreateDate, now)...))
+		}
+	}
+	return rows
+}
+
+// trustPrincipals returns the principals the Allow statements of a trust
+// policy allow to assume the role, by type, eg. "Service ec2.amazonaws.com"
+func trustPrincipals(doc *PolicyDocument) []string {
+	principals := []string{}
+	add := func(p string) {
+		if !stringSliceContains(principals, p) {
+			principals = append(principals, p)
+		}
+	}
+	for _, s := range doc.statements() {
+		if effect, _ := s["Effect"].(string); effect != "Allow" {
+			continue
+		}
+		switch p := s["Principal"].(type) {
+		case string:
+			add(p)
+		case map[string]interface{}:
+			for t, values := range p {
+				for _, v := range stringOrSlice(values) {
+					add(t + " " + v)
+				}
+			}
+		}
+	}
+	sort.Strings(principals)
+	return principals
+}
+
+func policiesInventory(accounts []*AccountData, now time.Time) [][]string {
+	rows := [][]string{{"Account", "Name", "Path", "Arn", "Type", "Description", "CreateDate", "AgeDays", "AttachedUsers", "AttachedGroups", "AttachedRoles", "Attachments"}}
+	for _, data := range accounts {
+		attachments := func(ref string) []string {
+			users, groups, roles := []string{}, []string{}, []string{}
+			for _, u := range data.Users {
+				if stringSliceContains(u.Policies, ref) {
+					users = append(users, u.Name)
+				}
+			}
+			for _, g := range data.Groups {
+				if stringSliceContains(g.Policies, ref) {
+					groups = append(groups, g.Name)
+				}
+			}
+			for _, r := range data.Roles {
+				if stringSliceContains(r.Policies, ref) {
+					roles = append(roles, r.Name)
+				}
+			}
+			return []string{joinReportList(users), joinReportList(groups), joinReportList(roles), fmt.Sprint(len(users) + len(groups) + len(roles))}
+		}
+
+		for _, p := range data.Policies {
+			row := append([]string{data.Account.String(), p.Name, p.Path, Arn(p, data.Account), "customer", p.Description}, createdCells(p.CreateDate, now)...)
+			rows = append(rows, append(row, attachments(policyRef(p))...))
+		}
+		for _, arn := range data.awsManagedPolicyArns() {
+			name := arn[strings.LastIndex(arn, "/")+1:]
+			path := strings.TrimSuffix(arn[strings.Index(arn, ":policy/")+len(":policy"):], name)
+			row := []string{data.Account.String(), name, path, arn, "aws", "", "", ""}
+			rows = append(rows, append(row, attachments(arn)...))
+		}
+	}
+	return rows
+}
+
+func joinReportList(values []string) string {
+	return strings.Join(values, reportListSeparator)
+}
+
+func inlinePolicyNames(policies []InlinePolicy) string {
+	names := []string{}
+	for _, p := range policies {
+		names = append(names, p.Name)
+	}
+	return joinReportList(names)
+}
+
+// WriteReport writes the rows of an inventory as CSV, or as tab separated
+// values with the tsv format
+func WriteReport(w io.Writer, rows [][]string, format string) error {
+	cw := csv.NewWriter(w)
+	if format == "tsv" {
+		cw.Comma = '\t'
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return errors.Wrap(err, "Error writing the report")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package iamy
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+type fakeAccessKeysIam struct {
+	iamiface.IAMAPI
+	keys map[string][]*iam.AccessKeyMetadata
+}
+
+func (f *fakeAccessKeysIam) ListAccessKeysPages(input *iam.ListAccessKeysInput, fn func(*iam.ListAccessKeysOutput, bool) bool) error {
+	fn(&iam.ListAccessKeysOutput{AccessKeyMetadata: f.keys[*input.UserName]}, true)
+	return nil
+}
+
+func TestInventoryReport(t *testing.T) {
+	readOnly := "arn:aws:iam::aws:policy/ReadOnlyAccess"
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"},
+		{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::456:root","arn:aws:iam::789:root"]},"Action":"sts:AssumeRole"},
+		{"Effect":"Deny","Principal":"*","Action":"sts:AssumeRole"}]}`)
+	policy := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+
+	data := NewAccountData("myalias-123")
+	created := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	data.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}, Groups: []string{"admins", "devs"}, Policies: []string{"team/reader"}, CreateDate: &created})
+	data.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, InlinePolicies: []InlinePolicy{{Name: "s3", Policy: policy}}})
+	data.addGroup(&Group{iamService: iamService{Name: "devs", Path: "/"}, Policies: []string{"team/reader", readOnly}})
+	data.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{readOnly}, MaxSessionDuration: 7200, CreateDate: &created})
+	data.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/team/"}, Description: "Reads things", Policy: policy})
+
+	now := time.Date(2022, 3, 4, 12, 0, 0, 0, time.UTC)
+	keys, err := fetchAccessKeys(&fakeAccessKeysIam{keys: map[string][]*iam.AccessKeyMetadata{
+		"alice": {
+			{AccessKeyId: aws.String("AKIAOLD"), Status: aws.String("Active"), CreateDate: aws.Time(now.AddDate(0, 0, -120).Add(time.Hour))},
+			{AccessKeyId: aws.String("AKIAOLDER"), Status: aws.String("Inactive"), CreateDate: aws.Time(now.AddDate(0, 0, -400))},
+		},
+	}}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := InventoryReport("users", []*AccountData{data}, keys, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"Account", "Name", "Path", "Arn", "Groups", "Policies", "InlinePolicies", "PermissionsBoundary", "CreateDate", "AgeDays", "AccessKeys", "ActiveAccessKeys", "OldestActiveKeyAgeDays", "AccessKeyAges"},
+		{"myalias-123", "alice", "/", "arn:aws:iam::123:user/alice", "admins; devs", "team/reader", "", "", "2021-03-04T00:00:00Z", "365", "2", "1", "119", "AKIAOLD (Active, 119 days); AKIAOLDER (Inactive, 400 days)"},
+		{"myalias-123", "bob", "/", "arn:aws:iam::123:user/bob", "", "", "s3", "", "", "", "0", "0", "", ""},
+	}
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("Expected users\n%v\ngot\n%v", expected, users)
+	}
+
+	users, _ = InventoryReport("users", []*AccountData{data}, nil, now)
+	if row := users[1]; row[10] != "" || row[13] != "" {
+		t.Errorf("Expected no access keys without them, got %v", row)
+	}
+
+	roles, _ := InventoryReport("roles", []*AccountData{data}, nil, now)
+	expected = [][]string{
+		{"Account", "Name", "Path", "Arn", "Description", "TrustPrincipals", "Policies", "InlinePolicies", "PermissionsBoundary", "MaxSessionDuration", "CreateDate", "AgeDays"},
+		{"myalias-123", "app", "/", "arn:aws:iam::123:role/app", "", "AWS arn:aws:iam::456:root; AWS arn:aws:iam::789:root; Service ec2.amazonaws.com", readOnly, "", "", "7200", "2021-03-04T00:00:00Z", "365"},
+	}
+	if !reflect.DeepEqual(roles, expected) {
+		t.Errorf("Expected roles\n%v\ngot\n%v", expected, roles)
+	}
+
+	policies, _ := InventoryReport("policies", []*AccountData{data}, nil, now)
+	expected = [][]string{
+		{"Account", "Name", "Path", "Arn", "Type", "Description", "CreateDate", "AgeDays", "AttachedUsers", "AttachedGroups", "AttachedRoles", "Attachments"},
+		{"myalias-123", "reader", "/team/", "arn:aws:iam::123:policy/team/reader", "customer", "Reads things", "", "", "alice", "devs", "", "2"},
+		{"myalias-123", "ReadOnlyAccess", "/", readOnly, "aws", "", "", "", "", "devs", "app", "2"},
+	}
+	if !reflect.DeepEqual(policies, expected) {
+		t.Errorf("Expected policies\n%v\ngot\n%v", expected, policies)
+	}
+
+	if _, err = InventoryReport("buckets", []*AccountData{data}, nil, now); err == nil {
+		t.Error("Expected an error for an unknown report")
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	rows := [][]string{{"Name", "Groups"}, {"alice", "admins; devs"}, {"bob", `"quoted", value`}}
+
+	var b bytes.Buffer
+	if err := WriteReport(&b, rows, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Name,Groups\nalice,admins; devs\nbob,\"\"\"quoted\"\", value\"\n"; b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+
+	b.Reset()
+	if err := WriteReport(&b, rows[:2], "tsv"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Name\tGroups\nalice\tadmins; devs\n"; b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
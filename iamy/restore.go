@@ -0,0 +1,217 @@
+package iamy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RestoreFromSnapshot returns copies of the resources the selector selects in
+// the snapshot, for the files, so push recreates them. A resource named the
+// same as one in the files is an error, unless newName renames the one
+// resource selected. Attachments to groups, roles and customer managed
+// policies that are neither in the files nor restored with the resource are
+// dropped with a warning, as push can't attach what doesn't exist
+func RestoreFromSnapshot(snapshot, files *AccountData, selector ResourceSelector, newName string) ([]AwsResource, Warnings, error) {
+	selected := snapshot.Select(selector)
+	if len(selected) == 0 {
+		return nil, nil, errors.Errorf("No resources in the snapshot match %s", selector)
+	}
+	if newName != "" && len(selected) > 1 {
+		return nil, nil, errors.Errorf("%s selects %d resources, only one can be restored under a new name", selector, len(selected))
+	}
+
+	restored := []AwsResource{}
+	for _, r := range selected {
+		r = copyResource(r)
+		if newName != "" {
+			if !renameResource(r, newName) {
+				return nil, nil, errors.Errorf("%s can't be restored under a new name", resourceKey(r))
+			}
+		}
+		if existing := conflictingResource(files, r); existing != nil {
+			return nil, nil, errors.Errorf("%s can't be restored as %s is in the files, restore it under a new name", resourceKey(r), resourceKey(existing))
+		}
+		restored = append(restored, r)
+	}
+
+	// the account once the resources are restored, to attach them to
+	target := NewAccountData(snapshot.Account.Id)
+	for _, r := range append(files.resources(), restored...) {
+		target.addResource(r)
+	}
+
+	warnings := Warnings{}
+	for _, r := range restored {
+		key := resourceKey(r)
+		groups := func(names []string) []string {
+			return keepAttachments(names, &warnings, key, "group", func(name string) bool {
+				for _, g := range target.Groups {
+					if g.Name == name {
+						return true
+					}
+				}
+				return false
+			})
+		}
+		roles := func(names []string) []string {
+			return keepAttachments(names, &warnings, key, "role", func(name string) bool {
+				for _, role := range target.Roles {
+					if role.Name == name {
+						return true
+					}
+				}
+				return false
+			})
+		}
+		policies := func(refs []string) []string {
+			return keepAttachments(refs, &warnings, key, "policy", func(ref string) bool {
+				if strings.HasPrefix(ref, "arn:") {
+					return true
+				}
+				for _, p := range target.Policies {
+					if strings.TrimPrefix(p.Path+p.Name, "/") == ref {
+						return true
+					}
+				}
+				return false
+			})
+		}
+		boundary := func(ref string) string {
+			if ref == "" {
+				return ""
+			}
+			if kept := policies([]string{ref}); len(kept) == 0 {
+				return ""
+			}
+			return ref
+		}
+
+		switch r := r.(type) {
+		case *User:
+			r.Groups = groups(r.Groups)
+			r.Policies = policies(r.Policies)
+			r.PermissionsBoundary = boundary(r.PermissionsBoundary)
+		case *Group:
+			r.Policies = policies(r.Policies)
+		case *Role:
+			r.Policies = policies(r.Policies)
+			r.PermissionsBoundary = boundary(r.PermissionsBoundary)
+		case *InstanceProfile:
+			r.Roles = roles(r.Roles)
+		}
+	}
+
+	return restored, warnings, nil
+}
+
+// keepAttachments returns the names that exist, adding a warning for each
+// that doesn't
+func keepAttachments(names []string, warnings *Warnings, key, resourceType string, exists func(string) bool) []string {
+	kept := []string{}
+	for _, name := range names {
+		if exists(name) {
+			kept = append(kept, name)
+		} else {
+			warnings.Add(WarningPlan, key, fmt.Sprintf("Not attaching %s %s, which no longer exists", resourceType, name))
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// conflictingResource returns the resource in data that r can't be created
+// alongside. IAM names are unique within an account whatever their path
+func conflictingResource(data *AccountData, r AwsResource) AwsResource {
+	for _, existing := range data.resources() {
+		if existing.Service() != r.Service() || existing.ResourceType() != r.ResourceType() || existing.ResourceName() != r.ResourceName() {
+			continue
+		}
+		if r.Service() == "iam" || existing.ResourcePath() == r.ResourcePath() {
+			return existing
+		}
+	}
+	return nil
+}
+
+// copyResource returns a copy of an IAM resource, which can be changed without
+// changing r. Other resources are returned as they are
+func copyResource(r AwsResource) AwsResource {
+	switch r := r.(type) {
+	case *User:
+		c := *r
+		return &c
+	case *Group:
+		c := *r
+		return &c
+	case *Role:
+		c := *r
+		return &c
+	case *Policy:
+		c := *r
+		return &c
+	case *InstanceProfile:
+		c := *r
+		return &c
+	}
+	return r
+}
+
+// renameResource renames an IAM resource, returning false for other
+// resources, whose names are fixed by what they're attached to
+func renameResource(r AwsResource, name string) bool {
+	switch r := r.(type) {
+	case *User:
+		r.Name = name
+	case *Group:
+		r.Name = name
+	case *Role:
+		r.Name = name
+	case *Policy:
+		r.Name = name
+	case *InstanceProfile:
+		r.Name = name
+	default:
+		return false
+	}
+	return true
+}
+
+// WriteResources writes the resources to the account's yaml files
+func (f *YamlLoadDumper) WriteResources(account *Account, resources []AwsResource) error {
+	for _, r := range resources {
+		if err := f.writeResource(account, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveResources removes the files of the resources from the account's
+// files, in either format. Resources a template generates have no file
+func (f *YamlLoadDumper) RemoveResources(account *Account, resources []AwsResource) error {
+	layout, err := f.layout()
+	if err != nil {
+		return err
+	}
+	for _, r := range resources {
+		if template, err := f.generatedBy(account, r); err != nil || template != "" {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for _, ext := range []string{".yaml", ".json"} {
+			file := filepath.Join(f.Dir, filepath.FromSlash(layout.file(account, r)+ext))
+			if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
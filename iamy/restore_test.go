@@ -0,0 +1,67 @@
+package iamy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRestoreFromSnapshot(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+
+	snapshot := NewAccountData("123")
+	snapshot.addRole(&Role{
+		iamService:               iamService{Name: "payments-deployer", Path: "/"},
+		AssumeRolePolicyDocument: doc,
+		Policies:                 []string{"arn:aws:iam::aws:policy/ReadOnlyAccess", "deploy", "team/payments"},
+		PermissionsBoundary:      "boundary",
+	})
+	snapshot.addUser(&User{
+		iamService: iamService{Name: "bob", Path: "/"},
+		Groups:     []string{"admins", "developers"},
+		Tags:       map[string]string{"team": "payments"},
+	})
+	files := NewAccountData("123")
+	files.addPolicy(&Policy{iamService: iamService{Name: "payments", Path: "/team/"}, Policy: doc})
+	files.addGroup(&Group{iamService: iamService{Name: "developers", Path: "/"}})
+
+	selector, _ := ParseResourceSelector("role/payments-deployer")
+	restored, warnings, err := RestoreFromSnapshot(snapshot, files, selector, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role := restored[0].(*Role)
+	if !reflect.DeepEqual(role.Policies, []string{"arn:aws:iam::aws:policy/ReadOnlyAccess", "team/payments"}) || role.PermissionsBoundary != "" {
+		t.Errorf("Expected attachments to deleted policies to be dropped, got %v %q", role.Policies, role.PermissionsBoundary)
+	}
+	if len(warnings) != 2 || warnings[0].Message != "Not attaching policy deploy, which no longer exists" {
+		t.Errorf("Expected a warning for each dropped attachment, got %v", warnings)
+	}
+	if len(snapshot.Roles[0].Policies) != 3 {
+		t.Errorf("Expected the snapshot to be unchanged, got %v", snapshot.Roles[0].Policies)
+	}
+
+	selector, _ = ParseResourceSelector("user/bob")
+	restored, _, err = RestoreFromSnapshot(snapshot, files, selector, "")
+	if user := restored[0].(*User); err != nil || !reflect.DeepEqual(user.Groups, []string{"developers"}) || user.Tags["team"] != "payments" {
+		t.Errorf("Expected bob to be restored with his tags to the groups that exist, got %+v %v", restored[0], err)
+	}
+
+	// bob's name has since been taken by a user on another path
+	files.addUser(&User{iamService: iamService{Name: "bob", Path: "/contractors/"}})
+	if _, _, err = RestoreFromSnapshot(snapshot, files, selector, ""); err == nil {
+		t.Errorf("Expected restoring over an existing user to fail")
+	}
+	restored, _, err = RestoreFromSnapshot(snapshot, files, selector, "bob-restored")
+	if err != nil || restored[0].ResourceName() != "bob-restored" || snapshot.Users[0].Name != "bob" {
+		t.Errorf("Expected bob to be restored under a new name, got %+v %v", restored, err)
+	}
+
+	selector, _ = ParseResourceSelector("role/*")
+	if _, _, err = RestoreFromSnapshot(snapshot, files, selector, ""); err != nil {
+		t.Errorf("Expected a pattern to restore every role it selects, got %v", err)
+	}
+	selector, _ = ParseResourceSelector("group/*")
+	if _, _, err = RestoreFromSnapshot(snapshot, files, selector, ""); err == nil {
+		t.Errorf("Expected restoring nothing to fail")
+	}
+}
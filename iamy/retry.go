@@ -0,0 +1,56 @@
+package iamy
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A RetryPolicy is how commands that fail because AWS throttled them are
+// retried, waiting a random time up to a delay that doubles with each retry
+type RetryPolicy struct {
+	// Retries is the most times to retry a command, or 0 for no retries
+	Retries int
+	// BaseDelay is the longest wait before the first retry
+	BaseDelay time.Duration
+	// MaxDelay is the longest wait before any retry
+	MaxDelay time.Duration
+}
+
+// delay returns the longest wait before the retry, counting from 0
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// runWithRetries runs the command, retrying it while AWS throttles it
+func (e Executor) runWithRetries(c Cmd) error {
+	sleep := e.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	for retry := 0; ; retry++ {
+		err := e.Run(c)
+		var throttled *ErrThrottled
+		if err == nil || retry >= e.Retry.Retries || !errors.As(err, &throttled) {
+			return err
+		}
+
+		wait := time.Duration(0)
+		if d := e.Retry.delay(retry); d > 0 {
+			wait = time.Duration(rand.Int63n(int64(d))) + 1
+		}
+		if e.OnRetry != nil {
+			e.OnRetry(c, err, wait)
+		}
+		sleep(wait)
+	}
+}
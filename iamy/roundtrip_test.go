@@ -0,0 +1,424 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+)
+
+// The round trip property: for any account, fetching it, dumping it to yaml,
+// loading the yaml and diffing against the fetched data must produce no
+// commands. A normaliser change that breaks this would make pull and push
+// disagree, so generated accounts exercise as many edge cases as possible.
+
+const roundTripIterations = 200
+
+var roundTripStrings = []string{
+	"", "a", "plain", "with space", "ünïcödé", "日本語", "🔐", "quote'd", `double"quoted`,
+	"colon: value", "- dash", "# hash", "yes", "no", "null", "~", "true", "0123", "1e3",
+	"{braces}", "[brackets]", "multi\nline", "tab\there", "trailing ",
+}
+
+const nameAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789+=,.@_-"
+
+type roundTripGenerator struct {
+	*rand.Rand
+}
+
+func (g roundTripGenerator) name() string {
+	b := make([]byte, 1+g.Intn(20))
+	for i := range b {
+		b[i] = nameAlphabet[g.Intn(len(nameAlphabet))]
+	}
+	return "n" + string(b)
+}
+
+func (g roundTripGenerator) path() string {
+	switch g.Intn(3) {
+	case 0:
+		return "/"
+	case 1:
+		return "/" + g.name() + "/"
+	}
+	return "/" + g.name() + "/" + g.name() + "/"
+}
+
+func (g roundTripGenerator) str() string {
+	return roundTripStrings[g.Intn(len(roundTripStrings))]
+}
+
+// stringOrList randomly generates the single string and array forms AWS accepts
+func (g roundTripGenerator) stringOrList(prefix string) interface{} {
+	switch g.Intn(3) {
+	case 0:
+		return prefix + g.str()
+	case 1:
+		return []interface{}{prefix + g.str()}
+	}
+	l := []interface{}{}
+	for i := g.Intn(4); i >= 0; i-- {
+		l = append(l, prefix+g.str())
+	}
+	return l
+}
+
+func (g roundTripGenerator) condition() map[string]interface{} {
+	c := map[string]interface{}{}
+	for i := g.Intn(3); i >= 0; i-- {
+		op := []string{"StringEquals", "StringLike", "ForAnyValue:StringEquals", "Bool", "NumericLessThan"}[g.Intn(5)]
+		inner, ok := c[op].(map[string]interface{})
+		if !ok {
+			inner = map[string]interface{}{}
+			c[op] = inner
+		}
+		switch op {
+		case "Bool":
+			inner["aws:MultiFactorAuthPresent"] = g.Intn(2) == 0
+		case "NumericLessThan":
+			inner["aws:MultiFactorAuthAge"] = float64(g.Intn(100000))
+		default:
+			inner["aws:PrincipalTag/"+g.name()] = g.stringOrList("")
+		}
+	}
+	return c
+}
+
+func (g roundTripGenerator) policyDocument() *PolicyDocument {
+	statements := []interface{}{}
+	for i := g.Intn(4); i > 0; i-- {
+		s := map[string]interface{}{
+			"Effect":   []string{"Allow", "Deny"}[g.Intn(2)],
+			"Action":   g.stringOrList("s3:"),
+			"Resource": g.stringOrList("arn:aws:s3:::"),
+		}
+		if g.Intn(2) == 0 {
+			s["Sid"] = g.name()
+		}
+		if g.Intn(2) == 0 {
+			s["Condition"] = g.condition()
+		}
+		if g.Intn(3) == 0 {
+			s["Principal"] = map[string]interface{}{"AWS": g.stringOrList("arn:aws:iam::123456789012:")}
+		}
+		statements = append(statements, s)
+	}
+
+	doc := map[string]interface{}{"Statement": statements}
+	if g.Intn(4) != 0 {
+		doc["Version"] = "2012-10-17"
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		panic(err)
+	}
+	p, err := NewPolicyDocumentFromJson(string(b))
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (g roundTripGenerator) encodedPolicyDocument() *string {
+	return aws.String(url.QueryEscape(g.policyDocument().JsonString()))
+}
+
+func (g roundTripGenerator) inlinePolicies() []*iam.PolicyDetail {
+	var pp []*iam.PolicyDetail
+	seen := map[string]bool{}
+	for i := g.Intn(3); i > 0; i-- {
+		name := g.name()
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		pp = append(pp, &iam.PolicyDetail{PolicyName: aws.String(name), PolicyDocument: g.encodedPolicyDocument()})
+	}
+	return pp
+}
+
+func (g roundTripGenerator) tags() []*iam.Tag {
+	var tt []*iam.Tag
+	for i := g.Intn(3); i > 0; i-- {
+		tt = append(tt, &iam.Tag{Key: aws.String(g.name()), Value: aws.String(g.str())})
+	}
+	return tt
+}
+
+func (g roundTripGenerator) attachedPolicies(policyArns []string) []*iam.AttachedPolicy {
+	var pp []*iam.AttachedPolicy
+	seen := map[string]bool{}
+	for i := g.Intn(3); i > 0 && len(policyArns) > 0; i-- {
+		arn := policyArns[g.Intn(len(policyArns))]
+		if seen[arn] {
+			continue
+		}
+		seen[arn] = true
+		pp = append(pp, &iam.AttachedPolicy{PolicyArn: aws.String(arn)})
+	}
+	return pp
+}
+
+func (g roundTripGenerator) permissionsBoundary(policyArns []string) *iam.AttachedPermissionsBoundary {
+	if g.Intn(2) == 0 {
+		return nil
+	}
+	return &iam.AttachedPermissionsBoundary{
+		PermissionsBoundaryArn:  aws.String(policyArns[g.Intn(len(policyArns))]),
+		PermissionsBoundaryType: aws.String(iam.PermissionsBoundaryAttachmentTypePermissionsBoundaryPolicy),
+	}
+}
+
+// authorizationDetails generates a response as returned by GetAccountAuthorizationDetails
+func (g roundTripGenerator) authorizationDetails(account *Account) *iam.GetAccountAuthorizationDetailsOutput {
+	resp := &iam.GetAccountAuthorizationDetailsOutput{}
+	policyArns := []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}
+
+	for i := g.Intn(4); i > 0; i-- {
+		name, path := g.name(), g.path()
+		resp.Policies = append(resp.Policies, &iam.ManagedPolicyDetail{
+			Arn:        aws.String(account.arnFor("policy", path, name)),
+			PolicyName: aws.String(name),
+			Path:       aws.String(path),
+			PolicyVersionList: []*iam.PolicyVersion{{
+				VersionId:        aws.String("v1"),
+				IsDefaultVersion: aws.Bool(true),
+				CreateDate:       aws.Time(time.Unix(0, 0)),
+				Document:         g.encodedPolicyDocument(),
+			}},
+		})
+		policyArns = append(policyArns, *resp.Policies[len(resp.Policies)-1].Arn)
+	}
+
+	groupNames := []string{}
+	for i := g.Intn(4); i > 0; i-- {
+		name := g.name()
+		groupNames = append(groupNames, name)
+		resp.GroupDetailList = append(resp.GroupDetailList, &iam.GroupDetail{
+			GroupName:               aws.String(name),
+			Path:                    aws.String(g.path()),
+			GroupPolicyList:         g.inlinePolicies(),
+			AttachedManagedPolicies: g.attachedPolicies(policyArns),
+		})
+	}
+
+	for i := g.Intn(4); i > 0; i-- {
+		user := &iam.UserDetail{
+			UserName:                aws.String(g.name()),
+			Path:                    aws.String(g.path()),
+			UserPolicyList:          g.inlinePolicies(),
+			AttachedManagedPolicies: g.attachedPolicies(policyArns),
+			PermissionsBoundary:     g.permissionsBoundary(policyArns),
+			Tags:                    g.tags(),
+		}
+		for _, group := range groupNames {
+			if g.Intn(2) == 0 {
+				user.GroupList = append(user.GroupList, aws.String(group))
+			}
+		}
+		resp.UserDetailList = append(resp.UserDetailList, user)
+	}
+
+	for i := g.Intn(4); i > 0; i-- {
+		resp.RoleDetailList = append(resp.RoleDetailList, &iam.RoleDetail{
+			RoleName:                 aws.String(g.name()),
+			Path:                     aws.String(g.path()),
+			AssumeRolePolicyDocument: g.encodedPolicyDocument(),
+			RolePolicyList:           g.inlinePolicies(),
+			AttachedManagedPolicies:  g.attachedPolicies(policyArns),
+			PermissionsBoundary:      g.permissionsBoundary(policyArns),
+		})
+	}
+
+	return resp
+}
+
+func (g roundTripGenerator) publicAccessBlock() *PublicAccessBlock {
+	return &PublicAccessBlock{
+		BlockPublicAcls:       g.Intn(2) == 0,
+		IgnorePublicAcls:      g.Intn(2) == 0,
+		BlockPublicPolicy:     g.Intn(2) == 0,
+		RestrictPublicBuckets: g.Intn(2) == 0,
+	}
+}
+
+func (g roundTripGenerator) bucketAcl() *BucketAcl {
+	grants := []BucketGrant{}
+	for i := g.Intn(3); i >= 0; i-- {
+		grantee := []string{allUsersGroupUri, logDeliveryGroupUri, "id=" + g.name()}[g.Intn(3)]
+		grants = append(grants, BucketGrant{Grantee: grantee, Permission: []string{"READ", "WRITE", "READ_ACP"}[g.Intn(3)]})
+	}
+	return newBucketAcl(grants)
+}
+
+type noTagsTaggingAPI struct {
+	resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI
+}
+
+func (noTagsTaggingAPI) GetResources(*resourcegroupstaggingapi.GetResourcesInput) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
+	return &resourcegroupstaggingapi.GetResourcesOutput{}, nil
+}
+
+func fetchGeneratedAccount(g roundTripGenerator) (*AccountData, error) {
+	account := &Account{Id: "123456789012", Alias: "roundtrip"}
+	f := AwsFetcher{
+		SkipFetchingPolicyAndRoleDescriptions: true,
+		cfn:                                   &cfnClient{},
+		tagging:                               &resourceGroupsTaggingAPIClient{noTagsTaggingAPI{}},
+		account:                               account,
+		data:                                  AccountData{Account: account},
+	}
+
+	if err := f.populateIamData(g.authorizationDetails(account)); err != nil {
+		return nil, err
+	}
+
+	for i := g.Intn(3); i > 0; i-- {
+		bp := &BucketPolicy{BucketName: g.name()}
+		if g.Intn(3) != 0 {
+			bp.Policy = g.policyDocument()
+		}
+		if bp.Policy == nil || g.Intn(2) == 0 {
+			bp.PublicAccessBlock = g.publicAccessBlock()
+		}
+		if g.Intn(3) == 0 {
+			bp.Acl = g.bucketAcl()
+		}
+		for _, t := range g.tags() {
+			if bp.Tags == nil {
+				bp.Tags = map[string]string{}
+			}
+			bp.Tags[*t.Key] = *t.Value
+		}
+		f.data.addBucketPolicy(bp)
+	}
+	for i := g.Intn(3); i > 0; i-- {
+		ap := &AccessPoint{Region: []string{"us-east-1", "ap-southeast-2"}[g.Intn(2)], Name: g.name(), Bucket: g.name()}
+		if g.Intn(2) == 0 {
+			ap.VpcId = "vpc-" + g.name()
+		}
+		if g.Intn(2) == 0 {
+			ap.Policy = g.policyDocument()
+		}
+		f.data.addAccessPoint(ap)
+	}
+	for i := g.Intn(3); i > 0; i-- {
+		ap := &ObjectLambdaAccessPoint{Region: []string{"us-east-1", "ap-southeast-2"}[g.Intn(2)], Name: g.name()}
+		ap.Configuration.SupportingAccessPoint = "arn:aws:s3:" + ap.Region + ":" + account.Id + ":accesspoint/" + g.name()
+		ap.Configuration.CloudWatchMetricsEnabled = g.Intn(2) == 0
+		if g.Intn(2) == 0 {
+			ap.Configuration.AllowedFeatures = []string{"GetObject-Range", "GetObject-PartNumber"}
+		}
+		for j := g.Intn(2) + 1; j > 0; j-- {
+			t := ObjectLambdaTransformationConfiguration{Actions: []string{"GetObject", "HeadObject"}[:g.Intn(2)+1]}
+			t.ContentTransformation.AwsLambda.FunctionArn = "arn:aws:lambda:" + ap.Region + ":" + account.Id + ":function:" + g.name()
+			if g.Intn(2) == 0 {
+				t.ContentTransformation.AwsLambda.FunctionPayload = g.str()
+			}
+			ap.Configuration.TransformationConfigurations = append(ap.Configuration.TransformationConfigurations, t)
+		}
+		if g.Intn(2) == 0 {
+			ap.Policy = g.policyDocument()
+		}
+		f.data.addObjectLambdaAccessPoint(ap)
+	}
+	for i := g.Intn(3); i > 0; i-- {
+		ap := &MultiRegionAccessPoint{Name: g.name()}
+		for j := g.Intn(3) + 1; j > 0; j-- {
+			ap.Regions = append(ap.Regions, MultiRegionAccessPointRegion{Bucket: g.name(), Region: []string{"us-east-1", "ap-southeast-2"}[g.Intn(2)]})
+		}
+		if g.Intn(2) == 0 {
+			ap.PublicAccessBlock = g.publicAccessBlock()
+		}
+		if g.Intn(2) == 0 {
+			ap.Policy = g.policyDocument()
+		}
+		f.data.addMultiRegionAccessPoint(ap)
+	}
+	for i := g.Intn(3); i > 0; i-- {
+		p := &GlacierVaultPolicy{Region: []string{"us-east-1", "ap-southeast-2"}[g.Intn(2)], VaultName: g.name()}
+		if g.Intn(3) != 0 {
+			p.Policy = g.policyDocument()
+		}
+		if p.Policy == nil || g.Intn(2) == 0 {
+			p.LockPolicy = g.policyDocument()
+			p.LockState = []string{"Locked", "InProgress"}[g.Intn(2)]
+		}
+		f.data.addGlacierVaultPolicy(p)
+	}
+	for _, region := range []string{"us-east-1", "ap-southeast-2"} {
+		if g.Intn(2) == 0 {
+			f.data.addEcrRegistryPolicy(&EcrRegistryPolicy{Region: region, Policy: g.policyDocument()})
+		}
+	}
+	if g.Intn(2) == 0 {
+		f.data.AccountPublicAccessBlock = &AccountPublicAccessBlock{*g.publicAccessBlock()}
+	}
+	f.data.SortCanonically()
+
+	return &f.data, nil
+}
+
+func TestFetchDumpLoadRoundTripProperty(t *testing.T) {
+	for seed := int64(0); seed < roundTripIterations; seed++ {
+		g := roundTripGenerator{rand.New(rand.NewSource(seed))}
+
+		fetched, err := fetchGeneratedAccount(g)
+		if err != nil {
+			t.Fatalf("seed %d: error populating generated account: %s", seed, err)
+		}
+
+		dir, err := ioutil.TempDir("", "roundtriptest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		y := YamlLoadDumper{Dir: dir}
+		if err = y.Dump(fetched, false); err != nil {
+			t.Fatalf("seed %d: error dumping: %s", seed, err)
+		}
+		loaded, err := y.Load()
+		if err != nil {
+			t.Fatalf("seed %d: error loading: %s", seed, err)
+		}
+		if len(loaded) != 1 {
+			t.Fatalf("seed %d: expected 1 account to be loaded, got %d", seed, len(loaded))
+		}
+
+		if cmds := AwsCliCmdsForSync(fetched, &loaded[0]); len(cmds) > 0 {
+			t.Errorf("seed %d: expected no changes after a round trip, got:\n%s", seed, cmds)
+		}
+
+		// dumping what we loaded must not change any files, so fmt is stable
+		before := readDir(dir)
+		if err = y.Dump(&loaded[0], false); err != nil {
+			t.Fatalf("seed %d: error dumping: %s", seed, err)
+		}
+		if after := readDir(dir); !reflect.DeepEqual(before, after) {
+			t.Errorf("seed %d: expected dumping loaded data to be stable\n%s", seed, describeDirDifference(before, after))
+		}
+
+		os.RemoveAll(dir)
+	}
+}
+
+func describeDirDifference(before, after map[string][]byte) string {
+	diffs := []string{}
+	for name, b := range before {
+		if a, ok := after[name]; !ok || string(a) != string(b) {
+			diffs = append(diffs, fmt.Sprintf("%s:\n%s\n---\n%s", name, b, a))
+		}
+	}
+	return strings.Join(diffs, "\n")
+}
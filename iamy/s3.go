@@ -1,7 +1,7 @@
 package iamy
 
 import (
-	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -9,11 +9,13 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/pkg/errors"
 )
 
 const NoSuchBucketPolicyErrCode = "NoSuchBucketPolicy"
 const NoSuchTagSetErrCode = "NoSuchTagSet"
+const NoSuchPublicAccessBlockConfigurationErrCode = "NoSuchPublicAccessBlockConfiguration"
 
 func newRegionClientMap(s *session.Session) *regionClientMap {
 	return &regionClientMap{
@@ -35,10 +37,10 @@ func (scm *regionClientMap) add(c *s3.S3) {
 
 func (scm *regionClientMap) getOrCreate(region string) s3iface.S3API {
 	scm.mutex.Lock()
+	defer scm.mutex.Unlock()
 	if _, ok := scm.clients[region]; !ok {
 		scm.clients[region] = s3.New(scm.sess, aws.NewConfig().WithRegion(region))
 	}
-	scm.mutex.Unlock()
 
 	return scm.clients[region]
 }
@@ -46,6 +48,7 @@ func (scm *regionClientMap) getOrCreate(region string) s3iface.S3API {
 type s3Client struct {
 	s3iface.S3API
 	regionClients *regionClientMap
+	timings       *Timings
 }
 
 func newS3Client(s *session.Session) *s3Client {
@@ -60,10 +63,12 @@ func newS3Client(s *session.Session) *s3Client {
 }
 
 type bucket struct {
-	name       string
-	policyJson string
-	exists     bool
-	tags       map[string]string
+	name              string
+	policyJson        string
+	publicAccessBlock *PublicAccessBlock
+	acl               *BucketAcl
+	exists            bool
+	tags              map[string]string
 }
 
 func (c *s3Client) withRegion(region string) s3iface.S3API {
@@ -81,14 +86,34 @@ func normaliseString(a *string) (b string) {
 	return
 }
 
+// maxConcurrentBucketFetches bounds how many buckets have their details
+// fetched at once, so accounts with thousands of buckets aren't throttled
+const maxConcurrentBucketFetches = 20
+
+// bucketRegion returns the region a bucket is in. GetBucketLocation can fail
+// when the bucket is in a different region to the session (eg. opt-in
+// regions), in which case the region S3 redirects to is used instead
+func (c *s3Client) bucketRegion(name string) (string, error) {
+	r, err := c.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: aws.String(name)})
+	if err == nil {
+		return s3.NormalizeBucketLocation(normaliseString(r.LocationConstraint)), nil
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case "AuthorizationHeaderMalformed", "PermanentRedirect", "IllegalLocationConstraintException":
+			return s3manager.GetBucketRegionWithClient(aws.BackgroundContext(), c.S3API, name)
+		}
+	}
+	return "", err
+}
+
 func (c *s3Client) populateBucket(b *bucket) error {
-	r, err := c.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: aws.String(b.name)})
+	region, err := c.bucketRegion(b.name)
 	if err != nil {
 		return err
 	}
 
-	region := s3.NormalizeBucketLocation(normaliseString(r.LocationConstraint))
-
 	tags, err := c.fetchTags(b.name, region)
 	if err != nil {
 		return err
@@ -96,38 +121,67 @@ func (c *s3Client) populateBucket(b *bucket) error {
 	b.tags = tags
 
 	b.policyJson, err = c.GetBucketPolicyDoc(b.name, region)
+	if err != nil {
+		return err
+	}
+
+	b.publicAccessBlock, err = c.getPublicAccessBlock(b.name, region)
+	if err != nil {
+		return err
+	}
+
+	b.acl, err = c.getBucketAcl(b.name, region)
 
 	return err
 }
 
-func (c *s3Client) listAllBuckets() ([]*bucket, error) {
+// listAllBuckets returns the buckets in the account that include returns true
+// for, and the canonical user id of the account that owns them
+func (c *s3Client) listAllBuckets(include func(name string) bool) ([]*bucket, string, error) {
+	stop := c.timings.Track("s3 list buckets")
 	bucketListResp, err := c.ListBuckets(&s3.ListBucketsInput{})
+	stop()
 	if err != nil {
-		return nil, errors.Wrap(err, "Error while calling ListBuckets")
+		return nil, "", errors.Wrap(err, "Error while calling ListBuckets")
 	}
 
-	var wg sync.WaitGroup
-	var oneOfTheErrorsDuringPopulation error
 	buckets := []*bucket{}
-
 	for _, rb := range bucketListResp.Buckets {
-		b := bucket{name: *rb.Name}
-		b.exists = true
-		buckets = append(buckets, &b)
+		if include(*rb.Name) {
+			buckets = append(buckets, &bucket{name: *rb.Name, exists: true})
+		}
+	}
 
+	var wg sync.WaitGroup
+	var errMutex sync.Mutex
+	var oneOfTheErrorsDuringPopulation error
+	queue := make(chan *bucket)
+
+	for i := 0; i < maxConcurrentBucketFetches && i < len(buckets); i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := c.populateBucket(&b)
-			if err != nil {
-				if awsErr, ok := err.(awserr.Error); ok {
-					if awsErr.Code() != s3.ErrCodeNoSuchBucket {
-						oneOfTheErrorsDuringPopulation = errors.New(fmt.Sprintf("Error while getting details for S3 bucket %s: %s", b.name, err))
+			for b := range queue {
+				stop := c.timings.Track("s3 bucket details")
+				err := c.populateBucket(b)
+				stop()
+				if err != nil {
+					// buckets deleted since they were listed are ignored
+					if awsErr, ok := errors.Cause(err).(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchBucket {
+						b.exists = false
+						continue
 					}
+					errMutex.Lock()
+					oneOfTheErrorsDuringPopulation = errors.Wrapf(err, "Error while getting details for S3 bucket %s", b.name)
+					errMutex.Unlock()
 				}
 			}
 		}()
 	}
+	for _, b := range buckets {
+		queue <- b
+	}
+	close(queue)
 	wg.Wait()
 
 	bucketsExist := []*bucket{}
@@ -139,10 +193,15 @@ func (c *s3Client) listAllBuckets() ([]*bucket, error) {
 	}
 
 	if oneOfTheErrorsDuringPopulation != nil {
-		return nil, oneOfTheErrorsDuringPopulation
+		return nil, "", oneOfTheErrorsDuringPopulation
+	}
+
+	ownerId := ""
+	if bucketListResp.Owner != nil {
+		ownerId = aws.StringValue(bucketListResp.Owner.ID)
 	}
 
-	return bucketsExist, nil
+	return bucketsExist, ownerId, nil
 }
 
 func (c *s3Client) GetBucketPolicyDoc(name, region string) (string, error) {
@@ -156,12 +215,78 @@ func (c *s3Client) GetBucketPolicyDoc(name, region string) (string, error) {
 				return "", nil
 			}
 		}
-		return "", fmt.Errorf("GetBucketPolicyDoc for %s: %s", name, err.Error())
+		return "", errors.Wrapf(err, "GetBucketPolicyDoc for %s", name)
 	}
 
 	return *resp.Policy, nil
 }
 
+// getPublicAccessBlock returns the bucket's Block Public Access configuration,
+// or nil if it has none
+func (c *s3Client) getPublicAccessBlock(name, region string) (*PublicAccessBlock, error) {
+	clientForRegion := c.withRegion(region)
+	resp, err := clientForRegion.GetPublicAccessBlock(&s3.GetPublicAccessBlockInput{
+		Bucket: aws.String(name),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok {
+			if awsErr.Code() == NoSuchPublicAccessBlockConfigurationErrCode {
+				return nil, nil
+			}
+		}
+		return nil, errors.Wrapf(err, "GetPublicAccessBlock for %s", name)
+	}
+
+	conf := resp.PublicAccessBlockConfiguration
+	return &PublicAccessBlock{
+		BlockPublicAcls:       aws.BoolValue(conf.BlockPublicAcls),
+		IgnorePublicAcls:      aws.BoolValue(conf.IgnorePublicAcls),
+		BlockPublicPolicy:     aws.BoolValue(conf.BlockPublicPolicy),
+		RestrictPublicBuckets: aws.BoolValue(conf.RestrictPublicBuckets),
+	}, nil
+}
+
+// getBucketAcl returns the bucket's ACL, or nil if the bucket is private
+func (c *s3Client) getBucketAcl(name, region string) (*BucketAcl, error) {
+	clientForRegion := c.withRegion(region)
+	resp, err := clientForRegion.GetBucketAcl(&s3.GetBucketAclInput{
+		Bucket: aws.String(name),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetBucketAcl for %s", name)
+	}
+
+	ownerId := ""
+	if resp.Owner != nil {
+		ownerId = aws.StringValue(resp.Owner.ID)
+	}
+
+	grants := []BucketGrant{}
+	for _, g := range resp.Grants {
+		grantee := bucketGranteeString(g.Grantee)
+		permission := aws.StringValue(g.Permission)
+		if grantee == "id="+ownerId && permission == s3.PermissionFullControl {
+			continue
+		}
+		grants = append(grants, BucketGrant{Grantee: grantee, Permission: permission})
+	}
+
+	return newBucketAcl(grants), nil
+}
+
+func bucketGranteeString(g *s3.Grantee) string {
+	if g == nil {
+		return ""
+	}
+	switch aws.StringValue(g.Type) {
+	case s3.TypeGroup:
+		return "uri=" + aws.StringValue(g.URI)
+	case s3.TypeAmazonCustomerByEmail:
+		return "emailAddress=" + aws.StringValue(g.EmailAddress)
+	}
+	return "id=" + aws.StringValue(g.ID)
+}
+
 func (c *s3Client) fetchTags(name, region string) (map[string]string, error) {
 	tags := make(map[string]string)
 	clientForRegion := c.withRegion(region)
@@ -181,3 +306,35 @@ func (c *s3Client) fetchTags(name, region string) (map[string]string, error) {
 	}
 	return tags, nil
 }
+
+// systemTags returns the aws: prefixed tags AWS adds, or nil if there are none
+func systemTags(tags map[string]string) map[string]string {
+	var result map[string]string
+	for k, v := range tags {
+		if !strings.HasPrefix(k, "aws:") {
+			continue
+		}
+		if result == nil {
+			result = map[string]string{}
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// userTags returns the tags without the aws: prefixed ones AWS adds, eg. for
+// CloudFormation stacks, which can't be set by users. Returns nil if there are
+// none left
+func userTags(tags map[string]string) map[string]string {
+	var result map[string]string
+	for k, v := range tags {
+		if strings.HasPrefix(k, "aws:") {
+			continue
+		}
+		if result == nil {
+			result = map[string]string{}
+		}
+		result[k] = v
+	}
+	return result
+}
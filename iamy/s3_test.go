@@ -0,0 +1,139 @@
+package iamy
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// regionalS3 answers for the buckets in its region, and redirects requests
+// for buckets in other regions like S3 does
+type regionalS3 struct {
+	s3iface.S3API
+	region   string
+	buckets  map[string]string
+	deleted  map[string]bool
+	inFlight *int32
+	maxSeen  *int32
+}
+
+func (c regionalS3) check(bucket *string) error {
+	n := atomic.AddInt32(c.inFlight, 1)
+	defer atomic.AddInt32(c.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(c.maxSeen)
+		if n <= max || atomic.CompareAndSwapInt32(c.maxSeen, max, n) {
+			break
+		}
+	}
+
+	name := aws.StringValue(bucket)
+	if c.deleted[name] {
+		return awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil)
+	}
+	if c.buckets[name] != c.region {
+		return awserr.New("PermanentRedirect", "The bucket you are attempting to access must be addressed using the specified endpoint", nil)
+	}
+	return nil
+}
+
+func (c regionalS3) ListBuckets(*s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+	out := &s3.ListBucketsOutput{Owner: &s3.Owner{ID: aws.String("owner")}}
+	for _, name := range sortedKeys(c.buckets) {
+		out.Buckets = append(out.Buckets, &s3.Bucket{Name: aws.String(name)})
+	}
+	return out, nil
+}
+
+func (c regionalS3) GetBucketLocation(in *s3.GetBucketLocationInput) (*s3.GetBucketLocationOutput, error) {
+	if c.deleted[aws.StringValue(in.Bucket)] {
+		return nil, awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil)
+	}
+	// buckets in us-east-1 have no location constraint
+	region := c.buckets[aws.StringValue(in.Bucket)]
+	if region == "us-east-1" {
+		region = ""
+	}
+	return &s3.GetBucketLocationOutput{LocationConstraint: aws.String(region)}, nil
+}
+
+func (c regionalS3) GetBucketTagging(in *s3.GetBucketTaggingInput) (*s3.GetBucketTaggingOutput, error) {
+	if err := c.check(in.Bucket); err != nil {
+		return nil, err
+	}
+	return nil, awserr.New(NoSuchTagSetErrCode, "The TagSet does not exist", nil)
+}
+
+func (c regionalS3) GetBucketPolicy(in *s3.GetBucketPolicyInput) (*s3.GetBucketPolicyOutput, error) {
+	if err := c.check(in.Bucket); err != nil {
+		return nil, err
+	}
+	return &s3.GetBucketPolicyOutput{Policy: aws.String(`{"Version":"2012-10-17"}`)}, nil
+}
+
+func (c regionalS3) GetPublicAccessBlock(in *s3.GetPublicAccessBlockInput) (*s3.GetPublicAccessBlockOutput, error) {
+	if err := c.check(in.Bucket); err != nil {
+		return nil, err
+	}
+	return nil, awserr.New(NoSuchPublicAccessBlockConfigurationErrCode, "The public access block configuration was not found", nil)
+}
+
+func (c regionalS3) GetBucketAcl(in *s3.GetBucketAclInput) (*s3.GetBucketAclOutput, error) {
+	if err := c.check(in.Bucket); err != nil {
+		return nil, err
+	}
+	return &s3.GetBucketAclOutput{Owner: &s3.Owner{ID: aws.String("owner")}}, nil
+}
+
+func TestListAllBucketsUsesBucketRegions(t *testing.T) {
+	buckets := map[string]string{}
+	for i := 0; i < 50; i++ {
+		buckets[fmt.Sprintf("bucket-%02d", i)] = []string{"us-east-1", "ap-southeast-2", "eu-west-1"}[i%3]
+	}
+	deleted := map[string]bool{"bucket-07": true}
+
+	var inFlight, maxSeen int32
+	regional := func(region string) regionalS3 {
+		return regionalS3{region: region, buckets: buckets, deleted: deleted, inFlight: &inFlight, maxSeen: &maxSeen}
+	}
+	c := &s3Client{
+		S3API: regional("us-east-1"),
+		regionClients: &regionClientMap{
+			clients: map[string]s3iface.S3API{
+				"us-east-1":      regional("us-east-1"),
+				"ap-southeast-2": regional("ap-southeast-2"),
+				"eu-west-1":      regional("eu-west-1"),
+			},
+			mutex: &sync.Mutex{},
+		},
+	}
+
+	result, ownerId, err := c.listAllBuckets(func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ownerId != "owner" {
+		t.Errorf("Expected owner id owner, got %s", ownerId)
+	}
+	if len(result) != 49 {
+		t.Errorf("Expected 49 buckets, got %d", len(result))
+	}
+	for _, b := range result {
+		if b.name == "bucket-07" {
+			t.Errorf("Expected the deleted bucket to be excluded")
+		}
+		if b.policyJson == "" {
+			t.Errorf("Expected %s to have its policy fetched from its region", b.name)
+		}
+	}
+	if maxSeen > maxConcurrentBucketFetches {
+		t.Errorf("Expected at most %d concurrent requests, saw %d", maxConcurrentBucketFetches, maxSeen)
+	}
+}
@@ -0,0 +1,254 @@
+package iamy
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3control"
+	"github.com/aws/aws-sdk-go/service/s3control/s3controliface"
+)
+
+const NoSuchAccessPointPolicyErrCode = "NoSuchAccessPointPolicy"
+
+type s3ControlClient struct {
+	s3controliface.S3ControlAPI
+	sess    *session.Session
+	clients map[string]s3controliface.S3ControlAPI
+	mutex   sync.Mutex
+}
+
+func newS3ControlClient(sess *session.Session) *s3ControlClient {
+	return &s3ControlClient{
+		S3ControlAPI: s3control.New(sess),
+		sess:         sess,
+		clients:      map[string]s3controliface.S3ControlAPI{},
+	}
+}
+
+// Access points and Object Lambda Access Points are regional, unlike the account's Block Public Access configuration
+func (c *s3ControlClient) withRegion(region string) s3controliface.S3ControlAPI {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.clients[region]; !ok {
+		c.clients[region] = s3control.New(c.sess, aws.NewConfig().WithRegion(region))
+	}
+
+	return c.clients[region]
+}
+
+// getAccountPublicAccessBlock returns the account's Block Public Access
+// configuration, or nil if it has none
+func (c *s3ControlClient) getAccountPublicAccessBlock(accountId string) (*PublicAccessBlock, error) {
+	resp, err := c.GetPublicAccessBlock(&s3control.GetPublicAccessBlockInput{
+		AccountId: aws.String(accountId),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok {
+			if awsErr.Code() == s3control.ErrCodeNoSuchPublicAccessBlockConfiguration {
+				return nil, nil
+			}
+		}
+		return nil, err
+	}
+
+	conf := resp.PublicAccessBlockConfiguration
+	return &PublicAccessBlock{
+		BlockPublicAcls:       aws.BoolValue(conf.BlockPublicAcls),
+		IgnorePublicAcls:      aws.BoolValue(conf.IgnorePublicAcls),
+		BlockPublicPolicy:     aws.BoolValue(conf.BlockPublicPolicy),
+		RestrictPublicBuckets: aws.BoolValue(conf.RestrictPublicBuckets),
+	}, nil
+}
+
+type accessPoint struct {
+	name       string
+	bucket     string
+	vpcId      string
+	policyJson string
+}
+
+func (c *s3ControlClient) listAccessPoints(accountId, region string) ([]*accessPoint, error) {
+	client := c.withRegion(region)
+	accessPoints := []*accessPoint{}
+	err := client.ListAccessPointsPages(&s3control.ListAccessPointsInput{AccountId: aws.String(accountId)},
+		func(resp *s3control.ListAccessPointsOutput, lastPage bool) bool {
+			for _, item := range resp.AccessPointList {
+				ap := accessPoint{
+					name:   aws.StringValue(item.Name),
+					bucket: aws.StringValue(item.Bucket),
+				}
+				if item.VpcConfiguration != nil {
+					ap.vpcId = aws.StringValue(item.VpcConfiguration.VpcId)
+				}
+				accessPoints = append(accessPoints, &ap)
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ap := range accessPoints {
+		resp, err := client.GetAccessPointPolicy(&s3control.GetAccessPointPolicyInput{
+			AccountId: aws.String(accountId),
+			Name:      aws.String(ap.name),
+		})
+		if err != nil {
+			if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == NoSuchAccessPointPolicyErrCode {
+				continue
+			}
+			return nil, err
+		}
+		ap.policyJson = aws.StringValue(resp.Policy)
+	}
+
+	return accessPoints, nil
+}
+
+type objectLambdaAccessPoint struct {
+	name          string
+	configuration ObjectLambdaConfiguration
+	policyJson    string
+}
+
+func (c *s3ControlClient) listObjectLambdaAccessPoints(accountId, region string) ([]*objectLambdaAccessPoint, error) {
+	client := c.withRegion(region)
+	accessPoints := []*objectLambdaAccessPoint{}
+	err := client.ListAccessPointsForObjectLambdaPages(&s3control.ListAccessPointsForObjectLambdaInput{AccountId: aws.String(accountId)},
+		func(resp *s3control.ListAccessPointsForObjectLambdaOutput, lastPage bool) bool {
+			for _, item := range resp.ObjectLambdaAccessPointList {
+				accessPoints = append(accessPoints, &objectLambdaAccessPoint{name: aws.StringValue(item.Name)})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ap := range accessPoints {
+		conf, err := client.GetAccessPointConfigurationForObjectLambda(&s3control.GetAccessPointConfigurationForObjectLambdaInput{
+			AccountId: aws.String(accountId),
+			Name:      aws.String(ap.name),
+		})
+		if err != nil {
+			return nil, err
+		}
+		ap.configuration = newObjectLambdaConfiguration(conf.Configuration)
+
+		resp, err := client.GetAccessPointPolicyForObjectLambda(&s3control.GetAccessPointPolicyForObjectLambdaInput{
+			AccountId: aws.String(accountId),
+			Name:      aws.String(ap.name),
+		})
+		if err != nil {
+			if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == NoSuchAccessPointPolicyErrCode {
+				continue
+			}
+			return nil, err
+		}
+		ap.policyJson = aws.StringValue(resp.Policy)
+	}
+
+	return accessPoints, nil
+}
+
+// multiRegionControlRegion is the region Multi-Region Access Point requests
+// must be sent to
+const multiRegionControlRegion = "us-west-2"
+
+type multiRegionAccessPoint struct {
+	name              string
+	regions           []MultiRegionAccessPointRegion
+	publicAccessBlock *PublicAccessBlock
+	policyJson        string
+}
+
+func (c *s3ControlClient) listMultiRegionAccessPoints(accountId string) ([]*multiRegionAccessPoint, error) {
+	client := c.withRegion(multiRegionControlRegion)
+	accessPoints := []*multiRegionAccessPoint{}
+	err := client.ListMultiRegionAccessPointsPages(&s3control.ListMultiRegionAccessPointsInput{AccountId: aws.String(accountId)},
+		func(resp *s3control.ListMultiRegionAccessPointsOutput, lastPage bool) bool {
+			for _, item := range resp.AccessPoints {
+				ap := multiRegionAccessPoint{name: aws.StringValue(item.Name)}
+				for _, r := range item.Regions {
+					ap.regions = append(ap.regions, MultiRegionAccessPointRegion{
+						Bucket: aws.StringValue(r.Bucket),
+						Region: aws.StringValue(r.Region),
+					})
+				}
+				if conf := item.PublicAccessBlock; conf != nil {
+					ap.publicAccessBlock = &PublicAccessBlock{
+						BlockPublicAcls:       aws.BoolValue(conf.BlockPublicAcls),
+						IgnorePublicAcls:      aws.BoolValue(conf.IgnorePublicAcls),
+						BlockPublicPolicy:     aws.BoolValue(conf.BlockPublicPolicy),
+						RestrictPublicBuckets: aws.BoolValue(conf.RestrictPublicBuckets),
+					}
+				}
+				accessPoints = append(accessPoints, &ap)
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ap := range accessPoints {
+		resp, err := client.GetMultiRegionAccessPointPolicy(&s3control.GetMultiRegionAccessPointPolicyInput{
+			AccountId: aws.String(accountId),
+			Name:      aws.String(ap.name),
+		})
+		if err != nil {
+			if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == NoSuchAccessPointPolicyErrCode {
+				continue
+			}
+			return nil, err
+		}
+		ap.policyJson = multiRegionAccessPointPolicy(resp.Policy)
+	}
+
+	return accessPoints, nil
+}
+
+// multiRegionAccessPointPolicy returns the policy in effect, or the proposed
+// policy if one hasn't been established yet
+func multiRegionAccessPointPolicy(doc *s3control.MultiRegionAccessPointPolicyDocument) string {
+	if doc == nil {
+		return ""
+	}
+	if doc.Established != nil && aws.StringValue(doc.Established.Policy) != "" {
+		return aws.StringValue(doc.Established.Policy)
+	}
+	if doc.Proposed != nil {
+		return aws.StringValue(doc.Proposed.Policy)
+	}
+	return ""
+}
+
+func newObjectLambdaConfiguration(conf *s3control.ObjectLambdaConfiguration) ObjectLambdaConfiguration {
+	if conf == nil {
+		return ObjectLambdaConfiguration{}
+	}
+
+	c := ObjectLambdaConfiguration{
+		SupportingAccessPoint:    aws.StringValue(conf.SupportingAccessPoint),
+		CloudWatchMetricsEnabled: aws.BoolValue(conf.CloudWatchMetricsEnabled),
+		AllowedFeatures:          aws.StringValueSlice(conf.AllowedFeatures),
+	}
+	for _, t := range conf.TransformationConfigurations {
+		tc := ObjectLambdaTransformationConfiguration{Actions: aws.StringValueSlice(t.Actions)}
+		if t.ContentTransformation != nil && t.ContentTransformation.AwsLambda != nil {
+			tc.ContentTransformation.AwsLambda = AwsLambdaTransformation{
+				FunctionArn:     aws.StringValue(t.ContentTransformation.AwsLambda.FunctionArn),
+				FunctionPayload: aws.StringValue(t.ContentTransformation.AwsLambda.FunctionPayload),
+			}
+		}
+		c.TransformationConfigurations = append(c.TransformationConfigurations, tc)
+	}
+	if len(c.AllowedFeatures) == 0 {
+		c.AllowedFeatures = nil
+	}
+
+	return c
+}
@@ -0,0 +1,168 @@
+package iamy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// sarifSchema and sarifVersion are the version of SARIF written
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+// sarifFingerprintKey is the partial fingerprint identifying a finding
+// between runs, so code scanning tracks it while its file changes
+const sarifFingerprintKey = "iamyFinding/v1"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifResult struct {
+	RuleId              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+// sarifRegion is the line of a file a finding is about, or the first line
+// when it's of the whole file
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifRuleId is the rule of the findings of a suite, eg. analyze/mfa
+func sarifRuleId(suite string) string {
+	return strings.Join(strings.Fields(suite), "/")
+}
+
+// sarifLocations returns the location of the line of the file a case is
+// named for, in the directory, or none when the case isn't of a file
+func sarifLocations(dir, name string, line int) []sarifLocation {
+	ext := filepath.Ext(name)
+	if ext != ".yaml" && ext != ".json" && !strings.HasSuffix(name, TemplateExt) {
+		return nil
+	}
+	if line < 1 {
+		line = 1
+	}
+	uri := filepath.ToSlash(filepath.Join(filepath.FromSlash(dir), name))
+	return []sarifLocation{{sarifPhysicalLocation{sarifArtifactLocation{uri}, sarifRegion{line}}}}
+}
+
+// WriteSarif writes the failures of the cases as the results of a SARIF log,
+// for GitHub code scanning and other SARIF tools to annotate the files with.
+// Each suite is a rule, and each line of a failure a result, located at its
+// line of the file the case is named for, relative to dir, the slash separated directory
+// of the files from the root of the repository. Errors are notifications of
+// a failed run, and skipped cases are left out
+func WriteSarif(w io.Writer, cases []JUnitCase, dir, version string) error {
+	run := sarifRun{
+		Tool: sarifTool{sarifDriver{
+			Name:           "iamy",
+			Version:        version,
+			InformationUri: "https://github.com/envato/iamy",
+			Rules:          []sarifRule{},
+		}},
+		Invocations: []sarifInvocation{{ExecutionSuccessful: true}},
+		Results:     []sarifResult{},
+	}
+	rules := map[string]bool{}
+	for _, c := range cases {
+		id := sarifRuleId(c.Suite)
+		if !rules[id] {
+			rules[id] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{id, sarifMessage{"iamy " + c.Suite}})
+		}
+
+		if c.Error != "" {
+			run.Invocations[0].ExecutionSuccessful = false
+			run.Invocations[0].ToolExecutionNotifications = append(run.Invocations[0].ToolExecutionNotifications,
+				sarifNotification{"error", sarifMessage{c.Error}, sarifLocations(dir, c.Name, 0)})
+			continue
+		}
+		if c.Failure == "" {
+			continue
+		}
+		for i, message := range strings.Split(c.Failure, "\n") {
+			if message == "" {
+				continue
+			}
+			line := 0
+			if i < len(c.Lines) {
+				line = c.Lines[i]
+			}
+			sum := sha256.Sum256([]byte(id + "\x00" + c.Name + "\x00" + message))
+			run.Results = append(run.Results, sarifResult{
+				RuleId:              id,
+				Level:               "error",
+				Message:             sarifMessage{message},
+				Locations:           sarifLocations(dir, c.Name, line),
+				PartialFingerprints: map[string]string{sarifFingerprintKey: hex.EncodeToString(sum[:])},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(sarifLog{sarifSchema, sarifVersion, []sarifRun{run}})
+}
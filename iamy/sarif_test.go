@@ -0,0 +1,62 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteSarif(t *testing.T) {
+	cases := []JUnitCase{
+		{Suite: "analyze mfa", ClassName: "analyze mfa", Name: "myalias-123/iam/user/alice.yaml", Failure: "first problem\nsecond problem"},
+		{Suite: "analyze mfa", ClassName: "analyze mfa", Name: "myalias-123/iam/role/deployer.yaml"},
+		{Suite: "analyze quotas", ClassName: "PoliciesPerAccount", Name: "myalias-123", Failure: "95% used"},
+		{Suite: "analyze regions", ClassName: "analyze regions", Name: "myalias-123/iam/policy/broken.yaml", Error: "Error reading myalias-123/iam/policy/broken.yaml"},
+	}
+
+	var b bytes.Buffer
+	if err := WriteSarif(&b, cases, "accounts", "1.2.3"); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(b.Bytes(), &log); err != nil {
+		t.Fatalf("Expected valid JSON, got %s:\n%s", err, b.String())
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Expected a SARIF 2.1.0 log of one run, got:\n%s", b.String())
+	}
+	run := log.Runs[0]
+
+	if run.Tool.Driver.Name != "iamy" || run.Tool.Driver.Version != "1.2.3" {
+		t.Errorf("Expected the tool to be iamy 1.2.3, got %+v", run.Tool.Driver)
+	}
+	rules := []string{}
+	for _, r := range run.Tool.Driver.Rules {
+		rules = append(rules, r.Id)
+	}
+	if len(rules) != 3 || rules[0] != "analyze/mfa" || rules[1] != "analyze/quotas" || rules[2] != "analyze/regions" {
+		t.Errorf("Expected a rule for each suite, got %v", rules)
+	}
+
+	if len(run.Results) != 3 {
+		t.Fatalf("Expected a result for each problem, got %+v", run.Results)
+	}
+	first := run.Results[0]
+	if first.RuleId != "analyze/mfa" || first.Message.Text != "first problem" || first.Level != "error" {
+		t.Errorf("Unexpected result %+v", first)
+	}
+	if len(first.Locations) != 1 || first.Locations[0].PhysicalLocation.ArtifactLocation.Uri != "accounts/myalias-123/iam/user/alice.yaml" {
+		t.Errorf("Expected the result in the file, relative to the directory, got %+v", first.Locations)
+	}
+	if first.PartialFingerprints[sarifFingerprintKey] == "" || first.PartialFingerprints[sarifFingerprintKey] == run.Results[1].PartialFingerprints[sarifFingerprintKey] {
+		t.Errorf("Expected each result to have its own fingerprint, got %v and %v", first.PartialFingerprints, run.Results[1].PartialFingerprints)
+	}
+	if len(run.Results[2].Locations) != 0 {
+		t.Errorf("Expected a problem that isn't of a file to have no location, got %+v", run.Results[2].Locations)
+	}
+
+	invocation := run.Invocations[0]
+	if invocation.ExecutionSuccessful || len(invocation.ToolExecutionNotifications) != 1 {
+		t.Errorf("Expected the error as a notification of a failed run, got %+v", invocation)
+	}
+}
@@ -0,0 +1,122 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStalePlan is a saved plan that no longer matches what push would do,
+// because AWS or the files have changed since it was saved. Reasons are what
+// differs
+type ErrStalePlan struct {
+	Reasons []string
+}
+
+func (e *ErrStalePlan) Error() string {
+	return "The saved plan is out of date, plan again and review the changes:\n  " + strings.Join(e.Reasons, "\n  ")
+}
+
+// savedPlan is a JSON plan as it's read back, with the resources before
+// the changes kept as JSON
+type savedPlan struct {
+	FormatVersion int      `json:"FormatVersion"`
+	Account       *Account `json:"Account"`
+	Changes       []struct {
+		Resource string          `json:"Resource"`
+		Before   json.RawMessage `json:"Before"`
+	} `json:"Changes"`
+	Commands []PlanCommand `json:"Commands"`
+}
+
+// VerifySavedPlan checks the plan makes exactly the changes of a plan saved
+// with the JSON renderer, from the same AWS state. It returns an
+// *ErrStalePlan when the resources in AWS or the commands differ
+func (p *SyncPlan) VerifySavedPlan(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var saved savedPlan
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return errors.Wrap(err, "Error reading the saved plan")
+	}
+	if saved.FormatVersion != PlanFormatVersion {
+		return errors.Errorf("The saved plan has format version %d, expected %d", saved.FormatVersion, PlanFormatVersion)
+	}
+	if saved.Account == nil || saved.Account.Id != p.to.Account.Id {
+		return errors.Errorf("The saved plan isn't for account %s", p.to.Account)
+	}
+
+	current := p.jsonPlan()
+	reasons := []string{}
+
+	savedBefore := map[string]string{}
+	for _, ch := range saved.Changes {
+		savedBefore[ch.Resource] = compactJson(ch.Before)
+	}
+	currentBefore := map[string]string{}
+	for _, ch := range current.Changes {
+		before := ""
+		if ch.Before != nil {
+			before = resourceJson(ch.Before)
+		}
+		currentBefore[ch.Resource] = before
+	}
+	resources := []string{}
+	for key := range savedBefore {
+		resources = append(resources, key)
+	}
+	for key := range currentBefore {
+		if _, ok := savedBefore[key]; !ok {
+			resources = append(resources, key)
+		}
+	}
+	sort.Strings(resources)
+	for _, key := range resources {
+		before, inSaved := savedBefore[key]
+		now, inCurrent := currentBefore[key]
+		switch {
+		case !inSaved:
+			reasons = append(reasons, key+" has changed since the plan was saved")
+		case !inCurrent:
+			reasons = append(reasons, key+" no longer needs the planned change")
+		case before != now:
+			reasons = append(reasons, key+" has changed in AWS since the plan was saved")
+		}
+	}
+
+	for i := 0; i < len(saved.Commands) || i < len(current.Commands); i++ {
+		switch {
+		case i >= len(current.Commands):
+			reasons = append(reasons, "The saved plan has more commands, from "+saved.Commands[i].Shell)
+		case i >= len(saved.Commands):
+			reasons = append(reasons, "There are more commands than the saved plan, from "+current.Commands[i].Shell)
+		case !reflect.DeepEqual(saved.Commands[i].Argv, current.Commands[i].Argv):
+			reasons = append(reasons, "Command "+current.Commands[i].Shell+" differs from the saved plan's "+saved.Commands[i].Shell)
+		default:
+			continue
+		}
+		break
+	}
+
+	if len(reasons) > 0 {
+		return &ErrStalePlan{reasons}
+	}
+	return nil
+}
+
+// compactJson returns the JSON without whitespace, or empty for null
+func compactJson(raw json.RawMessage) string {
+	var b bytes.Buffer
+	if len(raw) == 0 || json.Compact(&b, raw) != nil || b.String() == "null" {
+		return ""
+	}
+	return b.String()
+}
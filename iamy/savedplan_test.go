@@ -0,0 +1,51 @@
+package iamy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestVerifySavedPlan(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+	other := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]}`)
+
+	remoteData := func(policy *PolicyDocument) *AccountData {
+		data := NewAccountData("123")
+		data.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: policy})
+		return data
+	}
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/"}, Policy: other})
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: doc})
+
+	var saved bytes.Buffer
+	if err := (JsonRenderer{}).Render(&saved, PlanSync(remoteData(doc), localData)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PlanSync(remoteData(doc), localData).VerifySavedPlan(bytes.NewReader(saved.Bytes())); err != nil {
+		t.Errorf("Expected the same plan to verify, got %v", err)
+	}
+
+	// the policy was changed in AWS after the plan was saved
+	changed := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:ListBucket","Resource":"*"}]}`)
+	err := PlanSync(remoteData(changed), localData).VerifySavedPlan(bytes.NewReader(saved.Bytes()))
+	var stale *ErrStalePlan
+	if !errors.As(err, &stale) || len(stale.Reasons) != 1 || stale.Reasons[0] != "iam/policy/reader has changed in AWS since the plan was saved" {
+		t.Errorf("Expected the plan to be stale, got %v", err)
+	}
+
+	// the role was removed from the files after the plan was saved
+	localData.Roles = nil
+	err = PlanSync(remoteData(doc), localData).VerifySavedPlan(bytes.NewReader(saved.Bytes()))
+	if !errors.As(err, &stale) || !strings.Contains(err.Error(), "iam/role/app no longer needs the planned change") || !strings.Contains(err.Error(), "The saved plan has more commands") {
+		t.Errorf("Expected the plan to be stale, got %v", err)
+	}
+
+	if err = PlanSync(NewAccountData("456"), NewAccountData("456")).VerifySavedPlan(bytes.NewReader(saved.Bytes())); err == nil || errors.As(err, &stale) {
+		t.Errorf("Expected a plan for another account to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package iamy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// jsonSchemaDialect is the JSON Schema version of the file schemas
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaKinds are the kinds of file there are schemas for, and the resource
+// each kind's files hold
+var SchemaKinds = []struct {
+	Kind     string
+	Resource interface{}
+}{
+	{"user", User{}},
+	{"group", Group{}},
+	{"role", Role{}},
+	{"policy", Policy{}},
+	{"instance-profile", InstanceProfile{}},
+	{"bucket-policy", BucketPolicy{}},
+}
+
+var policyDocumentType = reflect.TypeOf(PolicyDocument{})
+
+// stringOrStrings is the schema of a policy value that is a string or a list
+// of them
+var stringOrStrings = map[string]interface{}{
+	"oneOf": []interface{}{
+		map[string]interface{}{"type": "string"},
+		map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "minItems": 1},
+	},
+}
+
+// policyDocumentSchemas are the definitions of a policy document's schema
+func policyDocumentSchemas() map[string]interface{} {
+	principal := map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"const": "*"},
+			map[string]interface{}{
+				"type":                 "object",
+				"propertyNames":        map[string]interface{}{"enum": []interface{}{"AWS", "Service", "Federated", "CanonicalUser"}},
+				"additionalProperties": stringOrStrings,
+			},
+		},
+	}
+	statement := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"Sid":          map[string]interface{}{"type": "string"},
+			"Effect":       map[string]interface{}{"enum": []interface{}{"Allow", "Deny"}},
+			"Principal":    principal,
+			"NotPrincipal": principal,
+			"Action":       stringOrStrings,
+			"NotAction":    stringOrStrings,
+			"Resource":     stringOrStrings,
+			"NotResource":  stringOrStrings,
+			"Condition": map[string]interface{}{
+				"type": "object",
+				"additionalProperties": map[string]interface{}{
+					"type": "object",
+					"additionalProperties": map[string]interface{}{
+						"oneOf": []interface{}{
+							map[string]interface{}{"type": []interface{}{"string", "number", "boolean"}},
+							map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": []interface{}{"string", "number", "boolean"}}},
+						},
+					},
+				},
+			},
+		},
+		"required":             []interface{}{"Effect"},
+		"additionalProperties": false,
+	}
+	return map[string]interface{}{
+		"PolicyDocument": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"Version": map[string]interface{}{"enum": []interface{}{"2012-10-17", "2008-10-17"}},
+				"Id":      map[string]interface{}{"type": "string"},
+				"Statement": map[string]interface{}{
+					"oneOf": []interface{}{
+						map[string]interface{}{"$ref": "#/$defs/Statement"},
+						map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/$defs/Statement"}},
+					},
+				},
+			},
+			"additionalProperties": false,
+		},
+		"Statement": statement,
+	}
+}
+
+// typeSchema returns the schema of a type as it's written to files
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == policyDocumentType {
+		return map[string]interface{}{"$ref": "#/$defs/PolicyDocument"}
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the schema of a struct's JSON fields. Fields without
+// omitempty are required, and a policy document can be in a PolicyFile
+// instead of under Policy
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []interface{}{}
+	requirePolicy := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.PkgPath != "" || field.Anonymous || tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type)
+		if strings.Contains(tag, ",omitempty") {
+			continue
+		}
+		if name == "Policy" && field.Type == reflect.PtrTo(policyDocumentType) {
+			requirePolicy = true
+		} else {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if _, ok := properties["Policy"]; ok {
+		properties[policyFileKey] = map[string]interface{}{"type": "string", "description": "A file of the policy document, relative to this file"}
+		if requirePolicy {
+			schema["oneOf"] = []interface{}{
+				map[string]interface{}{"required": []interface{}{"Policy"}},
+				map[string]interface{}{"required": []interface{}{policyFileKey}},
+			}
+		} else {
+			schema["not"] = map[string]interface{}{"required": []interface{}{"Policy", policyFileKey}}
+		}
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// FileSchema returns the JSON Schema of the kind's files
+func FileSchema(kind string) (map[string]interface{}, error) {
+	kinds := []string{}
+	for _, k := range SchemaKinds {
+		if k.Kind != kind {
+			kinds = append(kinds, k.Kind)
+			continue
+		}
+		schema := structSchema(reflect.TypeOf(k.Resource))
+		// the path is kept in the file with layouts without it
+		schema["properties"].(map[string]interface{})[pathFileKey] = map[string]interface{}{"type": "string", "pattern": "^/"}
+		schema["$schema"] = jsonSchemaDialect
+		schema["title"] = fmt.Sprintf("iamy %s file", kind)
+		schema["$defs"] = policyDocumentSchemas()
+		return schema, nil
+	}
+	return nil, fmt.Errorf("There's no schema for %s files, use one of %s", kind, strings.Join(kinds, ", "))
+}
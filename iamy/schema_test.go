@@ -0,0 +1,54 @@
+package iamy
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileSchema(t *testing.T) {
+	for _, k := range SchemaKinds {
+		schema, err := FileSchema(k.Kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = json.Marshal(schema); err != nil {
+			t.Errorf("Expected the %s schema to marshal, got %s", k.Kind, err)
+		}
+		properties := schema["properties"].(map[string]interface{})
+		if _, ok := properties["Path"]; !ok {
+			t.Errorf("Expected the %s schema to allow a Path, got %v", k.Kind, properties)
+		}
+	}
+
+	schema, err := FileSchema("role")
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	for _, p := range []string{"Name", "iamService"} {
+		if _, ok := properties[p]; ok {
+			t.Errorf("Expected no %s in the role schema, got %v", p, properties)
+		}
+	}
+	if !reflect.DeepEqual(schema["required"], []interface{}{"AssumeRolePolicyDocument"}) {
+		t.Errorf("Expected the role schema to require AssumeRolePolicyDocument, got %v", schema["required"])
+	}
+	inline := properties["InlinePolicies"].(map[string]interface{})["items"].(map[string]interface{})
+	if _, ok := inline["properties"].(map[string]interface{})[policyFileKey]; !ok || inline["oneOf"] == nil {
+		t.Errorf("Expected an inline policy to require a Policy or a %s, got %v", policyFileKey, inline)
+	}
+
+	bucket, err := FileSchema("bucket-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket["required"] != nil || bucket["oneOf"] != nil || bucket["not"] == nil {
+		t.Errorf("Expected a bucket policy's Policy to be optional, got %v", bucket)
+	}
+
+	if _, err = FileSchema("bucket"); err == nil || !strings.Contains(err.Error(), "bucket-policy") {
+		t.Errorf("Expected an error listing the kinds, got %v", err)
+	}
+}
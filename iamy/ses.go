@@ -0,0 +1,85 @@
+package iamy
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+	"github.com/aws/aws-sdk-go/service/ses/sesiface"
+	"github.com/pkg/errors"
+)
+
+type sesClient struct {
+	sess    *session.Session
+	clients map[string]sesiface.SESAPI
+	mutex   sync.Mutex
+}
+
+func newSesClient(sess *session.Session) *sesClient {
+	return &sesClient{
+		sess:    sess,
+		clients: map[string]sesiface.SESAPI{},
+	}
+}
+
+func (c *sesClient) withRegion(region string) sesiface.SESAPI {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.clients[region]; !ok {
+		c.clients[region] = ses.New(c.sess, aws.NewConfig().WithRegion(region))
+	}
+
+	return c.clients[region]
+}
+
+func (c *sesClient) listIdentities(region string) ([]string, error) {
+	identities := []string{}
+	err := c.withRegion(region).ListIdentitiesPages(&ses.ListIdentitiesInput{},
+		func(resp *ses.ListIdentitiesOutput, lastPage bool) bool {
+			for _, i := range resp.Identities {
+				identities = append(identities, *i)
+			}
+			return true
+		})
+
+	return identities, err
+}
+
+// getIdentityPolicyDocs returns the sending authorization policies attached
+// to identity in region, sorted by policy name
+func (c *sesClient) getIdentityPolicyDocs(region, identity string) ([]string, []string, error) {
+	client := c.withRegion(region)
+	namesResp, err := client.ListIdentityPolicies(&ses.ListIdentityPoliciesInput{
+		Identity: aws.String(identity),
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "ListIdentityPolicies for %s", identity)
+	}
+	if len(namesResp.PolicyNames) == 0 {
+		return nil, nil, nil
+	}
+
+	policiesResp, err := client.GetIdentityPolicies(&ses.GetIdentityPoliciesInput{
+		Identity:    aws.String(identity),
+		PolicyNames: namesResp.PolicyNames,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "GetIdentityPolicies for %s", identity)
+	}
+
+	names := []string{}
+	for name := range policiesResp.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	docs := []string{}
+	for _, name := range names {
+		docs = append(docs, aws.StringValue(policiesResp.Policies[name]))
+	}
+
+	return names, docs, nil
+}
@@ -1,6 +1,9 @@
 package iamy
 
-import "reflect"
+import (
+	"reflect"
+	"sort"
+)
 
 // inlinePolicySetDifference is the set of elements in aa but not in bb
 func inlinePolicySetDifference(aa, bb []InlinePolicy) []InlinePolicy {
@@ -9,7 +12,7 @@ func inlinePolicySetDifference(aa, bb []InlinePolicy) []InlinePolicy {
 LoopInlinePolicies:
 	for _, a := range aa {
 		for _, b := range bb {
-			if reflect.DeepEqual(a, b) {
+			if a.Name == b.Name && a.Policy.equal(b.Policy) {
 				continue LoopInlinePolicies
 			}
 		}
@@ -20,6 +23,17 @@ LoopInlinePolicies:
 	return rr
 }
 
+// inlinePolicyNamesContain is true if one of ips is named name
+func inlinePolicyNamesContain(ips []InlinePolicy, name string) bool {
+	for _, ip := range ips {
+		if ip.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 // stringSetDifference is the set of elements in aa but not in bb
 func stringSetDifference(aa, bb []string) []string {
 	rr := []string{}
@@ -37,3 +51,21 @@ LoopStrings:
 
 	return rr
 }
+
+// sortedCopy returns a sorted copy of ss
+func sortedCopy(ss []string) []string {
+	result := append([]string{}, ss...)
+	sort.Strings(result)
+	return result
+}
+
+// stringSliceContains is true if s is one of ss
+func stringSliceContains(ss []string, s string) bool {
+	for _, a := range ss {
+		if a == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,415 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// SnapshotFormatVersion is the version of the JSON snapshot format
+const SnapshotFormatVersion = 1
+
+// A snapshot is a single JSON document holding all the data for an account.
+// Unlike the yaml files, resource names and paths are stored in the document
+// rather than in the file layout
+type snapshot struct {
+	FormatVersion    int                        `json:"FormatVersion"`
+	Account          *Account                   `json:"Account"`
+	Users            []*userSnapshot            `json:"Users,omitempty"`
+	Groups           []*groupSnapshot           `json:"Groups,omitempty"`
+	Roles            []*roleSnapshot            `json:"Roles,omitempty"`
+	Policies         []*policySnapshot          `json:"Policies,omitempty"`
+	InstanceProfiles []*instanceProfileSnapshot `json:"InstanceProfiles,omitempty"`
+	BucketPolicies   []*bucketPolicySnapshot    `json:"BucketPolicies,omitempty"`
+
+	AccountPublicAccessBlock *AccountPublicAccessBlock `json:"AccountPublicAccessBlock,omitempty"`
+	CanonicalUserId          string                    `json:"CanonicalUserId,omitempty"`
+
+	CodeArtifactDomainPolicies     []*codeArtifactDomainPolicySnapshot     `json:"CodeArtifactDomainPolicies,omitempty"`
+	CodeArtifactRepositoryPolicies []*codeArtifactRepositoryPolicySnapshot `json:"CodeArtifactRepositoryPolicies,omitempty"`
+	SesIdentityPolicies            []*sesIdentityPoliciesSnapshot          `json:"SesIdentityPolicies,omitempty"`
+	RestApiPolicies                []*restApiPolicySnapshot                `json:"RestApiPolicies,omitempty"`
+	AccessPoints                   []*accessPointSnapshot                  `json:"AccessPoints,omitempty"`
+	ObjectLambdaAccessPoints       []*objectLambdaAccessPointSnapshot      `json:"ObjectLambdaAccessPoints,omitempty"`
+	GlacierVaultPolicies           []*glacierVaultPolicySnapshot           `json:"GlacierVaultPolicies,omitempty"`
+	MultiRegionAccessPoints        []*multiRegionAccessPointSnapshot       `json:"MultiRegionAccessPoints,omitempty"`
+	EcrRegistryPolicies            []*ecrRegistryPolicySnapshot            `json:"EcrRegistryPolicies,omitempty"`
+
+	Warnings Warnings `json:"Warnings,omitempty"`
+
+	// PolicyHashes are for external tooling, they're recalculated rather than
+	// read when loading a snapshot
+	PolicyHashes []PolicyLocation `json:"PolicyHashes,omitempty"`
+}
+
+type userSnapshot struct {
+	Name string `json:"Name"`
+	Path string `json:"Path"`
+	*User
+}
+
+type groupSnapshot struct {
+	Name string `json:"Name"`
+	Path string `json:"Path"`
+	*Group
+}
+
+type roleSnapshot struct {
+	Name string `json:"Name"`
+	Path string `json:"Path"`
+	*Role
+}
+
+type policySnapshot struct {
+	Name string `json:"Name"`
+	Path string `json:"Path"`
+	*Policy
+}
+
+type instanceProfileSnapshot struct {
+	Name string `json:"Name"`
+	Path string `json:"Path"`
+	*InstanceProfile
+}
+
+type bucketPolicySnapshot struct {
+	BucketName string `json:"BucketName"`
+	*BucketPolicy
+}
+
+type codeArtifactDomainPolicySnapshot struct {
+	Region     string `json:"Region"`
+	DomainName string `json:"DomainName"`
+	*CodeArtifactDomainPolicy
+}
+
+type codeArtifactRepositoryPolicySnapshot struct {
+	Region         string `json:"Region"`
+	DomainName     string `json:"DomainName"`
+	RepositoryName string `json:"RepositoryName"`
+	*CodeArtifactRepositoryPolicy
+}
+
+type sesIdentityPoliciesSnapshot struct {
+	Region   string `json:"Region"`
+	Identity string `json:"Identity"`
+	*SesIdentityPolicies
+}
+
+type restApiPolicySnapshot struct {
+	Region    string `json:"Region"`
+	RestApiId string `json:"RestApiId"`
+	*RestApiPolicy
+}
+
+type accessPointSnapshot struct {
+	Region string `json:"Region"`
+	Name   string `json:"Name"`
+	*AccessPoint
+}
+
+type objectLambdaAccessPointSnapshot struct {
+	Region string `json:"Region"`
+	Name   string `json:"Name"`
+	*ObjectLambdaAccessPoint
+}
+
+type glacierVaultPolicySnapshot struct {
+	Region    string `json:"Region"`
+	VaultName string `json:"VaultName"`
+	*GlacierVaultPolicy
+}
+
+type ecrRegistryPolicySnapshot struct {
+	Region string `json:"Region"`
+	*EcrRegistryPolicy
+}
+
+type multiRegionAccessPointSnapshot struct {
+	Name string `json:"Name"`
+	*MultiRegionAccessPoint
+}
+
+func newSnapshot(data *AccountData) *snapshot {
+	s := snapshot{
+		FormatVersion: SnapshotFormatVersion,
+		Account:       data.Account,
+		Warnings:      data.Warnings,
+
+		AccountPublicAccessBlock: data.AccountPublicAccessBlock,
+		CanonicalUserId:          data.canonicalUserId,
+	}
+	for _, u := range data.Users {
+		s.Users = append(s.Users, &userSnapshot{u.Name, u.Path, u})
+	}
+	for _, g := range data.Groups {
+		s.Groups = append(s.Groups, &groupSnapshot{g.Name, g.Path, g})
+	}
+	for _, r := range data.Roles {
+		s.Roles = append(s.Roles, &roleSnapshot{r.Name, r.Path, r})
+	}
+	for _, p := range data.Policies {
+		s.Policies = append(s.Policies, &policySnapshot{p.Name, p.Path, p})
+	}
+	for _, ip := range data.InstanceProfiles {
+		s.InstanceProfiles = append(s.InstanceProfiles, &instanceProfileSnapshot{ip.Name, ip.Path, ip})
+	}
+	for _, bp := range data.BucketPolicies {
+		s.BucketPolicies = append(s.BucketPolicies, &bucketPolicySnapshot{bp.BucketName, bp})
+	}
+	for _, p := range data.CodeArtifactDomainPolicies {
+		s.CodeArtifactDomainPolicies = append(s.CodeArtifactDomainPolicies, &codeArtifactDomainPolicySnapshot{p.Region, p.DomainName, p})
+	}
+	for _, p := range data.CodeArtifactRepositoryPolicies {
+		s.CodeArtifactRepositoryPolicies = append(s.CodeArtifactRepositoryPolicies, &codeArtifactRepositoryPolicySnapshot{p.Region, p.DomainName, p.RepositoryName, p})
+	}
+	for _, p := range data.SesIdentityPolicies {
+		s.SesIdentityPolicies = append(s.SesIdentityPolicies, &sesIdentityPoliciesSnapshot{p.Region, p.Identity, p})
+	}
+	for _, p := range data.RestApiPolicies {
+		s.RestApiPolicies = append(s.RestApiPolicies, &restApiPolicySnapshot{p.Region, p.RestApiId, p})
+	}
+	for _, p := range data.AccessPoints {
+		s.AccessPoints = append(s.AccessPoints, &accessPointSnapshot{p.Region, p.Name, p})
+	}
+	for _, p := range data.ObjectLambdaAccessPoints {
+		s.ObjectLambdaAccessPoints = append(s.ObjectLambdaAccessPoints, &objectLambdaAccessPointSnapshot{p.Region, p.Name, p})
+	}
+	for _, p := range data.GlacierVaultPolicies {
+		s.GlacierVaultPolicies = append(s.GlacierVaultPolicies, &glacierVaultPolicySnapshot{p.Region, p.VaultName, p})
+	}
+	for _, p := range data.MultiRegionAccessPoints {
+		s.MultiRegionAccessPoints = append(s.MultiRegionAccessPoints, &multiRegionAccessPointSnapshot{p.Name, p})
+	}
+	for _, p := range data.EcrRegistryPolicies {
+		s.EcrRegistryPolicies = append(s.EcrRegistryPolicies, &ecrRegistryPolicySnapshot{p.Region, p})
+	}
+	s.PolicyHashes = NewPolicyIndex(data).Locations()
+	return &s
+}
+
+func (s *snapshot) accountData() (*AccountData, error) {
+	if s.Account == nil {
+		return nil, errors.New("Snapshot has no Account")
+	}
+	if s.FormatVersion > SnapshotFormatVersion {
+		return nil, errors.Errorf("Snapshot format version %d is newer than this version of iamy supports (%d)", s.FormatVersion, SnapshotFormatVersion)
+	}
+
+	data := NewAccountData(s.Account.String())
+	data.Warnings = s.Warnings
+	data.AccountPublicAccessBlock = s.AccountPublicAccessBlock
+	data.canonicalUserId = s.CanonicalUserId
+	for _, u := range s.Users {
+		if u.User == nil {
+			u.User = &User{}
+		}
+		u.User.iamService = iamService{Name: u.Name, Path: u.Path}
+		data.addUser(u.User)
+	}
+	for _, g := range s.Groups {
+		if g.Group == nil {
+			g.Group = &Group{}
+		}
+		g.Group.iamService = iamService{Name: g.Name, Path: g.Path}
+		data.addGroup(g.Group)
+	}
+	for _, r := range s.Roles {
+		if r.Role == nil {
+			r.Role = &Role{}
+		}
+		r.Role.iamService = iamService{Name: r.Name, Path: r.Path}
+		data.addRole(r.Role)
+	}
+	for _, p := range s.Policies {
+		if p.Policy == nil {
+			p.Policy = &Policy{}
+		}
+		p.Policy.iamService = iamService{Name: p.Name, Path: p.Path}
+		data.addPolicy(p.Policy)
+	}
+	for _, ip := range s.InstanceProfiles {
+		if ip.InstanceProfile == nil {
+			ip.InstanceProfile = &InstanceProfile{}
+		}
+		ip.InstanceProfile.iamService = iamService{Name: ip.Name, Path: ip.Path}
+		data.addInstanceProfile(ip.InstanceProfile)
+	}
+	for _, bp := range s.BucketPolicies {
+		if bp.BucketPolicy == nil {
+			bp.BucketPolicy = &BucketPolicy{}
+		}
+		bp.BucketPolicy.BucketName = bp.BucketName
+		data.addBucketPolicy(bp.BucketPolicy)
+	}
+	for _, p := range s.CodeArtifactDomainPolicies {
+		if p.CodeArtifactDomainPolicy == nil {
+			p.CodeArtifactDomainPolicy = &CodeArtifactDomainPolicy{}
+		}
+		p.CodeArtifactDomainPolicy.Region = p.Region
+		p.CodeArtifactDomainPolicy.DomainName = p.DomainName
+		data.addCodeArtifactDomainPolicy(p.CodeArtifactDomainPolicy)
+	}
+	for _, p := range s.CodeArtifactRepositoryPolicies {
+		if p.CodeArtifactRepositoryPolicy == nil {
+			p.CodeArtifactRepositoryPolicy = &CodeArtifactRepositoryPolicy{}
+		}
+		p.CodeArtifactRepositoryPolicy.Region = p.Region
+		p.CodeArtifactRepositoryPolicy.DomainName = p.DomainName
+		p.CodeArtifactRepositoryPolicy.RepositoryName = p.RepositoryName
+		data.addCodeArtifactRepositoryPolicy(p.CodeArtifactRepositoryPolicy)
+	}
+	for _, p := range s.SesIdentityPolicies {
+		if p.SesIdentityPolicies == nil {
+			p.SesIdentityPolicies = &SesIdentityPolicies{}
+		}
+		p.SesIdentityPolicies.Region = p.Region
+		p.SesIdentityPolicies.Identity = p.Identity
+		data.addSesIdentityPolicies(p.SesIdentityPolicies)
+	}
+	for _, p := range s.RestApiPolicies {
+		if p.RestApiPolicy == nil {
+			p.RestApiPolicy = &RestApiPolicy{}
+		}
+		p.RestApiPolicy.Region = p.Region
+		p.RestApiPolicy.RestApiId = p.RestApiId
+		data.addRestApiPolicy(p.RestApiPolicy)
+	}
+	for _, p := range s.AccessPoints {
+		if p.AccessPoint == nil {
+			p.AccessPoint = &AccessPoint{}
+		}
+		p.AccessPoint.Region = p.Region
+		p.AccessPoint.Name = p.Name
+		data.addAccessPoint(p.AccessPoint)
+	}
+	for _, p := range s.ObjectLambdaAccessPoints {
+		if p.ObjectLambdaAccessPoint == nil {
+			p.ObjectLambdaAccessPoint = &ObjectLambdaAccessPoint{}
+		}
+		p.ObjectLambdaAccessPoint.Region = p.Region
+		p.ObjectLambdaAccessPoint.Name = p.Name
+		data.addObjectLambdaAccessPoint(p.ObjectLambdaAccessPoint)
+	}
+	for _, p := range s.GlacierVaultPolicies {
+		if p.GlacierVaultPolicy == nil {
+			p.GlacierVaultPolicy = &GlacierVaultPolicy{}
+		}
+		p.GlacierVaultPolicy.Region = p.Region
+		p.GlacierVaultPolicy.VaultName = p.VaultName
+		data.addGlacierVaultPolicy(p.GlacierVaultPolicy)
+	}
+	for _, p := range s.MultiRegionAccessPoints {
+		if p.MultiRegionAccessPoint == nil {
+			p.MultiRegionAccessPoint = &MultiRegionAccessPoint{}
+		}
+		p.MultiRegionAccessPoint.Name = p.Name
+		data.addMultiRegionAccessPoint(p.MultiRegionAccessPoint)
+	}
+	for _, p := range s.EcrRegistryPolicies {
+		if p.EcrRegistryPolicy == nil {
+			p.EcrRegistryPolicy = &EcrRegistryPolicy{}
+		}
+		p.EcrRegistryPolicy.Region = p.Region
+		data.addEcrRegistryPolicy(p.EcrRegistryPolicy)
+	}
+
+	return data, nil
+}
+
+// WriteSnapshot writes the account data to w as a single JSON document
+func WriteSnapshot(w io.Writer, data *AccountData) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newSnapshot(data))
+}
+
+// WriteSnapshotYaml writes the account data to w as a single YAML document,
+// the snapshot in YAML with its keys sorted, to read and diff by hand
+func WriteSnapshotYaml(w io.Writer, data *AccountData) error {
+	j, err := json.Marshal(newSnapshot(data))
+	if err != nil {
+		return err
+	}
+	y, err := yaml.JSONToYAML(j)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(y)
+	return err
+}
+
+// ReadSnapshot reads account data from a JSON or YAML document written by
+// WriteSnapshot or WriteSnapshotYaml
+func ReadSnapshot(r io.Reader) (*AccountData, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		if b, err = yaml.YAMLToJSON(b); err != nil {
+			return nil, errors.Wrap(err, "Error decoding snapshot")
+		}
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, errors.Wrap(err, "Error decoding snapshot")
+	}
+
+	return s.accountData()
+}
+
+// A SnapshotLoadDumper loads and dumps account data in a snapshot file, in
+// YAML when the file is .yaml or .yml, otherwise in JSON
+type SnapshotLoadDumper struct {
+	Path string
+}
+
+func (f *SnapshotLoadDumper) isYaml() bool {
+	ext := strings.ToLower(filepath.Ext(f.Path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Load reads the snapshot file at f.Path
+func (f *SnapshotLoadDumper) Load() (*AccountData, error) {
+	log.Println("Loading snapshot from", f.Path)
+
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadSnapshot(file)
+}
+
+// Dump writes the account data to the snapshot file at f.Path
+func (f *SnapshotLoadDumper) Dump(accountData *AccountData) error {
+	log.Println("Dumping snapshot to", f.Path)
+
+	file, err := os.Create(f.Path)
+	if err != nil {
+		return err
+	}
+
+	if f.isYaml() {
+		err = WriteSnapshotYaml(file, accountData)
+	} else {
+		err = WriteSnapshot(file, accountData)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
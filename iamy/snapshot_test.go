@@ -0,0 +1,55 @@
+package iamy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	data := loadTestdataAccount(t)
+
+	var first, second bytes.Buffer
+	if err := WriteSnapshot(&first, data); err != nil {
+		t.Fatal(err)
+	}
+	expected := first.String()
+
+	loaded, err := ReadSnapshot(&first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteSnapshot(&second, loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if second.String() != expected {
+		t.Errorf("Expected snapshot to round trip\nExpected: %s\nActual:   %s", expected, second.String())
+	}
+}
+
+func TestSnapshotYamlRoundTrip(t *testing.T) {
+	data := loadTestdataAccount(t)
+
+	var expected, yaml, actual bytes.Buffer
+	if err := WriteSnapshot(&expected, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSnapshotYaml(&yaml, data); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(yaml.Bytes(), []byte("{")) {
+		t.Fatalf("Expected a YAML document, got %s", yaml.String())
+	}
+
+	loaded, err := ReadSnapshot(&yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteSnapshot(&actual, loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual.String() != expected.String() {
+		t.Errorf("Expected YAML snapshot to round trip\nExpected: %s\nActual:   %s", expected.String(), actual.String())
+	}
+}
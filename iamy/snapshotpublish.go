@@ -0,0 +1,159 @@
+package iamy
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+)
+
+// SnapshotRetention is how long published snapshots are locked for. Without
+// Days, the bucket's default retention locks them
+type SnapshotRetention struct {
+	Mode string
+	Days int
+}
+
+// A SnapshotManifest records the digest of a published snapshot, to check
+// the snapshot against later
+type SnapshotManifest struct {
+	Account       string     `json:"Account"`
+	PulledAt      time.Time  `json:"PulledAt"`
+	Snapshot      string     `json:"Snapshot"`
+	Size          int        `json:"Size"`
+	Sha256        string     `json:"Sha256"`
+	FormatVersion int        `json:"FormatVersion"`
+	IamyVersion   string     `json:"IamyVersion,omitempty"`
+	RetentionMode string     `json:"RetentionMode,omitempty"`
+	RetainUntil   *time.Time `json:"RetainUntil,omitempty"`
+}
+
+// parseS3Prefix splits an s3://bucket/prefix location, where the prefix can
+// be empty
+func parseS3Prefix(location string) (bucket, prefix string, ok bool) {
+	if !strings.HasPrefix(location, "s3://") {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(location, "s3://"), "/", 2)
+	if parts[0] == "" {
+		return "", "", false
+	}
+	if len(parts) == 2 {
+		prefix = strings.Trim(parts[1], "/")
+	}
+	return parts[0], prefix, true
+}
+
+// publishedSnapshotKey is the key of the account's snapshot pulled at the
+// time, under the prefix
+func publishedSnapshotKey(prefix string, account *Account, now time.Time) string {
+	key := fmt.Sprintf("%s/%s.json", account.String(), now.UTC().Format("20060102T150405Z"))
+	if prefix != "" {
+		key = prefix + "/" + key
+	}
+	return key
+}
+
+// PublishSnapshot writes the account data as a JSON snapshot to an S3 bucket
+// with Object Lock enabled, at s3://BUCKET/PREFIX/ALIAS-ID/TIME.json, with a
+// manifest of its SHA-256 digest next to it at TIME.manifest.json. Both are
+// locked for the retention, so neither can be changed or deleted until it
+// ends. It returns the manifest
+func PublishSnapshot(location string, retention SnapshotRetention, data *AccountData, now time.Time, version string) (*SnapshotManifest, error) {
+	bucket, _, ok := parseS3Prefix(location)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't an s3://BUCKET/PREFIX location", location)
+	}
+	c := newS3Client(awsSession())
+	region, err := c.bucketRegion(bucket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error finding the region of bucket %s", bucket)
+	}
+	return publishSnapshot(c.withRegion(region), location, retention, data, now, version)
+}
+
+func publishSnapshot(client s3iface.S3API, location string, retention SnapshotRetention, data *AccountData, now time.Time, version string) (*SnapshotManifest, error) {
+	bucket, prefix, ok := parseS3Prefix(location)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't an s3://BUCKET/PREFIX location", location)
+	}
+
+	lock, err := client.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading the Object Lock configuration of bucket %s", bucket)
+	}
+	config := lock.ObjectLockConfiguration
+	if config == nil || aws.StringValue(config.ObjectLockEnabled) != s3.ObjectLockEnabledEnabled {
+		return nil, fmt.Errorf("Bucket %s doesn't have Object Lock enabled, so the snapshots could be changed or deleted", bucket)
+	}
+	if retention.Days == 0 && (config.Rule == nil || config.Rule.DefaultRetention == nil) {
+		return nil, fmt.Errorf("Bucket %s has no default retention, give the days to retain the snapshots for", bucket)
+	}
+
+	var snapshot bytes.Buffer
+	if err = WriteSnapshot(&snapshot, data); err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(snapshot.Bytes())
+	key := publishedSnapshotKey(prefix, data.Account, now)
+	manifest := &SnapshotManifest{
+		Account:       data.Account.String(),
+		PulledAt:      now.UTC().Truncate(time.Second),
+		Snapshot:      fmt.Sprintf("s3://%s/%s", bucket, key),
+		Size:          snapshot.Len(),
+		Sha256:        hex.EncodeToString(digest[:]),
+		FormatVersion: SnapshotFormatVersion,
+		IamyVersion:   version,
+	}
+	if retention.Days > 0 {
+		until := manifest.PulledAt.AddDate(0, 0, retention.Days)
+		manifest.RetentionMode = retention.Mode
+		manifest.RetainUntil = &until
+	} else {
+		manifest.RetentionMode = aws.StringValue(config.Rule.DefaultRetention.Mode)
+	}
+
+	if err = putLockedObject(client, bucket, key, snapshot.Bytes(), manifest); err != nil {
+		return nil, err
+	}
+	m, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	manifestKey := strings.TrimSuffix(key, ".json") + ".manifest.json"
+	if err = putLockedObject(client, bucket, manifestKey, append(m, '\n'), manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// putLockedObject writes an object locked for the manifest's retention, or
+// the bucket's default retention without one. S3 requires the Content-MD5
+// of objects written with a retention
+func putLockedObject(client s3iface.S3API, bucket, key string, body []byte, manifest *SnapshotManifest) error {
+	sum := md5.Sum(body)
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+		ContentMD5:  aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		Metadata:    map[string]*string{"snapshot-sha256": aws.String(manifest.Sha256)},
+	}
+	if manifest.RetainUntil != nil {
+		input.ObjectLockMode = aws.String(manifest.RetentionMode)
+		input.ObjectLockRetainUntilDate = manifest.RetainUntil
+	}
+	_, err := client.PutObject(input)
+	return errors.Wrapf(err, "Error writing s3://%s/%s", bucket, key)
+}
@@ -0,0 +1,80 @@
+package iamy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// lockedS3 is a bucket with an Object Lock configuration, recording the
+// objects written to it
+type lockedS3 struct {
+	s3iface.S3API
+	config  *s3.ObjectLockConfiguration
+	objects map[string][]byte
+	puts    []*s3.PutObjectInput
+}
+
+func (c *lockedS3) GetObjectLockConfiguration(in *s3.GetObjectLockConfigurationInput) (*s3.GetObjectLockConfigurationOutput, error) {
+	return &s3.GetObjectLockConfigurationOutput{ObjectLockConfiguration: c.config}, nil
+}
+
+func (c *lockedS3) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	b, err := ioutil.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.objects[aws.StringValue(in.Key)] = b
+	c.puts = append(c.puts, in)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestPublishSnapshot(t *testing.T) {
+	data := NewAccountData("myalias-123")
+	data.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: mustPolicyDocument(t, `{"Statement":[]}`)})
+	now := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	client := &lockedS3{objects: map[string][]byte{}, config: &s3.ObjectLockConfiguration{}}
+	if _, err := publishSnapshot(client, "s3://audit/iamy", SnapshotRetention{Mode: "COMPLIANCE", Days: 30}, data, now, "v1"); err == nil || !strings.Contains(err.Error(), "Object Lock") {
+		t.Errorf("Expected an error for a bucket without Object Lock, got %v", err)
+	}
+
+	client.config.ObjectLockEnabled = aws.String(s3.ObjectLockEnabledEnabled)
+	if _, err := publishSnapshot(client, "s3://audit/iamy", SnapshotRetention{Mode: "COMPLIANCE"}, data, now, "v1"); err == nil || !strings.Contains(err.Error(), "default retention") {
+		t.Errorf("Expected an error without a retention, got %v", err)
+	}
+
+	manifest, err := publishSnapshot(client, "s3://audit/iamy/", SnapshotRetention{Mode: "COMPLIANCE", Days: 30}, data, now, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, ok := client.objects["iamy/myalias-123/20200301T103000Z.json"]
+	if !ok || manifest.Snapshot != "s3://audit/iamy/myalias-123/20200301T103000Z.json" {
+		t.Fatalf("Expected the snapshot under the prefix, got %v and %v", manifest.Snapshot, client.objects)
+	}
+	digest := sha256.Sum256(snapshot)
+	if manifest.Sha256 != hex.EncodeToString(digest[:]) || manifest.Size != len(snapshot) {
+		t.Errorf("Expected the manifest to have the snapshot's digest, got %+v", manifest)
+	}
+
+	var written SnapshotManifest
+	if err = json.Unmarshal(client.objects["iamy/myalias-123/20200301T103000Z.manifest.json"], &written); err != nil {
+		t.Fatal(err)
+	}
+	if written.Sha256 != manifest.Sha256 || written.RetainUntil == nil || !written.RetainUntil.Equal(now.AddDate(0, 0, 30)) {
+		t.Errorf("Expected the manifest written with the retention, got %+v", written)
+	}
+	for _, put := range client.puts[len(client.puts)-2:] {
+		if aws.StringValue(put.ObjectLockMode) != "COMPLIANCE" || put.ContentMD5 == nil {
+			t.Errorf("Expected %s locked in compliance mode, got %v", aws.StringValue(put.Key), put)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package iamy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const sourceIpConditionKey = "aws:sourceip"
+
+// A SourceIpRange is an address range used in an aws:SourceIp condition,
+// and any problems found with it
+type SourceIpRange struct {
+	Statement PolicyStatement
+	Operator  string
+	Value     string
+	Problems  []string
+
+	network *net.IPNet
+}
+
+// parseSourceIp parses an address or CIDR as AWS accepts them in
+// aws:SourceIp conditions, returning a problem if it's not canonical
+func parseSourceIp(value string) (*net.IPNet, string) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, "not a valid IP address or CIDR"
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, ""
+	}
+
+	ip, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, "not a valid IP address or CIDR"
+	}
+	if !ip.Equal(network.IP) {
+		return network, "has host bits set, it's equivalent to " + network.String()
+	}
+	return network, ""
+}
+
+func networksOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// networkContains returns whether outer contains all of inner
+func networkContains(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
+// SourceIpReport finds every aws:SourceIp condition in the account's
+// policies. Ranges are checked for validity, for overlapping other ranges in
+// the same condition and, if an allowlist is given, for not being within it,
+// which flags statements still referencing decommissioned ranges
+func SourceIpReport(data *AccountData, allowlist []*net.IPNet) []SourceIpRange {
+	report := []SourceIpRange{}
+
+	for _, statement := range data.PolicyStatements() {
+		for _, condition := range statement.Conditions() {
+			base := baseConditionOperator(condition.Operator)
+			if (base != "IpAddress" && base != "NotIpAddress") || strings.ToLower(condition.Key) != sourceIpConditionKey {
+				continue
+			}
+
+			ranges := []SourceIpRange{}
+			for _, v := range condition.Values {
+				r := SourceIpRange{Statement: statement, Operator: condition.Operator, Value: v}
+				var problem string
+				r.network, problem = parseSourceIp(v)
+				if problem != "" {
+					r.Problems = append(r.Problems, problem)
+				}
+				ranges = append(ranges, r)
+			}
+
+			for i := range ranges {
+				if ranges[i].network == nil {
+					continue
+				}
+				for j := range ranges {
+					if i != j && ranges[j].network != nil && networksOverlap(ranges[i].network, ranges[j].network) {
+						ranges[i].Problems = append(ranges[i].Problems, "overlaps "+ranges[j].Value)
+					}
+				}
+				if len(allowlist) > 0 && !allowlistContains(allowlist, ranges[i].network) {
+					ranges[i].Problems = append(ranges[i].Problems, "not in the allowlist")
+				}
+			}
+
+			report = append(report, ranges...)
+		}
+	}
+
+	return report
+}
+
+func allowlistContains(allowlist []*net.IPNet, network *net.IPNet) bool {
+	for _, allowed := range allowlist {
+		if networkContains(allowed, network) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadCidrList reads addresses and CIDRs, one per line. Blank lines and
+// anything after a # are ignored
+func ReadCidrList(r io.Reader) ([]*net.IPNet, error) {
+	result := []*net.IPNet{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if idx := strings.Index(text, "#"); idx >= 0 {
+			text = text[:idx]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		network, problem := parseSourceIp(text)
+		if network == nil {
+			return nil, errors.Errorf("Line %d: %s is %s", line, text, problem)
+		}
+		result = append(result, network)
+	}
+
+	return result, scanner.Err()
+}
@@ -0,0 +1,40 @@
+package iamy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSourceIpReport(t *testing.T) {
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{
+		iamService: iamService{Name: "office-only", Path: "/"},
+		Policy:     mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Sid":"DenyOutsideOffice","Effect":"Deny","Action":"*","Resource":"*","Condition":{"NotIpAddress":{"aws:SourceIp":["10.0.0.0/8","10.1.0.0/16","192.0.2.1/24","2001:db8::/32","not-an-ip"]}}}]}`),
+	})
+
+	allowlist, err := ReadCidrList(strings.NewReader("# offices\n10.0.0.0/8\n\n192.0.2.0/24 # old office\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems := map[string]string{}
+	for _, r := range SourceIpReport(data, allowlist) {
+		if r.Statement.String() != "myalias-123/iam/policy/office-only.yaml Policy statement DenyOutsideOffice" {
+			t.Errorf("Unexpected statement %s", r.Statement)
+		}
+		problems[r.Value] = strings.Join(r.Problems, ", ")
+	}
+
+	expected := map[string]string{
+		"10.0.0.0/8":    "overlaps 10.1.0.0/16",
+		"10.1.0.0/16":   "overlaps 10.0.0.0/8",
+		"192.0.2.1/24":  "has host bits set, it's equivalent to 192.0.2.0/24",
+		"2001:db8::/32": "not in the allowlist",
+		"not-an-ip":     "not a valid IP address or CIDR",
+	}
+	for value, problem := range expected {
+		if problems[value] != problem {
+			t.Errorf("Expected %s to have problems %q, got %q", value, problem, problems[value])
+		}
+	}
+}
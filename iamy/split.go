@@ -0,0 +1,135 @@
+package iamy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SplitSuggestionsFileName is the file in an account's directory that pull
+// writes suggested managed policy splits to. The loader ignores it
+const SplitSuggestionsFileName = ".iamy-split-suggestions.yaml"
+
+// MaxManagedPolicySize is the most characters a managed policy document can
+// have, without whitespace
+const MaxManagedPolicySize = 6144
+
+// SplitThresholds are when an entity's inline policies are big enough to
+// suggest moving them to managed policies
+type SplitThresholds struct {
+	// Percent of the entity's inline policy size quota used, or 0 to ignore
+	// the size
+	Percent float64
+	// Count of inline policies, or 0 to ignore the count
+	Count int
+}
+
+// A SplitSuggestion proposes replacing an entity's inline policies with
+// managed policies holding the same statements, each small enough for the
+// managed policy size quota
+type SplitSuggestion struct {
+	Resource        string           `json:"Resource"`
+	Reason          string           `json:"Reason"`
+	InlinePolicies  []string         `json:"InlinePolicies"`
+	ManagedPolicies []SuggestedSplit `json:"ManagedPolicies"`
+}
+
+// A SuggestedSplit is a proposed managed policy
+type SuggestedSplit struct {
+	Name   string          `json:"Name"`
+	Path   string          `json:"Path"`
+	Policy *PolicyDocument `json:"Policy"`
+}
+
+// SuggestInlinePolicySplits suggests splitting out the inline policies of the
+// users, groups and roles that exceed either threshold, against the inline
+// policy size quota limits by quota name
+func SuggestInlinePolicySplits(data *AccountData, thresholds SplitThresholds, limits map[string]int) []SplitSuggestion {
+	suggestions := []SplitSuggestion{}
+	suggest := func(r AwsResource, inlinePolicies []InlinePolicy) {
+		quota := r.ResourceType() + "-inline-policy-size"
+		usage := QuotaUsage{quota, Arn(r, data.Account), inlinePolicySize(inlinePolicies), limits[quota]}
+
+		var reason string
+		switch {
+		case thresholds.Percent > 0 && usage.Percent() >= thresholds.Percent:
+			reason = fmt.Sprintf("Inline policies use %.0f%% of the %s quota, %d of %d", usage.Percent(), quota, usage.Used, usage.Limit)
+		case thresholds.Count > 0 && len(inlinePolicies) >= thresholds.Count:
+			reason = fmt.Sprintf("Has %d inline policies", len(inlinePolicies))
+		default:
+			return
+		}
+
+		s := SplitSuggestion{Resource: resourceKey(r), Reason: reason}
+		for _, ip := range inlinePolicies {
+			s.InlinePolicies = append(s.InlinePolicies, ip.Name)
+		}
+		docs := packStatements(inlinePolicies)
+		for i, doc := range docs {
+			name := r.ResourceName() + "-inline"
+			if len(docs) > 1 {
+				name = fmt.Sprintf("%s-%d", name, i+1)
+			}
+			s.ManagedPolicies = append(s.ManagedPolicies, SuggestedSplit{name, path(r.ResourcePath()), doc})
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	for _, u := range data.Users {
+		suggest(u, u.InlinePolicies)
+	}
+	for _, g := range data.Groups {
+		suggest(g, g.InlinePolicies)
+	}
+	for _, r := range data.Roles {
+		suggest(r, r.InlinePolicies)
+	}
+
+	return suggestions
+}
+
+// packStatements packs the statements of the inline policies into as few
+// policy documents as fit the managed policy size quota, keeping their order.
+// A statement too big for a managed policy gets a document of its own
+func packStatements(inlinePolicies []InlinePolicy) []*PolicyDocument {
+	docs := []*PolicyDocument{}
+	statements := []interface{}{}
+	newDoc := func(statements []interface{}) *PolicyDocument {
+		return &PolicyDocument{data: map[string]interface{}{"Version": "2012-10-17", "Statement": statements}}
+	}
+	size := func(doc *PolicyDocument) int {
+		data, _ := json.Marshal(doc)
+		return len(data)
+	}
+
+	for _, ip := range inlinePolicies {
+		for _, s := range ip.Policy.statements() {
+			if len(statements) > 0 && size(newDoc(append(statements, s))) > MaxManagedPolicySize {
+				docs = append(docs, newDoc(statements))
+				statements = []interface{}{}
+			}
+			statements = append(statements, s)
+		}
+	}
+	if len(statements) > 0 {
+		docs = append(docs, newDoc(statements))
+	}
+	return docs
+}
+
+// DumpSplitSuggestions writes the suggestions to the account's suggestions
+// file, or removes the file when there are none
+func (f *YamlLoadDumper) DumpSplitSuggestions(account *Account, suggestions []SplitSuggestion) error {
+	path := filepath.Join(f.Dir, account.String(), SplitSuggestionsFileName)
+	if len(suggestions) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	return writeYamlFile(path, struct {
+		Suggestions []SplitSuggestion `json:"Suggestions"`
+	}{suggestions})
+}
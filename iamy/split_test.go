@@ -0,0 +1,82 @@
+package iamy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSuggestInlinePolicySplits(t *testing.T) {
+	data := NewAccountData("123")
+
+	// a role close to its inline policy size quota, with statements too big
+	// for a single managed policy
+	big := []InlinePolicy{}
+	for i := 0; i < 3; i++ {
+		actions := []string{}
+		for j := 0; j < 170; j++ {
+			actions = append(actions, fmt.Sprintf(`"s3:Action%d%03d"`, i, j))
+		}
+		big = append(big, InlinePolicy{
+			Name:   fmt.Sprintf("big-%d", i),
+			Policy: mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":[`+strings.Join(actions, ",")+`],"Resource":"*"}]}`),
+		})
+	}
+	data.addRole(&Role{iamService: iamService{Name: "app", Path: "/team/"}, InlinePolicies: big})
+
+	small := InlinePolicy{Name: "small", Policy: mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)}
+	data.addGroup(&Group{iamService: iamService{Name: "many", Path: "/"}, InlinePolicies: []InlinePolicy{small, small, small}})
+	data.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}, InlinePolicies: []InlinePolicy{small}})
+
+	limits, _ := ParseQuotaLimits(nil)
+	suggestions := SuggestInlinePolicySplits(data, SplitThresholds{Percent: 75, Count: 3}, limits)
+	if len(suggestions) != 2 {
+		t.Fatalf("Expected suggestions for the group and role, got %+v", suggestions)
+	}
+
+	group := suggestions[0]
+	if group.Resource != "iam/group/many" || group.Reason != "Has 3 inline policies" || len(group.ManagedPolicies) != 1 || group.ManagedPolicies[0].Name != "many-inline" {
+		t.Errorf("Unexpected group suggestion %+v", group)
+	}
+
+	role := suggestions[1]
+	if role.Resource != "iam/role/team/app" || !strings.HasPrefix(role.Reason, "Inline policies use") {
+		t.Errorf("Unexpected role suggestion %+v", role)
+	}
+	if len(role.ManagedPolicies) != 2 || role.ManagedPolicies[1].Name != "app-inline-2" || role.ManagedPolicies[1].Path != "/team/" {
+		t.Fatalf("Expected the role's statements split across 2 managed policies, got %+v", role.ManagedPolicies)
+	}
+	statements := 0
+	for _, p := range role.ManagedPolicies {
+		if size := inlinePolicySize([]InlinePolicy{{Policy: p.Policy}}); size > MaxManagedPolicySize {
+			t.Errorf("Expected %s to fit a managed policy, is %d characters", p.Name, size)
+		}
+		statements += len(p.Policy.statements())
+	}
+	if statements != 3 {
+		t.Errorf("Expected the 3 statements to be kept, got %d", statements)
+	}
+
+	dir, err := ioutil.TempDir("", "splittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	yaml := YamlLoadDumper{Dir: dir}
+	if err = yaml.DumpSplitSuggestions(data.Account, suggestions); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, data.Account.String(), SplitSuggestionsFileName)
+	if content, err := ioutil.ReadFile(file); err != nil || !strings.Contains(string(content), "- Name: many-inline") {
+		t.Errorf("Expected the suggestions to be written, got %s %v", content, err)
+	}
+	if err = yaml.DumpSplitSuggestions(data.Account, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Expected the suggestions file to be removed, got %v", err)
+	}
+}
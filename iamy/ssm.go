@@ -0,0 +1,60 @@
+package iamy
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/pkg/errors"
+)
+
+type ssmClient struct {
+	ssmiface.SSMAPI
+}
+
+func newSsmClient(sess *session.Session) *ssmClient {
+	return &ssmClient{
+		ssm.New(sess),
+	}
+}
+
+// ReadStateParameter returns the PullState recorded in the SSM parameter
+// name, or nil if the parameter doesn't exist
+func ReadStateParameter(name string) (*PullState, error) {
+	resp, err := newSsmClient(awsSession()).GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == ssm.ErrCodeParameterNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "Error reading SSM parameter %s", name)
+	}
+
+	var state PullState
+	if err = json.Unmarshal([]byte(aws.StringValue(resp.Parameter.Value)), &state); err != nil {
+		return nil, errors.Wrapf(err, "Error decoding SSM parameter %s", name)
+	}
+
+	return &state, nil
+}
+
+// WriteStateParameter records state in the SSM parameter name
+func WriteStateParameter(name string, state PullState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = newSsmClient(awsSession()).PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(string(b)),
+		Type:      aws.String(ssm.ParameterTypeString),
+		Overwrite: aws.Bool(true),
+	})
+
+	return errors.Wrapf(err, "Error writing SSM parameter %s", name)
+}
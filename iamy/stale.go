@@ -0,0 +1,63 @@
+package iamy
+
+import (
+	"time"
+)
+
+// A StaleResource is a user, role or managed policy created long enough ago
+// that it should be in use, but that grants or is granted nothing
+type StaleResource struct {
+	Resource AwsResource
+	File     string
+	Created  time.Time
+	Problem  string
+}
+
+// createDate returns when a user, role or managed policy was created, as
+// recorded by the pull, or nil when it wasn't
+func createDate(r AwsResource) *time.Time {
+	switch r := r.(type) {
+	case *User:
+		return r.CreateDate
+	case *Role:
+		return r.CreateDate
+	case *Policy:
+		return r.CreateDate
+	}
+	return nil
+}
+
+// StaleReport returns the users, roles and customer managed policies created
+// before the cutoff that look abandoned: users that aren't in a group and
+// have no policies, roles with no policies, and managed policies that aren't
+// attached to anything or used as a permissions boundary. Resources without a
+// CreateDate, which haven't been pulled since it was recorded, are skipped
+func StaleReport(data *AccountData, cutoff time.Time) []StaleResource {
+	result := []StaleResource{}
+	add := func(r AwsResource, problem string) {
+		created := createDate(r)
+		if created == nil || !created.Before(cutoff) {
+			return
+		}
+		result = append(result, StaleResource{Resource: r, File: data.ResourceFile(r), Created: *created, Problem: problem})
+	}
+
+	for _, u := range data.Users {
+		if len(u.Groups) == 0 && len(u.Policies) == 0 && len(u.InlinePolicies) == 0 {
+			add(u, "isn't in a group and has no policies")
+		}
+	}
+	for _, r := range data.Roles {
+		if len(r.Policies) == 0 && len(r.InlinePolicies) == 0 {
+			add(r, "has no policies")
+		}
+	}
+
+	used := data.usedPolicyRefs()
+	for _, p := range data.Policies {
+		if !stringSliceContains(used, policyRef(p)) {
+			add(p, "isn't attached to anything")
+		}
+	}
+	return result
+}
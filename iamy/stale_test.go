@@ -0,0 +1,65 @@
+package iamy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaleReport(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	policy := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+	old := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	cutoff := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	data := NewAccountData("123")
+	data.addUser(&User{iamService: iamService{Name: "idle", Path: "/"}, CreateDate: &old})
+	data.addUser(&User{iamService: iamService{Name: "member", Path: "/"}, Groups: []string{"devs"}, CreateDate: &old})
+	data.addUser(&User{iamService: iamService{Name: "new", Path: "/"}, CreateDate: &recent})
+	data.addUser(&User{iamService: iamService{Name: "unpulled", Path: "/"}})
+	data.addRole(&Role{iamService: iamService{Name: "empty", Path: "/app/"}, AssumeRolePolicyDocument: trust, CreateDate: &old})
+	data.addRole(&Role{iamService: iamService{Name: "used", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{"team/reader"}, PermissionsBoundary: "boundary", CreateDate: &old})
+	data.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/team/"}, Policy: policy, CreateDate: &old})
+	data.addPolicy(&Policy{iamService: iamService{Name: "boundary", Path: "/"}, Policy: policy, CreateDate: &old})
+	data.addPolicy(&Policy{iamService: iamService{Name: "orphan", Path: "/"}, Policy: policy, CreateDate: &old})
+
+	found := []string{}
+	for _, s := range StaleReport(data, cutoff) {
+		if !s.Created.Equal(old) {
+			t.Errorf("Expected %s created at %s, got %s", resourceKey(s.Resource), old, s.Created)
+		}
+		found = append(found, resourceKey(s.Resource)+": "+s.Problem+" in "+s.File)
+	}
+	expected := []string{
+		"iam/user/idle: isn't in a group and has no policies in 123/iam/user/idle.yaml",
+		"iam/role/app/empty: has no policies in 123/iam/role/app/empty.yaml",
+		"iam/policy/orphan: isn't attached to anything in 123/iam/policy/orphan.yaml",
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, found)
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], found[i])
+		}
+	}
+}
+
+func TestCreateDateIsInformational(t *testing.T) {
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	created := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	remoteData := NewAccountData("123")
+	remoteData.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}, CreateDate: &created})
+	remoteData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: trust, CreateDate: &created})
+	localData := NewAccountData("123")
+	localData.addUser(&User{iamService: iamService{Name: "alice", Path: "/"}})
+	localData.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}, AssumeRolePolicyDocument: trust})
+
+	if drifts := DetectDrift(remoteData, localData); len(drifts) != 0 {
+		t.Errorf("Expected no drift from CreateDate, got %+v", drifts)
+	}
+	if cmds := PlanSync(remoteData, localData).Cmds; len(cmds) != 0 {
+		t.Errorf("Expected no commands, got %s", cmds)
+	}
+}
@@ -0,0 +1,72 @@
+package iamy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// StateFileName is the file in the yaml directory that records how each
+// account was last pulled
+const StateFileName = ".iamy-state"
+
+// PullState records how an account was last pulled, so pushes from an older
+// version of iamy, with different options or from a stale pull can be warned
+// about
+type PullState struct {
+	Version string `json:"Version"`
+	// LastPull is the day of the last pull, so pulling again the same day
+	// leaves the state file as it is
+	LastPull    time.Time `json:"LastPull"`
+	OptionsHash string    `json:"OptionsHash"`
+	// AwsManagedPolicies are the default versions of the AWS managed policies
+	// the account refers to, by ARN, so pulls and pushes can report AWS
+	// updating them
+	AwsManagedPolicies map[string]string `json:"AwsManagedPolicies,omitempty"`
+}
+
+// ReadStateFile returns the PullState of each account pulled into dir, keyed
+// by account
+func ReadStateFile(dir string) (map[string]PullState, error) {
+	states := map[string]PullState{}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, StateFileName))
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(data, &states); err != nil {
+		return nil, errors.Wrapf(err, "Error reading %s", StateFileName)
+	}
+
+	return states, nil
+}
+
+// WriteStateFile records the PullState of account in dir, keeping the state
+// of other accounts. The file is only rewritten when its content changes
+func WriteStateFile(dir string, account *Account, state PullState) error {
+	states, err := ReadStateFile(dir)
+	if err != nil {
+		return err
+	}
+	states[account.String()] = state
+
+	data, err := yaml.Marshal(states)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, StateFileName)
+	if existing, err := ioutil.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,52 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteStateFileKeepsOtherAccounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pulled := time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC)
+	if err = WriteStateFile(dir, &Account{Id: "123", Alias: "one"}, PullState{Version: "1.0.0", LastPull: pulled}); err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteStateFile(dir, &Account{Id: "456"}, PullState{Version: "1.1.0", LastPull: pulled, OptionsHash: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := ReadStateFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("Expected 2 accounts, got %v", states)
+	}
+	if s := states["one-123"]; s.Version != "1.0.0" || !s.LastPull.Equal(pulled) {
+		t.Errorf("Unexpected state for one-123: %+v", s)
+	}
+	if s := states["456"]; s.OptionsHash != "abc" {
+		t.Errorf("Unexpected state for 456: %+v", s)
+	}
+
+	// the same state again leaves the file as it is
+	path := filepath.Join(dir, StateFileName)
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err = os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteStateFile(dir, &Account{Id: "456"}, PullState{Version: "1.1.0", LastPull: pulled, OptionsHash: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("Expected the unchanged state not to be rewritten, got %v %v", info, err)
+	}
+}
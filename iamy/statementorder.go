@@ -0,0 +1,218 @@
+package iamy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/ghodss/yaml"
+)
+
+// The orders the statements of policy documents can be written to the files
+// in, set with StatementOrder in the layout file. Statements are always
+// compared in their canonical order, so the order is only how they're
+// written, and reordering them is never a change to push
+const (
+	// StatementOrderCanonical writes statements by Sid, then by their
+	// content, the order they're compared in
+	StatementOrderCanonical = "canonical"
+	// StatementOrderEffect writes statements by Effect, then Sid, then their
+	// first action, so allows and denies are grouped
+	StatementOrderEffect = "effect"
+	// StatementOrderPreserve keeps the statements already in a file in the
+	// order they're written in, for authors ordering them for readability.
+	// New statements follow in the canonical order
+	StatementOrderPreserve = "preserve"
+)
+
+// StatementOrders are the orders statements can be written in
+var StatementOrders = []string{StatementOrderCanonical, StatementOrderEffect, StatementOrderPreserve}
+
+// policyStatements returns the list of statements of a policy document
+func policyStatements(doc interface{}) ([]interface{}, bool) {
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	statements, ok := m["Statement"].([]interface{})
+	return statements, ok
+}
+
+// normalisedStatement returns the normalised JSON of a statement, the same
+// however it's written
+func normalisedStatement(s interface{}) string {
+	b, _ := json.Marshal(recursivelyNormaliseAwsPolicy(s))
+	return string(b)
+}
+
+// firstAction returns the first action, or not action, of a statement
+func firstAction(statement map[string]interface{}) string {
+	for _, key := range []string{"Action", "NotAction"} {
+		if values := stringOrSlice(statement[key]); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// sortStatementsByEffect sorts the statements of a policy document by
+// Effect, Sid and first action, then by their content
+func sortStatementsByEffect(doc interface{}) interface{} {
+	statements, ok := policyStatements(doc)
+	if !ok {
+		return doc
+	}
+	type sortable struct {
+		effect, sid, action, json string
+		statement                 interface{}
+	}
+	keyed := make([]sortable, len(statements))
+	for i, s := range statements {
+		keyed[i].statement = s
+		if m, ok := s.(map[string]interface{}); ok {
+			keyed[i].effect, _ = m["Effect"].(string)
+			keyed[i].sid, _ = m["Sid"].(string)
+			keyed[i].action = firstAction(m)
+		}
+		keyed[i].json = normalisedStatement(s)
+	}
+	sort.SliceStable(keyed, func(i, j int) bool {
+		a, b := keyed[i], keyed[j]
+		switch {
+		case a.effect != b.effect:
+			return a.effect < b.effect
+		case a.sid != b.sid:
+			return a.sid < b.sid
+		case a.action != b.action:
+			return a.action < b.action
+		}
+		return a.json < b.json
+	})
+	for i := range keyed {
+		statements[i] = keyed[i].statement
+	}
+	return doc
+}
+
+// orderStatementsLike orders the statements of a policy document the way the
+// same statements are ordered in the previous version of the document, the
+// new ones following in their order. Statements with a Sid are the same as
+// the previous statement with the Sid, and others as one with the same
+// content
+func orderStatementsLike(previous, doc interface{}) {
+	statements, ok := policyStatements(doc)
+	previousStatements, hasPrevious := policyStatements(previous)
+	if !ok || !hasPrevious {
+		return
+	}
+	key := func(s interface{}) string {
+		if m, ok := s.(map[string]interface{}); ok {
+			if sid, _ := m["Sid"].(string); sid != "" {
+				return "sid:" + sid
+			}
+		}
+		return "json:" + normalisedStatement(s)
+	}
+
+	keys := make([]string, len(statements))
+	used := make([]bool, len(statements))
+	for i, s := range statements {
+		keys[i] = key(s)
+	}
+	ordered := []interface{}{}
+	for _, p := range previousStatements {
+		k := key(p)
+		for i := range statements {
+			if !used[i] && keys[i] == k {
+				used[i] = true
+				ordered = append(ordered, statements[i])
+				break
+			}
+		}
+	}
+	for i, s := range statements {
+		if !used[i] {
+			ordered = append(ordered, s)
+		}
+	}
+	copy(statements, ordered)
+}
+
+// preserveStatementOrder orders the statements of the policy documents in the
+// content of a file like they are in its previous content. Lists of inline
+// policies are matched by name
+func preserveStatementOrder(previous, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		p, _ := previous.(map[string]interface{})
+		for k, child := range v {
+			if isPolicyDocument(k, child) {
+				orderStatementsLike(p[k], child)
+			} else {
+				preserveStatementOrder(p[k], child)
+			}
+		}
+	case []interface{}:
+		p, _ := previous.([]interface{})
+		for i, child := range v {
+			var match interface{}
+			if i < len(p) {
+				match = p[i]
+			}
+			if m, ok := child.(map[string]interface{}); ok {
+				if name, ok := m["Name"].(string); ok {
+					match = nil
+					for _, candidate := range p {
+						if c, ok := candidate.(map[string]interface{}); ok && c["Name"] == name {
+							match = candidate
+						}
+					}
+				}
+			}
+			preserveStatementOrder(match, child)
+		}
+	}
+}
+
+// withStatementOrder returns the content of a file with the statements of
+// its policy documents in the order. The canonical order is the order they
+// already have. To preserve the order, the previous content is read from the
+// file, and without one the statements stay in the canonical order. A file of
+// a policy document alone is a document
+func withStatementOrder(path string, content interface{}, order string, document bool) (interface{}, error) {
+	if order == "" || order == StatementOrderCanonical {
+		return content, nil
+	}
+	generic, err := genericContent(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if order == StatementOrderEffect {
+		if document {
+			return sortStatementsByEffect(generic), nil
+		}
+		eachPolicyDocument(generic, sortStatementsByEffect)
+		return generic, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return content, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a file that no longer parses has no order to preserve
+	var previous interface{}
+	if err = yaml.Unmarshal(data, &previous); err != nil {
+		return content, nil
+	}
+	if document {
+		orderStatementsLike(previous, generic)
+	} else {
+		preserveStatementOrder(previous, generic)
+	}
+	return generic, nil
+}
@@ -0,0 +1,144 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+// fileSids returns the Sids of the statements of the managed policy's file,
+// in the order they're written
+func fileSids(t *testing.T, file string) []string {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content struct {
+		Policy struct {
+			Statement []struct {
+				Sid string
+			}
+		}
+	}
+	if err = yaml.Unmarshal(b, &content); err != nil {
+		t.Fatal(err)
+	}
+	sids := []string{}
+	for _, s := range content.Policy.Statement {
+		sids = append(sids, s.Sid)
+	}
+	return sids
+}
+
+func TestStatementOrder(t *testing.T) {
+	doc := `{"Version":"2012-10-17","Statement":[
+		{"Sid":"ReadLogs","Effect":"Allow","Action":"logs:GetLogEvents","Resource":"*"},
+		{"Sid":"NoDelete","Effect":"Deny","Action":"s3:DeleteObject","Resource":"*"},
+		{"Sid":"ListBuckets","Effect":"Allow","Action":"s3:ListAllMyBuckets","Resource":"*"},
+		{"Sid":"GetObjects","Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{iamService: iamService{Name: "ops", Path: "/"}, Policy: mustPolicyDocument(t, doc)})
+	data.SortCanonically()
+	file := filepath.Join("myalias-123", "iam", "policy", "ops.yaml")
+
+	expected := map[string][]string{
+		StatementOrderCanonical: {"GetObjects", "ListBuckets", "NoDelete", "ReadLogs"},
+		StatementOrderEffect:    {"GetObjects", "ListBuckets", "ReadLogs", "NoDelete"},
+		StatementOrderPreserve:  {"GetObjects", "ListBuckets", "NoDelete", "ReadLogs"},
+	}
+	for _, order := range StatementOrders {
+		dir, err := ioutil.TempDir("", "iamy-statement-order")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if err = ioutil.WriteFile(filepath.Join(dir, LayoutFileName), []byte("StatementOrder: "+order+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		y := YamlLoadDumper{Dir: dir}
+		if err = y.Dump(data, false); err != nil {
+			t.Fatalf("%s: %s", order, err)
+		}
+		if sids := fileSids(t, filepath.Join(dir, file)); !reflect.DeepEqual(sids, expected[order]) {
+			t.Errorf("%s: expected the statements in the order %v, got %v", order, expected[order], sids)
+		}
+
+		loaded, err := y.Load()
+		if err != nil {
+			t.Fatalf("%s: %s", order, err)
+		}
+		if cmds := AwsCliCmdsForSync(data, &loaded[0]); len(cmds) > 0 {
+			t.Errorf("%s: expected the order not to be a change, got:\n%s", order, cmds)
+		}
+	}
+}
+
+func TestStatementOrderPreserve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iamy-statement-order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, LayoutFileName), []byte("StatementOrder: preserve\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "myalias-123", "iam", "policy", "ops.yaml")
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// written by hand, with the denies first and a statement without a Sid
+	if err = ioutil.WriteFile(file, []byte(`Policy:
+  Version: "2012-10-17"
+  Statement:
+  - Sid: NoDelete
+    Effect: Deny
+    Action: s3:DeleteObject
+    Resource: "*"
+  - Effect: Allow
+    Action:
+    - s3:ListAllMyBuckets
+    Resource: "*"
+  - Sid: ReadLogs
+    Effect: Allow
+    Action: logs:GetLogEvents
+    Resource: "*"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	y := YamlLoadDumper{Dir: dir}
+	loaded, err := y.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = y.Dump(&loaded[0], false); err != nil {
+		t.Fatal(err)
+	}
+	if sids := fileSids(t, file); !reflect.DeepEqual(sids, []string{"NoDelete", "", "ReadLogs"}) {
+		t.Errorf("Expected the statements to stay in the order they were written, got %v", sids)
+	}
+
+	// a new statement follows those already in the file
+	p := loaded[0].Policies[0]
+	p.Policy = mustPolicyDocument(t, strings.Replace(p.Policy.JsonString(), `"Statement": [`, `"Statement": [{"Sid":"AWrite","Effect":"Allow","Action":"s3:PutObject","Resource":"*"},`, 1))
+	p.Policy.sortStatements()
+	if err = y.Dump(&loaded[0], false); err != nil {
+		t.Fatal(err)
+	}
+	if sids := fileSids(t, file); !reflect.DeepEqual(sids, []string{"NoDelete", "", "ReadLogs", "AWrite"}) {
+		t.Errorf("Expected the new statement last, got %v", sids)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, LayoutFileName), []byte("StatementOrder: random\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadLayout(dir); err == nil || !strings.Contains(err.Error(), "Unknown StatementOrder") {
+		t.Errorf("Expected an error for an unknown order, got %v", err)
+	}
+}
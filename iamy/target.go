@@ -0,0 +1,255 @@
+package iamy
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// targetType is a type of resource selectors can select, and the fetch phase
+// that fetches it
+type targetType struct {
+	service, resourceType, phase string
+}
+
+// targetTypes are the resource types by the name selectors use, the same
+// names as ignore rules use where there is one
+var targetTypes = map[string]targetType{
+	"user":                        {"iam", "user", "iam"},
+	"group":                       {"iam", "group", "iam"},
+	"role":                        {"iam", "role", "iam"},
+	"policy":                      {"iam", "policy", "iam"},
+	"instance-profile":            {"iam", "instance-profile", "iam"},
+	"bucket":                      {"s3", "", "s3"},
+	"account-public-access-block": {"s3control", "", "s3"},
+	"accesspoint":                 {"s3control", "accesspoint", "s3 access points"},
+	"objectlambda":                {"s3control", "objectlambda", "s3 object lambda access points"},
+	"mrap":                        {"s3control", "mrap", "s3 multi-region access points"},
+	"codeartifact-domain":         {"codeartifact", "domain", "codeartifact"},
+	"codeartifact-repository":     {"codeartifact", "repository", "codeartifact"},
+	"ses-identity":                {"ses", "identity", "ses"},
+	"restapi":                     {"apigateway", "restapi", "apigateway"},
+	"vault":                       {"glacier", "vault", "glacier"},
+	"ecr-registry":                {"ecr", "registry", "ecr"},
+}
+
+// TargetTypeNames returns the types selectors can select, sorted
+func TargetTypeNames() []string {
+	names := []string{}
+	for name := range targetTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A ResourceSelector selects resources of a type by a pattern of their name,
+// or of their path and name without the leading /, where * and ? match any
+// characters, including /
+type ResourceSelector struct {
+	Type    string
+	Pattern string
+}
+
+// ParseResourceSelector parses a selector like role/my-app-*. A type on its
+// own selects every resource of the type
+func ParseResourceSelector(s string) (ResourceSelector, error) {
+	parts := strings.SplitN(s, "/", 2)
+	selector := ResourceSelector{Type: parts[0], Pattern: "*"}
+	if len(parts) == 2 {
+		selector.Pattern = parts[1]
+	}
+	if _, ok := targetTypes[selector.Type]; !ok {
+		return selector, errors.Errorf("Unknown resource type %s in %s, expected one of %s", selector.Type, s, strings.Join(TargetTypeNames(), ", "))
+	}
+	return selector, nil
+}
+
+func (s ResourceSelector) String() string {
+	return s.Type + "/" + s.Pattern
+}
+
+func (s ResourceSelector) matches(r AwsResource) bool {
+	return s.matchesName(r.Service(), r.ResourceType(), r.ResourcePath(), r.ResourceName())
+}
+
+func (s ResourceSelector) matchesName(service, resourceType, path, name string) bool {
+	t := targetTypes[s.Type]
+	if service != t.service || resourceType != t.resourceType {
+		return false
+	}
+	return globCovers(s.Pattern, name) || globCovers(s.Pattern, strings.TrimPrefix(path+name, "/"))
+}
+
+// TargetFetchPhases returns the fetch phases that fetch the resources the
+// selectors select, for AwsFetcher.Phases
+func TargetFetchPhases(selectors []ResourceSelector) []string {
+	phases := []string{}
+	for _, s := range selectors {
+		if phase := targetTypes[s.Type].phase; !stringSliceContains(phases, phase) {
+			phases = append(phases, phase)
+		}
+	}
+	return phases
+}
+
+// ParseResourceKinds parses the types of resource to restrict a pull or push
+// to, named in the singular or plural, eg. roles, and comma separated or
+// repeated. When exclude is set, every type but the named ones is selected
+func ParseResourceKinds(kinds []string, exclude bool) ([]ResourceSelector, error) {
+	named := map[string]bool{}
+	for _, list := range kinds {
+		for _, kind := range strings.Split(list, ",") {
+			kind = strings.TrimSpace(kind)
+			if kind == "" {
+				continue
+			}
+			name, ok := resourceKindName(kind)
+			if !ok {
+				return nil, errors.Errorf("Unknown resource type %s, expected one of %s", kind, strings.Join(TargetTypeNames(), ", "))
+			}
+			named[name] = true
+		}
+	}
+
+	selectors := []ResourceSelector{}
+	for _, name := range TargetTypeNames() {
+		if named[name] != exclude {
+			selectors = append(selectors, ResourceSelector{Type: name, Pattern: "*"})
+		}
+	}
+	return selectors, nil
+}
+
+// resourceKindName returns the selector type name of a singular or plural
+// resource type
+func resourceKindName(kind string) (string, bool) {
+	for _, name := range []string{kind, strings.TrimSuffix(kind, "s"), strings.TrimSuffix(kind, "ies") + "y"} {
+		if _, ok := targetTypes[name]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// FilterResourceKinds returns a copy of the account data with only the
+// resources of the types the selectors select, without the resources they
+// refer to, as those are left as they are
+func FilterResourceKinds(data *AccountData, selectors []ResourceSelector) *AccountData {
+	result := data.filter(func(r AwsResource) bool {
+		return selectsResource(selectors, r)
+	})
+	result.AwsManagedPolicyVersions = data.AwsManagedPolicyVersions
+	return result
+}
+
+// selectsResource returns whether any of the selectors selects the resource,
+// or there are none to restrict the resources to
+func selectsResource(selectors []ResourceSelector, r AwsResource) bool {
+	for _, s := range selectors {
+		if s.matches(r) {
+			return true
+		}
+	}
+	return len(selectors) == 0
+}
+
+// filter returns a copy of the account data with only the resources kept
+func (a *AccountData) filter(keep func(AwsResource) bool) *AccountData {
+	result := NewAccountData(a.Account.String())
+	result.Account = a.Account
+	result.Warnings = a.Warnings
+	result.canonicalUserId = a.canonicalUserId
+	result.layout = a.layout
+	result.loadedFrom = a.loadedFrom
+	result.sources = a.sources
+
+	for _, r := range a.resources() {
+		if keep(r) {
+			result.addResource(r)
+		}
+	}
+
+	return result
+}
+
+// dependencies returns the keys of the resources the resource refers to,
+// that must exist before it can be created
+func (a *AccountData) dependencies(r AwsResource) []string {
+	policies := func(refs ...string) []string {
+		result := []string{}
+		for _, ref := range refs {
+			if ref != "" {
+				result = append(result, "iam/policy/"+ref)
+			}
+		}
+		return result
+	}
+
+	switch r := r.(type) {
+	case *User:
+		result := policies(append(r.Policies, r.PermissionsBoundary)...)
+		for _, name := range r.Groups {
+			for _, g := range a.Groups {
+				if g.Name == name {
+					result = append(result, resourceKey(g))
+				}
+			}
+		}
+		return result
+	case *Group:
+		return policies(r.Policies...)
+	case *Role:
+		return policies(append(r.Policies, r.PermissionsBoundary)...)
+	case *InstanceProfile:
+		result := []string{}
+		for _, name := range r.Roles {
+			for _, role := range a.Roles {
+				if role.Name == name {
+					result = append(result, resourceKey(role))
+				}
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// SelectResources returns copies of the account data with only the resources
+// the selectors select, and the groups, roles and managed policies the
+// selected resources in the to data refer to, so they can be created first
+func SelectResources(from, to *AccountData, selectors []ResourceSelector) (*AccountData, *AccountData) {
+	selected := map[string]bool{}
+	pending := []AwsResource{}
+	for _, data := range []*AccountData{to, from} {
+		for _, r := range data.resources() {
+			for _, s := range selectors {
+				if s.matches(r) && !selected[resourceKey(r)] {
+					selected[resourceKey(r)] = true
+					pending = append(pending, r)
+				}
+			}
+		}
+	}
+
+	toResources := map[string]AwsResource{}
+	for _, r := range to.resources() {
+		toResources[resourceKey(r)] = r
+	}
+	for len(pending) > 0 {
+		r := pending[0]
+		pending = pending[1:]
+		for _, key := range to.dependencies(r) {
+			if dep, ok := toResources[key]; ok && !selected[key] {
+				selected[key] = true
+				pending = append(pending, dep)
+			}
+		}
+	}
+
+	keep := func(r AwsResource) bool {
+		return selected[resourceKey(r)]
+	}
+	return from.filter(keep), to.filter(keep)
+}
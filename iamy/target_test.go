@@ -0,0 +1,114 @@
+package iamy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseResourceSelector(t *testing.T) {
+	for s, expected := range map[string]ResourceSelector{
+		"role/my-app-*":   {"role", "my-app-*"},
+		"policy/team/*":   {"policy", "team/*"},
+		"bucket":          {"bucket", "*"},
+		"vault/us-east-1": {"vault", "us-east-1"},
+	} {
+		if actual, err := ParseResourceSelector(s); err != nil || actual != expected {
+			t.Errorf("Expected %s to parse as %v, got %v %v", s, expected, actual, err)
+		}
+	}
+
+	if _, err := ParseResourceSelector("lambda/my-function"); err == nil {
+		t.Error("Expected an error for an unknown type")
+	}
+}
+
+func TestSelectResources(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`)
+	trust := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+
+	remoteData := NewAccountData("123")
+	remoteData.addRole(&Role{iamService: iamService{Name: "my-app-web", Path: "/"}, AssumeRolePolicyDocument: trust})
+	remoteData.addRole(&Role{iamService: iamService{Name: "other", Path: "/"}, AssumeRolePolicyDocument: trust})
+	remoteData.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}})
+
+	localData := NewAccountData("123")
+	localData.addPolicy(&Policy{iamService: iamService{Name: "reader", Path: "/app/"}, Policy: doc})
+	localData.addRole(&Role{iamService: iamService{Name: "my-app-web", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{"app/reader"}})
+	localData.addRole(&Role{iamService: iamService{Name: "my-app-worker", Path: "/"}, AssumeRolePolicyDocument: trust})
+	localData.addRole(&Role{iamService: iamService{Name: "other", Path: "/"}, AssumeRolePolicyDocument: trust, Policies: []string{"app/reader"}})
+
+	selector, _ := ParseResourceSelector("role/my-app-*")
+	from, to := SelectResources(remoteData, localData, []ResourceSelector{selector})
+
+	names := func(data *AccountData) []string {
+		result := []string{}
+		for _, r := range data.resources() {
+			result = append(result, resourceKey(r))
+		}
+		return result
+	}
+	if actual := names(from); !reflect.DeepEqual(actual, []string{"iam/role/my-app-web"}) {
+		t.Errorf("Unexpected resources selected in AWS: %v", actual)
+	}
+	if actual := names(to); !reflect.DeepEqual(actual, []string{"iam/role/my-app-web", "iam/role/my-app-worker", "iam/policy/app/reader"}) {
+		t.Errorf("Unexpected resources selected in the files: %v", actual)
+	}
+
+	cmds := PlanSync(from, to).Cmds.String()
+	for _, unexpected := range []string{"other", "bob"} {
+		if strings.Contains(cmds, unexpected) {
+			t.Errorf("Expected only the selected resources to be pushed, got:\n%s", cmds)
+		}
+	}
+	if !strings.Contains(cmds, "create-policy --policy-name reader") {
+		t.Errorf("Expected the policy the role attaches to be created, got:\n%s", cmds)
+	}
+
+	if phases := TargetFetchPhases([]ResourceSelector{selector, {"user", "*"}, {"vault", "*"}}); !reflect.DeepEqual(phases, []string{"iam", "glacier"}) {
+		t.Errorf("Unexpected fetch phases: %v", phases)
+	}
+}
+
+func TestParseResourceKinds(t *testing.T) {
+	only, err := ParseResourceKinds([]string{"users,roles", "policies"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []ResourceSelector{{"policy", "*"}, {"role", "*"}, {"user", "*"}}; !reflect.DeepEqual(only, expected) {
+		t.Errorf("Expected %v, got %v", expected, only)
+	}
+	if phases := TargetFetchPhases(only); !reflect.DeepEqual(phases, []string{"iam"}) {
+		t.Errorf("Expected only IAM to be fetched, got %v", phases)
+	}
+
+	excluded, err := ParseResourceKinds([]string{"buckets"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(excluded) != len(targetTypes)-1 || selectorsHave(excluded, "bucket") {
+		t.Errorf("Expected every type but bucket, got %v", excluded)
+	}
+
+	if _, err = ParseResourceKinds([]string{"widgets"}, false); err == nil {
+		t.Errorf("Expected an error for an unknown type")
+	}
+
+	data := NewAccountData("123")
+	data.addRole(&Role{iamService: iamService{Name: "app", Path: "/"}})
+	data.addUser(&User{iamService: iamService{Name: "bob", Path: "/"}})
+	data.addBucketPolicy(&BucketPolicy{BucketName: "logs"})
+	roles, _ := ParseResourceKinds([]string{"role"}, false)
+	if filtered := FilterResourceKinds(data, roles); len(filtered.Roles) != 1 || len(filtered.Users) != 0 || len(filtered.BucketPolicies) != 0 {
+		t.Errorf("Expected only the role to be kept, got %+v", filtered)
+	}
+}
+
+func selectorsHave(selectors []ResourceSelector, kind string) bool {
+	for _, s := range selectors {
+		if s.Type == kind {
+			return true
+		}
+	}
+	return false
+}
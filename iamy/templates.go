@@ -0,0 +1,244 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// TemplatesDirName is the directory in the yaml directory of templates that
+// generate resources when the files are loaded, for fleets of nearly
+// identical resources
+const TemplatesDirName = "templates"
+
+// TemplateExt is the extension of the templates in TemplatesDirName
+const TemplateExt = ".yaml.tmpl"
+
+// A template is a Go template of YAML, with the functions of templateFuncs,
+// that evaluates to the account and the resources it generates, by their
+// kind, path and name, eg.
+//
+//	Account: myalias-123456789012
+//	Resources:
+//	{{- range list "api" "worker" "scheduler" }}
+//	  iam/role/services/{{ . }}:
+//	    AssumeRolePolicyDocument: ...
+//	{{- end }}
+type templateOutput struct {
+	Account   string                     `json:"Account"`
+	Resources map[string]json.RawMessage `json:"Resources"`
+}
+
+var templateFuncs = template.FuncMap{
+	"list":    func(v ...interface{}) []interface{} { return v },
+	"split":   func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":    func(sep string, v []string) string { return strings.Join(v, sep) },
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// A generatedResource is a resource a template generates
+type generatedResource struct {
+	template string
+	account  string
+	entity   string
+	path     string
+	name     string
+	content  json.RawMessage
+}
+
+func (g generatedResource) key() string {
+	return g.account + " " + g.entity + g.path + g.name
+}
+
+// templateFiles returns the templates, relative to the directory
+func (f *YamlLoadDumper) templateFiles() ([]string, error) {
+	files := []string{}
+	root := filepath.Join(f.Dir, TemplatesDirName)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == root {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, TemplateExt) {
+			rel, err := filepath.Rel(f.Dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// evaluateTemplate returns the resources the template generates
+func (f *YamlLoadDumper) evaluateTemplate(file string) ([]generatedResource, error) {
+	t, err := template.New(filepath.Base(file)).Funcs(templateFuncs).Option("missingkey=error").ParseFiles(filepath.Join(f.Dir, filepath.FromSlash(file)))
+	if err != nil {
+		return nil, validationError(file, err)
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, nil); err != nil {
+		return nil, validationError(file, err)
+	}
+
+	var out templateOutput
+	if err = f.unmarshalYaml(file, buf.Bytes(), &out); err != nil {
+		if _, ok := err.(*ErrValidation); ok {
+			return nil, err
+		}
+		return nil, validationError(file, errors.Wrap(err, "The template doesn't evaluate to valid YAML"))
+	}
+	if !accountReg.MatchString(out.Account) {
+		return nil, validationError(file, errors.New("Account must be the ALIAS-ID of the account the resources are in"))
+	}
+
+	keys := []string{}
+	for key := range out.Resources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	generated := []generatedResource{}
+	for _, key := range keys {
+		_, entity, path, name, ok := defaultLayout.parse(out.Account + "/" + strings.Trim(key, "/") + ".yaml")
+		if !ok {
+			return nil, validationError(file, fmt.Errorf("%s isn't a resource's kind, path and name, eg. iam/role/services/api", key))
+		}
+		generated = append(generated, generatedResource{file, out.Account, entity, path, name, out.Resources[key]})
+	}
+	return generated, nil
+}
+
+// generatedResources returns the resources the templates generate
+func (f *YamlLoadDumper) generatedResources() ([]generatedResource, error) {
+	files, err := f.templateFiles()
+	if err != nil {
+		return nil, err
+	}
+	generated := []generatedResource{}
+	from := map[string]string{}
+	for _, file := range files {
+		resources, err := f.evaluateTemplate(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range resources {
+			if other, ok := from[g.key()]; ok {
+				return nil, validationError(file, fmt.Errorf("%s%s%s is also generated by %s", g.entity, g.path, g.name, other))
+			}
+			from[g.key()] = file
+		}
+		generated = append(generated, resources...)
+	}
+	return generated, nil
+}
+
+// unmarshal unmarshals the resource's content, as YAML like a file
+func (g generatedResource) unmarshal(v interface{}) error {
+	y, err := yaml.JSONToYAML(g.content)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(y, v)
+}
+
+// loadGenerated adds the resources the templates generate to the accounts.
+// A resource can't be both generated and in a file
+func (f *YamlLoadDumper) loadGenerated(accounts map[string]*AccountData, layout *Layout) error {
+	generated, err := f.generatedResources()
+	if err != nil {
+		return err
+	}
+	f.generated = map[string]string{}
+	for _, g := range generated {
+		data, ok := accounts[g.account]
+		if !ok {
+			data = NewAccountData(g.account)
+			data.layout = layout
+			accounts[g.account] = data
+		}
+		for _, r := range data.resources() {
+			if data.Account.String()+" "+resourceKind(r)+r.ResourcePath()+r.ResourceName() == g.key() {
+				return validationError(g.template, fmt.Errorf("%s%s%s is also in %s", g.entity, g.path, g.name, data.ResourceFile(r)))
+			}
+		}
+
+		resource, err := f.loadResource(data, g.entity, g.path, g.name, g.unmarshal)
+		if err != nil {
+			return validationError(g.template, errors.Wrapf(err, "%s%s%s", g.entity, g.path, g.name))
+		}
+		if resource != nil {
+			f.generated[g.key()] = g.template
+		}
+	}
+	return nil
+}
+
+// generatedBy returns the template that generates the resource, or empty
+// when it's in a file. The templates are evaluated the first time it's
+// needed when the files weren't loaded
+func (f *YamlLoadDumper) generatedBy(a *Account, r AwsResource) (string, error) {
+	if f.generated == nil {
+		generated, err := f.generatedResources()
+		if err != nil {
+			return "", err
+		}
+		f.generated = map[string]string{}
+		for _, g := range generated {
+			f.generated[g.key()] = g.template
+		}
+	}
+	return f.generated[a.String()+" "+resourceKind(r)+r.ResourcePath()+r.ResourceName()], nil
+}
+
+// TemplateDrift returns warnings for the resources the templates generate
+// that differ from the account data or are missing from it, as a pull
+// writes no files for them, and their templates need changing instead
+func (f *YamlLoadDumper) TemplateDrift(data *AccountData) (Warnings, error) {
+	warnings := Warnings{}
+	generated, err := f.generatedResources()
+	if err != nil {
+		return nil, err
+	}
+	byKey := map[string]AwsResource{}
+	for _, r := range data.resources() {
+		byKey[resourceKind(r)+r.ResourcePath()+r.ResourceName()] = r
+	}
+	for _, g := range generated {
+		if g.account != data.Account.String() {
+			continue
+		}
+		key := g.entity + g.path + g.name
+		r, ok := byKey[key]
+		if !ok {
+			warnings.Add(WarningNormalised, key, fmt.Sprintf("Generated by %s, but not in AWS", g.template))
+			continue
+		}
+		templated := NewAccountData(g.account)
+		resource, err := f.loadResource(templated, g.entity, g.path, g.name, g.unmarshal)
+		if err != nil {
+			return nil, validationError(g.template, err)
+		}
+		if resource != nil && comparableJson(resource) != comparableJson(r) {
+			warnings.Add(WarningNormalised, key, fmt.Sprintf("Generated by %s, which differs from AWS. Update the template, the pull doesn't", g.template))
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,91 @@
+package iamy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iamy-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(file, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("templates/services.yaml.tmpl", `Account: myalias-123
+Resources:
+{{- range list "api" "worker" }}
+  iam/role/services/{{ . }}:
+    Description: The {{ upper . }} service
+    AssumeRolePolicyDocument:
+      Version: "2012-10-17"
+      Statement:
+      - Effect: Allow
+        Principal:
+          Service: ecs-tasks.amazonaws.com
+        Action: sts:AssumeRole
+{{- end }}
+`)
+	write("myalias-123/iam/role/admin.yaml", `AssumeRolePolicyDocument:
+  Version: "2012-10-17"
+  Statement:
+  - Effect: Allow
+    Principal:
+      AWS: arn:aws:iam::123:root
+    Action: sts:AssumeRole
+`)
+
+	files := YamlLoadDumper{Dir: dir}
+	accounts, err := files.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || len(accounts[0].Roles) != 3 {
+		t.Fatalf("Expected the file's role and the two generated roles, got %v", accounts)
+	}
+	data := &accounts[0]
+	var api *Role
+	for _, r := range data.Roles {
+		if r.Path == "/services/" && r.Description != "The "+strings.ToUpper(r.Name)+" service" {
+			t.Errorf("Expected %s's description from the template, got %q", r.Name, r.Description)
+		}
+		if r.Name == "api" {
+			api = r
+		}
+	}
+
+	// a pull writes no files for the generated roles, and warns of the ones
+	// that differ from the template
+	api.Description = "Changed in AWS"
+	if err = files.Dump(data, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "myalias-123/iam/role/services")); !os.IsNotExist(err) {
+		t.Errorf("Expected no files for the generated roles, got %v", err)
+	}
+	warnings, err := files.TemplateDrift(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "templates/services.yaml.tmpl") {
+		t.Errorf("Expected a warning of the changed role, got %v", warnings)
+	}
+
+	// a generated resource can't also be in a file
+	write("myalias-123/iam/role/services/api.yaml", "Description: Also in a file\n")
+	if _, err = (&YamlLoadDumper{Dir: dir}).Load(); err == nil || !strings.Contains(err.Error(), "is also in") {
+		t.Errorf("Expected an error for the role in a file and a template, got %v", err)
+	}
+}
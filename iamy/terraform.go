@@ -0,0 +1,350 @@
+package iamy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tfBlock is a Terraform resource, with the id to import it by. Its
+// attribute values are strings, ints, string maps, policy documents,
+// references to other blocks, or lists of strings and references, so they
+// can be rendered for Terraform or for Pulumi, whose AWS provider is bridged
+// from Terraform's and has the same resources
+type tfBlock struct {
+	resourceType string
+	label        string
+	attrs        []tfAttr
+	importId     string
+}
+
+type tfAttr struct {
+	name  string
+	value interface{}
+}
+
+// tfRef is a reference to an attribute of another exported resource
+type tfRef struct {
+	resourceType string
+	label        string
+	attr         string
+}
+
+// terraformExporter converts account data to Terraform resources, labelling
+// each uniquely and referring to the resources it exports rather than their
+// names where it can
+type terraformExporter struct {
+	data     *AccountData
+	blocks   []tfBlock
+	labels   map[string]bool
+	policies map[string]string
+	groups   map[string]string
+	roles    map[string]string
+	warnings Warnings
+}
+
+var tfLabelInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// label returns a label for the resource type that no other resource of the
+// type has, from the names given
+func (e *terraformExporter) label(resourceType string, names ...string) string {
+	label := tfLabelInvalid.ReplaceAllString(strings.Join(names, "_"), "_")
+	label = strings.Trim(label, "_")
+	if label == "" || (label[0] >= '0' && label[0] <= '9') || label[0] == '-' {
+		label = "_" + label
+	}
+	unique := label
+	for i := 2; e.labels[resourceType+"."+unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", label, i)
+	}
+	e.labels[resourceType+"."+unique] = true
+	return unique
+}
+
+func (e *terraformExporter) add(resourceType, label, importId string, attrs ...tfAttr) {
+	e.blocks = append(e.blocks, tfBlock{resourceType, label, attrs, importId})
+}
+
+// policyArn returns a reference to the ARN of a policy as users, groups and
+// roles refer to it, or the ARN of a policy that isn't exported
+func (e *terraformExporter) policyArn(ref string) interface{} {
+	if label, ok := e.policies[ref]; ok {
+		return tfRef{"aws_iam_policy", label, "arn"}
+	}
+	return e.data.Account.policyArnFromString(ref)
+}
+
+// policyName returns the name of the policy a user, group or role refers to
+func policyName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// tfString quotes a string for Terraform, escaping template sequences
+func tfString(s string) string {
+	return tfEscapeTemplates(strconv.Quote(s))
+}
+
+// tfEscapeTemplates escapes the ${ and %{ template sequences in strings,
+// which are common in policies as IAM policy variables
+func tfEscapeTemplates(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(s)
+}
+
+func tfMap(m map[string]string) string {
+	keys := []string{}
+	width := 0
+	for k := range m {
+		keys = append(keys, k)
+		if len(tfString(k)) > width {
+			width = len(tfString(k))
+		}
+	}
+	sort.Strings(keys)
+	lines := []string{"{"}
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("    %-*s = %s", width, tfString(k), tfString(m[k])))
+	}
+	return strings.Join(append(lines, "  }"), "\n")
+}
+
+// tfPolicy returns a policy document as a jsonencode expression. JSON is an
+// HCL expression, once the template sequences in its strings are escaped
+func tfPolicy(doc *PolicyDocument) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("  ", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	return "jsonencode(" + tfEscapeTemplates(strings.TrimSuffix(b.String(), "\n")) + ")", nil
+}
+
+// tfValue renders an attribute value as an HCL expression
+func tfValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return tfString(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case map[string]string:
+		return tfMap(v), nil
+	case *PolicyDocument:
+		return tfPolicy(v)
+	case tfRef:
+		return v.resourceType + "." + v.label + "." + v.attr, nil
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			s, err := tfValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("Can't export %v to Terraform", v)
+}
+
+// inlinePolicies exports the inline policies and managed policy attachments
+// of a user, group or role
+func (e *terraformExporter) inlinePolicies(kind, label, name string, inline []InlinePolicy, managed []string) {
+	for _, p := range inline {
+		e.add("aws_iam_"+kind+"_policy", e.label("aws_iam_"+kind+"_policy", label, p.Name), name+":"+p.Name,
+			tfAttr{"name", p.Name},
+			tfAttr{kind, tfRef{"aws_iam_" + kind, label, "name"}},
+			tfAttr{"policy", p.Policy},
+		)
+	}
+	for _, ref := range managed {
+		e.add("aws_iam_"+kind+"_policy_attachment", e.label("aws_iam_"+kind+"_policy_attachment", label, policyName(ref)), name+"/"+e.data.Account.policyArnFromString(ref),
+			tfAttr{kind, tfRef{"aws_iam_" + kind, label, "name"}},
+			tfAttr{"policy_arn", e.policyArn(ref)},
+		)
+	}
+}
+
+func (e *terraformExporter) export() {
+	a := e.data
+	for _, p := range a.Policies {
+		e.policies[strings.TrimPrefix(p.Path+p.Name, "/")] = e.label("aws_iam_policy", p.Name)
+	}
+	for _, g := range a.Groups {
+		e.groups[g.Name] = e.label("aws_iam_group", g.Name)
+	}
+	for _, r := range a.Roles {
+		e.roles[r.Name] = e.label("aws_iam_role", r.Name)
+	}
+
+	for _, p := range a.Policies {
+		attrs := []tfAttr{{"name", p.Name}, {"path", p.Path}}
+		if p.Description != "" {
+			attrs = append(attrs, tfAttr{"description", p.Description})
+		}
+		if len(p.Tags) > 0 {
+			attrs = append(attrs, tfAttr{"tags", p.Tags})
+		}
+		e.add("aws_iam_policy", e.policies[strings.TrimPrefix(p.Path+p.Name, "/")], Arn(p, a.Account), append(attrs, tfAttr{"policy", p.Policy})...)
+	}
+
+	for _, g := range a.Groups {
+		label := e.groups[g.Name]
+		e.add("aws_iam_group", label, g.Name, tfAttr{"name", g.Name}, tfAttr{"path", g.Path})
+		e.inlinePolicies("group", label, g.Name, g.InlinePolicies, g.Policies)
+	}
+
+	for _, u := range a.Users {
+		label := e.label("aws_iam_user", u.Name)
+		attrs := []tfAttr{{"name", u.Name}, {"path", u.Path}}
+		if u.PermissionsBoundary != "" {
+			attrs = append(attrs, tfAttr{"permissions_boundary", e.policyArn(u.PermissionsBoundary)})
+		}
+		if len(u.Tags) > 0 {
+			attrs = append(attrs, tfAttr{"tags", u.Tags})
+		}
+		e.add("aws_iam_user", label, u.Name, attrs...)
+
+		if len(u.Groups) > 0 {
+			groups := []interface{}{}
+			for _, g := range u.Groups {
+				if groupLabel, ok := e.groups[g]; ok {
+					groups = append(groups, tfRef{"aws_iam_group", groupLabel, "name"})
+				} else {
+					groups = append(groups, g)
+				}
+			}
+			e.add("aws_iam_user_group_membership", e.label("aws_iam_user_group_membership", u.Name), u.Name+"/"+strings.Join(u.Groups, "/"),
+				tfAttr{"user", tfRef{"aws_iam_user", label, "name"}},
+				tfAttr{"groups", groups},
+			)
+		}
+		e.inlinePolicies("user", label, u.Name, u.InlinePolicies, u.Policies)
+	}
+
+	for _, r := range a.Roles {
+		label := e.roles[r.Name]
+		attrs := []tfAttr{{"name", r.Name}, {"path", r.Path}}
+		if r.Description != "" {
+			attrs = append(attrs, tfAttr{"description", r.Description})
+		}
+		if r.MaxSessionDuration > 0 {
+			attrs = append(attrs, tfAttr{"max_session_duration", r.MaxSessionDuration})
+		}
+		if r.PermissionsBoundary != "" {
+			attrs = append(attrs, tfAttr{"permissions_boundary", e.policyArn(r.PermissionsBoundary)})
+		}
+		e.add("aws_iam_role", label, r.Name, append(attrs, tfAttr{"assume_role_policy", r.AssumeRolePolicyDocument})...)
+		e.inlinePolicies("role", label, r.Name, r.InlinePolicies, r.Policies)
+	}
+
+	for _, ip := range a.InstanceProfiles {
+		attrs := []tfAttr{{"name", ip.Name}, {"path", ip.Path}}
+		switch {
+		case len(ip.Roles) > 1:
+			e.warnings.Add(WarningExport, Arn(ip, a.Account), "Terraform instance profiles have one role, only the first is exported")
+			fallthrough
+		case len(ip.Roles) == 1:
+			var role interface{} = ip.Roles[0]
+			if roleLabel, ok := e.roles[ip.Roles[0]]; ok {
+				role = tfRef{"aws_iam_role", roleLabel, "name"}
+			}
+			attrs = append(attrs, tfAttr{"role", role})
+		}
+		e.add("aws_iam_instance_profile", e.label("aws_iam_instance_profile", ip.Name), ip.Name, attrs...)
+	}
+
+	for _, bp := range a.BucketPolicies {
+		if bp.PublicAccessBlock != nil || bp.Acl != nil || len(bp.Tags) > 0 {
+			e.warnings.Add(WarningExport, "s3/"+bp.BucketName, "Only the bucket policy is exported, not its public access block, ACL or tags")
+		}
+		if bp.Policy == nil {
+			continue
+		}
+		e.add("aws_s3_bucket_policy", e.label("aws_s3_bucket_policy", bp.BucketName), bp.BucketName, tfAttr{"bucket", bp.BucketName}, tfAttr{"policy", bp.Policy})
+	}
+
+	for _, r := range a.resources() {
+		switch r.(type) {
+		case *User, *Group, *Role, *Policy, *InstanceProfile, *BucketPolicy:
+			continue
+		}
+		e.warnings.Add(WarningExport, resourceKey(r), "Not exported, only IAM resources and bucket policies are")
+	}
+}
+
+// A TerraformExport is the account's users, groups, roles, managed policies,
+// instance profiles and bucket policies as Terraform resources, with the ids
+// to import the existing resources by. Warnings are the resources Terraform
+// can't represent
+type TerraformExport struct {
+	Account  *Account
+	Warnings Warnings
+
+	blocks []tfBlock
+}
+
+// ExportTerraform converts the account data to Terraform resources
+func ExportTerraform(data *AccountData) (*TerraformExport, error) {
+	e := terraformExporter{
+		data:     data,
+		labels:   map[string]bool{},
+		policies: map[string]string{},
+		groups:   map[string]string{},
+		roles:    map[string]string{},
+	}
+	e.export()
+	return &TerraformExport{data.Account, e.warnings, e.blocks}, nil
+}
+
+// WriteResources writes the resources as HCL
+func (x *TerraformExport) WriteResources(w io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Exported by iamy from account %s\n", x.Account)
+	for _, block := range x.blocks {
+		width := 0
+		for _, attr := range block.attrs {
+			if len(attr.name) > width {
+				width = len(attr.name)
+			}
+		}
+		fmt.Fprintf(&b, "\nresource %q %q {\n", block.resourceType, block.label)
+		for _, attr := range block.attrs {
+			value, err := tfValue(attr.value)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&b, "  %-*s = %s\n", width, attr.name, value)
+		}
+		b.WriteString("}\n")
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteImportBlocks writes an import block for each resource, for Terraform
+// 1.5 and later to adopt the existing resources on the next apply
+func (x *TerraformExport) WriteImportBlocks(w io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Imports of the resources exported by iamy from account %s\n", x.Account)
+	for _, block := range x.blocks {
+		fmt.Fprintf(&b, "\nimport {\n  to = %s.%s\n  id = %s\n}\n", block.resourceType, block.label, tfString(block.importId))
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ImportCmds returns a terraform import command for each resource, to adopt
+// the existing resources with Terraform versions without import blocks
+func (x *TerraformExport) ImportCmds() []Cmd {
+	cmds := []Cmd{}
+	for _, block := range x.blocks {
+		cmds = append(cmds, Cmd{Name: "terraform", Args: []string{"import", block.resourceType + "." + block.label, block.importId}})
+	}
+	return cmds
+}
@@ -0,0 +1,80 @@
+package iamy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportTerraform(t *testing.T) {
+	selfService := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"iam:ChangePassword","Resource":"arn:aws:iam::*:user/${aws:username}"}]}`
+	trust := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole","Principal":{"Service":"ec2.amazonaws.com"}}]}`
+
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{iamService: iamService{Name: "self-service", Path: "/people/"}, Policy: mustPolicyDocument(t, selfService)})
+	data.addGroup(&Group{iamService: iamService{Name: "developers", Path: "/"}, Policies: []string{"people/self-service"}})
+	data.addUser(&User{iamService: iamService{Name: "alice.smith", Path: "/"}, Groups: []string{"developers", "elsewhere"}, Tags: map[string]string{"team": "payments"}})
+	data.addRole(&Role{iamService: iamService{Name: "app-server", Path: "/"}, AssumeRolePolicyDocument: mustPolicyDocument(t, trust), Policies: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}, MaxSessionDuration: 7200})
+	data.addInstanceProfile(&InstanceProfile{iamService: iamService{Name: "app-server", Path: "/"}, Roles: []string{"app-server"}})
+	data.addResource(&EcrRegistryPolicy{Region: "ap-southeast-2", Policy: mustPolicyDocument(t, trust)})
+
+	x, err := ExportTerraform(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err = x.WriteResources(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err = x.WriteImportBlocks(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, s := range []string{
+		"resource \"aws_iam_policy\" \"self-service\" {\n  name   = \"self-service\"\n  path   = \"/people/\"\n  policy = jsonencode({",
+		`"Resource": "arn:aws:iam::*:user/$${aws:username}"`,
+		`resource "aws_iam_group_policy_attachment" "developers_self-service" {`,
+		`  policy_arn = aws_iam_policy.self-service.arn`,
+		`resource "aws_iam_user" "alice_smith" {`,
+		"  tags = {\n    \"team\" = \"payments\"\n  }",
+		`  groups = [aws_iam_group.developers.name, "elsewhere"]`,
+		`  max_session_duration = 7200`,
+		`  policy_arn = "arn:aws:iam::aws:policy/ReadOnlyAccess"`,
+		`  role = aws_iam_role.app-server.name`,
+		"import {\n  to = aws_iam_policy.self-service\n  id = \"arn:aws:iam::123:policy/people/self-service\"\n}",
+		"import {\n  to = aws_iam_role_policy_attachment.app-server_ReadOnlyAccess\n  id = \"app-server/arn:aws:iam::aws:policy/ReadOnlyAccess\"\n}",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected the export to contain\n%s\ngot\n%s", s, out)
+		}
+	}
+
+	if len(x.Warnings) != 1 || x.Warnings[0].Category != WarningExport {
+		t.Errorf("Expected a warning that the ECR registry policy isn't exported, got %v", x.Warnings)
+	}
+
+	cmds := x.ImportCmds()
+	if len(cmds) != 8 {
+		t.Fatalf("Expected an import command for each of the 8 resources, got %v", cmds)
+	}
+	if s := cmds[4].Quoted("posix"); s != "terraform import aws_iam_user_group_membership.alice_smith alice.smith/developers/elsewhere" {
+		t.Errorf("Expected the user's group membership import command, got %s", s)
+	}
+}
+
+func TestTerraformLabelsAreUnique(t *testing.T) {
+	e := terraformExporter{labels: map[string]bool{}}
+	for _, c := range []struct{ name, expected string }{
+		{"app.server", "app_server"},
+		{"app_server", "app_server_2"},
+		{"123-deploy", "_123-deploy"},
+	} {
+		if label := e.label("aws_iam_role", c.name); label != c.expected {
+			t.Errorf("Expected %s to be labelled %s, got %s", c.name, c.expected, label)
+		}
+	}
+	if label := e.label("aws_iam_user", "app.server"); label != "app_server" {
+		t.Errorf("Expected labels to be unique per resource type, got %s", label)
+	}
+}
@@ -0,0 +1,376 @@
+package iamy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// TestMatrixFileName is the file in the yaml directory that lists the
+// requests principals are expected to be allowed and denied
+const TestMatrixFileName = ".iamy-tests.yaml"
+
+// accountIdPlaceholder is replaced by the environment's account id in the
+// resources of test requests, so one test can cover every environment
+const accountIdPlaceholder = "${AccountId}"
+
+// A TestMatrix maps principals to the requests they're expected to be
+// allowed and denied, across environments. Environments names the accounts
+// tests run in by their id or alias-id, and without any every account in
+// the files is an environment named by its alias-id
+type TestMatrix struct {
+	Environments map[string]string `json:"Environments,omitempty"`
+	Tests        []PrincipalTest   `json:"Tests"`
+}
+
+// A PrincipalTest is the requests the users or roles the selector Principal
+// selects are expected to be allowed and denied, in the named environments or
+// all of them
+type PrincipalTest struct {
+	Principal    string        `json:"Principal"`
+	Environments []string      `json:"Environments,omitempty"`
+	Allowed      []TestRequest `json:"Allowed,omitempty"`
+	Denied       []TestRequest `json:"Denied,omitempty"`
+}
+
+// A TestRequest is an action on a resource, or on any resource if Resource
+// is empty. ${AccountId} in the resource is the environment's account id
+type TestRequest struct {
+	Action   string `json:"Action"`
+	Resource string `json:"Resource,omitempty"`
+}
+
+func (r TestRequest) resourceIn(account *Account) string {
+	if r.Resource == "" {
+		return "*"
+	}
+	return strings.Replace(r.Resource, accountIdPlaceholder, account.Id, -1)
+}
+
+// The decisions a test request can have. A request is undecided when it
+// depends on conditions, or policies that aren't in the files
+const (
+	DecisionAllowed   = "allowed"
+	DecisionDenied    = "denied"
+	DecisionUndecided = "undecided"
+)
+
+// A TestResult is the decision on a test request for a principal in an
+// environment. Error is why it couldn't be tested, eg. the principal doesn't
+// exist, and Reason the statement or check that decided it
+type TestResult struct {
+	Environment string
+	Account     *Account
+	Principal   string
+	Action      string
+	Resource    string
+	Expected    string
+	Actual      string
+	Reason      string
+	Error       string
+}
+
+// Name describes the test, eg. "role/deployer is allowed s3:GetObject on *"
+func (r TestResult) Name() string {
+	return fmt.Sprintf("%s is %s %s on %s", r.Principal, r.Expected, r.Action, r.Resource)
+}
+
+// Passed returns whether the request had the expected decision
+func (r TestResult) Passed() bool {
+	return r.Error == "" && r.Actual == r.Expected
+}
+
+// Skipped returns whether the request couldn't be decided
+func (r TestResult) Skipped() bool {
+	return r.Error == "" && r.Actual == DecisionUndecided
+}
+
+// JUnitCase returns the result as a JUnit test case, in a suite for its
+// environment
+func (r TestResult) JUnitCase() JUnitCase {
+	c := JUnitCase{Suite: r.Environment, ClassName: r.Environment, Name: r.Name()}
+	switch {
+	case r.Error != "":
+		c.Error = r.Error
+	case r.Skipped():
+		c.Skipped = r.Reason
+	case !r.Passed():
+		c.Failure = fmt.Sprintf("expected %s, was %s: %s", r.Expected, r.Actual, r.Reason)
+	}
+	return c
+}
+
+func (t PrincipalTest) validate(environments map[string]string) error {
+	selector, err := ParseResourceSelector(t.Principal)
+	if err != nil {
+		return err
+	}
+	if selector.Type != "user" && selector.Type != "role" {
+		return errors.Errorf("Test principal %s must select users or roles", t.Principal)
+	}
+	if len(t.Allowed) == 0 && len(t.Denied) == 0 {
+		return errors.Errorf("Test of %s must have Allowed or Denied requests", t.Principal)
+	}
+	for _, e := range t.Environments {
+		if _, ok := environments[e]; !ok && len(environments) > 0 {
+			return errors.Errorf("Test of %s has an unknown environment %s", t.Principal, e)
+		}
+	}
+	for _, r := range append(append([]TestRequest{}, t.Allowed...), t.Denied...) {
+		if r.Action == "" || !strings.Contains(r.Action, ":") {
+			return errors.Errorf("Test of %s must have actions like service:Action, got %q", t.Principal, r.Action)
+		}
+	}
+	return nil
+}
+
+// LoadTestMatrix reads a test matrix file
+func LoadTestMatrix(file string) (*TestMatrix, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := TestMatrix{}
+	if err = yaml.Unmarshal(data, &m); err != nil {
+		return nil, validationError(file, err)
+	}
+	if len(m.Tests) == 0 {
+		return nil, validationError(file, errors.New("There are no Tests"))
+	}
+	for _, t := range m.Tests {
+		if err := t.validate(m.Environments); err != nil {
+			return nil, validationError(file, err)
+		}
+	}
+	return &m, nil
+}
+
+// A testEnvironment is an environment of the matrix and its account data
+type testEnvironment struct {
+	name string
+	data *AccountData
+}
+
+// environments returns the environments of the matrix, sorted by name. An
+// environment whose account isn't in the files is an error
+func (m *TestMatrix) environments(accounts []AccountData) ([]testEnvironment, error) {
+	find := func(account string) *AccountData {
+		for i := range accounts {
+			if accounts[i].Account.Id == account || accounts[i].Account.String() == account {
+				return &accounts[i]
+			}
+		}
+		return nil
+	}
+
+	result := []testEnvironment{}
+	if len(m.Environments) == 0 {
+		for i := range accounts {
+			result = append(result, testEnvironment{accounts[i].Account.String(), &accounts[i]})
+		}
+	}
+	for name, account := range m.Environments {
+		data := find(account)
+		if data == nil {
+			return nil, errors.Errorf("No files found for account %s of environment %s", account, name)
+		}
+		result = append(result, testEnvironment{name, data})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result, nil
+}
+
+// A TestSimulator decides requests for a principal, eg. with the IAM
+// policy simulator, instead of evaluating the policies in the files
+type TestSimulator interface {
+	SimulateRequest(principalArn, action, resource string) (string, string, error)
+}
+
+// RunTestMatrix decides every test request in each environment of the
+// matrix, or only the named environments, from the policies in the files.
+// With a simulator, the requests are decided by it instead, and the tests of
+// environments in accounts other than simulatorAccount are skipped
+func RunTestMatrix(m *TestMatrix, accounts []AccountData, only []string, simulator TestSimulator, simulatorAccount *Account) ([]TestResult, error) {
+	environments, err := m.environments(accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []TestResult{}
+	for _, env := range environments {
+		if len(only) > 0 && !stringSliceContains(only, env.name) {
+			continue
+		}
+		pp := newPrincipalPolicies(env.data)
+		for _, t := range m.Tests {
+			if len(t.Environments) > 0 && !stringSliceContains(t.Environments, env.name) {
+				continue
+			}
+			selector, _ := ParseResourceSelector(t.Principal)
+			principals := env.data.Select(selector)
+
+			requests := []TestResult{}
+			for expected, list := range map[string][]TestRequest{DecisionAllowed: t.Allowed, DecisionDenied: t.Denied} {
+				for _, r := range list {
+					requests = append(requests, TestResult{
+						Environment: env.name,
+						Account:     env.data.Account,
+						Action:      r.Action,
+						Resource:    r.resourceIn(env.data.Account),
+						Expected:    expected,
+					})
+				}
+			}
+			sort.SliceStable(requests, func(i, j int) bool { return requests[i].Expected < requests[j].Expected })
+
+			if len(principals) == 0 {
+				for _, r := range requests {
+					r.Principal = t.Principal
+					r.Error = "No users or roles match " + t.Principal
+					results = append(results, r)
+				}
+				continue
+			}
+			for _, p := range principals {
+				for _, r := range requests {
+					r.Principal = fmt.Sprintf("%s/%s", p.ResourceType(), strings.TrimPrefix(p.ResourcePath()+p.ResourceName(), "/"))
+					switch {
+					case simulator == nil:
+						r.Actual, r.Reason = evaluateRequest(pp, p, r.Action, r.Resource)
+					case simulatorAccount == nil || simulatorAccount.Id != env.data.Account.Id:
+						r.Actual, r.Reason = DecisionUndecided, "not simulated, the AWS credentials aren't for this account"
+					default:
+						r.Actual, r.Reason, err = simulator.SimulateRequest(Arn(p, env.data.Account), r.Action, r.Resource)
+						if err != nil {
+							r.Error = err.Error()
+						}
+					}
+					results = append(results, r)
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// evaluateRequest decides whether the principal's identity policies and
+// permissions boundary allow the action on the resource. Statements with
+// conditions can't be evaluated without a request context, so a request
+// they would decide is undecided, as is one that policies that aren't in the
+// files, eg. AWS managed policies, may allow. Resource policies and service
+// control policies aren't considered
+func evaluateRequest(pp *principalPolicies, principal AwsResource, action, resource string) (string, string) {
+	var statements []PolicyStatement
+	var unknown []string
+	var boundary string
+	switch p := principal.(type) {
+	case *User:
+		statements, unknown = pp.userStatements(p)
+		boundary = p.PermissionsBoundary
+	case *Role:
+		statements, unknown = pp.roleStatements(p)
+		boundary = p.PermissionsBoundary
+	}
+
+	applies := func(s PolicyStatement) bool {
+		return actionCovers(s, action) && resourceMatches(s, resource)
+	}
+	var conditionalDeny *PolicyStatement
+	decide := func(statements []PolicyStatement) (allow, conditionalAllow, deny *PolicyStatement) {
+		for i, s := range statements {
+			if !applies(s) {
+				continue
+			}
+			switch {
+			case !isAllow(s) && isUnconditional(s):
+				return nil, nil, &statements[i]
+			case !isAllow(s) && conditionalDeny == nil:
+				conditionalDeny = &statements[i]
+			case isAllow(s) && isUnconditional(s) && allow == nil:
+				allow = &statements[i]
+			case isAllow(s) && conditionalAllow == nil:
+				conditionalAllow = &statements[i]
+			}
+		}
+		return allow, conditionalAllow, deny
+	}
+
+	allow, conditionalAllow, deny := decide(statements)
+	switch {
+	case deny != nil:
+		return DecisionDenied, "denied by " + deny.String()
+	case allow == nil && conditionalAllow != nil:
+		return DecisionUndecided, "only allowed under conditions by " + conditionalAllow.String()
+	case allow == nil && len(unknown) > 0:
+		return DecisionUndecided, "may be allowed by policies that aren't in the files: " + strings.Join(unknown, ", ")
+	case allow == nil:
+		return DecisionDenied, "no statement allows it"
+	}
+
+	if boundary != "" {
+		policy := pp.findPolicy(boundary)
+		if policy == nil {
+			return DecisionUndecided, "permissions boundary " + boundary + " isn't in the files"
+		}
+		boundaryAllow, boundaryConditionalAllow, boundaryDeny := decide(pp.byDoc[policy.Policy])
+		switch {
+		case boundaryDeny != nil:
+			return DecisionDenied, "denied by permissions boundary " + boundaryDeny.String()
+		case boundaryAllow == nil && boundaryConditionalAllow != nil:
+			return DecisionUndecided, "only allowed under conditions by permissions boundary " + boundaryConditionalAllow.String()
+		case boundaryAllow == nil:
+			return DecisionDenied, "not allowed by permissions boundary " + boundary
+		}
+	}
+
+	if conditionalDeny != nil {
+		return DecisionUndecided, "may be denied under conditions by " + conditionalDeny.String()
+	}
+	return DecisionAllowed, "allowed by " + allow.String()
+}
+
+// SimulateRequest decides whether IAM allows the principal the action on the
+// resource with SimulatePrincipalPolicy, from its policies in AWS. It's a
+// TestSimulator for RunTestMatrix
+func (a *AwsFetcher) SimulateRequest(principalArn, action, resource string) (string, string, error) {
+	resp, err := a.iam.SimulatePrincipalPolicy(&iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principalArn),
+		ActionNames:     aws.StringSlice([]string{action}),
+		ResourceArns:    aws.StringSlice([]string{resource}),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if len(resp.EvaluationResults) == 0 {
+		return "", "", errors.Errorf("The policy simulator returned no result for %s on %s", action, resource)
+	}
+
+	result := resp.EvaluationResults[0]
+	decision := aws.StringValue(result.EvalDecision)
+	reason := "simulated " + decision
+	if len(result.MissingContextValues) > 0 {
+		return DecisionUndecided, "simulation is missing context values " + strings.Join(aws.StringValueSlice(result.MissingContextValues), ", "), nil
+	}
+	if decision == iam.PolicyEvaluationDecisionTypeAllowed {
+		return DecisionAllowed, reason, nil
+	}
+	return DecisionDenied, reason, nil
+}
+
+// SimulatorAccount returns the account of the credentials, for the accounts
+// SimulateRequest can simulate requests in
+func (a *AwsFetcher) SimulatorAccount() (*Account, error) {
+	if a.account == nil {
+		if err := a.init(); err != nil {
+			return nil, err
+		}
+	}
+	return a.account, nil
+}
@@ -0,0 +1,104 @@
+package iamy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunTestMatrix(t *testing.T) {
+	deploy := `{"Version":"2012-10-17","Statement":[
+		{"Sid":"Assets","Effect":"Allow","Action":"s3:*Object","Resource":"arn:aws:s3:::assets-123/*"},
+		{"Sid":"NoDelete","Effect":"Deny","Action":"s3:DeleteObject","Resource":"*"},
+		{"Sid":"Office","Effect":"Allow","Action":"ec2:*","Resource":"*","Condition":{"IpAddress":{"aws:SourceIp":"10.0.0.0/8"}}}]}`
+	boundary := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`
+
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{iamService: iamService{Name: "boundary", Path: "/"}, Policy: mustPolicyDocument(t, boundary)})
+	data.addRole(&Role{iamService: iamService{Name: "deployer", Path: "/"}, InlinePolicies: []InlinePolicy{{Name: "deploy", Policy: mustPolicyDocument(t, deploy)}}})
+	data.addRole(&Role{iamService: iamService{Name: "bounded", Path: "/"}, InlinePolicies: []InlinePolicy{{Name: "deploy", Policy: mustPolicyDocument(t, deploy)}}, PermissionsBoundary: "boundary"})
+	data.addUser(&User{iamService: iamService{Name: "admin", Path: "/"}, Policies: []string{"arn:aws:iam::aws:policy/AdministratorAccess"}})
+
+	m := &TestMatrix{
+		Environments: map[string]string{"staging": "123"},
+		Tests: []PrincipalTest{
+			{
+				Principal: "role/deployer",
+				Allowed:   []TestRequest{{Action: "s3:PutObject", Resource: "arn:aws:s3:::assets-${AccountId}/app.js"}, {Action: "s3:DeleteObject", Resource: "arn:aws:s3:::assets-${AccountId}/app.js"}},
+				Denied:    []TestRequest{{Action: "iam:CreateUser"}, {Action: "ec2:RunInstances"}},
+			},
+			{
+				Principal: "role/bounded",
+				Denied:    []TestRequest{{Action: "s3:PutObject", Resource: "arn:aws:s3:::assets-123/app.js"}},
+			},
+			{
+				Principal: "user/admin",
+				Allowed:   []TestRequest{{Action: "iam:CreateUser"}},
+			},
+			{
+				Principal: "role/missing",
+				Allowed:   []TestRequest{{Action: "s3:GetObject"}},
+			},
+		},
+	}
+
+	results, err := RunTestMatrix(m, []AccountData{*data}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ name, actual string }{
+		{"role/deployer is allowed s3:PutObject on arn:aws:s3:::assets-123/app.js", DecisionAllowed},
+		{"role/deployer is allowed s3:DeleteObject on arn:aws:s3:::assets-123/app.js", DecisionDenied},
+		{"role/deployer is denied iam:CreateUser on *", DecisionDenied},
+		{"role/deployer is denied ec2:RunInstances on *", DecisionUndecided},
+		{"role/bounded is denied s3:PutObject on arn:aws:s3:::assets-123/app.js", DecisionDenied},
+		{"user/admin is allowed iam:CreateUser on *", DecisionUndecided},
+		{"role/missing is allowed s3:GetObject on *", ""},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %v", len(expected), results)
+	}
+	for i, r := range results {
+		if r.Name() != expected[i].name || r.Actual != expected[i].actual {
+			t.Errorf("Expected %q to be %q, got %q: %s", expected[i].name, expected[i].actual, r.Actual, r.Reason)
+		}
+		if r.Environment != "staging" {
+			t.Errorf("Expected %q in staging, got %s", r.Name(), r.Environment)
+		}
+	}
+	if results[1].Reason != "denied by myalias-123/iam/role/deployer.yaml InlinePolicies[deploy] statement NoDelete" {
+		t.Errorf("Expected the denying statement as the reason, got %q", results[1].Reason)
+	}
+	if results[4].Reason != "not allowed by permissions boundary boundary" {
+		t.Errorf("Expected the boundary as the reason, got %q", results[4].Reason)
+	}
+	if results[6].Error == "" {
+		t.Error("Expected a test of a missing principal to be an error")
+	}
+
+	cases := []JUnitCase{}
+	for _, r := range results {
+		cases = append(cases, r.JUnitCase())
+	}
+	var b bytes.Buffer
+	if err := WriteJUnit(&b, cases); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<testsuites tests="7" failures="1" errors="1" skipped="2">`,
+		`<testsuite name="staging" tests="7" failures="1" errors="1" skipped="2">`,
+		`<testcase name="role/deployer is allowed s3:DeleteObject on arn:aws:s3:::assets-123/app.js" classname="staging">`,
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Expected the JUnit XML to contain %s, got\n%s", s, b.String())
+		}
+	}
+}
+
+func TestRunTestMatrixUnknownEnvironmentAccount(t *testing.T) {
+	m := &TestMatrix{Environments: map[string]string{"production": "456"}, Tests: []PrincipalTest{{Principal: "role/*", Allowed: []TestRequest{{Action: "s3:GetObject"}}}}}
+	if _, err := RunTestMatrix(m, []AccountData{*NewAccountData("123")}, nil, nil, nil); err == nil {
+		t.Error("Expected an error for an environment without files")
+	}
+}
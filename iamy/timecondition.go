@@ -0,0 +1,155 @@
+package iamy
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var timeConditionKeys = map[string]bool{
+	"aws:currenttime": true,
+	"aws:epochtime":   true,
+}
+
+var timeConditionLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseConditionTime parses a date condition value, which AWS accepts as
+// ISO 8601 or as seconds since the epoch
+func parseConditionTime(value string) (time.Time, bool) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), true
+	}
+	for _, layout := range timeConditionLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// A TimeBoundStatement is a statement only in effect between Start and End
+// because of DateGreaterThan/DateLessThan conditions on the current time.
+// A zero Start or End is unbounded
+type TimeBoundStatement struct {
+	Statement  PolicyStatement
+	Conditions []Condition
+	Start      time.Time
+	End        time.Time
+}
+
+// Expired returns whether the statement can no longer be in effect, either
+// because its end has passed or because it has no window at all
+func (s TimeBoundStatement) Expired(now time.Time) bool {
+	if !s.End.IsZero() && !s.End.After(now) {
+		return true
+	}
+	return !s.Start.IsZero() && !s.End.IsZero() && !s.Start.Before(s.End)
+}
+
+// ExpiresWithin returns whether the statement is still in effect but will
+// expire within d
+func (s TimeBoundStatement) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return !s.Expired(now) && !s.End.IsZero() && s.End.Before(now.Add(d))
+}
+
+// TimeConditionReport finds every statement with a DateGreaterThan or
+// DateLessThan condition on aws:CurrentTime or aws:EpochTime. Conditions are
+// combined the way AWS evaluates them: values of one condition are ORed, and
+// separate conditions are ANDed
+func TimeConditionReport(data *AccountData) []TimeBoundStatement {
+	report := []TimeBoundStatement{}
+
+	for _, statement := range data.PolicyStatements() {
+		s := TimeBoundStatement{Statement: statement}
+
+		for _, condition := range statement.Conditions() {
+			if !timeConditionKeys[strings.ToLower(condition.Key)] {
+				continue
+			}
+
+			var bound time.Time
+			before := false
+			switch baseConditionOperator(condition.Operator) {
+			case "DateLessThan", "DateLessThanEquals":
+				before = true
+			case "DateGreaterThan", "DateGreaterThanEquals":
+			default:
+				continue
+			}
+
+			for _, v := range condition.Values {
+				t, ok := parseConditionTime(v)
+				if !ok {
+					continue
+				}
+				if bound.IsZero() || (before && t.After(bound)) || (!before && t.Before(bound)) {
+					bound = t
+				}
+			}
+			if bound.IsZero() {
+				continue
+			}
+
+			s.Conditions = append(s.Conditions, condition)
+			if before && (s.End.IsZero() || bound.Before(s.End)) {
+				s.End = bound
+			}
+			if !before && (s.Start.IsZero() || bound.After(s.Start)) {
+				s.Start = bound
+			}
+		}
+
+		if len(s.Conditions) > 0 {
+			report = append(report, s)
+		}
+	}
+
+	return report
+}
+
+// RemoveStatements removes the statements from the policy documents they
+// belong to. A document must keep at least one statement, so removing all of
+// a document's statements is an error and leaves that document unchanged
+func RemoveStatements(statements []PolicyStatement) error {
+	byDoc := map[*PolicyDocument]map[int]bool{}
+	docs := []*PolicyDocument{}
+	for _, s := range statements {
+		if byDoc[s.doc] == nil {
+			byDoc[s.doc] = map[int]bool{}
+			docs = append(docs, s.doc)
+		}
+		byDoc[s.doc][s.Index] = true
+	}
+
+	var result error
+	for _, doc := range docs {
+		remaining := []interface{}{}
+		for i, s := range doc.statements() {
+			if !byDoc[doc][i+1] {
+				remaining = append(remaining, s)
+			}
+		}
+
+		if len(remaining) == 0 {
+			for _, s := range statements {
+				if s.doc == doc {
+					result = errors.Errorf("Not removing every statement of %s %s, remove the policy instead", s.File, s.Policy)
+					break
+				}
+			}
+			continue
+		}
+
+		doc.value().(map[string]interface{})["Statement"] = remaining
+	}
+
+	return result
+}
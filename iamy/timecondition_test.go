@@ -0,0 +1,79 @@
+package iamy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeConditionReport(t *testing.T) {
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{
+		iamService: iamService{Name: "contractors", Path: "/"},
+		Policy: mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[
+			{"Sid":"Expired","Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"DateLessThan":{"aws:CurrentTime":"2020-01-01T00:00:00Z"}}},
+			{"Sid":"ExpiringSoon","Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"DateLessThan":{"aws:CurrentTime":"2021-06-10"}}},
+			{"Sid":"EmptyWindow","Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"DateGreaterThan":{"aws:EpochTime":"1640995200"},"DateLessThan":{"aws:EpochTime":"1609459200"}}},
+			{"Sid":"NotYetActive","Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"DateGreaterThan":{"aws:CurrentTime":"2022-01-01T00:00:00Z"}}},
+			{"Sid":"Unconditional","Effect":"Allow","Action":"s3:*","Resource":"*"}
+		]}`),
+	})
+
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	soon := 30 * 24 * time.Hour
+
+	expired := []PolicyStatement{}
+	statuses := map[string]string{}
+	for _, s := range TimeConditionReport(data) {
+		switch {
+		case s.Expired(now):
+			statuses[s.Statement.Sid] = "expired"
+			expired = append(expired, s.Statement)
+		case s.ExpiresWithin(now, soon):
+			statuses[s.Statement.Sid] = "expiring"
+		default:
+			statuses[s.Statement.Sid] = "active"
+		}
+	}
+
+	expected := map[string]string{
+		"Expired":      "expired",
+		"ExpiringSoon": "expiring",
+		"EmptyWindow":  "expired",
+		"NotYetActive": "active",
+	}
+	if len(statuses) != len(expected) {
+		t.Errorf("Expected %d time bound statements, got %v", len(expected), statuses)
+	}
+	for sid, status := range expected {
+		if statuses[sid] != status {
+			t.Errorf("Expected %s to be %s, got %s", sid, status, statuses[sid])
+		}
+	}
+
+	if err := RemoveStatements(expired); err != nil {
+		t.Fatal(err)
+	}
+	sids := []string{}
+	for _, s := range data.PolicyStatements() {
+		sids = append(sids, s.Sid)
+	}
+	if !reflect.DeepEqual(sids, []string{"ExpiringSoon", "NotYetActive", "Unconditional"}) {
+		t.Errorf("Expected expired statements to be removed, got %v", sids)
+	}
+}
+
+func TestRemoveStatementsKeepsAStatement(t *testing.T) {
+	data := NewAccountData("myalias-123")
+	data.addPolicy(&Policy{
+		iamService: iamService{Name: "expired", Path: "/"},
+		Policy:     mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"s3:*","Resource":"*","Condition":{"DateLessThan":{"aws:CurrentTime":"2020-01-01"}}}}`),
+	})
+
+	if err := RemoveStatements(data.PolicyStatements()); err == nil {
+		t.Errorf("Expected an error removing every statement of a policy")
+	}
+	if len(data.PolicyStatements()) != 1 {
+		t.Errorf("Expected the policy to be unchanged")
+	}
+}
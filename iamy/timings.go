@@ -0,0 +1,74 @@
+package iamy
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Timing is the accumulated time spent in one phase of a run
+type Timing struct {
+	Phase string
+	Count int
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Timings records how long each phase of a run takes, so slow accounts can be
+// reported with precise bottlenecks. It is safe for concurrent use, and a nil
+// *Timings records nothing
+type Timings struct {
+	mutex  sync.Mutex
+	phases map[string]*Timing
+}
+
+// Record adds a single duration to phase
+func (t *Timings) Record(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.phases == nil {
+		t.phases = map[string]*Timing{}
+	}
+	p, ok := t.phases[phase]
+	if !ok {
+		p = &Timing{Phase: phase}
+		t.phases[phase] = p
+	}
+	p.Count++
+	p.Total += d
+	if d > p.Max {
+		p.Max = d
+	}
+}
+
+// Track starts timing phase and returns a func that records it, eg.
+//
+//	defer a.Timings.Track("s3")()
+func (t *Timings) Track(phase string) func() {
+	start := time.Now()
+	return func() {
+		t.Record(phase, time.Since(start))
+	}
+}
+
+// All returns the recorded timings ordered by phase
+func (t *Timings) All() []Timing {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result := make([]Timing, 0, len(t.phases))
+	for _, p := range t.phases {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Phase < result[j].Phase
+	})
+	return result
+}
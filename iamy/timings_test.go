@@ -0,0 +1,33 @@
+package iamy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimingsAccumulatePerPhase(t *testing.T) {
+	timings := &Timings{}
+	timings.Record("s3", 2*time.Second)
+	timings.Record("iam", time.Second)
+	timings.Record("s3", 3*time.Second)
+
+	all := timings.All()
+	if len(all) != 2 {
+		t.Fatalf("Expected 2 phases, got %v", all)
+	}
+	if all[0].Phase != "iam" || all[1].Phase != "s3" {
+		t.Errorf("Expected phases to be ordered by name, got %v", all)
+	}
+	if all[1].Count != 2 || all[1].Total != 5*time.Second || all[1].Max != 3*time.Second {
+		t.Errorf("Expected s3 to be recorded twice totalling 5s with a max of 3s, got %+v", all[1])
+	}
+}
+
+func TestNilTimingsRecordNothing(t *testing.T) {
+	var timings *Timings
+	timings.Track("iam")()
+
+	if all := timings.All(); len(all) != 0 {
+		t.Errorf("Expected no timings, got %v", all)
+	}
+}
@@ -0,0 +1,110 @@
+package iamy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Select returns the account's resources the selector selects
+func (a *AccountData) Select(selector ResourceSelector) []AwsResource {
+	result := []AwsResource{}
+	for _, r := range a.resources() {
+		if selector.matches(r) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// TrustSummary describes each statement of a role's trust policy in a line,
+// as who it allows or denies to assume the role with which actions, and the
+// conditions that limit it, eg.
+// "Allow Service ec2.amazonaws.com to sts:AssumeRole"
+func TrustSummary(doc *PolicyDocument) []string {
+	summary := []string{}
+	for _, s := range doc.statements() {
+		effect, _ := s["Effect"].(string)
+		line := effect + " " + principalSummary(s["Principal"])
+		if actions := stringOrSlice(s["Action"]); len(actions) > 0 {
+			line += " to " + strings.Join(actions, ", ")
+		}
+		if conditions := conditionSummary(s["Condition"]); len(conditions) > 0 {
+			line += " when " + strings.Join(conditions, " and ")
+		}
+		summary = append(summary, line)
+	}
+	return summary
+}
+
+// principalSummary describes a statement's principals by type, eg.
+// "AWS arn:aws:iam::123456789012:root"
+func principalSummary(principal interface{}) string {
+	m, ok := principal.(map[string]interface{})
+	if !ok {
+		if s, ok := principal.(string); ok {
+			return s
+		}
+		return "nobody"
+	}
+
+	types := []string{}
+	for t := range m {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	parts := []string{}
+	for _, t := range types {
+		parts = append(parts, t+" "+strings.Join(stringOrSlice(m[t]), ", "))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// conditionSummary describes a statement's conditions, eg.
+// "StringEquals sts:ExternalId [abc]"
+func conditionSummary(condition interface{}) []string {
+	m, ok := condition.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	operators := []string{}
+	for op := range m {
+		operators = append(operators, op)
+	}
+	sort.Strings(operators)
+	result := []string{}
+	for _, op := range operators {
+		keys, ok := m[op].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		names := []string{}
+		for k := range keys {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			result = append(result, fmt.Sprintf("%s %s %v", op, k, stringOrSlice(keys[k])))
+		}
+	}
+	return result
+}
+
+// stringOrSlice returns a policy value that is either a string or a list of
+// strings as a list
+func stringOrSlice(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		result := []string{}
+		for _, s := range v {
+			result = append(result, fmt.Sprint(s))
+		}
+		return result
+	case nil:
+		return nil
+	}
+	return []string{fmt.Sprint(v)}
+}
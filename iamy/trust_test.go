@@ -0,0 +1,29 @@
+package iamy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrustSummary(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"},
+		{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::111111111111:root","arn:aws:iam::222222222222:root"]},"Action":["sts:AssumeRole","sts:TagSession"],"Condition":{"StringEquals":{"sts:ExternalId":"abc"},"Bool":{"aws:MultiFactorAuthPresent":"true"}}}
+	]}`)
+
+	expected := []string{
+		"Allow Service ec2.amazonaws.com to sts:AssumeRole",
+		"Allow AWS arn:aws:iam::111111111111:root, arn:aws:iam::222222222222:root to sts:AssumeRole, sts:TagSession when Bool aws:MultiFactorAuthPresent [true] and StringEquals sts:ExternalId [abc]",
+	}
+	if actual := TrustSummary(doc); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected\n%q\ngot\n%q", expected, actual)
+	}
+
+	data := NewAccountData("123")
+	data.addRole(&Role{iamService: iamService{Name: "app-server", Path: "/team/"}})
+	data.addRole(&Role{iamService: iamService{Name: "worker", Path: "/"}})
+	selector, _ := ParseResourceSelector("role/app-*")
+	if selected := data.Select(selector); len(selected) != 1 || selected[0].ResourceName() != "app-server" {
+		t.Errorf("Expected only app-server to be selected, got %v", selected)
+	}
+}
@@ -0,0 +1,213 @@
+package iamy
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A UsageRecord is one run of iamy in the opt-in usage log. It records what
+// ran, how long it took, how many resources of each type it handled and how
+// it failed, but never the names of resources, accounts or files, so the log
+// can be shipped to telemetry as it is
+type UsageRecord struct {
+	Version      string             `json:"Version"`
+	Command      string             `json:"Command"`
+	Flags        []string           `json:"Flags,omitempty"`
+	Started      time.Time          `json:"Started"`
+	Seconds      float64            `json:"Seconds"`
+	ExitCode     int                `json:"ExitCode"`
+	ErrorClass   string             `json:"ErrorClass,omitempty"`
+	Accounts     int                `json:"Accounts,omitempty"`
+	Resources    map[string]int     `json:"Resources,omitempty"`
+	PhaseSeconds map[string]float64 `json:"PhaseSeconds,omitempty"`
+}
+
+// ErrorClass returns the kind of an error for the usage log, without its
+// message, which can name resources
+func ErrorClass(err error) string {
+	var throttled *ErrThrottled
+	var denied *ErrAccessDenied
+	var conflict *ErrResourceConflict
+	var concurrent *ErrConcurrentChange
+	var limit *ErrLimitExceeded
+	var validation *ErrValidation
+	var blastRadius *ErrBlastRadius
+	var stale *ErrStalePlan
+	var failures ApplyErrors
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &failures) && len(failures) > 0:
+		return ErrorClass(failures[0].Err)
+	case errors.As(err, &throttled):
+		return "throttled"
+	case errors.As(err, &denied):
+		return "access-denied"
+	case errors.As(err, &conflict):
+		return "resource-conflict"
+	case errors.As(err, &concurrent):
+		return "concurrent-change"
+	case errors.As(err, &limit):
+		return "limit-exceeded"
+	case errors.As(err, &validation):
+		return "validation"
+	case errors.As(err, &blastRadius):
+		return "blast-radius"
+	case errors.As(err, &stale):
+		return "stale-plan"
+	}
+	return "other"
+}
+
+// ResourceCounts returns the number of resources of each type in the
+// account data, eg. 3 for role
+func ResourceCounts(data *AccountData) map[string]int {
+	counts := map[string]int{}
+	for _, r := range data.resources() {
+		counts[r.ResourceType()]++
+	}
+	return counts
+}
+
+// AppendUsageRecord appends the record to the usage log as a line of JSON,
+// creating the log if needed
+func AppendUsageRecord(file string, record UsageRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadUsageLog reads the records of a usage log
+func ReadUsageLog(file string) ([]UsageRecord, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []UsageRecord{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, &ErrValidation{File: file, Line: line, Err: err}
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// A CommandUsage summarises the runs of one command in the usage log
+type CommandUsage struct {
+	Command        string         `json:"Command"`
+	Runs           int            `json:"Runs"`
+	Failures       int            `json:"Failures"`
+	ErrorClasses   map[string]int `json:"ErrorClasses,omitempty"`
+	MedianSeconds  float64        `json:"MedianSeconds"`
+	MaxSeconds     float64        `json:"MaxSeconds"`
+	MaxResources   int            `json:"MaxResources,omitempty"`
+	Versions       map[string]int `json:"Versions,omitempty"`
+	FlagsUsed      map[string]int `json:"FlagsUsed,omitempty"`
+	SlowestPhase   string         `json:"SlowestPhase,omitempty"`
+	slowestSeconds float64
+}
+
+// A UsageSummary summarises a usage log by command, for platform teams to
+// see which commands are used, how long they take and how they fail
+type UsageSummary struct {
+	From     time.Time      `json:"From"`
+	To       time.Time      `json:"To"`
+	Runs     int            `json:"Runs"`
+	Commands []CommandUsage `json:"Commands"`
+}
+
+// SummariseUsage summarises the records by command, the most run first
+func SummariseUsage(records []UsageRecord) UsageSummary {
+	summary := UsageSummary{Runs: len(records), Commands: []CommandUsage{}}
+	byCommand := map[string]*CommandUsage{}
+	seconds := map[string][]float64{}
+	phases := map[string]map[string]float64{}
+	for _, r := range records {
+		if summary.From.IsZero() || r.Started.Before(summary.From) {
+			summary.From = r.Started
+		}
+		if r.Started.After(summary.To) {
+			summary.To = r.Started
+		}
+
+		c, ok := byCommand[r.Command]
+		if !ok {
+			c = &CommandUsage{Command: r.Command, ErrorClasses: map[string]int{}, Versions: map[string]int{}, FlagsUsed: map[string]int{}}
+			byCommand[r.Command] = c
+			phases[r.Command] = map[string]float64{}
+		}
+		c.Runs++
+		if r.ExitCode != 0 {
+			c.Failures++
+		}
+		if r.ErrorClass != "" {
+			c.ErrorClasses[r.ErrorClass]++
+		}
+		if r.Seconds > c.MaxSeconds {
+			c.MaxSeconds = r.Seconds
+		}
+		seconds[r.Command] = append(seconds[r.Command], r.Seconds)
+		total := 0
+		for _, n := range r.Resources {
+			total += n
+		}
+		if total > c.MaxResources {
+			c.MaxResources = total
+		}
+		c.Versions[r.Version]++
+		for _, f := range r.Flags {
+			c.FlagsUsed[f]++
+		}
+		for phase, s := range r.PhaseSeconds {
+			phases[r.Command][phase] += s
+		}
+	}
+
+	for command, c := range byCommand {
+		s := seconds[command]
+		sort.Float64s(s)
+		c.MedianSeconds = s[len(s)/2]
+		if len(s)%2 == 0 {
+			c.MedianSeconds = (s[len(s)/2-1] + s[len(s)/2]) / 2
+		}
+		for phase, total := range phases[command] {
+			if total > c.slowestSeconds || total == c.slowestSeconds && phase < c.SlowestPhase {
+				c.SlowestPhase, c.slowestSeconds = phase, total
+			}
+		}
+		summary.Commands = append(summary.Commands, *c)
+	}
+	sort.Slice(summary.Commands, func(i, j int) bool {
+		if summary.Commands[i].Runs != summary.Commands[j].Runs {
+			return summary.Commands[i].Runs > summary.Commands[j].Runs
+		}
+		return summary.Commands[i].Command < summary.Commands[j].Command
+	})
+	return summary
+}
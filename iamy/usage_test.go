@@ -0,0 +1,77 @@
+package iamy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestErrorClass(t *testing.T) {
+	for _, c := range []struct {
+		err      error
+		expected string
+	}{
+		{nil, ""},
+		{errors.New("boom"), "other"},
+		{pkgerrors.Wrap(&ErrThrottled{errors.New("Rate exceeded")}, "Error listing users"), "throttled"},
+		{&ErrAccessDenied{Action: "iam:ListUsers", Err: errors.New("denied")}, "access-denied"},
+		{&ErrValidation{File: "iam/role/app.yaml", Err: errors.New("bad")}, "validation"},
+		{ApplyErrors{{Err: &ErrResourceConflict{errors.New("exists")}}}, "resource-conflict"},
+	} {
+		if actual := ErrorClass(c.err); actual != c.expected {
+			t.Errorf("Expected %v to be %q, got %q", c.err, c.expected, actual)
+		}
+	}
+}
+
+func TestUsageLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iamy-usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "usage.jsonl")
+
+	started := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, r := range []UsageRecord{
+		{Version: "v3", Command: "push", Flags: []string{"--dir"}, Started: started, Seconds: 4, Resources: map[string]int{"role": 10, "user": 2}, PhaseSeconds: map[string]float64{"plan sync": 1, "fetch iam": 2}},
+		{Version: "v3", Command: "pull", Started: started.Add(time.Hour), Seconds: 2},
+		{Version: "v3", Command: "push", Started: started.Add(2 * time.Hour), Seconds: 8, ExitCode: 1, ErrorClass: "throttled", PhaseSeconds: map[string]float64{"fetch iam": 5}},
+		{Version: "v4", Command: "push", Flags: []string{"--dir", "--dry-run"}, Started: started.Add(3 * time.Hour), Seconds: 6},
+	} {
+		if err := AppendUsageRecord(file, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := ReadUsageLog(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0].Resources["role"] != 10 {
+		t.Fatalf("Expected the records to round trip, got %+v", records)
+	}
+
+	summary := SummariseUsage(records)
+	if summary.Runs != 4 || !summary.From.Equal(started) || !summary.To.Equal(started.Add(3*time.Hour)) {
+		t.Errorf("Expected 4 runs over 3 hours, got %+v", summary)
+	}
+	if len(summary.Commands) != 2 || summary.Commands[0].Command != "push" {
+		t.Fatalf("Expected push then pull, got %+v", summary.Commands)
+	}
+	push := summary.Commands[0]
+	if push.Runs != 3 || push.Failures != 1 || push.ErrorClasses["throttled"] != 1 {
+		t.Errorf("Expected 1 of 3 pushes to fail throttled, got %+v", push)
+	}
+	if push.MedianSeconds != 6 || push.MaxSeconds != 8 || push.MaxResources != 12 {
+		t.Errorf("Expected a median of 6s, max of 8s and 12 resources, got %+v", push)
+	}
+	if push.SlowestPhase != "fetch iam" || push.FlagsUsed["--dir"] != 2 || push.Versions["v4"] != 1 {
+		t.Errorf("Expected fetch iam to be slowest, got %+v", push)
+	}
+}
@@ -0,0 +1,85 @@
+package iamy
+
+import "fmt"
+
+// WarningCategory groups warnings by their cause
+type WarningCategory string
+
+const (
+	// WarningSkipped is for resources that were deliberately not fetched
+	WarningSkipped WarningCategory = "skipped"
+	// WarningAccessDenied is for resources that couldn't be fetched due to missing permissions
+	WarningAccessDenied WarningCategory = "access-denied"
+	// WarningNormalised is for local files that differ from how iamy would write them
+	WarningNormalised WarningCategory = "normalised"
+	// WarningPlan is for side effects of a planned change that may be surprising
+	WarningPlan WarningCategory = "plan"
+	// WarningCompatibility is for pushes that may behave differently to the last pull
+	WarningCompatibility WarningCategory = "compatibility"
+	// WarningFallback is for data that was fetched with the fallback credentials
+	WarningFallback WarningCategory = "fallback"
+	// WarningControlTower is for resources that weren't fetched because AWS
+	// Control Tower manages them
+	WarningControlTower WarningCategory = "control-tower"
+	// WarningReadReplica is for account data read indirectly, which is only
+	// good enough for reports and drift detection
+	WarningReadReplica WarningCategory = "read-replica"
+	// WarningQuota is for quotas that are nearly used up, or exceeded
+	WarningQuota WarningCategory = "quota"
+	// WarningPrune is for resources missing from the files that aren't
+	// deleted, as deletes weren't opted into
+	WarningPrune WarningCategory = "prune"
+	// WarningExport is for resources and attributes that can't be exported
+	// to another tool's format
+	WarningExport WarningCategory = "export"
+	// WarningObserved is for changes in the files to policies that are only
+	// observed, which push doesn't make
+	WarningObserved WarningCategory = "observed"
+)
+
+// A Warning is a problem that didn't stop iamy from continuing, but that
+// a user should know about. Unlike errors they are collected and reported
+// at the end of a command
+type Warning struct {
+	Category WarningCategory `json:"Category"`
+	Resource string          `json:"Resource,omitempty"`
+	Message  string          `json:"Message"`
+}
+
+func (w Warning) String() string {
+	if w.Resource == "" {
+		return fmt.Sprintf("[%s] %s", w.Category, w.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", w.Category, w.Resource, w.Message)
+}
+
+type Warnings []Warning
+
+func (ww *Warnings) Add(category WarningCategory, resource, message string) {
+	*ww = append(*ww, Warning{category, resource, message})
+}
+
+// Count returns the number of warnings in the given category
+func (ww Warnings) Count(category WarningCategory) int {
+	count := 0
+	for _, w := range ww {
+		if w.Category == category {
+			count++
+		}
+	}
+	return count
+}
+
+// unique returns the warnings without duplicates, which retrying part of a
+// fetch can produce
+func (ww Warnings) unique() Warnings {
+	seen := map[Warning]bool{}
+	result := Warnings{}
+	for _, w := range ww {
+		if !seen[w] {
+			seen[w] = true
+			result = append(result, w)
+		}
+	}
+	return result
+}
@@ -2,30 +2,70 @@ package iamy
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
-	"text/template"
+	"sort"
+	"strings"
 
 	"github.com/ghodss/yaml"
 )
 
-const pathTemplateBlob = "{{.Account}}/{{.Resource.Service}}/{{.Resource.ResourceType}}{{.Resource.ResourcePath}}{{.Resource.ResourceName}}.yaml"
-const pathRegexBlob = `^(?P<account>[^/]+)/(?P<entity>(iam/instance-profile|iam/user|iam/group|iam/policy|iam/role|s3))(?P<resourcepath>.*/)(?P<resourcename>[^/]+)\.yaml$`
+// entityPattern matches the kinds of resources files are kept for, by
+// service and type
+const entityPattern = `iam/instance-profile|iam/user|iam/group|iam/policy|iam/role|s3control/accesspoint|s3control/objectlambda|s3control/mrap|s3control|s3|codeartifact/domain|codeartifact/repository|ses/identity|apigateway/restapi|glacier/vault|ecr/registry`
 
-var pathTemplate = template.Must(template.New("").Parse(pathTemplateBlob))
-var pathRegex = regexp.MustCompile(pathRegexBlob)
-
-type pathTemplateData struct {
-	Account  *Account
-	Resource AwsResource
-}
-
-// A YamlLoadDumper loads and dumps account data in yaml files
+// A YamlLoadDumper loads and dumps account data in yaml files, or in json
+// files, which are loaded the same way
 type YamlLoadDumper struct {
 	Dir string
+	// Format is what Dump writes files as, yaml or json, defaulting to yaml
+	Format string
+	// Layout is the layout of the files, read from the directory's layout
+	// file when nil
+	Layout *Layout
+	// KeepReferences leaves the files written with YAML anchors, aliases and
+	// merge keys as they are when their resources are unchanged, rather than
+	// writing them expanded
+	KeepReferences bool
+	// PolicyFiles writes the policy documents of the resources whose files
+	// don't refer to policy files to files in PolicyFilesDirName, for their
+	// files to refer to with PolicyFile
+	PolicyFiles bool
+
+	warnings   Warnings
+	dirLayout  *Layout
+	layoutDir  string
+	referenced map[string]referencedFile
+
+	dirAnchors    []byte
+	anchorsDir    string
+	anchorsLoaded bool
+
+	policyFiles    map[string][]policyFileRef
+	policyFilesDir string
+
+	// generated are the templates generating resources, by account and
+	// resource
+	generated map[string]string
+}
+
+func (f *YamlLoadDumper) layout() (*Layout, error) {
+	if f.Layout != nil {
+		return f.Layout, nil
+	}
+	if f.dirLayout == nil || f.layoutDir != f.Dir {
+		l, err := LoadLayout(f.Dir)
+		if err != nil {
+			return nil, err
+		}
+		f.dirLayout, f.layoutDir = l, f.Dir
+	}
+	return f.dirLayout, nil
 }
 
 func (a *YamlLoadDumper) getFilesRecursively() ([]string, error) {
@@ -67,86 +107,264 @@ func namedMatch(r *regexp.Regexp, s string) (bool, map[string]string) {
 func (a *YamlLoadDumper) Load() ([]AccountData, error) {
 	log.Println("Loading YAML IAM data from", a.Dir)
 	accounts := map[string]*AccountData{}
+	a.warnings = Warnings{}
+	a.referenced = map[string]referencedFile{}
+	a.policyFiles, a.policyFilesDir = map[string][]policyFileRef{}, a.Dir
 
+	layout, err := a.layout()
+	if err != nil {
+		return nil, err
+	}
 	allFiles, err := a.getFilesRecursively()
 	if err != nil {
 		return nil, err
 	}
 
+	fileAccounts := map[string]string{}
+	loadedFrom := map[AwsResource]string{}
 	for _, fp := range allFiles {
-		if matched, result := namedMatch(pathRegex, fp); matched {
+		accountid, entity, path, name, matched := layout.parse(fp)
+		if matched && isResourceFileDir(fp) && accountReg.MatchString(accountid) {
 			log.Println("Loading", fp)
 
-			accountid := result["account"]
-			entity := result["entity"]
-			path := result["resourcepath"]
-			name := result["resourcename"]
-
 			if _, ok := accounts[accountid]; !ok {
 				accounts[accountid] = NewAccountData(accountid)
+				accounts[accountid].layout = layout
 			}
-
-			var err error
-			nameAndPath := iamService{Name: name, Path: path}
-
-			switch entity {
-			case "iam/user":
-				u := User{
-					iamService: nameAndPath,
-					Tags:       make(map[string]string),
+			fileAccounts[fp] = accountid
+			if !layout.hasPath {
+				if path, err = a.resourcePathInFile(fp); err != nil {
+					return nil, err
 				}
-				err = a.unmarshalYamlFile(fp, &u)
-				accounts[accountid].addUser(&u)
-			case "iam/group":
-				g := Group{iamService: nameAndPath}
-				err = a.unmarshalYamlFile(fp, &g)
-				accounts[accountid].addGroup(&g)
-			case "iam/role":
-				r := Role{iamService: nameAndPath}
-				err = a.unmarshalYamlFile(fp, &r)
-				accounts[accountid].addRole(&r)
-			case "iam/policy":
-				p := Policy{iamService: nameAndPath}
-				err = a.unmarshalYamlFile(fp, &p)
-				accounts[accountid].addPolicy(&p)
-			case "iam/instance-profile":
-				profile := InstanceProfile{iamService: nameAndPath}
-				err = a.unmarshalYamlFile(fp, &profile)
-				accounts[accountid].addInstanceProfile(&profile)
-			case "s3":
-				bp := BucketPolicy{BucketName: name}
-				err = a.unmarshalYamlFile(fp, &bp)
-				accounts[accountid].addBucketPolicy(&bp)
-			default:
-				panic("Unexpected entity")
 			}
 
+			resource, err := a.loadResource(accounts[accountid], entity, path, name, func(v interface{}) error {
+				return a.unmarshalYamlFile(fp, v)
+			})
 			if err != nil {
 				return nil, err
 			}
+			if resource == nil {
+				log.Println("Skipping", fp)
+			} else {
+				loadedFrom[resource] = fp
+			}
 
+		} else if accountid, _, _, _, old := defaultLayout.parse(fp); old && !layout.IsDefault() && accountReg.MatchString(accountid) {
+			log.Println("Skipping", fp)
+			if _, ok := accounts[accountid]; ok {
+				accounts[accountid].Warnings.Add(WarningNormalised, fp, fmt.Sprintf("File isn't in the layout of %s, run iamy fmt --relayout to move it", LayoutFileName))
+			}
 		} else {
 			log.Println("Skipping", fp)
 		}
 	}
 
-	return accountMapToSlice(accounts), nil
+	if err = a.loadGenerated(accounts, layout); err != nil {
+		return nil, err
+	}
+	for _, data := range accounts {
+		data.loadedFrom = map[AwsResource]string{}
+		for _, r := range data.resources() {
+			file, ok := loadedFrom[r]
+			if !ok {
+				file = a.generated[data.Account.String()+" "+resourceKind(r)+r.ResourcePath()+r.ResourceName()]
+			}
+			if file != "" {
+				data.loadedFrom[r] = file
+			}
+		}
+		if err = a.recordSources(data); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, w := range a.warnings {
+		if accountid, ok := fileAccounts[w.Resource]; ok {
+			accounts[accountid].Warnings = append(accounts[accountid].Warnings, w)
+		}
+	}
+
+	result := accountMapToSlice(accounts)
+	for i := range result {
+		result[i].SortCanonically()
+		result[i].internStrings()
+	}
+	return result, nil
+}
+
+// loadResource adds the resource of the kind, path and name the unmarshal
+// function reads to the account data, returning it, or nil when it isn't a
+// resource
+func (a *YamlLoadDumper) loadResource(data *AccountData, entity, path, name string, unmarshal func(v interface{}) error) (AwsResource, error) {
+	nameAndPath := iamService{Name: name, Path: path}
+
+	switch entity {
+	case "iam/user":
+		u := User{
+			iamService: nameAndPath,
+			Tags:       make(map[string]string),
+		}
+		if err := unmarshal(&u); err != nil {
+			return nil, err
+		}
+		data.addUser(&u)
+		return &u, nil
+	case "iam/group":
+		g := Group{iamService: nameAndPath}
+		if err := unmarshal(&g); err != nil {
+			return nil, err
+		}
+		data.addGroup(&g)
+		return &g, nil
+	case "iam/role":
+		r := Role{iamService: nameAndPath}
+		if err := unmarshal(&r); err != nil {
+			return nil, err
+		}
+		data.addRole(&r)
+		return &r, nil
+	case "iam/policy":
+		p := Policy{iamService: nameAndPath}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addPolicy(&p)
+		return &p, nil
+	case "iam/instance-profile":
+		profile := InstanceProfile{iamService: nameAndPath}
+		if err := unmarshal(&profile); err != nil {
+			return nil, err
+		}
+		data.addInstanceProfile(&profile)
+		return &profile, nil
+	case "s3":
+		bp := BucketPolicy{BucketName: name}
+		if err := unmarshal(&bp); err != nil {
+			return nil, err
+		}
+		data.addBucketPolicy(&bp)
+		return &bp, nil
+	case "s3control/accesspoint":
+		p := AccessPoint{
+			Region: strings.Trim(path, "/"),
+			Name:   name,
+		}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addAccessPoint(&p)
+		return &p, nil
+	case "s3control/objectlambda":
+		p := ObjectLambdaAccessPoint{
+			Region: strings.Trim(path, "/"),
+			Name:   name,
+		}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addObjectLambdaAccessPoint(&p)
+		return &p, nil
+	case "s3control":
+		if path != "/" || name != accountPublicAccessBlockName {
+			return nil, nil
+		}
+		p := AccountPublicAccessBlock{}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.AccountPublicAccessBlock = &p
+		return &p, nil
+	case "codeartifact/domain":
+		p := CodeArtifactDomainPolicy{
+			Region:     strings.Trim(path, "/"),
+			DomainName: name,
+		}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addCodeArtifactDomainPolicy(&p)
+		return &p, nil
+	case "codeartifact/repository":
+		// the path is the repository's region and then its domain
+		p := CodeArtifactRepositoryPolicy{RepositoryName: name}
+		regionAndDomain := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+		p.Region = regionAndDomain[0]
+		if len(regionAndDomain) == 2 {
+			p.DomainName = regionAndDomain[1]
+		}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addCodeArtifactRepositoryPolicy(&p)
+		return &p, nil
+	case "ses/identity":
+		p := SesIdentityPolicies{
+			Region:   strings.Trim(path, "/"),
+			Identity: name,
+		}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addSesIdentityPolicies(&p)
+		return &p, nil
+	case "apigateway/restapi":
+		p := RestApiPolicy{
+			Region:    strings.Trim(path, "/"),
+			RestApiId: name,
+		}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addRestApiPolicy(&p)
+		return &p, nil
+	case "s3control/mrap":
+		p := MultiRegionAccessPoint{Name: name}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addMultiRegionAccessPoint(&p)
+		return &p, nil
+	case "glacier/vault":
+		p := GlacierVaultPolicy{
+			Region:    strings.Trim(path, "/"),
+			VaultName: name,
+		}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addGlacierVaultPolicy(&p)
+		return &p, nil
+	case "ecr/registry":
+		p := EcrRegistryPolicy{Region: name}
+		if err := unmarshal(&p); err != nil {
+			return nil, err
+		}
+		data.addEcrRegistryPolicy(&p)
+		return &p, nil
+	}
+	panic("Unexpected entity")
 }
 
 func accountMapToSlice(accounts map[string]*AccountData) (aa []AccountData) {
 	for _, a := range accounts {
 		aa = append(aa, *a)
 	}
+	sort.Slice(aa, func(i, j int) bool { return aa[i].Account.String() < aa[j].Account.String() })
 	return
 }
 
 // Dump writes AccountData into yaml files in the a.Dir directory
 func (f *YamlLoadDumper) Dump(accountData *AccountData, canDelete bool) error {
-	destDir := filepath.Join(f.Dir, accountData.Account.String())
 	log.Println("Dumping YAML IAM data to", f.Dir)
 
 	if canDelete {
-		if err := os.RemoveAll(destDir); err != nil {
+		// the policy files the removed files refer to are kept for their
+		// resources' files to refer to again
+		if _, err := f.policyFileRefs(); err != nil {
+			return err
+		}
+		if err := f.removeAccountFiles(accountData.Account); err != nil {
 			return err
 		}
 	}
@@ -187,6 +405,66 @@ func (f *YamlLoadDumper) Dump(accountData *AccountData, canDelete bool) error {
 		}
 	}
 
+	if accountData.AccountPublicAccessBlock != nil {
+		if err := f.writeResource(accountData.Account, accountData.AccountPublicAccessBlock); err != nil {
+			return err
+		}
+	}
+
+	for _, accessPoint := range accountData.AccessPoints {
+		if err := f.writeResource(accountData.Account, accessPoint); err != nil {
+			return err
+		}
+	}
+
+	for _, accessPoint := range accountData.ObjectLambdaAccessPoints {
+		if err := f.writeResource(accountData.Account, accessPoint); err != nil {
+			return err
+		}
+	}
+
+	for _, domainPolicy := range accountData.CodeArtifactDomainPolicies {
+		if err := f.writeResource(accountData.Account, domainPolicy); err != nil {
+			return err
+		}
+	}
+
+	for _, repositoryPolicy := range accountData.CodeArtifactRepositoryPolicies {
+		if err := f.writeResource(accountData.Account, repositoryPolicy); err != nil {
+			return err
+		}
+	}
+
+	for _, identityPolicies := range accountData.SesIdentityPolicies {
+		if err := f.writeResource(accountData.Account, identityPolicies); err != nil {
+			return err
+		}
+	}
+
+	for _, restApiPolicy := range accountData.RestApiPolicies {
+		if err := f.writeResource(accountData.Account, restApiPolicy); err != nil {
+			return err
+		}
+	}
+
+	for _, accessPoint := range accountData.MultiRegionAccessPoints {
+		if err := f.writeResource(accountData.Account, accessPoint); err != nil {
+			return err
+		}
+	}
+
+	for _, vaultPolicy := range accountData.GlacierVaultPolicies {
+		if err := f.writeResource(accountData.Account, vaultPolicy); err != nil {
+			return err
+		}
+	}
+
+	for _, registryPolicy := range accountData.EcrRegistryPolicies {
+		if err := f.writeResource(accountData.Account, registryPolicy); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -196,27 +474,208 @@ func (f *YamlLoadDumper) unmarshalYamlFile(relativePath string, entity interface
 	if err != nil {
 		return err
 	}
-	err = yaml.Unmarshal(data, entity)
+	expanded, refs, err := f.expandPolicyFiles(relativePath, data)
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 && f.policyFiles != nil {
+		f.policyFiles[relativePath] = refs
+	}
+	err = f.unmarshalYaml(relativePath, expanded, entity)
+	if _, ok := err.(*ErrValidation); ok {
+		return err
+	}
+	if err != nil {
+		return validationError(relativePath, err)
+	}
+
+	content, _, err := f.withPolicyFiles(relativePath, f.fileContent(entity), false)
 	if err != nil {
 		return err
 	}
+	canonical, err := f.styledFile(relativePath, content)
+	switch {
+	case err != nil || bytes.Equal(canonical, data):
+	case usesReferences(data):
+		if f.referenced != nil {
+			f.referenced[relativePath] = referencedFile{data, canonical}
+		}
+	default:
+		f.warnings.Add(WarningNormalised, relativePath, "File isn't formatted the way iamy writes it, run iamy fmt to reformat it")
+	}
 
 	return nil
 }
 
+// resourcePathInFile returns the path a file keeps, for layouts without the
+// path, which is / when the file has none
+func (f *YamlLoadDumper) resourcePathInFile(relativePath string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(f.Dir, relativePath))
+	if err != nil {
+		return "", err
+	}
+	var kept struct {
+		Path string `json:"Path"`
+	}
+	if err = f.unmarshalYaml(relativePath, data, &kept); err != nil {
+		if _, ok := err.(*ErrValidation); ok {
+			return "", err
+		}
+		return "", validationError(relativePath, err)
+	}
+	trimmed := strings.Trim(kept.Path, "/")
+	if trimmed == "" {
+		return "/", nil
+	}
+	return "/" + trimmed + "/", nil
+}
+
+// fileContent returns what is written to the file of a resource, which keeps
+// its path when the layout doesn't
+func (f *YamlLoadDumper) fileContent(thing interface{}) interface{} {
+	r, ok := thing.(AwsResource)
+	if !ok || r.ResourcePath() == "/" {
+		return thing
+	}
+	if layout, err := f.layout(); err != nil || layout.hasPath {
+		return thing
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return thing
+	}
+	content := map[string]interface{}{}
+	if err = json.Unmarshal(b, &content); err != nil {
+		return thing
+	}
+	content[pathFileKey] = r.ResourcePath()
+	return content
+}
+
 func (f *YamlLoadDumper) writeResource(a *Account, r AwsResource) error {
-	path := mustExecutePathTemplate(pathTemplateData{a, r})
+	// a template generates the resource, so it has no file
+	if template, err := f.generatedBy(a, r); err != nil || template != "" {
+		return err
+	}
+	path, err := f.resourceFile(a, r)
+	if err != nil {
+		return err
+	}
+
+	content, docs, err := f.withPolicyFiles(path, f.fileContent(r), f.PolicyFiles)
+	if err != nil {
+		return err
+	}
+	layout, err := f.layout()
+	if err != nil {
+		return err
+	}
+	style := layout.PolicyStyle
+	for file, doc := range docs {
+		file = filepath.Join(f.Dir, filepath.FromSlash(file))
+		if doc, err = withStatementOrder(file, doc, layout.StatementOrder, true); err != nil {
+			return err
+		}
+		if err := writeStyledJsonFile(file, doc, style, true); err != nil {
+			return err
+		}
+	}
 
-	return writeYamlFile(filepath.Join(f.Dir, path), r)
+	data, ok := f.keptReferences(path, content)
+	if !ok {
+		if data, err = f.styledFile(path, content); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(f.Dir, path)), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(f.Dir, path), data, 0666)
+}
+
+// styledFile returns the content of a resource's file, relative to f.Dir, as
+// iamy writes it, with the layout's policy style and statement order, and as
+// JSON when it's a .json file
+func (f *YamlLoadDumper) styledFile(path string, content interface{}) ([]byte, error) {
+	layout, err := f.layout()
+	if err != nil {
+		return nil, err
+	}
+	if content, err = withStatementOrder(filepath.Join(f.Dir, path), content, layout.StatementOrder, false); err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".json") {
+		b, err := styledJson(content, layout.PolicyStyle, false)
+		return append(b, '\n'), err
+	}
+	return styledYaml(content, layout.PolicyStyle)
+}
+
+// resourceFile returns the resource's file, relative to f.Dir, in f.Format
+func (f *YamlLoadDumper) resourceFile(a *Account, r AwsResource) (string, error) {
+	layout, err := f.layout()
+	if err != nil {
+		return "", err
+	}
+	if f.Format == "json" {
+		return layout.file(a, r) + ".json", nil
+	}
+	return layout.file(a, r) + ".yaml", nil
 }
 
-func mustExecutePathTemplate(data interface{}) string {
-	buf := &bytes.Buffer{}
-	if err := pathTemplate.Execute(buf, data); err != nil {
-		panic(err)
+// removeAccountFiles removes the files of the account's resources, its
+// directory in the default layout
+func (f *YamlLoadDumper) removeAccountFiles(a *Account) error {
+	layout, err := f.layout()
+	if err != nil {
+		return err
+	}
+	if layout.IsDefault() {
+		return os.RemoveAll(filepath.Join(f.Dir, a.String()))
+	}
+	files, err := f.accountFiles(a)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Remove(filepath.Join(f.Dir, filepath.FromSlash(file))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accountFiles returns the files of the account's resources in the layout,
+// relative to f.Dir
+func (f *YamlLoadDumper) accountFiles(a *Account) ([]string, error) {
+	layout, err := f.layout()
+	if err != nil {
+		return nil, err
+	}
+	allFiles, err := f.getFilesRecursively()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, fp := range allFiles {
+		if account, _, _, _, ok := layout.parse(fp); ok && account == a.String() && isResourceFileDir(fp) {
+			files = append(files, fp)
+		}
+	}
+	return files, nil
+}
+
+func writeJsonFile(path string, thing interface{}) error {
+	b, err := json.MarshalIndent(thing, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
 	}
 
-	return buf.String()
+	return ioutil.WriteFile(path, append(b, '\n'), 0666)
 }
 
 func writeYamlFile(path string, thing interface{}) error {
@@ -64,3 +64,78 @@ func TestRoundTrip(t *testing.T) {
 		t.Error("Directory contents are not equal")
 	}
 }
+
+func TestLoadWarnsAboutUnformattedFiles(t *testing.T) {
+	accountData := loadTestdataAccount(t)
+
+	found := false
+	for _, w := range accountData.Warnings {
+		if w.Category == WarningNormalised && w.Resource == "myalias-123/iam/policy/TestPolicyAccess.yaml" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected a warning for the unformatted policy file, got %v", accountData.Warnings)
+	}
+}
+
+func TestJsonFilesRoundTrip(t *testing.T) {
+	accountData := loadTestdataAccount(t)
+
+	testdir := newTmpDir()
+	defer os.RemoveAll(testdir)
+	y := YamlLoadDumper{Dir: testdir, Format: "json"}
+	if err := y.Dump(accountData, false); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for name := range readDir(testdir) {
+		if filepath.Ext(name) != ".json" {
+			t.Errorf("Expected only .json files, got %s", name)
+		}
+	}
+
+	loaded, err := y.Load()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("Expected 1 account, got %d", len(loaded))
+	}
+
+	expected := map[string]string{}
+	for _, r := range accountData.resources() {
+		expected[resourceKey(r)] = resourceJson(r)
+	}
+	actual := map[string]string{}
+	for _, r := range loaded[0].resources() {
+		actual[resourceKey(r)] = resourceJson(r)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected the resources read back from the JSON files to equal those dumped")
+	}
+}
+
+func TestCodeArtifactRepositoryRoundTrip(t *testing.T) {
+	doc := mustPolicyDocument(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::456:root"},"Action":"codeartifact:ReadFromRepository","Resource":"*"}]}`)
+	data := NewAccountData("myalias-123")
+	data.addCodeArtifactRepositoryPolicy(&CodeArtifactRepositoryPolicy{Region: "eu-west-1", DomainName: "packages", RepositoryName: "npm", Policy: doc})
+
+	testdir := newTmpDir()
+	defer os.RemoveAll(testdir)
+	y := YamlLoadDumper{Dir: testdir}
+	if err := y.Dump(data, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(testdir, "myalias-123", "codeartifact", "repository", "eu-west-1", "packages", "npm.yaml")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	loaded, err := y.Load()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if found, _ := loaded[0].FindCodeArtifactRepositoryPolicyByName("eu-west-1", "packages", "npm"); !found {
+		t.Errorf("Expected the repository policy in eu-west-1/packages, got %v", loaded[0].CodeArtifactRepositoryPolicies)
+	}
+}
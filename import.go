@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/envato/iamy/iamy"
+)
+
+type ImportCommandInput struct {
+	Dir                   string
+	Selector              string
+	WithReferences        bool
+	Overwrite             bool
+	HeuristicCfnMatching  bool
+	SkipTagged            []string
+	IncludeTagged         []string
+	SkipPathPrefixes      []string
+	SkipBucketPrefixes    []string
+	IncludeBucketPatterns []string
+	IncludeControlTower   bool
+	Regions               []string
+	Timings               *iamy.Timings
+	FallbackProfile       string
+	FallbackRoleArn       string
+}
+
+// ImportCommand writes the files of the resources the selector selects in the
+// active AWS account, fetching only their service, so resources created
+// outside iamy can be adopted one at a time without a full pull
+func ImportCommand(ui Ui, input ImportCommandInput) {
+	selector, err := iamy.ParseResourceSelector(input.Selector)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ignore, err := iamy.LoadIgnoreCatalogue(input.Dir)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	aws := iamy.AwsFetcher{
+		Debug:                 ui.Debug,
+		HeuristicCfnMatching:  input.HeuristicCfnMatching,
+		SkipTagged:            input.SkipTagged,
+		IncludeTagged:         input.IncludeTagged,
+		SkipPathPrefixes:      input.SkipPathPrefixes,
+		SkipBucketPrefixes:    input.SkipBucketPrefixes,
+		IncludeBucketPatterns: input.IncludeBucketPatterns,
+		IncludeControlTower:   input.IncludeControlTower,
+		Regions:               input.Regions,
+		Ignore:                ignore,
+		Timings:               input.Timings,
+		FallbackProfile:       input.FallbackProfile,
+		FallbackRoleArn:       input.FallbackRoleArn,
+		Phases:                iamy.TargetFetchPhases([]iamy.ResourceSelector{selector}),
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	stop := input.Timings.Track("load yaml")
+	allDataFromYaml, err := yaml.Load()
+	stop()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	dataFromAws, err := aws.Fetch()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.usage.countResources(dataFromAws)
+	ui.PrintWarnings(dataFromAws.Warnings)
+
+	files := iamy.NewAccountData(dataFromAws.Account.Id)
+	files.Account = dataFromAws.Account
+	for i, data := range allDataFromYaml {
+		if data.Account.Id == dataFromAws.Account.Id {
+			files = &allDataFromYaml[i]
+		}
+	}
+
+	imported, existing := iamy.ImportResources(dataFromAws, files, selector, input.WithReferences)
+	if len(imported) == 0 && len(existing) == 0 {
+		ui.Fatalf("No resources in AWS Account ID %s match %s", dataFromAws.Account.Id, selector)
+		return
+	}
+	if input.Overwrite {
+		imported = append(imported, existing...)
+	} else {
+		for _, r := range existing {
+			ui.Printf("Skipping %s, which is already in the files, import with --overwrite to replace it", files.ResourceFile(r))
+		}
+	}
+
+	if *dryRun {
+		for _, r := range imported {
+			ui.Printf("Would import %s", files.ResourceFile(r))
+		}
+		ui.Println("Dry-run mode not writing files")
+		return
+	}
+	stop = input.Timings.Track("dump yaml")
+	err = yaml.WriteResources(files.Account, imported)
+	stop()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	for _, r := range imported {
+		ui.Printf("Imported %s", files.ResourceFile(r))
+	}
+}
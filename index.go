@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type IndexCommandInput struct {
+	Dir        string
+	OutputFile string
+}
+
+// IndexCommand writes the reverse index of the actions and principals in the
+// yaml files, for other tools to read instead of parsing the files. Pull
+// refreshes the index in the directory for the account it pulls
+func IndexCommand(ui Ui, input IndexCommandInput) {
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	accounts := []*iamy.AccountData{}
+	for i := range allDataFromYaml {
+		accounts = append(accounts, &allDataFromYaml[i])
+	}
+	index := iamy.NewReferenceIndex(time.Now(), accounts...)
+
+	file := input.OutputFile
+	if file == "" {
+		file = filepath.Join(input.Dir, iamy.ReferenceIndexFileName)
+	}
+	if err = index.Write(file); err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.Printf("Indexed %d actions and %d principals of %d accounts in %s", len(index.Actions), len(index.TrustedBy), len(accounts), file)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/envato/iamy/iamy"
+	"github.com/pkg/errors"
+)
+
+// writeJUnit writes the cases to the --junit file as JUnit XML, when one
+// was given
+func writeJUnit(ui Ui, file string, cases []iamy.JUnitCase) {
+	if file == "" {
+		return
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	err = iamy.WriteJUnit(f, cases)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		ui.Fatal(err)
+	}
+}
+
+// writeJUnitError writes the error that stopped the command to the --junit
+// file, as an error of the file that couldn't be read when it's a
+// validation error, so CI shows it like any other result
+func writeJUnitError(ui Ui, file, suite string, err error) {
+	writeJUnit(ui, file, []iamy.JUnitCase{errorCase(suite, err)})
+}
+
+// errorCase is the case of the error that stopped the command, of the file
+// that couldn't be read when it's a validation error
+func errorCase(suite string, err error) iamy.JUnitCase {
+	name := suite
+	var validation *iamy.ErrValidation
+	if errors.As(err, &validation) {
+		name = validation.File
+	}
+	return iamy.JUnitCase{Suite: suite, ClassName: suite, Name: name, Error: err.Error()}
+}
+
+// ResultFiles are the files analyze also writes its results to, for CI, as
+// JUnit XML and as SARIF, when they were given
+type ResultFiles struct {
+	JUnitFile string
+	SarifFile string
+}
+
+// writeResults writes the cases to the result files. The cases are of the
+// files in dir
+func writeResults(ui Ui, files ResultFiles, dir string, cases []iamy.JUnitCase) {
+	writeJUnit(ui, files.JUnitFile, cases)
+	writeSarif(ui, files.SarifFile, dir, cases)
+}
+
+// writeResultsError writes the error that stopped the command to the result
+// files, like writeJUnitError
+func writeResultsError(ui Ui, files ResultFiles, dir, suite string, err error) {
+	writeResults(ui, files, dir, []iamy.JUnitCase{errorCase(suite, err)})
+}
+
+// writeSarif writes the cases to the --sarif file as SARIF, when one was
+// given, locating their files from the working directory, which is the root
+// of the repository in CI
+func writeSarif(ui Ui, file, dir string, cases []iamy.JUnitCase) {
+	if file == "" {
+		return
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				dir = rel
+			}
+		}
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	err = iamy.WriteSarif(f, cases, filepath.ToSlash(dir), Version)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		ui.Fatal(err)
+	}
+}
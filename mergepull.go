@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type MergePullCommandInput struct {
+	Dir     string
+	Base    string
+	Theirs  string
+	Account string
+}
+
+// MergePullCommand reconciles two operators' pulls of the same account, the
+// files in Dir and their tree, a directory of files or a snapshot, using
+// the snapshot of the previous pull as the base. Changes to resources only
+// one side made are merged into Dir, and resources both changed differently
+// are left as they are in Dir and listed as conflicts
+func MergePullCommand(ui Ui, input MergePullCommandInput) {
+	base, err := loadMergeSide(input.Base, input.Account)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ours, err := loadMergeSide(input.Dir, base.Account.Id)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	theirs, err := loadMergeSide(input.Theirs, base.Account.Id)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	result, err := iamy.MergeAccounts(base, ours, theirs)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	for _, ch := range result.Theirs {
+		ui.Printf("Merging %s, %s in %s", ch.Resource, ch.Action, input.Theirs)
+	}
+	for _, c := range result.Conflicts {
+		conflict := fmt.Sprintf("Conflict in %s, %s in %s and %s in %s", c.Resource, c.Ours, input.Dir, c.Theirs, input.Theirs)
+		if len(c.Attributes) > 0 {
+			conflict += fmt.Sprintf(" (%s)", strings.Join(c.Attributes, ", "))
+		}
+		ui.Error.Println(conflict)
+	}
+
+	if len(result.Theirs) == 0 {
+		ui.Printf("No changes to merge from %s", input.Theirs)
+	} else if *dryRun {
+		ui.Println("Dry-run mode not writing files")
+	} else {
+		yaml := iamy.YamlLoadDumper{
+			Dir: input.Dir,
+		}
+		if err = yaml.DumpMerge(result); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Printf("Merged %d changes from %s", len(result.Theirs), input.Theirs)
+	}
+
+	if len(result.Conflicts) > 0 {
+		ui.Error.Printf("%d resources have conflicts and are left as they are in %s, resolve them before pushing", len(result.Conflicts), input.Dir)
+		ui.Exit(1)
+	}
+}
+
+// loadMergeSide loads the account from a directory of files, or from a
+// snapshot. Without an account, a directory must have only one
+func loadMergeSide(path, account string) (*iamy.AccountData, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		snapshot := iamy.SnapshotLoadDumper{
+			Path: path,
+		}
+		data, err := snapshot.Load()
+		if err != nil {
+			return nil, err
+		}
+		if account != "" && data.Account.Id != account && data.Account.String() != account {
+			return nil, fmt.Errorf("The snapshot %s is of account %s, not %s", path, data.Account, account)
+		}
+		return data, nil
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: path,
+	}
+	all, err := yaml.Load()
+	if err != nil {
+		return nil, err
+	}
+	if account == "" && len(all) > 1 {
+		return nil, fmt.Errorf("%s has files for several accounts, give the account to merge with --account", path)
+	}
+	for i, data := range all {
+		if account == "" || data.Account.Id == account || data.Account.String() == account {
+			return &all[i], nil
+		}
+	}
+	if account == "" {
+		return nil, fmt.Errorf("No files found in %s", path)
+	}
+	return nil, fmt.Errorf("No files found for account %s in %s", account, path)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/envato/iamy/iamy"
+	"github.com/fatih/color"
+	"github.com/ghodss/yaml"
+)
+
+type OrgCommandInput struct {
+	InventoryFile   string
+	Timings         *iamy.Timings
+	FallbackProfile string
+	FallbackRoleArn string
+}
+
+// loadOrgInventory reads the inventory file, or fetches the inventory from
+// AWS Organizations without one
+func loadOrgInventory(ui Ui, input OrgCommandInput) (*iamy.OrgInventory, error) {
+	if input.InventoryFile != "" {
+		return iamy.LoadOrgInventory(input.InventoryFile)
+	}
+	aws := iamy.AwsFetcher{
+		Debug:           ui.Debug,
+		Timings:         input.Timings,
+		FallbackProfile: input.FallbackProfile,
+		FallbackRoleArn: input.FallbackRoleArn,
+	}
+	return aws.FetchOrgInventory()
+}
+
+// OrgInventoryCommand prints the units and accounts of the organization as
+// JSON, so the credentials to read the organization are only needed once
+func OrgInventoryCommand(ui Ui, input OrgCommandInput) {
+	inv, err := loadOrgInventory(ui, input)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	b, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.Println(string(b))
+}
+
+type OrgTrustPolicyCommandInput struct {
+	OrgCommandInput
+	Units   []string
+	Actions []string
+	Format  string
+}
+
+// OrgTrustPolicyCommand prints a trust policy allowing the principals of the
+// organization, or of the units, the actions, to paste into a role's file
+func OrgTrustPolicyCommand(ui Ui, input OrgTrustPolicyCommandInput) {
+	inv, err := loadOrgInventory(ui, input.OrgCommandInput)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	doc, err := iamy.OrgTrustPolicy(inv, input.Actions, input.Units)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err == nil && input.Format == "yaml" {
+		b, err = yaml.JSONToYAML(b)
+	}
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.Println(string(b))
+}
+
+type OrgUpdateAccountsCommandInput struct {
+	OrgCommandInput
+	Dir          string
+	PreviousFile string
+	Save         bool
+}
+
+// OrgUpdateAccountsCommand updates the account lists in the files for the
+// accounts that joined or left the organization since the previous
+// inventory, in one pass over every policy document, for push to apply
+func OrgUpdateAccountsCommand(ui Ui, input OrgUpdateAccountsCommandInput) {
+	previous, err := iamy.LoadOrgInventory(input.PreviousFile)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	current, err := loadOrgInventory(ui, input.OrgCommandInput)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	if previous.Id != current.Id {
+		ui.Fatalf("The previous inventory is of %s, not %s", previous.Id, current.Id)
+		return
+	}
+
+	files := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := files.Load()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	written := 0
+	for i := range allDataFromYaml {
+		account := &allDataFromYaml[i]
+		updates, changed := iamy.UpdateAccountLists(account, previous, current)
+		for _, u := range updates {
+			if len(u.Added) == 0 && len(u.Removed) == 0 {
+				ui.Println(color.YellowString(u.String()))
+			} else {
+				ui.Println(u.String())
+			}
+		}
+		if *dryRun || len(changed) == 0 {
+			continue
+		}
+		if err := files.WriteResources(account.Account, changed); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		written += len(changed)
+	}
+
+	if *dryRun {
+		ui.Println("Dry-run mode not writing files")
+		return
+	}
+	ui.Printf("Updated %d files, push them to apply the changes", written)
+	if input.Save {
+		b, err := json.MarshalIndent(current, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(input.PreviousFile, append(b, '\n'), 0644)
+		}
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Printf("Saved the current inventory to %s", input.PreviousFile)
+	}
+}
@@ -2,37 +2,218 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
+	"time"
 
 	"github.com/envato/iamy/iamy"
+	"github.com/fatih/color"
 )
 
 type PullCommandInput struct {
-	Dir                  string
-	CanDelete            bool
-	HeuristicCfnMatching bool
-	SkipTagged           []string
-	IncludeTagged        []string
-	SkipPathPrefixes     []string
+	Dir                   string
+	CanDelete             bool
+	Format                string
+	Kinds                 []iamy.ResourceSelector
+	HeuristicCfnMatching  bool
+	SkipTagged            []string
+	IncludeTagged         []string
+	SkipPathPrefixes      []string
+	SkipBucketPrefixes    []string
+	IncludeBucketPatterns []string
+	IncludeControlTower   bool
+	Regions               []string
+	SnapshotFile          string
+	PublishSnapshot       string
+	PublishRetention      iamy.SnapshotRetention
+	SuggestSplits         bool
+	PolicyFiles           bool
+	SplitThresholds       iamy.SplitThresholds
+	Timings               *iamy.Timings
+	StateParameter        string
+	FallbackProfile       string
+	FallbackRoleArn       string
+	ConfigAggregator      string
+	AccountId             string
 }
 
 func PullCommand(ui Ui, input PullCommandInput) {
+	ignore, err := iamy.LoadIgnoreCatalogue(input.Dir)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
 	aws := iamy.AwsFetcher{
-		Debug:                ui.Debug,
-		HeuristicCfnMatching: input.HeuristicCfnMatching,
-		SkipTagged:           input.SkipTagged,
-		IncludeTagged:        input.IncludeTagged,
-		SkipPathPrefixes:     input.SkipPathPrefixes,
+		Debug:                 ui.Debug,
+		HeuristicCfnMatching:  input.HeuristicCfnMatching,
+		SkipTagged:            input.SkipTagged,
+		IncludeTagged:         input.IncludeTagged,
+		SkipPathPrefixes:      input.SkipPathPrefixes,
+		SkipBucketPrefixes:    input.SkipBucketPrefixes,
+		IncludeBucketPatterns: input.IncludeBucketPatterns,
+		IncludeControlTower:   input.IncludeControlTower,
+		Regions:               input.Regions,
+		Ignore:                ignore,
+		Timings:               input.Timings,
+		FallbackProfile:       input.FallbackProfile,
+		FallbackRoleArn:       input.FallbackRoleArn,
+		ConfigAggregator:      input.ConfigAggregator,
+		AccountId:             input.AccountId,
+		Phases:                iamy.TargetFetchPhases(input.Kinds),
 	}
 	data, err := aws.Fetch()
 	if err != nil {
-		ui.Error.Fatal(fmt.Printf("%s", err))
+		ui.Fatal(err)
+		return
+	}
+	if len(input.Kinds) > 0 {
+		data = iamy.FilterResourceKinds(data, input.Kinds)
+	}
+	ui.PrintWarnings(data.Warnings)
+	ui.usage.countResources(data)
+
+	if input.Format == "json" || input.Format == "yaml-document" {
+		if input.Format == "json" {
+			err = iamy.WriteSnapshot(ui.Writer(), data)
+		} else {
+			err = iamy.WriteSnapshotYaml(ui.Writer(), data)
+		}
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		writeSnapshotFile(ui, input, data)
+		return
 	}
 
 	yaml := iamy.YamlLoadDumper{
-		Dir: input.Dir,
+		Dir:         input.Dir,
+		PolicyFiles: input.PolicyFiles,
+	}
+	if input.Format == "json-files" {
+		yaml.Format = "json"
 	}
+	if input.CanDelete {
+		archived, err := yaml.ArchiveDeleted(data, input.Kinds, time.Now())
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		for _, t := range archived {
+			ui.Printf("Removing %s, deleted from AWS, keeping it in %s", t.File, filepath.Join(input.Dir, iamy.ArchiveDirName))
+		}
+	}
+
+	drift, err := yaml.TemplateDrift(data)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.PrintWarnings(drift)
+
+	stop := input.Timings.Track("dump yaml")
 	err = yaml.Dump(data, input.CanDelete)
+	stop()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	if input.SuggestSplits {
+		limits, _ := iamy.ParseQuotaLimits(nil)
+		suggestions := iamy.SuggestInlinePolicySplits(data, input.SplitThresholds, limits)
+		if err = yaml.DumpSplitSuggestions(data.Account, suggestions); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		if len(suggestions) > 0 {
+			ui.Printf("Suggested moving the inline policies of %d entities to managed policies in %s", len(suggestions), filepath.Join(input.Dir, data.Account.String(), iamy.SplitSuggestionsFileName))
+		}
+	}
+
+	if _, err := yaml.RefreshReferenceIndex(time.Now(), data); err != nil {
+		ui.Error.Println(color.YellowString("Warning: couldn't refresh %s, run iamy index: %s", iamy.ReferenceIndexFileName, err))
+	}
+
+	recorded := printAwsManagedPolicyUpdates(ui, input.Dir, &aws, data)
+
+	state := iamy.PullState{
+		Version:            Version,
+		LastPull:           time.Now().UTC().Truncate(24 * time.Hour),
+		OptionsHash:        aws.OptionsHash(),
+		AwsManagedPolicies: data.AwsManagedPolicyVersions,
+	}
+	if state.AwsManagedPolicies == nil {
+		// IAM wasn't fetched from the account's IAM API, so keep the versions
+		// to compare the next pull with
+		state.AwsManagedPolicies = recorded
+	}
+	if err = iamy.WriteStateFile(input.Dir, data.Account, state); err != nil {
+		ui.Fatal(err)
+		return
+	}
+	if input.StateParameter != "" {
+		if err = iamy.WriteStateParameter(input.StateParameter, state); err != nil {
+			ui.Fatal(err)
+			return
+		}
+	}
+
+	writeSnapshotFile(ui, input, data)
+}
+
+// writeSnapshotFile writes the account data to the snapshot file, and
+// publishes it to the snapshot bucket, if they were asked for
+func writeSnapshotFile(ui Ui, input PullCommandInput, data *iamy.AccountData) {
+	if input.SnapshotFile != "" {
+		snapshot := iamy.SnapshotLoadDumper{
+			Path: input.SnapshotFile,
+		}
+		if err := snapshot.Dump(data); err != nil {
+			ui.Fatal(err)
+			return
+		}
+	}
+	if input.PublishSnapshot != "" {
+		manifest, err := iamy.PublishSnapshot(input.PublishSnapshot, input.PublishRetention, data, time.Now(), Version)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		out := ui.Logger
+		if input.Format == "json" || input.Format == "yaml-document" {
+			// the account data is written to stdout
+			out = ui.Error
+		}
+		out.Printf("Published %s, SHA-256 %s", manifest.Snapshot, manifest.Sha256)
+	}
+}
+
+// printAwsManagedPolicyUpdates warns about the AWS managed policies AWS has
+// updated since the last pull into dir, with the statements AWS changed, as
+// they change permissions without any change to the files. It returns the
+// versions recorded by the last pull
+func printAwsManagedPolicyUpdates(ui Ui, dir string, aws *iamy.AwsFetcher, data *iamy.AccountData) map[string]string {
+	states, err := iamy.ReadStateFile(dir)
 	if err != nil {
-		ui.Error.Fatal(err)
+		ui.Fatal(err)
+		return nil
+	}
+	recorded := states[data.Account.String()].AwsManagedPolicies
+
+	for _, u := range iamy.AwsManagedPolicyUpdates(recorded, data.AwsManagedPolicyVersions) {
+		ui.PrintWarnings(iamy.Warnings{{
+			Category: iamy.WarningCompatibility,
+			Resource: u.Arn,
+			Message:  fmt.Sprintf("Updated by AWS from %s to %s since the last pull", u.FromVersion, u.ToVersion),
+		}})
+		diff, err := aws.AwsManagedPolicyDiff(u)
+		if err != nil {
+			ui.Error.Println(color.YellowString("Warning: %s", err))
+			continue
+		}
+		ui.Error.Print(diff)
 	}
+
+	return recorded
 }
@@ -6,58 +6,335 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/envato/iamy/iamy"
 	"github.com/fatih/color"
 )
 
 type PushCommandInput struct {
-	Dir                  string
-	HeuristicCfnMatching bool
-	SkipTagged           []string
-	IncludeTagged        []string
-	SkipPathPrefixes     []string
+	Dir                   string
+	HeuristicCfnMatching  bool
+	SkipTagged            []string
+	IncludeTagged         []string
+	SkipPathPrefixes      []string
+	SkipBucketPrefixes    []string
+	IncludeBucketPatterns []string
+	IncludeControlTower   bool
+	Regions               []string
+	Timings               *iamy.Timings
+	StateParameter        string
+	MaxPullAge            time.Duration
+	Output                string
+	DiffStyle             string
+	SavedPlan             string
+	ScriptFormat          string
+	Targets               []string
+	Kinds                 []iamy.ResourceSelector
+	Protect               []string
+	Workers               int
+	RateLimit             float64
+	ContinueOnError       bool
+	Retry                 iamy.RetryPolicy
+	DetailedExitCode      bool
+	Journal               string
+	DocumentDir           string
+	KeepDocumentFiles     bool
+	Rollback              bool
+	VersionRetention      int
+	KeepVersions          bool
+	QuotaWarnAt           float64
+	// QuotaLimits are raised IAM quota limits, by quota name
+	QuotaLimits map[string]string
+	// PlanOutputs are the files to render the plan to, by renderer name
+	PlanOutputs     map[string]string
+	DetectRenames   bool
+	Prune           bool
+	FallbackProfile string
+	FallbackRoleArn string
+	// ConfigAggregator reads the IAM data of AccountId from an AWS Config
+	// aggregator, when commands are never run
+	ConfigAggregator string
+	AccountId        string
+	// BlastRadius limits how much of the account a push changes, unless
+	// Force is set
+	BlastRadius iamy.BlastRadius
+	Force       bool
+	// VerifyBeforeApply re-reads each resource's policy documents before
+	// changing it, refusing to change it if they changed since the plan
+	VerifyBeforeApply bool
+	// AllAccounts pushes every account with files, assuming AccountRole in
+	// each
+	AllAccounts bool
+	AccountRole string
+
+	// commandEnv returns the environment to run aws commands with, if set
+	commandEnv func() ([]string, error)
 }
 
 func PushCommand(ui Ui, input PushCommandInput) {
+	if input.Rollback {
+		rollback(ui, input.Journal)
+		return
+	}
+
+	for name := range input.PlanOutputs {
+		if _, ok := iamy.PlanRenderers[name]; !ok {
+			ui.Fatalf("Unknown plan output %s, expected one of %s", name, strings.Join(iamy.PlanRendererNames(), ", "))
+			return
+		}
+	}
+
+	targets := []iamy.ResourceSelector{}
+	for _, t := range input.Targets {
+		selector, err := iamy.ParseResourceSelector(t)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		targets = append(targets, selector)
+	}
+	if len(input.Kinds) > 0 {
+		for _, t := range targets {
+			if !selectsKind(input.Kinds, t.Type) {
+				ui.Fatalf("--target %s selects resources excluded by --only or --exclude", t)
+				return
+			}
+		}
+	}
+	phases := iamy.TargetFetchPhases(targets)
+	if len(targets) == 0 {
+		phases = iamy.TargetFetchPhases(input.Kinds)
+	}
+
+	quotaLimits, err := iamy.ParseQuotaLimits(input.QuotaLimits)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
 	yaml := iamy.YamlLoadDumper{
 		Dir: input.Dir,
 	}
-	aws := iamy.AwsFetcher{
-		SkipFetchingPolicyAndRoleDescriptions: false,
-		Debug:                                 ui.Debug,
-		HeuristicCfnMatching:                  input.HeuristicCfnMatching,
-		SkipTagged:                            input.SkipTagged,
-		IncludeTagged:                         input.IncludeTagged,
-		SkipPathPrefixes:                      input.SkipPathPrefixes,
+	ignore, err := iamy.LoadIgnoreCatalogue(input.Dir)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	hooks, err := iamy.LoadApplyHooks(input.Dir)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	protected, err := iamy.LoadProtectedResources(input.Dir)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	for _, p := range input.Protect {
+		selector, err := iamy.ParseResourceSelector(p)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		protected = append(protected, selector)
+	}
+	newFetcher := func(roleArn string) *iamy.AwsFetcher {
+		return &iamy.AwsFetcher{
+			SkipFetchingPolicyAndRoleDescriptions: false,
+			Debug:                                 ui.Debug,
+			HeuristicCfnMatching:                  input.HeuristicCfnMatching,
+			SkipTagged:                            input.SkipTagged,
+			IncludeTagged:                         input.IncludeTagged,
+			SkipPathPrefixes:                      input.SkipPathPrefixes,
+			SkipBucketPrefixes:                    input.SkipBucketPrefixes,
+			IncludeBucketPatterns:                 input.IncludeBucketPatterns,
+			IncludeControlTower:                   input.IncludeControlTower,
+			Regions:                               input.Regions,
+			Ignore:                                ignore,
+			Timings:                               input.Timings,
+			FallbackProfile:                       input.FallbackProfile,
+			FallbackRoleArn:                       input.FallbackRoleArn,
+			ConfigAggregator:                      input.ConfigAggregator,
+			AccountId:                             input.AccountId,
+			Phases:                                phases,
+			RoleArn:                               roleArn,
+		}
 	}
+	ctx := pushContext{targets, quotaLimits, hooks, protected}
 
+	stop := input.Timings.Track("load yaml")
 	allDataFromYaml, err := yaml.Load()
+	stop()
 	if err != nil {
 		ui.Fatal(err)
 		return
 	}
 
+	if input.AllAccounts {
+		pushAllAccounts(ui, input, ctx, allDataFromYaml, newFetcher)
+		return
+	}
+
+	aws := newFetcher("")
 	dataFromAws, err := aws.Fetch()
 	if err != nil {
 		ui.Fatal(err)
 		return
 	}
+	ui.usage.countResources(dataFromAws)
 
 	// find the yaml account data that matches the aws account
 	for _, dataFromYaml := range allDataFromYaml {
 		if dataFromYaml.Account.Id == dataFromAws.Account.Id {
-			sync(dataFromYaml, dataFromAws, ui)
+			if pushAccount(ui, input, ctx, aws, dataFromAws, dataFromYaml) && input.DetailedExitCode {
+				ui.Exit(2)
+			}
 			return
 		}
 	}
 
+	ui.PrintWarnings(dataFromAws.Warnings)
 	ui.Println("No files found for AWS Account ID " + dataFromAws.Account.Id)
 }
 
+// pushContext is what PushCommand loads once for every account it pushes
+type pushContext struct {
+	targets     []iamy.ResourceSelector
+	quotaLimits map[string]int
+	hooks       []iamy.ApplyHook
+	protected   []iamy.ResourceSelector
+}
+
+// pushAccount plans and pushes the changes to make the account match its
+// files, returning whether there were any changes
+func pushAccount(ui Ui, input PushCommandInput, ctx pushContext, aws *iamy.AwsFetcher, dataFromAws *iamy.AccountData, dataFromYaml iamy.AccountData) bool {
+	ui.PrintWarnings(dataFromAws.Warnings)
+	ui.PrintWarnings(pullStateWarnings(ui, input, dataFromAws.Account, aws.OptionsHash()))
+	printAwsManagedPolicyUpdates(ui, input.Dir, aws, dataFromAws)
+
+	// files of resources the fetch ignores are ignored too, so they aren't
+	// created again
+	dataFromYaml = *aws.WithoutIgnored(&dataFromYaml)
+	ui.PrintWarnings(dataFromYaml.Warnings)
+	ui.PrintWarnings(iamy.QuotaWarnings(iamy.QuotaReport(&dataFromYaml, dataFromAws, ctx.quotaLimits), input.QuotaWarnAt))
+	if input.ConfigAggregator != "" {
+		// the aggregator only has IAM data, so only IAM drift is planned
+		iamOnly := []iamy.ResourceSelector{}
+		for _, t := range []string{"user", "group", "role", "policy", "instance-profile"} {
+			selector, _ := iamy.ParseResourceSelector(t)
+			iamOnly = append(iamOnly, selector)
+		}
+		selectedAws, selectedYaml := iamy.SelectResources(dataFromAws, &dataFromYaml, iamOnly)
+		dataFromAws, dataFromYaml = selectedAws, *selectedYaml
+	}
+	if len(input.Kinds) > 0 {
+		dataFromAws, dataFromYaml = iamy.FilterResourceKinds(dataFromAws, input.Kinds), *iamy.FilterResourceKinds(&dataFromYaml, input.Kinds)
+	}
+	if len(ctx.targets) > 0 {
+		selectedAws, selectedYaml := iamy.SelectResources(dataFromAws, &dataFromYaml, ctx.targets)
+		dataFromAws, dataFromYaml = selectedAws, *selectedYaml
+	}
+	return sync(dataFromYaml, dataFromAws, aws, ui, input, ctx.hooks, ctx.protected)
+}
+
+// pushAllAccounts pushes each account with files in the directory in turn,
+// assuming the account role in it, then reports how each push went. A push
+// that fails doesn't stop the other accounts being pushed
+func pushAllAccounts(ui Ui, input PushCommandInput, ctx pushContext, allDataFromYaml []iamy.AccountData, newFetcher func(roleArn string) *iamy.AwsFetcher) {
+	results := []string{}
+	changed, failed := false, false
+	for _, dataFromYaml := range allDataFromYaml {
+		account := dataFromYaml.Account
+		roleArn := fmt.Sprintf("arn:aws:iam::%s:role/%s", account.Id, strings.TrimPrefix(input.AccountRole, "/"))
+		ui.Printf("\n%s", color.New(color.Bold).Sprintf("Pushing %s as %s", account, roleArn))
+
+		aws := newFetcher(roleArn)
+		dataFromAws, err := aws.Fetch()
+		if err == nil && dataFromAws.Account.Id != account.Id {
+			err = fmt.Errorf("%s is in account %s", roleArn, dataFromAws.Account.Id)
+		}
+		if err != nil {
+			ui.Error.Println(color.RedString("Error: %s", err))
+			results = append(results, fmt.Sprintf("%s: %s", account, color.RedString("failed to fetch, %s", err)))
+			failed = true
+			continue
+		}
+		ui.usage.countResources(dataFromAws)
+
+		exitCode := 0
+		accountUi := ui
+		accountUi.Exit = func(code int) { exitCode = code }
+		accountInput := input
+		accountInput.commandEnv = iamy.RoleCredentialsEnv(roleArn)
+		hasChanges := pushAccount(accountUi, accountInput, ctx, aws, dataFromAws, dataFromYaml)
+
+		switch {
+		case exitCode != 0:
+			results = append(results, fmt.Sprintf("%s: %s", account, color.RedString("failed")))
+			failed = true
+		case hasChanges:
+			results = append(results, fmt.Sprintf("%s: %s", account, color.YellowString("changed")))
+			changed = true
+		default:
+			results = append(results, fmt.Sprintf("%s: up to date", account))
+		}
+	}
+
+	ui.Printf("\n%s", color.New(color.Bold).Sprintf("Pushed %d accounts:", len(allDataFromYaml)))
+	for _, r := range results {
+		ui.Println("    " + r)
+	}
+	switch {
+	case failed:
+		ui.Exit(1)
+	case changed && input.DetailedExitCode:
+		ui.Exit(2)
+	}
+}
+
+// selectsKind returns whether the selectors select resources of the type
+func selectsKind(selectors []iamy.ResourceSelector, kind string) bool {
+	for _, s := range selectors {
+		if s.Type == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// pullStateWarnings checks the pull state recorded in the directory, and in
+// the SSM parameter if there is one, against the push about to happen
+func pullStateWarnings(ui Ui, input PushCommandInput, account *iamy.Account, optionsHash string) iamy.Warnings {
+	warnings := iamy.Warnings{}
+	now := time.Now()
+
+	states, err := iamy.ReadStateFile(input.Dir)
+	if err != nil {
+		ui.Fatal(err)
+		return nil
+	}
+	if state, ok := states[account.String()]; ok {
+		warnings = append(warnings, checkPullState(ui, iamy.StateFileName, state, optionsHash, input.MaxPullAge, now)...)
+	}
+
+	if input.StateParameter != "" {
+		state, err := iamy.ReadStateParameter(input.StateParameter)
+		if err != nil {
+			ui.Fatal(err)
+			return nil
+		}
+		if state != nil {
+			warnings = append(warnings, checkPullState(ui, "ssm:"+input.StateParameter, *state, optionsHash, input.MaxPullAge, now)...)
+		}
+	}
+
+	return warnings
+}
+
 func printCommands(prefix string, awsCmds iamy.CmdList, ui Ui) {
 	for _, cmd := range awsCmds {
-		cmdStr := cmd.String()
+		cmdStr := cmd.Quoted(ui.Shell)
 		if cmd.IsDestructive() {
 			cmdStr = color.RedString(cmdStr)
 		}
@@ -65,47 +342,347 @@ func printCommands(prefix string, awsCmds iamy.CmdList, ui Ui) {
 	}
 }
 
-func sync(yamlData iamy.AccountData, awsData *iamy.AccountData, ui Ui) {
+// printPlanChanges prints the resources the plan changes, with a diff of each
+// attribute it changes, either unified or side-by-side
+func printPlanChanges(changes []iamy.Drift, style string, ui Ui) {
+	render := renderDiff
+	if style == "side-by-side" {
+		render = renderSideBySideDiff
+	}
+	for _, ch := range changes {
+		switch ch.Action {
+		case "create":
+			ui.Println(color.GreenString("+ %s", ch.Resource))
+		case "delete":
+			ui.Println(color.RedString("- %s", ch.Resource))
+		case "rename":
+			ui.Println(color.YellowString("~ %s", ch.Resource) + " (renamed from " + ch.RenamedFrom + ")")
+		default:
+			ui.Println(color.YellowString("~ %s", ch.Resource))
+		}
+		for _, a := range ch.Attributes {
+			ui.Printf("    %s:", a.Name)
+			for _, line := range render(a.Diff) {
+				ui.Println("      " + line)
+			}
+		}
+	}
+}
+
+// sync plans and pushes the changes to make AWS match the files, returning
+// whether there were any changes
+func sync(yamlData iamy.AccountData, awsData *iamy.AccountData, aws *iamy.AwsFetcher, ui Ui, input PushCommandInput, hooks []iamy.ApplyHook, protected []iamy.ResourceSelector) bool {
 	ui.Debug.Printf("Generating sync commands for %s", awsData.Account.String())
 
-	awsCmds := iamy.AwsCliCmdsForSync(awsData, &yamlData)
+	ownership, err := iamy.LoadPolicyOwnership(input.Dir, yamlData.Account)
+	if err != nil {
+		ui.Fatal(err)
+		return false
+	}
+
+	stop := input.Timings.Track("plan sync")
+	plan := iamy.PlanSyncWithOptions(awsData, &yamlData, iamy.SyncOptions{
+		DisableRenameDetection: !input.DetectRenames,
+		Protected:              protected,
+		DisablePrune:           !input.Prune,
+		PolicyVersionRetention: input.VersionRetention,
+		KeepPolicyVersions:     input.KeepVersions,
+		Ownership:              ownership,
+		Iam:                    aws.IamClient(),
+	})
+	stop()
+	ui.PrintWarnings(plan.Warnings)
+	if n := plan.Warnings.Count(iamy.WarningPrune); n > 0 {
+		ui.Error.Printf("%d resources missing from the files won't be deleted, push with --prune to delete them", n)
+	}
+	if len(plan.Errors) > 0 {
+		for _, err := range plan.Errors {
+			ui.Error.Println(color.RedString("Error: %s", err))
+		}
+		ui.Exit(1)
+		return false
+	}
+
+	if input.SavedPlan != "" {
+		if err := verifySavedPlan(plan, input.SavedPlan); err != nil {
+			ui.Fatal(err)
+			return false
+		}
+		ui.Printf("Applying the plan saved in %s", input.SavedPlan)
+	}
+
+	var journal *iamy.Journal
+	if input.Journal != "" {
+		var err error
+		if journal, err = iamy.OpenJournal(input.Journal, awsData); err != nil {
+			ui.Fatal(err)
+			return false
+		}
+		if len(journal.Entries) > 0 {
+			remaining := journal.Unapplied(plan.Cmds)
+			ui.Printf("Resuming the push in %s, skipping %d commands it records as applied", input.Journal, len(plan.Cmds)-len(remaining))
+			plan.Cmds = remaining
+		}
+	}
+
+	var documentFiles []string
+	if input.DocumentDir != "" {
+		var err error
+		inline := plan.Cmds
+		if plan.Cmds, documentFiles, err = iamy.WriteDocumentFiles(plan.Cmds, input.DocumentDir); err != nil {
+			ui.Fatal(err)
+			return false
+		}
+		journal.RecordOriginals(plan.Cmds, inline)
+	}
+
+	for name, file := range input.PlanOutputs {
+		if err := writePlan(file, planRenderer(name, input), plan); err != nil {
+			ui.Fatal(err)
+			return false
+		}
+	}
+
+	// rendered plans are for review, so their commands aren't run
+	if input.Output != "text" {
+		if err := planRenderer(input.Output, input).Render(ui.Writer(), plan); err != nil {
+			ui.Fatal(err)
+			return false
+		}
+		return len(plan.Cmds) > 0
+	}
+
+	awsCmds := plan.Cmds
 	if len(awsCmds) == 0 {
 		ui.Println("Already up to date")
-		return
+		return false
 	}
 
-	ui.Println("Commands to push changes to AWS:")
+	if input.DiffStyle == "commands" {
+		ui.Println("Commands to push changes to AWS:")
+		printCommands("      ", awsCmds, ui)
+	} else {
+		ui.Println("Changes to push to AWS:")
+		printPlanChanges(plan.Drifts(), input.DiffStyle, ui)
+		ui.Printf("\n%d aws commands push the changes, %d destructive. Push with --diff commands to list them", awsCmds.Count(), awsCmds.CountDestructive())
+	}
 
-	printCommands("      ", awsCmds, ui)
+	if err := plan.CheckBlastRadius(input.BlastRadius); err != nil {
+		if !input.Force {
+			ui.Error.Println(color.RedString("Error: %s", err))
+			ui.Exit(1)
+			return false
+		}
+		ui.Error.Println(color.YellowString("Pushing with --force: %s", err))
+	}
 
 	if *dryRun {
 		ui.Println("Dry-run mode not running aws commands")
-		return
+		return true
+	}
+	if input.ConfigAggregator != "" {
+		ui.Println("Read IAM data from an AWS Config aggregator, not running aws commands")
+		return true
 	}
 	r, err := prompt(fmt.Sprintf("\nRun %d aws commands (%d destructive)? (y/N) ", awsCmds.Count(), awsCmds.CountDestructive()))
 	if err != nil {
 		ui.Fatal(err)
-		return
+		return false
 	}
 	if r == "y" {
-		for _, c := range awsCmds {
-			execCmd(c, ui)
+		executor := iamy.Executor{
+			Workers:         input.Workers,
+			RateLimit:       input.RateLimit,
+			ContinueOnError: input.ContinueOnError,
+			Journal:         journal,
+			Retry:           input.Retry,
+			OnRetry: func(c iamy.Cmd, err error, wait time.Duration) {
+				ui.Error.Printf("%s, retrying in %s", color.YellowString("Throttled"), wait.Round(time.Millisecond))
+			},
+			Run: func(c iamy.Cmd) error {
+				return execCmdWithEnv(c, ui, input.commandEnv)
+			},
+			OnVersionLimit: func(c iamy.Cmd, deleted iamy.PolicyVersion) {
+				ui.Error.Printf("%s, deleting its version %s to make room", color.YellowString("%s has the most versions it can", deleted.PolicyArn), deleted.VersionId)
+			},
+			Hooks: hooks,
+			RunHook: func(command string, event iamy.HookEvent) error {
+				return runHook(command, event, ui)
+			},
+		}
+		if !input.KeepVersions {
+			// with versions kept, the command fails rather than deleting one
+			executor.PolicyVersions = aws.ReadPolicyVersions
+		}
+		versions := iamy.NewPolicyVersionGuard(plan, aws.PolicyDefaultVersion)
+		executor.Verify = versions.Verify
+		if input.VerifyBeforeApply {
+			guard := iamy.NewConcurrentChangeGuard(plan, aws.ReadPolicyDocuments)
+			executor.Verify = func(c iamy.Cmd) error {
+				if err := versions.Verify(c); err != nil {
+					return err
+				}
+				return guard.Verify(c)
+			}
+		}
+		stop := input.Timings.Track("run commands")
+		err := executor.Apply(plan)
+		stop()
+		if failures, ok := err.(iamy.ApplyErrors); ok {
+			printFailures(failures, ui)
+			printRollbackPlan(journal, ui)
+			ui.Exit(1)
+			return false
+		}
+		if err != nil {
+			printRollbackPlan(journal, ui)
+			ui.Fatal(err)
+			return false
+		}
+		if journal != nil {
+			if err := journal.Remove(); err != nil {
+				ui.Fatal(err)
+				return false
+			}
+		}
+		if !input.KeepDocumentFiles {
+			if err := iamy.RemoveDocumentFiles(documentFiles); err != nil {
+				ui.Fatal(err)
+				return false
+			}
 		}
 	} else {
 		ui.Println("Not running aws commands")
 	}
+	return true
 }
 
-func execCmd(c iamy.Cmd, ui Ui) {
-	ui.Println("\n>", c)
-	cmd := exec.Command(c.Name, c.Args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+// printFailures summarises the commands that failed, by the resource they
+// were changing
+func printFailures(failures iamy.ApplyErrors, ui Ui) {
+	ui.Error.Printf("\n%d commands failed:", len(failures))
+	for _, f := range failures {
+		resource := f.Resource
+		if resource == "" {
+			resource = "(unknown resource)"
+		}
+		message := f.Err.Error()
+		if len(f.Skipped) > 0 {
+			message += fmt.Sprintf(" (%d dependent commands skipped)", len(f.Skipped))
+		}
+		ui.Error.Printf("    %s: %s", resource, color.RedString(message))
+	}
+}
+
+// printRollbackPlan prints the commands reversing a failed push, and how to
+// roll it back or resume it
+func printRollbackPlan(journal *iamy.Journal, ui Ui) {
+	if journal == nil || len(journal.Entries) == 0 {
+		return
+	}
+	cmds, notes := journal.RollbackPlan()
+	ui.Error.Printf("\nThe %d commands applied are recorded in %s. Push again with --journal %s to resume, or add --rollback to reverse them with:", len(journal.Entries), journal.Path, journal.Path)
+	for _, c := range cmds {
+		ui.Error.Printf("      %s", c)
+	}
+	for _, n := range notes {
+		ui.Error.Printf("    %s", color.YellowString(n))
+	}
+}
+
+// rollback reverses the commands recorded in the journal
+func rollback(ui Ui, file string) {
+	journal, err := iamy.OpenJournal(file, nil)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	if len(journal.Entries) == 0 {
+		ui.Println("Nothing to roll back")
+		return
+	}
+
+	cmds, notes := journal.RollbackPlan()
+	ui.Println("Commands to roll back the push:")
+	printCommands("      ", cmds, ui)
+	for _, n := range notes {
+		ui.Error.Printf("    %s", color.YellowString(n))
+	}
+
+	if *dryRun {
+		ui.Println("Dry-run mode not running aws commands")
+		return
+	}
+	r, err := prompt(fmt.Sprintf("\nRun %d aws commands (%d destructive)? (y/N) ", cmds.Count(), cmds.CountDestructive()))
 	if err != nil {
 		ui.Fatal(err)
 		return
 	}
+	if r != "y" {
+		ui.Println("Not running aws commands")
+		return
+	}
+	if err = journal.Rollback(func(c iamy.Cmd) error { return execCmd(c, ui) }); err != nil {
+		ui.Fatal(err)
+	}
+}
+
+// writePlan renders the plan to the file
+func writePlan(file string, renderer iamy.PlanRenderer, plan *iamy.SyncPlan) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err = renderer.Render(f, plan); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// verifySavedPlan checks the plan makes the changes of the JSON plan saved
+// in file
+func verifySavedPlan(plan *iamy.SyncPlan, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return plan.VerifySavedPlan(f)
+}
+
+// planRenderer returns the named plan renderer, writing shell scripts in the
+// script format
+func planRenderer(name string, input PushCommandInput) iamy.PlanRenderer {
+	if name == "shell" {
+		return iamy.ShellRenderer{Format: input.ScriptFormat}
+	}
+	return iamy.PlanRenderers[name]
+}
+
+// execCmd runs the command, printing its output once it finishes so the
+// output of commands run at once isn't interleaved
+func execCmd(c iamy.Cmd, ui Ui) error {
+	return execCmdWithEnv(c, ui, nil)
+}
+
+// execCmdWithEnv runs the command like execCmd, adding the environment env
+// returns, if set, eg. to run it with other credentials
+func execCmdWithEnv(c iamy.Cmd, ui Ui, env func() ([]string, error)) error {
+	cmd := exec.Command(c.Name, c.Args...)
+	if env != nil {
+		vars, err := env()
+		if err != nil {
+			return err
+		}
+		cmd.Env = append(os.Environ(), vars...)
+	}
+	out, err := cmd.CombinedOutput()
+	ui.Printf("\n> %s\n%s", c, out)
+	if err != nil {
+		return iamy.CmdError(c, string(out), err)
+	}
+	return nil
 }
 
 func prompt(prompt string) (string, error) {
@@ -117,3 +694,21 @@ func prompt(prompt string) (string, error) {
 	}
 	return strings.TrimSpace(text), nil
 }
+
+// runHook runs a hook's shell command, with the change it's run for in its
+// environment
+func runHook(command string, event iamy.HookEvent, ui Ui) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"IAMY_HOOK="+event.Hook,
+		"IAMY_STAGE="+event.Stage,
+		"IAMY_ACCOUNT="+event.Account.String(),
+		"IAMY_ACCOUNT_ID="+event.Account.Id,
+		"IAMY_RESOURCE="+event.Change.Resource,
+		"IAMY_RENAMED_FROM="+event.Change.RenamedFrom,
+		"IAMY_ACTION="+event.Change.Action,
+	)
+	out, err := cmd.CombinedOutput()
+	ui.Printf("\n> %s hook %s for %s\n%s", event.Stage, event.Hook, event.Change.Resource, out)
+	return err
+}
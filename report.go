@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type ReportCommandInput struct {
+	ExportSource
+	Kind      string
+	Format    string
+	OutputDir string
+}
+
+// ReportCommand prints a flat inventory of the users, roles or policies of
+// the accounts in the files, or of the active AWS account, for spreadsheets
+// and auditors, or writes every inventory to the output directory. The ages
+// of the users' access keys are only known for the active AWS account
+func ReportCommand(ui Ui, input ReportCommandInput) {
+	accounts := loadExportAccounts(ui, input.ExportSource)
+	if accounts == nil {
+		return
+	}
+
+	var keys map[string][]iamy.AccessKey
+	if input.Live && (input.Kind == "" || input.Kind == "users") {
+		var err error
+		keys, err = iamy.FetchAccessKeys(accounts[0])
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+	}
+	now := time.Now()
+
+	if input.OutputDir == "" {
+		rows, err := iamy.InventoryReport(input.Kind, accounts, keys, now)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		if err = iamy.WriteReport(os.Stdout, rows, input.Format); err != nil {
+			ui.Fatal(err)
+		}
+		return
+	}
+
+	if err := os.MkdirAll(input.OutputDir, 0755); err != nil {
+		ui.Fatal(err)
+		return
+	}
+	kinds := iamy.ReportKinds
+	if input.Kind != "" {
+		kinds = []string{input.Kind}
+	}
+	for _, kind := range kinds {
+		rows, err := iamy.InventoryReport(kind, accounts, keys, now)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		var b bytes.Buffer
+		if err = iamy.WriteReport(&b, rows, input.Format); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		if !writeExportFile(ui, input.OutputDir, fmt.Sprintf("%s.%s", kind, input.Format), &b, 0644) {
+			return
+		}
+	}
+}
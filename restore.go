@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type RestoreCommandInput struct {
+	Dir          string
+	Selector     string
+	List         bool
+	SnapshotFile string
+	NewName      string
+}
+
+// RestoreCommand writes back the files pull --delete archived for the
+// resources the selector selects, so the next push recreates them. With List,
+// it lists the archived files instead. With SnapshotFile, the resources are
+// restored from the snapshot instead of the archive
+func RestoreCommand(ui Ui, input RestoreCommandInput) {
+	if input.SnapshotFile != "" {
+		restoreFromSnapshot(ui, input)
+		return
+	}
+
+	var selector *iamy.ResourceSelector
+	if input.Selector != "" {
+		s, err := iamy.ParseResourceSelector(input.Selector)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		selector = &s
+	} else if !input.List {
+		ui.Fatal("A selector is required to restore, or --list to list the archived files")
+		return
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	tombstones, err := yaml.LoadTombstones()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	now := time.Now()
+	found := 0
+	for _, t := range tombstones {
+		if selector != nil && !t.Matches(*selector) {
+			continue
+		}
+		found++
+		if input.List {
+			ui.Printf("%s, deleted %s", t.File, ui.When(t.DeletedAt, now))
+			continue
+		}
+		if err := yaml.Restore(t); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Printf("Restored %s, deleted %s", t.File, ui.When(t.DeletedAt, now))
+	}
+
+	switch {
+	case found == 0 && selector != nil:
+		ui.Fatalf("No archived files match %s", selector)
+	case found == 0:
+		ui.Println("No archived files")
+	case !input.List:
+		ui.Printf("Push to recreate the %d restored resources", found)
+	}
+}
+
+// restoreFromSnapshot adds the resources the selector selects in the snapshot
+// to the files of its account
+func restoreFromSnapshot(ui Ui, input RestoreCommandInput) {
+	if input.Selector == "" {
+		ui.Fatal("A selector is required to restore from a snapshot")
+		return
+	}
+	selector, err := iamy.ParseResourceSelector(input.Selector)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	snapshot := iamy.SnapshotLoadDumper{
+		Path: input.SnapshotFile,
+	}
+	snapshotData, err := snapshot.Load()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	files := iamy.NewAccountData(snapshotData.Account.Id)
+	files.Account = snapshotData.Account
+	for i, data := range allDataFromYaml {
+		if data.Account.Id == snapshotData.Account.Id {
+			files = &allDataFromYaml[i]
+		}
+	}
+
+	restored, warnings, err := iamy.RestoreFromSnapshot(snapshotData, files, selector, input.NewName)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.PrintWarnings(warnings)
+	for _, r := range restored {
+		ui.Printf("Restoring %s/%s%s to %s from %s", r.ResourceType(), strings.TrimPrefix(r.ResourcePath(), "/"), r.ResourceName(), files.Account, input.SnapshotFile)
+	}
+
+	if *dryRun {
+		ui.Println("Dry-run mode not writing files")
+		return
+	}
+	if err = yaml.WriteResources(files.Account, restored); err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.Printf("Push to recreate the %d restored resources", len(restored))
+}
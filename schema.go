@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type SchemaCommandInput struct {
+	Kind      string
+	OutputDir string
+}
+
+func schemaKindNames() []string {
+	names := []string{}
+	for _, k := range iamy.SchemaKinds {
+		names = append(names, k.Kind)
+	}
+	return names
+}
+
+// SchemaCommand prints the JSON Schema of a kind of yaml file, or writes the
+// schema of every kind to the output directory
+func SchemaCommand(ui Ui, input SchemaCommandInput) {
+	if input.OutputDir == "" {
+		b, err := schemaJson(input.Kind)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Println(string(b))
+		return
+	}
+
+	if err := os.MkdirAll(input.OutputDir, 0755); err != nil {
+		ui.Fatal(err)
+		return
+	}
+	kinds := schemaKindNames()
+	if input.Kind != "" {
+		kinds = []string{input.Kind}
+	}
+	for _, kind := range kinds {
+		b, err := schemaJson(kind)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		file := filepath.Join(input.OutputDir, fmt.Sprintf("iamy-%s.schema.json", kind))
+		if err = ioutil.WriteFile(file, append(b, '\n'), 0644); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Printf("Wrote %s", file)
+	}
+}
+
+func schemaJson(kind string) ([]byte, error) {
+	schema, err := iamy.FileSchema(kind)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
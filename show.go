@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/envato/iamy/iamy"
+	"github.com/fatih/color"
+)
+
+type ShowCommandInput struct {
+	Dir                   string
+	Selector              string
+	Live                  bool
+	HeuristicCfnMatching  bool
+	SkipTagged            []string
+	IncludeTagged         []string
+	SkipPathPrefixes      []string
+	SkipBucketPrefixes    []string
+	IncludeBucketPatterns []string
+	IncludeControlTower   bool
+	Regions               []string
+	Timings               *iamy.Timings
+	FallbackProfile       string
+	FallbackRoleArn       string
+}
+
+// ShowCommand prints the resources the selector selects, from the files or
+// from AWS, with their trust policy summarised and their policy documents
+// highlighted, to review a resource without opening each of its files
+func ShowCommand(ui Ui, input ShowCommandInput) {
+	selector, err := iamy.ParseResourceSelector(input.Selector)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	var accounts []*iamy.AccountData
+	if input.Live {
+		ignore, err := iamy.LoadIgnoreCatalogue(input.Dir)
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		aws := iamy.AwsFetcher{
+			Debug:                 ui.Debug,
+			HeuristicCfnMatching:  input.HeuristicCfnMatching,
+			SkipTagged:            input.SkipTagged,
+			IncludeTagged:         input.IncludeTagged,
+			SkipPathPrefixes:      input.SkipPathPrefixes,
+			SkipBucketPrefixes:    input.SkipBucketPrefixes,
+			IncludeBucketPatterns: input.IncludeBucketPatterns,
+			IncludeControlTower:   input.IncludeControlTower,
+			Regions:               input.Regions,
+			Ignore:                ignore,
+			Timings:               input.Timings,
+			FallbackProfile:       input.FallbackProfile,
+			FallbackRoleArn:       input.FallbackRoleArn,
+			Phases:                iamy.TargetFetchPhases([]iamy.ResourceSelector{selector}),
+		}
+		data, err := aws.Fetch()
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.PrintWarnings(data.Warnings)
+		accounts = append(accounts, data)
+	} else {
+		yaml := iamy.YamlLoadDumper{
+			Dir: input.Dir,
+		}
+		all, err := yaml.Load()
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		for i := range all {
+			accounts = append(accounts, &all[i])
+		}
+	}
+
+	shown := 0
+	for _, data := range accounts {
+		for _, r := range data.Select(selector) {
+			if shown > 0 {
+				ui.Println("")
+			}
+			printResource(ui, data.Account, r)
+			shown++
+		}
+	}
+	if shown == 0 {
+		ui.Fatalf("No resources match %s", selector)
+	}
+}
+
+// printResource prints the resource with its attachments, trust policy
+// summary and policy documents
+func printResource(ui Ui, account *iamy.Account, r iamy.AwsResource) {
+	heading := color.New(color.Bold)
+	label := color.New(color.FgBlue)
+	field := func(name, value string) {
+		if value != "" {
+			ui.Printf("%s %s", label.Sprint(name+":"), value)
+		}
+	}
+	list := func(name string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		ui.Println(label.Sprint(name + ":"))
+		for _, v := range values {
+			ui.Println("  - " + v)
+		}
+	}
+	document := func(name string, doc *iamy.PolicyDocument) {
+		ui.Println(label.Sprint(name + ":"))
+		ui.Println(indent(highlightJson(doc.JsonString()), "  "))
+	}
+	inlinePolicies := func(policies []iamy.InlinePolicy) {
+		for _, p := range policies {
+			document("Inline policy "+p.Name, p.Policy)
+		}
+	}
+
+	ui.Println(heading.Sprintf("%s/%s%s", r.ResourceType(), strings.TrimPrefix(r.ResourcePath(), "/"), r.ResourceName()) + " in " + account.String())
+	if r.Service() == "iam" {
+		field("ARN", iamy.Arn(r, account))
+	}
+
+	switch r := r.(type) {
+	case *iamy.Role:
+		field("Description", r.Description)
+		if r.MaxSessionDuration > 0 {
+			field("Max session duration", fmt.Sprintf("%ds", r.MaxSessionDuration))
+		}
+		list("Trusted by", iamy.TrustSummary(r.AssumeRolePolicyDocument))
+		field("Permissions boundary", r.PermissionsBoundary)
+		list("Managed policies", r.Policies)
+		inlinePolicies(r.InlinePolicies)
+		document("Trust policy", r.AssumeRolePolicyDocument)
+	case *iamy.User:
+		list("Groups", r.Groups)
+		field("Permissions boundary", r.PermissionsBoundary)
+		list("Managed policies", r.Policies)
+		inlinePolicies(r.InlinePolicies)
+	case *iamy.Group:
+		list("Managed policies", r.Policies)
+		inlinePolicies(r.InlinePolicies)
+	case *iamy.Policy:
+		field("Description", r.Description)
+		document("Policy", r.Policy)
+	default:
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Println(highlightJson(string(b)))
+	}
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.Replace(s, "\n", "\n"+prefix, -1)
+}
+
+// highlightJson colours the keys, strings and other values of the JSON
+func highlightJson(s string) string {
+	key := color.New(color.FgCyan)
+	str := color.New(color.FgGreen)
+	literal := color.New(color.FgYellow)
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(s) {
+				end++
+			}
+			token := s[i:end]
+			if rest := strings.TrimLeft(s[end:], " "); strings.HasPrefix(rest, ":") {
+				b.WriteString(key.Sprint(token))
+			} else {
+				b.WriteString(str.Sprint(token))
+			}
+			i = end
+		case strings.IndexByte("-0123456789tfn", c) >= 0:
+			end := i
+			for end < len(s) && strings.IndexByte(",]} \n", s[end]) < 0 {
+				end++
+			}
+			b.WriteString(literal.Sprint(s[i:end]))
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/envato/iamy/iamy"
+	"github.com/fatih/color"
+)
+
+type TestCommandInput struct {
+	Dir             string
+	MatrixFile      string
+	JUnitFile       string
+	Environments    []string
+	Online          bool
+	Timings         *iamy.Timings
+	FallbackProfile string
+	FallbackRoleArn string
+}
+
+// TestCommand runs the test matrix, checking the principals in each
+// environment are allowed and denied the requests it expects, from the
+// policies in the files or, online, with the IAM policy simulator. It exits
+// with 1 when a test fails
+func TestCommand(ui Ui, input TestCommandInput) {
+	matrixFile := input.MatrixFile
+	if matrixFile == "" {
+		matrixFile = filepath.Join(input.Dir, iamy.TestMatrixFileName)
+	}
+	matrix, err := iamy.LoadTestMatrix(matrixFile)
+	if err != nil {
+		writeJUnitError(ui, input.JUnitFile, "test", err)
+		ui.Fatal(err)
+		return
+	}
+
+	yaml := iamy.YamlLoadDumper{
+		Dir: input.Dir,
+	}
+	allDataFromYaml, err := yaml.Load()
+	if err != nil {
+		writeJUnitError(ui, input.JUnitFile, "test", err)
+		ui.Fatal(err)
+		return
+	}
+
+	var simulator iamy.TestSimulator
+	var simulatorAccount *iamy.Account
+	if input.Online {
+		aws := &iamy.AwsFetcher{
+			Debug:           ui.Debug,
+			Timings:         input.Timings,
+			FallbackProfile: input.FallbackProfile,
+			FallbackRoleArn: input.FallbackRoleArn,
+		}
+		if simulatorAccount, err = aws.SimulatorAccount(); err != nil {
+			ui.Fatal(err)
+			return
+		}
+		simulator = aws
+	}
+
+	results, err := iamy.RunTestMatrix(matrix, allDataFromYaml, input.Environments, simulator, simulatorAccount)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+
+	passed, failed, skipped := 0, 0, 0
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			failed++
+			ui.Printf("%s %s %s: %s", color.RedString("ERROR"), r.Environment, r.Name(), r.Error)
+		case r.Skipped():
+			skipped++
+			ui.Printf("%s  %s %s: %s", color.YellowString("SKIP"), r.Environment, r.Name(), r.Reason)
+		case r.Passed():
+			passed++
+			ui.Printf("%s  %s %s", color.GreenString("PASS"), r.Environment, r.Name())
+		default:
+			failed++
+			ui.Printf("%s  %s %s: %s, %s", color.RedString("FAIL"), r.Environment, r.Name(), r.Actual, r.Reason)
+		}
+	}
+	ui.Printf("\n%d passed, %d failed, %d skipped", passed, failed, skipped)
+
+	cases := []iamy.JUnitCase{}
+	for _, r := range results {
+		cases = append(cases, r.JUnitCase())
+	}
+	writeJUnit(ui, input.JUnitFile, cases)
+
+	if failed > 0 {
+		ui.Exit(1)
+	}
+}
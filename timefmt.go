@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timestamp returns the time as ISO 8601 in the time zone reports are in
+func (ui Ui) Timestamp(t time.Time) string {
+	loc := ui.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// When returns the time as ISO 8601 followed by how long before or after now
+// it is, eg. "2022-03-04T00:00:00Z (in 3 days)", for terminal output
+func (ui Ui) When(t, now time.Time) string {
+	return fmt.Sprintf("%s (%s)", ui.Timestamp(t), relativeTime(t, now))
+}
+
+// relativeTime describes how long before or after now the time is, in its
+// largest whole unit, eg. "3 days ago" or "in 2 hours"
+func relativeTime(t, now time.Time) string {
+	d := t.Sub(now)
+	future := d > 0
+	if !future {
+		d = -d
+	}
+
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	amount := ""
+	for _, u := range units {
+		if n := int(d / u.size); n > 0 {
+			amount = fmt.Sprintf("%d %ss", n, u.name)
+			if n == 1 {
+				amount = "1 " + u.name
+			}
+			break
+		}
+	}
+	switch {
+	case amount == "":
+		return "now"
+	case future:
+		return "in " + amount
+	}
+	return amount + " ago"
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWhen(t *testing.T) {
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	melbourne, err := time.LoadLocation("Australia/Melbourne")
+	if err != nil {
+		t.Skip(err)
+	}
+	ui := Ui{Location: melbourne}
+
+	for _, c := range []struct {
+		t        time.Time
+		expected string
+	}{
+		{now.Add(3*24*time.Hour + time.Hour), "2022-03-04T12:00:00+11:00 (in 3 days)"},
+		{now.Add(-time.Hour), "2022-03-01T10:00:00+11:00 (1 hour ago)"},
+		{now.Add(-400 * 24 * time.Hour), "2021-01-25T11:00:00+11:00 (1 year ago)"},
+		{now.Add(30 * time.Second), "2022-03-01T11:00:30+11:00 (now)"},
+	} {
+		if actual := ui.When(c.t, now); actual != c.expected {
+			t.Errorf("Expected %s, got %s", c.expected, actual)
+		}
+	}
+}
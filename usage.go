@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/envato/iamy/iamy"
+	"github.com/fatih/color"
+)
+
+// A usageRecorder records the run in the opt-in usage log, when one is set
+// with --usage-log. A nil *usageRecorder records nothing
+type usageRecorder struct {
+	file      string
+	record    iamy.UsageRecord
+	timings   *iamy.Timings
+	resources map[string]map[string]int
+	done      bool
+}
+
+func newUsageRecorder(file, command string, args []string, timings *iamy.Timings) *usageRecorder {
+	if file == "" {
+		return nil
+	}
+	return &usageRecorder{
+		file:      file,
+		record:    iamy.UsageRecord{Version: Version, Command: command, Flags: flagNames(args), Started: time.Now().UTC()},
+		timings:   timings,
+		resources: map[string]map[string]int{},
+	}
+}
+
+// flagNames returns the flags in the arguments without their values, which
+// can be names of resources or files
+func flagNames(args []string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			continue
+		}
+		name := strings.SplitN(arg, "=", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// countResources records the number of resources of each type in an
+// account. An account loaded from the files and fetched from AWS is counted
+// once, by the larger count of each type
+func (u *usageRecorder) countResources(data *iamy.AccountData) {
+	if u == nil {
+		return
+	}
+	counts := u.resources[data.Account.Id]
+	if counts == nil {
+		counts = map[string]int{}
+		u.resources[data.Account.Id] = counts
+	}
+	for resourceType, n := range iamy.ResourceCounts(data) {
+		if n > counts[resourceType] {
+			counts[resourceType] = n
+		}
+	}
+}
+
+// fail records the class of the error that stopped the command
+func (u *usageRecorder) fail(v []interface{}) {
+	if u == nil || u.record.ErrorClass != "" {
+		return
+	}
+	u.record.ErrorClass = "other"
+	for _, arg := range v {
+		if err, ok := arg.(error); ok {
+			u.record.ErrorClass = iamy.ErrorClass(err)
+			break
+		}
+	}
+}
+
+// finish appends the record of the run to the usage log. Failing to write it
+// is only a warning, the log mustn't change how the command ends
+func (u *usageRecorder) finish(ui Ui, exitCode int) {
+	if u == nil || u.done {
+		return
+	}
+	u.done = true
+
+	u.record.Seconds = time.Since(u.record.Started).Seconds()
+	u.record.ExitCode = exitCode
+	u.record.Accounts = len(u.resources)
+	if len(u.resources) > 0 {
+		u.record.Resources = map[string]int{}
+		for _, counts := range u.resources {
+			for resourceType, n := range counts {
+				u.record.Resources[resourceType] += n
+			}
+		}
+	}
+	if all := u.timings.All(); len(all) > 0 {
+		u.record.PhaseSeconds = map[string]float64{}
+		for _, t := range all {
+			u.record.PhaseSeconds[t.Phase] = t.Total.Seconds()
+		}
+	}
+
+	if err := iamy.AppendUsageRecord(u.file, u.record); err != nil {
+		ui.Error.Println(color.YellowString("Warning: couldn't write the usage log: %s", err))
+	}
+}
+
+// Fatal prints the error to stderr and exits, recording its class in the
+// usage log
+func (ui Ui) Fatal(v ...interface{}) {
+	ui.usage.fail(v)
+	ui.Error.Print(v...)
+	ui.Exit(1)
+}
+
+// Fatalf prints the message to stderr and exits, recording the class of an
+// error argument in the usage log
+func (ui Ui) Fatalf(format string, v ...interface{}) {
+	ui.usage.fail(v)
+	ui.Error.Printf(format, v...)
+	ui.Exit(1)
+}
+
+type UsageSummaryCommandInput struct {
+	LogFile string
+	Json    bool
+}
+
+// UsageSummaryCommand summarises the usage log by command, as a table or as
+// JSON for the org's telemetry
+func UsageSummaryCommand(ui Ui, input UsageSummaryCommandInput) {
+	records, err := iamy.ReadUsageLog(input.LogFile)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	summary := iamy.SummariseUsage(records)
+
+	if input.Json {
+		b, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			ui.Fatal(err)
+			return
+		}
+		ui.Println(string(b))
+		return
+	}
+
+	if summary.Runs == 0 {
+		ui.Println("No runs recorded")
+		return
+	}
+	ui.Printf("%d runs from %s to %s", summary.Runs, ui.Timestamp(summary.From), ui.Timestamp(summary.To))
+	ui.Printf("%-24s %6s %8s %10s %10s %10s  %s", "Command", "Runs", "Failures", "Median", "Max", "Resources", "Slowest phase")
+	for _, c := range summary.Commands {
+		ui.Printf("%-24s %6d %8d %10s %10s %10d  %s", c.Command, c.Runs, c.Failures,
+			secondsDuration(c.MedianSeconds), secondsDuration(c.MaxSeconds), c.MaxResources, c.SlowestPhase)
+	}
+
+	for _, c := range summary.Commands {
+		if len(c.ErrorClasses) == 0 {
+			continue
+		}
+		classes := []string{}
+		for class, n := range c.ErrorClasses {
+			classes = append(classes, fmt.Sprintf("%s: %d", class, n))
+		}
+		sort.Strings(classes)
+		ui.Printf("%s failed with %s", c.Command, strings.Join(classes, ", "))
+	}
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
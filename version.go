@@ -7,8 +7,10 @@ import (
 	"os"
 	"reflect"
 	"regexp"
+	"time"
 
 	"github.com/blang/semver/v4"
+	"github.com/envato/iamy/iamy"
 )
 
 func checkVersion() error {
@@ -61,3 +63,30 @@ func versionOk(current semver.Version, required semver.Version) (bool, error) {
 	}
 	return true, nil
 }
+
+// checkPullState compares how an account was last pulled with how it's about
+// to be pushed, returning warnings for differences that can change the plan
+func checkPullState(ui Ui, source string, state iamy.PullState, optionsHash string, maxAge time.Duration, now time.Time) iamy.Warnings {
+	warnings := iamy.Warnings{}
+
+	if current, err := semver.ParseTolerant(Version); err == nil {
+		if pulled, err := semver.ParseTolerant(state.Version); err == nil {
+			if current.Major < pulled.Major || (current.Major == pulled.Major && current.Minor < pulled.Minor) {
+				warnings.Add(iamy.WarningCompatibility, source,
+					fmt.Sprintf("Last pulled with IAMy %s, which is newer than this version (%s). Upgrade to avoid behaviour differences", state.Version, Version))
+			}
+		}
+	}
+
+	if maxAge > 0 && now.Sub(state.LastPull) > maxAge {
+		warnings.Add(iamy.WarningCompatibility, source,
+			fmt.Sprintf("Last pulled %s, changes made in AWS since then will be reverted. Pull first to pick them up", ui.When(state.LastPull, now)))
+	}
+
+	if state.OptionsHash != "" && state.OptionsHash != optionsHash {
+		warnings.Add(iamy.WarningCompatibility, source,
+			"Last pulled with different pull options (--skip-tagged, --include-tagged, --skip-path-prefix, --skip-bucket-prefix, --include-bucket-pattern, --region, --accurate-cfn, --include-control-tower or the rules in "+iamy.IgnoreFileName+"), resources may be created or deleted unexpectedly")
+	}
+
+	return warnings
+}
@@ -1,6 +1,11 @@
 package main
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/envato/iamy/iamy"
+)
 
 func TestCheckVersionIsHigher(t *testing.T) {
 	versionFileName = "fixtures/0.0.1"
@@ -57,3 +62,20 @@ func TestCheckVersionWithPreRelease(t *testing.T) {
 		t.Errorf("Received an unexpected error %s", err)
 	}
 }
+
+func TestCheckPullState(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "1.2.0"
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	state := iamy.PullState{Version: "1.2.5", LastPull: now.Add(-time.Hour), OptionsHash: "abc"}
+
+	if warnings := checkPullState(Ui{}, ".iamy-state", state, "abc", 24*time.Hour, now); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for a recent pull with a patch version difference, got %v", warnings)
+	}
+
+	state = iamy.PullState{Version: "1.3.0", LastPull: now.Add(-48 * time.Hour), OptionsHash: "def"}
+	warnings := checkPullState(Ui{}, ".iamy-state", state, "abc", 24*time.Hour, now)
+	if warnings.Count(iamy.WarningCompatibility) != 3 {
+		t.Errorf("Expected warnings for the version, age and options, got %v", warnings)
+	}
+}
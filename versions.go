@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/envato/iamy/iamy"
+)
+
+type VersionsCommandInput struct {
+	Dir                 string
+	SkipTagged          []string
+	IncludeTagged       []string
+	SkipPathPrefixes    []string
+	IncludeControlTower bool
+	Timings             *iamy.Timings
+	FallbackProfile     string
+	FallbackRoleArn     string
+	Prune               bool
+	Keep                int
+}
+
+// VersionsCommand lists the stored versions of the customer managed policies
+// in the account, or prunes the nondefault versions beyond the most recent
+func VersionsCommand(ui Ui, input VersionsCommandInput) {
+	if input.Keep < 1 || input.Keep > iamy.MaxAllowedPolicyVersions {
+		ui.Fatalf("--keep must be between 1 and %d", iamy.MaxAllowedPolicyVersions)
+		return
+	}
+
+	ignore, err := iamy.LoadIgnoreCatalogue(input.Dir)
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	aws := iamy.AwsFetcher{
+		Debug:               ui.Debug,
+		SkipTagged:          input.SkipTagged,
+		IncludeTagged:       input.IncludeTagged,
+		SkipPathPrefixes:    input.SkipPathPrefixes,
+		IncludeControlTower: input.IncludeControlTower,
+		Ignore:              ignore,
+		Timings:             input.Timings,
+		FallbackProfile:     input.FallbackProfile,
+		FallbackRoleArn:     input.FallbackRoleArn,
+		Phases:              []string{"iam"},
+	}
+	data, err := aws.Fetch()
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	ui.PrintWarnings(data.Warnings)
+
+	versions := data.PolicyVersions()
+	if !input.Prune {
+		now := time.Now()
+		for _, v := range versions {
+			line := fmt.Sprintf("%s %s %s", v.PolicyArn, v.VersionId, ui.When(v.Created, now))
+			if v.IsDefault {
+				line += " (default)"
+			}
+			ui.Println(line)
+		}
+		return
+	}
+
+	cmds := iamy.PolicyVersionDeleteCmds(iamy.PrunablePolicyVersions(versions, input.Keep))
+	if len(cmds) == 0 {
+		ui.Printf("No policies have more than %d versions", input.Keep)
+		return
+	}
+
+	ui.Println("Commands to prune policy versions:")
+	printCommands("      ", cmds, ui)
+
+	if *dryRun {
+		ui.Println("Dry-run mode not running aws commands")
+		return
+	}
+	r, err := prompt(fmt.Sprintf("\nRun %d aws commands (%d destructive)? (y/N) ", cmds.Count(), cmds.CountDestructive()))
+	if err != nil {
+		ui.Fatal(err)
+		return
+	}
+	if r != "y" {
+		ui.Println("Not running aws commands")
+		return
+	}
+	for _, c := range cmds {
+		if err := execCmd(c, ui); err != nil {
+			ui.Fatal(err)
+			return
+		}
+	}
+}